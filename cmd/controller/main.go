@@ -30,6 +30,7 @@ func main() {
 	ctx, op := operator.NewOperator(coreoperator.NewOperator())
 
 	aliCloudProvider := cloudprovider.New(
+		ctx,
 		op.GetClient(),
 		op.EventRecorder,
 		op.InstanceTypeProvider,
@@ -58,6 +59,9 @@ func main() {
 			op.InstanceProvider, op.InstanceTypeProvider,
 			op.PricingProvider, op.VSwitchProvider,
 			op.SecurityGroupProvider, op.ImageProvider,
+			op.CapacityReservationProvider,
+			op.KeyPairProvider,
+			op.QuotaProvider,
 		)...).
 		Start(ctx)
 }
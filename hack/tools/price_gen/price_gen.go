@@ -18,6 +18,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"os"
 
 	"github.com/cloudpilot-ai/priceserver/pkg/apis"
@@ -25,6 +26,9 @@ import (
 )
 
 func main() {
+	output := flag.String("output", "pkg/providers/pricing/initial-on-demand-prices.json", "The file to write the on-demand prices to")
+	flag.Parse()
+
 	queryClient, err := tools.NewQueryClient("https://pre-price.cloudpilot.ai", tools.AlibabaCloudProvider, "")
 	if err != nil {
 		panic(err)
@@ -51,7 +55,7 @@ func main() {
 		panic(err)
 	}
 
-	if err := os.WriteFile("pkg/providers/pricing/initial-on-demand-prices.json", data, 0644); err != nil {
+	if err := os.WriteFile(*output, data, 0644); err != nil {
 		panic(err)
 	}
 }
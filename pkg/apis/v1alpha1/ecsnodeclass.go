@@ -19,26 +19,49 @@ package v1alpha1
 import (
 	"fmt"
 	"log"
+	"regexp"
 	"strings"
+	"text/template"
 
 	"github.com/mitchellh/hashstructure/v2"
 	"github.com/samber/lo"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
 	VSwitchSelectionPolicyBalanced = "balanced"
+
+	// maxHostnameLength is the longest hostname of the Linux instances ECS accepts
+	maxHostnameLength = 64
+	// maxInstanceNameLength is the longest instance name ECS accepts
+	maxInstanceNameLength = 128
+
+	// DefaultInstanceNameTemplate names the instances after their NodeClaims, which are named after their NodePools
+	DefaultInstanceNameTemplate = "karpenter-{{ .NodeClaim }}"
+
+	TenancyDefault = "default"
+	TenancyHost    = "host"
+
+	SpotStrategySpotAsPriceGo      = "SpotAsPriceGo"
+	SpotStrategySpotWithPriceLimit = "SpotWithPriceLimit"
+
+	DeploymentSetStrategyAvailability = "Availability"
+	DeploymentSetStrategyLowLatency   = "LowLatency"
 )
 
 // ECSNodeClassSpec is the top level specification for the AlibabaCloud Karpenter Provider.
 // This will contain the configuration necessary to launch instances in AlibabaCloud.
 // +kubebuilder:validation:XValidation:rule="!(has(self.passwordInherit) ? (self.passwordInherit ? has(self.password) : false) : false)",message="password cannot be set when passwordInherit is true"
+// +kubebuilder:validation:XValidation:rule="!has(self.dedicatedHostId) || (has(self.tenancy) && self.tenancy == 'host')",message="dedicatedHostId requires tenancy to be host"
+// +kubebuilder:validation:XValidation:rule="has(self.spotPriceLimit) == (has(self.spotStrategy) && self.spotStrategy == 'SpotWithPriceLimit')",message="spotPriceLimit must be set if and only if spotStrategy is SpotWithPriceLimit"
+// +kubebuilder:validation:XValidation:rule="!has(self.eipAssociation) || !has(self.internetMaxBandwidthOut) || self.internetMaxBandwidthOut == 0",message="eipAssociation cannot be set with an internetMaxBandwidthOut greater than 0"
 type ECSNodeClassSpec struct {
 	// VSwitchSelectorTerms is a list of or vSwitch selector terms. The terms are ORed.
 	// +kubebuilder:validation:XValidation:message="vSwitchSelectorTerms cannot be empty",rule="self.size() != 0"
 	// +kubebuilder:validation:XValidation:message="expected at least one, got none, ['tags', 'id']",rule="self.all(x, has(x.tags) || has(x.id))"
-	// +kubebuilder:validation:XValidation:message="'id' is mutually exclusive, cannot be set with a combination of other fields in vSwitchSelectorTerms",rule="!self.all(x, has(x.id) && has(x.tags))"
+	// +kubebuilder:validation:XValidation:message="'id' is mutually exclusive, cannot be set with a combination of other fields in vSwitchSelectorTerms",rule="!self.exists(x, has(x.id) && has(x.tags))"
 	// +kubebuilder:validation:MaxItems:=30
 	// +required
 	VSwitchSelectorTerms []VSwitchSelectorTerm `json:"vSwitchSelectorTerms" hash:"ignore"`
@@ -46,14 +69,39 @@ type ECSNodeClassSpec struct {
 	// +kubebuilder:validation:Enum:=balanced;cheapest
 	// +kubebuilder:default:=cheapest
 	VSwitchSelectionPolicy string `json:"vSwitchSelectionPolicy,omitempty"`
+	// VSwitchZonesFromNodePools resolves the vSwitches matching the vSwitchSelectorTerms in the zones the NodePools
+	// of the ECSNodeClass allow only, keeping the vSwitches with available IP addresses. The NodePoolZonesCovered
+	// condition reports the zones the NodePools require which are left without a vSwitch.
+	// +optional
+	VSwitchZonesFromNodePools bool `json:"vSwitchZonesFromNodePools,omitempty" hash:"ignore"`
+	// ZoneExclusions are the zones no instance is launched in, e.g. the zones with chronic capacity problems. The
+	// vSwitches in them are left out of the resolved vSwitches and no instance type is offered in them, whatever the
+	// zones the NodePools allow. The nodes already running in them drift.
+	// +kubebuilder:validation:MaxItems:=30
+	// +kubebuilder:validation:items:Pattern:="^[a-z]+-[a-z0-9]+(-[a-z0-9]+)*$"
+	// +optional
+	ZoneExclusions []string `json:"zoneExclusions,omitempty" hash:"ignore"`
+	// VPCID is the VPC the instances are launched into. The vSwitches and security groups selected by tags or name
+	// are discovered in it only, and the ECSNodeClass fails validation if the other selectors resolve resources
+	// outside it. Without it, the security groups are discovered in the VPC of the resolved vSwitches.
+	// +kubebuilder:validation:Pattern:="vpc-[0-9a-z]+"
+	// +optional
+	VPCID string `json:"vpcId,omitempty" hash:"ignore"`
 	// SecurityGroupSelectorTerms is a list of or security group selector terms. The terms are ORed.
 	// +kubebuilder:validation:XValidation:message="securityGroupSelectorTerms cannot be empty",rule="self.size() != 0"
 	// +kubebuilder:validation:XValidation:message="expected at least one, got none, ['tags', 'id', 'name']",rule="self.all(x, has(x.tags) || has(x.id) || has(x.name))"
-	// +kubebuilder:validation:XValidation:message="'id' is mutually exclusive, cannot be set with a combination of other fields in securityGroupSelectorTerms",rule="!self.all(x, has(x.id) && (has(x.tags) || has(x.name)))"
-	// +kubebuilder:validation:XValidation:message="'name' is mutually exclusive, cannot be set with a combination of other fields in securityGroupSelectorTerms",rule="!self.all(x, has(x.name) && (has(x.tags) || has(x.id)))"
+	// +kubebuilder:validation:XValidation:message="'id' is mutually exclusive, cannot be set with a combination of other fields in securityGroupSelectorTerms",rule="!self.exists(x, has(x.id) && (has(x.tags) || has(x.name)))"
+	// +kubebuilder:validation:XValidation:message="'name' is mutually exclusive, cannot be set with a combination of other fields in securityGroupSelectorTerms",rule="!self.exists(x, has(x.name) && (has(x.tags) || has(x.id)))"
 	// +kubebuilder:validation:MaxItems:=30
 	// +required
 	SecurityGroupSelectorTerms []SecurityGroupSelectorTerm `json:"securityGroupSelectorTerms" hash:"ignore"`
+	// CapacityReservationSelectorTerms is a list of or capacity reservation selector terms. The terms are ORed.
+	// The instances are launched into the matching capacity reservations first, then into the public pool.
+	// +kubebuilder:validation:XValidation:message="expected at least one, got none, ['tags', 'id']",rule="self.all(x, has(x.tags) || has(x.id))"
+	// +kubebuilder:validation:XValidation:message="'id' is mutually exclusive, cannot be set with a combination of other fields in capacityReservationSelectorTerms",rule="!self.exists(x, has(x.id) && has(x.tags))"
+	// +kubebuilder:validation:MaxItems:=30
+	// +optional
+	CapacityReservationSelectorTerms []CapacityReservationSelectorTerm `json:"capacityReservationSelectorTerms,omitempty" hash:"ignore"`
 	// ImageSelectorTerms is a list of or image selector terms. The terms are ORed.
 	// +kubebuilder:validation:XValidation:message="expected at least one, got none, ['id', 'alias']",rule="self.all(x, has(x.id) || has(x.alias))"
 	// +kubebuilder:validation:XValidation:message="'id' is mutually exclusive, cannot be set with a combination of other fields in imageSelectorTerms",rule="!self.exists(x, has(x.id) && (has(x.alias)))"
@@ -70,7 +118,16 @@ type ECSNodeClassSpec struct {
 	// +kubebuilder:validation:XValidation:message="evictionSoft OwnerKey does not have a matching evictionSoftGracePeriod",rule="has(self.evictionSoft) ? self.evictionSoft.all(e, (e in self.evictionSoftGracePeriod)):true"
 	// +kubebuilder:validation:XValidation:message="evictionSoftGracePeriod OwnerKey does not have a matching evictionSoft",rule="has(self.evictionSoftGracePeriod) ? self.evictionSoftGracePeriod.all(e, (e in self.evictionSoft)):true"
 	// +optional
-	KubeletConfiguration *KubeletConfiguration `json:"kubeletConfiguration,omitempty"`
+	KubeletConfiguration *KubeletConfiguration `json:"kubeletConfiguration,omitempty" hash:"ignore"`
+	// DefaultMaxPods is the max pods of the nodes when the kubeletConfiguration doesn't set maxPods. It overrides
+	// the default derived from the CNI of the cluster, e.g. for images which ship another max pods default.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	DefaultMaxPods *int32 `json:"defaultMaxPods,omitempty" hash:"ignore"`
+	// MinResources is the floor of the instance types offered for the NodeClass, the instance types with fewer
+	// vCPUs or less memory are filtered out on top of the requirements of the NodePools.
+	// +optional
+	MinResources *MinResources `json:"minResources,omitempty" hash:"ignore"`
 	// SystemDisk to be applied to provisioned nodes.
 	// +optional
 	SystemDisk *SystemDisk `json:"systemDisk,omitempty"`
@@ -86,8 +143,12 @@ type ECSNodeClassSpec struct {
 	// FormatDataDisk specifies whether to mount data disks to an existing instance when adding it to the cluster. This allows you to add data disks for storing container data and images. If FormatDataDisk is set to true, and the Elastic Compute Service (ECS) instances already have data disks mounted, but the file system on the last data disk is not initialized, the system will automatically format the disk to ext4 and mount it to /var/lib/containerd and /var/lib/kubelet.
 	// +kubebuilder:default:=false
 	// +optional
-	FormatDataDisk bool `json:"formatDataDisk,omitempty"`
+	FormatDataDisk bool `json:"formatDataDisk,omitempty" hash:"ignore"`
 	// Tags to be applied on ecs resources like instances and launch templates.
+	// An instance has at most 20 tags, 7 of them are reserved by karpenter.
+	// Tag values are Go templates rendered with the .ClusterID, .NodePool, .NodeClass and .NodeClaim of the instance,
+	// e.g. team: "{{ .NodePool }}".
+	// +kubebuilder:validation:MaxProperties=13
 	// +kubebuilder:validation:XValidation:message="empty tag keys aren't supported",rule="self.all(k, k != '')"
 	// +kubebuilder:validation:XValidation:message="tag contains a restricted tag matching ecs:ecs-cluster-name",rule="self.all(k, k !='ecs:ecs-cluster-name')"
 	// +kubebuilder:validation:XValidation:message="tag contains a restricted tag matching kubernetes.io/cluster/",rule="self.all(k, !k.startsWith('kubernetes.io/cluster') )"
@@ -97,12 +158,32 @@ type ECSNodeClassSpec struct {
 	// +optional
 	Tags map[string]string `json:"tags,omitempty"`
 	// ResourceGroupID is the resource group id in ECS
+	// vSwitches and security groups are discovered in the resource group and instances are launched into it.
+	// It takes precedence over the resource group configured for the controller.
 	// +kubebuilder:validation:Pattern:="rg-[0-9a-z]+"
 	// +optional
 	ResourceGroupID string `json:"resourceGroupId,omitempty"`
 	// UserData to be applied to the provisioned nodes and executed before/after the node is registered.
 	// +optional
-	UserData *string `json:"userData,omitempty"`
+	UserData *string `json:"userData,omitempty" hash:"ignore"`
+	// HostnameTemplate is the hostname of the instances, a Go template rendered with the .ClusterID, .NodePool,
+	// .NodeClass and .NodeClaim of the instance, e.g. "{{ .NodePool }}-{{ .NodeClaim }}". It must reference the
+	// .NodeClaim so the hostnames are unique, and render to a lowercase RFC 1123 subdomain of at most 64 characters.
+	// Without it, ECS names the instances.
+	// +kubebuilder:validation:MaxLength:=256
+	// +optional
+	HostnameTemplate string `json:"hostnameTemplate,omitempty"`
+	// InstanceNameTemplate is the name of the instances in the ECS console, a Go template rendered with the .ClusterID,
+	// .NodePool, .NodeClass and .NodeClaim of the instance. The names longer than the 128 characters ECS allows are
+	// truncated, they must start with a letter and only contain letters, digits, periods, underscores, colons and hyphens.
+	// Defaults to "karpenter-{{ .NodeClaim }}", e.g. karpenter-default-abcde.
+	// +kubebuilder:validation:MaxLength:=256
+	// +optional
+	InstanceNameTemplate string `json:"instanceNameTemplate,omitempty" hash:"ignore"`
+	// DNS is the resolver configuration of the nodes, the bootstrap script of ACK clusters writes it to /etc/resolv.conf
+	// before the node is registered.
+	// +optional
+	DNS *DNSConfiguration `json:"dns,omitempty"`
 	// Password is the password for ecs for root.
 	// +kubebuilder:validation:Pattern=`^[A-Za-z\d~!@#$%^&*()_+\-=\[\]{}|\\:;"'<>,.?/]{8,30}$`
 	//+optional
@@ -115,6 +196,161 @@ type ECSNodeClassSpec struct {
 	// +kubebuilder:default:=false
 	// +optional
 	PasswordInherit bool `json:"passwordInherit,omitempty"`
+	// RAMRoleName is the name of the RAM role attached to the instances, the workloads and the kubelet on the
+	// nodes call AlibabaCloud APIs with its credentials, e.g. the CSI drivers. The role must be trusted by ECS.
+	// +kubebuilder:validation:Pattern:=`^[a-zA-Z0-9.-]{1,64}$`
+	// +optional
+	RAMRoleName string `json:"ramRoleName,omitempty"`
+	// MetadataOptions for the generated instances. When omitted, the metadata service is left as ECS launches
+	// it. When set, the fields it leaves out default to the metadata service enabled and the security hardening
+	// mode required to access it:
+	//   httpEndpoint: enabled
+	//   httpTokens: required
+	// +optional
+	MetadataOptions *MetadataOptions `json:"metadataOptions,omitempty"`
+	// DeploymentSet spreads the instances across physical servers to reduce correlated hardware failures,
+	// or places them close to each other in the network with the LowLatency strategy.
+	// +optional
+	DeploymentSet *DeploymentSet `json:"deploymentSet,omitempty"`
+	// Tenancy of the instances, host launches the instances on-demand on dedicated hosts.
+	// +kubebuilder:validation:Enum:={default,host}
+	// +optional
+	Tenancy string `json:"tenancy,omitempty"`
+	// DedicatedHostID is the dedicated host to launch the instances on. Without it, an available
+	// dedicated host which supports the instance type is selected.
+	// +kubebuilder:validation:Pattern:="dh-[0-9a-z]+"
+	// +optional
+	DedicatedHostID *string `json:"dedicatedHostId,omitempty"`
+	// SpotStrategy of the spot instances. SpotAsPriceGo bids the current market price, SpotWithPriceLimit
+	// bids at most the spotPriceLimit. When omitted, SpotAsPriceGo is used.
+	// +kubebuilder:validation:Enum:={SpotAsPriceGo,SpotWithPriceLimit}
+	// +optional
+	SpotStrategy string `json:"spotStrategy,omitempty"`
+	// SpotPriceLimit is the max hourly price of the spot instances with the SpotWithPriceLimit spotStrategy.
+	// A spot instance is not launched when the market price is higher.
+	// +kubebuilder:validation:Pattern=`^[0-9]*\.?[0-9]+$`
+	// +optional
+	SpotPriceLimit *string `json:"spotPriceLimit,omitempty"`
+	// InternetMaxBandwidthOut is the max outbound public bandwidth of the instances in Mbit/s. When it's greater
+	// than 0, a public IP address charged by traffic is assigned to the instances.
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:validation:Maximum:=100
+	// +optional
+	InternetMaxBandwidthOut *int32 `json:"internetMaxBandwidthOut,omitempty"`
+	// EIPAssociation allocates an elastic IP address for every instance and associates it with the instance
+	// after the launch, the elastic IP address is released with the instance. It takes one of the instance tags.
+	// +optional
+	EIPAssociation *EIPAssociation `json:"eipAssociation,omitempty"`
+	// IPv6 assigns IPv6 addresses to the primary network interface of the instances, for dual-stack clusters.
+	// Only the vSwitches with an IPv6 CIDR block are launched into.
+	// +optional
+	IPv6 *IPv6 `json:"ipv6,omitempty"`
+	// Terway is the ENI configuration of Terway on the nodes, it only applies to the clusters running Terway. It's
+	// written to the ConfigMap karpenter-terway-<ECSNodeClass> of kube-system, the nodes are labeled with terway-config
+	// so Terway merges it into the eni_conf of the cluster. A change of it is reported as user data drift.
+	// +optional
+	Terway *TerwayConfiguration `json:"terway,omitempty" hash:"ignore"`
+}
+
+// TerwayConfiguration is the ENI configuration of Terway on the nodes
+type TerwayConfiguration struct {
+	// ENITrunking enables the trunk ENI of Terway for the pods with dedicated ENIs. The trunk ENI takes one of the
+	// secondary ENIs, and only the instance types supporting trunk ENIs are offered.
+	// +optional
+	ENITrunking bool `json:"eniTrunking,omitempty"`
+	// ENICount is the number of secondary ENIs Terway allocates the pod IPs from, including the trunk ENI. Only the
+	// instance types with at least as many secondary ENIs are offered. Defaults to all the secondary ENIs.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	ENICount *int32 `json:"eniCount,omitempty"`
+}
+
+// MinResources is the minimum vCPUs and memory of the instance types
+type MinResources struct {
+	// CPU is the minimum number of vCPUs.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	CPU *int32 `json:"cpu,omitempty"`
+	// Memory is the minimum memory, compared against the memory of the instance type before the VM overhead.
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+}
+
+// IPv6 is the IPv6 addresses assigned to every instance
+type IPv6 struct {
+	// AddressCount is the number of IPv6 addresses assigned to the primary network interface. Defaults to 1.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=10
+	// +optional
+	AddressCount *int32 `json:"addressCount,omitempty"`
+}
+
+// EIPAssociation is the elastic IP address allocated for every instance
+type EIPAssociation struct {
+	// Bandwidth is the max bandwidth of the elastic IP address in Mbit/s. Defaults to 5.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=200
+	// +optional
+	Bandwidth *int32 `json:"bandwidth,omitempty"`
+	// InternetChargeType of the elastic IP address. Defaults to PayByTraffic.
+	// +kubebuilder:validation:Enum:={PayByTraffic,PayByBandwidth}
+	// +optional
+	InternetChargeType *string `json:"internetChargeType,omitempty"`
+}
+
+// DeploymentSet is the deployment set to launch the instances into, either an existing one or
+// one managed by karpenter for each NodePool.
+// +kubebuilder:validation:XValidation:message="exactly one of 'id' and 'managed' must be set",rule="has(self.id) != (has(self.managed) && self.managed)"
+// +kubebuilder:validation:XValidation:message="strategy requires managed to be true",rule="!has(self.strategy) || (has(self.managed) && self.managed)"
+type DeploymentSet struct {
+	// ID is the ID of an existing deployment set.
+	// +kubebuilder:validation:Pattern:="ds-[0-9a-z]+"
+	// +optional
+	ID *string `json:"id,omitempty"`
+	// Managed creates a deployment set for each NodePool if it doesn't exist and reuses it.
+	// +optional
+	Managed bool `json:"managed,omitempty"`
+	// Strategy of the managed deployment sets. Availability spreads the instances across physical servers,
+	// LowLatency places them close to each other in the network of a zone for tightly coupled workloads,
+	// e.g. HPC and distributed training. When omitted, Availability is used.
+	// +kubebuilder:validation:Enum:={Availability,LowLatency}
+	// +optional
+	Strategy string `json:"strategy,omitempty"`
+}
+
+// DNSConfiguration is the resolver configuration of the nodes
+type DNSConfiguration struct {
+	// Nameservers are the IP addresses of the nameservers, they replace the nameservers of the node.
+	// +kubebuilder:validation:MinItems:=1
+	// +kubebuilder:validation:MaxItems:=3
+	// +optional
+	Nameservers []string `json:"nameservers,omitempty"`
+	// Searches are the search domains, they replace the search domains of the node.
+	// +kubebuilder:validation:MinItems:=1
+	// +kubebuilder:validation:MaxItems:=6
+	// +optional
+	Searches []string `json:"searches,omitempty"`
+}
+
+// MetadataOptions contains parameters for specifying the exposure of the
+// instance metadata service to provisioned ECS nodes.
+type MetadataOptions struct {
+	// HTTPEndpoint enables or disables the access channel of the instance metadata
+	// service on provisioned nodes. Defaults to enabled.
+	// +kubebuilder:validation:Enum:={enabled,disabled}
+	// +optional
+	HTTPEndpoint *string `json:"httpEndpoint,omitempty"`
+	// HTTPPutResponseHopLimit is the number of network hops the response of the
+	// instance metadata service can travel. Not set by default.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=64
+	// +optional
+	HTTPPutResponseHopLimit *int32 `json:"httpPutResponseHopLimit,omitempty"`
+	// HTTPTokens determines whether the security hardening mode (IMDSv2) is required
+	// to access the instance metadata. Defaults to required.
+	// +kubebuilder:validation:Enum:={required,optional}
+	// +optional
+	HTTPTokens *string `json:"httpTokens,omitempty"`
 }
 
 // VSwitchSelectorTerm defines selection logic for a vSwitch used by Karpenter to launch nodes.
@@ -122,6 +358,7 @@ type VSwitchSelectorTerm struct {
 	// Tags is a map of key/value tags used to select vSwitches
 	// Specifying '*' for a value selects all values for a given tag key.
 	// +kubebuilder:validation:XValidation:message="empty tag keys aren't supported",rule="self.all(k, k != '')"
+	// +kubebuilder:validation:MinProperties:=1
 	// +kubebuilder:validation:MaxProperties:=20
 	// +optional
 	Tags map[string]string `json:"tags,omitempty"`
@@ -137,6 +374,7 @@ type SecurityGroupSelectorTerm struct {
 	// Tags is a map of key/value tags used to select vSwitches
 	// Specifying '*' for a value selects all values for a given tag key.
 	// +kubebuilder:validation:XValidation:message="empty tag keys aren't supported",rule="self.all(k, k != '')"
+	// +kubebuilder:validation:MinProperties:=1
 	// +kubebuilder:validation:MaxProperties:=20
 	// +optional
 	Tags map[string]string `json:"tags,omitempty"`
@@ -149,13 +387,29 @@ type SecurityGroupSelectorTerm struct {
 	Name string `json:"name,omitempty"`
 }
 
+// CapacityReservationSelectorTerm defines selection logic for a capacity reservation used by Karpenter to launch nodes.
+// If multiple fields are used for selection, the requirements are ANDed.
+type CapacityReservationSelectorTerm struct {
+	// Tags is a map of key/value tags used to select capacity reservations
+	// Specifying '*' for a value selects all values for a given tag key.
+	// +kubebuilder:validation:XValidation:message="empty tag keys aren't supported",rule="self.all(k, k != '')"
+	// +kubebuilder:validation:MinProperties:=1
+	// +kubebuilder:validation:MaxProperties:=20
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+	// ID is the capacity reservation id in ECS
+	// +kubebuilder:validation:Pattern:="crp-[0-9a-z]+"
+	// +optional
+	ID string `json:"id,omitempty"`
+}
+
 // ImageSelectorTerm defines selection logic for an image used by Karpenter to launch nodes.
 // If multiple fields are used for selection, the requirements are ANDed.
 type ImageSelectorTerm struct {
 	// Alias specifies which ACK image to select.
 	// Each alias consists of a family and an image version, specified as "family@version".
 	// Valid families include: AlibabaCloudLinux3,ContainerOS
-	// Currently only supports version pinning to the latest image release, with that images version format (ex: "aliyun3@latest").
+	// The version is either latest or the release date of an image (ex: "AlibabaCloudLinux3@20240819").
 	// Setting the version to latest will result in drift when a new Image is released. This is **not** recommended for production environments.
 	// +kubebuilder:validation:XValidation:message="'alias' is improperly formatted, must match the format 'family'",rule="self.matches('^[a-zA-Z0-9]+@.+$')"
 	// +kubebuilder:validation:XValidation:message="family is not supported, must be one of the following: 'AlibabaCloudLinux3,ContainerOS'",rule="self.find('^[^@]+') in ['AlibabaCloudLinux3', 'ContainerOS']"
@@ -234,8 +488,18 @@ type KubeletConfiguration struct {
 	// CPUCFSQuota enables CPU CFS quota enforcement for containers that specify CPU limits.
 	// +optional
 	CPUCFSQuota *bool `json:"cpuCFSQuota,omitempty"`
+	// RegistryPullQPS is the limit of registry pulls per second.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	RegistryPullQPS *int32 `json:"registryPullQPS,omitempty"`
+	// RegistryBurst is the maximum size of bursty pulls, temporarily allows pulls to burst to this number,
+	// while still not exceeding RegistryPullQPS. Only used if RegistryPullQPS is greater than 0.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	RegistryBurst *int32 `json:"registryBurst,omitempty"`
 }
 
+// +kubebuilder:validation:XValidation:rule="!has(self.kmsKeyId) || !has(self.encrypted) || self.encrypted",message="kmsKeyId requires encrypted to be true"
 type SystemDisk struct {
 	// The category of the system disk (for example, cloud and cloud_ssd).
 	// Different ECS is compatible with different disk category, using array to maximize ECS creation success.
@@ -267,12 +531,20 @@ type SystemDisk struct {
 	//   * PL1: A single ESSD can deliver up to 50,000 random read/write IOPS.
 	//   * PL2: A single ESSD can deliver up to 100,000 random read/write IOPS.
 	//   * PL3: A single ESSD can deliver up to 1,000,000 random read/write IOPS.
-	// This will be supported soon
+	// It only takes effect when the category of the system disk is cloud_essd.
 	// +kubebuilder:validation:Enum:={PL0,PL1,PL2,PL3}
 	// +kubebuilder:default:=PL0
 	PerformanceLevel *string `json:"performanceLevel,omitempty"`
+	// Encrypted specifies whether to encrypt the system disk.
+	// +optional
+	Encrypted *bool `json:"encrypted,omitempty"`
+	// KMSKeyID is the KMS key to encrypt the system disk with, either its ID or its ARN. The system disk is
+	// encrypted when it's set. The key must be in the region of the cluster. Without it, the default key of ECS is used.
+	// +optional
+	KMSKeyID *string `json:"kmsKeyId,omitempty"`
 }
 
+// +kubebuilder:validation:XValidation:rule="!has(self.kmsKeyId) || !has(self.encrypted) || self.encrypted",message="kmsKeyId requires encrypted to be true"
 type DataDisk struct {
 	// Size in `Gi`, `G`, `Ti`, or `T`. You must specify either a snapshot ID or
 	// a volume size.
@@ -287,6 +559,26 @@ type DataDisk struct {
 	// Mount point of the data disk.
 	// +optional
 	Device *string `json:"device,omitempty"`
+	// Category of the data disk, it takes precedence over dataDiskCategories.
+	// Valid values:"cloud", "cloud_efficiency", "cloud_ssd", "cloud_essd", "cloud_auto", and "cloud_essd_entry"
+	// +kubebuilder:validation:Enum:={cloud,cloud_efficiency,cloud_ssd,cloud_essd,cloud_auto,cloud_essd_entry}
+	// +optional
+	Category *string `json:"category,omitempty"`
+	// The performance level of the data disk when its category is cloud_essd. Default value: PL1.
+	// The min size of the data disk depends on it, PL2 needs at least 461GiB and PL3 at least 1261GiB.
+	// +kubebuilder:validation:Enum:={PL0,PL1,PL2,PL3}
+	// +optional
+	PerformanceLevel *string `json:"performanceLevel,omitempty"`
+	// DeleteWithInstance specifies whether to release the data disk when the instance is released. Default value: true.
+	// +optional
+	DeleteWithInstance *bool `json:"deleteWithInstance,omitempty"`
+	// Encrypted specifies whether to encrypt the data disk.
+	// +optional
+	Encrypted *bool `json:"encrypted,omitempty"`
+	// KMSKeyID is the KMS key to encrypt the data disk with, either its ID or its ARN. The data disk is
+	// encrypted when it's set. The key must be in the region of the cluster. Without it, the default key of ECS is used.
+	// +optional
+	KMSKeyID *string `json:"kmsKeyId,omitempty"`
 }
 
 // ECSNodeClass is the Schema for the ECSNodeClass API
@@ -308,7 +600,7 @@ const (
 	// 1. A field changes its default value for an existing field that is already hashed
 	// 2. A field is added to the hash calculation with an already-set value
 	// 3. A field is removed from the hash calculations
-	ECSNodeClassHashVersion = "v3"
+	ECSNodeClassHashVersion = "v4"
 )
 
 func (in *ECSNodeClass) Hash() string {
@@ -321,6 +613,68 @@ func (in *ECSNodeClass) Hash() string {
 	})))
 }
 
+// TerwayConfigNamePrefix prefixes the name of the ECSNodeClass in the name of its Terway ConfigMap of kube-system
+const TerwayConfigNamePrefix = "karpenter-terway-"
+
+// TerwayConfigName returns the name of the ConfigMap of kube-system holding the Terway configuration of the nodes,
+// empty when the ECSNodeClass keeps the Terway configuration of the cluster
+func (in *ECSNodeClass) TerwayConfigName() string {
+	if in.Spec.Terway == nil || (!in.Spec.Terway.ENITrunking && in.Spec.Terway.ENICount == nil) {
+		return ""
+	}
+	return TerwayConfigNamePrefix + in.Name
+}
+
+// UserDataHash returns the hash of the bootstrap configuration of the nodes, the kubelet configuration, the user data,
+// whether the data disks are formatted and the Terway configuration. The user data is normalized first, so reformatting
+// it doesn't change the hash. They are excluded from Hash, a change of them is reported as user data drift instead.
+func (in *ECSNodeClass) UserDataHash() string {
+	fields := []interface{}{
+		in.ResolvedKubeletConfiguration(),
+		normalizeUserData(lo.FromPtr(in.Spec.UserData)),
+		in.Spec.FormatDataDisk,
+	}
+	// The Terway configuration is only hashed when it's set, so the hash of the nodes launched without it doesn't change
+	if in.Spec.Terway != nil {
+		fields = append(fields, in.Spec.Terway)
+	}
+	return fmt.Sprint(lo.Must(hashstructure.Hash(fields, hashstructure.FormatV2, &hashstructure.HashOptions{
+		SlicesAsSets:    true,
+		IgnoreZeroValue: true,
+		ZeroNil:         true,
+	})))
+}
+
+// normalizeUserData drops the formatting of the user data which doesn't change what it runs, the line endings, the
+// trailing whitespace and the blank lines
+func normalizeUserData(userData string) string {
+	lines := lo.FilterMap(strings.Split(strings.ReplaceAll(userData, "\r\n", "\n"), "\n"), func(line string, _ int) (string, bool) {
+		line = strings.TrimRight(line, " \t")
+		return line, line != ""
+	})
+	return strings.Join(lines, "\n")
+}
+
+// ResolvedKubeletConfiguration returns the kubelet configuration of the nodes. The max pods of the kubelet
+// configuration take precedence over the DefaultMaxPods, and both over the default derived from the CNI.
+func (in *ECSNodeClass) ResolvedKubeletConfiguration() *KubeletConfiguration {
+	if in.Spec.DefaultMaxPods == nil || (in.Spec.KubeletConfiguration != nil && in.Spec.KubeletConfiguration.MaxPods != nil) {
+		return in.Spec.KubeletConfiguration
+	}
+	kubeletConfiguration := lo.FromPtr(in.Spec.KubeletConfiguration.DeepCopy())
+	kubeletConfiguration.MaxPods = lo.ToPtr(*in.Spec.DefaultMaxPods)
+	return &kubeletConfiguration
+}
+
+// ResolvedVPCID returns the VPC the instances are launched into, the vpcId of the spec takes precedence over the
+// one inferred from the resolved vSwitches. It's empty when the VPC is not known yet.
+func (in *ECSNodeClass) ResolvedVPCID() string {
+	if in.Spec.VPCID != "" {
+		return in.Spec.VPCID
+	}
+	return in.Status.VPCID
+}
+
 func (in *ECSNodeClass) Alias() *Alias {
 	term, ok := lo.Find(in.Spec.ImageSelectorTerms, func(term ImageSelectorTerm) bool {
 		return term.Alias != ""
@@ -385,6 +739,9 @@ func imageVersionFromAlias(alias string) string {
 }
 
 func (sd *SystemDisk) GetGiBSize() int32 {
+	if sd == nil {
+		return 0
+	}
 	if sd.VolumeSize != nil {
 		return int32(sd.VolumeSize.Value() / (1024 * 1024 * 1024)) // #nosec G115
 	}
@@ -400,3 +757,66 @@ func (dd *DataDisk) GetGiBSize() int32 {
 	}
 	return 0
 }
+
+// TagTemplateData is the data the tag values, the hostname and the instance name templates of the ECSNodeClass are
+// rendered with
+// +k8s:deepcopy-gen=false
+type TagTemplateData struct {
+	ClusterID string
+	NodePool  string
+	NodeClass string
+	NodeClaim string
+}
+
+// RenderTagValue renders the tag value template with the data, the references to other fields fail
+func RenderTagValue(value string, data TagTemplateData) (string, error) {
+	return renderTemplate("tag value", value, data)
+}
+
+// RenderHostname renders the hostname template with the data, the hostname must be a lowercase RFC 1123 subdomain
+// of at most 64 characters
+func RenderHostname(hostnameTemplate string, data TagTemplateData) (string, error) {
+	hostname, err := renderTemplate("hostname", hostnameTemplate, data)
+	if err != nil {
+		return "", err
+	}
+	if errs := validation.IsDNS1123Subdomain(hostname); len(errs) != 0 {
+		return "", fmt.Errorf("hostname %q is invalid, %s", hostname, strings.Join(errs, ", "))
+	}
+	if len(hostname) > maxHostnameLength {
+		return "", fmt.Errorf("hostname %q is longer than %d characters", hostname, maxHostnameLength)
+	}
+	return hostname, nil
+}
+
+// instanceNamePattern matches the instance names ECS accepts
+var instanceNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9._:-]+$`)
+
+// RenderInstanceName renders the instance name template with the data, the name is truncated to the 128 characters
+// ECS allows. Without a template, the instances are named with DefaultInstanceNameTemplate.
+func RenderInstanceName(instanceNameTemplate string, data TagTemplateData) (string, error) {
+	name, err := renderTemplate("instance name", lo.Ternary(instanceNameTemplate != "", instanceNameTemplate, DefaultInstanceNameTemplate), data)
+	if err != nil {
+		return "", err
+	}
+	name = name[:min(len(name), maxInstanceNameLength)]
+	if !instanceNamePattern.MatchString(name) {
+		return "", fmt.Errorf("instance name %q is invalid, it must start with a letter and only contain letters, digits, periods, underscores, colons and hyphens", name)
+	}
+	return name, nil
+}
+
+func renderTemplate(name, value string, data TagTemplateData) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s %q, %w", name, value, err)
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("rendering %s %q, %w", name, value, err)
+	}
+	return rendered.String(), nil
+}
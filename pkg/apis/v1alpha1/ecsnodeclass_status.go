@@ -25,6 +25,12 @@ const (
 	ConditionTypeVSwitchesReady      = "VSwitchesReady"
 	ConditionTypeSecurityGroupsReady = "SecurityGroupsReady"
 	ConditionTypeImagesReady         = "ImagesReady"
+	ConditionTypeValidationSucceeded = "ValidationSucceeded"
+	// ConditionTypeNodePoolZonesCovered, ConditionTypeKeyPairFound and ConditionTypeQuotaAvailable are warnings,
+	// they don't affect the readiness of the ECSNodeClass
+	ConditionTypeNodePoolZonesCovered = "NodePoolZonesCovered"
+	ConditionTypeKeyPairFound         = "KeyPairFound"
+	ConditionTypeQuotaAvailable       = "QuotaAvailable"
 )
 
 // VSwitch contains resolved VSwitch selector values utilized for node launch
@@ -35,6 +41,9 @@ type VSwitch struct {
 	// The associated availability zone ID
 	// +required
 	ZoneID string `json:"zoneID,omitempty"`
+	// IPv6CIDRBlock of the vSwitch, empty when IPv6 is not enabled on the vSwitch
+	// +optional
+	IPv6CIDRBlock string `json:"ipv6CIDRBlock,omitempty"`
 }
 
 // SecurityGroup contains resolved SecurityGroup selector values utilized for node launch
@@ -55,17 +64,41 @@ type Image struct {
 	// Name of the Image
 	// +optional
 	Name string `json:"name,omitempty"`
+	// Size of the Image in GiB, the system disk must not be smaller than it
+	// +optional
+	Size int32 `json:"size,omitempty"`
 	// Requirements of the Image to be utilized on an instance type
 	// +required
 	Requirements []corev1.NodeSelectorRequirement `json:"requirements"`
 }
 
+// CapacityReservation contains resolved CapacityReservation selector values utilized for node launch, one per
+// instance type and zone the capacity reservation reserves
+type CapacityReservation struct {
+	// ID of the capacity reservation
+	// +required
+	ID string `json:"id"`
+	// InstanceType reserved by the capacity reservation
+	// +required
+	InstanceType string `json:"instanceType"`
+	// The associated availability zone ID
+	// +required
+	ZoneID string `json:"zoneID"`
+	// AvailableInstanceCount is the number of instances which can still be launched into the capacity reservation
+	// +optional
+	AvailableInstanceCount int32 `json:"availableInstanceCount,omitempty"`
+}
+
 // ECSNodeClassStatus contains the resolved state of the ECSNodeClass
 type ECSNodeClassStatus struct {
 	// VSwitches contains the current VSwitch values that are available to the
 	// cluster under the vSwitch selectors.
 	// +optional
 	VSwitches []VSwitch `json:"vSwitches,omitempty"`
+	// VPCID is the VPC the instances are launched into, the vpcId of the spec or the single VPC of the
+	// resolved vSwitches.
+	// +optional
+	VPCID string `json:"vpcId,omitempty"`
 	// SecurityGroups contains the current Security Groups values that are available to the
 	// cluster under the SecurityGroups selectors.
 	// +optional
@@ -74,6 +107,10 @@ type ECSNodeClassStatus struct {
 	// cluster under the Image selectors.
 	// +optional
 	Images []Image `json:"images,omitempty"`
+	// CapacityReservations contains the current capacity reservations that are available to the
+	// cluster under the CapacityReservation selectors.
+	// +optional
+	CapacityReservations []CapacityReservation `json:"capacityReservations,omitempty"`
 	// Conditions contains signals for health and readiness
 	// +optional
 	Conditions []status.Condition `json:"conditions,omitempty"`
@@ -84,6 +121,7 @@ func (in *ECSNodeClass) StatusConditions() status.ConditionSet {
 		ConditionTypeVSwitchesReady,
 		ConditionTypeSecurityGroupsReady,
 		ConditionTypeImagesReady,
+		ConditionTypeValidationSucceeded,
 	).For(in)
 }
 
@@ -0,0 +1,304 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// maxSelectorTerms is the max number of terms of a selector
+const maxSelectorTerms = 30
+
+const (
+	DiskCategoryESSD = "cloud_essd"
+	// defaultESSDPerformanceLevel is the performance level of an ESSD data disk without one
+	defaultESSDPerformanceLevel = "PL1"
+)
+
+// dataDiskMinGiBSizes are the min sizes of a data disk of the categories, ESSDs by performance level
+// https://www.alibabacloud.com/help/en/ecs/user-guide/disks-2
+var dataDiskMinGiBSizes = map[string]int32{
+	"cloud":            5,
+	"cloud_efficiency": 20,
+	"cloud_ssd":        20,
+	"cloud_auto":       1,
+	"cloud_essd_entry": 10,
+	"PL0":              1,
+	"PL1":              20,
+	"PL2":              461,
+	"PL3":              1261,
+}
+
+// RuntimeValidate validates the selector terms, the disks, the tag, hostname and instance name templates, the DNS, the public IP, the
+// minimum resources and the Terway configuration of the ECSNodeClass.
+// The CRD rejects the same terms with CEL rules, this catches the ECSNodeClasses which were admitted before the rules were added.
+func (in *ECSNodeClass) RuntimeValidate() error {
+	return multierr.Combine(
+		validateVSwitchSelectorTerms(in.Spec.VSwitchSelectorTerms),
+		validateSecurityGroupSelectorTerms(in.Spec.SecurityGroupSelectorTerms),
+		validateImageSelectorTerms(in.Spec.ImageSelectorTerms),
+		validateDataDisks(in.Spec.DataDisks, in.Spec.DataDisksCategories),
+		validateDiskEncryption(in.Spec.SystemDisk, in.Spec.DataDisks),
+		validateTags(in.Spec.Tags),
+		validateHostnameTemplate(in.Spec.HostnameTemplate),
+		validateInstanceNameTemplate(in.Spec.InstanceNameTemplate),
+		validateDNS(in.Spec.DNS),
+		validatePublicIP(in.Spec.InternetMaxBandwidthOut, in.Spec.EIPAssociation),
+		validateMinResources(in.Spec.MinResources),
+		validateTerway(in.Spec.Terway),
+	)
+}
+
+// ValidateRegion validates that the KMS keys of the disks are in the region of the cluster, ECS can't encrypt a disk
+// with a key of another region. Only the keys given as an ARN carry their region, the key IDs are left to ECS. The
+// excluded zones have to be in the region too, a zone of another region would silently exclude nothing.
+func (in *ECSNodeClass) ValidateRegion(region string) error {
+	if region == "" {
+		return nil
+	}
+	var errs error
+	validate := func(field string, kmsKeyID *string) {
+		if keyRegion, ok := KMSKeyRegion(lo.FromPtr(kmsKeyID)); ok && keyRegion != region {
+			errs = multierr.Append(errs, fmt.Errorf("%s kmsKeyId is in region %s, not in the region %s of the cluster", field, keyRegion, region))
+		}
+	}
+	if in.Spec.SystemDisk != nil {
+		validate("systemDisk", in.Spec.SystemDisk.KMSKeyID)
+	}
+	for i, dataDisk := range in.Spec.DataDisks {
+		validate(fmt.Sprintf("dataDisks[%d]", i), dataDisk.KMSKeyID)
+	}
+	// The zones are named after their region, e.g. cn-hangzhou-k or ap-southeast-1a
+	for _, zone := range in.Spec.ZoneExclusions {
+		if !strings.HasPrefix(zone, region) {
+			errs = multierr.Append(errs, fmt.Errorf("zoneExclusions zone %s is not in the region %s of the cluster", zone, region))
+		}
+	}
+	return errs
+}
+
+// KMSKeyRegion returns the region of a KMS key given as an ARN, e.g. acs:kms:cn-hangzhou:123456:key/key-hzz1234
+func KMSKeyRegion(kmsKeyID string) (string, bool) {
+	parts := strings.SplitN(kmsKeyID, ":", 5)
+	if len(parts) != 5 || parts[0] != "acs" || parts[1] != "kms" || parts[2] == "" {
+		return "", false
+	}
+	return parts[2], true
+}
+
+func validateTermCount(field string, count int) error {
+	if count == 0 {
+		return fmt.Errorf("%s cannot be empty", field)
+	}
+	if count > maxSelectorTerms {
+		return fmt.Errorf("%s must have at most %d terms, got %d", field, maxSelectorTerms, count)
+	}
+	return nil
+}
+
+func validateVSwitchSelectorTerms(terms []VSwitchSelectorTerm) error {
+	errs := validateTermCount("vSwitchSelectorTerms", len(terms))
+	for i, term := range terms {
+		switch {
+		case term.ID == "" && len(term.Tags) == 0:
+			errs = multierr.Append(errs, fmt.Errorf("vSwitchSelectorTerms[%d] expected at least one, got none, ['tags', 'id']", i))
+		case term.ID != "" && len(term.Tags) != 0:
+			errs = multierr.Append(errs, fmt.Errorf("vSwitchSelectorTerms[%d] 'id' is mutually exclusive, cannot be set with a combination of other fields", i))
+		}
+	}
+	return errs
+}
+
+func validateSecurityGroupSelectorTerms(terms []SecurityGroupSelectorTerm) error {
+	errs := validateTermCount("securityGroupSelectorTerms", len(terms))
+	for i, term := range terms {
+		switch {
+		case term.ID == "" && term.Name == "" && len(term.Tags) == 0:
+			errs = multierr.Append(errs, fmt.Errorf("securityGroupSelectorTerms[%d] expected at least one, got none, ['tags', 'id', 'name']", i))
+		case term.ID != "" && (term.Name != "" || len(term.Tags) != 0):
+			errs = multierr.Append(errs, fmt.Errorf("securityGroupSelectorTerms[%d] 'id' is mutually exclusive, cannot be set with a combination of other fields", i))
+		case term.Name != "" && len(term.Tags) != 0:
+			errs = multierr.Append(errs, fmt.Errorf("securityGroupSelectorTerms[%d] 'name' is mutually exclusive, cannot be set with a combination of other fields", i))
+		}
+	}
+	return errs
+}
+
+func validateImageSelectorTerms(terms []ImageSelectorTerm) error {
+	errs := validateTermCount("imageSelectorTerms", len(terms))
+	for i, term := range terms {
+		switch {
+		case term.ID == "" && term.Alias == "":
+			errs = multierr.Append(errs, fmt.Errorf("imageSelectorTerms[%d] expected at least one, got none, ['id', 'alias']", i))
+		case term.ID != "" && term.Alias != "":
+			errs = multierr.Append(errs, fmt.Errorf("imageSelectorTerms[%d] 'id' is mutually exclusive, cannot be set with a combination of other fields", i))
+		case term.Alias != "" && len(terms) != 1:
+			errs = multierr.Append(errs, fmt.Errorf("imageSelectorTerms[%d] 'alias' is mutually exclusive, cannot be set with a combination of other imageSelectorTerms", i))
+		}
+	}
+	return errs
+}
+
+// validateDataDisks validates the sizes of the data disks against the min size of every category they may be created in
+func validateDataDisks(dataDisks []DataDisk, categories []string) error {
+	var errs error
+	for i, dataDisk := range dataDisks {
+		diskCategories := categories
+		if dataDisk.Category != nil {
+			diskCategories = []string{*dataDisk.Category}
+		}
+		if dataDisk.PerformanceLevel != nil && dataDisk.Category != nil && *dataDisk.Category != DiskCategoryESSD {
+			errs = multierr.Append(errs, fmt.Errorf("dataDisks[%d] performanceLevel is only supported by %s", i, DiskCategoryESSD))
+			continue
+		}
+		size := dataDisk.GetGiBSize()
+		if size == 0 {
+			continue
+		}
+		for _, category := range diskCategories {
+			key, name := category, category
+			if category == DiskCategoryESSD {
+				key = lo.FromPtrOr(dataDisk.PerformanceLevel, defaultESSDPerformanceLevel)
+				name = fmt.Sprintf("%s %s", category, key)
+			}
+			if minSize, ok := dataDiskMinGiBSizes[key]; ok && size < minSize {
+				errs = multierr.Append(errs, fmt.Errorf("dataDisks[%d] size %dGiB is smaller than the min size %dGiB of %s", i, size, minSize, name))
+			}
+		}
+	}
+	return errs
+}
+
+// validateDiskEncryption validates that the disks with a KMS key aren't explicitly unencrypted
+func validateDiskEncryption(systemDisk *SystemDisk, dataDisks []DataDisk) error {
+	var errs error
+	if systemDisk != nil && systemDisk.KMSKeyID != nil && !lo.FromPtrOr(systemDisk.Encrypted, true) {
+		errs = multierr.Append(errs, fmt.Errorf("systemDisk kmsKeyId requires encrypted to be true"))
+	}
+	for i, dataDisk := range dataDisks {
+		if dataDisk.KMSKeyID != nil && !lo.FromPtrOr(dataDisk.Encrypted, true) {
+			errs = multierr.Append(errs, fmt.Errorf("dataDisks[%d] kmsKeyId requires encrypted to be true", i))
+		}
+	}
+	return errs
+}
+
+// validateTags renders the tag value templates with empty data, so that the syntax errors and the references to
+// unknown fields are reported before an instance is launched
+func validateTags(tags map[string]string) error {
+	var errs error
+	for _, key := range lo.Keys(tags) {
+		if _, err := RenderTagValue(tags[key], TagTemplateData{}); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("tags[%s] %w", key, err))
+		}
+	}
+	return errs
+}
+
+// validateHostnameTemplate renders the hostname template for two NodeClaims, so that the invalid hostnames and the
+// templates which would give every instance the same hostname are reported before an instance is launched
+func validateHostnameTemplate(hostnameTemplate string) error {
+	if hostnameTemplate == "" {
+		return nil
+	}
+	data := TagTemplateData{ClusterID: "c0123456789abcdef0123456789abcdef", NodePool: "default", NodeClass: "default"}
+	var hostnames []string
+	for _, nodeClaim := range []string{"default-abcde", "default-fghij"} {
+		data.NodeClaim = nodeClaim
+		hostname, err := RenderHostname(hostnameTemplate, data)
+		if err != nil {
+			return fmt.Errorf("hostnameTemplate %w", err)
+		}
+		hostnames = append(hostnames, hostname)
+	}
+	if hostnames[0] == hostnames[1] {
+		return fmt.Errorf("hostnameTemplate must reference .NodeClaim, the hostnames of the instances must be unique")
+	}
+	return nil
+}
+
+// validateInstanceNameTemplate renders the instance name template, so that the invalid names are reported before an
+// instance is launched. Unlike the hostnames, the instance names don't need to be unique.
+func validateInstanceNameTemplate(instanceNameTemplate string) error {
+	if instanceNameTemplate == "" {
+		return nil
+	}
+	data := TagTemplateData{ClusterID: "c0123456789abcdef0123456789abcdef", NodePool: "default", NodeClass: "default", NodeClaim: "default-abcde"}
+	if _, err := RenderInstanceName(instanceNameTemplate, data); err != nil {
+		return fmt.Errorf("instanceNameTemplate %w", err)
+	}
+	return nil
+}
+
+// validateDNS validates that the nameservers are IP addresses and the search domains are RFC 1123 subdomains
+func validateDNS(dns *DNSConfiguration) error {
+	if dns == nil {
+		return nil
+	}
+	var errs error
+	for i, nameserver := range dns.Nameservers {
+		if net.ParseIP(nameserver) == nil {
+			errs = multierr.Append(errs, fmt.Errorf("dns.nameservers[%d] %q is not an IP address", i, nameserver))
+		}
+	}
+	for i, search := range dns.Searches {
+		if msgs := validation.IsDNS1123Subdomain(search); len(msgs) != 0 {
+			errs = multierr.Append(errs, fmt.Errorf("dns.searches[%d] %q is invalid, %s", i, search, strings.Join(msgs, ", ")))
+		}
+	}
+	return errs
+}
+
+// validatePublicIP validates that the instances get either a public IP address or an elastic IP address
+func validatePublicIP(internetMaxBandwidthOut *int32, eipAssociation *EIPAssociation) error {
+	if eipAssociation != nil && lo.FromPtr(internetMaxBandwidthOut) > 0 {
+		return fmt.Errorf("eipAssociation cannot be set with an internetMaxBandwidthOut greater than 0")
+	}
+	return nil
+}
+
+// validateMinResources validates that the floor of the instance types is positive
+func validateMinResources(minResources *MinResources) error {
+	if minResources == nil {
+		return nil
+	}
+	var errs error
+	if minResources.CPU != nil && *minResources.CPU < 1 {
+		errs = multierr.Append(errs, fmt.Errorf("minResources.cpu must be at least 1, got %d", *minResources.CPU))
+	}
+	if minResources.Memory != nil && minResources.Memory.Sign() <= 0 {
+		errs = multierr.Append(errs, fmt.Errorf("minResources.memory must be positive, got %s", minResources.Memory))
+	}
+	return errs
+}
+
+// validateTerway validates that Terway is left with at least one ENI for the pod IPs, the trunk ENI takes one of them
+func validateTerway(terway *TerwayConfiguration) error {
+	if terway == nil || terway.ENICount == nil {
+		return nil
+	}
+	if minENIs := lo.Ternary[int32](terway.ENITrunking, 2, 1); *terway.ENICount < minENIs {
+		return fmt.Errorf("terway.eniCount must be at least %d, got %d", minENIs, *terway.ENICount)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func validNodeClass() *ECSNodeClass {
+	return &ECSNodeClass{Spec: ECSNodeClassSpec{
+		VSwitchSelectorTerms:       []VSwitchSelectorTerm{{Tags: map[string]string{"karpenter.sh/discovery": "c-1"}}, {ID: "vsw-1"}},
+		SecurityGroupSelectorTerms: []SecurityGroupSelectorTerm{{Tags: map[string]string{"karpenter.sh/discovery": "c-1"}}, {ID: "sg-1"}, {Name: "default"}},
+		ImageSelectorTerms:         []ImageSelectorTerm{{Alias: "AlibabaCloudLinux3@latest"}},
+	}}
+}
+
+func TestRuntimeValidate(t *testing.T) {
+	assert.NoError(t, validNodeClass().RuntimeValidate())
+	templatedTags := validNodeClass()
+	templatedTags.Spec.Tags = map[string]string{"team": "{{ .NodePool }}", "owner": "{{ .ClusterID }}-{{ .NodeClaim }}"}
+	assert.NoError(t, templatedTags.RuntimeValidate())
+	hostname := validNodeClass()
+	hostname.Spec.HostnameTemplate = "{{ .NodePool }}-{{ .NodeClaim }}.node.example.com"
+	hostname.Spec.DNS = &DNSConfiguration{Nameservers: []string{"10.0.0.2", "fd00::2"}, Searches: []string{"example.com", "svc.example.com"}}
+	assert.NoError(t, hostname.RuntimeValidate())
+
+	tooManyVSwitchTerms := make([]VSwitchSelectorTerm, maxSelectorTerms+1)
+	for i := range tooManyVSwitchTerms {
+		tooManyVSwitchTerms[i] = VSwitchSelectorTerm{ID: fmt.Sprintf("vsw-%d", i)}
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(*ECSNodeClass)
+		wantErr string
+	}{
+		{
+			name:    "no vSwitch terms",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.VSwitchSelectorTerms = nil },
+			wantErr: "vSwitchSelectorTerms cannot be empty",
+		},
+		{
+			name:    "too many vSwitch terms",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.VSwitchSelectorTerms = tooManyVSwitchTerms },
+			wantErr: "vSwitchSelectorTerms must have at most 30 terms, got 31",
+		},
+		{
+			name: "empty vSwitch term",
+			mutate: func(nc *ECSNodeClass) {
+				nc.Spec.VSwitchSelectorTerms = append(nc.Spec.VSwitchSelectorTerms, VSwitchSelectorTerm{Tags: map[string]string{}})
+			},
+			wantErr: "vSwitchSelectorTerms[2] expected at least one, got none",
+		},
+		{
+			name: "vSwitch term with id and tags",
+			mutate: func(nc *ECSNodeClass) {
+				nc.Spec.VSwitchSelectorTerms[1].Tags = map[string]string{"foo": "bar"}
+			},
+			wantErr: "vSwitchSelectorTerms[1] 'id' is mutually exclusive",
+		},
+		{
+			name:    "no security group terms",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.SecurityGroupSelectorTerms = nil },
+			wantErr: "securityGroupSelectorTerms cannot be empty",
+		},
+		{
+			name: "empty security group term",
+			mutate: func(nc *ECSNodeClass) {
+				nc.Spec.SecurityGroupSelectorTerms = append(nc.Spec.SecurityGroupSelectorTerms, SecurityGroupSelectorTerm{})
+			},
+			wantErr: "securityGroupSelectorTerms[3] expected at least one, got none",
+		},
+		{
+			name:    "security group term with id and name",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.SecurityGroupSelectorTerms[1].Name = "default" },
+			wantErr: "securityGroupSelectorTerms[1] 'id' is mutually exclusive",
+		},
+		{
+			name: "security group term with name and tags",
+			mutate: func(nc *ECSNodeClass) {
+				nc.Spec.SecurityGroupSelectorTerms[2].Tags = map[string]string{"foo": "bar"}
+			},
+			wantErr: "securityGroupSelectorTerms[2] 'name' is mutually exclusive",
+		},
+		{
+			name:    "no image terms",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.ImageSelectorTerms = nil },
+			wantErr: "imageSelectorTerms cannot be empty",
+		},
+		{
+			name:    "empty image term",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.ImageSelectorTerms = []ImageSelectorTerm{{}} },
+			wantErr: "imageSelectorTerms[0] expected at least one, got none",
+		},
+		{
+			name:    "image term with id and alias",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.ImageSelectorTerms[0].ID = "m-1" },
+			wantErr: "imageSelectorTerms[0] 'id' is mutually exclusive",
+		},
+		{
+			name: "alias with other image terms",
+			mutate: func(nc *ECSNodeClass) {
+				nc.Spec.ImageSelectorTerms = append(nc.Spec.ImageSelectorTerms, ImageSelectorTerm{ID: "m-1"})
+			},
+			wantErr: "imageSelectorTerms[0] 'alias' is mutually exclusive",
+		},
+		{
+			name:    "tag template with an unknown field",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.Tags = map[string]string{"team": "{{ .Team }}"} },
+			wantErr: "tags[team] rendering tag value",
+		},
+		{
+			name: "public IP with an elastic IP address",
+			mutate: func(nc *ECSNodeClass) {
+				nc.Spec.InternetMaxBandwidthOut = lo.ToPtr[int32](10)
+				nc.Spec.EIPAssociation = &EIPAssociation{}
+			},
+			wantErr: "eipAssociation cannot be set with an internetMaxBandwidthOut greater than 0",
+		},
+		{
+			name: "unencrypted disk with a KMS key",
+			mutate: func(nc *ECSNodeClass) {
+				nc.Spec.DataDisks = []DataDisk{{KMSKeyID: lo.ToPtr("key-hzz1234"), Encrypted: lo.ToPtr(false)}}
+			},
+			wantErr: "dataDisks[0] kmsKeyId requires encrypted to be true",
+		},
+		{
+			name:    "malformed tag template",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.Tags = map[string]string{"team": "{{ .NodePool"} },
+			wantErr: "tags[team] parsing tag value",
+		},
+		{
+			name:    "hostname template with uppercase letters",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.HostnameTemplate = "Node-{{ .NodeClaim }}" },
+			wantErr: `hostnameTemplate hostname "Node-default-abcde" is invalid`,
+		},
+		{
+			name:    "hostname template with an underscore",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.HostnameTemplate = "{{ .NodePool }}_{{ .NodeClaim }}" },
+			wantErr: `hostnameTemplate hostname "default_default-abcde" is invalid`,
+		},
+		{
+			name: "hostname template longer than 64 characters",
+			mutate: func(nc *ECSNodeClass) {
+				nc.Spec.HostnameTemplate = "{{ .ClusterID }}-{{ .NodeClass }}-{{ .NodeClaim }}-worker-node"
+			},
+			wantErr: "is longer than 64 characters",
+		},
+		{
+			name:    "hostname template without the NodeClaim",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.HostnameTemplate = "{{ .NodePool }}" },
+			wantErr: "hostnameTemplate must reference .NodeClaim",
+		},
+		{
+			name:    "hostname template with an unknown field",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.HostnameTemplate = "{{ .Zone }}-{{ .NodeClaim }}" },
+			wantErr: "hostnameTemplate rendering hostname",
+		},
+		{
+			name:    "instance name template starting with a digit",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.InstanceNameTemplate = "0-{{ .NodeClaim }}" },
+			wantErr: `instanceNameTemplate instance name "0-default-abcde" is invalid`,
+		},
+		{
+			name:    "instance name template with an unknown field",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.InstanceNameTemplate = "karpenter-{{ .Zone }}" },
+			wantErr: "instanceNameTemplate rendering instance name",
+		},
+		{
+			name: "nameserver which isn't an IP address",
+			mutate: func(nc *ECSNodeClass) {
+				nc.Spec.DNS = &DNSConfiguration{Nameservers: []string{"10.0.0.2", "dns.example.com"}}
+			},
+			wantErr: `dns.nameservers[1] "dns.example.com" is not an IP address`,
+		},
+		{
+			name:    "invalid search domain",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.DNS = &DNSConfiguration{Searches: []string{"-example.com"}} },
+			wantErr: `dns.searches[0] "-example.com" is invalid`,
+		},
+		{
+			name:    "zero minimum vCPUs",
+			mutate:  func(nc *ECSNodeClass) { nc.Spec.MinResources = &MinResources{CPU: lo.ToPtr[int32](0)} },
+			wantErr: "minResources.cpu must be at least 1, got 0",
+		},
+		{
+			name: "negative minimum memory",
+			mutate: func(nc *ECSNodeClass) {
+				nc.Spec.MinResources = &MinResources{Memory: lo.ToPtr(resource.MustParse("-1Gi"))}
+			},
+			wantErr: "minResources.memory must be positive, got -1Gi",
+		},
+		{
+			name: "ENI trunking with a single ENI",
+			mutate: func(nc *ECSNodeClass) {
+				nc.Spec.Terway = &TerwayConfiguration{ENITrunking: true, ENICount: lo.ToPtr[int32](1)}
+			},
+			wantErr: "terway.eniCount must be at least 2, got 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeClass := validNodeClass()
+			tt.mutate(nodeClass)
+			err := nodeClass.RuntimeValidate()
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateRegion(t *testing.T) {
+	nodeClass := validNodeClass()
+	nodeClass.Spec.SystemDisk = &SystemDisk{KMSKeyID: lo.ToPtr("acs:kms:cn-hangzhou:123456:key/key-hzz1234")}
+	nodeClass.Spec.DataDisks = []DataDisk{{KMSKeyID: lo.ToPtr("key-hzz5678")}, {KMSKeyID: lo.ToPtr("acs:kms:cn-beijing:123456:key/key-bjj1234")}}
+
+	// the key IDs don't carry their region
+	assert.EqualError(t, nodeClass.ValidateRegion("cn-hangzhou"), "dataDisks[1] kmsKeyId is in region cn-beijing, not in the region cn-hangzhou of the cluster")
+	nodeClass.Spec.DataDisks = nodeClass.Spec.DataDisks[:1]
+	assert.NoError(t, nodeClass.ValidateRegion("cn-hangzhou"))
+	assert.ErrorContains(t, nodeClass.ValidateRegion("cn-shanghai"), "systemDisk kmsKeyId is in region cn-hangzhou")
+
+	// the excluded zones are named after their region
+	nodeClass = validNodeClass()
+	nodeClass.Spec.ZoneExclusions = []string{"cn-hangzhou-k", "cn-beijing-a"}
+	assert.EqualError(t, nodeClass.ValidateRegion("cn-hangzhou"), "zoneExclusions zone cn-beijing-a is not in the region cn-hangzhou of the cluster")
+	nodeClass.Spec.ZoneExclusions = []string{"ap-southeast-1a"}
+	assert.NoError(t, nodeClass.ValidateRegion("ap-southeast-1"))
+}
+
+func TestValidateDataDisks(t *testing.T) {
+	size := func(s string) *resource.Quantity { return lo.ToPtr(resource.MustParse(s)) }
+
+	tests := []struct {
+		name       string
+		dataDisks  []DataDisk
+		categories []string
+		wantErr    string
+	}{
+		{
+			name:      "ESSD PL1",
+			dataDisks: []DataDisk{{Category: lo.ToPtr(DiskCategoryESSD), PerformanceLevel: lo.ToPtr("PL1"), VolumeSize: size("40Gi")}},
+		},
+		{
+			name:      "undersized ESSD PL2",
+			dataDisks: []DataDisk{{Category: lo.ToPtr(DiskCategoryESSD), PerformanceLevel: lo.ToPtr("PL2"), VolumeSize: size("100Gi")}},
+			wantErr:   "dataDisks[0] size 100GiB is smaller than the min size 461GiB of cloud_essd PL2",
+		},
+		{
+			name:       "undersized for one of the categories",
+			dataDisks:  []DataDisk{{VolumeSize: size("10Gi")}},
+			categories: []string{"cloud_auto", "cloud_efficiency"},
+			wantErr:    "dataDisks[0] size 10GiB is smaller than the min size 20GiB of cloud_efficiency",
+		},
+		{
+			name:       "the category of the disk takes precedence",
+			dataDisks:  []DataDisk{{Category: lo.ToPtr("cloud_auto"), VolumeSize: size("10Gi")}},
+			categories: []string{"cloud_efficiency"},
+		},
+		{
+			name:      "performance level of another category",
+			dataDisks: []DataDisk{{Category: lo.ToPtr("cloud_ssd"), PerformanceLevel: lo.ToPtr("PL1"), VolumeSize: size("40Gi")}},
+			wantErr:   "dataDisks[0] performanceLevel is only supported by cloud_essd",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDataDisks(tt.dataDisks, tt.categories)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
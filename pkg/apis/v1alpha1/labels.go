@@ -37,12 +37,19 @@ func init() {
 		LabelInstanceSize,
 		LabelInstanceCPU,
 		LabelInstanceCPUModel,
+		LabelInstanceCPUManufacturer,
 		LabelInstanceMemory,
 		LabelInstanceGPUName,
 		LabelInstanceGPUManufacturer,
 		LabelInstanceGPUCount,
 		LabelInstanceGPUMemory,
+		LabelInstanceLocalStorage,
+		LabelInstanceLocalStorageCategory,
+		LabelInstanceENICount,
+		LabelInstanceENIPrivateIPCount,
+		LabelInstanceNetworkBandwidth,
 		LabelTopologyZoneID,
+		LabelCapacityReservationID,
 		corev1.LabelWindowsBuild,
 	)
 }
@@ -73,30 +80,54 @@ var (
 	ImageFamilyCustom                                 = "Custom"
 	ECSAMDCPUModelValue                               = "AMD"
 	ECSIntelCPUModelValue                             = "Intel"
+	ECSYitianCPUModelValue                            = "Yitian"
 	ResourceNVIDIAGPU             corev1.ResourceName = "nvidia.com/gpu"
 	ResourceAMDGPU                corev1.ResourceName = "amd.com/gpu"
 	ResourceAliyunENI             corev1.ResourceName = "aliyun/eni"
 	ResourcePrivateIPv4Address    corev1.ResourceName = "vpc.alibabacloud.com/PrivateIPv4Address"
 	ECSClusterIDTagKey                                = "ecs:ecs-cluster-id"
 
-	LabelNodeClass                           = apis.Group + "/ecsnodeclass"
-	LabelTopologyZoneID                      = "topology.k8s.alibabacloud/zone-id"
-	LabelInstanceCategory                    = apis.Group + "/instance-category"
-	LabelInstanceFamily                      = apis.Group + "/instance-family"
-	LabelInstanceGeneration                  = apis.Group + "/instance-generation"
-	LabelInstanceSize                        = apis.Group + "/instance-size"
-	LabelInstanceCPU                         = apis.Group + "/instance-cpu"
-	LabelInstanceCPUModel                    = apis.Group + "/instance-cpu-model"
-	LabelInstanceMemory                      = apis.Group + "/instance-memory"
-	LabelInstanceGPUName                     = apis.Group + "/instance-gpu-name"
-	LabelInstanceGPUManufacturer             = apis.Group + "/instance-gpu-manufacturer"
-	LabelInstanceGPUCount                    = apis.Group + "/instance-gpu-count"
-	LabelInstanceGPUMemory                   = apis.Group + "/instance-gpu-memory"
+	LabelNodeClass          = apis.Group + "/ecsnodeclass"
+	LabelTopologyZoneID     = "topology.k8s.alibabacloud/zone-id"
+	LabelInstanceCategory   = apis.Group + "/instance-category"
+	LabelInstanceFamily     = apis.Group + "/instance-family"
+	LabelInstanceGeneration = apis.Group + "/instance-generation"
+	LabelInstanceSize       = apis.Group + "/instance-size"
+	LabelInstanceCPU        = apis.Group + "/instance-cpu"
+	LabelInstanceCPUModel   = apis.Group + "/instance-cpu-model"
+	// LabelInstanceCPUManufacturer is the vendor of the processor of the instance: intel, amd or yitian
+	LabelInstanceCPUManufacturer = apis.Group + "/instance-cpu-manufacturer"
+	LabelInstanceMemory          = apis.Group + "/instance-memory"
+	LabelInstanceGPUName         = apis.Group + "/instance-gpu-name"
+	LabelInstanceGPUManufacturer = apis.Group + "/instance-gpu-manufacturer"
+	LabelInstanceGPUCount        = apis.Group + "/instance-gpu-count"
+	LabelInstanceGPUMemory       = apis.Group + "/instance-gpu-memory"
+	// LabelInstanceLocalStorage is the total size in GiB of the local disks, e.g. the NVMe SSDs of the i families
+	LabelInstanceLocalStorage         = apis.Group + "/instance-local-storage"
+	LabelInstanceLocalStorageCategory = apis.Group + "/instance-local-storage-category"
+	// LabelInstanceENICount is the max number of ENIs of the instance, including the primary ENI
+	LabelInstanceENICount = apis.Group + "/instance-eni-count"
+	// LabelInstanceENIPrivateIPCount is the max number of private IPv4 addresses of each ENI
+	LabelInstanceENIPrivateIPCount = apis.Group + "/instance-eni-private-ip-count"
+	// LabelInstanceNetworkBandwidth is the max internal bandwidth of the instance in Mbit/s, inbound or outbound
+	LabelInstanceNetworkBandwidth = apis.Group + "/instance-network-bandwidth"
+	// LabelTerwayConfig selects the ConfigMap of kube-system the Terway agent of the node merges into the eni_conf of
+	// the cluster, referring to the dynamic configuration of Terway nodes
+	LabelTerwayConfig = "terway-config"
+	// LabelCapacityReservationID is the capacity reservation the instance is launched into
+	LabelCapacityReservationID               = apis.Group + "/capacity-reservation-id"
 	AnnotationECSNodeClassHash               = apis.Group + "/ecsnodeclass-hash"
 	AnnotationClusterNameTaggedCompatability = apis.CompatibilityGroup + "/cluster-name-tagged"
 	AnnotationECSNodeClassHashVersion        = apis.Group + "/ecsnodeclass-hash-version"
 	AnnotationInstanceTagged                 = apis.Group + "/tagged"
+	// AnnotationNodeClassTags are the keys of the ECSNodeClass tags synced onto the instance of the NodeClaim,
+	// so the tags removed from the ECSNodeClass are removed from the instance too
+	AnnotationNodeClassTags = apis.Group + "/nodeclass-tags"
 
 	TagNodeClaim = coreapis.Group + "/nodeclaim"
 	TagName      = "Name"
+	// TagEIPAssociation marks the instances with an elastic IP address allocated by karpenter
+	TagEIPAssociation = apis.Group + "/eip-association"
+	// TagUserDataHash is the UserDataHash of the ECSNodeClass the instance is launched with
+	TagUserDataHash = apis.Group + "/userdata-hash"
 )
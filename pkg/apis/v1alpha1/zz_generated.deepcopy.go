@@ -42,6 +42,68 @@ func (in *Alias) DeepCopy() *Alias {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapacityReservation) DeepCopyInto(out *CapacityReservation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapacityReservation.
+func (in *CapacityReservation) DeepCopy() *CapacityReservation {
+	if in == nil {
+		return nil
+	}
+	out := new(CapacityReservation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapacityReservationSelectorTerm) DeepCopyInto(out *CapacityReservationSelectorTerm) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapacityReservationSelectorTerm.
+func (in *CapacityReservationSelectorTerm) DeepCopy() *CapacityReservationSelectorTerm {
+	if in == nil {
+		return nil
+	}
+	out := new(CapacityReservationSelectorTerm)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSConfiguration) DeepCopyInto(out *DNSConfiguration) {
+	*out = *in
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Searches != nil {
+		in, out := &in.Searches, &out.Searches
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSConfiguration.
+func (in *DNSConfiguration) DeepCopy() *DNSConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DataDisk) DeepCopyInto(out *DataDisk) {
 	*out = *in
@@ -55,6 +117,31 @@ func (in *DataDisk) DeepCopyInto(out *DataDisk) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Category != nil {
+		in, out := &in.Category, &out.Category
+		*out = new(string)
+		**out = **in
+	}
+	if in.PerformanceLevel != nil {
+		in, out := &in.PerformanceLevel, &out.PerformanceLevel
+		*out = new(string)
+		**out = **in
+	}
+	if in.DeleteWithInstance != nil {
+		in, out := &in.DeleteWithInstance, &out.DeleteWithInstance
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Encrypted != nil {
+		in, out := &in.Encrypted, &out.Encrypted
+		*out = new(bool)
+		**out = **in
+	}
+	if in.KMSKeyID != nil {
+		in, out := &in.KMSKeyID, &out.KMSKeyID
+		*out = new(string)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataDisk.
@@ -67,6 +154,51 @@ func (in *DataDisk) DeepCopy() *DataDisk {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeploymentSet) DeepCopyInto(out *DeploymentSet) {
+	*out = *in
+	if in.ID != nil {
+		in, out := &in.ID, &out.ID
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeploymentSet.
+func (in *DeploymentSet) DeepCopy() *DeploymentSet {
+	if in == nil {
+		return nil
+	}
+	out := new(DeploymentSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EIPAssociation) DeepCopyInto(out *EIPAssociation) {
+	*out = *in
+	if in.Bandwidth != nil {
+		in, out := &in.Bandwidth, &out.Bandwidth
+		*out = new(int32)
+		**out = **in
+	}
+	if in.InternetChargeType != nil {
+		in, out := &in.InternetChargeType, &out.InternetChargeType
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EIPAssociation.
+func (in *EIPAssociation) DeepCopy() *EIPAssociation {
+	if in == nil {
+		return nil
+	}
+	out := new(EIPAssociation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ECSNodeClass) DeepCopyInto(out *ECSNodeClass) {
 	*out = *in
@@ -136,6 +268,11 @@ func (in *ECSNodeClassSpec) DeepCopyInto(out *ECSNodeClassSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ZoneExclusions != nil {
+		in, out := &in.ZoneExclusions, &out.ZoneExclusions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.SecurityGroupSelectorTerms != nil {
 		in, out := &in.SecurityGroupSelectorTerms, &out.SecurityGroupSelectorTerms
 		*out = make([]SecurityGroupSelectorTerm, len(*in))
@@ -143,6 +280,13 @@ func (in *ECSNodeClassSpec) DeepCopyInto(out *ECSNodeClassSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.CapacityReservationSelectorTerms != nil {
+		in, out := &in.CapacityReservationSelectorTerms, &out.CapacityReservationSelectorTerms
+		*out = make([]CapacityReservationSelectorTerm, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.ImageSelectorTerms != nil {
 		in, out := &in.ImageSelectorTerms, &out.ImageSelectorTerms
 		*out = make([]ImageSelectorTerm, len(*in))
@@ -153,6 +297,16 @@ func (in *ECSNodeClassSpec) DeepCopyInto(out *ECSNodeClassSpec) {
 		*out = new(KubeletConfiguration)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.DefaultMaxPods != nil {
+		in, out := &in.DefaultMaxPods, &out.DefaultMaxPods
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MinResources != nil {
+		in, out := &in.MinResources, &out.MinResources
+		*out = new(MinResources)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.SystemDisk != nil {
 		in, out := &in.SystemDisk, &out.SystemDisk
 		*out = new(SystemDisk)
@@ -182,6 +336,51 @@ func (in *ECSNodeClassSpec) DeepCopyInto(out *ECSNodeClassSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = new(DNSConfiguration)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MetadataOptions != nil {
+		in, out := &in.MetadataOptions, &out.MetadataOptions
+		*out = new(MetadataOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeploymentSet != nil {
+		in, out := &in.DeploymentSet, &out.DeploymentSet
+		*out = new(DeploymentSet)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DedicatedHostID != nil {
+		in, out := &in.DedicatedHostID, &out.DedicatedHostID
+		*out = new(string)
+		**out = **in
+	}
+	if in.SpotPriceLimit != nil {
+		in, out := &in.SpotPriceLimit, &out.SpotPriceLimit
+		*out = new(string)
+		**out = **in
+	}
+	if in.InternetMaxBandwidthOut != nil {
+		in, out := &in.InternetMaxBandwidthOut, &out.InternetMaxBandwidthOut
+		*out = new(int32)
+		**out = **in
+	}
+	if in.EIPAssociation != nil {
+		in, out := &in.EIPAssociation, &out.EIPAssociation
+		*out = new(EIPAssociation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IPv6 != nil {
+		in, out := &in.IPv6, &out.IPv6
+		*out = new(IPv6)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Terway != nil {
+		in, out := &in.Terway, &out.Terway
+		*out = new(TerwayConfiguration)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ECSNodeClassSpec.
@@ -214,6 +413,11 @@ func (in *ECSNodeClassStatus) DeepCopyInto(out *ECSNodeClassStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.CapacityReservations != nil {
+		in, out := &in.CapacityReservations, &out.CapacityReservations
+		*out = make([]CapacityReservation, len(*in))
+		copy(*out, *in)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]status.Condition, len(*in))
@@ -233,6 +437,26 @@ func (in *ECSNodeClassStatus) DeepCopy() *ECSNodeClassStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPv6) DeepCopyInto(out *IPv6) {
+	*out = *in
+	if in.AddressCount != nil {
+		in, out := &in.AddressCount, &out.AddressCount
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPv6.
+func (in *IPv6) DeepCopy() *IPv6 {
+	if in == nil {
+		return nil
+	}
+	out := new(IPv6)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Image) DeepCopyInto(out *Image) {
 	*out = *in
@@ -343,6 +567,16 @@ func (in *KubeletConfiguration) DeepCopyInto(out *KubeletConfiguration) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.RegistryPullQPS != nil {
+		in, out := &in.RegistryPullQPS, &out.RegistryPullQPS
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RegistryBurst != nil {
+		in, out := &in.RegistryBurst, &out.RegistryBurst
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeletConfiguration.
@@ -355,6 +589,61 @@ func (in *KubeletConfiguration) DeepCopy() *KubeletConfiguration {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataOptions) DeepCopyInto(out *MetadataOptions) {
+	*out = *in
+	if in.HTTPEndpoint != nil {
+		in, out := &in.HTTPEndpoint, &out.HTTPEndpoint
+		*out = new(string)
+		**out = **in
+	}
+	if in.HTTPPutResponseHopLimit != nil {
+		in, out := &in.HTTPPutResponseHopLimit, &out.HTTPPutResponseHopLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.HTTPTokens != nil {
+		in, out := &in.HTTPTokens, &out.HTTPTokens
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataOptions.
+func (in *MetadataOptions) DeepCopy() *MetadataOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MinResources) DeepCopyInto(out *MinResources) {
+	*out = *in
+	if in.CPU != nil {
+		in, out := &in.CPU, &out.CPU
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MinResources.
+func (in *MinResources) DeepCopy() *MinResources {
+	if in == nil {
+		return nil
+	}
+	out := new(MinResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecurityGroup) DeepCopyInto(out *SecurityGroup) {
 	*out = *in
@@ -415,6 +704,16 @@ func (in *SystemDisk) DeepCopyInto(out *SystemDisk) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Encrypted != nil {
+		in, out := &in.Encrypted, &out.Encrypted
+		*out = new(bool)
+		**out = **in
+	}
+	if in.KMSKeyID != nil {
+		in, out := &in.KMSKeyID, &out.KMSKeyID
+		*out = new(string)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SystemDisk.
@@ -427,6 +726,26 @@ func (in *SystemDisk) DeepCopy() *SystemDisk {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TerwayConfiguration) DeepCopyInto(out *TerwayConfiguration) {
+	*out = *in
+	if in.ENICount != nil {
+		in, out := &in.ENICount, &out.ENICount
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TerwayConfiguration.
+func (in *TerwayConfiguration) DeepCopy() *TerwayConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(TerwayConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VSwitch) DeepCopyInto(out *VSwitch) {
 	*out = *in
@@ -30,10 +30,20 @@ const (
 	// UnavailableOfferingsTTL is the time before offerings that were marked as unavailable
 	// are removed from the cache and are available for launch again
 	UnavailableOfferingsTTL = 3 * time.Minute
+	// SoldOutOfferingsTTL is the default cooldown before offerings which ECS reported as sold out
+	// are considered for launch again
+	SoldOutOfferingsTTL = 10 * time.Minute
+	// AccountErrorCooldown is the default time the launches are paused after ECS rejected one with an
+	// account-level error, e.g. InsufficientBalance
+	AccountErrorCooldown = 5 * time.Minute
 	// AvailableIPAddressTTL is time to drop AvailableIPAddress data if it is not updated within the TTL
 	AvailableIPAddressTTL = 5 * time.Minute
 	// InstanceTypeAvailableDiskTTL is the time refresh InstanceType compatible disk
 	InstanceTypeAvailableDiskTTL = 30 * time.Minute
+	// ZonesTTL is the time before the zones of the region are described again, they rarely change
+	ZonesTTL = time.Hour
+	// QuotaTTL is the time before the vCPU quota of the account and its usage are described again
+	QuotaTTL = time.Minute
 	// ClusterAttachScriptTTL is the time refresh for the cluster attach script
 	ClusterAttachScriptTTL = 6 * time.Hour
 
@@ -46,4 +56,9 @@ const (
 
 	// InstanceTypesAndZonesTTL is the time before we refresh instance types and zones at ECS
 	InstanceTypesAndZonesTTL = 5 * time.Minute
+	// OfferingPreflightTTL is the time the instance types ECS reported as available in a zone are trusted
+	// without preflighting the zone again
+	OfferingPreflightTTL = 30 * time.Second
+	// InstanceTypeOfferingsRefreshInterval is the default interval to re-query the offerings of instance types in every zone
+	InstanceTypeOfferingsRefreshInterval = 5 * time.Minute
 )
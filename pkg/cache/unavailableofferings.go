@@ -55,8 +55,12 @@ func (u *UnavailableOfferings) IsUnavailable(instanceType, zone, capacityType st
 	return found
 }
 
-// MarkUnavailableWithTTL allows us to mark an offering unavailable with a custom TTL
+// MarkUnavailableWithTTL allows us to mark an offering unavailable with a custom TTL, the offering isn't marked
+// with a TTL which isn't positive
 func (u *UnavailableOfferings) MarkUnavailableWithTTL(ctx context.Context, unavailableReason, instanceType, zone, capacityType string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
 	// even if the key is already in the cache, we still need to call Set to extend the cached entry's TTL
 	logging.FromContext(ctx).With(
 		"unavailable", unavailableReason,
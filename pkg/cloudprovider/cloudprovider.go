@@ -41,6 +41,7 @@ import (
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
 	cloudproviderevents "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cloudprovider/events"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instancetype"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
@@ -48,6 +49,9 @@ import (
 
 const CloudProviderName = "alibabacloud"
 
+// ConditionKubeletUnhealthy is reported by the node problem detector when the health check of the kubelet fails
+const ConditionKubeletUnhealthy corev1.NodeConditionType = "KubeletUnhealthy"
+
 var _ cloudprovider.CloudProvider = (*CloudProvider)(nil)
 
 type CloudProvider struct {
@@ -56,9 +60,12 @@ type CloudProvider struct {
 
 	instanceTypeProvider instancetype.Provider
 	instanceProvider     instance.Provider
+
+	repairPolicies []cloudprovider.RepairPolicy
 }
 
-func New(kubeClient client.Client,
+func New(ctx context.Context,
+	kubeClient client.Client,
 	recorder events.Recorder,
 	instanceTypeProvider instancetype.Provider,
 	instanceProvider instance.Provider) *CloudProvider {
@@ -68,6 +75,8 @@ func New(kubeClient client.Client,
 
 		instanceTypeProvider: instanceTypeProvider,
 		instanceProvider:     instanceProvider,
+
+		repairPolicies: repairPolicies(lo.FromPtr(options.FromContext(ctx))),
 	}
 }
 
@@ -135,7 +144,7 @@ func (c *CloudProvider) List(ctx context.Context) ([]*karpv1.NodeClaim, error) {
 }
 
 func (c *CloudProvider) Get(ctx context.Context, providerID string) (*karpv1.NodeClaim, error) {
-	id, err := utils.ParseInstanceID(providerID)
+	_, id, err := utils.ParseProviderID(providerID)
 	if err != nil {
 		log.FromContext(ctx).Error(err, "parsing instance ID")
 		return nil, fmt.Errorf("getting instance ID, %w", err)
@@ -181,7 +190,7 @@ func (c *CloudProvider) GetInstanceTypes(ctx context.Context, nodePool *karpv1.N
 		return nil, err
 	}
 	// TODO: break this coupling
-	instanceTypes, err := c.instanceTypeProvider.List(ctx, nodeClass.Spec.KubeletConfiguration, nodeClass)
+	instanceTypes, err := c.instanceTypeProvider.List(ctx, nodeClass.ResolvedKubeletConfiguration(), nodeClass)
 	if err != nil {
 		log.FromContext(ctx).Error(err, "listing instance types")
 		return nil, err
@@ -190,7 +199,7 @@ func (c *CloudProvider) GetInstanceTypes(ctx context.Context, nodePool *karpv1.N
 }
 
 func (c *CloudProvider) Delete(ctx context.Context, nodeClaim *karpv1.NodeClaim) error {
-	id, err := utils.ParseInstanceID(nodeClaim.Status.ProviderID)
+	_, id, err := utils.ParseProviderID(nodeClaim.Status.ProviderID)
 	if err != nil {
 		return fmt.Errorf("getting instance ID, %w", err)
 	}
@@ -306,9 +315,17 @@ func (c *CloudProvider) instanceToNodeClaim(i *instance.Instance, instanceType *
 	}
 	labels[corev1.LabelTopologyZone] = i.Zone
 	labels[karpv1.CapacityTypeLabelKey] = i.CapacityType
+	// The instances in a capacity reservation are on-demand, the reservation is told apart by its label
+	if i.CapacityReservationID != "" {
+		labels[v1alpha1.LabelCapacityReservationID] = i.CapacityReservationID
+	}
 	if v, ok := i.Tags[karpv1.NodePoolLabelKey]; ok {
 		labels[karpv1.NodePoolLabelKey] = v
 	}
+	// The NodeClaim the instance is launched for, its provider id may not be persisted yet
+	if v, ok := i.Tags[v1alpha1.TagNodeClaim]; ok {
+		annotations[v1alpha1.TagNodeClaim] = v
+	}
 	nodeClaim.Labels = labels
 	nodeClaim.Annotations = annotations
 
@@ -319,7 +336,7 @@ func (c *CloudProvider) instanceToNodeClaim(i *instance.Instance, instanceType *
 		nodeClaim.DeletionTimestamp = &metav1.Time{Time: time.Now()}
 	}
 
-	nodeClaim.Status.ProviderID = fmt.Sprintf("%s.%s", i.Region, i.ID)
+	nodeClaim.Status.ProviderID = utils.FormatProviderID(i.Region, i.ID)
 	nodeClaim.Status.ImageID = i.ImageID
 	return nodeClaim
 }
@@ -339,7 +356,7 @@ func (c *CloudProvider) resolveNodeClassFromNodeClaim(ctx context.Context, nodeC
 }
 
 func (c *CloudProvider) resolveInstanceTypes(ctx context.Context, nodeClaim *karpv1.NodeClaim, nodeClass *v1alpha1.ECSNodeClass) ([]*cloudprovider.InstanceType, error) {
-	instanceTypes, err := c.instanceTypeProvider.List(ctx, nodeClass.Spec.KubeletConfiguration, nodeClass)
+	instanceTypes, err := c.instanceTypeProvider.List(ctx, nodeClass.ResolvedKubeletConfiguration(), nodeClass)
 	if err != nil {
 		return nil, fmt.Errorf("getting instance types, %w", err)
 	}
@@ -352,18 +369,39 @@ func (c *CloudProvider) resolveInstanceTypes(ctx context.Context, nodeClaim *kar
 }
 
 func (c *CloudProvider) RepairPolicies() []cloudprovider.RepairPolicy {
-	return []cloudprovider.RepairPolicy{
-		// Supported Kubelet Node Conditions
-		// TODO: check ack and fix this part
+	return c.repairPolicies
+}
+
+// repairPolicies returns the unhealthy node conditions Karpenter replaces the nodes on, a condition with a zero
+// toleration is not repaired
+func repairPolicies(o options.Options) []cloudprovider.RepairPolicy {
+	policies := []cloudprovider.RepairPolicy{
+		// The kubelet reports the node is not ready
 		{
 			ConditionType:      corev1.NodeReady,
 			ConditionStatus:    corev1.ConditionFalse,
-			TolerationDuration: 30 * time.Minute,
+			TolerationDuration: o.RepairNodeNotReadyToleration,
 		},
+		// The kubelet stopped reporting the status of the node, e.g. the instance is hung
 		{
 			ConditionType:      corev1.NodeReady,
 			ConditionStatus:    corev1.ConditionUnknown,
-			TolerationDuration: 30 * time.Minute,
+			TolerationDuration: o.RepairNodeNotReadyToleration,
+		},
+		// The CNI failed to set up the network of the node
+		{
+			ConditionType:      corev1.NodeNetworkUnavailable,
+			ConditionStatus:    corev1.ConditionTrue,
+			TolerationDuration: o.RepairNetworkUnavailableToleration,
+		},
+		// The node problem detector shipped with ACK reports the kubelet is unhealthy
+		{
+			ConditionType:      ConditionKubeletUnhealthy,
+			ConditionStatus:    corev1.ConditionTrue,
+			TolerationDuration: o.RepairKubeletUnhealthyToleration,
 		},
 	}
+	return lo.Filter(policies, func(p cloudprovider.RepairPolicy, _ int) bool {
+		return p.TolerationDuration > 0
+	})
 }
@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	kcache "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/fake"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
+)
+
+func TestGet(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	ecsAPI := fake.NewECSAPI()
+	ecsAPI.Seed(fake.ECSAPIState{Instances: []*ecsclient.DescribeInstancesResponseBodyInstancesInstance{{
+		InstanceId:   tea.String("i-1"),
+		InstanceType: tea.String("ecs.g7.large"),
+		ImageId:      tea.String("image-id"),
+		RegionId:     tea.String(fake.DefaultRegion),
+		ZoneId:       tea.String("cn-hangzhou-i"),
+		Status:       tea.String(instance.InstanceStatusRunning),
+		SpotStrategy: tea.String("NoSpot"),
+		CreationTime: tea.String("2025-01-01T00:00Z"),
+	}}})
+	c := &CloudProvider{instanceProvider: instance.NewDefaultProvider(ctx, fake.DefaultRegion, ecsAPI, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)}
+
+	nodeClaim, err := c.Get(ctx, fake.DefaultRegion+".i-1")
+	require.NoError(t, err)
+	assert.Equal(t, fake.DefaultRegion+".i-1", nodeClaim.Status.ProviderID)
+	assert.Equal(t, "image-id", nodeClaim.Status.ImageID)
+	assert.Equal(t, "cn-hangzhou-i", nodeClaim.Labels[corev1.LabelTopologyZone])
+	assert.Equal(t, karpv1.CapacityTypeOnDemand, nodeClaim.Labels[karpv1.CapacityTypeLabelKey])
+	assert.NotContains(t, nodeClaim.Labels, v1alpha1.LabelCapacityReservationID)
+	// only the instance is described
+	require.Equal(t, 1, ecsAPI.DescribeInstancesBehavior.Calls())
+	assert.Equal(t, `["i-1"]`, tea.StringValue(ecsAPI.DescribeInstancesBehavior.Requests()[0].InstanceIds))
+
+	_, err = c.Get(ctx, fake.DefaultRegion+".i-2")
+	assert.True(t, cloudprovider.IsNodeClaimNotFoundError(err))
+
+	for _, providerID := range []string{"", "i-1", fake.DefaultRegion + ".", ".i-1", "cn.hangzhou.i-1"} {
+		_, err = c.Get(ctx, providerID)
+		assert.Error(t, err, providerID)
+		assert.False(t, cloudprovider.IsNodeClaimNotFoundError(err), providerID)
+	}
+	assert.Equal(t, 2, ecsAPI.DescribeInstancesBehavior.Calls())
+}
+
+func TestGetCapacityReservation(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	ecsAPI := fake.NewECSAPI()
+	ecsAPI.Seed(fake.ECSAPIState{Instances: []*ecsclient.DescribeInstancesResponseBodyInstancesInstance{{
+		InstanceId:                 tea.String("i-1"),
+		InstanceType:               tea.String("ecs.g7.large"),
+		ImageId:                    tea.String("image-id"),
+		RegionId:                   tea.String(fake.DefaultRegion),
+		ZoneId:                     tea.String("cn-hangzhou-j"),
+		Status:                     tea.String(instance.InstanceStatusRunning),
+		SpotStrategy:               tea.String("NoSpot"),
+		CreationTime:               tea.String("2025-01-01T00:00Z"),
+		EcsCapacityReservationAttr: &ecsclient.DescribeInstancesResponseBodyInstancesInstanceEcsCapacityReservationAttr{CapacityReservationId: tea.String("crp-1")},
+	}}})
+	c := &CloudProvider{instanceProvider: instance.NewDefaultProvider(ctx, fake.DefaultRegion, ecsAPI, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)}
+
+	// the instance in the capacity reservation is labeled with it, so it matches the reserved offering
+	nodeClaim, err := c.Get(ctx, fake.DefaultRegion+".i-1")
+	require.NoError(t, err)
+	assert.Equal(t, "crp-1", nodeClaim.Labels[v1alpha1.LabelCapacityReservationID])
+	assert.Equal(t, karpv1.CapacityTypeOnDemand, nodeClaim.Labels[karpv1.CapacityTypeLabelKey])
+}
+
+func TestRepairPolicies(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{
+		RepairNodeNotReadyToleration:       20 * time.Minute,
+		RepairNetworkUnavailableToleration: 15 * time.Minute,
+		RepairKubeletUnhealthyToleration:   10 * time.Minute,
+	})
+	assert.ElementsMatch(t, []cloudprovider.RepairPolicy{
+		{ConditionType: corev1.NodeReady, ConditionStatus: corev1.ConditionFalse, TolerationDuration: 20 * time.Minute},
+		{ConditionType: corev1.NodeReady, ConditionStatus: corev1.ConditionUnknown, TolerationDuration: 20 * time.Minute},
+		{ConditionType: corev1.NodeNetworkUnavailable, ConditionStatus: corev1.ConditionTrue, TolerationDuration: 15 * time.Minute},
+		{ConditionType: ConditionKubeletUnhealthy, ConditionStatus: corev1.ConditionTrue, TolerationDuration: 10 * time.Minute},
+	}, New(ctx, nil, nil, nil, nil).RepairPolicies())
+
+	// a zero toleration doesn't repair the condition
+	ctx = options.ToContext(context.Background(), &options.Options{RepairNodeNotReadyToleration: 30 * time.Minute})
+	assert.ElementsMatch(t, []cloudprovider.RepairPolicy{
+		{ConditionType: corev1.NodeReady, ConditionStatus: corev1.ConditionFalse, TolerationDuration: 30 * time.Minute},
+		{ConditionType: corev1.NodeReady, ConditionStatus: corev1.ConditionUnknown, TolerationDuration: 30 * time.Minute},
+	}, New(ctx, nil, nil, nil, nil).RepairPolicies())
+}
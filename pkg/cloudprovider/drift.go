@@ -24,6 +24,7 @@ import (
 	"sigs.k8s.io/karpenter/pkg/cloudprovider"
 
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
 )
@@ -32,6 +33,8 @@ const (
 	VSwitchDrift       cloudprovider.DriftReason = "VSwitchDrift"
 	SecurityGroupDrift cloudprovider.DriftReason = "SecurityGroupDrift"
 	NodeClassDrift     cloudprovider.DriftReason = "NodeClassDrift"
+	ImageDrift         cloudprovider.DriftReason = "ImageDrift"
+	UserDataDrift      cloudprovider.DriftReason = "UserDataDrift"
 )
 
 func (c *CloudProvider) isNodeClassDrifted(ctx context.Context, nodeClaim *karpv1.NodeClaim, _ *karpv1.NodePool, nodeClass *v1alpha1.ECSNodeClass) (cloudprovider.DriftReason, error) {
@@ -43,7 +46,11 @@ func (c *CloudProvider) isNodeClassDrifted(ctx context.Context, nodeClaim *karpv
 	if err != nil {
 		return "", err
 	}
-	securityGroupDrifted, err := c.areSecurityGroupsDrifted(instance, nodeClass)
+	imageDrifted, err := c.isImageDrifted(instance, nodeClass)
+	if err != nil {
+		return "", fmt.Errorf("calculating image drift, %w", err)
+	}
+	securityGroupDrifted, err := c.areSecurityGroupsDrifted(ctx, instance, nodeClass)
 	if err != nil {
 		return "", fmt.Errorf("calculating securitygroup drift, %w", err)
 	}
@@ -51,7 +58,8 @@ func (c *CloudProvider) isNodeClassDrifted(ctx context.Context, nodeClaim *karpv
 	if err != nil {
 		return "", fmt.Errorf("calculating vSwitch drift, %w", err)
 	}
-	drifted := lo.FindOrElse([]cloudprovider.DriftReason{securityGroupDrifted, vSwitchDrifted}, "", func(i cloudprovider.DriftReason) bool {
+	userDataDrifted := isUserDataDrifted(instance, nodeClass)
+	drifted := lo.FindOrElse([]cloudprovider.DriftReason{imageDrifted, securityGroupDrifted, vSwitchDrifted, userDataDrifted}, "", func(i cloudprovider.DriftReason) bool {
 		return string(i) != ""
 	})
 	return drifted, nil
@@ -73,15 +81,39 @@ func (c *CloudProvider) areStaticFieldsDrifted(nodeClaim *karpv1.NodeClaim, node
 	return lo.Ternary(nodeClassHash != nodeClaimHash, NodeClassDrift, "")
 }
 
+// Checks if the image is drifted, by comparing the images resolved in the ECSNodeClass status
+// to the ecs instance image
+func (c *CloudProvider) isImageDrifted(ecsInstance *instance.Instance, nodeClass *v1alpha1.ECSNodeClass) (cloudprovider.DriftReason, error) {
+	// The images are unknown until they are resolved, this must not be reported as drift
+	if len(nodeClass.Status.Images) == 0 || !nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeImagesReady).IsTrue() {
+		return "", fmt.Errorf("no images are resolved in the status")
+	}
+
+	if !lo.ContainsBy(nodeClass.Status.Images, func(im v1alpha1.Image) bool {
+		return im.ID == ecsInstance.ImageID
+	}) {
+		return ImageDrift, nil
+	}
+	return "", nil
+}
+
 // Checks if the security groups are drifted, by comparing the security groups returned from the SecurityGroupProvider
-// to the ecs instance security groups
-func (c *CloudProvider) areSecurityGroupsDrifted(ecsInstance *instance.Instance, nodeClass *v1alpha1.ECSNodeClass) (cloudprovider.DriftReason, error) {
+// to the ecs instance security groups, the order of the security groups is irrelevant.
+// In superset mode, security groups attached to the instance out-of-band are not drift.
+func (c *CloudProvider) areSecurityGroupsDrifted(ctx context.Context, ecsInstance *instance.Instance, nodeClass *v1alpha1.ECSNodeClass) (cloudprovider.DriftReason, error) {
 	securityGroupIds := sets.New(lo.Map(nodeClass.Status.SecurityGroups, func(sg v1alpha1.SecurityGroup, _ int) string { return sg.ID })...)
 	if len(securityGroupIds) == 0 {
 		return "", fmt.Errorf("no security groups are present in the status")
 	}
 
-	if !securityGroupIds.Equal(sets.New(ecsInstance.SecurityGroupIDs...)) {
+	instanceSecurityGroupIds := sets.New(ecsInstance.SecurityGroupIDs...)
+	if options.FromContext(ctx).SecurityGroupDriftMode == options.SecurityGroupDriftModeSuperset {
+		if !instanceSecurityGroupIds.IsSuperset(securityGroupIds) {
+			return SecurityGroupDrift, nil
+		}
+		return "", nil
+	}
+	if !securityGroupIds.Equal(instanceSecurityGroupIds) {
 		return SecurityGroupDrift, nil
 	}
 	return "", nil
@@ -105,9 +137,19 @@ func (c *CloudProvider) isVSwitchDrifted(instance *instance.Instance, nodeClass
 	return "", nil
 }
 
+// Checks if the user data is drifted, by comparing the UserDataHash the ecs instance is tagged with at launch to the one
+// of the ECSNodeClass. The instances launched before the tag was added are not drifted.
+func isUserDataDrifted(instance *instance.Instance, nodeClass *v1alpha1.ECSNodeClass) cloudprovider.DriftReason {
+	userDataHash, ok := instance.Tags[v1alpha1.TagUserDataHash]
+	if !ok {
+		return ""
+	}
+	return lo.Ternary(userDataHash != nodeClass.UserDataHash(), UserDataDrift, "")
+}
+
 func (c *CloudProvider) getInstance(ctx context.Context, providerID string) (*instance.Instance, error) {
 	// Get InstanceID to fetch from ECS
-	instanceID, err := utils.ParseInstanceID(providerID)
+	_, instanceID, err := utils.ParseProviderID(providerID)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,110 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
+)
+
+func TestIsImageDrifted(t *testing.T) {
+	c := &CloudProvider{}
+	ecsInstance := &instance.Instance{ID: "i-123", ImageID: "aliyun_3_x64_20G_alibase_20240819.vhd"}
+	nodeClass := &v1alpha1.ECSNodeClass{}
+	nodeClass.Status.Images = []v1alpha1.Image{{ID: "aliyun_3_x64_20G_alibase_20240819.vhd"}}
+	nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeImagesReady)
+
+	drifted, err := c.isImageDrifted(ecsInstance, nodeClass)
+	assert.NoError(t, err)
+	assert.Empty(t, drifted)
+
+	// A newer image is resolved
+	nodeClass.Status.Images = []v1alpha1.Image{{ID: "aliyun_3_x64_20G_alibase_20241011.vhd"}}
+	drifted, err = c.isImageDrifted(ecsInstance, nodeClass)
+	assert.NoError(t, err)
+	assert.Equal(t, ImageDrift, drifted)
+
+	// The images failed to resolve
+	nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeImagesReady, "ImagesNotFound", "ImageSelector did not match any Images")
+	drifted, err = c.isImageDrifted(ecsInstance, nodeClass)
+	assert.Error(t, err)
+	assert.Empty(t, drifted)
+
+	nodeClass.Status.Images = nil
+	drifted, err = c.isImageDrifted(ecsInstance, nodeClass)
+	assert.Error(t, err)
+	assert.Empty(t, drifted)
+}
+
+func TestAreSecurityGroupsDrifted(t *testing.T) {
+	c := &CloudProvider{}
+	nodeClass := &v1alpha1.ECSNodeClass{}
+	nodeClass.Status.SecurityGroups = []v1alpha1.SecurityGroup{{ID: "sg-1"}, {ID: "sg-2"}}
+
+	cases := []struct {
+		name             string
+		mode             string
+		securityGroupIDs []string
+		drifted          bool
+	}{
+		{name: "unchanged in another order", mode: options.SecurityGroupDriftModeStrict, securityGroupIDs: []string{"sg-2", "sg-1"}},
+		{name: "removed group", mode: options.SecurityGroupDriftModeStrict, securityGroupIDs: []string{"sg-1"}, drifted: true},
+		{name: "added group", mode: options.SecurityGroupDriftModeStrict, securityGroupIDs: []string{"sg-1", "sg-2", "sg-3"}, drifted: true},
+		{name: "removed group in superset mode", mode: options.SecurityGroupDriftModeSuperset, securityGroupIDs: []string{"sg-1", "sg-3"}, drifted: true},
+		{name: "added group in superset mode", mode: options.SecurityGroupDriftModeSuperset, securityGroupIDs: []string{"sg-1", "sg-2", "sg-3"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := options.ToContext(context.Background(), &options.Options{SecurityGroupDriftMode: tc.mode})
+			drifted, err := c.areSecurityGroupsDrifted(ctx, &instance.Instance{SecurityGroupIDs: tc.securityGroupIDs}, nodeClass)
+			assert.NoError(t, err)
+			if tc.drifted {
+				assert.Equal(t, SecurityGroupDrift, drifted)
+			} else {
+				assert.Empty(t, drifted)
+			}
+		})
+	}
+}
+
+func TestIsUserDataDrifted(t *testing.T) {
+	nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{
+		UserData:             tea.String("#!/bin/bash\necho hello\n"),
+		KubeletConfiguration: &v1alpha1.KubeletConfiguration{MaxPods: tea.Int32(64)},
+	}}
+	ecsInstance := &instance.Instance{Tags: map[string]string{v1alpha1.TagUserDataHash: nodeClass.UserDataHash()}}
+	assert.Empty(t, isUserDataDrifted(ecsInstance, nodeClass))
+
+	// reformatting the user data doesn't change what it runs
+	nodeClass.Spec.UserData = tea.String("#!/bin/bash\r\n\r\necho hello  \r\n\r\n")
+	assert.Empty(t, isUserDataDrifted(ecsInstance, nodeClass))
+
+	nodeClass.Spec.UserData = tea.String("#!/bin/bash\necho world\n")
+	assert.Equal(t, UserDataDrift, isUserDataDrifted(ecsInstance, nodeClass))
+
+	nodeClass.Spec.UserData = tea.String("#!/bin/bash\necho hello\n")
+	nodeClass.Spec.KubeletConfiguration.MaxPods = tea.Int32(110)
+	assert.Equal(t, UserDataDrift, isUserDataDrifted(ecsInstance, nodeClass))
+
+	// the instances launched before the hash was tagged are not drifted
+	assert.Empty(t, isUserDataDrifted(&instance.Instance{}, nodeClass))
+}
@@ -29,20 +29,26 @@ import (
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/interruption"
 	nodeclaimgarbagecollection "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/nodeclaim/garbagecollection"
+	nodeclaimlaunchtimeout "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/nodeclaim/launchtimeout"
 	nodeclaimtagging "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/nodeclaim/tagging"
+	nodeclaimtagsync "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/nodeclaim/tagsync"
 	nodeclaimunregisteredtaint "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/nodeclaim/unregisteredtaint"
 	nodeclasshash "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/nodeclass/hash"
 	nodeclaasstatus "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/nodeclass/status"
 	nodeclasstermination "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/nodeclass/termination"
 	nodeclassvolumesize "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/nodeclass/volumesize"
 	providersinstancetype "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/providers/instancetype"
+	providersinstancetypeoffering "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/providers/instancetype/offering"
 	controllerspricing "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/providers/pricing"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/controllers/telemetry"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/capacityreservation"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/imagefamily"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instancetype"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/keypair"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/pricing"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/quota"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/securitygroup"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/vswitch"
 )
@@ -54,22 +60,36 @@ func NewControllers(ctx context.Context, mgr manager.Manager, clk clock.Clock, r
 	instanceProvider instance.Provider, instanceTypeProvider instancetype.Provider,
 	pricingProvider pricing.Provider,
 	vSwitchProvider vswitch.Provider, securityGroupProvider securitygroup.Provider,
-	imageProvider imagefamily.Provider) []controller.Controller {
+	imageProvider imagefamily.Provider, capacityReservationProvider capacityreservation.Provider,
+	keyPairProvider keypair.Provider, quotaProvider quota.Provider) []controller.Controller {
 
 	controllers := []controller.Controller{
 		nodeclasshash.NewController(kubeClient),
 		nodeclassvolumesize.NewController(kubeClient),
-		nodeclaasstatus.NewController(kubeClient, vSwitchProvider, securityGroupProvider, imageProvider),
+		nodeclaasstatus.NewController(kubeClient, vSwitchProvider, securityGroupProvider, imageProvider, capacityReservationProvider, keyPairProvider, quotaProvider),
 		nodeclasstermination.NewController(kubeClient, recorder),
-		controllerspricing.NewController(pricingProvider),
+		controllerspricing.NewController(pricingProvider, instanceTypeProvider),
 		nodeclaimgarbagecollection.NewController(kubeClient, cloudProvider),
 		nodeclaimunregisteredtaint.NewController(kubeClient),
 		nodeclaimtagging.NewController(kubeClient, instanceProvider),
+		nodeclaimlaunchtimeout.NewController(kubeClient, instanceProvider),
 		providersinstancetype.NewController(instanceTypeProvider),
+		providersinstancetypeoffering.NewController(instanceTypeProvider),
 	}
 
 	if options.FromContext(ctx).Interruption {
-		controllers = append(controllers, interruption.NewController(kubeClient, recorder, unavailableOfferings))
+		controllers = append(controllers,
+			interruption.NewController(kubeClient, recorder, unavailableOfferings),
+			interruption.NewSpotController(kubeClient, recorder, unavailableOfferings, instanceProvider),
+		)
+	}
+
+	if options.FromContext(ctx).PricingMode == options.PricingModeCommittedUse {
+		controllers = append(controllers, controllerspricing.NewCommittedUseController(kubeClient, pricingProvider))
+	}
+
+	if options.FromContext(ctx).NodeClassTagSync {
+		controllers = append(controllers, nodeclaimtagsync.NewController(kubeClient, instanceProvider))
 	}
 
 	if options.FromContext(ctx).TelemetryShare {
@@ -67,10 +67,17 @@ func (c *Controller) Reconcile(ctx context.Context, node *corev1.Node) (reconcil
 		return reconcile.Result{}, nil
 	}
 
+	if err := c.taint(ctx, node); err != nil {
+		return reconcile.Result{RequeueAfter: time.Second * 5}, err
+	}
 	nodeClaim, err := c.getNodeClaimByNodeName(ctx, node.Name)
 	if err != nil {
 		return reconcile.Result{RequeueAfter: time.Second * 5}, err
 	}
+	// The NodeClaim is gone already, the node is left to the termination of karpenter
+	if nodeClaim == nil {
+		return reconcile.Result{}, nil
+	}
 
 	zone := nodeClaim.Labels[corev1.LabelTopologyZone]
 	instanceType := nodeClaim.Labels[corev1.LabelInstanceTypeStable]
@@ -99,7 +106,24 @@ func (c *Controller) Register(_ context.Context, m manager.Manager) error {
 		Complete(reconcile.AsReconciler(m.GetClient(), c))
 }
 
-// deleteNodeClaim removes the NodeClaim from the api-server
+// taint adds the karpenter.sh/disruption taint to the interrupted node, so that no new pods land on it while its
+// NodeClaim is deleted and the pods are drained to the replacement capacity
+func (c *Controller) taint(ctx context.Context, node *corev1.Node) error {
+	if lo.ContainsBy(node.Spec.Taints, func(taint corev1.Taint) bool { return taint.MatchTaint(&karpv1.DisruptedNoScheduleTaint) }) {
+		return nil
+	}
+	stored := node.DeepCopy()
+	node.Spec.Taints = append(node.Spec.Taints, karpv1.DisruptedNoScheduleTaint)
+	// The taints are a list, the optimistic lock keeps the taints added meanwhile
+	if err := c.kubeClient.Patch(ctx, node, client.MergeFromWithOptions(stored, client.MergeFromWithOptimisticLock{})); err != nil {
+		return client.IgnoreNotFound(fmt.Errorf("tainting the node on interruption, %w", err))
+	}
+	return nil
+}
+
+// deleteNodeClaim removes the NodeClaim from the api-server, so that karpenter requests the replacement capacity
+// before the instance is reclaimed. The NodeClaims already being deleted are skipped, so an interruption seen twice
+// publishes the events once.
 func (c *Controller) deleteNodeClaim(ctx context.Context, nodeClaim *karpv1.NodeClaim, node *corev1.Node) error {
 	if !nodeClaim.DeletionTimestamp.IsZero() {
 		return nil
@@ -112,6 +136,7 @@ func (c *Controller) deleteNodeClaim(ctx context.Context, nodeClaim *karpv1.Node
 	return nil
 }
 
+// getNodeClaimByNodeName returns the NodeClaim of the node, or nil when it doesn't exist
 func (c *Controller) getNodeClaimByNodeName(ctx context.Context, nodeName string) (*karpv1.NodeClaim, error) {
 	nodeClaimList := &karpv1.NodeClaimList{}
 	if err := c.kubeClient.List(ctx, nodeClaimList); err != nil {
@@ -124,5 +149,5 @@ func (c *Controller) getNodeClaimByNodeName(ctx context.Context, nodeName string
 		}
 	}
 
-	return nil, fmt.Errorf("no nodeclaim found for node %s", nodeName)
+	return nil, nil
 }
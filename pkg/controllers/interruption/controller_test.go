@@ -0,0 +1,150 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package interruption
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/events"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
+)
+
+type fakeRecorder struct {
+	events []events.Event
+}
+
+func (f *fakeRecorder) Publish(evts ...events.Event) {
+	f.events = append(f.events, evts...)
+}
+
+// testObjects returns a spot node and its NodeClaim, the finalizer keeps the NodeClaim around once it's deleted
+func testObjects() (*corev1.Node, *karpv1.NodeClaim) {
+	labels := map[string]string{
+		karpv1.NodePoolLabelKey:        "default",
+		karpv1.CapacityTypeLabelKey:    karpv1.CapacityTypeSpot,
+		corev1.LabelTopologyZone:       "cn-hangzhou-i",
+		corev1.LabelInstanceTypeStable: "ecs.g7.large",
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: labels},
+		Spec:       corev1.NodeSpec{ProviderID: "cn-hangzhou.i-1"},
+	}
+	nodeClaim := &karpv1.NodeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "default-abcde", Labels: labels, Finalizers: []string{karpv1.TerminationFinalizer}},
+		Status:     karpv1.NodeClaimStatus{NodeName: node.Name},
+	}
+	return node, nodeClaim
+}
+
+// assertDisrupted asserts that the node is tainted once, and its NodeClaim is being deleted
+func assertDisrupted(t *testing.T, kubeClient client.Client, node *corev1.Node, nodeClaim *karpv1.NodeClaim) {
+	stored := &corev1.Node{}
+	require.NoError(t, kubeClient.Get(context.Background(), client.ObjectKeyFromObject(node), stored))
+	assert.Len(t, lo.Filter(stored.Spec.Taints, func(taint corev1.Taint, _ int) bool {
+		return taint.MatchTaint(&karpv1.DisruptedNoScheduleTaint)
+	}), 1)
+	storedNodeClaim := &karpv1.NodeClaim{}
+	require.NoError(t, kubeClient.Get(context.Background(), client.ObjectKeyFromObject(nodeClaim), storedNodeClaim))
+	assert.False(t, storedNodeClaim.DeletionTimestamp.IsZero())
+}
+
+func TestReconcilePreemption(t *testing.T) {
+	ctx := context.Background()
+	node, nodeClaim := testObjects()
+	node.Status.Conditions = []corev1.NodeCondition{{Type: ConditionTypeInstanceExpired, Status: corev1.ConditionTrue, Reason: "SpotInstanceInterruption"}}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(node, nodeClaim).WithStatusSubresource(nodeClaim).Build()
+	recorder := &fakeRecorder{}
+	unavailableOfferings := cache.NewUnavailableOfferings()
+	c := NewController(kubeClient, recorder, unavailableOfferings)
+
+	// the preempted node is tainted, its NodeClaim is deleted and the offering is marked unavailable
+	_, err := c.Reconcile(ctx, node.DeepCopy())
+	require.NoError(t, err)
+	assertDisrupted(t, kubeClient, node, nodeClaim)
+	assert.True(t, unavailableOfferings.IsUnavailable("ecs.g7.large", "cn-hangzhou-i", karpv1.CapacityTypeSpot))
+	assert.Equal(t, []string{"TerminatingOnInterruption", "TerminatingOnInterruption"}, lo.Map(recorder.events, func(e events.Event, _ int) string { return e.Reason }))
+
+	// the same preemption seen again doesn't taint or delete twice
+	stored := &corev1.Node{}
+	require.NoError(t, kubeClient.Get(ctx, client.ObjectKeyFromObject(node), stored))
+	_, err = c.Reconcile(ctx, stored)
+	require.NoError(t, err)
+	assertDisrupted(t, kubeClient, node, nodeClaim)
+	assert.Len(t, recorder.events, 2)
+
+	// the node without its NodeClaim is only tainted
+	node, _ = testObjects()
+	node.Status.Conditions = []corev1.NodeCondition{{Type: ConditionTypeInstanceExpired, Status: corev1.ConditionTrue}}
+	kubeClient = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(node).Build()
+	_, err = NewController(kubeClient, recorder, unavailableOfferings).Reconcile(ctx, node.DeepCopy())
+	require.NoError(t, err)
+	require.NoError(t, kubeClient.Get(ctx, client.ObjectKeyFromObject(node), stored))
+	assert.Contains(t, stored.Spec.Taints, karpv1.DisruptedNoScheduleTaint)
+	assert.Len(t, recorder.events, 2)
+}
+
+type fakeInstanceProvider struct {
+	instance.Provider
+	instances []*instance.Instance
+}
+
+func (f *fakeInstanceProvider) List(context.Context) ([]*instance.Instance, error) {
+	return f.instances, nil
+}
+
+func TestReconcileSpotInterruption(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{InterruptionPollInterval: time.Minute})
+	node, nodeClaim := testObjects()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(node, nodeClaim).WithStatusSubresource(nodeClaim).Build()
+	recorder := &fakeRecorder{}
+	unavailableOfferings := cache.NewUnavailableOfferings()
+	instanceProvider := &fakeInstanceProvider{instances: []*instance.Instance{
+		{ID: "i-1", CapacityType: karpv1.CapacityTypeSpot},
+		// the on-demand instances are never reclaimed, whatever locks them
+		{ID: "i-2", CapacityType: karpv1.CapacityTypeOnDemand, LockReasons: []string{instance.LockReasonRecycling}},
+	}}
+	c := NewSpotController(kubeClient, recorder, unavailableOfferings, instanceProvider)
+
+	result, err := c.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, result.RequeueAfter)
+	assert.Empty(t, recorder.events)
+
+	// the interrupted instance is polled until it's released, the node and the NodeClaim are disrupted once
+	instanceProvider.instances[0].LockReasons = []string{"recycling"}
+	for range 2 {
+		_, err := c.Reconcile(ctx)
+		require.NoError(t, err)
+		assertDisrupted(t, kubeClient, node, nodeClaim)
+	}
+	assert.True(t, unavailableOfferings.IsUnavailable("ecs.g7.large", "cn-hangzhou-i", karpv1.CapacityTypeSpot))
+	assert.Len(t, recorder.events, 2)
+}
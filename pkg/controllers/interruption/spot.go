@@ -0,0 +1,122 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package interruption
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/awslabs/operatorpkg/singleton"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/events"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
+)
+
+// SpotController polls the spot instances launched by karpenter for their interruption, ECS locks them as Recycling
+// until they're released. The nodes of the interrupted instances are tainted and their NodeClaims are deleted, so
+// that pods are drained before the instances are reclaimed.
+type SpotController struct {
+	*Controller
+	instanceProvider instance.Provider
+}
+
+func NewSpotController(kubeClient client.Client, recorder events.Recorder,
+	unavailableOfferingsCache *cache.UnavailableOfferings, instanceProvider instance.Provider) *SpotController {
+	return &SpotController{
+		Controller:       NewController(kubeClient, recorder, unavailableOfferingsCache),
+		instanceProvider: instanceProvider,
+	}
+}
+
+func (c *SpotController) Reconcile(ctx context.Context) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "interruption.spot")
+	interval := options.FromContext(ctx).InterruptionPollInterval
+
+	instances, err := c.instanceProvider.List(ctx)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing instances, %w", err)
+	}
+	interrupted := sets.New(lo.FilterMap(instances, func(i *instance.Instance, _ int) (string, bool) {
+		return i.ID, i.Interrupted()
+	})...)
+	if interrupted.Len() == 0 {
+		return reconcile.Result{RequeueAfter: interval}, nil
+	}
+
+	nodes, err := c.getNodesByInstanceIDs(ctx, interrupted)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	for i := range nodes {
+		if err := c.interrupt(log.IntoContext(ctx, log.FromContext(ctx).WithValues("Node", nodes[i].Name)), &nodes[i]); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	return reconcile.Result{RequeueAfter: interval}, nil
+}
+
+func (c *SpotController) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("interruption.spot").
+		WatchesRawSource(singleton.Source()).
+		Complete(singleton.AsReconciler(c))
+}
+
+// interrupt taints the node of the interrupted instance, marks its offering unavailable and deletes its NodeClaim
+func (c *SpotController) interrupt(ctx context.Context, node *corev1.Node) error {
+	if err := c.taint(ctx, node); err != nil {
+		return err
+	}
+	nodeClaim, err := c.getNodeClaimByNodeName(ctx, node.Name)
+	if err != nil {
+		return err
+	}
+	// The NodeClaim is gone already, the node is left to the termination of karpenter
+	if nodeClaim == nil {
+		return nil
+	}
+	zone := nodeClaim.Labels[corev1.LabelTopologyZone]
+	instanceType := nodeClaim.Labels[corev1.LabelInstanceTypeStable]
+	if zone != "" && instanceType != "" {
+		c.unavailableOfferingsCache.MarkUnavailable(ctx, "SpotInstanceInterruption", instanceType, zone, karpv1.CapacityTypeSpot)
+	}
+	return c.deleteNodeClaim(ctx, nodeClaim, node)
+}
+
+// getNodesByInstanceIDs returns the spot nodes of karpenter running on the instances
+func (c *SpotController) getNodesByInstanceIDs(ctx context.Context, instanceIDs sets.Set[string]) ([]corev1.Node, error) {
+	nodeList := &corev1.NodeList{}
+	if err := c.kubeClient.List(ctx, nodeList, client.HasLabels{karpv1.NodePoolLabelKey}); err != nil {
+		return nil, err
+	}
+	return lo.Filter(nodeList.Items, func(n corev1.Node, _ int) bool {
+		_, id, err := utils.ParseProviderID(n.Spec.ProviderID)
+		return err == nil && instanceIDs.Has(id) &&
+			n.Labels[karpv1.CapacityTypeLabelKey] == karpv1.CapacityTypeSpot
+	}), nil
+}
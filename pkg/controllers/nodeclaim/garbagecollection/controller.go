@@ -35,6 +35,8 @@ import (
 	"sigs.k8s.io/karpenter/pkg/cloudprovider"
 	"sigs.k8s.io/karpenter/pkg/operator/injection"
 
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
 )
 
@@ -74,21 +76,36 @@ func (c *Controller) Reconcile(ctx context.Context) (reconcile.Result, error) {
 	if err = c.kubeClient.List(ctx, nodeList); err != nil {
 		return reconcile.Result{}, err
 	}
-	resolvedProviderIDs := sets.New[string](lo.FilterMap(nodeClaimList.Items, func(n karpv1.NodeClaim, _ int) (string, bool) {
-		return n.Status.ProviderID, n.Status.ProviderID != ""
-	})...)
-	errs := make([]error, len(retrieved))
-	workqueue.ParallelizeUntil(ctx, 100, len(managedRetrieved), func(i int) {
-		if !resolvedProviderIDs.Has(managedRetrieved[i].Status.ProviderID) &&
-			time.Since(managedRetrieved[i].CreationTimestamp.Time) > time.Second*30 {
-			errs[i] = c.garbageCollect(ctx, managedRetrieved[i], nodeList)
-		}
+	orphaned := orphanedInstances(managedRetrieved, nodeClaimList.Items, options.FromContext(ctx).GarbageCollectionGracePeriod)
+	errs := make([]error, len(orphaned))
+	workqueue.ParallelizeUntil(ctx, 100, len(orphaned), func(i int) {
+		errs[i] = c.garbageCollect(ctx, orphaned[i], nodeList)
 	})
 	if err = multierr.Combine(errs...); err != nil {
 		return reconcile.Result{}, err
 	}
 	c.successfulCount++
-	return reconcile.Result{RequeueAfter: lo.Ternary(c.successfulCount <= 20, time.Second*10, time.Minute)}, nil
+	interval := options.FromContext(ctx).GarbageCollectionInterval
+	return reconcile.Result{RequeueAfter: lo.Ternary(c.successfulCount <= 20, min(time.Second*10, interval), interval)}, nil
+}
+
+// orphanedInstances returns the instances without a NodeClaim that were launched longer than the grace period ago.
+// An instance tagged with a NodeClaim which has no provider id yet is in the registration window, the provider id
+// is persisted after the launch returns, so it's not an orphan.
+func orphanedInstances(retrieved []*karpv1.NodeClaim, nodeClaims []karpv1.NodeClaim, gracePeriod time.Duration) []*karpv1.NodeClaim {
+	resolvedProviderIDs := sets.New[string](lo.FilterMap(nodeClaims, func(n karpv1.NodeClaim, _ int) (string, bool) {
+		return n.Status.ProviderID, n.Status.ProviderID != ""
+	})...)
+	launchingNodeClaims := sets.New[string](lo.FilterMap(nodeClaims, func(n karpv1.NodeClaim, _ int) (string, bool) {
+		return n.Name, n.Status.ProviderID == ""
+	})...)
+	return lo.Filter(retrieved, func(nc *karpv1.NodeClaim, _ int) bool {
+		if resolvedProviderIDs.Has(nc.Status.ProviderID) || time.Since(nc.CreationTimestamp.Time) <= gracePeriod {
+			return false
+		}
+		name, ok := nc.Annotations[v1alpha1.TagNodeClaim]
+		return !ok || !launchingNodeClaims.Has(name)
+	})
 }
 
 func (c *Controller) garbageCollect(ctx context.Context, nodeClaim *karpv1.NodeClaim, nodeList *corev1.NodeList) error {
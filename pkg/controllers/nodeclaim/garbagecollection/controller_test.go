@@ -0,0 +1,128 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package garbagecollection
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+)
+
+type fakeKubeClient struct {
+	client.Client
+	mu           sync.Mutex
+	nodeClaims   []karpv1.NodeClaim
+	nodes        []corev1.Node
+	deletedNodes []string
+}
+
+func (f *fakeKubeClient) List(_ context.Context, list client.ObjectList, _ ...client.ListOption) error {
+	switch l := list.(type) {
+	case *karpv1.NodeClaimList:
+		l.Items = f.nodeClaims
+	case *corev1.NodeList:
+		l.Items = f.nodes
+	}
+	return nil
+}
+
+func (f *fakeKubeClient) Delete(_ context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deletedNodes = append(f.deletedNodes, obj.GetName())
+	return nil
+}
+
+type fakeCloudProvider struct {
+	cloudprovider.CloudProvider
+	mu        sync.Mutex
+	instances []*karpv1.NodeClaim
+	deleted   []string
+}
+
+func (f *fakeCloudProvider) List(context.Context) ([]*karpv1.NodeClaim, error) {
+	return f.instances, nil
+}
+
+func (f *fakeCloudProvider) Delete(_ context.Context, nodeClaim *karpv1.NodeClaim) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = append(f.deleted, nodeClaim.Status.ProviderID)
+	return nil
+}
+
+func testInstance(providerID, nodeClaimName string, age time.Duration) *karpv1.NodeClaim {
+	return &karpv1.NodeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			Annotations:       map[string]string{v1alpha1.TagNodeClaim: nodeClaimName},
+		},
+		Status: karpv1.NodeClaimStatus{ProviderID: providerID},
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{
+		GarbageCollectionGracePeriod: time.Minute,
+		GarbageCollectionInterval:    5 * time.Minute,
+	})
+	kubeClient := &fakeKubeClient{
+		nodeClaims: []karpv1.NodeClaim{
+			{ObjectMeta: metav1.ObjectMeta{Name: "healthy"}, Status: karpv1.NodeClaimStatus{ProviderID: "cn-hangzhou.i-healthy"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "registering"}},
+		},
+		nodes: []corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "healthy"}, Spec: corev1.NodeSpec{ProviderID: "cn-hangzhou.i-healthy"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "orphaned"}, Spec: corev1.NodeSpec{ProviderID: "cn-hangzhou.i-orphaned"}},
+		},
+	}
+	cloudProvider := &fakeCloudProvider{instances: []*karpv1.NodeClaim{
+		testInstance("cn-hangzhou.i-healthy", "healthy", time.Hour),
+		testInstance("cn-hangzhou.i-orphaned", "deleted", time.Hour),
+		// a second instance launched for a NodeClaim which already has one
+		testInstance("cn-hangzhou.i-duplicate", "healthy", time.Hour),
+		// the provider id of the NodeClaim is not persisted yet
+		testInstance("cn-hangzhou.i-registering", "registering", time.Hour),
+		// the instance is still in the grace period
+		testInstance("cn-hangzhou.i-new", "deleted", time.Second),
+	}}
+	c := NewController(kubeClient, cloudProvider)
+
+	result, err := c.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"cn-hangzhou.i-orphaned", "cn-hangzhou.i-duplicate"}, cloudProvider.deleted)
+	assert.Equal(t, []string{"orphaned"}, kubeClient.deletedNodes)
+	// the first reconciles requeue faster
+	assert.Equal(t, 10*time.Second, result.RequeueAfter)
+
+	c.successfulCount = 20
+	result, err = c.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, result.RequeueAfter)
+}
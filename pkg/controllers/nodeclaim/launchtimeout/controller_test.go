@@ -0,0 +1,111 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtimeout
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
+)
+
+type fakeKubeClient struct {
+	client.Client
+	deleted []string
+}
+
+func (f *fakeKubeClient) Delete(_ context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	f.deleted = append(f.deleted, obj.GetName())
+	return nil
+}
+
+type fakeInstanceProvider struct {
+	instance.Provider
+	instances map[string]*instance.Instance
+	deleted   []string
+}
+
+func (f *fakeInstanceProvider) Get(_ context.Context, id string) (*instance.Instance, error) {
+	if inst, ok := f.instances[id]; ok {
+		return inst, nil
+	}
+	return nil, cloudprovider.NewNodeClaimNotFoundError(fmt.Errorf("instance %s not found", id))
+}
+
+func (f *fakeInstanceProvider) Delete(_ context.Context, id string) error {
+	f.deleted = append(f.deleted, id)
+	delete(f.instances, id)
+	return nil
+}
+
+func testNodeClaim(name string) *karpv1.NodeClaim {
+	return &karpv1.NodeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     karpv1.NodeClaimStatus{ProviderID: "cn-hangzhou.i-" + name},
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{LaunchTimeout: 10 * time.Minute})
+	instanceProvider := &fakeInstanceProvider{instances: map[string]*instance.Instance{
+		"i-stuck":     {ID: "i-stuck", Status: instance.InstanceStatusPending, CreationTime: time.Now().Add(-time.Hour)},
+		"i-launching": {ID: "i-launching", Status: instance.InstanceStatusStarting, CreationTime: time.Now()},
+		"i-running":   {ID: "i-running", Status: instance.InstanceStatusRunning, CreationTime: time.Now().Add(-time.Hour)},
+	}}
+	kubeClient := &fakeKubeClient{}
+	c := NewController(kubeClient, instanceProvider)
+
+	// the instances still launching are checked again later
+	result, err := c.Reconcile(ctx, testNodeClaim("launching"))
+	require.NoError(t, err)
+	assert.Equal(t, pollInterval, result.RequeueAfter)
+
+	for _, name := range []string{"running", "released"} {
+		result, err = c.Reconcile(ctx, testNodeClaim(name))
+		require.NoError(t, err)
+		assert.Zero(t, result.RequeueAfter)
+	}
+	assert.Empty(t, instanceProvider.deleted)
+	assert.Empty(t, kubeClient.deleted)
+
+	// the registered NodeClaims are left alone, whatever their instance looks like
+	registered := testNodeClaim("stuck")
+	registered.StatusConditions().SetTrue(karpv1.ConditionTypeRegistered)
+	_, err = c.Reconcile(ctx, registered)
+	require.NoError(t, err)
+	assert.Empty(t, instanceProvider.deleted)
+
+	// and so are they all when the launch timeout is disabled
+	_, err = c.Reconcile(options.ToContext(ctx, &options.Options{}), testNodeClaim("stuck"))
+	require.NoError(t, err)
+	assert.Empty(t, instanceProvider.deleted)
+
+	_, err = c.Reconcile(ctx, testNodeClaim("stuck"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"i-stuck"}, instanceProvider.deleted)
+	assert.Equal(t, []string{"stuck"}, kubeClient.deleted)
+}
@@ -59,7 +59,7 @@ func (c *Controller) Reconcile(ctx context.Context, nodeClaim *karpv1.NodeClaim)
 		return reconcile.Result{}, nil
 	}
 	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithValues("provider-id", nodeClaim.Status.ProviderID))
-	id, err := utils.ParseInstanceID(nodeClaim.Status.ProviderID)
+	_, id, err := utils.ParseProviderID(nodeClaim.Status.ProviderID)
 	if err != nil {
 		// We don't throw an error here since we don't want to retry until the ProviderID has been updated.
 		log.FromContext(ctx).Error(err, "failed parsing instance id")
@@ -0,0 +1,161 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tagsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/awslabs/operatorpkg/reasonable"
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/types"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
+)
+
+// Controller syncs the tags of the ECSNodeClass onto the running instances of its NodeClaims. The instances are
+// only tagged with the ECSNodeClass tags at launch, so without it the tags changed later don't reach them.
+type Controller struct {
+	kubeClient       client.Client
+	instanceProvider instance.Provider
+}
+
+func NewController(kubeClient client.Client, instanceProvider instance.Provider) *Controller {
+	return &Controller{
+		kubeClient:       kubeClient,
+		instanceProvider: instanceProvider,
+	}
+}
+
+func (c *Controller) Reconcile(ctx context.Context, nodeClaim *karpv1.NodeClaim) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "nodeclaim.tagsync")
+
+	if nodeClaim.Status.ProviderID == "" || !nodeClaim.DeletionTimestamp.IsZero() || nodeClaim.Spec.NodeClassRef == nil {
+		return reconcile.Result{}, nil
+	}
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithValues("provider-id", nodeClaim.Status.ProviderID))
+	_, id, err := utils.ParseProviderID(nodeClaim.Status.ProviderID)
+	if err != nil {
+		// The provider ID won't change, retrying doesn't help
+		log.FromContext(ctx).Error(err, "failed parsing instance id")
+		return reconcile.Result{}, nil
+	}
+	nodeClass := &v1alpha1.ECSNodeClass{}
+	if err := c.kubeClient.Get(ctx, types.NamespacedName{Name: nodeClaim.Spec.NodeClassRef.Name}, nodeClass); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	desired, err := instance.UserTags(ctx, nodeClass, nodeClaim)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("rendering tags, %w", err)
+	}
+	ecsInstance, err := c.instanceProvider.Get(ctx, id)
+	if err != nil {
+		return reconcile.Result{}, cloudprovider.IgnoreNodeClaimNotFoundError(fmt.Errorf("getting instance, %w", err))
+	}
+
+	added := lo.PickBy(desired, func(key, value string) bool {
+		current, ok := ecsInstance.Tags[key]
+		return !ok || current != value
+	})
+	removed := lo.Filter(syncedTags(nodeClaim), func(key string, _ int) bool {
+		_, tagged := ecsInstance.Tags[key]
+		_, ok := desired[key]
+		return tagged && !ok && !isReservedTag(key)
+	})
+	if len(added) > 0 {
+		if err := c.instanceProvider.CreateTags(ctx, id, added); err != nil {
+			return reconcile.Result{}, cloudprovider.IgnoreNodeClaimNotFoundError(err)
+		}
+		log.FromContext(ctx).WithValues("tags", lo.Keys(added)).V(1).Info("added the nodeclass tags to the instance")
+	}
+	if len(removed) > 0 {
+		if err := c.instanceProvider.DeleteTags(ctx, id, removed); err != nil {
+			return reconcile.Result{}, cloudprovider.IgnoreNodeClaimNotFoundError(err)
+		}
+		log.FromContext(ctx).WithValues("tags", removed).V(1).Info("removed the nodeclass tags from the instance")
+	}
+
+	keys := lo.Keys(desired)
+	sort.Strings(keys)
+	synced := string(lo.Must(json.Marshal(keys)))
+	if nodeClaim.Annotations[v1alpha1.AnnotationNodeClassTags] != synced {
+		stored := nodeClaim.DeepCopy()
+		nodeClaim.Annotations = lo.Assign(nodeClaim.Annotations, map[string]string{v1alpha1.AnnotationNodeClassTags: synced})
+		if err := c.kubeClient.Patch(ctx, nodeClaim, client.MergeFrom(stored)); err != nil {
+			return reconcile.Result{}, client.IgnoreNotFound(err)
+		}
+	}
+	return reconcile.Result{}, nil
+}
+
+func (c *Controller) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("nodeclaim.tagsync").
+		For(&karpv1.NodeClaim{}).
+		Watches(
+			&v1alpha1.ECSNodeClass{},
+			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+				nodeClaimList := &karpv1.NodeClaimList{}
+				if err := m.GetClient().List(ctx, nodeClaimList, client.MatchingFields{"spec.nodeClassRef.name": o.GetName()}); err != nil {
+					return nil
+				}
+				return lo.Map(nodeClaimList.Items, func(nc karpv1.NodeClaim, _ int) reconcile.Request {
+					return reconcile.Request{NamespacedName: types.NamespacedName{Name: nc.Name}}
+				})
+			}),
+		).
+		// Ok with using the default MaxConcurrentReconciles of 1 to avoid throttling from the tagging write APIs
+		WithOptions(controller.Options{
+			RateLimiter: reasonable.RateLimiter(),
+		}).
+		Complete(reconcile.AsReconciler(m.GetClient(), c))
+}
+
+// syncedTags returns the keys of the ECSNodeClass tags last synced onto the instance. Without the annotation, no
+// tag was removed since the launch.
+func syncedTags(nodeClaim *karpv1.NodeClaim) []string {
+	var keys []string
+	if err := json.Unmarshal([]byte(nodeClaim.Annotations[v1alpha1.AnnotationNodeClassTags]), &keys); err != nil {
+		return nil
+	}
+	return keys
+}
+
+// isReservedTag returns whether the tag is one of karpenter, which must not be removed from the instance
+func isReservedTag(key string) bool {
+	return key == v1alpha1.TagName || strings.HasPrefix(key, apis.Group+"/") ||
+		lo.ContainsBy(v1alpha1.RestrictedTagPatterns, func(pattern *regexp.Regexp) bool {
+			return pattern.MatchString(key)
+		})
+}
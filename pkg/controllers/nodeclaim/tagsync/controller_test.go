@@ -0,0 +1,117 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tagsync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
+)
+
+type fakeKubeClient struct {
+	client.Client
+	nodeClass *v1alpha1.ECSNodeClass
+}
+
+func (f *fakeKubeClient) Get(_ context.Context, _ client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	f.nodeClass.DeepCopyInto(obj.(*v1alpha1.ECSNodeClass))
+	return nil
+}
+
+func (f *fakeKubeClient) Patch(context.Context, client.Object, client.Patch, ...client.PatchOption) error {
+	return nil
+}
+
+type fakeInstanceProvider struct {
+	instance.Provider
+	instance *instance.Instance
+}
+
+func (f *fakeInstanceProvider) Get(context.Context, string) (*instance.Instance, error) {
+	return f.instance, nil
+}
+
+func (f *fakeInstanceProvider) CreateTags(_ context.Context, _ string, tags map[string]string) error {
+	f.instance.Tags = lo.Assign(f.instance.Tags, tags)
+	return nil
+}
+
+func (f *fakeInstanceProvider) DeleteTags(_ context.Context, _ string, keys []string) error {
+	f.instance.Tags = lo.OmitByKeys(f.instance.Tags, keys)
+	return nil
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	nodeClass := &v1alpha1.ECSNodeClass{ObjectMeta: metav1.ObjectMeta{Name: "default"}, Spec: v1alpha1.ECSNodeClassSpec{
+		Tags: map[string]string{"team": "a"},
+	}}
+	instanceProvider := &fakeInstanceProvider{instance: &instance.Instance{ID: "i-1", Tags: map[string]string{
+		"team":                  "a",
+		"owner":                 "ops",
+		v1alpha1.TagNodeClaim:   "default-abcde",
+		v1alpha1.LabelNodeClass: "default",
+	}}}
+	c := NewController(&fakeKubeClient{nodeClass: nodeClass}, instanceProvider)
+	nodeClaim := &karpv1.NodeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "default-abcde", Labels: map[string]string{karpv1.NodePoolLabelKey: "default"}},
+		Spec:       karpv1.NodeClaimSpec{NodeClassRef: &karpv1.NodeClassReference{Name: "default"}},
+		Status:     karpv1.NodeClaimStatus{ProviderID: "cn-hangzhou.i-1"},
+	}
+
+	_, err := c.Reconcile(ctx, nodeClaim)
+	require.NoError(t, err)
+	assert.Equal(t, `["team"]`, nodeClaim.Annotations[v1alpha1.AnnotationNodeClassTags])
+
+	// a tag added to the node class is added to the instance, rendered for its NodeClaim
+	nodeClass.Spec.Tags = map[string]string{"team": "b", "nodepool": "{{ .NodePool }}"}
+	_, err = c.Reconcile(ctx, nodeClaim)
+	require.NoError(t, err)
+	assert.Equal(t, "b", instanceProvider.instance.Tags["team"])
+	assert.Equal(t, "default", instanceProvider.instance.Tags["nodepool"])
+	assert.Equal(t, `["nodepool","team"]`, nodeClaim.Annotations[v1alpha1.AnnotationNodeClassTags])
+
+	// a tag removed from the node class is removed, the tags added out-of-band and the ones of karpenter are kept
+	nodeClass.Spec.Tags = map[string]string{"nodepool": "{{ .NodePool }}"}
+	_, err = c.Reconcile(ctx, nodeClaim)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"nodepool":              "default",
+		"owner":                 "ops",
+		v1alpha1.TagNodeClaim:   "default-abcde",
+		v1alpha1.LabelNodeClass: "default",
+	}, instanceProvider.instance.Tags)
+	assert.Equal(t, `["nodepool"]`, nodeClaim.Annotations[v1alpha1.AnnotationNodeClassTags])
+}
+
+func TestIsReservedTag(t *testing.T) {
+	for _, key := range []string{v1alpha1.TagName, v1alpha1.TagNodeClaim, v1alpha1.TagUserDataHash, v1alpha1.ECSClusterIDTagKey,
+		karpv1.NodePoolLabelKey, "kubernetes.io/cluster/c-1"} {
+		assert.True(t, isReservedTag(key), key)
+	}
+	assert.False(t, isReservedTag("team"))
+}
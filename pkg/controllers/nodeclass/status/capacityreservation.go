@@ -0,0 +1,44 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package status
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/capacityreservation"
+)
+
+type CapacityReservation struct {
+	capacityReservationProvider capacityreservation.Provider
+}
+
+func (c *CapacityReservation) Reconcile(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass) (reconcile.Result, error) {
+	// Capacity reservations are optional, launches fall back to the public pool when none are selected or matched
+	if len(nodeClass.Spec.CapacityReservationSelectorTerms) == 0 {
+		nodeClass.Status.CapacityReservations = nil
+		return reconcile.Result{}, nil
+	}
+	capacityReservations, err := c.capacityReservationProvider.List(ctx, nodeClass)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("getting capacity reservations, %w", err)
+	}
+	nodeClass.Status.CapacityReservations = capacityReservations
+	// The available instance counts change as instances are launched into the capacity reservations
+	return reconcile.Result{RequeueAfter: time.Minute}, nil
+}
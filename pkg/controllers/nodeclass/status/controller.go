@@ -21,17 +21,24 @@ import (
 	"go.uber.org/multierr"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	controllerruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	"sigs.k8s.io/karpenter/pkg/operator/injection"
 	"sigs.k8s.io/karpenter/pkg/utils/result"
 
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/capacityreservation"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/imagefamily"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/keypair"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/quota"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/securitygroup"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/vswitch"
 )
@@ -46,16 +53,30 @@ type Controller struct {
 	vSwitch       *VSwitch
 	securityGroup *SecurityGroup
 	image         *Image
+	vpc           *VPC
+
+	capacityReservation *CapacityReservation
+	keyPair             *KeyPair
+	quota               *Quota
+	terway              *Terway
 }
 
 func NewController(kubeClient client.Client, vSwitchProvider vswitch.Provider,
-	securityGroupProvider securitygroup.Provider, imageProvider imagefamily.Provider) *Controller {
+	securityGroupProvider securitygroup.Provider, imageProvider imagefamily.Provider,
+	capacityReservationProvider capacityreservation.Provider, keyPairProvider keypair.Provider,
+	quotaProvider quota.Provider) *Controller {
 	return &Controller{
 		kubeClient: kubeClient,
 
-		vSwitch:       &VSwitch{vSwitchProvider: vSwitchProvider},
+		vSwitch:       &VSwitch{kubeClient: kubeClient, vSwitchProvider: vSwitchProvider},
 		securityGroup: &SecurityGroup{securityGroupProvider: securityGroupProvider},
 		image:         &Image{imageProvider: imageProvider},
+		vpc:           &VPC{vSwitchProvider: vSwitchProvider, securityGroupProvider: securityGroupProvider},
+
+		capacityReservation: &CapacityReservation{capacityReservationProvider: capacityReservationProvider},
+		keyPair:             &KeyPair{keyPairProvider: keyPairProvider},
+		quota:               &Quota{quotaProvider: quotaProvider},
+		terway:              &Terway{kubeClient: kubeClient},
 	}
 }
 
@@ -80,14 +101,26 @@ func (c *Controller) Reconcile(ctx context.Context, nodeClass *v1alpha1.ECSNodeC
 
 	var results []reconcile.Result
 	var errs error
-	for _, reconciler := range []nodeClassStatusReconciler{
-		c.vSwitch,
-		c.securityGroup,
-		c.image,
-	} {
-		res, err := reconciler.Reconcile(ctx, nodeClass)
-		errs = multierr.Append(errs, err)
-		results = append(results, res)
+	// Malformed selector terms can't be resolved, the spec has to be fixed first
+	if err := multierr.Combine(nodeClass.RuntimeValidate(), nodeClass.ValidateRegion(options.FromContext(ctx).RegionID)); err != nil {
+		nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeValidationSucceeded, "ValidationFailed", err.Error())
+	} else {
+		nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeValidationSucceeded)
+		for _, reconciler := range []nodeClassStatusReconciler{
+			c.vSwitch,
+			c.securityGroup,
+			c.image,
+			// The VPCs are checked once the vSwitches and the security groups are resolved
+			c.vpc,
+			c.capacityReservation,
+			c.keyPair,
+			c.quota,
+			c.terway,
+		} {
+			res, err := reconciler.Reconcile(ctx, nodeClass)
+			errs = multierr.Append(errs, err)
+			results = append(results, res)
+		}
 	}
 
 	if !equality.Semantic.DeepEqual(stored, nodeClass) {
@@ -112,6 +145,17 @@ func (c *Controller) Register(_ context.Context, m manager.Manager) error {
 	return controllerruntime.NewControllerManagedBy(m).
 		Named("nodeclass.status").
 		For(&v1alpha1.ECSNodeClass{}).
+		// The vSwitches may be resolved in the zones of the NodePools
+		Watches(
+			&karpv1.NodePool{},
+			handler.EnqueueRequestsFromMapFunc(func(_ context.Context, o client.Object) []reconcile.Request {
+				np := o.(*karpv1.NodePool)
+				if np.Spec.Template.Spec.NodeClassRef == nil {
+					return nil
+				}
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: np.Spec.Template.Spec.NodeClassRef.Name}}}
+			}),
+		).
 		WithOptions(controller.Options{
 			RateLimiter:             reasonable.RateLimiter(),
 			MaxConcurrentReconciles: 10,
@@ -16,6 +16,7 @@ package status
 
 import (
 	"context"
+	"fmt"
 	"sort"
 	"time"
 
@@ -43,7 +44,8 @@ func (i *Image) Reconcile(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass)
 	if len(images) == 0 {
 		nodeClass.Status.Images = nil
 		nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeImagesReady, "ImagesNotFound", "ImageSelector did not match any Images")
-		return reconcile.Result{}, nil
+		// Images may be published or shared later, keep checking like the vSwitches and security groups.
+		return reconcile.Result{RequeueAfter: time.Second * 15}, nil
 	}
 
 	nodeClass.Status.Images = lo.Map(images, func(image imagefamily.Image, _ int) v1alpha1.Image {
@@ -60,9 +62,17 @@ func (i *Image) Reconcile(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass)
 		return v1alpha1.Image{
 			Name:         image.Name,
 			ID:           image.ImageID,
+			Size:         image.Size,
 			Requirements: reqs,
 		}
 	})
+	if size := nodeClass.Spec.SystemDisk.GetGiBSize(); size != 0 {
+		if image, ok := lo.Find(nodeClass.Status.Images, func(image v1alpha1.Image) bool { return image.Size > size }); ok {
+			nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeImagesReady, "SystemDiskTooSmall",
+				fmt.Sprintf("SystemDisk size %dGiB is smaller than the size %dGiB of image %s", size, image.Size, image.ID))
+			return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+		}
+	}
 	nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeImagesReady)
 	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
 }
@@ -0,0 +1,51 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/keypair"
+)
+
+type KeyPair struct {
+	keyPairProvider keypair.Provider
+}
+
+func (k *KeyPair) Reconcile(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass) (reconcile.Result, error) {
+	if nodeClass.Spec.KeyPairName == "" {
+		_ = nodeClass.StatusConditions().Clear(v1alpha1.ConditionTypeKeyPairFound)
+		return reconcile.Result{}, nil
+	}
+	exists, err := k.keyPairProvider.Exists(ctx, nodeClass.Spec.KeyPairName)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("getting key pair, %w", err)
+	}
+	// A missing key pair doesn't block the ECSNodeClass, it may be imported after the ECSNodeClass is created
+	if !exists {
+		nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeKeyPairFound, "KeyPairNotFound",
+			fmt.Sprintf("Key pair %s does not exist in the region, the instances fail to launch with it", nodeClass.Spec.KeyPairName))
+		return reconcile.Result{RequeueAfter: time.Minute}, nil
+	}
+	nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeKeyPairFound)
+	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+}
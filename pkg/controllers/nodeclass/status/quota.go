@@ -0,0 +1,58 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/quota"
+)
+
+type Quota struct {
+	quotaProvider quota.Provider
+}
+
+func (q *Quota) Reconcile(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass) (reconcile.Result, error) {
+	threshold := options.FromContext(ctx).QuotaWarningThreshold
+	if threshold == 0 {
+		_ = nodeClass.StatusConditions().Clear(v1alpha1.ConditionTypeQuotaAvailable)
+		return reconcile.Result{}, nil
+	}
+	accountQuota, err := q.quotaProvider.Get(ctx)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("getting vCPU quota, %w", err)
+	}
+	// A quota near its limit doesn't block the ECSNodeClass, the launches fit in the headroom left may still succeed
+	if capacityTypes := accountQuota.NearLimit(threshold); len(capacityTypes) > 0 {
+		nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeQuotaAvailable, "QuotaNearLimit",
+			fmt.Sprintf("The vCPU quota of the region is near its limit, %s", strings.Join(lo.Map(capacityTypes, func(capacityType string, _ int) string {
+				limit, usage := accountQuota.VCPULimits[capacityType], accountQuota.VCPUUsage[capacityType]
+				return fmt.Sprintf("%s %d%% used (%d of %d vCPUs)", capacityType, usage*100/max(limit, 1), usage, limit)
+			}), ", ")))
+		return reconcile.Result{RequeueAfter: time.Minute}, nil
+	}
+	nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeQuotaAvailable)
+	return reconcile.Result{RequeueAfter: time.Minute}, nil
+}
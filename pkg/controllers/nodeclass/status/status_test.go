@@ -0,0 +1,540 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"testing"
+
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	vpc "github.com/alibabacloud-go/vpc-20160428/v6/client"
+	"github.com/awslabs/operatorpkg/status"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/imagefamily"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/keypair"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/quota"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/securitygroup"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/vswitch"
+)
+
+type fakeVSwitchProvider struct {
+	vswitch.Provider
+	vSwitches []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch
+}
+
+func (f *fakeVSwitchProvider) List(context.Context, *v1alpha1.ECSNodeClass) ([]*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, error) {
+	return f.vSwitches, nil
+}
+
+type fakeSecurityGroupProvider struct {
+	securitygroup.Provider
+	securityGroups []*ecsclient.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup
+}
+
+func (f *fakeSecurityGroupProvider) List(context.Context, *v1alpha1.ECSNodeClass) ([]*ecsclient.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup, error) {
+	return f.securityGroups, nil
+}
+
+type fakeImageProvider struct {
+	imagefamily.Provider
+	images imagefamily.Images
+}
+
+func (f *fakeImageProvider) List(context.Context, *v1alpha1.ECSNodeClass) (imagefamily.Images, error) {
+	return f.images, nil
+}
+
+type fakeKeyPairProvider struct {
+	keypair.Provider
+	keyPairs []string
+}
+
+func (f *fakeKeyPairProvider) Exists(_ context.Context, keyPairName string) (bool, error) {
+	return lo.Contains(f.keyPairs, keyPairName), nil
+}
+
+type fakeQuotaProvider struct {
+	quota.Provider
+	quota *quota.Quota
+}
+
+func (f *fakeQuotaProvider) Get(context.Context) (*quota.Quota, error) {
+	return f.quota, nil
+}
+
+func testNodeClass() *v1alpha1.ECSNodeClass {
+	return &v1alpha1.ECSNodeClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Generation: 1},
+		Spec: v1alpha1.ECSNodeClassSpec{
+			VSwitchSelectorTerms:       []v1alpha1.VSwitchSelectorTerm{{Tags: map[string]string{"karpenter.sh/discovery": "c-1"}}},
+			SecurityGroupSelectorTerms: []v1alpha1.SecurityGroupSelectorTerm{{Tags: map[string]string{"karpenter.sh/discovery": "c-1"}}},
+			ImageSelectorTerms:         []v1alpha1.ImageSelectorTerm{{Alias: "AlibabaCloudLinux3"}},
+		},
+	}
+}
+
+func TestReconcileSelectorsMatchNothing(t *testing.T) {
+	vSwitches := []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{
+		{VSwitchId: tea.String("vsw-1"), ZoneId: tea.String("cn-hangzhou-i"), AvailableIpAddressCount: tea.Int64(100)},
+	}
+	securityGroups := []*ecsclient.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{
+		{SecurityGroupId: tea.String("sg-1"), SecurityGroupName: tea.String("default")},
+	}
+	images := imagefamily.Images{{Name: "aliyun_3_x64", ImageID: "aliyun_3_x64_20G_alibase_20250101.vhd", Requirements: scheduling.NewRequirements()}}
+
+	tests := []struct {
+		name       string
+		reconciler nodeClassStatusReconciler
+		condition  string
+		reason     string
+	}{
+		{
+			name:       "vSwitches",
+			reconciler: &VSwitch{vSwitchProvider: &fakeVSwitchProvider{}},
+			condition:  v1alpha1.ConditionTypeVSwitchesReady,
+			reason:     "VSwitchesNotFound",
+		},
+		{
+			name:       "security groups",
+			reconciler: &SecurityGroup{securityGroupProvider: &fakeSecurityGroupProvider{}},
+			condition:  v1alpha1.ConditionTypeSecurityGroupsReady,
+			reason:     "SecurityGroupsNotFound",
+		},
+		{
+			name:       "images",
+			reconciler: &Image{imageProvider: &fakeImageProvider{}},
+			condition:  v1alpha1.ConditionTypeImagesReady,
+			reason:     "ImagesNotFound",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeClass := testNodeClass()
+			for _, reconciler := range []nodeClassStatusReconciler{
+				&VSwitch{vSwitchProvider: &fakeVSwitchProvider{vSwitches: vSwitches}},
+				&SecurityGroup{securityGroupProvider: &fakeSecurityGroupProvider{securityGroups: securityGroups}},
+				&Image{imageProvider: &fakeImageProvider{images: images}},
+			} {
+				_, err := reconciler.Reconcile(context.Background(), nodeClass)
+				require.NoError(t, err)
+			}
+			nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeValidationSucceeded)
+			assert.True(t, nodeClass.StatusConditions().Root().IsTrue())
+
+			res, err := tt.reconciler.Reconcile(context.Background(), nodeClass)
+			require.NoError(t, err)
+			// the selectors are checked again, the resources may be tagged or created later
+			assert.NotEqual(t, reconcile.Result{}, res)
+
+			condition := nodeClass.StatusConditions().Get(tt.condition)
+			require.NotNil(t, condition)
+			assert.Equal(t, metav1.ConditionFalse, condition.Status)
+			assert.Equal(t, tt.reason, condition.Reason)
+			assert.NotEmpty(t, condition.Message)
+			assert.True(t, nodeClass.StatusConditions().Root().IsFalse())
+			assert.Equal(t, status.ConditionReady, nodeClass.StatusConditions().Root().Type)
+		})
+	}
+}
+
+func TestReconcileResolvedSelectors(t *testing.T) {
+	nodeClass := testNodeClass()
+	_, err := (&VSwitch{vSwitchProvider: &fakeVSwitchProvider{vSwitches: []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{
+		{VSwitchId: tea.String("vsw-2"), ZoneId: tea.String("cn-hangzhou-j"), AvailableIpAddressCount: tea.Int64(10)},
+		{VSwitchId: tea.String("vsw-1"), ZoneId: tea.String("cn-hangzhou-i"), AvailableIpAddressCount: tea.Int64(100)},
+	}}}).Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	// vSwitches with more available IP addresses come first
+	assert.Equal(t, []v1alpha1.VSwitch{{ID: "vsw-1", ZoneID: "cn-hangzhou-i"}, {ID: "vsw-2", ZoneID: "cn-hangzhou-j"}}, nodeClass.Status.VSwitches)
+
+	_, err = (&SecurityGroup{securityGroupProvider: &fakeSecurityGroupProvider{securityGroups: []*ecsclient.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{
+		{SecurityGroupId: tea.String("sg-2"), SecurityGroupName: tea.String("b")},
+		{SecurityGroupId: tea.String("sg-1"), SecurityGroupName: tea.String("a")},
+	}}}).Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	assert.Equal(t, []v1alpha1.SecurityGroup{{ID: "sg-1", Name: "a"}, {ID: "sg-2", Name: "b"}}, nodeClass.Status.SecurityGroups)
+
+	assert.True(t, nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeVSwitchesReady).IsTrue())
+	assert.True(t, nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeSecurityGroupsReady).IsTrue())
+}
+
+func TestReconcileVSwitchVPCID(t *testing.T) {
+	tests := []struct {
+		name      string
+		vpcID     string
+		vSwitches []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch
+		expected  string
+	}{
+		{
+			name: "inferred from the vSwitches",
+			vSwitches: []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{
+				{VSwitchId: tea.String("vsw-1"), VpcId: tea.String("vpc-1"), ZoneId: tea.String("cn-hangzhou-i"), AvailableIpAddressCount: tea.Int64(100)},
+				{VSwitchId: tea.String("vsw-2"), VpcId: tea.String("vpc-1"), ZoneId: tea.String("cn-hangzhou-j"), AvailableIpAddressCount: tea.Int64(100)},
+			},
+			expected: "vpc-1",
+		},
+		{
+			name: "vSwitches in several VPCs",
+			vSwitches: []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{
+				{VSwitchId: tea.String("vsw-1"), VpcId: tea.String("vpc-1"), ZoneId: tea.String("cn-hangzhou-i"), AvailableIpAddressCount: tea.Int64(100)},
+				{VSwitchId: tea.String("vsw-2"), VpcId: tea.String("vpc-2"), ZoneId: tea.String("cn-hangzhou-j"), AvailableIpAddressCount: tea.Int64(100)},
+			},
+		},
+		{
+			name:  "from the spec",
+			vpcID: "vpc-2",
+			vSwitches: []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{
+				{VSwitchId: tea.String("vsw-1"), VpcId: tea.String("vpc-1"), ZoneId: tea.String("cn-hangzhou-i"), AvailableIpAddressCount: tea.Int64(100)},
+			},
+			expected: "vpc-2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeClass := testNodeClass()
+			nodeClass.Spec.VPCID = tt.vpcID
+			_, err := (&VSwitch{vSwitchProvider: &fakeVSwitchProvider{vSwitches: tt.vSwitches}}).Reconcile(context.Background(), nodeClass)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, nodeClass.Status.VPCID)
+			assert.Equal(t, tt.expected, nodeClass.ResolvedVPCID())
+		})
+	}
+}
+
+func TestReconcileVSwitchZoneExclusions(t *testing.T) {
+	vSwitches := []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{
+		{VSwitchId: tea.String("vsw-1"), VpcId: tea.String("vpc-1"), ZoneId: tea.String("cn-hangzhou-i"), AvailableIpAddressCount: tea.Int64(100)},
+		{VSwitchId: tea.String("vsw-2"), VpcId: tea.String("vpc-1"), ZoneId: tea.String("cn-hangzhou-j"), AvailableIpAddressCount: tea.Int64(200)},
+	}
+	reconciler := &VSwitch{vSwitchProvider: &fakeVSwitchProvider{vSwitches: vSwitches}}
+
+	// the vSwitches of the excluded zone are left out
+	nodeClass := testNodeClass()
+	nodeClass.Spec.ZoneExclusions = []string{"cn-hangzhou-j"}
+	_, err := reconciler.Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	assert.Equal(t, []v1alpha1.VSwitch{{ID: "vsw-1", ZoneID: "cn-hangzhou-i"}}, nodeClass.Status.VSwitches)
+	assert.True(t, nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeVSwitchesReady).IsTrue())
+
+	// no vSwitch is left outside the excluded zones
+	nodeClass.Spec.ZoneExclusions = []string{"cn-hangzhou-i", "cn-hangzhou-j"}
+	_, err = reconciler.Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	assert.Empty(t, nodeClass.Status.VSwitches)
+	condition := nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeVSwitchesReady)
+	assert.True(t, condition.IsFalse())
+	assert.Equal(t, "VSwitchSelector did not match any VSwitches outside the excluded zones", condition.Message)
+}
+
+func TestReconcileSystemDiskTooSmall(t *testing.T) {
+	nodeClass := testNodeClass()
+	nodeClass.Spec.SystemDisk = &v1alpha1.SystemDisk{Size: tea.Int32(30)}
+	reconciler := &Image{imageProvider: &fakeImageProvider{images: imagefamily.Images{
+		{Name: "custom", ImageID: "m-1", Size: 40, Requirements: scheduling.NewRequirements()},
+	}}}
+
+	_, err := reconciler.Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	condition := nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeImagesReady)
+	assert.True(t, condition.IsFalse())
+	assert.Equal(t, "SystemDiskTooSmall", condition.Reason)
+
+	nodeClass.Spec.SystemDisk.Size = tea.Int32(40)
+	_, err = reconciler.Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	assert.True(t, nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeImagesReady).IsTrue())
+	assert.Equal(t, int32(40), nodeClass.Status.Images[0].Size)
+}
+
+func TestNodePoolZoneVSwitches(t *testing.T) {
+	vSwitches := []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{
+		{VSwitchId: tea.String("vsw-1"), ZoneId: tea.String("cn-hangzhou-i"), AvailableIpAddressCount: tea.Int64(100)},
+		{VSwitchId: tea.String("vsw-2"), ZoneId: tea.String("cn-hangzhou-j"), AvailableIpAddressCount: tea.Int64(0)},
+		{VSwitchId: tea.String("vsw-3"), ZoneId: tea.String("cn-hangzhou-j"), AvailableIpAddressCount: tea.Int64(10)},
+		{VSwitchId: tea.String("vsw-4"), ZoneId: tea.String("cn-hangzhou-k"), AvailableIpAddressCount: tea.Int64(0)},
+	}
+	nodePool := func(zones ...string) karpv1.NodePool {
+		nodePool := karpv1.NodePool{}
+		if len(zones) != 0 {
+			nodePool.Spec.Template.Spec.Requirements = []karpv1.NodeSelectorRequirementWithMinValues{{NodeSelectorRequirement: corev1.NodeSelectorRequirement{
+				Key: corev1.LabelTopologyZone, Operator: corev1.NodeSelectorOpIn, Values: zones,
+			}}}
+		}
+		return nodePool
+	}
+	ids := func(vSwitches []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch) []string {
+		return lo.Map(vSwitches, func(v *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, _ int) string {
+			return tea.StringValue(v.VSwitchId)
+		})
+	}
+
+	tests := []struct {
+		name      string
+		nodePools []karpv1.NodePool
+		excluded  []string
+		want      []string
+		covered   bool
+		message   string
+	}{
+		{
+			name: "no nodepools",
+			want: []string{"vsw-1", "vsw-3"}, covered: true,
+		},
+		{
+			name:      "nodepool allowing every zone",
+			nodePools: []karpv1.NodePool{nodePool(), nodePool("cn-hangzhou-i")},
+			want:      []string{"vsw-1", "vsw-3"}, covered: true,
+		},
+		{
+			name:      "intersection with the zones of the nodepools",
+			nodePools: []karpv1.NodePool{nodePool("cn-hangzhou-j")},
+			want:      []string{"vsw-3"}, covered: true,
+		},
+		{
+			name:      "zones without a usable vSwitch",
+			nodePools: []karpv1.NodePool{nodePool("cn-hangzhou-i"), nodePool("cn-hangzhou-k", "cn-hangzhou-h")},
+			want:      []string{"vsw-1"},
+			message:   "No vSwitch with available IP addresses in the zones cn-hangzhou-h, cn-hangzhou-k allowed by the NodePools",
+		},
+		{
+			name:      "excluded zones aren't reported",
+			nodePools: []karpv1.NodePool{nodePool("cn-hangzhou-i"), nodePool("cn-hangzhou-k", "cn-hangzhou-h")},
+			excluded:  []string{"cn-hangzhou-k"},
+			want:      []string{"vsw-1"},
+			message:   "No vSwitch with available IP addresses in the zones cn-hangzhou-h allowed by the NodePools",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeClass := testNodeClass()
+			nodeClass.Spec.ZoneExclusions = tt.excluded
+			assert.Equal(t, tt.want, ids(nodePoolZoneVSwitches(nodeClass, vSwitches, tt.nodePools)))
+
+			condition := nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeNodePoolZonesCovered)
+			require.NotNil(t, condition)
+			assert.Equal(t, tt.covered, condition.IsTrue())
+			if !tt.covered {
+				assert.Equal(t, "ZonesWithoutVSwitches", condition.Reason)
+				assert.Equal(t, tt.message, condition.Message)
+			}
+		})
+	}
+
+	// the warning doesn't affect the readiness of the ECSNodeClass
+	nodeClass := testNodeClass()
+	for _, condition := range nodeClass.StatusConditions().List() {
+		nodeClass.StatusConditions().SetTrue(condition.Type)
+	}
+	nodePoolZoneVSwitches(nodeClass, vSwitches, []karpv1.NodePool{nodePool("cn-hangzhou-k")})
+	assert.True(t, nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeNodePoolZonesCovered).IsFalse())
+	assert.True(t, nodeClass.StatusConditions().Root().IsTrue())
+}
+
+func TestReconcileKeyPair(t *testing.T) {
+	nodeClass := testNodeClass()
+	nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeVSwitchesReady)
+	nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeSecurityGroupsReady)
+	nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeImagesReady)
+	nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeValidationSucceeded)
+	reconciler := &KeyPair{keyPairProvider: &fakeKeyPairProvider{keyPairs: []string{"ops"}}}
+
+	nodeClass.Spec.KeyPairName = "missing"
+	res, err := reconciler.Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	assert.NotEqual(t, reconcile.Result{}, res)
+	condition := nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeKeyPairFound)
+	require.NotNil(t, condition)
+	assert.True(t, condition.IsFalse())
+	assert.Equal(t, "KeyPairNotFound", condition.Reason)
+	// a missing key pair is a warning, it doesn't block the node class
+	assert.True(t, nodeClass.StatusConditions().Root().IsTrue())
+
+	nodeClass.Spec.KeyPairName = "ops"
+	_, err = reconciler.Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	assert.True(t, nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeKeyPairFound).IsTrue())
+
+	nodeClass.Spec.KeyPairName = ""
+	_, err = reconciler.Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	assert.Nil(t, nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeKeyPairFound))
+}
+
+func TestReconcileQuota(t *testing.T) {
+	nodeClass := testNodeClass()
+	for _, condition := range nodeClass.StatusConditions().List() {
+		nodeClass.StatusConditions().SetTrue(condition.Type)
+	}
+	quotaProvider := &fakeQuotaProvider{quota: &quota.Quota{
+		VCPULimits: map[string]int64{karpv1.CapacityTypeOnDemand: 1000, karpv1.CapacityTypeSpot: 500},
+		VCPUUsage:  map[string]int64{karpv1.CapacityTypeOnDemand: 950, karpv1.CapacityTypeSpot: 100},
+	}}
+	reconciler := &Quota{quotaProvider: quotaProvider}
+
+	// the on-demand quota is near its limit
+	ctx := options.ToContext(context.Background(), &options.Options{QuotaWarningThreshold: 0.9})
+	res, err := reconciler.Reconcile(ctx, nodeClass)
+	require.NoError(t, err)
+	assert.NotEqual(t, reconcile.Result{}, res)
+	condition := nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeQuotaAvailable)
+	require.NotNil(t, condition)
+	assert.True(t, condition.IsFalse())
+	assert.Equal(t, "QuotaNearLimit", condition.Reason)
+	assert.Equal(t, "The vCPU quota of the region is near its limit, on-demand 95% used (950 of 1000 vCPUs)", condition.Message)
+	// a quota near its limit is a warning, it doesn't block the node class
+	assert.True(t, nodeClass.StatusConditions().Root().IsTrue())
+
+	// both quotas are near their limits
+	quotaProvider.quota.VCPUUsage[karpv1.CapacityTypeSpot] = 500
+	_, err = reconciler.Reconcile(ctx, nodeClass)
+	require.NoError(t, err)
+	assert.Equal(t, "The vCPU quota of the region is near its limit, on-demand 95% used (950 of 1000 vCPUs), spot 100% used (500 of 500 vCPUs)", nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeQuotaAvailable).Message)
+
+	// the quotas are below a higher threshold
+	quotaProvider.quota.VCPUUsage[karpv1.CapacityTypeSpot] = 100
+	ctx = options.ToContext(context.Background(), &options.Options{QuotaWarningThreshold: 0.99})
+	_, err = reconciler.Reconcile(ctx, nodeClass)
+	require.NoError(t, err)
+	assert.True(t, nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeQuotaAvailable).IsTrue())
+
+	// the condition isn't reported without a threshold
+	ctx = options.ToContext(context.Background(), &options.Options{})
+	_, err = reconciler.Reconcile(ctx, nodeClass)
+	require.NoError(t, err)
+	assert.Nil(t, nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeQuotaAvailable))
+}
+
+func TestReconcileVPC(t *testing.T) {
+	vSwitches := []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{
+		{VSwitchId: tea.String("vsw-1"), VpcId: tea.String("vpc-1"), ZoneId: tea.String("cn-hangzhou-i"), AvailableIpAddressCount: tea.Int64(100)},
+		{VSwitchId: tea.String("vsw-2"), VpcId: tea.String("vpc-1"), ZoneId: tea.String("cn-hangzhou-j"), AvailableIpAddressCount: tea.Int64(100)},
+	}
+	tests := []struct {
+		name           string
+		vpcID          string
+		securityGroups []*ecsclient.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup
+		message        string
+	}{
+		{
+			name: "single VPC",
+			securityGroups: []*ecsclient.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{
+				{SecurityGroupId: tea.String("sg-1"), VpcId: tea.String("vpc-1")},
+			},
+		},
+		{
+			name: "security group in another VPC",
+			securityGroups: []*ecsclient.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{
+				{SecurityGroupId: tea.String("sg-1"), VpcId: tea.String("vpc-1")},
+				{SecurityGroupId: tea.String("sg-2"), VpcId: tea.String("vpc-2")},
+			},
+			message: "The vSwitches and security groups must be in a single VPC, found vpc-1 (vsw-1, vsw-2, sg-1); vpc-2 (sg-2)",
+		},
+		{
+			name:  "resources in the VPC of the spec",
+			vpcID: "vpc-1",
+			securityGroups: []*ecsclient.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{
+				{SecurityGroupId: tea.String("sg-1"), VpcId: tea.String("vpc-1")},
+			},
+		},
+		{
+			name:  "resources outside the VPC of the spec",
+			vpcID: "vpc-2",
+			securityGroups: []*ecsclient.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{
+				{SecurityGroupId: tea.String("sg-2"), VpcId: tea.String("vpc-2")},
+			},
+			message: "The vSwitches and security groups must be in the VPC vpc-2, found vpc-1 (vsw-1, vsw-2)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeClass := testNodeClass()
+			nodeClass.Spec.VPCID = tt.vpcID
+			for _, condition := range nodeClass.StatusConditions().List() {
+				nodeClass.StatusConditions().SetTrue(condition.Type)
+			}
+			reconciler := &VPC{
+				vSwitchProvider:       &fakeVSwitchProvider{vSwitches: vSwitches},
+				securityGroupProvider: &fakeSecurityGroupProvider{securityGroups: tt.securityGroups},
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), nodeClass)
+			require.NoError(t, err)
+			condition := nodeClass.StatusConditions().Get(v1alpha1.ConditionTypeValidationSucceeded)
+			if tt.message == "" {
+				assert.True(t, condition.IsTrue())
+				assert.True(t, nodeClass.StatusConditions().Root().IsTrue())
+				return
+			}
+			assert.True(t, condition.IsFalse())
+			assert.Equal(t, "VPCMismatch", condition.Reason)
+			assert.Equal(t, tt.message, condition.Message)
+			assert.True(t, nodeClass.StatusConditions().Root().IsFalse())
+		})
+	}
+}
+
+func TestReconcileTerway(t *testing.T) {
+	nodeClass := testNodeClass()
+	nodeClass.UID = "4f1c2d3e"
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	reconciler := &Terway{kubeClient: kubeClient}
+	key := types.NamespacedName{Namespace: "kube-system", Name: "karpenter-terway-default"}
+
+	// no ConfigMap is written without a Terway configuration
+	_, err := reconciler.Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	assert.True(t, apierrors.IsNotFound(kubeClient.Get(context.Background(), key, &corev1.ConfigMap{})))
+
+	nodeClass.Spec.Terway = &v1alpha1.TerwayConfiguration{ENITrunking: true, ENICount: tea.Int32(3)}
+	_, err = reconciler.Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	configMap := &corev1.ConfigMap{}
+	require.NoError(t, kubeClient.Get(context.Background(), key, configMap))
+	assert.Equal(t, map[string]string{"eni_conf": `{"enable_eni_trunking":true,"max_eni":3}`}, configMap.Data)
+	assert.Equal(t, "default", configMap.Labels[v1alpha1.LabelNodeClass])
+	require.Len(t, configMap.OwnerReferences, 1)
+	assert.Equal(t, "ECSNodeClass", configMap.OwnerReferences[0].Kind)
+	assert.Equal(t, nodeClass.UID, configMap.OwnerReferences[0].UID)
+
+	// a change of the configuration updates the ConfigMap
+	nodeClass.Spec.Terway = &v1alpha1.TerwayConfiguration{ENICount: tea.Int32(2)}
+	_, err = reconciler.Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	require.NoError(t, kubeClient.Get(context.Background(), key, configMap))
+	assert.Equal(t, map[string]string{"eni_conf": `{"max_eni":2}`}, configMap.Data)
+
+	// an empty configuration keeps the Terway configuration of the cluster
+	nodeClass.Spec.Terway = &v1alpha1.TerwayConfiguration{}
+	_, err = reconciler.Reconcile(context.Background(), nodeClass)
+	require.NoError(t, err)
+	assert.True(t, apierrors.IsNotFound(kubeClient.Get(context.Background(), key, &corev1.ConfigMap{})))
+}
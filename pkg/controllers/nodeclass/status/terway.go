@@ -0,0 +1,86 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+)
+
+const (
+	// terwayConfigNamespace is the namespace Terway reads the dynamic configuration of the nodes from
+	terwayConfigNamespace = "kube-system"
+	// terwayConfigKey is the key of the ConfigMap Terway merges into the eni_conf of eni-config
+	terwayConfigKey = "eni_conf"
+)
+
+// terwayConfig is the part of the eni_conf of Terway set by the ECSNodeClass
+type terwayConfig struct {
+	ENITrunking bool   `json:"enable_eni_trunking,omitempty"`
+	MaxENI      *int32 `json:"max_eni,omitempty"`
+}
+
+// Terway writes the Terway configuration of the ECSNodeClass to the ConfigMap of kube-system the nodes select with
+// the terway-config label, the Terway agent merges it into the eni-config of the cluster when the node starts
+type Terway struct {
+	kubeClient client.Client
+}
+
+func (t *Terway) Reconcile(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass) (reconcile.Result, error) {
+	name := nodeClass.TerwayConfigName()
+	if name == "" {
+		// The ConfigMap of a removed Terway configuration is dropped, the nodes launched with it keep their ENIs
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: terwayConfigNamespace, Name: v1alpha1.TerwayConfigNamePrefix + nodeClass.Name}}
+		if err := t.kubeClient.Delete(ctx, configMap); client.IgnoreNotFound(err) != nil {
+			return reconcile.Result{}, fmt.Errorf("deleting terway configmap, %w", err)
+		}
+		return reconcile.Result{}, nil
+	}
+	data, err := json.Marshal(terwayConfig{ENITrunking: nodeClass.Spec.Terway.ENITrunking, MaxENI: nodeClass.Spec.Terway.ENICount})
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("marshaling terway configuration, %w", err)
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: terwayConfigNamespace,
+			Name:      name,
+			Labels:    map[string]string{v1alpha1.LabelNodeClass: nodeClass.Name},
+		},
+		Data: map[string]string{terwayConfigKey: string(data)},
+	}
+	// The ConfigMap is garbage collected with the ECSNodeClass
+	if err := controllerutil.SetOwnerReference(nodeClass, configMap, t.kubeClient.Scheme()); err != nil {
+		return reconcile.Result{}, fmt.Errorf("setting terway configmap owner, %w", err)
+	}
+	if err := t.kubeClient.Patch(ctx, configMap.DeepCopy(), client.MergeFrom(&corev1.ConfigMap{})); err != nil {
+		if !errors.IsNotFound(err) {
+			return reconcile.Result{}, fmt.Errorf("patching terway configmap, %w", err)
+		}
+		if err := t.kubeClient.Create(ctx, configMap); err != nil {
+			return reconcile.Result{}, fmt.Errorf("creating terway configmap, %w", err)
+		}
+	}
+	return reconcile.Result{}, nil
+}
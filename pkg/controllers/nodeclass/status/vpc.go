@@ -0,0 +1,82 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/securitygroup"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/vswitch"
+)
+
+// VPC validates the resolved vSwitches and security groups are in a single VPC, or in the VPC of the spec when it's set.
+// ECS fails the launches mixing VPCs with an error that doesn't point at the selectors.
+type VPC struct {
+	vSwitchProvider       vswitch.Provider
+	securityGroupProvider securitygroup.Provider
+}
+
+func (v *VPC) Reconcile(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass) (reconcile.Result, error) {
+	vSwitches, err := v.vSwitchProvider.List(ctx, nodeClass)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("getting vSwitches, %w", err)
+	}
+	securityGroups, err := v.securityGroupProvider.List(ctx, nodeClass)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("getting security groups, %w", err)
+	}
+
+	resources := map[string][]string{}
+	for _, vSwitch := range vSwitches {
+		if vpcID := lo.FromPtr(vSwitch.VpcId); vpcID != "" {
+			resources[vpcID] = append(resources[vpcID], lo.FromPtr(vSwitch.VSwitchId))
+		}
+	}
+	for _, securityGroup := range securityGroups {
+		if vpcID := lo.FromPtr(securityGroup.VpcId); vpcID != "" {
+			resources[vpcID] = append(resources[vpcID], lo.FromPtr(securityGroup.SecurityGroupId))
+		}
+	}
+	if vpcID := nodeClass.Spec.VPCID; vpcID != "" {
+		if outside := lo.OmitByKeys(resources, []string{vpcID}); len(outside) != 0 {
+			nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeValidationSucceeded, "VPCMismatch",
+				fmt.Sprintf("The vSwitches and security groups must be in the VPC %s, found %s", vpcID, describeVPCResources(outside)))
+		}
+		return reconcile.Result{}, nil
+	}
+	if len(resources) > 1 {
+		nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeValidationSucceeded, "VPCMismatch",
+			fmt.Sprintf("The vSwitches and security groups must be in a single VPC, found %s", describeVPCResources(resources)))
+	}
+	return reconcile.Result{}, nil
+}
+
+// describeVPCResources lists the resources of each VPC, sorted by the VPC ID
+func describeVPCResources(resources map[string][]string) string {
+	vpcs := lo.Keys(resources)
+	sort.Strings(vpcs)
+	return strings.Join(lo.Map(vpcs, func(vpcID string, _ int) string {
+		return fmt.Sprintf("%s (%s)", vpcID, strings.Join(resources[vpcID], ", "))
+	}), "; ")
+}
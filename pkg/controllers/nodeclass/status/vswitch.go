@@ -20,17 +20,25 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	vpc "github.com/alibabacloud-go/vpc-20160428/v6/client"
 	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+	nodepoolutils "sigs.k8s.io/karpenter/pkg/utils/nodepool"
 
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/vswitch"
 )
 
 type VSwitch struct {
+	kubeClient      client.Client
 	vSwitchProvider vswitch.Provider
 }
 
@@ -41,11 +49,35 @@ func (v *VSwitch) Reconcile(ctx context.Context, nodeClass *v1alpha1.ECSNodeClas
 	}
 	if len(vSwitches) == 0 {
 		nodeClass.Status.VSwitches = nil
-		nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeVSwitchesReady, "vSwitchesNotFound", "VSwitchSelector did not match any VSwitches")
+		nodeClass.Status.VPCID = nodeClass.Spec.VPCID
+		nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeVSwitchesReady, "VSwitchesNotFound", "VSwitchSelector did not match any VSwitches")
 		// If users have omitted the necessary tags and later add them, we need to reprocess the information.
 		// Returning 'ok' in this case means that the ecsnodeclass will remain in an unready state until the component is restarted.
 		return reconcile.Result{RequeueAfter: time.Second * 15}, nil
 	}
+	nodeClass.Status.VPCID = resolveVPCID(nodeClass, vSwitches)
+	vSwitches = lo.Reject(vSwitches, func(v *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, _ int) bool {
+		return lo.Contains(nodeClass.Spec.ZoneExclusions, lo.FromPtr(v.ZoneId))
+	})
+	if len(vSwitches) == 0 {
+		nodeClass.Status.VSwitches = nil
+		nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeVSwitchesReady, "VSwitchesNotFound", "VSwitchSelector did not match any VSwitches outside the excluded zones")
+		return reconcile.Result{RequeueAfter: time.Second * 15}, nil
+	}
+	if nodeClass.Spec.VSwitchZonesFromNodePools {
+		nodePoolList := &karpv1.NodePoolList{}
+		if err := v.kubeClient.List(ctx, nodePoolList, nodepoolutils.ForNodeClass(nodeClass)); err != nil {
+			return reconcile.Result{}, fmt.Errorf("listing nodepools, %w", err)
+		}
+		vSwitches = nodePoolZoneVSwitches(nodeClass, vSwitches, nodePoolList.Items)
+		if len(vSwitches) == 0 {
+			nodeClass.Status.VSwitches = nil
+			nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeVSwitchesReady, "VSwitchesNotFound", "No vSwitch with available IP addresses in the zones of the NodePools")
+			return reconcile.Result{RequeueAfter: time.Second * 15}, nil
+		}
+	} else {
+		_ = nodeClass.StatusConditions().Clear(v1alpha1.ConditionTypeNodePoolZonesCovered)
+	}
 	sort.Slice(vSwitches, func(i, j int) bool {
 		if int(*vSwitches[i].AvailableIpAddressCount) != int(*vSwitches[j].AvailableIpAddressCount) {
 			return int(*vSwitches[i].AvailableIpAddressCount) > int(*vSwitches[j].AvailableIpAddressCount)
@@ -54,10 +86,64 @@ func (v *VSwitch) Reconcile(ctx context.Context, nodeClass *v1alpha1.ECSNodeClas
 	})
 	nodeClass.Status.VSwitches = lo.Map(vSwitches, func(ecsvSwitch *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, _ int) v1alpha1.VSwitch {
 		return v1alpha1.VSwitch{
-			ID:     *ecsvSwitch.VSwitchId,
-			ZoneID: *ecsvSwitch.ZoneId,
+			ID:            *ecsvSwitch.VSwitchId,
+			ZoneID:        *ecsvSwitch.ZoneId,
+			IPv6CIDRBlock: lo.FromPtr(ecsvSwitch.Ipv6CidrBlock),
 		}
 	})
 	nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeVSwitchesReady)
 	return reconcile.Result{RequeueAfter: time.Minute}, nil
 }
+
+// resolveVPCID returns the VPC in the spec, or else the VPC of the vSwitches when they are all in the same one. The
+// security groups are discovered in this VPC, mixing VPCs is reported by the VPC validation instead.
+func resolveVPCID(nodeClass *v1alpha1.ECSNodeClass, vSwitches []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch) string {
+	if nodeClass.Spec.VPCID != "" {
+		return nodeClass.Spec.VPCID
+	}
+	vpcIDs := lo.Uniq(lo.FilterMap(vSwitches, func(v *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, _ int) (string, bool) {
+		return lo.FromPtr(v.VpcId), lo.FromPtr(v.VpcId) != ""
+	}))
+	if len(vpcIDs) != 1 {
+		return ""
+	}
+	return vpcIDs[0]
+}
+
+// nodePoolZoneVSwitches returns the vSwitches with available IP addresses in the zones the NodePools allow, and reports
+// the zones the NodePools require without any of them with the NodePoolZonesCovered condition. Without NodePools, or with
+// a NodePool allowing every zone, the vSwitches are kept in every zone. The zones excluded by the ECSNodeClass are
+// expected to be left without vSwitches, so they're not reported.
+func nodePoolZoneVSwitches(nodeClass *v1alpha1.ECSNodeClass, vSwitches []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch,
+	nodePools []karpv1.NodePool) []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch {
+	zoneRequirements := lo.Map(nodePools, func(nodePool karpv1.NodePool, _ int) *scheduling.Requirement {
+		requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodePool.Spec.Template.Spec.Requirements...)
+		requirements.Add(scheduling.NewLabelRequirements(nodePool.Spec.Template.Labels).Values()...)
+		return requirements.Get(corev1.LabelTopologyZone)
+	})
+	allowed := func(zone string) bool {
+		return len(zoneRequirements) == 0 || lo.ContainsBy(zoneRequirements, func(r *scheduling.Requirement) bool { return r.Has(zone) })
+	}
+	usable := lo.Filter(vSwitches, func(v *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, _ int) bool {
+		return allowed(lo.FromPtr(v.ZoneId)) && lo.FromPtr(v.AvailableIpAddressCount) > 0
+	})
+
+	// Only the zones the NodePools list can be checked, the other requirements allow every zone
+	required := sets.New[string]()
+	for _, r := range zoneRequirements {
+		if r.Operator() == corev1.NodeSelectorOpIn {
+			required.Insert(r.Values()...)
+		}
+	}
+	required.Delete(nodeClass.Spec.ZoneExclusions...)
+	missing := required.Difference(sets.New(lo.Map(usable, func(v *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, _ int) string {
+		return lo.FromPtr(v.ZoneId)
+	})...))
+	if missing.Len() != 0 {
+		nodeClass.StatusConditions().SetFalse(v1alpha1.ConditionTypeNodePoolZonesCovered, "ZonesWithoutVSwitches",
+			fmt.Sprintf("No vSwitch with available IP addresses in the zones %s allowed by the NodePools", strings.Join(sets.List(missing), ", ")))
+	} else {
+		nodeClass.StatusConditions().SetTrue(v1alpha1.ConditionTypeNodePoolZonesCovered)
+	}
+	return usable
+}
@@ -20,8 +20,6 @@ import (
 	"time"
 
 	"github.com/awslabs/operatorpkg/singleton"
-	lop "github.com/samber/lo/parallel"
-	"go.uber.org/multierr"
 	controllerruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -43,17 +41,8 @@ func NewController(instancetypeProvider instancetype.Provider) *Controller {
 func (c *Controller) Reconcile(ctx context.Context) (reconcile.Result, error) {
 	ctx = injection.WithControllerName(ctx, "providers.instancetype")
 
-	work := []func(ctx context.Context) error{
-		c.instancetypeProvider.UpdateInstanceTypes,
-		c.instancetypeProvider.UpdateInstanceTypeOfferings,
-	}
-	errs := make([]error, len(work))
-	lop.ForEach(work, func(f func(ctx context.Context) error, i int) {
-		if err := f(ctx); err != nil {
-			errs[i] = err
-		}
-	})
-	if err := multierr.Combine(errs...); err != nil {
+	// Offerings are refreshed more frequently by the providers.instancetype.offering controller
+	if err := c.instancetypeProvider.UpdateInstanceTypes(ctx); err != nil {
 		return reconcile.Result{}, fmt.Errorf("updating instancetype, %w", err)
 	}
 	return reconcile.Result{RequeueAfter: 12 * time.Hour}, nil
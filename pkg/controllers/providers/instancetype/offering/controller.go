@@ -0,0 +1,57 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package offering
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/awslabs/operatorpkg/singleton"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instancetype"
+)
+
+// Controller periodically refreshes the instance type offerings of every zone, so that zones which
+// temporarily stop offering an instance type are taken into account before launching
+type Controller struct {
+	instancetypeProvider instancetype.Provider
+}
+
+func NewController(instancetypeProvider instancetype.Provider) *Controller {
+	return &Controller{
+		instancetypeProvider: instancetypeProvider,
+	}
+}
+
+func (c *Controller) Reconcile(ctx context.Context) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "providers.instancetype.offering")
+
+	if err := c.instancetypeProvider.UpdateInstanceTypeOfferings(ctx); err != nil {
+		return reconcile.Result{}, fmt.Errorf("updating instancetype offerings, %w", err)
+	}
+	return reconcile.Result{RequeueAfter: options.FromContext(ctx).InstanceTypeOfferingsRefreshInterval}, nil
+}
+
+func (c *Controller) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("providers.instancetype.offering").
+		WatchesRawSource(singleton.Source()).
+		Complete(singleton.AsReconciler(c))
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package offering
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	kcache "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/fake"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instancetype"
+)
+
+func TestReconcileSoldOutOfferings(t *testing.T) {
+	ecsAPI := fake.NewECSAPI()
+	// ecs.g7.large is sold out in the first zone, both on-demand and spot
+	output, err := ecsAPI.DescribeAvailableResourceWithOptions(&ecsclient.DescribeAvailableResourceRequest{}, &util.RuntimeOptions{})
+	require.NoError(t, err)
+	for _, zone := range output.Body.AvailableZones.AvailableZone {
+		if tea.StringValue(zone.ZoneId) != fake.DefaultZones[0] {
+			continue
+		}
+		for _, resource := range zone.AvailableResources.AvailableResource[0].SupportedResources.SupportedResource {
+			if tea.StringValue(resource.Value) == "ecs.g7.large" {
+				resource.StatusCategory = tea.String("WithoutStock")
+			}
+		}
+	}
+	ecsAPI.DescribeAvailableResourceBehavior.SetOutput(output)
+
+	unavailableOfferings := kcache.NewUnavailableOfferings()
+	c := NewController(instancetype.NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute), unavailableOfferings, nil, nil, nil))
+	ctx := options.ToContext(context.Background(), &options.Options{SoldOutOfferingsCooldown: 100 * time.Millisecond, InstanceTypeOfferingsRefreshInterval: time.Minute})
+
+	res, err := c.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, res.RequeueAfter)
+	// the sold out offerings aren't launched into during the cooldown, the other zones and instance types are
+	for _, capacityType := range []string{karpv1.CapacityTypeOnDemand, karpv1.CapacityTypeSpot} {
+		assert.True(t, unavailableOfferings.IsUnavailable("ecs.g7.large", fake.DefaultZones[0], capacityType), capacityType)
+		assert.False(t, unavailableOfferings.IsUnavailable("ecs.g7.large", fake.DefaultZones[1], capacityType), capacityType)
+		assert.False(t, unavailableOfferings.IsUnavailable("ecs.g7.xlarge", fake.DefaultZones[0], capacityType), capacityType)
+	}
+
+	// the offerings are available again once the cooldown expires
+	assert.Eventually(t, func() bool {
+		return !unavailableOfferings.IsUnavailable("ecs.g7.large", fake.DefaultZones[0], karpv1.CapacityTypeOnDemand) &&
+			!unavailableOfferings.IsUnavailable("ecs.g7.large", fake.DefaultZones[0], karpv1.CapacityTypeSpot)
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pricing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/awslabs/operatorpkg/singleton"
+	corev1 "k8s.io/api/core/v1"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/operator/injection"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/pricing"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
+)
+
+// CommittedUseController counts the running on-demand instances per instance family, so the pricing provider only
+// discounts the families whose committed use is not used up
+type CommittedUseController struct {
+	kubeClient      client.Client
+	pricingProvider pricing.Provider
+}
+
+func NewCommittedUseController(kubeClient client.Client, pricingProvider pricing.Provider) *CommittedUseController {
+	return &CommittedUseController{
+		kubeClient:      kubeClient,
+		pricingProvider: pricingProvider,
+	}
+}
+
+func (c *CommittedUseController) Reconcile(ctx context.Context) (reconcile.Result, error) {
+	ctx = injection.WithControllerName(ctx, "providers.pricing.committeduse")
+
+	nodeClaimList := &karpv1.NodeClaimList{}
+	if err := c.kubeClient.List(ctx, nodeClaimList); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing nodeclaims, %w", err)
+	}
+	usage := map[string]int{}
+	for _, nodeClaim := range nodeClaimList.Items {
+		if !nodeClaim.DeletionTimestamp.IsZero() || nodeClaim.Labels[karpv1.CapacityTypeLabelKey] != karpv1.CapacityTypeOnDemand {
+			continue
+		}
+		if instanceType := nodeClaim.Labels[corev1.LabelInstanceTypeStable]; instanceType != "" {
+			usage[utils.InstanceFamily(instanceType)]++
+		}
+	}
+	c.pricingProvider.SetCommittedUseUsage(usage)
+	return reconcile.Result{RequeueAfter: time.Minute}, nil
+}
+
+func (c *CommittedUseController) Register(_ context.Context, m manager.Manager) error {
+	return controllerruntime.NewControllerManagedBy(m).
+		Named("providers.pricing.committeduse").
+		WatchesRawSource(singleton.Source()).
+		Complete(singleton.AsReconciler(c))
+}
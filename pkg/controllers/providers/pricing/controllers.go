@@ -19,6 +19,7 @@ package pricing
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"time"
 
 	"github.com/awslabs/operatorpkg/singleton"
@@ -29,22 +30,45 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/karpenter/pkg/operator/injection"
 
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instancetype"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/pricing"
 )
 
+const (
+	refreshInterval = 12 * time.Hour
+	// maxInitialDelay bounds the stagger of the first refresh, the prices are needed soon after the start
+	maxInitialDelay = 30 * time.Second
+)
+
 type Controller struct {
-	pricingProvider pricing.Provider
+	pricingProvider      pricing.Provider
+	instanceTypeProvider instancetype.Provider
+	// random returns a number in [0, 1) to jitter the refreshes with, it's injectable for the tests
+	random  func() float64
+	started bool
 }
 
-func NewController(pricingProvider pricing.Provider) *Controller {
+func NewController(pricingProvider pricing.Provider, instanceTypeProvider instancetype.Provider) *Controller {
 	return &Controller{
-		pricingProvider: pricingProvider,
+		pricingProvider:      pricingProvider,
+		instanceTypeProvider: instanceTypeProvider,
+		random:               rand.Float64,
 	}
 }
 
 func (c *Controller) Reconcile(ctx context.Context) (reconcile.Result, error) {
 	ctx = injection.WithControllerName(ctx, "providers.pricing")
 
+	// The first refresh is staggered too, so the replicas started at the same time don't query the pricing API together
+	jitter := options.FromContext(ctx).PricingRefreshJitter
+	if !c.started {
+		c.started = true
+		if jitter > 0 {
+			return reconcile.Result{RequeueAfter: max(time.Duration(c.random()*float64(maxInitialDelay)), singleton.RequeueImmediately)}, nil
+		}
+	}
+
 	work := []func(ctx context.Context) error{
 		c.pricingProvider.UpdateSpotPricing,
 		c.pricingProvider.UpdateOnDemandPricing,
@@ -58,7 +82,14 @@ func (c *Controller) Reconcile(ctx context.Context) (reconcile.Result, error) {
 	if err := multierr.Combine(errs...); err != nil {
 		return reconcile.Result{}, fmt.Errorf("updating pricing, %w", err)
 	}
-	return reconcile.Result{RequeueAfter: 12 * time.Hour}, nil
+	// Only the prices changed, the cached instance types are repriced instead of recomputed
+	c.instanceTypeProvider.UpdateOfferingPrices(ctx)
+	return reconcile.Result{RequeueAfter: c.jitter(refreshInterval, jitter)}, nil
+}
+
+// jitter moves the interval earlier or later by at most the fraction of it
+func (c *Controller) jitter(interval time.Duration, fraction float64) time.Duration {
+	return time.Duration(float64(interval) * (1 + fraction*(2*c.random()-1)))
 }
 
 func (c *Controller) Register(_ context.Context, m manager.Manager) error {
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pricing
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instancetype"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/pricing"
+)
+
+type fakePricingProvider struct {
+	pricing.Provider
+	updates int
+}
+
+func (f *fakePricingProvider) UpdateOnDemandPricing(context.Context) error {
+	f.updates++
+	return nil
+}
+
+func (f *fakePricingProvider) UpdateSpotPricing(context.Context) error {
+	return nil
+}
+
+type fakeInstanceTypeProvider struct {
+	instancetype.Provider
+	repricings int
+}
+
+func (f *fakeInstanceTypeProvider) UpdateOfferingPrices(context.Context) {
+	f.repricings++
+}
+
+func TestReconcileJitter(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{PricingRefreshJitter: 0.1})
+	pricingProvider := &fakePricingProvider{}
+	instanceTypeProvider := &fakeInstanceTypeProvider{}
+	c := NewController(pricingProvider, instanceTypeProvider)
+	c.random = rand.New(rand.NewSource(1)).Float64
+
+	// the first refresh is staggered
+	res, err := c.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, pricingProvider.updates)
+	assert.Zero(t, instanceTypeProvider.repricings)
+	assert.Positive(t, res.RequeueAfter)
+	assert.LessOrEqual(t, res.RequeueAfter, maxInitialDelay)
+
+	var requeues []time.Duration
+	for range 100 {
+		res, err := c.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, res.RequeueAfter, 10*time.Hour+48*time.Minute)
+		assert.LessOrEqual(t, res.RequeueAfter, 13*time.Hour+12*time.Minute)
+		requeues = append(requeues, res.RequeueAfter)
+	}
+	assert.Equal(t, 100, pricingProvider.updates)
+	// the offerings are repriced after every refresh of the prices
+	assert.Equal(t, 100, instanceTypeProvider.repricings)
+	assert.NotEqual(t, requeues[0], requeues[1])
+
+	// without jitter, the prices are refreshed right away and on the fixed interval
+	c = NewController(pricingProvider, instanceTypeProvider)
+	res, err = c.Reconcile(options.ToContext(context.Background(), &options.Options{}))
+	require.NoError(t, err)
+	assert.Equal(t, 101, pricingProvider.updates)
+	assert.Equal(t, refreshInterval, res.RequeueAfter)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fake
+
+import (
+	"fmt"
+
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	vpc "github.com/alibabacloud-go/vpc-20160428/v6/client"
+)
+
+const (
+	DefaultRegion = "cn-hangzhou"
+	DefaultVPCID  = "vpc-fake"
+)
+
+// DefaultZones are the zones the default vSwitches and instance type offerings are in
+var DefaultZones = []string{"cn-hangzhou-i", "cn-hangzhou-j", "cn-hangzhou-k"}
+
+// InstanceType returns an instance type of DescribeInstanceTypes, the ENI limits are the ones of the general
+// purpose instance types
+func InstanceType(id, family, cpuArchitecture string, cpu int32, memoryGiB float32) *ecs.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType {
+	return &ecs.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		InstanceTypeId:              tea.String(id),
+		InstanceTypeFamily:          tea.String(family),
+		CpuArchitecture:             tea.String(cpuArchitecture),
+		CpuCoreCount:                tea.Int32(cpu),
+		MemorySize:                  tea.Float32(memoryGiB),
+		EniQuantity:                 tea.Int32(3),
+		EniPrivateIpAddressQuantity: tea.Int32(6),
+		InstanceBandwidthRx:         tea.Int32(2048000),
+		InstanceBandwidthTx:         tea.Int32(2048000),
+	}
+}
+
+// Image returns an image of DescribeImages
+func Image(id, name, architecture string) *ecs.DescribeImagesResponseBodyImagesImage {
+	return &ecs.DescribeImagesResponseBodyImagesImage{
+		ImageId:      tea.String(id),
+		ImageName:    tea.String(name),
+		Architecture: tea.String(architecture),
+		OSType:       tea.String("linux"),
+		Platform:     tea.String("Aliyun"),
+		Status:       tea.String("Available"),
+		Size:         tea.Int32(20),
+		CreationTime: tea.String("2024-01-01T00:00:00Z"),
+	}
+}
+
+// VSwitch returns a vSwitch of DescribeVSwitches in the default VPC, tagged with the tags
+func VSwitch(id, zone string, availableIPAddressCount int64, tags map[string]string) *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch {
+	vSwitch := &vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{
+		VSwitchId:               tea.String(id),
+		VSwitchName:             tea.String(id),
+		VpcId:                   tea.String(DefaultVPCID),
+		ZoneId:                  tea.String(zone),
+		Status:                  tea.String("Available"),
+		AvailableIpAddressCount: tea.Int64(availableIPAddressCount),
+		Tags:                    &vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitchTags{},
+	}
+	for k, v := range tags {
+		vSwitch.Tags.Tag = append(vSwitch.Tags.Tag, &vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitchTagsTag{Key: tea.String(k), Value: tea.String(v)})
+	}
+	return vSwitch
+}
+
+// DefaultInstanceTypes returns general purpose, compute optimized and ARM instance types
+func DefaultInstanceTypes() []*ecs.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType {
+	return []*ecs.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		InstanceType("ecs.g7.large", "ecs.g7", "X86", 2, 8),
+		InstanceType("ecs.g7.xlarge", "ecs.g7", "X86", 4, 16),
+		InstanceType("ecs.c7.large", "ecs.c7", "X86", 2, 4),
+		InstanceType("ecs.g8y.large", "ecs.g8y", "ARM", 2, 8),
+	}
+}
+
+// DefaultInstanceTypeZones returns the zones with stock of the default instance types, the ARM instance type
+// is sold in a single zone
+func DefaultInstanceTypeZones() map[string][]string {
+	return map[string][]string{
+		"ecs.g7.large":  DefaultZones,
+		"ecs.g7.xlarge": DefaultZones,
+		"ecs.c7.large":  DefaultZones,
+		"ecs.g8y.large": DefaultZones[:1],
+	}
+}
+
+// DefaultImages returns an x86 and an ARM image
+func DefaultImages() []*ecs.DescribeImagesResponseBodyImagesImage {
+	return []*ecs.DescribeImagesResponseBodyImagesImage{
+		Image("aliyun_3_x64_20G_alibase_20240819.vhd", "aliyun_3_x64_20G_alibase_20240819.vhd", "x86_64"),
+		Image("aliyun_3_arm64_20G_alibase_20240819.vhd", "aliyun_3_arm64_20G_alibase_20240819.vhd", "arm64"),
+	}
+}
+
+// DefaultVSwitches returns a vSwitch in every default zone, tagged with its zone
+func DefaultVSwitches() []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch {
+	vSwitches := make([]*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, 0, len(DefaultZones))
+	for i, zone := range DefaultZones {
+		vSwitches = append(vSwitches, VSwitch(fmt.Sprintf("vsw-%d", i+1), zone, 100, map[string]string{"karpenter.sh/discovery": "test", "zone": zone}))
+	}
+	return vSwitches
+}
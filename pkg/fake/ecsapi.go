@@ -0,0 +1,396 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/samber/lo"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+)
+
+const requestID = "fake-request-id"
+
+var _ client.ECSClient = &ECSAPI{}
+
+// ECSAPI is an in-memory fake of the ECS API. The describe actions reply from the seeded ECSAPIState by default,
+// the other actions reply with an empty successful response, and every action can be programmed through its behavior.
+type ECSAPI struct {
+	mu sync.RWMutex
+	ECSAPIState
+
+	AddTagsBehavior                       MockedFunction[ecs.AddTagsRequest, ecs.AddTagsResponse]
+	AssignIpv6AddressesBehavior           MockedFunction[ecs.AssignIpv6AddressesRequest, ecs.AssignIpv6AddressesResponse]
+	CreateAutoProvisioningGroupBehavior   MockedFunction[ecs.CreateAutoProvisioningGroupRequest, ecs.CreateAutoProvisioningGroupResponse]
+	CreateDeploymentSetBehavior           MockedFunction[ecs.CreateDeploymentSetRequest, ecs.CreateDeploymentSetResponse]
+	DeleteInstanceBehavior                MockedFunction[ecs.DeleteInstanceRequest, ecs.DeleteInstanceResponse]
+	DescribeAccountAttributesBehavior     MockedFunction[ecs.DescribeAccountAttributesRequest, ecs.DescribeAccountAttributesResponse]
+	DescribeAvailableResourceBehavior     MockedFunction[ecs.DescribeAvailableResourceRequest, ecs.DescribeAvailableResourceResponse]
+	DescribeCapacityReservationsBehavior  MockedFunction[ecs.DescribeCapacityReservationsRequest, ecs.DescribeCapacityReservationsResponse]
+	DescribeDedicatedHostsBehavior        MockedFunction[ecs.DescribeDedicatedHostsRequest, ecs.DescribeDedicatedHostsResponse]
+	DescribeDeploymentSetsBehavior        MockedFunction[ecs.DescribeDeploymentSetsRequest, ecs.DescribeDeploymentSetsResponse]
+	DescribeImagesBehavior                MockedFunction[ecs.DescribeImagesRequest, ecs.DescribeImagesResponse]
+	DescribeInstanceTypesBehavior         MockedFunction[ecs.DescribeInstanceTypesRequest, ecs.DescribeInstanceTypesResponse]
+	DescribeInstancesBehavior             MockedFunction[ecs.DescribeInstancesRequest, ecs.DescribeInstancesResponse]
+	DescribeKeyPairsBehavior              MockedFunction[ecs.DescribeKeyPairsRequest, ecs.DescribeKeyPairsResponse]
+	DescribeNetworkInterfacesBehavior     MockedFunction[ecs.DescribeNetworkInterfacesRequest, ecs.DescribeNetworkInterfacesResponse]
+	DescribeSecurityGroupsBehavior        MockedFunction[ecs.DescribeSecurityGroupsRequest, ecs.DescribeSecurityGroupsResponse]
+	DescribeZonesBehavior                 MockedFunction[ecs.DescribeZonesRequest, ecs.DescribeZonesResponse]
+	ModifyInstanceAttributeBehavior       MockedFunction[ecs.ModifyInstanceAttributeRequest, ecs.ModifyInstanceAttributeResponse]
+	ModifyInstanceMetadataOptionsBehavior MockedFunction[ecs.ModifyInstanceMetadataOptionsRequest, ecs.ModifyInstanceMetadataOptionsResponse]
+	RemoveTagsBehavior                    MockedFunction[ecs.RemoveTagsRequest, ecs.RemoveTagsResponse]
+	RunInstancesBehavior                  MockedFunction[ecs.RunInstancesRequest, ecs.RunInstancesResponse]
+}
+
+// ECSAPIState is the ECS resources the describe actions of the fake reply with
+type ECSAPIState struct {
+	InstanceTypes []*ecs.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType
+	// InstanceTypeZones are the zones with stock of every instance type
+	InstanceTypeZones map[string][]string
+	Images            []*ecs.DescribeImagesResponseBodyImagesImage
+	SecurityGroups    []*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup
+	Instances         []*ecs.DescribeInstancesResponseBodyInstancesInstance
+	KeyPairs          []string
+	// Zones are the zones of the region the instances can be created in
+	Zones []string
+}
+
+// NewECSAPI returns a fake ECS API seeded with the default instance types and images
+func NewECSAPI() *ECSAPI {
+	e := &ECSAPI{}
+	e.Reset()
+	return e
+}
+
+// Reset seeds the fake with the default state and forgets the programmed behaviors
+func (e *ECSAPI) Reset() {
+	e.mu.Lock()
+	e.ECSAPIState = ECSAPIState{
+		InstanceTypes:     DefaultInstanceTypes(),
+		InstanceTypeZones: DefaultInstanceTypeZones(),
+		Images:            DefaultImages(),
+		Zones:             DefaultZones,
+	}
+	e.mu.Unlock()
+
+	e.AddTagsBehavior.Reset()
+	e.AssignIpv6AddressesBehavior.Reset()
+	e.CreateAutoProvisioningGroupBehavior.Reset()
+	e.CreateDeploymentSetBehavior.Reset()
+	e.DeleteInstanceBehavior.Reset()
+	e.DescribeAccountAttributesBehavior.Reset()
+	e.DescribeAvailableResourceBehavior.Reset()
+	e.DescribeCapacityReservationsBehavior.Reset()
+	e.DescribeDedicatedHostsBehavior.Reset()
+	e.DescribeDeploymentSetsBehavior.Reset()
+	e.DescribeImagesBehavior.Reset()
+	e.DescribeInstanceTypesBehavior.Reset()
+	e.DescribeInstancesBehavior.Reset()
+	e.DescribeKeyPairsBehavior.Reset()
+	e.DescribeNetworkInterfacesBehavior.Reset()
+	e.DescribeSecurityGroupsBehavior.Reset()
+	e.DescribeZonesBehavior.Reset()
+	e.ModifyInstanceAttributeBehavior.Reset()
+	e.ModifyInstanceMetadataOptionsBehavior.Reset()
+	e.RemoveTagsBehavior.Reset()
+	e.RunInstancesBehavior.Reset()
+}
+
+// Seed replaces the state the describe actions reply with
+func (e *ECSAPI) Seed(state ECSAPIState) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ECSAPIState = state
+}
+
+func (e *ECSAPI) AddTagsWithOptions(request *ecs.AddTagsRequest, _ *util.RuntimeOptions) (*ecs.AddTagsResponse, error) {
+	return e.AddTagsBehavior.Invoke(request, func(*ecs.AddTagsRequest) (*ecs.AddTagsResponse, error) {
+		return &ecs.AddTagsResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.AddTagsResponseBody{RequestId: tea.String(requestID)}}, nil
+	})
+}
+
+func (e *ECSAPI) AssignIpv6AddressesWithOptions(request *ecs.AssignIpv6AddressesRequest, _ *util.RuntimeOptions) (*ecs.AssignIpv6AddressesResponse, error) {
+	return e.AssignIpv6AddressesBehavior.Invoke(request, func(*ecs.AssignIpv6AddressesRequest) (*ecs.AssignIpv6AddressesResponse, error) {
+		return &ecs.AssignIpv6AddressesResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.AssignIpv6AddressesResponseBody{
+			RequestId:          tea.String(requestID),
+			NetworkInterfaceId: request.NetworkInterfaceId,
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) CreateAutoProvisioningGroupWithOptions(request *ecs.CreateAutoProvisioningGroupRequest, _ *util.RuntimeOptions) (*ecs.CreateAutoProvisioningGroupResponse, error) {
+	return e.CreateAutoProvisioningGroupBehavior.Invoke(request, func(*ecs.CreateAutoProvisioningGroupRequest) (*ecs.CreateAutoProvisioningGroupResponse, error) {
+		return &ecs.CreateAutoProvisioningGroupResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.CreateAutoProvisioningGroupResponseBody{
+			RequestId:     tea.String(requestID),
+			LaunchResults: &ecs.CreateAutoProvisioningGroupResponseBodyLaunchResults{},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) CreateDeploymentSet(request *ecs.CreateDeploymentSetRequest) (*ecs.CreateDeploymentSetResponse, error) {
+	return e.CreateDeploymentSetBehavior.Invoke(request, func(*ecs.CreateDeploymentSetRequest) (*ecs.CreateDeploymentSetResponse, error) {
+		return &ecs.CreateDeploymentSetResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.CreateDeploymentSetResponseBody{RequestId: tea.String(requestID)}}, nil
+	})
+}
+
+func (e *ECSAPI) DeleteInstanceWithOptions(request *ecs.DeleteInstanceRequest, _ *util.RuntimeOptions) (*ecs.DeleteInstanceResponse, error) {
+	return e.DeleteInstanceBehavior.Invoke(request, func(*ecs.DeleteInstanceRequest) (*ecs.DeleteInstanceResponse, error) {
+		return &ecs.DeleteInstanceResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DeleteInstanceResponseBody{RequestId: tea.String(requestID)}}, nil
+	})
+}
+
+// DescribeAccountAttributesWithOptions replies without any quota by default, the tests set the quotas as the output
+func (e *ECSAPI) DescribeAccountAttributesWithOptions(request *ecs.DescribeAccountAttributesRequest, _ *util.RuntimeOptions) (*ecs.DescribeAccountAttributesResponse, error) {
+	return e.DescribeAccountAttributesBehavior.Invoke(request, func(*ecs.DescribeAccountAttributesRequest) (*ecs.DescribeAccountAttributesResponse, error) {
+		return &ecs.DescribeAccountAttributesResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeAccountAttributesResponseBody{
+			RequestId:             tea.String(requestID),
+			AccountAttributeItems: &ecs.DescribeAccountAttributesResponseBodyAccountAttributeItems{},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) DescribeAvailableResourceWithOptions(request *ecs.DescribeAvailableResourceRequest, _ *util.RuntimeOptions) (*ecs.DescribeAvailableResourceResponse, error) {
+	return e.DescribeAvailableResourceBehavior.Invoke(request, func(*ecs.DescribeAvailableResourceRequest) (*ecs.DescribeAvailableResourceResponse, error) {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+
+		instanceTypes := map[string][]string{}
+		for instanceType, zones := range e.InstanceTypeZones {
+			for _, zone := range zones {
+				if request.ZoneId != nil && tea.StringValue(request.ZoneId) != zone {
+					continue
+				}
+				instanceTypes[zone] = append(instanceTypes[zone], instanceType)
+			}
+		}
+		zones := lo.Keys(instanceTypes)
+		sort.Strings(zones)
+		return &ecs.DescribeAvailableResourceResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeAvailableResourceResponseBody{
+			RequestId: tea.String(requestID),
+			AvailableZones: &ecs.DescribeAvailableResourceResponseBodyAvailableZones{
+				AvailableZone: lo.Map(zones, func(zone string, _ int) *ecs.DescribeAvailableResourceResponseBodyAvailableZonesAvailableZone {
+					sort.Strings(instanceTypes[zone])
+					return &ecs.DescribeAvailableResourceResponseBodyAvailableZonesAvailableZone{
+						ZoneId:         tea.String(zone),
+						StatusCategory: tea.String("WithStock"),
+						AvailableResources: &ecs.DescribeAvailableResourceResponseBodyAvailableZonesAvailableZoneAvailableResources{
+							AvailableResource: []*ecs.DescribeAvailableResourceResponseBodyAvailableZonesAvailableZoneAvailableResourcesAvailableResource{{
+								Type: tea.String("InstanceType"),
+								SupportedResources: &ecs.DescribeAvailableResourceResponseBodyAvailableZonesAvailableZoneAvailableResourcesAvailableResourceSupportedResources{
+									SupportedResource: lo.Map(instanceTypes[zone], func(instanceType string, _ int) *ecs.DescribeAvailableResourceResponseBodyAvailableZonesAvailableZoneAvailableResourcesAvailableResourceSupportedResourcesSupportedResource {
+										return &ecs.DescribeAvailableResourceResponseBodyAvailableZonesAvailableZoneAvailableResourcesAvailableResourceSupportedResourcesSupportedResource{
+											Value:          tea.String(instanceType),
+											Status:         tea.String("Available"),
+											StatusCategory: tea.String("WithStock"),
+										}
+									}),
+								},
+							}},
+						},
+					}
+				}),
+			},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) DescribeCapacityReservationsWithOptions(request *ecs.DescribeCapacityReservationsRequest, _ *util.RuntimeOptions) (*ecs.DescribeCapacityReservationsResponse, error) {
+	return e.DescribeCapacityReservationsBehavior.Invoke(request, func(*ecs.DescribeCapacityReservationsRequest) (*ecs.DescribeCapacityReservationsResponse, error) {
+		return &ecs.DescribeCapacityReservationsResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeCapacityReservationsResponseBody{
+			RequestId:              tea.String(requestID),
+			CapacityReservationSet: &ecs.DescribeCapacityReservationsResponseBodyCapacityReservationSet{},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) DescribeDedicatedHostsWithOptions(request *ecs.DescribeDedicatedHostsRequest, _ *util.RuntimeOptions) (*ecs.DescribeDedicatedHostsResponse, error) {
+	return e.DescribeDedicatedHostsBehavior.Invoke(request, func(*ecs.DescribeDedicatedHostsRequest) (*ecs.DescribeDedicatedHostsResponse, error) {
+		return &ecs.DescribeDedicatedHostsResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeDedicatedHostsResponseBody{
+			RequestId:      tea.String(requestID),
+			DedicatedHosts: &ecs.DescribeDedicatedHostsResponseBodyDedicatedHosts{},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) DescribeDeploymentSets(request *ecs.DescribeDeploymentSetsRequest) (*ecs.DescribeDeploymentSetsResponse, error) {
+	return e.DescribeDeploymentSetsBehavior.Invoke(request, func(*ecs.DescribeDeploymentSetsRequest) (*ecs.DescribeDeploymentSetsResponse, error) {
+		return &ecs.DescribeDeploymentSetsResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeDeploymentSetsResponseBody{
+			RequestId:      tea.String(requestID),
+			DeploymentSets: &ecs.DescribeDeploymentSetsResponseBodyDeploymentSets{},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) DescribeImages(request *ecs.DescribeImagesRequest) (*ecs.DescribeImagesResponse, error) {
+	return e.DescribeImagesBehavior.Invoke(request, func(request *ecs.DescribeImagesRequest) (*ecs.DescribeImagesResponse, error) {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+
+		images := lo.Filter(e.Images, func(image *ecs.DescribeImagesResponseBodyImagesImage, _ int) bool {
+			return (request.ImageId == nil || tea.StringValue(image.ImageId) == tea.StringValue(request.ImageId)) &&
+				(request.ImageName == nil || tea.StringValue(image.ImageName) == tea.StringValue(request.ImageName)) &&
+				(request.ImageFamily == nil || tea.StringValue(image.ImageFamily) == tea.StringValue(request.ImageFamily))
+		})
+		return &ecs.DescribeImagesResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeImagesResponseBody{
+			RequestId:  tea.String(requestID),
+			TotalCount: tea.Int32(int32(len(images))),
+			Images:     &ecs.DescribeImagesResponseBodyImages{Image: images},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) DescribeInstanceTypesWithOptions(request *ecs.DescribeInstanceTypesRequest, _ *util.RuntimeOptions) (*ecs.DescribeInstanceTypesResponse, error) {
+	return e.DescribeInstanceTypesBehavior.Invoke(request, func(*ecs.DescribeInstanceTypesRequest) (*ecs.DescribeInstanceTypesResponse, error) {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+
+		return &ecs.DescribeInstanceTypesResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeInstanceTypesResponseBody{
+			RequestId:     tea.String(requestID),
+			InstanceTypes: &ecs.DescribeInstanceTypesResponseBodyInstanceTypes{InstanceType: append([]*ecs.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{}, e.InstanceTypes...)},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) DescribeInstancesWithOptions(request *ecs.DescribeInstancesRequest, _ *util.RuntimeOptions) (*ecs.DescribeInstancesResponse, error) {
+	return e.DescribeInstancesBehavior.Invoke(request, func(*ecs.DescribeInstancesRequest) (*ecs.DescribeInstancesResponse, error) {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+
+		var instanceIDs []string
+		if request.InstanceIds != nil {
+			if err := json.Unmarshal([]byte(tea.StringValue(request.InstanceIds)), &instanceIDs); err != nil {
+				return nil, fmt.Errorf("parsing instance ids, %w", err)
+			}
+		}
+		instances := lo.Filter(e.Instances, func(instance *ecs.DescribeInstancesResponseBodyInstancesInstance, _ int) bool {
+			return len(instanceIDs) == 0 || lo.Contains(instanceIDs, tea.StringValue(instance.InstanceId))
+		})
+		return &ecs.DescribeInstancesResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeInstancesResponseBody{
+			RequestId:  tea.String(requestID),
+			TotalCount: tea.Int32(int32(len(instances))), // #nosec G115
+			Instances:  &ecs.DescribeInstancesResponseBodyInstances{Instance: instances},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) DescribeKeyPairsWithOptions(request *ecs.DescribeKeyPairsRequest, _ *util.RuntimeOptions) (*ecs.DescribeKeyPairsResponse, error) {
+	return e.DescribeKeyPairsBehavior.Invoke(request, func(request *ecs.DescribeKeyPairsRequest) (*ecs.DescribeKeyPairsResponse, error) {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+
+		keyPairs := lo.FilterMap(e.KeyPairs, func(name string, _ int) (*ecs.DescribeKeyPairsResponseBodyKeyPairsKeyPair, bool) {
+			return &ecs.DescribeKeyPairsResponseBodyKeyPairsKeyPair{KeyPairName: tea.String(name)},
+				request.KeyPairName == nil || name == tea.StringValue(request.KeyPairName)
+		})
+		return &ecs.DescribeKeyPairsResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeKeyPairsResponseBody{
+			RequestId:  tea.String(requestID),
+			TotalCount: tea.Int32(int32(len(keyPairs))), // #nosec G115
+			KeyPairs:   &ecs.DescribeKeyPairsResponseBodyKeyPairs{KeyPair: keyPairs},
+		}}, nil
+	})
+}
+
+// DescribeNetworkInterfacesWithOptions replies with the primary network interface eni-<instance-id> of the instance
+func (e *ECSAPI) DescribeNetworkInterfacesWithOptions(request *ecs.DescribeNetworkInterfacesRequest, _ *util.RuntimeOptions) (*ecs.DescribeNetworkInterfacesResponse, error) {
+	return e.DescribeNetworkInterfacesBehavior.Invoke(request, func(request *ecs.DescribeNetworkInterfacesRequest) (*ecs.DescribeNetworkInterfacesResponse, error) {
+		var networkInterfaces []*ecs.DescribeNetworkInterfacesResponseBodyNetworkInterfaceSetsNetworkInterfaceSet
+		if request.InstanceId != nil {
+			networkInterfaces = append(networkInterfaces, &ecs.DescribeNetworkInterfacesResponseBodyNetworkInterfaceSetsNetworkInterfaceSet{
+				NetworkInterfaceId: tea.String("eni-" + tea.StringValue(request.InstanceId)),
+				InstanceId:         request.InstanceId,
+				Type:               tea.String("Primary"),
+			})
+		}
+		return &ecs.DescribeNetworkInterfacesResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeNetworkInterfacesResponseBody{
+			RequestId:            tea.String(requestID),
+			NetworkInterfaceSets: &ecs.DescribeNetworkInterfacesResponseBodyNetworkInterfaceSets{NetworkInterfaceSet: networkInterfaces},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) DescribeSecurityGroupsWithOptions(request *ecs.DescribeSecurityGroupsRequest, _ *util.RuntimeOptions) (*ecs.DescribeSecurityGroupsResponse, error) {
+	return e.DescribeSecurityGroupsBehavior.Invoke(request, func(request *ecs.DescribeSecurityGroupsRequest) (*ecs.DescribeSecurityGroupsResponse, error) {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+
+		securityGroups := lo.Filter(e.SecurityGroups, func(securityGroup *ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup, _ int) bool {
+			return (request.SecurityGroupId == nil || tea.StringValue(securityGroup.SecurityGroupId) == tea.StringValue(request.SecurityGroupId)) &&
+				(request.SecurityGroupName == nil || tea.StringValue(securityGroup.SecurityGroupName) == tea.StringValue(request.SecurityGroupName))
+		})
+		return &ecs.DescribeSecurityGroupsResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeSecurityGroupsResponseBody{
+			RequestId:      tea.String(requestID),
+			SecurityGroups: &ecs.DescribeSecurityGroupsResponseBodySecurityGroups{SecurityGroup: securityGroups},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) DescribeZonesWithOptions(request *ecs.DescribeZonesRequest, _ *util.RuntimeOptions) (*ecs.DescribeZonesResponse, error) {
+	return e.DescribeZonesBehavior.Invoke(request, func(*ecs.DescribeZonesRequest) (*ecs.DescribeZonesResponse, error) {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+
+		return &ecs.DescribeZonesResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.DescribeZonesResponseBody{
+			RequestId: tea.String(requestID),
+			Zones: &ecs.DescribeZonesResponseBodyZones{Zone: lo.Map(e.Zones, func(zone string, _ int) *ecs.DescribeZonesResponseBodyZonesZone {
+				return &ecs.DescribeZonesResponseBodyZonesZone{
+					ZoneId: tea.String(zone),
+					AvailableResourceCreation: &ecs.DescribeZonesResponseBodyZonesZoneAvailableResourceCreation{
+						ResourceTypes: tea.StringSlice([]string{"VSwitch", "IoOptimized", "Instance", "Disk"}),
+					},
+				}
+			})},
+		}}, nil
+	})
+}
+
+func (e *ECSAPI) ModifyInstanceAttributeWithOptions(request *ecs.ModifyInstanceAttributeRequest, _ *util.RuntimeOptions) (*ecs.ModifyInstanceAttributeResponse, error) {
+	return e.ModifyInstanceAttributeBehavior.Invoke(request, func(*ecs.ModifyInstanceAttributeRequest) (*ecs.ModifyInstanceAttributeResponse, error) {
+		return &ecs.ModifyInstanceAttributeResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.ModifyInstanceAttributeResponseBody{RequestId: tea.String(requestID)}}, nil
+	})
+}
+
+func (e *ECSAPI) ModifyInstanceMetadataOptionsWithOptions(request *ecs.ModifyInstanceMetadataOptionsRequest, _ *util.RuntimeOptions) (*ecs.ModifyInstanceMetadataOptionsResponse, error) {
+	return e.ModifyInstanceMetadataOptionsBehavior.Invoke(request, func(*ecs.ModifyInstanceMetadataOptionsRequest) (*ecs.ModifyInstanceMetadataOptionsResponse, error) {
+		return &ecs.ModifyInstanceMetadataOptionsResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.ModifyInstanceMetadataOptionsResponseBody{RequestId: tea.String(requestID)}}, nil
+	})
+}
+
+func (e *ECSAPI) RemoveTagsWithOptions(request *ecs.RemoveTagsRequest, _ *util.RuntimeOptions) (*ecs.RemoveTagsResponse, error) {
+	return e.RemoveTagsBehavior.Invoke(request, func(*ecs.RemoveTagsRequest) (*ecs.RemoveTagsResponse, error) {
+		return &ecs.RemoveTagsResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.RemoveTagsResponseBody{RequestId: tea.String(requestID)}}, nil
+	})
+}
+
+func (e *ECSAPI) RunInstancesWithOptions(request *ecs.RunInstancesRequest, _ *util.RuntimeOptions) (*ecs.RunInstancesResponse, error) {
+	return e.RunInstancesBehavior.Invoke(request, func(request *ecs.RunInstancesRequest) (*ecs.RunInstancesResponse, error) {
+		// ECS fails a dry run which would have succeeded
+		if tea.BoolValue(request.DryRun) {
+			return nil, &tea.SDKError{Code: tea.String("DryRunOperation"), StatusCode: tea.Int(http.StatusBadRequest)}
+		}
+		return &ecs.RunInstancesResponse{StatusCode: tea.Int32(http.StatusOK), Body: &ecs.RunInstancesResponseBody{
+			RequestId:      tea.String(requestID),
+			InstanceIdSets: &ecs.RunInstancesResponseBodyInstanceIdSets{},
+		}}, nil
+	})
+}
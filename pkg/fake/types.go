@@ -0,0 +1,85 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fake
+
+import (
+	"sync"
+
+	"github.com/samber/lo"
+)
+
+// MockedFunction records the requests of an API action of a fake client, the calls reply with the programmed
+// output or error, or fall back to the default behavior of the fake when neither is set
+type MockedFunction[I any, O any] struct {
+	mu       sync.Mutex
+	output   *O
+	err      error
+	requests []*I
+}
+
+// SetOutput makes the following calls reply with the output
+func (m *MockedFunction[I, O]) SetOutput(output *O) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.output = output
+}
+
+// SetError makes the following calls fail with the error
+func (m *MockedFunction[I, O]) SetError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Requests returns a copy of the request of every call, in the order of the calls
+func (m *MockedFunction[I, O]) Requests() []*I {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*I{}, m.requests...)
+}
+
+// Calls returns the number of calls
+func (m *MockedFunction[I, O]) Calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.requests)
+}
+
+// Reset forgets the programmed output and error and the recorded requests
+func (m *MockedFunction[I, O]) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.output = nil
+	m.err = nil
+	m.requests = nil
+}
+
+// Invoke records the request and replies to the call
+func (m *MockedFunction[I, O]) Invoke(request *I, defaultBehavior func(*I) (*O, error)) (*O, error) {
+	m.mu.Lock()
+	// the providers reuse the requests across pages, so a copy is recorded
+	m.requests = append(m.requests, lo.ToPtr(lo.FromPtr(request)))
+	output, err := m.output, m.err
+	m.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if output != nil {
+		return output, nil
+	}
+	return defaultBehavior(request)
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	vpc "github.com/alibabacloud-go/vpc-20160428/v6/client"
+	"github.com/samber/lo"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+)
+
+var _ client.VPCClient = &VPCAPI{}
+
+// VPCAPI is an in-memory fake of the VPC API, DescribeVSwitches replies from the seeded vSwitches by default and
+// the elastic IP address actions operate on EIPs
+type VPCAPI struct {
+	mu        sync.RWMutex
+	VSwitches []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch
+	EIPs      []*vpc.DescribeEipAddressesResponseBodyEipAddressesEipAddress
+
+	AllocateEipAddressBehavior   MockedFunction[vpc.AllocateEipAddressRequest, vpc.AllocateEipAddressResponse]
+	AssociateEipAddressBehavior  MockedFunction[vpc.AssociateEipAddressRequest, vpc.AssociateEipAddressResponse]
+	DescribeEipAddressesBehavior MockedFunction[vpc.DescribeEipAddressesRequest, vpc.DescribeEipAddressesResponse]
+	ReleaseEipAddressBehavior    MockedFunction[vpc.ReleaseEipAddressRequest, vpc.ReleaseEipAddressResponse]
+	DescribeVSwitchesBehavior    MockedFunction[vpc.DescribeVSwitchesRequest, vpc.DescribeVSwitchesResponse]
+}
+
+// NewVPCAPI returns a fake VPC API seeded with the default vSwitches
+func NewVPCAPI() *VPCAPI {
+	v := &VPCAPI{}
+	v.Reset()
+	return v
+}
+
+// Reset seeds the fake with the default vSwitches and forgets the programmed behaviors
+func (v *VPCAPI) Reset() {
+	v.Seed(DefaultVSwitches())
+	v.mu.Lock()
+	v.EIPs = nil
+	v.mu.Unlock()
+	v.AllocateEipAddressBehavior.Reset()
+	v.AssociateEipAddressBehavior.Reset()
+	v.DescribeEipAddressesBehavior.Reset()
+	v.ReleaseEipAddressBehavior.Reset()
+	v.DescribeVSwitchesBehavior.Reset()
+}
+
+// Seed replaces the vSwitches DescribeVSwitches replies with
+func (v *VPCAPI) Seed(vSwitches []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.VSwitches = vSwitches
+}
+
+// DescribeVSwitchesWithOptions filters the vSwitches by the ID, the VPC, the zone, the resource group and the tags
+// of the request, and pages them like the VPC API does
+func (v *VPCAPI) DescribeVSwitchesWithOptions(request *vpc.DescribeVSwitchesRequest, _ *util.RuntimeOptions) (*vpc.DescribeVSwitchesResponse, error) {
+	return v.DescribeVSwitchesBehavior.Invoke(request, func(request *vpc.DescribeVSwitchesRequest) (*vpc.DescribeVSwitchesResponse, error) {
+		v.mu.RLock()
+		defer v.mu.RUnlock()
+
+		vSwitches := lo.Filter(v.VSwitches, func(vSwitch *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, _ int) bool {
+			return matches(request.VSwitchId, vSwitch.VSwitchId) &&
+				matches(request.VpcId, vSwitch.VpcId) &&
+				matches(request.ZoneId, vSwitch.ZoneId) &&
+				matches(request.ResourceGroupId, vSwitch.ResourceGroupId) &&
+				lo.EveryBy(request.Tag, func(tag *vpc.DescribeVSwitchesRequestTag) bool {
+					return vSwitch.Tags != nil && lo.ContainsBy(vSwitch.Tags.Tag, func(t *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitchTagsTag) bool {
+						return tea.StringValue(t.Key) == tea.StringValue(tag.Key) && matches(tag.Value, t.Value)
+					})
+				})
+		})
+
+		pageNumber, pageSize := max(tea.Int32Value(request.PageNumber), 1), tea.Int32Value(request.PageSize)
+		if pageSize <= 0 {
+			pageSize = 10
+		}
+		page := lo.Slice(vSwitches, int((pageNumber-1)*pageSize), int(pageNumber*pageSize))
+		return &vpc.DescribeVSwitchesResponse{StatusCode: tea.Int32(http.StatusOK), Body: &vpc.DescribeVSwitchesResponseBody{
+			RequestId:  tea.String(requestID),
+			PageNumber: tea.Int32(pageNumber),
+			PageSize:   tea.Int32(pageSize),
+			TotalCount: tea.Int32(int32(len(vSwitches))),
+			VSwitches:  &vpc.DescribeVSwitchesResponseBodyVSwitches{VSwitch: page},
+		}}, nil
+	})
+}
+
+// AllocateEipAddressWithOptions allocates an available elastic IP address
+func (v *VPCAPI) AllocateEipAddressWithOptions(request *vpc.AllocateEipAddressRequest, _ *util.RuntimeOptions) (*vpc.AllocateEipAddressResponse, error) {
+	return v.AllocateEipAddressBehavior.Invoke(request, func(request *vpc.AllocateEipAddressRequest) (*vpc.AllocateEipAddressResponse, error) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		eip := &vpc.DescribeEipAddressesResponseBodyEipAddressesEipAddress{
+			AllocationId:       tea.String(fmt.Sprintf("eip-%d", len(v.EIPs)+1)),
+			IpAddress:          tea.String(fmt.Sprintf("47.0.0.%d", len(v.EIPs)+1)),
+			Bandwidth:          request.Bandwidth,
+			InternetChargeType: request.InternetChargeType,
+			Name:               request.Name,
+			Description:        request.Description,
+			ResourceGroupId:    request.ResourceGroupId,
+			Status:             tea.String("Available"),
+		}
+		v.EIPs = append(v.EIPs, eip)
+		return &vpc.AllocateEipAddressResponse{StatusCode: tea.Int32(http.StatusOK), Body: &vpc.AllocateEipAddressResponseBody{
+			RequestId:    tea.String(requestID),
+			AllocationId: eip.AllocationId,
+			EipAddress:   eip.IpAddress,
+		}}, nil
+	})
+}
+
+// AssociateEipAddressWithOptions associates the elastic IP address with the instance
+func (v *VPCAPI) AssociateEipAddressWithOptions(request *vpc.AssociateEipAddressRequest, _ *util.RuntimeOptions) (*vpc.AssociateEipAddressResponse, error) {
+	return v.AssociateEipAddressBehavior.Invoke(request, func(request *vpc.AssociateEipAddressRequest) (*vpc.AssociateEipAddressResponse, error) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		eip, ok := lo.Find(v.EIPs, func(eip *vpc.DescribeEipAddressesResponseBodyEipAddressesEipAddress) bool {
+			return tea.StringValue(eip.AllocationId) == tea.StringValue(request.AllocationId)
+		})
+		if !ok {
+			return nil, &tea.SDKError{Code: tea.String("InvalidAllocationId.NotFound"), StatusCode: tea.Int(http.StatusNotFound)}
+		}
+		eip.InstanceId, eip.InstanceType, eip.Status = request.InstanceId, request.InstanceType, tea.String("InUse")
+		return &vpc.AssociateEipAddressResponse{StatusCode: tea.Int32(http.StatusOK), Body: &vpc.AssociateEipAddressResponseBody{RequestId: tea.String(requestID)}}, nil
+	})
+}
+
+// DescribeEipAddressesWithOptions filters the elastic IP addresses by the allocation ID and the associated instance
+func (v *VPCAPI) DescribeEipAddressesWithOptions(request *vpc.DescribeEipAddressesRequest, _ *util.RuntimeOptions) (*vpc.DescribeEipAddressesResponse, error) {
+	return v.DescribeEipAddressesBehavior.Invoke(request, func(request *vpc.DescribeEipAddressesRequest) (*vpc.DescribeEipAddressesResponse, error) {
+		v.mu.RLock()
+		defer v.mu.RUnlock()
+
+		eips := lo.Filter(v.EIPs, func(eip *vpc.DescribeEipAddressesResponseBodyEipAddressesEipAddress, _ int) bool {
+			return matches(request.AllocationId, eip.AllocationId) &&
+				matches(request.AssociatedInstanceId, eip.InstanceId) &&
+				matches(request.AssociatedInstanceType, eip.InstanceType)
+		})
+		return &vpc.DescribeEipAddressesResponse{StatusCode: tea.Int32(http.StatusOK), Body: &vpc.DescribeEipAddressesResponseBody{
+			RequestId:    tea.String(requestID),
+			PageNumber:   tea.Int32(1),
+			PageSize:     tea.Int32(int32(len(eips))),
+			TotalCount:   tea.Int32(int32(len(eips))),
+			EipAddresses: &vpc.DescribeEipAddressesResponseBodyEipAddresses{EipAddress: eips},
+		}}, nil
+	})
+}
+
+// ReleaseEipAddressWithOptions releases the elastic IP address
+func (v *VPCAPI) ReleaseEipAddressWithOptions(request *vpc.ReleaseEipAddressRequest, _ *util.RuntimeOptions) (*vpc.ReleaseEipAddressResponse, error) {
+	return v.ReleaseEipAddressBehavior.Invoke(request, func(request *vpc.ReleaseEipAddressRequest) (*vpc.ReleaseEipAddressResponse, error) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		v.EIPs = lo.Reject(v.EIPs, func(eip *vpc.DescribeEipAddressesResponseBodyEipAddressesEipAddress, _ int) bool {
+			return tea.StringValue(eip.AllocationId) == tea.StringValue(request.AllocationId)
+		})
+		return &vpc.ReleaseEipAddressResponse{StatusCode: tea.Int32(http.StatusOK), Body: &vpc.ReleaseEipAddressResponseBody{RequestId: tea.String(requestID)}}, nil
+	})
+}
+
+// matches returns true when the filter of the request is unset or equals the value
+func matches(filter, value *string) bool {
+	return filter == nil || tea.StringValue(filter) == tea.StringValue(value)
+}
@@ -30,14 +30,18 @@ import (
 
 	alicache "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/capacityreservation"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/cluster"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/imagefamily"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instance"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/instancetype"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/keypair"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/pricing"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/quota"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/securitygroup"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/version"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/vswitch"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/zone"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
 )
 
@@ -49,40 +53,63 @@ func init() {
 type Operator struct {
 	*operator.Operator
 
-	UnavailableOfferingsCache *alicache.UnavailableOfferings
-	InstanceProvider          instance.Provider
-	PricingProvider           pricing.Provider
-	VSwitchProvider           vswitch.Provider
-	SecurityGroupProvider     securitygroup.Provider
-	ImageProvider             imagefamily.Provider
-	ImageResolver             imagefamily.Resolver
-	VersionProvider           version.Provider
-	InstanceTypeProvider      instancetype.Provider
+	UnavailableOfferingsCache   *alicache.UnavailableOfferings
+	InstanceProvider            instance.Provider
+	PricingProvider             pricing.Provider
+	VSwitchProvider             vswitch.Provider
+	ZoneProvider                zone.Provider
+	SecurityGroupProvider       securitygroup.Provider
+	CapacityReservationProvider capacityreservation.Provider
+	KeyPairProvider             keypair.Provider
+	QuotaProvider               quota.Provider
+	ImageProvider               imagefamily.Provider
+	ImageResolver               imagefamily.Resolver
+	VersionProvider             version.Provider
+	InstanceTypeProvider        instancetype.Provider
 }
 
 func NewOperator(ctx context.Context, operator *operator.Operator) (context.Context, *Operator) {
-	clientConfig, err := client.NewClientConfig(ctx, options.FromContext(ctx).RegionID, options.FromContext(ctx).AliNetwork)
+	clientConfig, err := client.NewClientConfig(ctx, options.FromContext(ctx).RegionID, options.FromContext(ctx).AliNetwork,
+		options.FromContext(ctx).CredentialRefreshWindow)
 	if err != nil {
 		log.FromContext(ctx).Error(err, "Failed to create client config")
 		os.Exit(1)
 	}
-	ecsClient, err := ecs.NewClient(clientConfig)
+	ecsConfig, err := client.ServiceConfig(clientConfig, client.ServiceECS, options.FromContext(ctx).ECSEndpoint)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to resolve ECS endpoint")
+		os.Exit(1)
+	}
+	ecsClient, err := ecs.NewClient(ecsConfig)
 	if err != nil {
 		log.FromContext(ctx).Error(err, "Failed to create ECS client")
 		os.Exit(1)
 	}
-	vpcClient, err := vpc.NewClient(clientConfig)
+	vpcConfig, err := client.ServiceConfig(clientConfig, client.ServiceVPC, options.FromContext(ctx).VPCEndpoint)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to resolve VPC endpoint")
+		os.Exit(1)
+	}
+	vpcClient, err := vpc.NewClient(vpcConfig)
 	if err != nil {
 		log.FromContext(ctx).Error(err, "Failed to create VPC client")
 		os.Exit(1)
 	}
-	ackClient, err := ackclient.NewClient(clientConfig)
+	ackConfig, err := client.ServiceConfig(clientConfig, client.ServiceACK, options.FromContext(ctx).ACKEndpoint)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to resolve ACK endpoint")
+		os.Exit(1)
+	}
+	ackClient, err := ackclient.NewClient(ackConfig)
 	if err != nil {
 		log.FromContext(ctx).Error(err, "Failed to create ACK client")
 		os.Exit(1)
 	}
 
 	region := *ecsClient.RegionId
+	ecsAPI := client.NewInstrumentedECSClient(ecsClient)
+	vpcAPI := client.NewInstrumentedVPCClient(vpcClient)
+	ackAPI := client.NewInstrumentedACKClient(ackClient)
 
 	pricingProvider, err := pricing.NewDefaultProvider(ctx, region)
 	if err != nil {
@@ -90,41 +117,66 @@ func NewOperator(ctx context.Context, operator *operator.Operator) (context.Cont
 		os.Exit(1)
 	}
 
-	versionProvider := version.NewDefaultProvider(operator.KubernetesInterface, cache.New(alicache.KubernetesVersionTTL, alicache.DefaultCleanupInterval))
-	vSwitchProvider := vswitch.NewDefaultProvider(region, vpcClient, cache.New(alicache.DefaultTTL, alicache.DefaultCleanupInterval), cache.New(alicache.AvailableIPAddressTTL, alicache.DefaultCleanupInterval))
-	securityGroupProvider := securitygroup.NewDefaultProvider(region, ecsClient, cache.New(alicache.DefaultTTL, alicache.DefaultCleanupInterval))
-	clusterProvider := cluster.NewClusterProvider(ctx, ackClient, region)
-	imageProvider := imagefamily.NewDefaultProvider(region, ecsClient, clusterProvider, versionProvider, cache.New(alicache.DefaultTTL, alicache.DefaultCleanupInterval))
-	imageResolver := imagefamily.NewDefaultResolver(region, ecsClient, cache.New(alicache.InstanceTypeAvailableDiskTTL, alicache.DefaultCleanupInterval))
+	versionProvider, err := version.NewDefaultProviderWithOptions(operator.KubernetesInterface, cache.New(alicache.KubernetesVersionTTL, alicache.DefaultCleanupInterval), version.ProviderOptions{
+		MinVersion: options.FromContext(ctx).MinK8sVersion,
+		MaxVersion: options.FromContext(ctx).MaxK8sVersion,
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to create version provider")
+		os.Exit(1)
+	}
+	rateLimiter := options.FromContext(ctx).RateLimiter()
+	zoneProvider := zone.NewDefaultProvider(region, ecsAPI, rateLimiter, cache.New(alicache.ZonesTTL, alicache.DefaultCleanupInterval))
+	vSwitchProvider := vswitch.NewDefaultProvider(region, vpcAPI, zoneProvider, rateLimiter, cache.New(alicache.DefaultTTL, alicache.DefaultCleanupInterval), cache.New(alicache.AvailableIPAddressTTL, alicache.DefaultCleanupInterval))
+	securityGroupProvider := securitygroup.NewDefaultProvider(region, ecsAPI, rateLimiter, cache.New(alicache.DefaultTTL, alicache.DefaultCleanupInterval))
+	capacityReservationProvider := capacityreservation.NewDefaultProvider(region, ecsAPI, rateLimiter, cache.New(alicache.DefaultTTL, alicache.DefaultCleanupInterval))
+	keyPairProvider := keypair.NewDefaultProvider(region, ecsAPI, rateLimiter, cache.New(alicache.DefaultTTL, alicache.DefaultCleanupInterval))
+	quotaProvider := quota.NewDefaultProvider(region, ecsAPI, rateLimiter, cache.New(alicache.QuotaTTL, alicache.DefaultCleanupInterval))
+	clusterProvider := cluster.NewClusterProvider(ctx, ackAPI, operator.KubernetesInterface, region)
+	imageProvider := imagefamily.NewDefaultProvider(region, ecsAPI, rateLimiter, clusterProvider, versionProvider, cache.New(alicache.DefaultTTL, alicache.DefaultCleanupInterval))
+	imageResolver := imagefamily.NewDefaultResolver(region, ecsAPI, rateLimiter, cache.New(alicache.InstanceTypeAvailableDiskTTL, alicache.DefaultCleanupInterval))
 
 	unavailableOfferingsCache := alicache.NewUnavailableOfferings()
 	instanceTypeProvider := instancetype.NewDefaultProvider(
-		*ecsClient.RegionId, ecsClient,
-		cache.New(alicache.InstanceTypesAndZonesTTL, alicache.DefaultCleanupInterval),
+		region, ecsAPI, rateLimiter,
+		cache.New(options.FromContext(ctx).InstanceTypesCacheTTL, alicache.DefaultCleanupInterval),
 		unavailableOfferingsCache,
-		pricingProvider, clusterProvider)
+		pricingProvider, clusterProvider, zoneProvider)
 
 	instanceProvider := instance.NewDefaultProvider(
 		ctx,
 		region,
-		ecsClient,
+		ecsAPI,
+		vpcAPI,
+		rateLimiter,
 		unavailableOfferingsCache,
 		imageResolver,
 		vSwitchProvider,
 		clusterProvider,
+		quotaProvider,
+		operator.EventRecorder,
 	)
 
+	lo.Must0(operator.AddReadyzCheck("providers", providersSynced(operator.Elected(), map[string]syncer{
+		"instancetype": instanceTypeProvider,
+		"pricing":      pricingProvider,
+	})))
+
 	return ctx, &Operator{
 		Operator: operator,
 
-		UnavailableOfferingsCache: unavailableOfferingsCache,
-		InstanceProvider:          instanceProvider,
-		PricingProvider:           pricingProvider,
-		VSwitchProvider:           vSwitchProvider,
-		SecurityGroupProvider:     securityGroupProvider,
-		ImageProvider:             imageProvider,
-		ImageResolver:             imageResolver,
-		VersionProvider:           versionProvider,
-		InstanceTypeProvider:      instanceTypeProvider,
+		UnavailableOfferingsCache:   unavailableOfferingsCache,
+		InstanceProvider:            instanceProvider,
+		PricingProvider:             pricingProvider,
+		VSwitchProvider:             vSwitchProvider,
+		ZoneProvider:                zoneProvider,
+		SecurityGroupProvider:       securityGroupProvider,
+		CapacityReservationProvider: capacityReservationProvider,
+		KeyPairProvider:             keyPairProvider,
+		QuotaProvider:               quotaProvider,
+		ImageProvider:               imageProvider,
+		ImageResolver:               imageResolver,
+		VersionProvider:             versionProvider,
+		InstanceTypeProvider:        instanceTypeProvider,
 	}
 }
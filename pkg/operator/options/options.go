@@ -19,12 +19,65 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"math"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	coreoptions "sigs.k8s.io/karpenter/pkg/operator/options"
 	"sigs.k8s.io/karpenter/pkg/utils/env"
 
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
+)
+
+const (
+	// SecurityGroupDriftModeStrict reports drift when the security groups of an instance differ from the resolved ones
+	SecurityGroupDriftModeStrict = "strict"
+	// SecurityGroupDriftModeSuperset allows security groups attached to an instance out-of-band
+	SecurityGroupDriftModeSuperset = "superset"
+
+	// ClusterCNITerway and ClusterCNIFlannel are the values of the cluster-cni option
+	ClusterCNITerway  = "terway-eniip"
+	ClusterCNIFlannel = "Flannel"
+	// ClusterEndpointAccessPrivate and ClusterEndpointAccessPublic are the values of the cluster-endpoint-access option
+	ClusterEndpointAccessPrivate = "private"
+	ClusterEndpointAccessPublic  = "public"
+	// PricingModeOnDemand ranks the instance types by their on-demand prices
+	PricingModeOnDemand = "on-demand"
+	// PricingModeCommittedUse discounts the on-demand prices of the instance families covered by
+	// reserved instances or savings plans
+	PricingModeCommittedUse = "committed-use"
+	// DefaultCommittedUseDiscount is the fraction of the on-demand price saved by the committed use
+	DefaultCommittedUseDiscount = 0.5
+	// DefaultPricingRefreshJitter is the fraction of the pricing refresh interval the refreshes are jittered by
+	DefaultPricingRefreshJitter = 0.1
+
+	// DefaultFlannelMaxPods is the max pods of the nodes in a cluster with Flannel
+	DefaultFlannelMaxPods = 256
+
+	// DefaultMaxConcurrentLaunches is the number of instance launches in flight at the same time
+	DefaultMaxConcurrentLaunches = 20
+	// DefaultLaunchTimeout is how long a launched instance may take to reach Running before it's deleted
+	DefaultLaunchTimeout = 10 * time.Minute
+	// DefaultQuotaWarningThreshold is the fraction of the vCPU quota used before the NodeClasses warn, 0 disables it
+	DefaultQuotaWarningThreshold = 0.0
+
+	// DefaultGarbageCollectionGracePeriod is how long a launched instance may go without a NodeClaim
+	DefaultGarbageCollectionGracePeriod = 30 * time.Second
+	// DefaultGarbageCollectionInterval is the interval between the garbage collections of the orphaned instances
+	DefaultGarbageCollectionInterval = time.Minute
+
+	// DefaultRepairNodeNotReadyToleration is how long a node may be NotReady before it's repaired
+	DefaultRepairNodeNotReadyToleration = 30 * time.Minute
+	// DefaultRepairNetworkUnavailableToleration is how long the network of a node may be unavailable before it's repaired
+	DefaultRepairNetworkUnavailableToleration = 30 * time.Minute
+	// DefaultRepairKubeletUnhealthyToleration is how long the kubelet of a node may be unhealthy before it's repaired
+	DefaultRepairKubeletUnhealthyToleration = 30 * time.Minute
 )
 
 func init() {
@@ -34,14 +87,55 @@ func init() {
 type optionsKey struct{}
 
 type Options struct {
-	ClusterID               string
-	RegionID                string
-	AliNetwork              string
-	VMMemoryOverheadPercent float64
-	Interruption            bool
-	TelemetryShare          bool
-	APGCreationQPS          int
-	ClusterType             string
+	ClusterID                            string
+	RegionID                             string
+	AliNetwork                           string
+	VMMemoryOverheadPercent              float64
+	Interruption                         bool
+	TelemetryShare                       bool
+	APGCreationQPS                       int
+	MaxConcurrentLaunches                int
+	LaunchBatchWindow                    time.Duration
+	ClusterType                          string
+	MinK8sVersion                        string
+	MaxK8sVersion                        string
+	InstanceTypeOfferingsRefreshInterval time.Duration
+	InstanceTypesCacheTTL                time.Duration
+	SoldOutOfferingsCooldown             time.Duration
+	InsufficientCapacityCooldown         time.Duration
+	InterruptionPollInterval             time.Duration
+	SecurityGroupDriftMode               string
+	ResourceGroupID                      string
+	CredentialRefreshWindow              time.Duration
+	ECSEndpoint                          string
+	VPCEndpoint                          string
+	ACKEndpoint                          string
+	PricingEndpoint                      string
+	APIQPS                               float64
+	APIRateLimits                        string
+	APIThrottlingMaxRetries              int
+	ClusterCNI                           string
+	ClusterEndpointAccess                string
+	ACKNodePoolID                        string
+	FlannelMaxPods                       int
+	AllowedInstanceFamilies              string
+	BlockedInstanceFamilies              string
+	InstanceFamilyWeights                string
+	PricingMode                          string
+	CommittedUseCoverage                 string
+	CommittedUseDiscount                 float64
+	PricingRefreshJitter                 float64
+	AccountErrorCooldown                 time.Duration
+	LaunchTimeout                        time.Duration
+	QuotaWarningThreshold                float64
+	GarbageCollectionGracePeriod         time.Duration
+	GarbageCollectionInterval            time.Duration
+	RepairNodeNotReadyToleration         time.Duration
+	RepairNetworkUnavailableToleration   time.Duration
+	RepairKubeletUnhealthyToleration     time.Duration
+	DryRun                               bool
+	OfferingPreflight                    bool
+	NodeClassTagSync                     bool
 }
 
 func (o *Options) AddFlags(fs *coreoptions.FlagSet) {
@@ -53,7 +147,122 @@ func (o *Options) AddFlags(fs *coreoptions.FlagSet) {
 	fs.BoolVar(&o.Interruption, "interruption", env.WithDefaultBool("INTERRUPTION", true), "Enable interruption handling.")
 	fs.BoolVar(&o.TelemetryShare, "telemetry-share", env.WithDefaultBool("TELEMETRY_SHARE", true), "Enable telemetry sharing.")
 	fs.IntVar(&o.APGCreationQPS, "apg-qps", int(env.WithDefaultInt64("APG_CREATION_QPS", 100)), "The QPS limit for creating AutoProvisionGroup.")
+	fs.IntVar(&o.MaxConcurrentLaunches, "max-concurrent-launches", int(env.WithDefaultInt64("MAX_CONCURRENT_LAUNCHES", DefaultMaxConcurrentLaunches)), "How many instance launches may be in flight at the same time, the other launches wait for one of them to finish. It keeps large scale-ups within the launch quotas of the account. Set it to 0 to not limit the launches.")
+	fs.DurationVar(&o.LaunchBatchWindow, "launch-batch-window", env.WithDefaultDuration("LAUNCH_BATCH_WINDOW", 0), "How long a launch waits for the launches of identical NodeClaims, so up to 100 of them are launched by a single auto provisioning group. If not set, every NodeClaim is launched by its own auto provisioning group.")
 	fs.StringVar(&o.ClusterType, "cluster-type", env.WithDefaultString("CLUSTER_TYPE", "ACKManaged"), "Type of cluster, which specifies the method to generate userdata. The default is ACKManaged, with an option for Custom configuration. If your cluster-type is not default or ACKManaged, you need to add taint(karpenter.sh/unregistered:NoExecute) before the node is ready")
+	fs.StringVar(&o.MinK8sVersion, "min-k8s-version", env.WithDefaultString("MIN_K8S_VERSION", ""), "Override the min supported kubernetes version. If not set, use the version tested by karpenter.")
+	fs.StringVar(&o.MaxK8sVersion, "max-k8s-version", env.WithDefaultString("MAX_K8S_VERSION", ""), "Override the max supported kubernetes version. If not set, use the version tested by karpenter.")
+	fs.DurationVar(&o.InstanceTypeOfferingsRefreshInterval, "instance-type-offerings-refresh-interval", env.WithDefaultDuration("INSTANCE_TYPE_OFFERINGS_REFRESH_INTERVAL", cache.InstanceTypeOfferingsRefreshInterval), "The interval to refresh the offerings of instance types in every zone.")
+	fs.DurationVar(&o.InstanceTypesCacheTTL, "instance-types-cache-ttl", env.WithDefaultDuration("INSTANCE_TYPES_CACHE_TTL", cache.InstanceTypesAndZonesTTL), "How long the instance types computed for a NodeClass and kubelet configuration are cached.")
+	fs.DurationVar(&o.SoldOutOfferingsCooldown, "sold-out-offerings-cooldown", env.WithDefaultDuration("SOLD_OUT_OFFERINGS_COOLDOWN", cache.SoldOutOfferingsTTL), "The duration an instance type reported as sold out in a zone is not launched again.")
+	fs.DurationVar(&o.InsufficientCapacityCooldown, "insufficient-capacity-cooldown", env.WithDefaultDuration("INSUFFICIENT_CAPACITY_COOLDOWN", cache.UnavailableOfferingsTTL), "The duration an offering which failed to launch because it's sold out is not launched again. A zero cooldown launches it again right away.")
+	fs.DurationVar(&o.InterruptionPollInterval, "interruption-poll-interval", env.WithDefaultDuration("INTERRUPTION_POLL_INTERVAL", 15*time.Second), "The interval to poll the spot instances launched by karpenter for their interruption.")
+	fs.StringVar(&o.ResourceGroupID, "resource-group-id", env.WithDefaultString("RESOURCE_GROUP_ID", ""), "The resource group to discover vSwitches and security groups in and to launch instances into. The resourceGroupId of an ECSNodeClass takes precedence. If not set, the whole account is used.")
+	fs.DurationVar(&o.CredentialRefreshWindow, "credential-refresh-window", env.WithDefaultDuration("CREDENTIAL_REFRESH_WINDOW", client.DefaultCredentialRefreshWindow), "How long before their expiration the temporary credentials of RRSA or the RAM role of the instance are refreshed.")
+	fs.StringVar(&o.ECSEndpoint, "ecs-endpoint", env.WithDefaultString("ECS_ENDPOINT", ""), "Override the endpoint of the ECS API. If not set, derive it from the region and the network.")
+	fs.StringVar(&o.VPCEndpoint, "vpc-endpoint", env.WithDefaultString("VPC_ENDPOINT", ""), "Override the endpoint of the VPC API. If not set, derive it from the region and the network.")
+	fs.StringVar(&o.ACKEndpoint, "ack-endpoint", env.WithDefaultString("ACK_ENDPOINT", ""), "Override the endpoint of the ACK API. If not set, derive it from the region and the network.")
+	fs.StringVar(&o.PricingEndpoint, "pricing-endpoint", env.WithDefaultString("PRICING_ENDPOINT", ""), "Override the endpoint of the pricing query server. If not set, use https://price.cloudpilot.ai.")
+	fs.Float64Var(&o.APIQPS, "api-qps", utils.WithDefaultFloat64("API_QPS", ratelimit.DefaultQPS), "The QPS limit of every AlibabaCloud API action without a limit in api-rate-limits.")
+	fs.StringVar(&o.APIRateLimits, "api-rate-limits", env.WithDefaultString("API_RATE_LIMITS", ""), "The QPS limits of the AlibabaCloud API actions, in the format of Action=QPS[,Action=QPS...], e.g. DescribeInstances=10,DescribeVSwitches=5.")
+	fs.IntVar(&o.APIThrottlingMaxRetries, "api-throttling-max-retries", int(env.WithDefaultInt64("API_THROTTLING_MAX_RETRIES", ratelimit.DefaultMaxRetries)), "How many times an AlibabaCloud API call throttled by AlibabaCloud is retried with backoff.")
+	fs.StringVar(&o.SecurityGroupDriftMode, "security-group-drift-mode", env.WithDefaultString("SECURITY_GROUP_DRIFT_MODE", SecurityGroupDriftModeStrict), "How security group drift is detected. With strict, an instance is drifted when its security groups differ from the resolved ones. With superset, security groups added to an instance out-of-band are ignored.")
+	fs.StringVar(&o.ClusterCNI, "cluster-cni", env.WithDefaultString("CLUSTER_CNI", ""), "Override the CNI of the cluster the pods capacity of the instance types is computed for, one of terway-eniip, Flannel. If not set, detect it from the cluster.")
+	fs.StringVar(&o.ClusterEndpointAccess, "cluster-endpoint-access", env.WithDefaultString("CLUSTER_ENDPOINT_ACCESS", ClusterEndpointAccessPrivate), "Which API server endpoint of the ACK cluster is discovered for the nodes to register with, one of private, public. The private endpoint is reachable from the VPC of the cluster only.")
+	fs.StringVar(&o.ACKNodePoolID, "ack-node-pool-id", env.WithDefaultString("ACK_NODE_POOL_ID", ""), "The ACK node pool the nodes of an ACK cluster are labeled with when they register, so the ACK addons scheduled by node pool, e.g. the CSI plugins and Terway, run on them. If not set, the nodes don't belong to a node pool.")
+	fs.IntVar(&o.FlannelMaxPods, "flannel-max-pods", int(env.WithDefaultInt64("FLANNEL_MAX_PODS", DefaultFlannelMaxPods)), "The pods capacity of the instance types in a cluster with Flannel, it should match the max pods of the pod CIDR of the nodes.")
+	fs.StringVar(&o.AllowedInstanceFamilies, "allowed-instance-families", env.WithDefaultString("ALLOWED_INSTANCE_FAMILIES", ""), "The instance families Karpenter is allowed to launch regardless of the NodePools, as comma separated globs or prefixes, e.g. ecs.g7,ecs.c*. If not set, all instance families are allowed.")
+	fs.StringVar(&o.BlockedInstanceFamilies, "blocked-instance-families", env.WithDefaultString("BLOCKED_INSTANCE_FAMILIES", ""), "The instance families Karpenter never launches regardless of the NodePools, as comma separated globs or prefixes, e.g. gn*. It takes precedence over allowed-instance-families.")
+	fs.StringVar(&o.InstanceFamilyWeights, "instance-family-weights", env.WithDefaultString("INSTANCE_FAMILY_WEIGHTS", ""), "The weights the prices of the instance families are multiplied by when the instance types are ranked, in the format of Family=Weight[,Family=Weight...], e.g. ecs.g8i=0.9,ecs.g6=1.2. A weight below 1 prefers the family over cheaper ones, the families without a weight keep their prices.")
+	fs.StringVar(&o.PricingMode, "pricing-mode", env.WithDefaultString("PRICING_MODE", PricingModeOnDemand), "How the on-demand instance types are priced. With on-demand, the on-demand prices are used. With committed-use, the prices of the instance families in committed-use-coverage are discounted until their committed instances are used up.")
+	fs.StringVar(&o.CommittedUseCoverage, "committed-use-coverage", env.WithDefaultString("COMMITTED_USE_COVERAGE", ""), "The instance families covered by reserved instances or savings plans and how many instances they cover, in the format of Family=Count[,Family=Count...], e.g. ecs.g7=10,ecs.c7=4. It only takes effect with the committed-use pricing mode.")
+	fs.Float64Var(&o.CommittedUseDiscount, "committed-use-discount", utils.WithDefaultFloat64("COMMITTED_USE_DISCOUNT", DefaultCommittedUseDiscount), "The fraction of the on-demand price saved by the instances covered by committed-use-coverage, between 0 and 1.")
+	fs.Float64Var(&o.PricingRefreshJitter, "pricing-refresh-jitter", utils.WithDefaultFloat64("PRICING_REFRESH_JITTER", DefaultPricingRefreshJitter), "The fraction of the pricing refresh interval the refreshes are randomly moved earlier or later by, between 0 and 1, so the replicas and the clusters don't query the pricing API at the same time. Set it to 0 to refresh on a fixed interval.")
+	fs.DurationVar(&o.AccountErrorCooldown, "account-error-cooldown", env.WithDefaultDuration("ACCOUNT_ERROR_COOLDOWN", cache.AccountErrorCooldown), "The duration the launches are paused after one failed with an account-level error, e.g. InsufficientBalance or Account.Arrearage. Set it to 0 to retry the launches right away.")
+	fs.DurationVar(&o.LaunchTimeout, "launch-timeout", env.WithDefaultDuration("LAUNCH_TIMEOUT", DefaultLaunchTimeout), "How long a launched instance may stay Pending or Starting before it's deleted, so its NodeClaim is launched again. Set it to 0 to wait for the instances indefinitely.")
+	fs.Float64Var(&o.QuotaWarningThreshold, "quota-warning-threshold", utils.WithDefaultFloat64("QUOTA_WARNING_THRESHOLD", DefaultQuotaWarningThreshold), "The fraction of the ECS vCPU quota of the region used, between 0 and 1, from which the QuotaAvailable condition of the NodeClasses turns False, e.g. 0.9 to warn once 90% of the quota is used. Set it to 0 to not report the condition.")
+	fs.DurationVar(&o.GarbageCollectionGracePeriod, "garbage-collection-grace-period", env.WithDefaultDuration("GARBAGE_COLLECTION_GRACE_PERIOD", DefaultGarbageCollectionGracePeriod), "How long after its launch an instance managed by Karpenter without a NodeClaim is garbage collected.")
+	fs.DurationVar(&o.GarbageCollectionInterval, "garbage-collection-interval", env.WithDefaultDuration("GARBAGE_COLLECTION_INTERVAL", DefaultGarbageCollectionInterval), "The interval to garbage collect the instances managed by Karpenter without a NodeClaim.")
+	fs.DurationVar(&o.RepairNodeNotReadyToleration, "repair-node-not-ready-toleration", env.WithDefaultDuration("REPAIR_NODE_NOT_READY_TOLERATION", DefaultRepairNodeNotReadyToleration), "How long a node may be NotReady or stop reporting its status before it's replaced by node repair. Set it to 0 to not repair the NotReady nodes.")
+	fs.DurationVar(&o.RepairNetworkUnavailableToleration, "repair-network-unavailable-toleration", env.WithDefaultDuration("REPAIR_NETWORK_UNAVAILABLE_TOLERATION", DefaultRepairNetworkUnavailableToleration), "How long the NetworkUnavailable condition of a node may be True, e.g. because the CNI failed to set up its ENIs, before it's replaced by node repair. Set it to 0 to not repair the nodes with an unavailable network.")
+	fs.DurationVar(&o.RepairKubeletUnhealthyToleration, "repair-kubelet-unhealthy-toleration", env.WithDefaultDuration("REPAIR_KUBELET_UNHEALTHY_TOLERATION", DefaultRepairKubeletUnhealthyToleration), "How long the KubeletUnhealthy condition reported by the node problem detector may be True before the node is replaced by node repair. Set it to 0 to not repair the nodes with an unhealthy kubelet.")
+	fs.BoolVar(&o.DryRun, "dry-run", env.WithDefaultBool("DRY_RUN", false), "Validate the launches with a dry run of RunInstances instead of launching instances, e.g. to check the permissions, the quotas and the resolved NodeClasses. Every launch fails with the result of its dry run.")
+	fs.BoolVar(&o.OfferingPreflight, "offering-preflight", env.WithDefaultBool("OFFERING_PREFLIGHT", false), "Only offer the instance types ECS currently reports as available in each zone of the NodeClasses, checked with DescribeAvailableResource calls per zone and cached shortly. It reduces the launches failing on sold out offerings at the cost of more API calls.")
+	fs.BoolVar(&o.NodeClassTagSync, "nodeclass-tag-sync", env.WithDefaultBool("NODECLASS_TAG_SYNC", false), "Sync the tags of the NodeClasses onto the running instances, the tags added to a NodeClass are added to its instances and the removed ones are removed. The tags reserved by Karpenter are never changed.")
+}
+
+// SplitList splits a comma separated option into its trimmed, non-empty items
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseCommittedUseCoverage parses the committed-use-coverage option into the number of instances covered per
+// instance family, the ecs. prefix of the families is optional
+func ParseCommittedUseCoverage(s string) (map[string]int, error) {
+	coverage := map[string]int{}
+	for _, item := range SplitList(s) {
+		family, value, ok := strings.Cut(item, "=")
+		family = strings.TrimSpace(family)
+		if !ok || family == "" {
+			return nil, fmt.Errorf("invalid committed use coverage %q, expected Family=Count", item)
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("invalid committed use coverage %q, count must be a positive integer", item)
+		}
+		if !strings.HasPrefix(family, "ecs.") {
+			family = "ecs." + family
+		}
+		coverage[family] += count
+	}
+	return coverage, nil
+}
+
+// ParseInstanceFamilyWeights parses the instance-family-weights option into the weight of the prices per instance
+// family, the ecs. prefix of the families is optional
+func ParseInstanceFamilyWeights(s string) (map[string]float64, error) {
+	weights := map[string]float64{}
+	for _, item := range SplitList(s) {
+		family, value, ok := strings.Cut(item, "=")
+		family = strings.TrimSpace(family)
+		if !ok || family == "" {
+			return nil, fmt.Errorf("invalid instance family weight %q, expected Family=Weight", item)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || !(weight > 0) || math.IsInf(weight, 1) {
+			return nil, fmt.Errorf("invalid instance family weight %q, weight must be a positive number", item)
+		}
+		if !strings.HasPrefix(family, "ecs.") {
+			family = "ecs." + family
+		}
+		weights[family] = weight
+	}
+	return weights, nil
+}
+
+// ResourceGroupID returns the resource group the AlibabaCloud API calls for the ECSNodeClass are scoped to,
+// the resource group of the ECSNodeClass takes precedence over the global one, empty means the whole account
+func ResourceGroupID(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass) string {
+	if nodeClass.Spec.ResourceGroupID != "" {
+		return nodeClass.Spec.ResourceGroupID
+	}
+	if o := FromContext(ctx); o != nil {
+		return o.ResourceGroupID
+	}
+	return ""
+}
+
+// RateLimiter returns the rate limiter of the AlibabaCloud API calls configured by the options
+func (o *Options) RateLimiter() *ratelimit.RateLimiter {
+	// the limits are validated when the options are parsed
+	limits, _ := ratelimit.ParseLimits(o.APIRateLimits)
+	return ratelimit.NewRateLimiter(limits, o.APIQPS, o.APIThrottlingMaxRetries)
 }
 
 func (o *Options) Parse(fs *coreoptions.FlagSet, args ...string) error {
@@ -16,15 +16,31 @@ package options
 
 import (
 	"fmt"
+	"path"
+	"regexp"
 
 	"go.uber.org/multierr"
 
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client/metadata"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
 )
 
+// ackNodePoolIDPattern matches the IDs of the ACK node pools, e.g. np1f6779297c4444a3a1cdd29be8e5a1b2
+var ackNodePoolIDPattern = regexp.MustCompile(`^np[0-9a-z]{32}$`)
+
 func (o *Options) Validate() error {
 	return multierr.Combine(
 		o.validateRequiredFields(),
+		o.validateOfferings(),
+		o.validateInterruption(),
+		o.validateSecurityGroupDriftMode(),
+		o.validateCredentialRefreshWindow(),
+		o.validateRateLimits(),
+		o.validateCNI(),
+		o.validateInstanceFamilies(),
+		o.validatePricing(),
+		o.validateGarbageCollection(),
+		o.validateRepair(),
 	)
 }
 
@@ -43,3 +59,135 @@ func (o *Options) validateRequiredFields() error {
 	}
 	return nil
 }
+
+func (o *Options) validateOfferings() error {
+	if o.InstanceTypeOfferingsRefreshInterval <= 0 {
+		return fmt.Errorf("instance-type-offerings-refresh-interval must be positive")
+	}
+	if o.InstanceTypesCacheTTL <= 0 {
+		return fmt.Errorf("instance-types-cache-ttl must be positive")
+	}
+	if o.SoldOutOfferingsCooldown < 0 {
+		return fmt.Errorf("sold-out-offerings-cooldown must not be negative")
+	}
+	if o.InsufficientCapacityCooldown < 0 {
+		return fmt.Errorf("insufficient-capacity-cooldown must not be negative")
+	}
+	if o.AccountErrorCooldown < 0 {
+		return fmt.Errorf("account-error-cooldown must not be negative")
+	}
+	if o.MaxConcurrentLaunches < 0 {
+		return fmt.Errorf("max-concurrent-launches must not be negative")
+	}
+	if o.LaunchBatchWindow < 0 {
+		return fmt.Errorf("launch-batch-window must not be negative")
+	}
+	if o.LaunchTimeout < 0 {
+		return fmt.Errorf("launch-timeout must not be negative")
+	}
+	if o.QuotaWarningThreshold < 0 || o.QuotaWarningThreshold > 1 {
+		return fmt.Errorf("quota-warning-threshold must be between 0 and 1")
+	}
+	return nil
+}
+
+func (o *Options) validateInterruption() error {
+	if o.Interruption && o.InterruptionPollInterval <= 0 {
+		return fmt.Errorf("interruption-poll-interval must be positive")
+	}
+	return nil
+}
+
+func (o *Options) validateSecurityGroupDriftMode() error {
+	if o.SecurityGroupDriftMode != SecurityGroupDriftModeStrict && o.SecurityGroupDriftMode != SecurityGroupDriftModeSuperset {
+		return fmt.Errorf("security-group-drift-mode must be one of %s, %s", SecurityGroupDriftModeStrict, SecurityGroupDriftModeSuperset)
+	}
+	return nil
+}
+
+func (o *Options) validateCredentialRefreshWindow() error {
+	if o.CredentialRefreshWindow < 0 {
+		return fmt.Errorf("credential-refresh-window must not be negative")
+	}
+	return nil
+}
+
+func (o *Options) validateRateLimits() error {
+	if o.APIQPS <= 0 {
+		return fmt.Errorf("api-qps must be positive")
+	}
+	if _, err := ratelimit.ParseLimits(o.APIRateLimits); err != nil {
+		return fmt.Errorf("api-rate-limits, %w", err)
+	}
+	if o.APIThrottlingMaxRetries < 0 {
+		return fmt.Errorf("api-throttling-max-retries must not be negative")
+	}
+	return nil
+}
+
+func (o *Options) validateCNI() error {
+	if o.ClusterCNI != "" && o.ClusterCNI != ClusterCNITerway && o.ClusterCNI != ClusterCNIFlannel {
+		return fmt.Errorf("cluster-cni must be one of %s, %s", ClusterCNITerway, ClusterCNIFlannel)
+	}
+	if o.ClusterEndpointAccess != ClusterEndpointAccessPrivate && o.ClusterEndpointAccess != ClusterEndpointAccessPublic {
+		return fmt.Errorf("cluster-endpoint-access must be one of %s, %s", ClusterEndpointAccessPrivate, ClusterEndpointAccessPublic)
+	}
+	if o.FlannelMaxPods <= 0 {
+		return fmt.Errorf("flannel-max-pods must be positive")
+	}
+	if o.ACKNodePoolID != "" && !ackNodePoolIDPattern.MatchString(o.ACKNodePoolID) {
+		return fmt.Errorf("invalid ack-node-pool-id %q, expected np followed by 32 lowercase letters or digits", o.ACKNodePoolID)
+	}
+	return nil
+}
+
+func (o *Options) validateInstanceFamilies() error {
+	for _, pattern := range append(SplitList(o.AllowedInstanceFamilies), SplitList(o.BlockedInstanceFamilies)...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid instance family pattern %q, %w", pattern, err)
+		}
+	}
+	if _, err := ParseInstanceFamilyWeights(o.InstanceFamilyWeights); err != nil {
+		return fmt.Errorf("instance-family-weights, %w", err)
+	}
+	return nil
+}
+
+func (o *Options) validatePricing() error {
+	if o.PricingMode != PricingModeOnDemand && o.PricingMode != PricingModeCommittedUse {
+		return fmt.Errorf("pricing-mode must be one of %s, %s", PricingModeOnDemand, PricingModeCommittedUse)
+	}
+	if _, err := ParseCommittedUseCoverage(o.CommittedUseCoverage); err != nil {
+		return fmt.Errorf("committed-use-coverage, %w", err)
+	}
+	if o.CommittedUseDiscount < 0 || o.CommittedUseDiscount > 1 {
+		return fmt.Errorf("committed-use-discount must be between 0 and 1")
+	}
+	if o.PricingRefreshJitter < 0 || o.PricingRefreshJitter >= 1 {
+		return fmt.Errorf("pricing-refresh-jitter must be at least 0 and less than 1")
+	}
+	return nil
+}
+
+func (o *Options) validateGarbageCollection() error {
+	if o.GarbageCollectionGracePeriod < 0 {
+		return fmt.Errorf("garbage-collection-grace-period must not be negative")
+	}
+	if o.GarbageCollectionInterval <= 0 {
+		return fmt.Errorf("garbage-collection-interval must be positive")
+	}
+	return nil
+}
+
+func (o *Options) validateRepair() error {
+	if o.RepairNodeNotReadyToleration < 0 {
+		return fmt.Errorf("repair-node-not-ready-toleration must not be negative")
+	}
+	if o.RepairNetworkUnavailableToleration < 0 {
+		return fmt.Errorf("repair-network-unavailable-toleration must not be negative")
+	}
+	if o.RepairKubeletUnhealthyToleration < 0 {
+		return fmt.Errorf("repair-kubelet-unhealthy-toleration must not be negative")
+	}
+	return nil
+}
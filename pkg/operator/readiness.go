@@ -0,0 +1,52 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// syncer is a provider which caches the data it refreshes from AlibabaCloud
+type syncer interface {
+	SyncedAtLeastOnce() bool
+}
+
+// providersSynced reports not ready until every provider has refreshed its cache at least once, so that the first
+// scheduling decisions aren't made without offerings or with the static prices. The providers are only refreshed by
+// the controllers of the leader, so a replica which is not elected is ready.
+func providersSynced(elected <-chan struct{}, providers map[string]syncer) healthz.Checker {
+	names := lo.Keys(providers)
+	sort.Strings(names)
+	return func(_ *http.Request) error {
+		select {
+		case <-elected:
+		default:
+			return nil
+		}
+		for _, name := range names {
+			if !providers[name].SyncedAtLeastOnce() {
+				return fmt.Errorf("%s provider has not synced yet", name)
+			}
+		}
+		return nil
+	}
+}
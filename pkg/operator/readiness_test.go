@@ -0,0 +1,43 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSyncer bool
+
+func (f *fakeSyncer) SyncedAtLeastOnce() bool { return bool(*f) }
+
+func TestProvidersSynced(t *testing.T) {
+	instanceTypes, pricing := new(fakeSyncer), new(fakeSyncer)
+	elected := make(chan struct{})
+	check := providersSynced(elected, map[string]syncer{"instancetype": instanceTypes, "pricing": pricing})
+
+	// the replicas on standby don't refresh the providers
+	assert.NoError(t, check(nil))
+
+	close(elected)
+	assert.EqualError(t, check(nil), "instancetype provider has not synced yet")
+	*instanceTypes = true
+	assert.EqualError(t, check(nil), "pricing provider has not synced yet")
+	*pricing = true
+	assert.NoError(t, check(nil))
+}
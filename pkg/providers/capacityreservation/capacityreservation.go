@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityreservation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/mitchellh/hashstructure/v2"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/karpenter/pkg/utils/pretty"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
+)
+
+// StatusActive is the status of the capacity reservations instances can be launched into
+const StatusActive = "Active"
+
+type Provider interface {
+	List(context.Context, *v1alpha1.ECSNodeClass) ([]v1alpha1.CapacityReservation, error)
+}
+
+type DefaultProvider struct {
+	sync.Mutex
+	region      string
+	ecsapi      client.ECSClient
+	rateLimiter *ratelimit.RateLimiter
+	cache       *cache.Cache
+	cm          *pretty.ChangeMonitor
+}
+
+func NewDefaultProvider(region string, ecsapi client.ECSClient, rateLimiter *ratelimit.RateLimiter, cache *cache.Cache) *DefaultProvider {
+	return &DefaultProvider{
+		region:      region,
+		ecsapi:      ecsapi,
+		rateLimiter: rateLimiter,
+		cache:       cache,
+		cm:          pretty.NewChangeMonitor(),
+	}
+}
+
+// List returns the active capacity reservations matched by the capacity reservation selector terms, one per
+// instance type and zone they reserve
+func (p *DefaultProvider) List(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass) ([]v1alpha1.CapacityReservation, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	filterSets := getFilterSets(nodeClass.Spec.CapacityReservationSelectorTerms, options.ResourceGroupID(ctx, nodeClass))
+	if len(filterSets) == 0 {
+		return nil, nil
+	}
+	capacityReservations, err := p.getCapacityReservations(ctx, filterSets)
+	if err != nil {
+		return nil, err
+	}
+	if p.cm.HasChanged(fmt.Sprintf("capacity-reservations/%s", nodeClass.Name), capacityReservations) {
+		log.FromContext(ctx).
+			WithValues("capacity-reservations", lo.Uniq(lo.Map(capacityReservations, func(cr v1alpha1.CapacityReservation, _ int) string {
+				return cr.ID
+			}))).
+			V(1).Info("discovered capacity reservations")
+	}
+	return capacityReservations, nil
+}
+
+func (p *DefaultProvider) getCapacityReservations(ctx context.Context, filterSets []*ecs.DescribeCapacityReservationsRequest) ([]v1alpha1.CapacityReservation, error) {
+	hash, err := hashstructure.Hash(filterSets, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
+	if err != nil {
+		return nil, err
+	}
+	if crs, ok := p.cache.Get(fmt.Sprint(hash)); ok {
+		return append([]v1alpha1.CapacityReservation{}, crs.([]v1alpha1.CapacityReservation)...), nil
+	}
+	var capacityReservations []v1alpha1.CapacityReservation
+	for _, filter := range filterSets {
+		if err := p.describeCapacityReservations(ctx, filter, func(item *ecs.DescribeCapacityReservationsResponseBodyCapacityReservationSetCapacityReservationItem) {
+			capacityReservations = append(capacityReservations, capacityReservationsFromItem(item)...)
+		}); err != nil {
+			return nil, fmt.Errorf("describing capacity reservations %+v, %w", filter, err)
+		}
+	}
+	capacityReservations = lo.UniqBy(capacityReservations, func(cr v1alpha1.CapacityReservation) string {
+		return fmt.Sprintf("%s/%s/%s", cr.ID, cr.InstanceType, cr.ZoneID)
+	})
+	sort.Slice(capacityReservations, func(i, j int) bool {
+		if capacityReservations[i].ID != capacityReservations[j].ID {
+			return capacityReservations[i].ID < capacityReservations[j].ID
+		}
+		if capacityReservations[i].InstanceType != capacityReservations[j].InstanceType {
+			return capacityReservations[i].InstanceType < capacityReservations[j].InstanceType
+		}
+		return capacityReservations[i].ZoneID < capacityReservations[j].ZoneID
+	})
+	p.cache.SetDefault(fmt.Sprint(hash), capacityReservations)
+	return append([]v1alpha1.CapacityReservation{}, capacityReservations...), nil
+}
+
+// capacityReservationsFromItem flattens a capacity reservation into the instance types and zones it reserves
+func capacityReservationsFromItem(item *ecs.DescribeCapacityReservationsResponseBodyCapacityReservationSetCapacityReservationItem) []v1alpha1.CapacityReservation {
+	if item == nil || tea.StringValue(item.PrivatePoolOptionsId) == "" || item.AllocatedResources == nil {
+		return nil
+	}
+	var capacityReservations []v1alpha1.CapacityReservation
+	for _, resource := range item.AllocatedResources.AllocatedResource {
+		if resource == nil || tea.StringValue(resource.InstanceType) == "" || tea.StringValue(resource.ZoneId) == "" {
+			continue
+		}
+		capacityReservations = append(capacityReservations, v1alpha1.CapacityReservation{
+			ID:                     tea.StringValue(item.PrivatePoolOptionsId),
+			InstanceType:           tea.StringValue(resource.InstanceType),
+			ZoneID:                 tea.StringValue(resource.ZoneId),
+			AvailableInstanceCount: tea.Int32Value(resource.AvailableAmount),
+		})
+	}
+	return capacityReservations
+}
+
+func (p *DefaultProvider) describeCapacityReservations(ctx context.Context, request *ecs.DescribeCapacityReservationsRequest,
+	process func(*ecs.DescribeCapacityReservationsResponseBodyCapacityReservationSetCapacityReservationItem)) error {
+	runtime := &util.RuntimeOptions{}
+	request.RegionId = tea.String(p.region)
+	request.Status = tea.String(StatusActive)
+	request.MaxResults = tea.Int32(100)
+	for {
+		output, err := ratelimit.Call(ctx, p.rateLimiter, "DescribeCapacityReservations", func() (*ecs.DescribeCapacityReservationsResponse, error) {
+			return p.ecsapi.DescribeCapacityReservationsWithOptions(request, runtime)
+		})
+		if err != nil {
+			return err
+		} else if output == nil || output.Body == nil {
+			return fmt.Errorf("unexpected null value was returned")
+		} else if output.Body.CapacityReservationSet == nil {
+			return alierrors.WithRequestID(tea.StringValue(output.Body.RequestId), fmt.Errorf("unexpected null value was returned"))
+		}
+
+		for i := range output.Body.CapacityReservationSet.CapacityReservationItem {
+			process(output.Body.CapacityReservationSet.CapacityReservationItem[i])
+		}
+		request.NextToken = output.Body.NextToken
+		if request.NextToken == nil || *request.NextToken == "" || len(output.Body.CapacityReservationSet.CapacityReservationItem) == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+func getFilterSets(terms []v1alpha1.CapacityReservationSelectorTerm, resourceGroupID string) []*ecs.DescribeCapacityReservationsRequest {
+	var filterSets []*ecs.DescribeCapacityReservationsRequest
+	for _, term := range terms {
+		if term.ID != "" {
+			// The ids are passed to the API as a JSON array
+			ids, _ := json.Marshal([]string{term.ID})
+			filterSets = append(filterSets, &ecs.DescribeCapacityReservationsRequest{
+				PrivatePoolOptions: &ecs.DescribeCapacityReservationsRequestPrivatePoolOptions{Ids: tea.String(string(ids))},
+			})
+			continue
+		}
+
+		var tags []*ecs.DescribeCapacityReservationsRequestTag
+		for k, v := range term.Tags {
+			tag := &ecs.DescribeCapacityReservationsRequestTag{Key: tea.String(k)}
+			if v != "*" {
+				tag.Value = tea.String(v)
+			}
+			tags = append(tags, tag)
+		}
+		filterSets = append(filterSets, &ecs.DescribeCapacityReservationsRequest{Tag: tags})
+	}
+
+	if resourceGroupID != "" {
+		for _, filterSet := range filterSets {
+			filterSet.ResourceGroupId = tea.String(resourceGroupID)
+		}
+	}
+	return filterSets
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityreservation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	kcache "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+)
+
+func TestList(t *testing.T) {
+	var queries []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		query := map[string]string{}
+		for k := range r.URL.Query() {
+			query[k] = r.URL.Query().Get(k)
+		}
+		queries = append(queries, query)
+		if query["PrivatePoolOptions.Ids"] != "" {
+			fmt.Fprint(w, `{"RequestId":"r","CapacityReservationSet":{"CapacityReservationItem":[{"PrivatePoolOptionsId":"crp-2",`+
+				`"AllocatedResources":{"AllocatedResource":[{"InstanceType":"ecs.g7.large","zoneId":"cn-hangzhou-i","AvailableAmount":3}]}}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"RequestId":"r","CapacityReservationSet":{"CapacityReservationItem":[{"PrivatePoolOptionsId":"crp-2",`+
+			`"AllocatedResources":{"AllocatedResource":[{"InstanceType":"ecs.g7.large","zoneId":"cn-hangzhou-i","AvailableAmount":3}]}},`+
+			`{"PrivatePoolOptionsId":"crp-1","AllocatedResources":{"AllocatedResource":[`+
+			`{"InstanceType":"ecs.g7.large","zoneId":"cn-hangzhou-j","AvailableAmount":1},`+
+			`{"InstanceType":"ecs.c7.large","zoneId":"cn-hangzhou-j","AvailableAmount":0}]}}]}}`)
+	}))
+	t.Cleanup(server.Close)
+	ecsClient, err := ecs.NewClient(&openapi.Config{
+		AccessKeyId:     tea.String("ak"),
+		AccessKeySecret: tea.String("sk"),
+		RegionId:        tea.String("cn-hangzhou"),
+		Endpoint:        tea.String(strings.TrimPrefix(server.URL, "http://")),
+		Protocol:        tea.String("http"),
+	})
+	require.NoError(t, err)
+
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	p := NewDefaultProvider("cn-hangzhou", ecsClient, nil, cache.New(kcache.DefaultTTL, kcache.DefaultCleanupInterval))
+	nodeClass := &v1alpha1.ECSNodeClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: v1alpha1.ECSNodeClassSpec{CapacityReservationSelectorTerms: []v1alpha1.CapacityReservationSelectorTerm{
+			{ID: "crp-2"},
+			{Tags: map[string]string{"karpenter.sh/discovery": "*"}},
+		}},
+	}
+	capacityReservations, err := p.List(ctx, nodeClass)
+	require.NoError(t, err)
+	// overlapping terms are deduplicated and every reserved instance type and zone is an entry
+	assert.Equal(t, []v1alpha1.CapacityReservation{
+		{ID: "crp-1", InstanceType: "ecs.c7.large", ZoneID: "cn-hangzhou-j"},
+		{ID: "crp-1", InstanceType: "ecs.g7.large", ZoneID: "cn-hangzhou-j", AvailableInstanceCount: 1},
+		{ID: "crp-2", InstanceType: "ecs.g7.large", ZoneID: "cn-hangzhou-i", AvailableInstanceCount: 3},
+	}, capacityReservations)
+
+	require.Len(t, queries, 2)
+	assert.Equal(t, `["crp-2"]`, queries[0]["PrivatePoolOptions.Ids"])
+	assert.Equal(t, StatusActive, queries[0]["Status"])
+	assert.Equal(t, "karpenter.sh/discovery", queries[1]["Tag.1.Key"])
+	assert.NotContains(t, queries[1], "Tag.1.Value")
+
+	// the capacity reservations are cached
+	_, err = p.List(ctx, nodeClass)
+	require.NoError(t, err)
+	assert.Len(t, queries, 2)
+
+	capacityReservations, err = p.List(ctx, &v1alpha1.ECSNodeClass{})
+	assert.NoError(t, err)
+	assert.Empty(t, capacityReservations)
+}
@@ -17,9 +17,7 @@ limitations under the License.
 package cluster
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -33,33 +31,41 @@ import (
 	"github.com/alibabacloud-go/tea/tea"
 	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
-	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
 
-	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/imagefamily/bootstrap"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
 )
 
 const (
 	ackManagedClusterType = "ACKManaged"
-	defaultNodeLabel      = "k8s.aliyun.com=true"
 )
 
 type ACKManaged struct {
 	clusterID string
 	region    string
-	ackClient *ackclient.Client
+	ackClient client.ACKClient
+	// kubernetesInterface reads the expiration of the registration tokens, it's optional
+	kubernetesInterface kubernetes.Interface
+	clk                 clock.Clock
 
 	muClusterCNI sync.RWMutex
 	clusterCNI   string
 	cache        *cache.Cache
 }
 
-func NewACKManaged(clusterID string, region string, ackClient *ackclient.Client, cache *cache.Cache) *ACKManaged {
+func NewACKManaged(clusterID string, region string, ackClient client.ACKClient, kubernetesInterface kubernetes.Interface, cache *cache.Cache) *ACKManaged {
 	return &ACKManaged{
-		clusterID: clusterID,
-		region:    region,
-		ackClient: ackClient,
-		cache:     cache,
+		clusterID:           clusterID,
+		region:              region,
+		ackClient:           ackClient,
+		kubernetesInterface: kubernetesInterface,
+		clk:                 clock.RealClock{},
+		cache:               cache,
 	}
 }
 
@@ -138,30 +144,49 @@ func (a *ACKManaged) GetSupportedImages(k8sVersion string) ([]Image, error) {
 	}), nil
 }
 
-func (a *ACKManaged) UserData(ctx context.Context,
-	labels map[string]string,
-	taints []corev1.Taint,
-	kubeletCfg *v1alpha1.KubeletConfiguration,
-	userData *string,
-	formatDataDisk bool) (string, error) {
-
-	attach, err := a.getClusterAttachScripts(formatDataDisk, ctx)
+func (a *ACKManaged) UserData(ctx context.Context, opts UserDataOptions) (string, error) {
+	attach, err := a.getClusterAttachScripts(opts.FormatDataDisk, ctx)
+	if err != nil {
+		// The node can't register without the token of the attach script, the launch fails with a reason the user can act on
+		return "", cloudprovider.NewCreateError(fmt.Errorf("getting cluster attach script, %w", err), errCodeRegistrationTokenUnavailable,
+			fmt.Sprintf("Failed to get the node registration token of cluster %s, %s", a.clusterID, err))
+	}
+	ackScript, err := bootstrap.ACK{
+		Options: bootstrap.Options{
+			ClusterID:     a.clusterID,
+			AttachScript:  attach,
+			KubeletConfig: opts.KubeletConfig,
+			Labels:        opts.Labels,
+			Taints:        opts.Taints,
+			Hostname:      opts.Hostname,
+			DNS:           opts.DNS,
+			NodePoolID:    ackNodePoolID(ctx),
+			TerwayConfig:  opts.TerwayConfig,
+		},
+	}.Script()
 	if err != nil {
 		return "", err
 	}
-	ackScript := a.ackBootstrap(attach, labels, taints, kubeletCfg)
 	cloudInit := NewCloudInit()
 
 	if err := cloudInit.Merge(&ackScript); err != nil {
 		return "", err
 	}
-	if err := cloudInit.Merge(userData); err != nil {
+	if err := cloudInit.Merge(opts.UserData); err != nil {
 		return "", err
 	}
 
 	return cloudInit.Script()
 }
 
+// ackNodePoolID returns the ACK node pool the nodes are labeled with, empty when it's not configured
+func ackNodePoolID(ctx context.Context) string {
+	if o := options.FromContext(ctx); o != nil {
+		return o.ACKNodePoolID
+	}
+	return ""
+}
+
 func (a *ACKManaged) FeatureFlags() FeatureFlags {
 	if cni, err := a.GetClusterCNI(context.TODO()); err == nil && cni == ClusterCNITypeFlannel {
 		return FeatureFlags{
@@ -175,9 +200,11 @@ func (a *ACKManaged) FeatureFlags() FeatureFlags {
 	}
 }
 
+// getClusterAttachScripts returns the attach script of the cluster, it's cached until the registration token it embeds
+// is about to expire, so the nodes aren't launched with a token expiring before they register
 func (a *ACKManaged) getClusterAttachScripts(formatDataDisk bool, ctx context.Context) (string, error) {
-	if cachedScript, ok := a.cache.Get(a.clusterID); ok {
-		return cachedScript.(string), nil
+	if cached, ok := a.cache.Get(a.clusterID); ok && !cached.(*attachScript).expiring(a.clk.Now()) {
+		return cached.(*attachScript).script, nil
 	}
 
 	reqPara := &ackclient.DescribeClusterAttachScriptsRequest{
@@ -207,7 +234,11 @@ func (a *ACKManaged) getClusterAttachScripts(formatDataDisk bool, ctx context.Co
 			respStr, fmt.Sprintf(" --runtime %s --runtime-version %s", runtime, runtimeVersion))
 	}
 
-	a.cache.SetDefault(a.clusterID, respStr)
+	script := &attachScript{script: respStr, expiration: a.registrationTokenExpiration(ctx, respStr)}
+	if script.expiring(a.clk.Now()) {
+		log.FromContext(ctx).Info("the registration token of the attach script is about to expire", "expiration", script.expiration)
+	}
+	a.cache.SetDefault(a.clusterID, script)
 	return respStr, nil
 }
 
@@ -259,59 +290,3 @@ func (a *ACKManaged) getClusterAttachRuntimeConfiguration(ctx context.Context) (
 	return tea.StringValue(targetNodepool.KubernetesConfig.Runtime),
 		tea.StringValue(targetNodepool.KubernetesConfig.RuntimeVersion), nil
 }
-
-func (a *ACKManaged) ackBootstrap(respStr string, labels map[string]string, taints []corev1.Taint,
-	kubeletCfg *v1alpha1.KubeletConfiguration) string {
-
-	var script bytes.Buffer
-	// Add bash script header
-	script.WriteString("#!/bin/bash\n\n")
-
-	// Clean up the input string
-	script.WriteString(respStr + " ")
-	// Add labels
-	script.WriteString(fmt.Sprintf("--labels %s ", a.formatLabels(labels)))
-	// Add kubelet config
-	cfg := convertNodeClassKubeletConfigToACKNodeConfig(kubeletCfg)
-	script.WriteString(fmt.Sprintf("--node-config %s ", cfg))
-	// Add taints
-	script.WriteString(fmt.Sprintf("--taints %s\n\n", a.formatTaints(taints)))
-
-	return script.String()
-}
-
-func (a *ACKManaged) formatLabels(labels map[string]string) string {
-	labelsFormatted := fmt.Sprintf("%s,ack.aliyun.com=%s", defaultNodeLabel, a.clusterID)
-	for key, value := range labels {
-		labelsFormatted = fmt.Sprintf("%s,%s=%s", labelsFormatted, key, value)
-	}
-	return labelsFormatted
-}
-
-func (a *ACKManaged) formatTaints(taints []corev1.Taint) string {
-	return strings.Join(lo.Map(taints, func(t corev1.Taint, _ int) string {
-		return t.ToString()
-	}), ",")
-}
-
-type NodeConfig struct {
-	KubeletConfig *ACKKubeletConfig `json:"kubelet_config,omitempty"`
-}
-
-type ACKKubeletConfig struct {
-	MaxPods *int32 `json:"maxPods,omitempty"`
-}
-
-func convertNodeClassKubeletConfigToACKNodeConfig(kubeletCfg *v1alpha1.KubeletConfiguration) string {
-	cfg := &NodeConfig{
-		KubeletConfig: &ACKKubeletConfig{
-			MaxPods: kubeletCfg.MaxPods,
-		},
-	}
-
-	data, err := json.Marshal(cfg)
-	if err != nil {
-		return base64.StdEncoding.EncodeToString([]byte("{}"))
-	}
-	return base64.StdEncoding.EncodeToString(data)
-}
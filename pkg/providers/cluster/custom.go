@@ -19,9 +19,7 @@ package cluster
 import (
 	"context"
 	"encoding/base64"
-	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
 	"github.com/samber/lo"
-	corev1 "k8s.io/api/core/v1"
 	"net/http"
 )
 
@@ -34,8 +32,8 @@ func NewCustom() *Custom {
 	return &Custom{}
 }
 
-func (c *Custom) UserData(ctx context.Context, labels map[string]string, taints []corev1.Taint, configuration *v1alpha1.KubeletConfiguration, userData *string, formatDataDisk bool) (string, error) {
-	return base64.StdEncoding.EncodeToString([]byte(lo.FromPtr(userData))), nil
+func (c *Custom) UserData(ctx context.Context, opts UserDataOptions) (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(lo.FromPtr(opts.UserData))), nil
 }
 
 func (c *Custom) GetClusterCNI(ctx context.Context) (string, error) {
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	ackclient "github.com/alibabacloud-go/cs-20151215/v5/client"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/samber/lo"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+)
+
+// kubeconfigDurationMinutes is the shortest validity of the kubeconfig DescribeClusterUserKubeconfig accepts,
+// only the endpoint and the CA are read from it, the credentials it carries are dropped right away
+const kubeconfigDurationMinutes = 15
+
+// Endpoint is the API server endpoint of a cluster and the CA the API server is served with,
+// the images registered without the attach script need both in their userdata
+type Endpoint struct {
+	// Server is the URL of the API server, e.g. https://192.168.0.1:6443
+	Server string
+	// CAData is the base64 encoded PEM of the cluster CA
+	CAData string
+}
+
+// Endpoint discovers the API server endpoint and the CA of the cluster from its kubeconfig, the private endpoint
+// is used unless the cluster-endpoint-access option selects the public one, the result is cached
+func (a *ACKManaged) Endpoint(ctx context.Context) (*Endpoint, error) {
+	public := lo.FromPtr(options.FromContext(ctx)).ClusterEndpointAccess == options.ClusterEndpointAccessPublic
+	key := fmt.Sprintf("endpoint/%s/%t", a.clusterID, public)
+	if cached, ok := a.cache.Get(key); ok {
+		return cached.(*Endpoint), nil
+	}
+
+	resp, err := a.ackClient.DescribeClusterUserKubeconfig(tea.String(a.clusterID), &ackclient.DescribeClusterUserKubeconfigRequest{
+		PrivateIpAddress:         tea.Bool(!public),
+		TemporaryDurationMinutes: tea.Int64(kubeconfigDurationMinutes),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing cluster user kubeconfig, %w", err)
+	}
+	if resp == nil || resp.Body == nil || tea.StringValue(resp.Body.Config) == "" {
+		return nil, fmt.Errorf("empty cluster user kubeconfig")
+	}
+	endpoint, err := parseEndpoint(tea.StringValue(resp.Body.Config))
+	if err != nil {
+		return nil, err
+	}
+
+	a.cache.SetDefault(key, endpoint)
+	return endpoint, nil
+}
+
+// parseEndpoint reads the server and the CA of the current context of a kubeconfig, falling back to its only cluster
+func parseEndpoint(kubeconfig string) (*Endpoint, error) {
+	config, err := clientcmd.Load([]byte(kubeconfig))
+	if err != nil {
+		return nil, fmt.Errorf("parsing cluster user kubeconfig, %w", err)
+	}
+	clusterName := ""
+	if kubeContext, ok := config.Contexts[config.CurrentContext]; ok {
+		clusterName = kubeContext.Cluster
+	} else if len(config.Clusters) == 1 {
+		clusterName = lo.Keys(config.Clusters)[0]
+	}
+	cluster, ok := config.Clusters[clusterName]
+	if !ok || cluster.Server == "" {
+		return nil, fmt.Errorf("no cluster server found in cluster user kubeconfig")
+	}
+	if len(cluster.CertificateAuthorityData) == 0 {
+		return nil, fmt.Errorf("no certificate authority data found in cluster user kubeconfig")
+	}
+	return &Endpoint{
+		Server: cluster.Server,
+		CAData: base64.StdEncoding.EncodeToString(cluster.CertificateAuthorityData),
+	}, nil
+}
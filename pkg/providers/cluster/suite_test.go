@@ -19,15 +19,33 @@ package cluster
 import (
 	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"mime"
 	"strings"
 	"testing"
+	"time"
 
+	ackclient "github.com/alibabacloud-go/cs-20151215/v5/client"
+	"github.com/alibabacloud-go/tea/tea"
 	awsmime "github.com/aws/karpenter-provider-aws/pkg/providers/amifamily/bootstrap/mime"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
 	. "sigs.k8s.io/karpenter/pkg/utils/testing"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
 )
 
 var ctx context.Context
@@ -317,3 +335,195 @@ echo 'world'
 		})
 	})
 })
+
+// fakeACKClient replies to DescribeClusterDetail with the cluster metadata, to DescribeClusterUserKubeconfig
+// with the kubeconfig and to DescribeClusterAttachScripts with a script embedding a new token each time
+type fakeACKClient struct {
+	client.ACKClient
+	metadata           string
+	kubeconfig         string
+	calls              int
+	kubeconfigRequests []*ackclient.DescribeClusterUserKubeconfigRequest
+	attachScriptCalls  int
+	attachScriptErr    error
+}
+
+func (f *fakeACKClient) DescribeClusterAttachScripts(_ *string, _ *ackclient.DescribeClusterAttachScriptsRequest) (*ackclient.DescribeClusterAttachScriptsResponse, error) {
+	if f.attachScriptErr != nil {
+		return nil, f.attachScriptErr
+	}
+	f.attachScriptCalls++
+	return &ackclient.DescribeClusterAttachScriptsResponse{Body: tea.String(fmt.Sprintf(
+		"curl http://aliacs-k8s-cn-hangzhou.oss-cn-hangzhou.aliyuncs.com/attach_node.sh | bash -s -- --token tkn00%d.0123456789abcdef --endpoint 192.168.0.1:6443", f.attachScriptCalls))}, nil
+}
+
+func (f *fakeACKClient) DescribeClusterNodePools(_ *string, _ *ackclient.DescribeClusterNodePoolsRequest) (*ackclient.DescribeClusterNodePoolsResponse, error) {
+	return nil, errors.New("node pools aren't described")
+}
+
+// attachUserData returns the decoded userdata of a node of the cluster
+func attachUserData(ack *ACKManaged) (string, error) {
+	userData, err := ack.UserData(ctx, UserDataOptions{KubeletConfig: &v1alpha1.KubeletConfiguration{}})
+	if err != nil {
+		return "", err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(userData)
+	return string(decoded), err
+}
+
+// bootstrapTokenSecret is the bootstrap token secret of the token ID expiring at the expiration
+func bootstrapTokenSecret(tokenID string, expiration time.Time) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-" + tokenID, Namespace: "kube-system"},
+		Data:       map[string][]byte{"expiration": []byte(expiration.Format(time.RFC3339))},
+	}
+}
+
+func (f *fakeACKClient) DescribeClusterDetail(clusterID *string) (*ackclient.DescribeClusterDetailResponse, error) {
+	f.calls++
+	return &ackclient.DescribeClusterDetailResponse{Body: &ackclient.DescribeClusterDetailResponseBody{
+		ClusterId: clusterID,
+		MetaData:  tea.String(f.metadata),
+	}}, nil
+}
+
+func (f *fakeACKClient) DescribeClusterUserKubeconfig(_ *string, request *ackclient.DescribeClusterUserKubeconfigRequest) (*ackclient.DescribeClusterUserKubeconfigResponse, error) {
+	f.kubeconfigRequests = append(f.kubeconfigRequests, request)
+	server := "https://47.0.0.1:6443"
+	if tea.BoolValue(request.PrivateIpAddress) {
+		server = "https://192.168.0.1:6443"
+	}
+	return &ackclient.DescribeClusterUserKubeconfigResponse{Body: &ackclient.DescribeClusterUserKubeconfigResponseBody{
+		Config: tea.String(strings.ReplaceAll(f.kubeconfig, "SERVER", server)),
+	}}, nil
+}
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: kubernetes
+  cluster:
+    server: SERVER
+    certificate-authority-data: Y2EtZGF0YQ==
+contexts:
+- name: admin@kubernetes
+  context:
+    cluster: kubernetes
+    user: admin
+current-context: admin@kubernetes
+users:
+- name: admin
+  user:
+    client-certificate-data: Y2VydA==
+    client-key-data: a2V5
+`
+
+var _ = Describe("ACKManaged", func() {
+	It("should detect the cluster CNI once", func() {
+		ackClient := &fakeACKClient{metadata: `{"Capabilities":{"Network":"terway-eniip"}}`}
+		ack := NewACKManaged("c1234567890", "cn-hangzhou", ackClient, nil, cache.New(time.Minute, time.Minute))
+
+		for range 2 {
+			cni, err := ack.GetClusterCNI(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cni).To(Equal(ClusterCNITypeTerway))
+		}
+		Expect(ackClient.calls).To(Equal(1))
+	})
+
+	It("should discover the private endpoint and the CA once", func() {
+		ackClient := &fakeACKClient{kubeconfig: testKubeconfig}
+		ack := NewACKManaged("c1234567890", "cn-hangzhou", ackClient, nil, cache.New(time.Minute, time.Minute))
+
+		for range 2 {
+			endpoint, err := ack.Endpoint(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(endpoint).To(Equal(&Endpoint{Server: "https://192.168.0.1:6443", CAData: "Y2EtZGF0YQ=="}))
+		}
+		Expect(ackClient.kubeconfigRequests).To(HaveLen(1))
+		Expect(tea.BoolValue(ackClient.kubeconfigRequests[0].PrivateIpAddress)).To(BeTrue())
+	})
+	It("should discover the public endpoint when the option selects it", func() {
+		ackClient := &fakeACKClient{kubeconfig: testKubeconfig}
+		ack := NewACKManaged("c1234567890", "cn-hangzhou", ackClient, nil, cache.New(time.Minute, time.Minute))
+
+		endpoint, err := ack.Endpoint(options.ToContext(ctx, &options.Options{ClusterEndpointAccess: options.ClusterEndpointAccessPublic}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(endpoint.Server).To(Equal("https://47.0.0.1:6443"))
+		Expect(tea.BoolValue(ackClient.kubeconfigRequests[0].PrivateIpAddress)).To(BeFalse())
+	})
+	It("should refresh the attach script when its registration token is about to expire", func() {
+		now := time.Now().Truncate(time.Second)
+		clk := clocktesting.NewFakeClock(now)
+		ackClient := &fakeACKClient{}
+		kubernetesInterface := kubefake.NewSimpleClientset(
+			bootstrapTokenSecret("tkn001", now.Add(time.Hour)),
+			bootstrapTokenSecret("tkn002", now.Add(2*time.Hour)),
+		)
+		ack := NewACKManaged("c1234567890", "cn-hangzhou", ackClient, kubernetesInterface, cache.New(time.Hour*6, time.Minute))
+		ack.clk = clk
+		userData := func() (string, error) {
+			return attachUserData(ack)
+		}
+
+		script, err := userData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(script).To(ContainSubstring("--token tkn001."))
+
+		// the token is valid long enough for the node to register
+		clk.Step(20 * time.Minute)
+		script, err = userData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(script).To(ContainSubstring("--token tkn001."))
+		Expect(ackClient.attachScriptCalls).To(Equal(1))
+
+		// the token expires within the refresh window, a new one is fetched before launching
+		clk.Step(15 * time.Minute)
+		script, err = userData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(script).To(ContainSubstring("--token tkn002."))
+		Expect(ackClient.attachScriptCalls).To(Equal(2))
+
+		// the token can't be refreshed, the launch fails
+		ackClient.attachScriptErr = errors.New("forbidden")
+		clk.Step(time.Hour)
+		_, err = userData()
+		createError := &cloudprovider.CreateError{}
+		Expect(errors.As(err, &createError)).To(BeTrue())
+		Expect(createError.ConditionReason).To(Equal("RegistrationTokenUnavailable"))
+		Expect(createError.ConditionMessage).To(ContainSubstring("forbidden"))
+	})
+	It("should cache the attach script when the expiration of its token is unknown", func() {
+		ackClient := &fakeACKClient{}
+		ack := NewACKManaged("c1234567890", "cn-hangzhou", ackClient, kubefake.NewSimpleClientset(), cache.New(time.Hour*6, time.Minute))
+
+		for range 2 {
+			script, err := attachUserData(ack)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(script).To(ContainSubstring("--token tkn001."))
+		}
+		Expect(ackClient.attachScriptCalls).To(Equal(1))
+	})
+	It("should cache the attach script when reading the expiration of its token is forbidden", func() {
+		ackClient := &fakeACKClient{}
+		kubernetesInterface := kubefake.NewSimpleClientset(bootstrapTokenSecret("tkn001", time.Now().Add(time.Minute)))
+		kubernetesInterface.PrependReactor("get", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "bootstrap-token-tkn001", errors.New("no Role in kube-system"))
+		})
+		ack := NewACKManaged("c1234567890", "cn-hangzhou", ackClient, kubernetesInterface, cache.New(time.Hour*6, time.Minute))
+
+		for range 2 {
+			script, err := attachUserData(ack)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(script).To(ContainSubstring("--token tkn001."))
+		}
+		Expect(ackClient.attachScriptCalls).To(Equal(1))
+	})
+	It("should fail on a kubeconfig without the CA", func() {
+		ackClient := &fakeACKClient{kubeconfig: strings.ReplaceAll(testKubeconfig, "    certificate-authority-data: Y2EtZGF0YQ==\n", "")}
+		ack := NewACKManaged("c1234567890", "cn-hangzhou", ackClient, nil, cache.New(time.Minute, time.Minute))
+
+		_, err := ack.Endpoint(ctx)
+		Expect(err).To(MatchError(ContainSubstring("no certificate authority data")))
+	})
+})
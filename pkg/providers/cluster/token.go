@@ -0,0 +1,78 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// registrationTokenRefreshWindow is how long before its expiration the registration token of the attach script
+	// is refreshed, the node still has to boot and register with it once it's launched
+	registrationTokenRefreshWindow = 30 * time.Minute
+
+	// The bootstrap tokens are stored in the kube-system secrets named after their ID, with their expiration in
+	// RFC3339, referring to: https://kubernetes.io/docs/reference/access-authn-authz/bootstrap-tokens/
+	bootstrapTokenNamespace     = "kube-system"
+	bootstrapTokenSecretPrefix  = "bootstrap-token-"
+	bootstrapTokenExpirationKey = "expiration"
+
+	// errCodeRegistrationTokenUnavailable is the condition reason of the launches failed without an attach script
+	errCodeRegistrationTokenUnavailable = "RegistrationTokenUnavailable"
+)
+
+// registrationTokenPattern matches the bootstrap token the attach script registers the node with, e.g.
+// --token abcdef.0123456789abcdef, the nodes register with it and don't need a RAM role to join the cluster
+var registrationTokenPattern = regexp.MustCompile(`--token\s+([a-z0-9]{6})\.[a-z0-9]{16}\b`)
+
+// attachScript is the attach script of the cluster and the expiration of the registration token it embeds,
+// the expiration is zero when it's unknown
+type attachScript struct {
+	script     string
+	expiration time.Time
+}
+
+// expiring returns whether the registration token is expired or about to, the attach script has to be described again
+func (s *attachScript) expiring(now time.Time) bool {
+	return !s.expiration.IsZero() && !now.Before(s.expiration.Add(-registrationTokenRefreshWindow))
+}
+
+// registrationTokenExpiration returns when the registration token embedded in the attach script expires, read from
+// its bootstrap token secret, the chart allows Karpenter to get the secrets of kube-system. It's zero when the script
+// has no token or the secret can't be read, e.g. the Role is missing, the cached attach script then expires with the
+// cache only.
+func (a *ACKManaged) registrationTokenExpiration(ctx context.Context, script string) time.Time {
+	match := registrationTokenPattern.FindStringSubmatch(script)
+	if match == nil || a.kubernetesInterface == nil {
+		return time.Time{}
+	}
+	secret, err := a.kubernetesInterface.CoreV1().Secrets(bootstrapTokenNamespace).Get(ctx, bootstrapTokenSecretPrefix+match[1], metav1.GetOptions{})
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("failed reading the expiration of the registration token", "error", err.Error())
+		return time.Time{}
+	}
+	expiration, err := time.Parse(time.RFC3339, string(secret.Data[bootstrapTokenExpirationKey]))
+	if err != nil {
+		return time.Time{}
+	}
+	return expiration
+}
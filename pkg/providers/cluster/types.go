@@ -20,13 +20,14 @@ import (
 	"context"
 	"net/http"
 
-	ackclient "github.com/alibabacloud-go/cs-20151215/v5/client"
 	"github.com/patrickmn/go-cache"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
 
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
 	alicache "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
 )
 
 const (
@@ -50,20 +51,34 @@ type Image struct {
 	Architecture string
 }
 
+// UserDataOptions is the configuration of a node rendered into its userdata
+type UserDataOptions struct {
+	Labels        map[string]string
+	Taints        []corev1.Taint
+	KubeletConfig *v1alpha1.KubeletConfiguration
+	// UserData is the custom userdata of the ECSNodeClass, merged after the node registration
+	UserData       *string
+	FormatDataDisk bool
+	Hostname       string
+	DNS            *v1alpha1.DNSConfiguration
+	// TerwayConfig is the ConfigMap of the Terway configuration the node is labeled with
+	TerwayConfig string
+}
+
 // Provider can be implemented to generate userdata
 type Provider interface {
 	ClusterType() string
-	UserData(context.Context, map[string]string, []corev1.Taint, *v1alpha1.KubeletConfiguration, *string, bool) (string, error)
+	UserData(context.Context, UserDataOptions) (string, error)
 	GetClusterCNI(context.Context) (string, error)
 	LivenessProbe(*http.Request) error
 	GetSupportedImages(string) ([]Image, error)
 	FeatureFlags() FeatureFlags
 }
 
-func NewClusterProvider(ctx context.Context, ackClient *ackclient.Client, region string) Provider {
+func NewClusterProvider(ctx context.Context, ackClient client.ACKClient, kubernetesInterface kubernetes.Interface, region string) Provider {
 	clusterID := options.FromContext(ctx).ClusterID
 	if options.FromContext(ctx).ClusterType == ackManagedClusterType {
-		return NewACKManaged(clusterID, region, ackClient, cache.New(alicache.ClusterAttachScriptTTL, alicache.DefaultCleanupInterval))
+		return NewACKManaged(clusterID, region, ackClient, kubernetesInterface, cache.New(alicache.ClusterAttachScriptTTL, alicache.DefaultCleanupInterval))
 	}
 	return NewCustom()
 }
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"regexp"
 
+	"github.com/samber/lo"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
 
@@ -38,10 +39,10 @@ type AlibabaCloudLinux3 struct {
 
 func (a *AlibabaCloudLinux3) GetImages(supprotedImages []cluster.Image, kubernetesVersion, imageVersion string) (Images, error) {
 	var ret Images
-	for _, im := range supprotedImages {
-		if !alibabaCloudLinux3ImageIDRegex.Match([]byte(im.ImageID)) {
-			continue
-		}
+	familyImages := lo.Filter(supprotedImages, func(im cluster.Image, _ int) bool {
+		return alibabaCloudLinux3ImageIDRegex.Match([]byte(im.ImageID))
+	})
+	for _, im := range selectImagesByVersion(familyImages, imageVersion) {
 		if image, err := alibabaCloudLinuxResolveImages(im); err == nil {
 			ret = append(ret, image)
 		}
@@ -59,6 +60,7 @@ func alibabaCloudLinuxResolveImages(im cluster.Image) (Image, error) {
 	return Image{
 		Name:         im.ImageName,
 		ImageID:      im.ImageID,
+		CreationDate: releaseDate(im),
 		Requirements: scheduling.NewRequirements(requirement),
 	}, nil
 }
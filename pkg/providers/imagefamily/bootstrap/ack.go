@@ -0,0 +1,168 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+)
+
+const (
+	defaultNodeLabel = "k8s.aliyun.com=true"
+	// nodePoolIDLabel is the label ACK selects the nodes of a node pool by
+	nodePoolIDLabel = "alibabacloud.com/nodepool-id"
+)
+
+// ACK bootstraps nodes through the ACK attach script, AlibabaCloudLinux3 and ContainerOS
+// images are registered by the same script
+type ACK struct {
+	Options
+}
+
+func (a ACK) Script() (string, error) {
+	var script bytes.Buffer
+	// Add bash script header
+	script.WriteString("#!/bin/bash\n\n")
+	// Configure the hostname and the resolver before the node is registered
+	script.WriteString(a.hostConfig())
+
+	// Clean up the input string
+	script.WriteString(a.AttachScript + " ")
+	// Add labels
+	script.WriteString(fmt.Sprintf("--labels %s ", a.formatLabels()))
+	// Add kubelet config
+	cfg, err := a.nodeConfig()
+	if err != nil {
+		return "", err
+	}
+	script.WriteString(fmt.Sprintf("--node-config %s ", cfg))
+	// Add taints
+	script.WriteString(fmt.Sprintf("--taints %s\n\n", a.formatTaints()))
+
+	return script.String(), nil
+}
+
+// hostConfig returns the commands setting the hostname and replacing the nameservers and the search domains of
+// the resolver, the values are validated by the ECSNodeClass
+func (a ACK) hostConfig() string {
+	var cmds strings.Builder
+	if a.Hostname != "" {
+		cmds.WriteString(fmt.Sprintf("hostnamectl set-hostname %s\n", a.Hostname))
+	}
+	if a.DNS != nil && len(a.DNS.Nameservers) != 0 {
+		cmds.WriteString("sed -i '/^nameserver /d' /etc/resolv.conf\n")
+		for _, nameserver := range a.DNS.Nameservers {
+			cmds.WriteString(fmt.Sprintf("echo 'nameserver %s' >> /etc/resolv.conf\n", nameserver))
+		}
+	}
+	if a.DNS != nil && len(a.DNS.Searches) != 0 {
+		cmds.WriteString("sed -i '/^search /d' /etc/resolv.conf\n")
+		cmds.WriteString(fmt.Sprintf("echo 'search %s' >> /etc/resolv.conf\n", strings.Join(a.DNS.Searches, " ")))
+	}
+	if cmds.Len() == 0 {
+		return ""
+	}
+	return cmds.String() + "\n"
+}
+
+func (a ACK) formatLabels() string {
+	labelsFormatted := fmt.Sprintf("%s,ack.aliyun.com=%s", defaultNodeLabel, a.ClusterID)
+	if a.NodePoolID != "" {
+		labelsFormatted = fmt.Sprintf("%s,%s=%s", labelsFormatted, nodePoolIDLabel, a.NodePoolID)
+	}
+	// Terway selects the configuration of the node by its label once the agent starts on the node
+	if a.TerwayConfig != "" {
+		labelsFormatted = fmt.Sprintf("%s,%s=%s", labelsFormatted, v1alpha1.LabelTerwayConfig, a.TerwayConfig)
+	}
+	keys := lo.Keys(lo.PickBy(a.Labels, func(key, value string) bool {
+		// the configured node pool and Terway configuration take precedence over the labels of the NodePool
+		return registrationLabel(key, value) && (a.NodePoolID == "" || key != nodePoolIDLabel) &&
+			(a.TerwayConfig == "" || key != v1alpha1.LabelTerwayConfig)
+	}))
+	sort.Strings(keys)
+	for _, key := range keys {
+		labelsFormatted = fmt.Sprintf("%s,%s=%s", labelsFormatted, key, a.Labels[key])
+	}
+	return labelsFormatted
+}
+
+func (a ACK) formatTaints() string {
+	return strings.Join(lo.FilterMap(a.Taints, func(t corev1.Taint, _ int) (string, bool) {
+		return t.ToString(), registrationTaint(t)
+	}), ",")
+}
+
+type NodeConfig struct {
+	KubeletConfig *ACKKubeletConfig `json:"kubelet_config,omitempty"`
+}
+
+// ACKKubeletConfig is the kubelet configuration accepted by the ACK attach script,
+// the names follow the upstream kubelet configuration
+type ACKKubeletConfig struct {
+	ClusterDNS                  []string                   `json:"clusterDNS,omitempty"`
+	MaxPods                     *int32                     `json:"maxPods,omitempty"`
+	PodsPerCore                 *int32                     `json:"podsPerCore,omitempty"`
+	SystemReserved              map[string]string          `json:"systemReserved,omitempty"`
+	KubeReserved                map[string]string          `json:"kubeReserved,omitempty"`
+	EvictionHard                map[string]string          `json:"evictionHard,omitempty"`
+	EvictionSoft                map[string]string          `json:"evictionSoft,omitempty"`
+	EvictionSoftGracePeriod     map[string]metav1.Duration `json:"evictionSoftGracePeriod,omitempty"`
+	EvictionMaxPodGracePeriod   *int32                     `json:"evictionMaxPodGracePeriod,omitempty"`
+	ImageGCHighThresholdPercent *int32                     `json:"imageGCHighThresholdPercent,omitempty"`
+	ImageGCLowThresholdPercent  *int32                     `json:"imageGCLowThresholdPercent,omitempty"`
+	CPUCFSQuota                 *bool                      `json:"cpuCFSQuota,omitempty"`
+	RegistryPullQPS             *int32                     `json:"registryPullQPS,omitempty"`
+	RegistryBurst               *int32                     `json:"registryBurst,omitempty"`
+}
+
+func (a ACK) nodeConfig() (string, error) {
+	cfg := &NodeConfig{KubeletConfig: &ACKKubeletConfig{}}
+	if k := a.KubeletConfig; k != nil {
+		cfg.KubeletConfig = &ACKKubeletConfig{
+			ClusterDNS:                  k.ClusterDNS,
+			MaxPods:                     k.MaxPods,
+			PodsPerCore:                 k.PodsPerCore,
+			SystemReserved:              k.SystemReserved,
+			KubeReserved:                k.KubeReserved,
+			EvictionHard:                k.EvictionHard,
+			EvictionSoft:                k.EvictionSoft,
+			EvictionSoftGracePeriod:     k.EvictionSoftGracePeriod,
+			EvictionMaxPodGracePeriod:   k.EvictionMaxPodGracePeriod,
+			ImageGCHighThresholdPercent: k.ImageGCHighThresholdPercent,
+			ImageGCLowThresholdPercent:  k.ImageGCLowThresholdPercent,
+			CPUCFSQuota:                 k.CPUCFSQuota,
+			RegistryPullQPS:             k.RegistryPullQPS,
+			RegistryBurst:               k.RegistryBurst,
+		}
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal node config, %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestACKNodeConfig(t *testing.T) {
+	kubeletCfg := &v1alpha1.KubeletConfiguration{
+		MaxPods: tea.Int32(110),
+	}
+	d, err := ACK{Options: Options{KubeletConfig: kubeletCfg}}.nodeConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "eyJrdWJlbGV0X2NvbmZpZyI6eyJtYXhQb2RzIjoxMTB9fQ==", d)
+}
+
+func TestACKScript(t *testing.T) {
+	options := Options{
+		ClusterID:    "c1234567890",
+		AttachScript: "curl http://aliacs-k8s-cn-hangzhou.oss-cn-hangzhou.aliyuncs.com/public/pkg/run/attach/1.30.1-aliyun.1/attach_node.sh | bash -s -- --openapi-token xxx --ess true",
+		Labels: map[string]string{
+			"karpenter.sh/nodepool":      "default",
+			"karpenter.sh/capacity-type": "spot",
+		},
+		Taints: []corev1.Taint{
+			{Key: "karpenter.sh/unregistered", Effect: corev1.TaintEffectNoExecute},
+			{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+		},
+	}
+
+	cases := map[string]*v1alpha1.KubeletConfiguration{
+		"ack_default": nil,
+		"ack_kubelet_config": {
+			ClusterDNS:     []string{"10.0.0.10"},
+			MaxPods:        tea.Int32(64),
+			SystemReserved: map[string]string{"cpu": "100m", "memory": "500Mi"},
+			EvictionHard:   map[string]string{"memory.available": "5%"},
+		},
+		"ack_kubelet_reserved": {
+			SystemReserved:  map[string]string{"cpu": "200m", "memory": "1Gi", "pid": "1000"},
+			KubeReserved:    map[string]string{"cpu": "300m", "memory": "2Gi", "ephemeral-storage": "10Gi"},
+			EvictionHard:    map[string]string{"memory.available": "500Mi", "nodefs.available": "10%"},
+			RegistryPullQPS: tea.Int32(10),
+			RegistryBurst:   tea.Int32(20),
+		},
+	}
+	for name, kubeletCfg := range cases {
+		t.Run(name, func(t *testing.T) {
+			options := options
+			options.KubeletConfig = kubeletCfg
+			script, err := ACK{Options: options}.Script()
+			require.NoError(t, err)
+
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				require.NoError(t, os.WriteFile(golden, []byte(script), 0o600))
+			}
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), script)
+		})
+	}
+}
+
+func TestACKScriptHostConfig(t *testing.T) {
+	options := Options{
+		ClusterID:    "c1234567890",
+		AttachScript: "curl http://aliacs-k8s-cn-hangzhou.oss-cn-hangzhou.aliyuncs.com/public/pkg/run/attach/1.30.1-aliyun.1/attach_node.sh | bash -s -- --openapi-token xxx --ess true",
+		Labels:       map[string]string{"karpenter.sh/nodepool": "default"},
+		Taints:       []corev1.Taint{{Key: "karpenter.sh/unregistered", Effect: corev1.TaintEffectNoExecute}},
+	}
+
+	cases := map[string]func(*Options){
+		"ack_hostname": func(o *Options) {
+			o.Hostname = "default-abcde.node.example.com"
+		},
+		"ack_dns": func(o *Options) {
+			o.Hostname = "default-abcde"
+			o.DNS = &v1alpha1.DNSConfiguration{
+				Nameservers: []string{"10.0.0.2", "10.0.0.3"},
+				Searches:    []string{"example.com", "svc.example.com"},
+			}
+		},
+		"ack_dns_searches": func(o *Options) {
+			o.DNS = &v1alpha1.DNSConfiguration{Searches: []string{"example.com"}}
+		},
+		// the configured node pool takes precedence over the node pool label of the NodePool
+		"ack_node_pool": func(o *Options) {
+			o.NodePoolID = "np1f6779297c4444a3a1cdd29be8e5a1b2"
+			o.Labels = map[string]string{"karpenter.sh/nodepool": "default", "alibabacloud.com/nodepool-id": "np0"}
+		},
+		// the Terway configuration of the ECSNodeClass takes precedence over the label of the NodePool
+		"ack_terway": func(o *Options) {
+			o.TerwayConfig = "karpenter-terway-default"
+			o.Labels = map[string]string{"karpenter.sh/nodepool": "default", "terway-config": "eni-config-np"}
+		},
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			options := options
+			mutate(&options)
+			script, err := ACK{Options: options}.Script()
+			require.NoError(t, err)
+
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				require.NoError(t, os.WriteFile(golden, []byte(script), 0o600))
+			}
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), script)
+		})
+	}
+}
+
+func TestACKScriptRegistration(t *testing.T) {
+	options := Options{
+		ClusterID:    "c1234567890",
+		AttachScript: "curl http://aliacs-k8s-cn-hangzhou.oss-cn-hangzhou.aliyuncs.com/public/pkg/run/attach/1.30.1-aliyun.1/attach_node.sh | bash -s -- --openapi-token xxx --ess true",
+		Labels: map[string]string{
+			"karpenter.sh/nodepool":                      "default",
+			"karpenter.sh/capacity-type":                 "on-demand",
+			"kubernetes.io/arch":                         "amd64",
+			"topology.kubernetes.io/zone":                "cn-hangzhou-i",
+			"node.kubernetes.io/instance-type":           "ecs.g7.large",
+			"node-role.kubernetes.io/worker":             "",
+			"node-restriction.kubernetes.io/team":        "a",
+			"karpenter.k8s.alibabacloud/instance-family": "ecs.g7",
+			"team":           "a",
+			"invalid label":  "a",
+			"invalid-value":  "a,b",
+			"example.com/id": "1",
+		},
+		Taints: []corev1.Taint{
+			{Key: "karpenter.sh/unregistered", Effect: corev1.TaintEffectNoExecute},
+			{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+			{Key: "example.com/preferred", Effect: corev1.TaintEffectPreferNoSchedule},
+			{Key: "node.cilium.io/agent-not-ready", Value: "true", Effect: corev1.TaintEffectNoExecute},
+			{Key: "invalid-effect", Effect: "NoRun"},
+		},
+	}
+	script, err := ACK{Options: options}.Script()
+	require.NoError(t, err)
+
+	golden := filepath.Join("testdata", "ack_registration.golden")
+	if *update {
+		require.NoError(t, os.WriteFile(golden, []byte(script), 0o600))
+	}
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), script)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+)
+
+// Options is the node registration configuration rendered into the userdata of a node
+type Options struct {
+	ClusterID string
+	// AttachScript is the node registration command returned by DescribeClusterAttachScripts,
+	// it already carries the API server endpoint and the cluster CA
+	AttachScript  string
+	KubeletConfig *v1alpha1.KubeletConfiguration
+	Labels        map[string]string
+	Taints        []corev1.Taint
+	// Hostname is set on the node before it's registered, it's validated by the ECSNodeClass
+	Hostname string
+	// DNS is written to the resolver configuration of the node before it's registered
+	DNS *v1alpha1.DNSConfiguration
+	// NodePoolID is the ACK node pool the node is labeled with, the ACK addons scheduled by node pool select it
+	NodePoolID string
+	// TerwayConfig is the ConfigMap of the Terway configuration the node is labeled with, empty to keep the Terway
+	// configuration of the cluster
+	TerwayConfig string
+}
+
+// Bootstrapper can be implemented to generate a bootstrap script
+// that registers a node of an image family to the cluster
+type Bootstrapper interface {
+	Script() (string, error)
+}
+
+var (
+	// kubeletLabels are the labels in the kubernetes.io and k8s.io namespaces that the kubelet is allowed to set,
+	// referring to: https://github.com/kubernetes/kubernetes/blob/v1.32.0/pkg/kubelet/apis/well_known_labels.go
+	kubeletLabels = sets.New(
+		corev1.LabelHostname,
+		corev1.LabelTopologyZone,
+		corev1.LabelTopologyRegion,
+		corev1.LabelFailureDomainBetaZone,
+		corev1.LabelFailureDomainBetaRegion,
+		corev1.LabelInstanceType,
+		corev1.LabelInstanceTypeStable,
+		corev1.LabelOSStable,
+		corev1.LabelArchStable,
+		"beta.kubernetes.io/os",
+		"beta.kubernetes.io/arch",
+	)
+	kubeletLabelNamespaces = sets.New("kubelet.kubernetes.io", "node.kubernetes.io")
+
+	taintEffects = sets.New(corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute)
+)
+
+// registrationLabel returns true if the node can register with the label, the kubelet fails to start
+// with an invalid label or a label in the kubernetes.io and k8s.io namespaces that it isn't allowed to set.
+// The labels left out are still applied to the node by Karpenter once it joins.
+func registrationLabel(key, value string) bool {
+	if len(validation.IsQualifiedName(key)) != 0 || len(validation.IsValidLabelValue(value)) != 0 {
+		return false
+	}
+	namespace, _, ok := strings.Cut(key, "/")
+	if !ok || kubeletLabels.Has(key) {
+		return true
+	}
+	for _, restricted := range []string{"kubernetes.io", "k8s.io"} {
+		if namespace != restricted && !strings.HasSuffix(namespace, "."+restricted) {
+			continue
+		}
+		for allowed := range kubeletLabelNamespaces {
+			if namespace == allowed || strings.HasSuffix(namespace, "."+allowed) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// registrationTaint returns true if the node can register with the taint
+func registrationTaint(taint corev1.Taint) bool {
+	return len(validation.IsQualifiedName(taint.Key)) == 0 &&
+		len(validation.IsValidLabelValue(taint.Value)) == 0 &&
+		taintEffects.Has(taint.Effect)
+}
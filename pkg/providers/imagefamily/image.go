@@ -19,7 +19,9 @@ package imagefamily
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
 	"github.com/alibabacloud-go/tea/tea"
@@ -32,15 +34,19 @@ import (
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/cluster"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/version"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
 )
 
 type Provider interface {
 	List(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass) (Images, error)
+	Resolve(ctx context.Context, alias, arch, kubernetesVersion string) (Image, error)
 }
 
 type DefaultProvider struct {
-	region    string
-	ecsClient *ecs.Client
+	region      string
+	ecsClient   client.ECSClient
+	rateLimiter *ratelimit.RateLimiter
 
 	sync.Mutex
 	cache *cache.Cache
@@ -49,11 +55,12 @@ type DefaultProvider struct {
 	versionProvider version.Provider
 }
 
-func NewDefaultProvider(region string, ecsClient *ecs.Client, clusterProvider cluster.Provider,
+func NewDefaultProvider(region string, ecsClient client.ECSClient, rateLimiter *ratelimit.RateLimiter, clusterProvider cluster.Provider,
 	versionProvider version.Provider, cache *cache.Cache) *DefaultProvider {
 	return &DefaultProvider{
-		region:    region,
-		ecsClient: ecsClient,
+		region:      region,
+		ecsClient:   ecsClient,
+		rateLimiter: rateLimiter,
 
 		cache: cache,
 
@@ -75,7 +82,40 @@ func (p *DefaultProvider) List(ctx context.Context, nodeClass *v1alpha1.ECSNodeC
 	return images, nil
 }
 
-//nolint:gocyclo
+// Resolve returns the image an alias (eg: AlibabaCloudLinux3@latest) resolves to for the given architecture,
+// arch could be either the kubernetes or the AlibabaCloud name of the architecture
+func (p *DefaultProvider) Resolve(ctx context.Context, alias, arch, kubernetesVersion string) (Image, error) {
+	a := v1alpha1.NewAlias(alias)
+	imageFamily := GetImageFamily(a.Family, nil)
+	if imageFamily == nil {
+		return Image{}, fmt.Errorf("unsupported image family %s", alias)
+	}
+	if kubeArch, ok := v1alpha1.AlibabaCloudToKubeArchitectures[arch]; ok {
+		arch = kubeArch
+	}
+
+	if kubernetesVersion == "" {
+		var err error
+		if kubernetesVersion, err = p.versionProvider.Get(ctx); err != nil {
+			return Image{}, err
+		}
+	}
+	supportedImages, err := p.clusterProvider.GetSupportedImages(kubernetesVersion)
+	if err != nil {
+		return Image{}, err
+	}
+	ims, err := imageFamily.GetImages(supportedImages, kubernetesVersion, a.Version)
+	if err != nil {
+		return Image{}, err
+	}
+	for _, im := range ims {
+		if im.Requirements.Get(corev1.LabelArchStable).Has(arch) {
+			return im, nil
+		}
+	}
+	return Image{}, fmt.Errorf("no image found for alias %s, architecture %s and kubernetes version %s", alias, arch, kubernetesVersion)
+}
+
 func (p *DefaultProvider) getImages(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass) (Images, error) {
 	hash, err := hashstructure.Hash(nodeClass.Spec.ImageSelectorTerms, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
 	if err != nil {
@@ -95,7 +135,7 @@ func (p *DefaultProvider) getImages(ctx context.Context, nodeClass *v1alpha1.ECS
 	if err != nil {
 		return nil, err
 	}
-	images := map[uint64]Image{}
+	var images Images
 	for _, selectorTerm := range nodeClass.Spec.ImageSelectorTerms {
 		var ims Images
 		var err error
@@ -110,35 +150,54 @@ func (p *DefaultProvider) getImages(ctx context.Context, nodeClass *v1alpha1.ECS
 				return nil, err
 			}
 		} else {
-			ims, err = p.getImagesByID(selectorTerm.ID)
+			ims, err = p.getImagesByID(ctx, selectorTerm.ID)
 			if err != nil {
 				return nil, err
 			}
 		}
+		images = append(images, ims...)
+	}
+	images = newestImages(images)
 
-		for _, im := range ims {
-			reqsHash := lo.Must(hashstructure.Hash(im.Requirements.NodeSelectorRequirements(),
-				hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true}))
-			// So, this means, the further ahead, the higher the priority.
-			if _, ok := images[reqsHash]; ok {
-				continue
-			}
-			images[reqsHash] = im
+	p.cache.SetDefault(fmt.Sprintf("%d", hash), images)
+	return append(Images{}, images...), nil
+}
+
+// newestImages keeps the newest image of every set of requirements, i.e. of every architecture, among the images
+// matched by all the selector terms. The ties are broken by the image id, so the same images are always selected
+// regardless of the order of the terms. The result is ordered by the image id.
+func newestImages(images Images) Images {
+	newest := map[uint64]Image{}
+	for _, im := range images {
+		reqsHash := lo.Must(hashstructure.Hash(im.Requirements.NodeSelectorRequirements(),
+			hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true}))
+		if current, ok := newest[reqsHash]; ok && !newerImage(im, current) {
+			continue
 		}
+		newest[reqsHash] = im
 	}
+	ret := lo.Values(newest)
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ImageID < ret[j].ImageID })
+	return ret
+}
 
-	p.cache.SetDefault(fmt.Sprintf("%d", hash), Images(lo.Values(images)))
-	return lo.Values(images), nil
+func newerImage(a, b Image) bool {
+	if !a.CreationDate.Equal(b.CreationDate) {
+		return a.CreationDate.After(b.CreationDate)
+	}
+	return a.ImageID > b.ImageID
 }
 
-func (p *DefaultProvider) getImagesByID(id string) (Images, error) {
+func (p *DefaultProvider) getImagesByID(ctx context.Context, id string) (Images, error) {
 	req := &ecs.DescribeImagesRequest{
 		RegionId:    tea.String(p.region),
 		ImageId:     tea.String(id),
 		ShowExpired: tea.Bool(true),
 	}
 
-	resp, err := p.ecsClient.DescribeImages(req)
+	resp, err := ratelimit.Call(ctx, p.rateLimiter, "DescribeImages", func() (*ecs.DescribeImagesResponse, error) {
+		return p.ecsClient.DescribeImages(req)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get images through id %s", id)
 	}
@@ -155,10 +214,14 @@ func (p *DefaultProvider) getImagesByID(id string) (Images, error) {
 		}
 		requirement := scheduling.NewRequirement(
 			corev1.LabelArchStable, corev1.NodeSelectorOpIn, arch)
+		// an unknown creation time loses to the images with a known one
+		creationDate, _ := time.Parse(time.RFC3339, tea.StringValue(image.CreationTime))
 
 		images = append(images, Image{
 			Name:         tea.StringValue(image.ImageName),
 			ImageID:      id,
+			Size:         tea.Int32Value(image.Size),
+			CreationDate: creationDate,
 			Requirements: scheduling.NewRequirements(requirement),
 		})
 	}
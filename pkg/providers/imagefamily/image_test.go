@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"context"
+	"testing"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/fake"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/cluster"
+)
+
+type fakeClusterProvider struct {
+	cluster.Provider
+	images []cluster.Image
+}
+
+func (f *fakeClusterProvider) GetSupportedImages(string) ([]cluster.Image, error) {
+	return f.images, nil
+}
+
+type fakeVersionProvider struct{}
+
+func (fakeVersionProvider) Get(context.Context) (string, error) {
+	return "1.31", nil
+}
+
+func (fakeVersionProvider) GetParsed(context.Context) (*version.Version, error) {
+	return version.MustParseGeneric("1.31"), nil
+}
+
+func TestListNewestImages(t *testing.T) {
+	ecsAPI := fake.NewECSAPI()
+	custom := func(id, architecture, creationTime string) {
+		image := fake.Image(id, id, architecture)
+		image.CreationTime = &creationTime
+		ecsAPI.Images = append(ecsAPI.Images, image)
+	}
+	custom("m-x86-old", "x86_64", "2024-05-01T00:00:00Z")
+	custom("m-x86-new", "x86_64", "2024-12-01T00:00:00Z")
+	custom("m-arm-a", "arm64", "2024-06-01T00:00:00Z")
+	custom("m-arm-b", "arm64", "2024-06-01T00:00:00Z")
+	custom("m-arm-new", "arm64", "2024-08-19T00:00:00Z")
+	list := func(terms ...v1alpha1.ImageSelectorTerm) []string {
+		p := NewDefaultProvider("cn-hangzhou", ecsAPI, nil, &fakeClusterProvider{}, fakeVersionProvider{}, cache.New(cache.NoExpiration, cache.NoExpiration))
+		images, err := p.List(context.Background(), &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{ImageSelectorTerms: terms}})
+		require.NoError(t, err)
+		return lo.Map(images, func(im Image, _ int) string { return im.ImageID })
+	}
+
+	// the newest image of every architecture wins regardless of the order of the terms, and the ties are broken by
+	// the image id
+	terms := []v1alpha1.ImageSelectorTerm{{ID: "m-x86-old"}, {ID: "m-arm-new"}, {ID: "m-x86-new"}, {ID: "m-arm-b"}, {ID: "m-arm-a"}}
+	assert.Equal(t, []string{"m-arm-new", "m-x86-new"}, list(terms...))
+	assert.Equal(t, []string{"m-arm-new", "m-x86-new"}, list(lo.Reverse(terms)...))
+	assert.Equal(t, []string{"m-arm-b", "m-x86-old"}, list(v1alpha1.ImageSelectorTerm{ID: "m-arm-a"}, v1alpha1.ImageSelectorTerm{ID: "m-x86-old"}, v1alpha1.ImageSelectorTerm{ID: "m-arm-b"}))
+	// the overlapping terms resolve the image once
+	assert.Equal(t, []string{"m-x86-new"}, list(v1alpha1.ImageSelectorTerm{ID: "m-x86-new"}, v1alpha1.ImageSelectorTerm{ID: "m-x86-new"}))
+
+	// the terms which match no image don't fail the others
+	assert.Equal(t, []string{"m-x86-new"}, list(v1alpha1.ImageSelectorTerm{ID: "m-missing"}, v1alpha1.ImageSelectorTerm{ID: "m-x86-new"}))
+	assert.Empty(t, list(v1alpha1.ImageSelectorTerm{ID: "m-missing"}))
+}
@@ -34,6 +34,8 @@ import (
 
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
 )
 
 var DefaultSystemDisk = v1alpha1.SystemDisk{
@@ -79,17 +81,19 @@ type Resolver interface {
 // DefaultResolver is able to fill-in dynamic launch template parameters
 type DefaultResolver struct {
 	sync.Mutex
-	region string
-	ecsapi *ecs.Client
-	cache  *cache.Cache
+	region      string
+	ecsapi      client.ECSClient
+	rateLimiter *ratelimit.RateLimiter
+	cache       *cache.Cache
 }
 
 // NewDefaultResolver constructs a new launch template DefaultResolver
-func NewDefaultResolver(region string, ecsapi *ecs.Client, cache *cache.Cache) *DefaultResolver {
+func NewDefaultResolver(region string, ecsapi client.ECSClient, rateLimiter *ratelimit.RateLimiter, cache *cache.Cache) *DefaultResolver {
 	return &DefaultResolver{
-		region: region,
-		ecsapi: ecsapi,
-		cache:  cache,
+		region:      region,
+		ecsapi:      ecsapi,
+		rateLimiter: rateLimiter,
+		cache:       cache,
 	}
 }
 
@@ -130,7 +134,7 @@ func (r *DefaultResolver) FilterInstanceTypesBySystemDisk(ctx context.Context, n
 		}
 
 		availableSystemDisk := newInstanceTypeAvailableSystemDisk()
-		if err := r.describeAvailableSystemDisk(&ecs.DescribeAvailableResourceRequest{
+		if err := r.describeAvailableSystemDisk(ctx, &ecs.DescribeAvailableResourceRequest{
 			RegionId:            tea.String(r.region),
 			DestinationResource: tea.String("SystemDisk"),
 			InstanceType:        tea.String(instanceType.Name),
@@ -159,9 +163,11 @@ func (r *DefaultResolver) FilterInstanceTypesBySystemDisk(ctx context.Context, n
 }
 
 //nolint:gocyclo
-func (r *DefaultResolver) describeAvailableSystemDisk(request *ecs.DescribeAvailableResourceRequest, process func(*ecs.DescribeAvailableResourceResponseBodyAvailableZonesAvailableZoneAvailableResourcesAvailableResourceSupportedResourcesSupportedResource)) error {
+func (r *DefaultResolver) describeAvailableSystemDisk(ctx context.Context, request *ecs.DescribeAvailableResourceRequest, process func(*ecs.DescribeAvailableResourceResponseBodyAvailableZonesAvailableZoneAvailableResourcesAvailableResourceSupportedResourcesSupportedResource)) error {
 	runtime := &util.RuntimeOptions{}
-	output, err := r.ecsapi.DescribeAvailableResourceWithOptions(request, runtime)
+	output, err := ratelimit.Call(ctx, r.rateLimiter, "DescribeAvailableResource", func() (*ecs.DescribeAvailableResourceResponse, error) {
+		return r.ecsapi.DescribeAvailableResourceWithOptions(request, runtime)
+	})
 	if err != nil {
 		return err
 	} else if output == nil || output.Body == nil {
@@ -17,13 +17,20 @@ limitations under the License.
 package imagefamily
 
 import (
+	"time"
+
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/cluster"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
 )
 
 type Image struct {
-	Name         string
-	ImageID      string
+	Name    string
+	ImageID string
+	// Size is the size of the image in GiB, 0 if it is unknown
+	Size int32
+	// CreationDate is when the image was created, or released for the images of the ACK image families. It's zero if
+	// it is unknown.
+	CreationDate time.Time
 	Requirements scheduling.Requirements
 }
 
@@ -0,0 +1,78 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/cluster"
+)
+
+var (
+	// The release date is the version of an ACK image, eg: aliyun_3_arm64_20G_alibase_20240819.vhd
+	imageVersionRegex = regexp.MustCompile(`(\d{8})\.vhd$`)
+)
+
+// releaseVersion returns the release version of the image, falling back to the image id if the
+// image id does not contain a release date
+func releaseVersion(im cluster.Image) string {
+	if matches := imageVersionRegex.FindStringSubmatch(im.ImageID); matches != nil {
+		return matches[1]
+	}
+	return im.ImageID
+}
+
+// releaseDate returns the release date of the image, it's zero if the image id does not contain a release date
+func releaseDate(im cluster.Image) time.Time {
+	if matches := imageVersionRegex.FindStringSubmatch(im.ImageID); matches != nil {
+		date, _ := time.Parse("20060102", matches[1])
+		return date
+	}
+	return time.Time{}
+}
+
+// selectImagesByVersion keeps the images of a family matching the pinned version, or the newest image
+// of every architecture when the version is latest. The result is ordered by architecture and image id.
+func selectImagesByVersion(supportedImages []cluster.Image, version string) []cluster.Image {
+	var ret []cluster.Image
+	if version == "" || version == v1alpha1.AliasVersionLatest {
+		for _, images := range lo.GroupBy(supportedImages, func(im cluster.Image) string { return im.Architecture }) {
+			ret = append(ret, lo.MaxBy(images, func(a, b cluster.Image) bool {
+				if releaseVersion(a) != releaseVersion(b) {
+					return releaseVersion(a) > releaseVersion(b)
+				}
+				return a.ImageID > b.ImageID
+			}))
+		}
+	} else {
+		ret = lo.Filter(supportedImages, func(im cluster.Image, _ int) bool {
+			return releaseVersion(im) == version || im.ImageID == version
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Architecture != ret[j].Architecture {
+			return ret[i].Architecture < ret[j].Architecture
+		}
+		return ret[i].ImageID < ret[j].ImageID
+	})
+	return ret
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagefamily
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/cluster"
+)
+
+func TestSelectImagesByVersion(t *testing.T) {
+	images := []cluster.Image{
+		{ImageID: "aliyun_3_x64_20G_alibase_20240819.vhd", Architecture: "x86_64"},
+		{ImageID: "aliyun_3_arm64_20G_alibase_20240819.vhd", Architecture: "arm64"},
+		{ImageID: "aliyun_3_x64_20G_alibase_20241011.vhd", Architecture: "x86_64"},
+		{ImageID: "aliyun_3_arm64_20G_alibase_20240528.vhd", Architecture: "arm64"},
+	}
+	ids := func(ims []cluster.Image) []string {
+		return lo.Map(ims, func(im cluster.Image, _ int) string { return im.ImageID })
+	}
+
+	assert.Equal(t, []string{
+		"aliyun_3_arm64_20G_alibase_20240819.vhd",
+		"aliyun_3_x64_20G_alibase_20241011.vhd",
+	}, ids(selectImagesByVersion(images, "latest")))
+	assert.Equal(t, []string{
+		"aliyun_3_arm64_20G_alibase_20240819.vhd",
+		"aliyun_3_x64_20G_alibase_20240819.vhd",
+	}, ids(selectImagesByVersion(images, "20240819")))
+	assert.Empty(t, selectImagesByVersion(images, "20200101"))
+}
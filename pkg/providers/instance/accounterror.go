@@ -0,0 +1,60 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/logging"
+)
+
+const accountErrorKey = "account"
+
+// accountError returns the error every launch fails with while the launches are paused after an account-level
+// error, e.g. InsufficientBalance, the account has to be fixed by the user, so retrying right away only floods ECS
+func (p *DefaultProvider) accountError() error {
+	item, expiration, ok := p.accountErrors.GetWithExpiration(accountErrorKey)
+	if !ok {
+		return nil
+	}
+	createError := item.(*cloudprovider.CreateError)
+	return cloudprovider.NewCreateError(
+		fmt.Errorf("launches are paused until %s after an account error, %w", expiration.Format(time.RFC3339), createError),
+		createError.ConditionReason, createError.ConditionMessage)
+}
+
+// recordAccountError pauses the launches for the account-error-cooldown if the launch failed with an account-level error
+func (p *DefaultProvider) recordAccountError(ctx context.Context, err error) {
+	var createError *cloudprovider.CreateError
+	if !errors.As(err, &createError) || !alierrors.IsTerminalCode(createError.ConditionReason) {
+		return
+	}
+	cooldown := options.FromContext(ctx).AccountErrorCooldown
+	if cooldown <= 0 {
+		return
+	}
+	p.accountErrors.Set(accountErrorKey, createError, cooldown)
+	logging.FromContext(ctx).WithValues("code", createError.ConditionReason, "cooldown", cooldown).
+		Error(err, "pausing launches after an account error")
+}
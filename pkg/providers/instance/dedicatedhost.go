@@ -0,0 +1,241 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/vswitch"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
+)
+
+const (
+	dedicatedHostStatusAvailable = "Available"
+	// describeDedicatedHostsMaxResults is the max page size of DescribeDedicatedHosts
+	describeDedicatedHostsMaxResults int32 = 100
+)
+
+type dedicatedHost = ecsclient.DescribeDedicatedHostsResponseBodyDedicatedHostsDedicatedHost
+
+// launchOnDedicatedHost launches the instance of the auto provisioning group request on a dedicated host. The auto
+// provisioning group can't place instances on dedicated hosts, so the instance is launched with RunInstances instead.
+func (p *DefaultProvider) launchOnDedicatedHost(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, request *ecsclient.CreateAutoProvisioningGroupRequest,
+	instanceTypes []*cloudprovider.InstanceType, zonalVSwitchs map[string]*vswitch.VSwitch,
+) (*ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult, error) {
+	hosts, err := p.describeDedicatedHosts(ctx, nodeClass.Spec.DedicatedHostID)
+	if err != nil {
+		return nil, err
+	}
+	instanceType, host, ok := selectDedicatedHost(request.LaunchTemplateConfig, instanceTypes, hosts, zonalVSwitchs)
+	if !ok {
+		return nil, cloudprovider.NewInsufficientCapacityError(fmt.Errorf("no available dedicated host supports the instance types"))
+	}
+
+	runInstancesRequest := runInstancesRequestOnDedicatedHost(request, instanceType, zonalVSwitchs[tea.StringValue(host.ZoneId)].ID, host)
+	if count := ipv6AddressCount(nodeClass); count != 0 {
+		runInstancesRequest.Ipv6AddressCount = tea.Int32(count)
+	}
+	if nodeClass.Spec.MetadataOptions != nil {
+		metadataOptions := metadataOptionsRequest(nodeClass.Spec.MetadataOptions)
+		runInstancesRequest.HttpEndpoint = metadataOptions.HttpEndpoint
+		runInstancesRequest.HttpTokens = metadataOptions.HttpTokens
+		runInstancesRequest.HttpPutResponseHopLimit = metadataOptions.HttpPutResponseHopLimit
+	}
+	if options.FromContext(ctx).DryRun {
+		return nil, p.dryRunInstances(runInstancesRequest)
+	}
+	release, err := p.acquireLaunchSlot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for a launch slot, %w", err)
+	}
+	resp, err := p.ecsClient.RunInstancesWithOptions(runInstancesRequest, &util.RuntimeOptions{})
+	release()
+	if err != nil {
+		code := alierrors.ErrorCode(err)
+		switch {
+		case alierrors.IsLaunchFailureCode(code):
+			return nil, cloudprovider.NewCreateError(fmt.Errorf("running instance on dedicated host, %w", err), code, err.Error())
+		case alierrors.IsInsufficientCapacityCode(code):
+			return nil, cloudprovider.NewInsufficientCapacityError(fmt.Errorf("running instance on dedicated host, %w", err))
+		}
+		return nil, fmt.Errorf("running instance on dedicated host, %w", err)
+	}
+	if resp == nil || resp.Body == nil || resp.Body.InstanceIdSets == nil || len(resp.Body.InstanceIdSets.InstanceIdSet) == 0 {
+		return nil, fmt.Errorf("invalid response when running instance on dedicated host: %s", tea.Prettify(resp))
+	}
+
+	return &ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult{
+		InstanceIds: &ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResultInstanceIds{
+			InstanceId: resp.Body.InstanceIdSets.InstanceIdSet,
+		},
+		InstanceType: tea.String(instanceType),
+		ZoneId:       host.ZoneId,
+		SpotStrategy: tea.String("NoSpot"),
+	}, nil
+}
+
+func (p *DefaultProvider) describeDedicatedHosts(ctx context.Context, id *string) ([]*dedicatedHost, error) {
+	request := &ecsclient.DescribeDedicatedHostsRequest{
+		RegionId:   tea.String(p.region),
+		Status:     tea.String(dedicatedHostStatusAvailable),
+		MaxResults: tea.Int32(describeDedicatedHostsMaxResults),
+	}
+	if id != nil {
+		request.DedicatedHostIds = tea.String(fmt.Sprintf("[%q]", *id))
+	}
+
+	var hosts []*dedicatedHost
+	for {
+		resp, err := ratelimit.Call(ctx, p.rateLimiter, "DescribeDedicatedHosts", func() (*ecsclient.DescribeDedicatedHostsResponse, error) {
+			return p.ecsClient.DescribeDedicatedHostsWithOptions(request, &util.RuntimeOptions{})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describing dedicated hosts, %w", err)
+		}
+		if resp == nil || resp.Body == nil || resp.Body.DedicatedHosts == nil {
+			return hosts, nil
+		}
+		hosts = append(hosts, resp.Body.DedicatedHosts.DedicatedHost...)
+
+		nextToken := tea.StringValue(resp.Body.NextToken)
+		if nextToken == "" || nextToken == tea.StringValue(request.NextToken) {
+			return hosts, nil
+		}
+		request.NextToken = tea.String(nextToken)
+	}
+}
+
+// selectDedicatedHost returns the first instance type of the launch template configs and a dedicated host which can
+// place it. The host must be in a zone to launch in, support the instance type and have enough vCPUs and memory left.
+func selectDedicatedHost(launchTemplateConfigs []*ecsclient.CreateAutoProvisioningGroupRequestLaunchTemplateConfig,
+	instanceTypes []*cloudprovider.InstanceType, hosts []*dedicatedHost, zonalVSwitchs map[string]*vswitch.VSwitch,
+) (string, *dedicatedHost, bool) {
+	capacities := lo.SliceToMap(instanceTypes, func(instanceType *cloudprovider.InstanceType) (string, corev1.ResourceList) {
+		return instanceType.Name, instanceType.Capacity
+	})
+	for _, launchTemplateConfig := range launchTemplateConfigs {
+		instanceType := tea.StringValue(launchTemplateConfig.InstanceType)
+		for _, host := range hosts {
+			if _, ok := zonalVSwitchs[tea.StringValue(host.ZoneId)]; !ok {
+				continue
+			}
+			if supportsInstanceType(host, instanceType) && hasCapacity(host, capacities[instanceType]) {
+				return instanceType, host, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+func supportsInstanceType(host *dedicatedHost, instanceType string) bool {
+	if host.SupportedInstanceTypesList != nil && lo.Contains(tea.StringSliceValue(host.SupportedInstanceTypesList.SupportedInstanceTypesList), instanceType) {
+		return true
+	}
+	// ecs.g7.large belongs to the instance family ecs.g7
+	family := instanceType[:max(strings.LastIndex(instanceType, "."), 0)]
+	return host.SupportedInstanceTypeFamilies != nil && lo.Contains(tea.StringSliceValue(host.SupportedInstanceTypeFamilies.SupportedInstanceTypeFamily), family)
+}
+
+func hasCapacity(host *dedicatedHost, capacity corev1.ResourceList) bool {
+	if host.Capacity == nil {
+		return false
+	}
+	memoryGiB := float64(capacity.Memory().Value()) / (1024 * 1024 * 1024)
+	return int64(tea.Int32Value(host.Capacity.AvailableVcpus)) >= capacity.Cpu().Value() &&
+		float64(tea.Float32Value(host.Capacity.AvailableMemory)) >= memoryGiB
+}
+
+// runInstancesRequestOnDedicatedHost translates the launch configuration of the auto provisioning group request into
+// a pay-as-you-go RunInstances request on the dedicated host.
+func runInstancesRequestOnDedicatedHost(request *ecsclient.CreateAutoProvisioningGroupRequest, instanceType, vSwitchID string, host *dedicatedHost) *ecsclient.RunInstancesRequest {
+	runInstancesRequest := runInstancesRequest(request, instanceType, vSwitchID)
+	runInstancesRequest.ZoneId = host.ZoneId
+	runInstancesRequest.Tenancy = tea.String(v1alpha1.TenancyHost)
+	runInstancesRequest.DedicatedHostId = host.DedicatedHostId
+	return runInstancesRequest
+}
+
+// runInstancesRequest translates the launch configuration of the auto provisioning group request into a pay-as-you-go
+// RunInstances request of the instance type in the vSwitch.
+func runInstancesRequest(request *ecsclient.CreateAutoProvisioningGroupRequest, instanceType, vSwitchID string) *ecsclient.RunInstancesRequest {
+	launchConfiguration := request.LaunchConfiguration
+	runInstancesRequest := &ecsclient.RunInstancesRequest{
+		ClientToken:             request.ClientToken,
+		RegionId:                request.RegionId,
+		InstanceType:            tea.String(instanceType),
+		InstanceChargeType:      tea.String("PostPaid"),
+		VSwitchId:               tea.String(vSwitchID),
+		ImageId:                 launchConfiguration.ImageId,
+		UserData:                launchConfiguration.UserData,
+		ResourceGroupId:         launchConfiguration.ResourceGroupId,
+		SecurityGroupIds:        launchConfiguration.SecurityGroupIds,
+		KeyPairName:             launchConfiguration.KeyPairName,
+		Password:                launchConfiguration.Password,
+		PasswordInherit:         launchConfiguration.PasswordInherit,
+		DeploymentSetId:         launchConfiguration.DeploymentSetId,
+		RamRoleName:             launchConfiguration.RamRoleName,
+		HostName:                launchConfiguration.HostName,
+		InstanceName:            launchConfiguration.InstanceName,
+		InternetMaxBandwidthOut: launchConfiguration.InternetMaxBandwidthOut,
+		Tag: lo.Map(launchConfiguration.Tag, func(tag *ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationTag, _ int) *ecsclient.RunInstancesRequestTag {
+			return &ecsclient.RunInstancesRequestTag{Key: tag.Key, Value: tag.Value}
+		}),
+		SystemDisk: &ecsclient.RunInstancesRequestSystemDisk{
+			Size:             tea.String(strconv.Itoa(int(tea.Int32Value(launchConfiguration.SystemDiskSize)))),
+			PerformanceLevel: launchConfiguration.SystemDiskPerformanceLevel,
+		},
+	}
+	// RunInstances takes a single category, the first one the auto provisioning group would try
+	if len(request.SystemDiskConfig) != 0 {
+		runInstancesRequest.SystemDisk.Category = request.SystemDiskConfig[0].DiskCategory
+	}
+	if launchConfiguration.SystemDisk != nil {
+		runInstancesRequest.SystemDisk.Encrypted = launchConfiguration.SystemDisk.Encrypted
+		runInstancesRequest.SystemDisk.KMSKeyId = launchConfiguration.SystemDisk.KMSKeyId
+	}
+	runInstancesRequest.DataDisk = lo.Map(launchConfiguration.DataDisk, func(disk *ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationDataDisk, _ int) *ecsclient.RunInstancesRequestDataDisk {
+		dataDisk := &ecsclient.RunInstancesRequestDataDisk{
+			Size:               disk.Size,
+			Device:             disk.Device,
+			Category:           disk.Category,
+			PerformanceLevel:   disk.PerformanceLevel,
+			DeleteWithInstance: disk.DeleteWithInstance,
+			KMSKeyId:           disk.KmsKeyId,
+		}
+		if dataDisk.Category == nil && len(request.DataDiskConfig) != 0 {
+			dataDisk.Category = request.DataDiskConfig[0].DiskCategory
+		}
+		if disk.Encrypted != nil {
+			dataDisk.Encrypted = tea.String(strconv.FormatBool(*disk.Encrypted))
+		}
+		return dataDisk
+	})
+	return runInstancesRequest
+}
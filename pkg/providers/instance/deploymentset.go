@@ -0,0 +1,115 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/samber/lo"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
+)
+
+// getDeploymentSetID returns the deployment set to launch the instance of the NodeClaim into, or an empty string
+// when the instance isn't launched into a deployment set. Managed deployment sets are created for each NodePool and
+// strategy.
+func (p *DefaultProvider) getDeploymentSetID(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim) (string, error) {
+	deploymentSet := nodeClass.Spec.DeploymentSet
+	if deploymentSet == nil {
+		return "", nil
+	}
+	if !deploymentSet.Managed {
+		return lo.FromPtr(deploymentSet.ID), nil
+	}
+
+	strategy := lo.CoalesceOrEmpty(deploymentSet.Strategy, v1alpha1.DeploymentSetStrategyAvailability)
+	name := fmt.Sprintf("karpenter-%s-%s", options.FromContext(ctx).ClusterID, nodeClaim.Labels[karpv1.NodePoolLabelKey])
+	// The name of the deployment sets which spread the instances is kept for the ones created before the strategy
+	if strategy != v1alpha1.DeploymentSetStrategyAvailability {
+		name = fmt.Sprintf("%s-%s", name, strings.ToLower(strategy))
+	}
+	if id, ok := p.deploymentSetCache.Get(name); ok {
+		return id.(string), nil
+	}
+
+	p.deploymentSetMu.Lock()
+	defer p.deploymentSetMu.Unlock()
+	if id, ok := p.deploymentSetCache.Get(name); ok {
+		return id.(string), nil
+	}
+
+	id, err := p.describeDeploymentSet(ctx, name, strategy)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		if id, err = p.createDeploymentSet(ctx, name, strategy); err != nil {
+			return "", err
+		}
+	}
+	p.deploymentSetCache.SetDefault(name, id)
+	return id, nil
+}
+
+func (p *DefaultProvider) describeDeploymentSet(ctx context.Context, name, strategy string) (string, error) {
+	resp, err := ratelimit.Call(ctx, p.rateLimiter, "DescribeDeploymentSets", func() (*ecsclient.DescribeDeploymentSetsResponse, error) {
+		return p.ecsClient.DescribeDeploymentSets(&ecsclient.DescribeDeploymentSetsRequest{
+			RegionId:          tea.String(p.region),
+			DeploymentSetName: tea.String(name),
+			Strategy:          tea.String(strategy),
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("describing deployment set %s, %w", name, err)
+	}
+	if resp == nil || resp.Body == nil || resp.Body.DeploymentSets == nil {
+		return "", nil
+	}
+	// The name filter is a fuzzy match
+	deploymentSet, _ := lo.Find(resp.Body.DeploymentSets.DeploymentSet, func(ds *ecsclient.DescribeDeploymentSetsResponseBodyDeploymentSetsDeploymentSet) bool {
+		return tea.StringValue(ds.DeploymentSetName) == name
+	})
+	if deploymentSet == nil {
+		return "", nil
+	}
+	return tea.StringValue(deploymentSet.DeploymentSetId), nil
+}
+
+func (p *DefaultProvider) createDeploymentSet(ctx context.Context, name, strategy string) (string, error) {
+	resp, err := ratelimit.Call(ctx, p.rateLimiter, "CreateDeploymentSet", func() (*ecsclient.CreateDeploymentSetResponse, error) {
+		return p.ecsClient.CreateDeploymentSet(&ecsclient.CreateDeploymentSetRequest{
+			RegionId:          tea.String(p.region),
+			DeploymentSetName: tea.String(name),
+			Description:       tea.String("Managed by karpenter"),
+			Strategy:          tea.String(strategy),
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating deployment set %s, %w", name, err)
+	}
+	if resp == nil || resp.Body == nil || tea.StringValue(resp.Body.DeploymentSetId) == "" {
+		return "", fmt.Errorf("invalid response when creating deployment set %s: %s", name, tea.Prettify(resp))
+	}
+	return tea.StringValue(resp.Body.DeploymentSetId), nil
+}
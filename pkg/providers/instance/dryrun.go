@@ -0,0 +1,66 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+)
+
+// dryRunProvisioningGroup validates the launch of the auto provisioning group request without launching an instance.
+// The auto provisioning group has no dry run, so the first launch template config, the one the auto provisioning group
+// tries first, is validated with a dry run of RunInstances instead.
+func (p *DefaultProvider) dryRunProvisioningGroup(ctx context.Context, request *ecsclient.CreateAutoProvisioningGroupRequest, capacityType string) error {
+	if len(request.LaunchTemplateConfig) == 0 {
+		return errors.New("dry run of the launch, no launch template configs")
+	}
+	launchTemplateConfig := request.LaunchTemplateConfig[0]
+	runInstancesRequest := runInstancesRequest(request, tea.StringValue(launchTemplateConfig.InstanceType), tea.StringValue(launchTemplateConfig.VSwitchId))
+	if capacityType == karpv1.CapacityTypeSpot {
+		runInstancesRequest.SpotStrategy = tea.String("SpotAsPriceGo")
+	}
+	return p.dryRunInstances(runInstancesRequest)
+}
+
+// dryRunInstances sends the RunInstances request as a dry run. It always fails the launch: with the DryRunOperation
+// reason when the instance would have been launched, and with the error of the launch otherwise, e.g. a missing
+// permission or an exceeded quota.
+func (p *DefaultProvider) dryRunInstances(request *ecsclient.RunInstancesRequest) error {
+	request.DryRun = tea.Bool(true)
+	_, err := p.ecsClient.RunInstancesWithOptions(request, &util.RuntimeOptions{})
+	code := alierrors.ErrorCode(err)
+	switch {
+	case err == nil || code == alierrors.ErrCodeDryRunOperation:
+		message := fmt.Sprintf("dry run of %s in %s passed, no instance is launched in dry run mode",
+			tea.StringValue(request.InstanceType), tea.StringValue(request.VSwitchId))
+		return cloudprovider.NewCreateError(errors.New(message), alierrors.ErrCodeDryRunOperation, message)
+	case alierrors.IsLaunchFailureCode(code):
+		return cloudprovider.NewCreateError(fmt.Errorf("dry run of the launch, %w", err), code, err.Error())
+	case alierrors.IsInsufficientCapacityCode(code):
+		return cloudprovider.NewInsufficientCapacityError(fmt.Errorf("dry run of the launch, %w", err))
+	}
+	return fmt.Errorf("dry run of the launch, %w", err)
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	vpc "github.com/alibabacloud-go/vpc-20160428/v6/client"
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/logging"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
+)
+
+const (
+	defaultEIPBandwidth          int32 = 5
+	defaultEIPInternetChargeType       = "PayByTraffic"
+	eipInstanceType                    = "EcsInstance"
+)
+
+// eipBackoff waits for the instance to start before associating the elastic IP address, and for the association
+// to be removed after the instance is released before releasing the elastic IP address
+var eipBackoff = wait.Backoff{Duration: 2 * time.Second, Factor: 1.5, Steps: 8, Cap: 15 * time.Second}
+
+// eipDescription marks the elastic IP addresses allocated by karpenter for the instances of the cluster
+func eipDescription(clusterID string) string {
+	return fmt.Sprintf("Managed by karpenter of cluster %s, released with the instance", clusterID)
+}
+
+// associateEIP allocates an elastic IP address for the instance of the NodeClaim and associates it with the
+// instance. The instance can't be associated until it's running, so the association is retried while it starts.
+// When the association fails, the elastic IP address is released.
+func (p *DefaultProvider) associateEIP(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim, instanceID string) error {
+	association := nodeClass.Spec.EIPAssociation
+	if association == nil {
+		return nil
+	}
+	resp, err := ratelimit.Call(ctx, p.rateLimiter, "AllocateEipAddress", func() (*vpc.AllocateEipAddressResponse, error) {
+		return p.vpcClient.AllocateEipAddressWithOptions(&vpc.AllocateEipAddressRequest{
+			RegionId:           tea.String(p.region),
+			ClientToken:        tea.String(fmt.Sprintf("eip-%s", instanceID)),
+			Bandwidth:          tea.String(strconv.Itoa(int(lo.FromPtrOr(association.Bandwidth, defaultEIPBandwidth)))),
+			InternetChargeType: tea.String(lo.FromPtrOr(association.InternetChargeType, defaultEIPInternetChargeType)),
+			InstanceChargeType: tea.String("PostPaid"),
+			Name:               tea.String(nodeClaim.Name),
+			Description:        tea.String(eipDescription(options.FromContext(ctx).ClusterID)),
+			ResourceGroupId:    lo.EmptyableToPtr(options.ResourceGroupID(ctx, nodeClass)),
+		}, &util.RuntimeOptions{})
+	})
+	if err != nil {
+		return fmt.Errorf("allocating elastic IP address, %w", err)
+	}
+	if resp == nil || resp.Body == nil || resp.Body.AllocationId == nil {
+		return fmt.Errorf("allocating elastic IP address, invalid response %s", tea.Prettify(resp))
+	}
+	allocationID := tea.StringValue(resp.Body.AllocationId)
+
+	if err := retryIncorrectStatus(ctx, func() error {
+		_, err := ratelimit.Call(ctx, p.rateLimiter, "AssociateEipAddress", func() (*vpc.AssociateEipAddressResponse, error) {
+			return p.vpcClient.AssociateEipAddressWithOptions(&vpc.AssociateEipAddressRequest{
+				RegionId:     tea.String(p.region),
+				AllocationId: tea.String(allocationID),
+				InstanceId:   tea.String(instanceID),
+				InstanceType: tea.String(eipInstanceType),
+			}, &util.RuntimeOptions{})
+		})
+		return err
+	}); err != nil {
+		err = fmt.Errorf("associating elastic IP address %s, %w", allocationID, err)
+		if e := p.releaseEIPs(ctx, []string{allocationID}); e != nil {
+			err = multierr.Append(err, e)
+		}
+		return err
+	}
+	logging.FromContext(ctx).WithValues("id", instanceID, "eip", tea.StringValue(resp.Body.EipAddress)).V(1).Info("associated elastic IP address")
+	return nil
+}
+
+// listEIPs returns the elastic IP addresses karpenter allocated for the instance
+func (p *DefaultProvider) listEIPs(ctx context.Context, instanceID string) ([]string, error) {
+	resp, err := ratelimit.CallIdempotent(ctx, p.rateLimiter, "DescribeEipAddresses", func() (*vpc.DescribeEipAddressesResponse, error) {
+		return p.vpcClient.DescribeEipAddressesWithOptions(&vpc.DescribeEipAddressesRequest{
+			RegionId:               tea.String(p.region),
+			AssociatedInstanceId:   tea.String(instanceID),
+			AssociatedInstanceType: tea.String(eipInstanceType),
+			PageSize:               tea.Int32(100),
+		}, &util.RuntimeOptions{})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing elastic IP addresses of instance %s, %w", instanceID, err)
+	}
+	if resp == nil || resp.Body == nil || resp.Body.EipAddresses == nil {
+		return nil, nil
+	}
+	description := eipDescription(options.FromContext(ctx).ClusterID)
+	return lo.FilterMap(resp.Body.EipAddresses.EipAddress, func(eip *vpc.DescribeEipAddressesResponseBodyEipAddressesEipAddress, _ int) (string, bool) {
+		return tea.StringValue(eip.AllocationId), tea.StringValue(eip.Description) == description
+	}), nil
+}
+
+// releaseEIPs releases the elastic IP addresses, the release is retried while they are still being unassociated
+func (p *DefaultProvider) releaseEIPs(ctx context.Context, allocationIDs []string) error {
+	var errs error
+	for _, allocationID := range allocationIDs {
+		if err := retryIncorrectStatus(ctx, func() error {
+			_, err := ratelimit.Call(ctx, p.rateLimiter, "ReleaseEipAddress", func() (*vpc.ReleaseEipAddressResponse, error) {
+				return p.vpcClient.ReleaseEipAddressWithOptions(&vpc.ReleaseEipAddressRequest{
+					RegionId:     tea.String(p.region),
+					AllocationId: tea.String(allocationID),
+				}, &util.RuntimeOptions{})
+			})
+			return err
+		}); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("releasing elastic IP address %s, %w", allocationID, err))
+		}
+	}
+	return errs
+}
+
+// retryIncorrectStatus retries the operation with eipBackoff while the resource it operates on is transitioning
+func retryIncorrectStatus(ctx context.Context, operation func() error) error {
+	var err error
+	if waitErr := wait.ExponentialBackoffWithContext(ctx, eipBackoff, func(context.Context) (bool, error) {
+		err = operation()
+		if alierrors.IsIncorrectStatus(err) {
+			return false, nil
+		}
+		return true, err
+	}); waitErr != nil && err == nil {
+		return waitErr
+	}
+	return err
+}
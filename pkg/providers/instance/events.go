@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"errors"
+	"fmt"
+
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/events"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+)
+
+const (
+	launchFailureReasonInsufficientCapacity = "InsufficientCapacity"
+	launchFailureReasonUnauthorized         = "Unauthorized"
+	launchFailureReasonQuotaExceeded        = "QuotaExceeded"
+	launchFailureReasonInsufficientBalance  = "InsufficientBalance"
+	launchFailureReasonLaunchFailed         = "LaunchFailed"
+
+	// maxEventMessageLength keeps the error messages of the SDK, which include the whole response, readable
+	maxEventMessageLength = 500
+)
+
+func LaunchFailedEvent(nodeClaim *karpv1.NodeClaim, reason string, err error) events.Event {
+	message := fmt.Sprintf("Failed to launch instance, %s", err)
+	if len(message) > maxEventMessageLength {
+		message = message[:maxEventMessageLength] + "..."
+	}
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           corev1.EventTypeWarning,
+		Reason:         reason,
+		Message:        message,
+		DedupeValues:   []string{string(nodeClaim.UID), reason},
+	}
+}
+
+func MetadataOptionsFailedEvent(nodeClaim *karpv1.NodeClaim, instanceID string, err error) events.Event {
+	message := fmt.Sprintf("Failed to modify the metadata options of instance %s, the metadata service is left as launched, %s", instanceID, err)
+	if len(message) > maxEventMessageLength {
+		message = message[:maxEventMessageLength] + "..."
+	}
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           corev1.EventTypeWarning,
+		Reason:         "MetadataOptionsFailed",
+		Message:        message,
+		DedupeValues:   []string{string(nodeClaim.UID), instanceID},
+	}
+}
+
+func DeploymentSetFullEvent(nodeClaim *karpv1.NodeClaim, deploymentSetID string, zones []string) events.Event {
+	return events.Event{
+		InvolvedObject: nodeClaim,
+		Type:           corev1.EventTypeWarning,
+		Reason:         "DeploymentSetFull",
+		Message: fmt.Sprintf("Deployment set %s can't place more instances in %s, falling back to the other zones",
+			deploymentSetID, utils.PrettySlice(zones, 5)),
+		DedupeValues: []string{string(nodeClaim.UID), deploymentSetID},
+	}
+}
+
+// publishDeploymentSetFull publishes an event on the NodeClaim when its deployment set can't place more instances
+// in some zones. The offerings of these zones are marked unavailable, so the launch is retried in the other zones.
+func (p *DefaultProvider) publishDeploymentSetFull(nodeClaim *karpv1.NodeClaim, request *ecsclient.CreateAutoProvisioningGroupRequest,
+	resp *ecsclient.CreateAutoProvisioningGroupResponse,
+) {
+	deploymentSetID := tea.StringValue(request.LaunchConfiguration.DeploymentSetId)
+	if deploymentSetID == "" || resp == nil || resp.Body == nil || resp.Body.LaunchResults == nil {
+		return
+	}
+	zones := lo.Uniq(lo.FilterMap(lo.Compact(resp.Body.LaunchResults.LaunchResult), func(lr *ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult, _ int) (string, bool) {
+		return tea.StringValue(lr.ZoneId), tea.StringValue(lr.ErrorCode) == alierrors.ErrCodeDeploymentSetNoCapacity
+	}))
+	if len(zones) == 0 {
+		return
+	}
+	p.recorder.Publish(DeploymentSetFullEvent(nodeClaim, deploymentSetID, zones))
+}
+
+// publishLaunchFailure publishes an event on the NodeClaim when its launch failed with an error the user has to act on.
+// The transient errors are retried, so they are only logged.
+func (p *DefaultProvider) publishLaunchFailure(nodeClaim *karpv1.NodeClaim, err error) {
+	if reason, ok := launchFailureReason(err); ok {
+		p.recorder.Publish(LaunchFailedEvent(nodeClaim, reason, err))
+	}
+}
+
+// launchFailureReason normalizes the error of a failed launch into the reason of its event
+func launchFailureReason(err error) (string, bool) {
+	if cloudprovider.IsInsufficientCapacityError(err) {
+		return launchFailureReasonInsufficientCapacity, true
+	}
+	var createError *cloudprovider.CreateError
+	if !errors.As(err, &createError) {
+		return "", false
+	}
+	switch code := createError.ConditionReason; {
+	case code == alierrors.ErrCodeDryRunOperation:
+		return "", false
+	case alierrors.IsUnauthorizedCode(code):
+		return launchFailureReasonUnauthorized, true
+	case alierrors.IsQuotaExceededCode(code):
+		return launchFailureReasonQuotaExceeded, true
+	case alierrors.IsBalanceCode(code):
+		return launchFailureReasonInsufficientBalance, true
+	default:
+		return launchFailureReasonLaunchFailed, true
+	}
+}
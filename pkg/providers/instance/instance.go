@@ -18,26 +18,28 @@ package instance
 
 import (
 	"context"
-	"crypto/rand"
 	"errors"
 	"fmt"
 	"math"
-	"math/big"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
 	util "github.com/alibabacloud-go/tea-utils/v2/service"
 	"github.com/alibabacloud-go/tea/tea"
+	"github.com/mitchellh/hashstructure/v2"
 	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
 	"go.uber.org/multierr"
 	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
-	"sigs.k8s.io/controller-runtime/pkg/log"
+	"k8s.io/apimachinery/pkg/util/sets"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/events"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
 	"sigs.k8s.io/karpenter/pkg/utils/resources"
 
@@ -47,8 +49,12 @@ import (
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/cluster"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/imagefamily"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/quota"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/vswitch"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/logging"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
 )
 
 const (
@@ -56,7 +62,22 @@ const (
 	instanceTypeFlexibilityThreshold       = 5 // falling back to on-demand without flexibility risks insufficient capacity errors
 	maxInstanceTypes                       = 20
 	instanceCacheExpiration                = 15 * time.Second
+	zoneLaunchesExpiration                 = 5 * time.Minute
+	deploymentSetCacheExpiration           = time.Hour
 	defaultDataDiskSize              int32 = 20
+
+	// maxInstanceTags is the max number of tags of an ECS instance
+	maxInstanceTags = 20
+
+	// describeInstancesMaxResults is the max page size of DescribeInstances
+	describeInstancesMaxResults int32 = 100
+
+	defaultMetadataHTTPEndpoint = "enabled"
+	defaultMetadataHTTPTokens   = "required"
+
+	// Ref: https://api.aliyun.com/api/Ecs/2014-05-26/CreateAutoProvisioningGroup
+	ResourcePoolStrategyPrivatePoolFirst = "PrivatePoolFirst"
+	ResourcePoolStrategyPrivatePoolOnly  = "PrivatePoolOnly"
 )
 
 type Provider interface {
@@ -65,33 +86,61 @@ type Provider interface {
 	List(context.Context) ([]*Instance, error)
 	Delete(context.Context, string) error
 	CreateTags(context.Context, string, map[string]string) error
+	DeleteTags(context.Context, string, []string) error
 }
 
 type DefaultProvider struct {
-	ecsClient            *ecsclient.Client
+	ecsClient            client.ECSClient
+	vpcClient            client.VPCClient
+	rateLimiter          *ratelimit.RateLimiter
 	region               string
 	instanceCache        *cache.Cache
 	unavailableOfferings *kcache.UnavailableOfferings
+	// zoneLaunches is the zone of each recently launched instance, key: instance ID, value: zone
+	zoneLaunches *cache.Cache
+	// deploymentSetCache is the ID of each managed deployment set, key: deployment set name, value: ID
+	deploymentSetCache *cache.Cache
+	deploymentSetMu    sync.Mutex
+	// accountErrors is the last account-level launch error, the launches are paused until it expires
+	accountErrors *cache.Cache
 
 	imageFamilyResolver imagefamily.Resolver
 	vSwitchProvider     vswitch.Provider
 	clusterProvider     cluster.Provider
+	quotaProvider       quota.Provider
 	createLimiter       *rate.Limiter
+	// launchSlots limits the launches in flight, it's nil when they're not limited
+	launchSlots chan struct{}
+	// launchBatches is the batch of identical launches waiting for the end of their batch window, key: launch batch key
+	launchBatches   map[uint64]*launchBatch
+	launchBatchesMu sync.Mutex
+	recorder        events.Recorder
 }
 
-func NewDefaultProvider(ctx context.Context, region string, ecsClient *ecsclient.Client, unavailableOfferings *kcache.UnavailableOfferings,
+func NewDefaultProvider(ctx context.Context, region string, ecsClient client.ECSClient, vpcClient client.VPCClient, rateLimiter *ratelimit.RateLimiter, unavailableOfferings *kcache.UnavailableOfferings,
 	imageFamilyResolver imagefamily.Resolver, vSwitchProvider vswitch.Provider,
-	clusterProvider cluster.Provider,
+	clusterProvider cluster.Provider, quotaProvider quota.Provider, recorder events.Recorder,
 ) *DefaultProvider {
 	p := &DefaultProvider{
 		ecsClient:            ecsClient,
+		vpcClient:            vpcClient,
+		rateLimiter:          rateLimiter,
 		region:               region,
 		instanceCache:        cache.New(instanceCacheExpiration, instanceCacheExpiration),
 		unavailableOfferings: unavailableOfferings,
+		zoneLaunches:         cache.New(zoneLaunchesExpiration, zoneLaunchesExpiration),
+		deploymentSetCache:   cache.New(deploymentSetCacheExpiration, deploymentSetCacheExpiration),
+		accountErrors:        cache.New(cache.NoExpiration, kcache.DefaultCleanupInterval),
+		launchBatches:        map[uint64]*launchBatch{},
 		createLimiter:        rate.NewLimiter(rate.Limit(1), options.FromContext(ctx).APGCreationQPS),
 		imageFamilyResolver:  imageFamilyResolver,
 		vSwitchProvider:      vSwitchProvider,
 		clusterProvider:      clusterProvider,
+		quotaProvider:        quotaProvider,
+		recorder:             recorder,
+	}
+	if limit := options.FromContext(ctx).MaxConcurrentLaunches; limit > 0 {
+		p.launchSlots = make(chan struct{}, limit)
 	}
 
 	return p
@@ -100,9 +149,13 @@ func NewDefaultProvider(ctx context.Context, region string, ecsClient *ecsclient
 func (p *DefaultProvider) Create(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim,
 	instanceTypes []*cloudprovider.InstanceType,
 ) (*Instance, error) {
+	if err := p.accountError(); err != nil {
+		p.publishLaunchFailure(nodeClaim, err)
+		return nil, err
+	}
 	// Wait for rate limiter
 	if err := p.createLimiter.Wait(ctx); err != nil {
-		log.FromContext(ctx).Error(err, "rate limit exceeded")
+		logging.ForNodeClaim(ctx, nodeClaim).Error(err, "rate limit exceeded")
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 	schedulingRequirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...)
@@ -114,13 +167,100 @@ func (p *DefaultProvider) Create(ctx context.Context, nodeClass *v1alpha1.ECSNod
 	if err != nil {
 		return nil, fmt.Errorf("truncating instance types, %w", err)
 	}
-	tags := getTags(ctx, nodeClass, nodeClaim)
-	launchInstance, createAutoProvisioningGroupRequest, err := p.launchInstance(ctx, nodeClass, nodeClaim, instanceTypes, tags)
+	tags, err := getTags(ctx, nodeClass, nodeClaim)
 	if err != nil {
+		return nil, fmt.Errorf("getting tags, %w", err)
+	}
+	capacityType := p.launchCapacityType(nodeClass, nodeClaim, instanceTypes)
+	start := time.Now()
+	launchInstance, createAutoProvisioningGroupRequest, err := p.launchInstance(ctx, nodeClass, nodeClaim, instanceTypes, capacityType, tags)
+	recordLaunch(capacityType, time.Since(start), err)
+	if fallbackToOnDemand(nodeClaim, instanceTypes, capacityType, err) {
+		logging.ForNodeClaim(ctx, nodeClaim).V(1).Info("falling back to on-demand, the spot offerings are sold out")
+		capacityType = karpv1.CapacityTypeOnDemand
+		start = time.Now()
+		launchInstance, createAutoProvisioningGroupRequest, err = p.launchInstance(ctx, nodeClass, nodeClaim, instanceTypes, capacityType, tags)
+		recordLaunch(capacityType, time.Since(start), err)
+	}
+	if err != nil {
+		p.recordAccountError(ctx, err)
+		p.publishLaunchFailure(nodeClaim, err)
+		return nil, err
+	}
+
+	instance := NewInstanceFromProvisioningGroup(launchInstance, createAutoProvisioningGroupRequest, p.region)
+	// The launch result doesn't tell which of the capacity reservations the instance is launched into, if any, so the
+	// instance is described. A failure leaves the NodeClaim without the capacity reservation label.
+	if instance.CapacityReservationID == "" && createAutoProvisioningGroupRequest.ResourcePoolOptions != nil {
+		if launched, err := p.Get(ctx, instance.ID); err != nil {
+			logging.ForNodeClaim(ctx, nodeClaim).V(1).Info("failed resolving the capacity reservation of the instance", "instance", instance.ID, "error", err.Error())
+		} else {
+			instance.CapacityReservationID = launched.CapacityReservationID
+		}
+	}
+	p.zoneLaunches.SetDefault(instance.ID, instance.Zone)
+	// The instances on dedicated hosts are launched with RunInstances, which configures the metadata service itself
+	if nodeClass.Spec.Tenancy != v1alpha1.TenancyHost {
+		// The launch configuration of the auto provisioning group can't configure the metadata service, so it's only
+		// configured right after the launch when the NodeClass sets it. The instance exists already, a failure leaves
+		// the metadata service as launched instead of failing the launch.
+		if nodeClass.Spec.MetadataOptions != nil {
+			if err := p.modifyMetadataOptions(ctx, instance.ID, nodeClass.Spec.MetadataOptions); err != nil {
+				logging.ForNodeClaim(ctx, nodeClaim).Error(err, "failed modifying metadata options", "instance", instance.ID)
+				p.recorder.Publish(MetadataOptionsFailedEvent(nodeClaim, instance.ID, err))
+			}
+		}
+	}
+	if err := p.assignAddresses(ctx, nodeClass, nodeClaim, instance); err != nil {
 		return nil, err
 	}
+	return instance, nil
+}
+
+// assignAddresses assigns the IPv6 addresses and associates the elastic IP address of the ECSNodeClass with the
+// launched instance. The instance without its addresses is deleted with the elastic IP addresses associated with it,
+// so they aren't leaked when the NodeClaim is launched again.
+func (p *DefaultProvider) assignAddresses(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim, instance *Instance) error {
+	// The instances on dedicated hosts request the IPv6 addresses in the launch
+	if nodeClass.Spec.Tenancy != v1alpha1.TenancyHost {
+		if err := p.assignIPv6Addresses(ctx, nodeClass, instance.ID); err != nil {
+			return p.terminateLaunched(ctx, instance, fmt.Errorf("assigning IPv6 addresses to instance %s, %w", instance.ID, err))
+		}
+	}
+	if err := p.associateEIP(ctx, nodeClass, nodeClaim, instance.ID); err != nil {
+		return p.terminateLaunched(ctx, instance, fmt.Errorf("associating elastic IP address with instance %s, %w", instance.ID, err))
+	}
+	return nil
+}
 
-	return NewInstanceFromProvisioningGroup(launchInstance, createAutoProvisioningGroupRequest, p.region), nil
+// terminateLaunched deletes the launched instance which failed to be set up, and returns the error of the setup
+// with the one of the deletion
+func (p *DefaultProvider) terminateLaunched(ctx context.Context, instance *Instance, err error) error {
+	if e := p.terminate(ctx, instance); e != nil {
+		err = multierr.Append(err, e)
+	}
+	return err
+}
+
+func (p *DefaultProvider) modifyMetadataOptions(ctx context.Context, id string, metadataOptions *v1alpha1.MetadataOptions) error {
+	request := metadataOptionsRequest(metadataOptions)
+	request.RegionId = tea.String(p.region)
+	request.InstanceId = tea.String(id)
+
+	_, err := ratelimit.Call(ctx, p.rateLimiter, "ModifyInstanceMetadataOptions", func() (*ecsclient.ModifyInstanceMetadataOptionsResponse, error) {
+		return p.ecsClient.ModifyInstanceMetadataOptionsWithOptions(request, &util.RuntimeOptions{})
+	})
+	return err
+}
+
+// metadataOptionsRequest defaults the fields the metadata options leave out to the secure configuration of the
+// metadata service: enabled, and only accessible through the security hardening mode.
+func metadataOptionsRequest(metadataOptions *v1alpha1.MetadataOptions) *ecsclient.ModifyInstanceMetadataOptionsRequest {
+	return &ecsclient.ModifyInstanceMetadataOptionsRequest{
+		HttpEndpoint:            tea.String(lo.FromPtrOr(metadataOptions.HTTPEndpoint, defaultMetadataHTTPEndpoint)),
+		HttpTokens:              tea.String(lo.FromPtrOr(metadataOptions.HTTPTokens, defaultMetadataHTTPTokens)),
+		HttpPutResponseHopLimit: metadataOptions.HTTPPutResponseHopLimit,
+	}
 }
 
 func (p *DefaultProvider) Get(ctx context.Context, id string) (*Instance, error) {
@@ -128,25 +268,28 @@ func (p *DefaultProvider) Get(ctx context.Context, id string) (*Instance, error)
 		return instance.(*Instance), nil
 	}
 
-	// List all instances to update the cache
-	instances, err := p.List(ctx)
+	// Only the instance is described, listing all the instances of the cluster for a single lookup is wasteful
+	describeInstancesRequest := p.describeInstancesRequest(ctx)
+	describeInstancesRequest.InstanceIds = tea.String(fmt.Sprintf("[%q]", id))
+	instances, err := p.describeInstances(ctx, describeInstancesRequest)
 	if err != nil {
 		return nil, err
 	}
 	p.syncAllInstances(instances)
 
-	currentInstance, ok := p.instanceCache.Get(id)
+	currentInstance, ok := lo.Find(instances, func(instance *Instance) bool {
+		return instance.ID == id
+	})
 	if ok {
-		return currentInstance.(*Instance), nil
+		return currentInstance, nil
 	}
 
 	return nil, cloudprovider.NewNodeClaimNotFoundError(fmt.Errorf("instance not found"))
 }
 
-func (p *DefaultProvider) list(ctx context.Context) ([]*Instance, error) {
-	var instances []*Instance
-
-	describeInstancesRequest := &ecsclient.DescribeInstancesRequest{
+// describeInstancesRequest describes the instances owned by the cluster
+func (p *DefaultProvider) describeInstancesRequest(ctx context.Context) *ecsclient.DescribeInstancesRequest {
+	return &ecsclient.DescribeInstancesRequest{
 		Tag: []*ecsclient.DescribeInstancesRequestTag{
 			// TODO: add karpenter.xxx.xxx tags
 			{
@@ -154,35 +297,63 @@ func (p *DefaultProvider) list(ctx context.Context) ([]*Instance, error) {
 				Value: tea.String("owned"),
 			},
 		},
-		RegionId: tea.String(p.region),
+		RegionId:   tea.String(p.region),
+		MaxResults: tea.Int32(describeInstancesMaxResults),
 	}
+}
 
+func (p *DefaultProvider) list(ctx context.Context) ([]*Instance, error) {
+	describeInstancesRequest := p.describeInstancesRequest(ctx)
+
+	// TODO: limit 1000
+	/* Refer https://api.aliyun.com/api/Ecs/2014-05-26/DescribeInstances
+	If you use one tag to filter resources, the number of resources queried under that tag cannot exceed 1000;
+	if you use multiple tags to filter resources, the number of resources queried with multiple tags bound at the
+	same time cannot exceed 1000. If the number of resources exceeds 1000, use the ListTagResources interface to query.
+	*/
+	return p.describeInstances(ctx, describeInstancesRequest)
+}
+
+func (p *DefaultProvider) describeInstances(ctx context.Context, describeInstancesRequest *ecsclient.DescribeInstancesRequest) ([]*Instance, error) {
 	runtime := &util.RuntimeOptions{}
+	return describeInstances(describeInstancesRequest, func(request *ecsclient.DescribeInstancesRequest) (*ecsclient.DescribeInstancesResponse, error) {
+		return ratelimit.Call(ctx, p.rateLimiter, "DescribeInstances", func() (*ecsclient.DescribeInstancesResponse, error) {
+			return p.ecsClient.DescribeInstancesWithOptions(request, runtime)
+		})
+	})
+}
+
+// describeInstances pages through DescribeInstances by following the NextToken, an instance which moves between
+// pages while paging is only returned once
+func describeInstances(request *ecsclient.DescribeInstancesRequest,
+	describe func(*ecsclient.DescribeInstancesRequest) (*ecsclient.DescribeInstancesResponse, error)) ([]*Instance, error) {
+	var instances []*Instance
+	seen := sets.New[string]()
 
 	for {
-		// TODO: limit 1000
-		/* Refer https://api.aliyun.com/api/Ecs/2014-05-26/DescribeInstances
-		If you use one tag to filter resources, the number of resources queried under that tag cannot exceed 1000;
-		if you use multiple tags to filter resources, the number of resources queried with multiple tags bound at the
-		same time cannot exceed 1000. If the number of resources exceeds 1000, use the ListTagResources interface to query.
-		*/
-		resp, err := p.ecsClient.DescribeInstancesWithOptions(describeInstancesRequest, runtime)
+		resp, err := describe(request)
 		if err != nil {
 			return nil, err
 		}
-
-		if resp == nil || resp.Body == nil || resp.Body.Instances == nil || len(resp.Body.Instances.Instance) == 0 {
+		if resp == nil || resp.Body == nil {
 			break
 		}
 
-		describeInstancesRequest.NextToken = resp.Body.NextToken
-		for i := range resp.Body.Instances.Instance {
-			instances = append(instances, NewInstance(resp.Body.Instances.Instance[i]))
+		if resp.Body.Instances != nil {
+			for _, instance := range resp.Body.Instances.Instance {
+				if instance == nil || seen.Has(tea.StringValue(instance.InstanceId)) {
+					continue
+				}
+				seen.Insert(tea.StringValue(instance.InstanceId))
+				instances = append(instances, NewInstance(instance))
+			}
 		}
 
-		if resp.Body.NextToken == nil || *resp.Body.NextToken == "" {
+		nextToken := tea.StringValue(resp.Body.NextToken)
+		if nextToken == "" || nextToken == tea.StringValue(request.NextToken) {
 			break
 		}
+		request.NextToken = tea.String(nextToken)
 	}
 
 	return instances, nil
@@ -204,10 +375,26 @@ func (p *DefaultProvider) Delete(ctx context.Context, id string) error {
 		return fmt.Errorf("deleting instance, %w", err)
 	}
 
-	// For follow state, the API will return an error, let's return NotSupportedError
-	if instance.Status == InstanceStatusStarting || instance.Status == InstanceStatusPending {
+	// For follow state, the API will return an error, let's return NotSupportedError. The instances stuck launching
+	// for longer than the launch timeout are force deleted, ECS may still refuse it while they're transitioning.
+	if (instance.Status == InstanceStatusStarting || instance.Status == InstanceStatusPending) && !LaunchTimedOut(ctx, instance) {
 		return NewInstanceStateOperationNotSupportedError(id)
 	}
+	return p.terminate(ctx, instance)
+}
+
+// terminate force deletes the instance whatever its status, and releases the elastic IP addresses karpenter
+// allocated for it
+func (p *DefaultProvider) terminate(ctx context.Context, instance *Instance) error {
+	id := instance.ID
+	// The elastic IP addresses are looked up before the instance is released, which unassociates them
+	var eips []string
+	var err error
+	if _, ok := instance.Tags[v1alpha1.TagEIPAssociation]; ok {
+		if eips, err = p.listEIPs(ctx, id); err != nil {
+			return fmt.Errorf("deleting instance, %w", err)
+		}
+	}
 
 	deleteInstanceRequest := &ecsclient.DeleteInstanceRequest{
 		InstanceId:            tea.String(id),
@@ -217,21 +404,30 @@ func (p *DefaultProvider) Delete(ctx context.Context, id string) error {
 
 	runtime := &util.RuntimeOptions{}
 	if _, err := p.ecsClient.DeleteInstanceWithOptions(deleteInstanceRequest, runtime); err != nil {
+		// The instance has been released, e.g. out-of-band or by a previous delete
 		if alierrors.IsNotFound(err) {
+			p.instanceCache.Delete(id)
+			InstanceTerminationTotal.Inc(map[string]string{resultLabel: resultNotFound})
 			return cloudprovider.NewNodeClaimNotFoundError(fmt.Errorf("instance already terminated"))
 		}
 
 		if _, e := p.Get(ctx, id); e != nil {
 			if cloudprovider.IsNodeClaimNotFoundError(e) {
+				InstanceTerminationTotal.Inc(map[string]string{resultLabel: resultNotFound})
 				return e
 			}
 			err = multierr.Append(err, e)
 		}
 
+		InstanceTerminationTotal.Inc(map[string]string{resultLabel: resultFailure})
 		return fmt.Errorf("terminating instance id: %s, %w", id, err)
 	}
 
 	p.instanceCache.Delete(id)
+	InstanceTerminationTotal.Inc(map[string]string{resultLabel: resultSuccess})
+	if err := p.releaseEIPs(ctx, eips); err != nil {
+		logging.FromContext(ctx).Error(err, "failed releasing elastic IP addresses of instance", "id", id)
+	}
 	return nil
 }
 
@@ -268,6 +464,28 @@ func (p *DefaultProvider) CreateTags(ctx context.Context, id string, tags map[st
 	return err
 }
 
+func (p *DefaultProvider) DeleteTags(_ context.Context, id string, keys []string) error {
+	removeTagsRequest := &ecsclient.RemoveTagsRequest{
+		RegionId:     tea.String(p.region),
+		ResourceType: tea.String("instance"),
+		ResourceId:   tea.String(id),
+		Tag: lo.Map(keys, func(key string, _ int) *ecsclient.RemoveTagsRequestTag {
+			return &ecsclient.RemoveTagsRequestTag{Key: tea.String(key)}
+		}),
+	}
+
+	runtime := &util.RuntimeOptions{}
+	if _, err := p.ecsClient.RemoveTagsWithOptions(removeTagsRequest, runtime); err != nil {
+		if alierrors.IsNotFound(err) {
+			return cloudprovider.NewNodeClaimNotFoundError(fmt.Errorf("untagging instance, %w", err))
+		}
+		return fmt.Errorf("untagging instance, %w", err)
+	}
+	// The cached instance still has the removed tags
+	p.instanceCache.Delete(id)
+	return nil
+}
+
 // filterInstanceTypes is used to provide filtering on the list of potential instance types to further limit it to those
 // that make the most sense given our specific Alibaba Cloud cloudprovider.
 func (p *DefaultProvider) filterInstanceTypes(nodeClaim *karpv1.NodeClaim, instanceTypes []*cloudprovider.InstanceType) []*cloudprovider.InstanceType {
@@ -358,23 +576,82 @@ func filterUnwantedSpot(instanceTypes []*cloudprovider.InstanceType) []*cloudpro
 	return instanceTypes
 }
 
-func getTags(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim) map[string]string {
+// getTags returns the tags of the instance, the user tags of the ECSNodeClass never override the tags of karpenter.
+// The Name tag is added by the tagging controller once the node is registered, so it's counted against the limit too.
+func getTags(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim) (map[string]string, error) {
 	staticTags := map[string]string{
 		fmt.Sprintf("kubernetes.io/cluster/%s", options.FromContext(ctx).ClusterID): "owned",
 		karpv1.NodePoolLabelKey:     nodeClaim.Labels[karpv1.NodePoolLabelKey],
 		v1alpha1.ECSClusterIDTagKey: options.FromContext(ctx).ClusterID,
 		v1alpha1.LabelNodeClass:     nodeClass.Name,
+		v1alpha1.TagNodeClaim:       nodeClaim.Name,
+		v1alpha1.TagUserDataHash:    nodeClass.UserDataHash(),
+	}
+	userTags, err := UserTags(ctx, nodeClass, nodeClaim)
+	if err != nil {
+		return nil, err
+	}
+	if nodeClass.Spec.EIPAssociation != nil {
+		staticTags[v1alpha1.TagEIPAssociation] = "true"
+	}
+	tags := lo.Assign(userTags, staticTags)
+	if count := len(lo.Assign(tags, map[string]string{v1alpha1.TagName: ""})); count > maxInstanceTags {
+		return nil, fmt.Errorf("instance would have %d tags including the ones of karpenter, exceeding the limit of %d tags per instance", count, maxInstanceTags)
 	}
-	return lo.Assign(nodeClass.Spec.Tags, staticTags)
+	return tags, nil
+}
+
+// UserTags returns the tags of the ECSNodeClass rendered for the instance of the NodeClaim
+func UserTags(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim) (map[string]string, error) {
+	userTags := make(map[string]string, len(nodeClass.Spec.Tags))
+	for key, value := range nodeClass.Spec.Tags {
+		rendered, err := v1alpha1.RenderTagValue(value, templateData(ctx, nodeClass, nodeClaim))
+		if err != nil {
+			return nil, fmt.Errorf("tag %s, %w", key, err)
+		}
+		userTags[key] = rendered
+	}
+	return userTags, nil
+}
+
+// getHostname returns the hostname of the instance rendered from the hostname template of the ECSNodeClass,
+// it's empty without a template
+func getHostname(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim) (string, error) {
+	if nodeClass.Spec.HostnameTemplate == "" {
+		return "", nil
+	}
+	return v1alpha1.RenderHostname(nodeClass.Spec.HostnameTemplate, templateData(ctx, nodeClass, nodeClaim))
+}
+
+// templateData returns the data the tag values, the hostname and the instance name templates of the instance are
+// rendered with
+func templateData(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim) v1alpha1.TagTemplateData {
+	return v1alpha1.TagTemplateData{
+		ClusterID: options.FromContext(ctx).ClusterID,
+		NodePool:  nodeClaim.Labels[karpv1.NodePoolLabelKey],
+		NodeClass: nodeClass.Name,
+		NodeClaim: nodeClaim.Name,
+	}
+}
+
+// launchCapacityType returns the capacity type the instance is launched with
+func (p *DefaultProvider) launchCapacityType(nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim, instanceTypes []*cloudprovider.InstanceType) string {
+	// Dedicated hosts are pay-as-you-go only
+	if nodeClass.Spec.Tenancy == v1alpha1.TenancyHost {
+		return karpv1.CapacityTypeOnDemand
+	}
+	return p.getCapacityType(nodeClaim, instanceTypes)
 }
 
 func (p *DefaultProvider) launchInstance(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim, instanceTypes []*cloudprovider.InstanceType,
-	tags map[string]string,
+	capacityType string, tags map[string]string,
 ) (*ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult, *ecsclient.CreateAutoProvisioningGroupRequest, error) {
 	if err := p.checkODFallback(nodeClaim, instanceTypes); err != nil {
-		log.FromContext(ctx).Error(err, "failed while checking on-demand fallback")
+		logging.ForNodeClaim(ctx, nodeClaim).Error(err, "failed while checking on-demand fallback")
+	}
+	if err := p.checkQuota(ctx, instanceTypes, capacityType); err != nil {
+		return nil, nil, err
 	}
-	capacityType := p.getCapacityType(nodeClaim, instanceTypes)
 	zonalVSwitchs, err := p.vSwitchProvider.ZonalVSwitchesForLaunch(ctx, nodeClass, instanceTypes, capacityType)
 	if err != nil {
 		return nil, nil, fmt.Errorf("getting vSwitches, %w", err)
@@ -385,97 +662,169 @@ func (p *DefaultProvider) launchInstance(ctx context.Context, nodeClass *v1alpha
 		return nil, nil, fmt.Errorf("getting provisioning group, %w", err)
 	}
 
-	runtime := &util.RuntimeOptions{}
-	resp, err := p.ecsClient.CreateAutoProvisioningGroupWithOptions(createAutoProvisioningGroupRequest, runtime)
-	if err != nil {
-		return nil, nil, fmt.Errorf("creating auto provisioning group, %w", err)
+	if nodeClass.Spec.Tenancy == v1alpha1.TenancyHost {
+		launchResult, err := p.launchOnDedicatedHost(ctx, nodeClass, createAutoProvisioningGroupRequest, instanceTypes, zonalVSwitchs)
+		if err != nil {
+			return nil, nil, err
+		}
+		return launchResult, createAutoProvisioningGroupRequest, nil
 	}
 
-	p.updateUnavailableOfferingsCache(ctx, resp, capacityType)
+	if options.FromContext(ctx).DryRun {
+		return nil, nil, p.dryRunProvisioningGroup(ctx, createAutoProvisioningGroupRequest, capacityType)
+	}
 
-	if err := createAutoProvisioningGroupResponseHandler(resp); err != nil {
+	if window := options.FromContext(ctx).LaunchBatchWindow; window > 0 {
+		launchResult, err := p.launchBatched(ctx, nodeClaim, createAutoProvisioningGroupRequest, capacityType, window)
+		if err != nil {
+			return nil, nil, err
+		}
+		return launchResult, createAutoProvisioningGroupRequest, nil
+	}
+
+	resp, err := p.createAutoProvisioningGroup(ctx, createAutoProvisioningGroupRequest, capacityType)
+	if err != nil {
 		return nil, nil, err
 	}
+	p.publishDeploymentSetFull(nodeClaim, createAutoProvisioningGroupRequest, resp)
 
-	return resp.Body.LaunchResults.LaunchResult[0], createAutoProvisioningGroupRequest, nil
+	launchResult, err := createAutoProvisioningGroupResponseHandler(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return launchResult, createAutoProvisioningGroupRequest, nil
 }
 
-const (
-	ErrCodeNoInstanceStock        = "NoInstanceStock"
-	ErrCodeOperationDeniedNoStock = "OperationDenied.NoStock"
-)
+// createAutoProvisioningGroup creates the auto provisioning group in one of the launch slots, and marks the offerings
+// which are sold out unavailable
+func (p *DefaultProvider) createAutoProvisioningGroup(ctx context.Context, request *ecsclient.CreateAutoProvisioningGroupRequest,
+	capacityType string,
+) (*ecsclient.CreateAutoProvisioningGroupResponse, error) {
+	release, err := p.acquireLaunchSlot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for a launch slot, %w", err)
+	}
+	resp, err := p.ecsClient.CreateAutoProvisioningGroupWithOptions(request, &util.RuntimeOptions{})
+	release()
+	if err != nil {
+		if code := alierrors.ErrorCode(err); alierrors.IsLaunchFailureCode(code) {
+			return nil, cloudprovider.NewCreateError(fmt.Errorf("creating auto provisioning group, %w", err), code, err.Error())
+		}
+		return nil, fmt.Errorf("creating auto provisioning group, %w", err)
+	}
+
+	p.updateUnavailableOfferingsCache(ctx, resp, capacityType)
+	return resp, nil
+}
 
+// updateUnavailableOfferingsCache marks the offerings which failed to launch because they are sold out as unavailable
+// for the insufficient capacity cooldown, so that they are not picked again until the stock may have recovered
 func (p *DefaultProvider) updateUnavailableOfferingsCache(ctx context.Context, resp *ecsclient.CreateAutoProvisioningGroupResponse, capacityType string) {
 	if resp == nil || resp.Body == nil || resp.Body.LaunchResults == nil || len(resp.Body.LaunchResults.LaunchResult) == 0 {
 		return
 	}
 
-	for lri := range resp.Body.LaunchResults.LaunchResult {
-		if resp.Body.LaunchResults.LaunchResult[lri] == nil {
+	for _, launchResult := range resp.Body.LaunchResults.LaunchResult {
+		if launchResult == nil {
 			continue
 		}
 
-		if (tea.StringValue(resp.Body.LaunchResults.LaunchResult[lri].ErrorCode) == ErrCodeNoInstanceStock || tea.StringValue(resp.Body.LaunchResults.LaunchResult[lri].ErrorCode) == ErrCodeOperationDeniedNoStock) &&
-			tea.StringValue(resp.Body.LaunchResults.LaunchResult[lri].InstanceType) != "" &&
-			tea.StringValue(resp.Body.LaunchResults.LaunchResult[lri].ZoneId) != "" {
-			p.unavailableOfferings.MarkUnavailable(
+		if alierrors.IsInsufficientCapacityCode(tea.StringValue(launchResult.ErrorCode)) &&
+			tea.StringValue(launchResult.InstanceType) != "" &&
+			tea.StringValue(launchResult.ZoneId) != "" {
+			p.unavailableOfferings.MarkUnavailableWithTTL(
 				ctx,
-				tea.StringValue(resp.Body.LaunchResults.LaunchResult[lri].ErrorMsg),
-				tea.StringValue(resp.Body.LaunchResults.LaunchResult[lri].InstanceType),
-				tea.StringValue(resp.Body.LaunchResults.LaunchResult[lri].ZoneId),
-				capacityType)
+				tea.StringValue(launchResult.ErrorMsg),
+				tea.StringValue(launchResult.InstanceType),
+				tea.StringValue(launchResult.ZoneId),
+				capacityType,
+				options.FromContext(ctx).InsufficientCapacityCooldown)
 		}
 	}
 }
 
-func createAutoProvisioningGroupResponseHandler(resp *ecsclient.CreateAutoProvisioningGroupResponse) error {
+// createAutoProvisioningGroupResponseHandler returns the launch result of the launched instance. The auto provisioning
+// group falls back through the launch template configs, so the offerings that failed before it are skipped. When no
+// instance is launched, a terminal error fails the launch, and only sold out offerings are an insufficient capacity error.
+func createAutoProvisioningGroupResponseHandler(resp *ecsclient.CreateAutoProvisioningGroupResponse) (*ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult, error) {
 	if resp == nil || resp.Body == nil || resp.Body.LaunchResults == nil {
-		return fmt.Errorf("invalid response when creating auto provision group: %s", tea.Prettify(resp))
+		return nil, fmt.Errorf("invalid response when creating auto provision group: %s", tea.Prettify(resp))
 	}
 
 	if tea.Int32Value(resp.StatusCode) != http.StatusOK {
-		return fmt.Errorf("unexpected status code %d when creating auto provision group: %s",
+		return nil, fmt.Errorf("unexpected status code %d when creating auto provision group: %s",
 			tea.Int32Value(resp.StatusCode), tea.Prettify(resp))
 	}
 
-	launchResults := resp.Body.LaunchResults.LaunchResult
+	launchResults := lo.Compact(resp.Body.LaunchResults.LaunchResult)
 	if len(launchResults) == 0 {
-		return fmt.Errorf("no launch results found in response: %s", tea.Prettify(resp.Body.String()))
+		return nil, fmt.Errorf("no launch results found in response: %s", tea.Prettify(resp.Body.String()))
 	}
 
-	launchResult := launchResults[0]
+	if launchResult, ok := lo.Find(launchResults, func(lr *ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult) bool {
+		return lr.InstanceIds != nil && len(lr.InstanceIds.InstanceId) != 0
+	}); ok {
+		return launchResult, nil
+	}
 
-	if tea.StringValue(launchResult.ErrorCode) == ErrCodeNoInstanceStock || tea.StringValue(launchResult.ErrorCode) == ErrCodeOperationDeniedNoStock {
-		return cloudprovider.NewInsufficientCapacityError(alierrors.WithRequestID(tea.StringValue(resp.Body.RequestId),
-			fmt.Errorf("failed to launch instance: errorCode=%s, errorMessage=%s",
-				tea.StringValue(launchResult.ErrorCode), tea.StringValue(launchResult.ErrorMsg))))
+	requestID := tea.StringValue(resp.Body.RequestId)
+	if launchResult, ok := lo.Find(launchResults, func(lr *ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult) bool {
+		return alierrors.IsLaunchFailureCode(tea.StringValue(lr.ErrorCode))
+	}); ok {
+		err := alierrors.WithRequestID(requestID, fmt.Errorf("failed to launch instance: errorCode=%s, errorMessage=%s",
+			tea.StringValue(launchResult.ErrorCode), tea.StringValue(launchResult.ErrorMsg)))
+		return nil, cloudprovider.NewCreateError(err, tea.StringValue(launchResult.ErrorCode), tea.StringValue(launchResult.ErrorMsg))
 	}
 
-	if launchResult.InstanceIds == nil || len(launchResult.InstanceIds.InstanceId) == 0 {
-		return alierrors.WithRequestID(tea.StringValue(resp.Body.RequestId),
+	launchResult := launchResults[0]
+	if lo.EveryBy(launchResults, func(lr *ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult) bool {
+		return alierrors.IsInsufficientCapacityCode(tea.StringValue(lr.ErrorCode))
+	}) {
+		return nil, cloudprovider.NewInsufficientCapacityError(alierrors.WithRequestID(requestID,
 			fmt.Errorf("failed to launch instance: errorCode=%s, errorMessage=%s",
-				tea.StringValue(launchResult.ErrorCode), tea.StringValue(launchResult.ErrorMsg)))
+				tea.StringValue(launchResult.ErrorCode), tea.StringValue(launchResult.ErrorMsg))))
 	}
 
-	return nil
+	return nil, alierrors.WithRequestID(requestID,
+		fmt.Errorf("failed to launch instance: errorCode=%s, errorMessage=%s",
+			tea.StringValue(launchResult.ErrorCode), tea.StringValue(launchResult.ErrorMsg)))
 }
 
 // getCapacityType selects spot if both constraints are flexible and there is an
 // available offering. The Alibaba Cloud Provider defaults to [ on-demand ], so spot
 // must be explicitly included in capacity type requirements.
 func (p *DefaultProvider) getCapacityType(nodeClaim *karpv1.NodeClaim, instanceTypes []*cloudprovider.InstanceType) string {
+	if hasAvailableOffering(nodeClaim, instanceTypes, karpv1.CapacityTypeSpot) {
+		return karpv1.CapacityTypeSpot
+	}
+	return karpv1.CapacityTypeOnDemand
+}
+
+// hasAvailableOffering returns whether the requirements of the NodeClaim allow the capacity type, and an available
+// offering of the capacity type is compatible with them
+func hasAvailableOffering(nodeClaim *karpv1.NodeClaim, instanceTypes []*cloudprovider.InstanceType, capacityType string) bool {
 	requirements := scheduling.NewNodeSelectorRequirementsWithMinValues(nodeClaim.Spec.Requirements...)
-	if requirements.Get(karpv1.CapacityTypeLabelKey).Has(karpv1.CapacityTypeSpot) {
-		requirements[karpv1.CapacityTypeLabelKey] = scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeSpot)
-		for _, instanceType := range instanceTypes {
-			for _, offering := range instanceType.Offerings.Available() {
-				if requirements.Compatible(offering.Requirements, scheduling.AllowUndefinedWellKnownLabels) == nil {
-					return karpv1.CapacityTypeSpot
-				}
+	if !requirements.Get(karpv1.CapacityTypeLabelKey).Has(capacityType) {
+		return false
+	}
+	requirements[karpv1.CapacityTypeLabelKey] = scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, capacityType)
+	for _, instanceType := range instanceTypes {
+		for _, offering := range instanceType.Offerings.Available() {
+			if requirements.Compatible(offering.Requirements, scheduling.AllowUndefinedWellKnownLabels) == nil {
+				return true
 			}
 		}
 	}
-	return karpv1.CapacityTypeOnDemand
+	return false
+}
+
+// fallbackToOnDemand returns whether a spot launch which failed because the spot offerings are sold out is retried
+// on-demand right away. It's only retried when the requirements of the NodeClaim allow on-demand too, a NodeClaim
+// which requires spot waits for spot capacity.
+func fallbackToOnDemand(nodeClaim *karpv1.NodeClaim, instanceTypes []*cloudprovider.InstanceType, capacityType string, err error) bool {
+	return capacityType == karpv1.CapacityTypeSpot && cloudprovider.IsInsufficientCapacityError(err) &&
+		hasAvailableOffering(nodeClaim, instanceTypes, karpv1.CapacityTypeOnDemand)
 }
 
 // mapToInstanceTypes returns a map of ImageIDs that are the most recent on creationDate to compatible instancetypes
@@ -509,13 +858,14 @@ func (p *DefaultProvider) getProvisioningGroup(ctx context.Context, nodeClass *v
 	mappedImages := mapToInstanceTypes(instanceTypes, nodeClass.Status.Images)
 
 	requirements[karpv1.CapacityTypeLabelKey] = scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, capacityType)
+	zones := p.zoneStats(instanceTypes, capacityType)
 	var launchTemplateConfigs []*ecsclient.CreateAutoProvisioningGroupRequestLaunchTemplateConfig
 	for _, instanceType := range instanceTypes {
 		if len(launchTemplateConfigs) > maxInstanceTypes-1 {
 			break
 		}
 
-		vSwitchID := p.getVSwitchID(instanceType, zonalVSwitchs, requirements, capacityType, nodeClass.Spec.VSwitchSelectionPolicy)
+		vSwitchID := getVSwitchID(instanceType, zonalVSwitchs, requirements, capacityType, nodeClass.Spec.VSwitchSelectionPolicy, zones)
 		if vSwitchID == "" {
 			continue
 		}
@@ -541,24 +891,30 @@ func (p *DefaultProvider) getProvisioningGroup(ctx context.Context, nodeClass *v
 		})
 	}
 
-	userData, err := p.buildUserData(ctx, capacityType, nodeClass, nodeClaim)
+	hostname, err := getHostname(ctx, nodeClass, nodeClaim)
+	if err != nil {
+		return nil, fmt.Errorf("getting hostname, %w", err)
+	}
+	instanceName, err := v1alpha1.RenderInstanceName(nodeClass.Spec.InstanceNameTemplate, templateData(ctx, nodeClass, nodeClaim))
+	if err != nil {
+		return nil, fmt.Errorf("getting instance name, %w", err)
+	}
+
+	userData, err := p.buildUserData(ctx, capacityType, nodeClass, nodeClaim, hostname)
 	if err != nil {
-		log.FromContext(ctx).Error(err, "Failed to resolve user data for node")
+		logging.ForNodeClaim(ctx, nodeClaim).Error(err, "Failed to resolve user data for node")
 		return nil, err
 	}
 
+	deploymentSetID, err := p.getDeploymentSetID(ctx, nodeClass, nodeClaim)
+	if err != nil {
+		return nil, fmt.Errorf("getting deployment set, %w", err)
+	}
+
 	securityGroupIDs := lo.Map(nodeClass.Status.SecurityGroups, func(item v1alpha1.SecurityGroup, index int) *string {
 		return tea.String(item.ID)
 	})
 
-	systemDisk := nodeClass.Spec.SystemDisk
-	if systemDisk == nil {
-		systemDisk = imagefamily.DefaultSystemDisk.DeepCopy()
-	}
-	if systemDisk.VolumeSize == nil {
-		systemDisk.VolumeSize = imagefamily.DefaultSystemDisk.VolumeSize
-	}
-
 	imageID, ok := mappedImages[instanceTypes[0].Name]
 	if !ok {
 		return nil, errors.New("matching image not found")
@@ -566,6 +922,7 @@ func (p *DefaultProvider) getProvisioningGroup(ctx context.Context, nodeClass *v
 
 	// Convert bytes to GiB
 	createAutoProvisioningGroupRequest := &ecsclient.CreateAutoProvisioningGroupRequest{
+		ClientToken:                     tea.String(clientToken(nodeClaim, capacityType, launchTemplateConfigs)),
 		RegionId:                        tea.String(p.region),
 		TotalTargetCapacity:             tea.String("1"),
 		SpotAllocationStrategy:          tea.String("lowest-price"),
@@ -577,51 +934,108 @@ func (p *DefaultProvider) getProvisioningGroup(ctx context.Context, nodeClass *v
 			// TODO: we should set image id for each instance types after alibabacloud supports
 			ImageId:          tea.String(imageID),
 			UserData:         tea.String(userData),
-			ResourceGroupId:  tea.String(nodeClass.Spec.ResourceGroupID),
+			ResourceGroupId:  tea.String(options.ResourceGroupID(ctx, nodeClass)),
 			SecurityGroupIds: securityGroupIDs,
-			SystemDiskSize:   tea.Int32(systemDisk.GetGiBSize()),
 			Tag:              reqTags,
-			KeyPairName:      tea.String(nodeClass.Spec.KeyPairName),
+			KeyPairName:      lo.EmptyableToPtr(nodeClass.Spec.KeyPairName),
 			Password:         tea.String(nodeClass.Spec.Password),
 			PasswordInherit:  tea.Bool(nodeClass.Spec.PasswordInherit),
+			DeploymentSetId:  lo.EmptyableToPtr(deploymentSetID),
+			RamRoleName:      lo.EmptyableToPtr(nodeClass.Spec.RAMRoleName),
+			HostName:         lo.EmptyableToPtr(hostname),
+			InstanceName:     tea.String(instanceName),
+			// A public IP address is assigned when the bandwidth is greater than 0
+			InternetMaxBandwidthOut: nodeClass.Spec.InternetMaxBandwidthOut,
 		},
 		// Add this tag to auto-provisioning-group, alibabacloud will monitor the requests and enhance the stability
 		Tag: []*ecsclient.CreateAutoProvisioningGroupRequestTag{
 			{Key: tea.String(apis.Group + "/autoprovisiongroup"), Value: tea.String("true")},
 		},
-
-		SystemDiskConfig: lo.Map(systemDisk.Categories, func(category string, _ int) *ecsclient.CreateAutoProvisioningGroupRequestSystemDiskConfig {
-			return &ecsclient.CreateAutoProvisioningGroupRequestSystemDiskConfig{
-				DiskCategory: &category,
-			}
-		}),
 	}
 
-	if nodeClass.Spec.DataDisks != nil && nodeClass.Spec.DataDisksCategories != nil {
-		createAutoProvisioningGroupRequest.LaunchConfiguration.DataDisk = lo.Map(nodeClass.Spec.DataDisks, func(dataDisk v1alpha1.DataDisk, index int) *ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationDataDisk {
-			return &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationDataDisk{
-				Size:   tea.Int32(max(defaultDataDiskSize, dataDisk.GetGiBSize())),
-				Device: dataDisk.Device,
-			}
-		})
-		createAutoProvisioningGroupRequest.DataDiskConfig = lo.Map(nodeClass.Spec.DataDisksCategories, func(category string, index int) *ecsclient.CreateAutoProvisioningGroupRequestDataDiskConfig {
-			return &ecsclient.CreateAutoProvisioningGroupRequestDataDiskConfig{
-				DiskCategory: &category,
-			}
-		})
-	}
+	image, _ := lo.Find(nodeClass.Status.Images, func(image v1alpha1.Image) bool { return image.ID == imageID })
+	setSystemDisk(createAutoProvisioningGroupRequest, nodeClass, image.Size)
+	createAutoProvisioningGroupRequest.LaunchConfiguration.DataDisk, createAutoProvisioningGroupRequest.DataDiskConfig = dataDisks(nodeClass)
 
 	if capacityType == karpv1.CapacityTypeSpot {
 		createAutoProvisioningGroupRequest.SpotTargetCapacity = tea.String("1")
 		createAutoProvisioningGroupRequest.PayAsYouGoTargetCapacity = tea.String("0")
+		if err := setSpotPriceLimit(createAutoProvisioningGroupRequest, nodeClass); err != nil {
+			return nil, err
+		}
 	} else {
 		createAutoProvisioningGroupRequest.SpotTargetCapacity = tea.String("0")
 		createAutoProvisioningGroupRequest.PayAsYouGoTargetCapacity = tea.String("1")
+		createAutoProvisioningGroupRequest.ResourcePoolOptions = resourcePoolOptions(nodeClass, requirements, launchTemplateConfigs, zonalVSwitchs)
 	}
 
 	return createAutoProvisioningGroupRequest, nil
 }
 
+// resourcePoolOptions returns the capacity reservations to launch the on-demand instance into. A NodeClaim requiring
+// the capacity reservation id is only launched into the required capacity reservations, otherwise the capacity
+// reservations of the candidate offerings are tried before the public pool.
+func resourcePoolOptions(nodeClass *v1alpha1.ECSNodeClass, requirements scheduling.Requirements,
+	launchTemplateConfigs []*ecsclient.CreateAutoProvisioningGroupRequestLaunchTemplateConfig, zonalVSwitchs map[string]*vswitch.VSwitch,
+) *ecsclient.CreateAutoProvisioningGroupRequestResourcePoolOptions {
+	if requirements.Has(v1alpha1.LabelCapacityReservationID) {
+		requirement := requirements.Get(v1alpha1.LabelCapacityReservationID)
+		if requirement.Operator() != corev1.NodeSelectorOpIn {
+			return nil
+		}
+		return &ecsclient.CreateAutoProvisioningGroupRequestResourcePoolOptions{
+			Strategy:       tea.String(ResourcePoolStrategyPrivatePoolOnly),
+			PrivatePoolIds: tea.StringSlice(sets.List(sets.New(requirement.Values()...))),
+		}
+	}
+
+	zoneByVSwitch := map[string]string{}
+	for zone, vSwitch := range zonalVSwitchs {
+		zoneByVSwitch[vSwitch.ID] = zone
+	}
+	privatePoolIDs := sets.New[string]()
+	for _, config := range launchTemplateConfigs {
+		for _, cr := range nodeClass.Status.CapacityReservations {
+			if cr.AvailableInstanceCount > 0 && cr.InstanceType == tea.StringValue(config.InstanceType) &&
+				cr.ZoneID == zoneByVSwitch[tea.StringValue(config.VSwitchId)] {
+				privatePoolIDs.Insert(cr.ID)
+			}
+		}
+	}
+	if privatePoolIDs.Len() == 0 {
+		return nil
+	}
+	return &ecsclient.CreateAutoProvisioningGroupRequestResourcePoolOptions{
+		Strategy:       tea.String(ResourcePoolStrategyPrivatePoolFirst),
+		PrivatePoolIds: tea.StringSlice(sets.List(privatePoolIDs)),
+	}
+}
+
+// setSpotPriceLimit caps the price of the spot instance with the SpotWithPriceLimit strategy, the auto provisioning
+// group bids the market price without a MaxSpotPrice, which is the SpotAsPriceGo strategy
+func setSpotPriceLimit(request *ecsclient.CreateAutoProvisioningGroupRequest, nodeClass *v1alpha1.ECSNodeClass) error {
+	if nodeClass.Spec.SpotStrategy != v1alpha1.SpotStrategySpotWithPriceLimit {
+		return nil
+	}
+	priceLimit, err := strconv.ParseFloat(lo.FromPtr(nodeClass.Spec.SpotPriceLimit), 32)
+	if err != nil || priceLimit <= 0 {
+		return cloudprovider.NewCreateError(fmt.Errorf("invalid spot price limit %q", lo.FromPtr(nodeClass.Spec.SpotPriceLimit)),
+			"InvalidSpotPriceLimit", "spotPriceLimit must be a positive price")
+	}
+	request.MaxSpotPrice = tea.Float32(float32(priceLimit))
+	return nil
+}
+
+// clientToken makes the launch of a NodeClaim idempotent, AlibabaCloud deduplicates the requests with the same token
+// so a retry after a timed out request that actually succeeded does not create another instance. The candidate
+// offerings are part of the token, since a retry with other offerings (eg: after sold out) is a new launch.
+func clientToken(nodeClaim *karpv1.NodeClaim, capacityType string,
+	launchTemplateConfigs []*ecsclient.CreateAutoProvisioningGroupRequestLaunchTemplateConfig) string {
+	hash := lo.Must(hashstructure.Hash([]any{capacityType, launchTemplateConfigs}, hashstructure.FormatV2, nil))
+	// The token is at most 64 ASCII characters
+	return fmt.Sprintf("%s-%016x", nodeClaim.UID, hash)
+}
+
 func (p *DefaultProvider) checkODFallback(nodeClaim *karpv1.NodeClaim, instanceTypes []*cloudprovider.InstanceType) error {
 	// only evaluate for on-demand fallback if the capacity type for the request is OD and both OD and spot are allowed in requirements
 	if p.getCapacityType(nodeClaim, instanceTypes) != karpv1.CapacityTypeOnDemand ||
@@ -636,38 +1050,119 @@ func (p *DefaultProvider) checkODFallback(nodeClaim *karpv1.NodeClaim, instanceT
 	return nil
 }
 
-func (p *DefaultProvider) getVSwitchID(instanceType *cloudprovider.InstanceType,
-	zonalVSwitchs map[string]*vswitch.VSwitch, reqs scheduling.Requirements, capacityType string, vSwitchSelectionPolicy string,
+// getVSwitchID returns the vSwitch to launch the instance type in. The zones with a capacity reservation of the instance
+// type are preferred. For different AZ, the spot price may differ, so the cheapest zones are preferred for spot unless
+// the vSwitches are balanced. The zone stats decide between equal zones.
+func getVSwitchID(instanceType *cloudprovider.InstanceType, zonalVSwitchs map[string]*vswitch.VSwitch, reqs scheduling.Requirements,
+	capacityType string, vSwitchSelectionPolicy string, zones zoneStats,
 ) string {
-	cheapestVSwitchID := ""
-	cheapestPrice := math.MaxFloat64
+	ignorePrice := capacityType == karpv1.CapacityTypeOnDemand || vSwitchSelectionPolicy == v1alpha1.VSwitchSelectionPolicyBalanced
 
-	if capacityType == karpv1.CapacityTypeOnDemand || vSwitchSelectionPolicy == v1alpha1.VSwitchSelectionPolicyBalanced {
-		// For on-demand, randomly select a zone's vswitch
-		zoneIDs := lo.Keys(zonalVSwitchs)
-		if len(zoneIDs) > 0 {
-			randomIndex, _ := rand.Int(rand.Reader, big.NewInt(int64(len(zoneIDs))))
-			return zonalVSwitchs[zoneIDs[randomIndex.Int64()]].ID
-		}
-	}
-
-	// For different AZ, the spot price may differ. So we need to get the cheapest vSwitch in the zone
-	for i := range instanceType.Offerings {
-		if reqs.Compatible(instanceType.Offerings[i].Requirements, scheduling.AllowUndefinedWellKnownLabels) != nil {
+	var candidates []*vswitch.VSwitch
+	cheapestPrice := math.MaxFloat64
+	candidatesReserved := false
+	for _, offering := range instanceType.Offerings {
+		if !offering.Available || reqs.Compatible(offering.Requirements, scheduling.AllowUndefinedWellKnownLabels) != nil {
 			continue
 		}
 
-		vswitch, ok := zonalVSwitchs[instanceType.Offerings[i].Requirements.Get(corev1.LabelTopologyZone).Any()]
+		vSwitch, ok := zonalVSwitchs[offering.Requirements.Get(corev1.LabelTopologyZone).Any()]
 		if !ok {
 			continue
 		}
-		if instanceType.Offerings[i].Price < cheapestPrice {
-			cheapestVSwitchID = vswitch.ID
-			cheapestPrice = instanceType.Offerings[i].Price
+		reserved := offering.Requirements.Get(v1alpha1.LabelCapacityReservationID).Operator() == corev1.NodeSelectorOpIn
+		if candidatesReserved && !reserved {
+			continue
+		}
+		price := lo.Ternary(ignorePrice, 0, offering.Price)
+		switch {
+		case reserved && !candidatesReserved, price < cheapestPrice:
+			cheapestPrice = price
+			candidatesReserved = reserved
+			candidates = []*vswitch.VSwitch{vSwitch}
+		case price == cheapestPrice:
+			candidates = append(candidates, vSwitch)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return ""
+	}
+	return zones.pick(candidates).ID
+}
+
+// dataDisks returns the data disks to attach at launch and the categories the auto provisioning group tries for the
+// data disks without a category. The data disks are only attached when every one of them has a category to be created in.
+func dataDisks(nodeClass *v1alpha1.ECSNodeClass) ([]*ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationDataDisk, []*ecsclient.CreateAutoProvisioningGroupRequestDataDiskConfig) {
+	if len(nodeClass.Spec.DataDisks) == 0 {
+		return nil, nil
+	}
+	if nodeClass.Spec.DataDisksCategories == nil && lo.SomeBy(nodeClass.Spec.DataDisks, func(dataDisk v1alpha1.DataDisk) bool {
+		return dataDisk.Category == nil
+	}) {
+		return nil, nil
+	}
+
+	disks := lo.Map(nodeClass.Spec.DataDisks, func(dataDisk v1alpha1.DataDisk, _ int) *ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationDataDisk {
+		disk := &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationDataDisk{
+			Size:               tea.Int32(max(defaultDataDiskSize, dataDisk.GetGiBSize())),
+			Device:             dataDisk.Device,
+			Category:           dataDisk.Category,
+			DeleteWithInstance: tea.Bool(lo.FromPtrOr(dataDisk.DeleteWithInstance, true)),
+			Encrypted:          dataDisk.Encrypted,
+		}
+		// a disk with a KMS key is encrypted with it
+		if dataDisk.KMSKeyID != nil {
+			disk.Encrypted = tea.Bool(true)
+			disk.KmsKeyId = dataDisk.KMSKeyID
+		}
+		if lo.FromPtr(dataDisk.Category) == v1alpha1.DiskCategoryESSD {
+			disk.PerformanceLevel = dataDisk.PerformanceLevel
 		}
+		return disk
+	})
+	if nodeClass.Spec.DataDisksCategories == nil {
+		return disks, nil
 	}
+	return disks, lo.Map(nodeClass.Spec.DataDisksCategories, func(category string, _ int) *ecsclient.CreateAutoProvisioningGroupRequestDataDiskConfig {
+		return &ecsclient.CreateAutoProvisioningGroupRequestDataDiskConfig{
+			DiskCategory: tea.String(category),
+		}
+	})
+}
 
-	return cheapestVSwitchID
+// setSystemDisk configures the system disk of the instance to launch. Without a size, the system disk is as large
+// as the image, and at least as large as the default system disk.
+func setSystemDisk(request *ecsclient.CreateAutoProvisioningGroupRequest, nodeClass *v1alpha1.ECSNodeClass, imageSize int32) {
+	systemDisk := nodeClass.Spec.SystemDisk
+	if systemDisk == nil {
+		systemDisk = &imagefamily.DefaultSystemDisk
+	}
+	size := nodeClass.Spec.SystemDisk.GetGiBSize()
+	if size == 0 {
+		size = max(imagefamily.DefaultSystemDisk.GetGiBSize(), imageSize)
+	}
+
+	request.LaunchConfiguration.SystemDiskSize = tea.Int32(size)
+	// The performance level is only valid when the system disk can only be an ESSD
+	if len(systemDisk.Categories) != 0 && lo.Every([]string{v1alpha1.DiskCategoryESSD}, systemDisk.Categories) {
+		request.LaunchConfiguration.SystemDiskPerformanceLevel = systemDisk.PerformanceLevel
+	}
+	if systemDisk.KMSKeyID != nil {
+		request.LaunchConfiguration.SystemDisk = &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationSystemDisk{
+			Encrypted: tea.String("true"),
+			KMSKeyId:  systemDisk.KMSKeyID,
+		}
+	} else if systemDisk.Encrypted != nil {
+		request.LaunchConfiguration.SystemDisk = &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationSystemDisk{
+			Encrypted: tea.String(strconv.FormatBool(*systemDisk.Encrypted)),
+		}
+	}
+	request.SystemDiskConfig = lo.Map(systemDisk.Categories, func(category string, _ int) *ecsclient.CreateAutoProvisioningGroupRequestSystemDiskConfig {
+		return &ecsclient.CreateAutoProvisioningGroupRequestSystemDiskConfig{
+			DiskCategory: tea.String(category),
+		}
+	})
 }
 
 func (p *DefaultProvider) syncAllInstances(instances []*Instance) {
@@ -676,7 +1171,7 @@ func (p *DefaultProvider) syncAllInstances(instances []*Instance) {
 	}
 }
 
-func (p *DefaultProvider) buildUserData(ctx context.Context, capacityType string, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim) (string, error) {
+func (p *DefaultProvider) buildUserData(ctx context.Context, capacityType string, nodeClass *v1alpha1.ECSNodeClass, nodeClaim *karpv1.NodeClaim, hostname string) (string, error) {
 	kubeletCfg := resolveKubeletConfiguration(nodeClass)
 	labels := lo.Assign(nodeClaim.Labels, map[string]string{karpv1.CapacityTypeLabelKey: capacityType})
 	taints := lo.Flatten([][]corev1.Taint{
@@ -688,11 +1183,20 @@ func (p *DefaultProvider) buildUserData(ctx context.Context, capacityType string
 	}) {
 		taints = append(taints, karpv1.UnregisteredNoExecuteTaint)
 	}
-	return p.clusterProvider.UserData(ctx, labels, taints, kubeletCfg, nodeClass.Spec.UserData, nodeClass.Spec.FormatDataDisk)
+	return p.clusterProvider.UserData(ctx, cluster.UserDataOptions{
+		Labels:         labels,
+		Taints:         taints,
+		KubeletConfig:  kubeletCfg,
+		UserData:       nodeClass.Spec.UserData,
+		FormatDataDisk: nodeClass.Spec.FormatDataDisk,
+		Hostname:       hostname,
+		DNS:            nodeClass.Spec.DNS,
+		TerwayConfig:   nodeClass.TerwayConfigName(),
+	})
 }
 
 func resolveKubeletConfiguration(nodeClass *v1alpha1.ECSNodeClass) *v1alpha1.KubeletConfiguration {
-	kubeletConfig := nodeClass.Spec.KubeletConfiguration
+	kubeletConfig := nodeClass.ResolvedKubeletConfiguration()
 	if kubeletConfig == nil {
 		kubeletConfig = &v1alpha1.KubeletConfiguration{}
 	}
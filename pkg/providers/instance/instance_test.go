@@ -0,0 +1,1448 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	vpc "github.com/alibabacloud-go/vpc-20160428/v6/client"
+	"github.com/patrickmn/go-cache"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/events"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	kcache "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/fake"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/imagefamily"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/quota"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/vswitch"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+)
+
+func testLaunchResult(instanceType, errorCode string, instanceIDs ...string) *ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult {
+	launchResult := &ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult{
+		InstanceType: tea.String(instanceType),
+		ZoneId:       tea.String("cn-hangzhou-i"),
+	}
+	if errorCode != "" {
+		launchResult.ErrorCode = tea.String(errorCode)
+		launchResult.ErrorMsg = tea.String(errorCode)
+	}
+	if len(instanceIDs) != 0 {
+		launchResult.InstanceIds = &ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResultInstanceIds{
+			InstanceId: tea.StringSlice(instanceIDs),
+		}
+	}
+	return launchResult
+}
+
+func testResponse(launchResults ...*ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult) *ecsclient.CreateAutoProvisioningGroupResponse {
+	return &ecsclient.CreateAutoProvisioningGroupResponse{
+		StatusCode: tea.Int32(http.StatusOK),
+		Body: &ecsclient.CreateAutoProvisioningGroupResponseBody{
+			RequestId: tea.String("request-id"),
+			LaunchResults: &ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResults{
+				LaunchResult: launchResults,
+			},
+		},
+	}
+}
+
+func TestCreateAutoProvisioningGroupResponseHandler(t *testing.T) {
+	// The first candidates are sold out, the group falls back to the next one
+	launchResult, err := createAutoProvisioningGroupResponseHandler(testResponse(
+		testLaunchResult("ecs.g7.large", alierrors.ErrCodeNoInstanceStock),
+		testLaunchResult("ecs.g6.large", alierrors.ErrCodeOperationDeniedNoStock),
+		testLaunchResult("ecs.c7.large", "", "i-123"),
+	))
+	require.NoError(t, err)
+	assert.Equal(t, "ecs.c7.large", tea.StringValue(launchResult.InstanceType))
+
+	_, err = createAutoProvisioningGroupResponseHandler(testResponse(
+		testLaunchResult("ecs.g7.large", alierrors.ErrCodeNoInstanceStock),
+		testLaunchResult("ecs.g6.large", alierrors.ErrCodeZoneNotOnSale),
+	))
+	assert.True(t, cloudprovider.IsInsufficientCapacityError(err))
+
+	// a full deployment set falls through to the offerings in the other zones
+	_, err = createAutoProvisioningGroupResponseHandler(testResponse(
+		testLaunchResult("ecs.g7.large", alierrors.ErrCodeDeploymentSetNoCapacity),
+	))
+	assert.True(t, cloudprovider.IsInsufficientCapacityError(err))
+
+	_, err = createAutoProvisioningGroupResponseHandler(testResponse(
+		testLaunchResult("ecs.g7.large", alierrors.ErrCodeNoInstanceStock),
+		testLaunchResult("ecs.g6.large", alierrors.ErrCodeNotEnoughBalance),
+	))
+	assert.False(t, cloudprovider.IsInsufficientCapacityError(err))
+	createError := &cloudprovider.CreateError{}
+	require.ErrorAs(t, err, &createError)
+	assert.Equal(t, alierrors.ErrCodeNotEnoughBalance, createError.ConditionReason)
+
+	// a spot price limit below the market price fails the launch instead of retrying it
+	_, err = createAutoProvisioningGroupResponseHandler(testResponse(
+		testLaunchResult("ecs.g7.large", "InvalidSpotPriceLimit.LowerThanPublicPrice"),
+	))
+	require.ErrorAs(t, err, &createError)
+	assert.Equal(t, "InvalidSpotPriceLimit.LowerThanPublicPrice", createError.ConditionReason)
+
+	// a RAM role ECS rejects fails the launch with the error of ECS
+	_, err = createAutoProvisioningGroupResponseHandler(testResponse(
+		testLaunchResult("ecs.g7.large", "InvalidRamRole.NotEcsRole"),
+	))
+	require.ErrorAs(t, err, &createError)
+	assert.Equal(t, "InvalidRamRole.NotEcsRole", createError.ConditionReason)
+
+	_, err = createAutoProvisioningGroupResponseHandler(testResponse(
+		testLaunchResult("ecs.g7.large", "InvalidParameter"),
+	))
+	assert.Error(t, err)
+	assert.False(t, cloudprovider.IsInsufficientCapacityError(err))
+}
+
+func TestClientToken(t *testing.T) {
+	nodeClaim := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{UID: types.UID("1c7b0e2c-9a8f-4a3e-8d7c-2f6f1e1a9b3d")}}
+	launchTemplateConfigs := func() []*ecsclient.CreateAutoProvisioningGroupRequestLaunchTemplateConfig {
+		return []*ecsclient.CreateAutoProvisioningGroupRequestLaunchTemplateConfig{
+			{InstanceType: tea.String("ecs.g7.large"), VSwitchId: tea.String("vsw-1"), WeightedCapacity: tea.Float64(1)},
+			{InstanceType: tea.String("ecs.g6.large"), VSwitchId: tea.String("vsw-2"), WeightedCapacity: tea.Float64(1)},
+		}
+	}
+
+	// The same launch is retried with the same token
+	token := clientToken(nodeClaim, karpv1.CapacityTypeSpot, launchTemplateConfigs())
+	assert.Equal(t, token, clientToken(nodeClaim, karpv1.CapacityTypeSpot, launchTemplateConfigs()))
+	assert.LessOrEqual(t, len(token), 64)
+
+	other := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{UID: types.UID("5d2e8f3a-1b4c-4d6e-9f0a-7b8c9d0e1f2a")}}
+	assert.NotEqual(t, token, clientToken(other, karpv1.CapacityTypeSpot, launchTemplateConfigs()))
+	assert.NotEqual(t, token, clientToken(nodeClaim, karpv1.CapacityTypeOnDemand, launchTemplateConfigs()))
+	assert.NotEqual(t, token, clientToken(nodeClaim, karpv1.CapacityTypeSpot, launchTemplateConfigs()[1:]))
+}
+
+func testDescribedInstance(id string) *ecsclient.DescribeInstancesResponseBodyInstancesInstance {
+	return &ecsclient.DescribeInstancesResponseBodyInstancesInstance{
+		InstanceId:   tea.String(id),
+		CreationTime: tea.String("2025-01-01T00:00Z"),
+		Status:       tea.String("Running"),
+		ImageId:      tea.String("image-id"),
+		InstanceType: tea.String("ecs.g7.large"),
+		RegionId:     tea.String("cn-hangzhou"),
+		ZoneId:       tea.String("cn-hangzhou-i"),
+		SpotStrategy: tea.String("NoSpot"),
+	}
+}
+
+func testDescribeInstancesResponse(nextToken string, ids ...string) *ecsclient.DescribeInstancesResponse {
+	instances := make([]*ecsclient.DescribeInstancesResponseBodyInstancesInstance, 0, len(ids))
+	for _, id := range ids {
+		instances = append(instances, testDescribedInstance(id))
+	}
+	return &ecsclient.DescribeInstancesResponse{
+		StatusCode: tea.Int32(http.StatusOK),
+		Body: &ecsclient.DescribeInstancesResponseBody{
+			NextToken: tea.String(nextToken),
+			Instances: &ecsclient.DescribeInstancesResponseBodyInstances{Instance: instances},
+		},
+	}
+}
+
+func TestDescribeInstances(t *testing.T) {
+	t.Run("follows the next token through every page", func(t *testing.T) {
+		pages := map[string]*ecsclient.DescribeInstancesResponse{
+			"":       testDescribeInstancesResponse("token1", "i-1", "i-2"),
+			"token1": testDescribeInstancesResponse("token2", "i-2", "i-3"),
+			"token2": testDescribeInstancesResponse("", "i-4"),
+		}
+		var tokens []string
+		instances, err := describeInstances(&ecsclient.DescribeInstancesRequest{MaxResults: tea.Int32(describeInstancesMaxResults)},
+			func(request *ecsclient.DescribeInstancesRequest) (*ecsclient.DescribeInstancesResponse, error) {
+				assert.Equal(t, describeInstancesMaxResults, tea.Int32Value(request.MaxResults))
+				tokens = append(tokens, tea.StringValue(request.NextToken))
+				return pages[tea.StringValue(request.NextToken)], nil
+			})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"", "token1", "token2"}, tokens)
+		assert.Equal(t, []string{"i-1", "i-2", "i-3", "i-4"}, lo.Map(instances, func(instance *Instance, _ int) string { return instance.ID }))
+	})
+
+	t.Run("no instances", func(t *testing.T) {
+		instances, err := describeInstances(&ecsclient.DescribeInstancesRequest{},
+			func(*ecsclient.DescribeInstancesRequest) (*ecsclient.DescribeInstancesResponse, error) {
+				return testDescribeInstancesResponse(""), nil
+			})
+		require.NoError(t, err)
+		assert.Empty(t, instances)
+	})
+
+	t.Run("reads the interruption of the spot instances", func(t *testing.T) {
+		interrupted := testDescribedInstance("i-1")
+		interrupted.SpotStrategy = tea.String("SpotAsPriceGo")
+		interrupted.OperationLocks = &ecsclient.DescribeInstancesResponseBodyInstancesInstanceOperationLocks{
+			LockReason: []*ecsclient.DescribeInstancesResponseBodyInstancesInstanceOperationLocksLockReason{{LockReason: tea.String(LockReasonRecycling)}},
+		}
+		assert.True(t, NewInstance(interrupted).Interrupted())
+		assert.False(t, NewInstance(testDescribedInstance("i-2")).Interrupted())
+	})
+
+	t.Run("fails when a page fails", func(t *testing.T) {
+		calls := 0
+		_, err := describeInstances(&ecsclient.DescribeInstancesRequest{},
+			func(*ecsclient.DescribeInstancesRequest) (*ecsclient.DescribeInstancesResponse, error) {
+				calls++
+				if calls == 2 {
+					return nil, errors.New("boom")
+				}
+				return testDescribeInstancesResponse("token1", "i-1"), nil
+			})
+		assert.Error(t, err)
+	})
+}
+
+func TestGetTags(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	nodeClaim := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:   "default-abcde",
+		Labels: map[string]string{karpv1.NodePoolLabelKey: "default"},
+	}}
+	nodeClass := &v1alpha1.ECSNodeClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: v1alpha1.ECSNodeClassSpec{Tags: map[string]string{
+			"team":                  "infra",
+			v1alpha1.TagNodeClaim:   "clobbered",
+			karpv1.NodePoolLabelKey: "clobbered",
+		}},
+	}
+
+	tags, err := getTags(ctx, nodeClass, nodeClaim)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"kubernetes.io/cluster/c-1": "owned",
+		karpv1.NodePoolLabelKey:     "default",
+		v1alpha1.ECSClusterIDTagKey: "c-1",
+		v1alpha1.LabelNodeClass:     "default",
+		v1alpha1.TagNodeClaim:       "default-abcde",
+		v1alpha1.TagUserDataHash:    nodeClass.UserDataHash(),
+		"team":                      "infra",
+	}, tags)
+
+	// 6 karpenter tags, the Name tag and 13 user tags fill the limit
+	nodeClass.Spec.Tags = map[string]string{}
+	for i := 0; i < 13; i++ {
+		nodeClass.Spec.Tags[fmt.Sprintf("tag-%d", i)] = "value"
+	}
+	tags, err = getTags(ctx, nodeClass, nodeClaim)
+	require.NoError(t, err)
+	assert.Len(t, tags, 19)
+
+	nodeClass.Spec.Tags["tag-13"] = "value"
+	_, err = getTags(ctx, nodeClass, nodeClaim)
+	assert.Error(t, err)
+
+	// the tag values are rendered with the owners of the instance
+	nodeClass.Spec.Tags = map[string]string{"team": "{{ .NodePool }}", "owner": "{{ .ClusterID }}/{{ .NodeClass }}/{{ .NodeClaim }}"}
+	tags, err = getTags(ctx, nodeClass, nodeClaim)
+	require.NoError(t, err)
+	assert.Equal(t, "default", tags["team"])
+	assert.Equal(t, "c-1/default/default-abcde", tags["owner"])
+
+	nodeClass.Spec.Tags = map[string]string{"team": "{{ .Namespace }}"}
+	_, err = getTags(ctx, nodeClass, nodeClaim)
+	assert.ErrorContains(t, err, "tag team")
+}
+
+func TestGetHostname(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	nodeClaim := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:   "default-abcde",
+		Labels: map[string]string{karpv1.NodePoolLabelKey: "gpu"},
+	}}
+	nodeClass := &v1alpha1.ECSNodeClass{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+
+	// ECS names the instances without a template
+	hostname, err := getHostname(ctx, nodeClass, nodeClaim)
+	require.NoError(t, err)
+	assert.Empty(t, hostname)
+
+	nodeClass.Spec.HostnameTemplate = "{{ .NodePool }}-{{ .NodeClaim }}.{{ .ClusterID }}"
+	hostname, err = getHostname(ctx, nodeClass, nodeClaim)
+	require.NoError(t, err)
+	assert.Equal(t, "gpu-default-abcde.c-1", hostname)
+
+	// the hostname is validated again at launch, a long NodePool name makes it too long
+	nodeClaim.Labels[karpv1.NodePoolLabelKey] = strings.Repeat("gpu", 20)
+	_, err = getHostname(ctx, nodeClass, nodeClaim)
+	assert.ErrorContains(t, err, "is longer than 64 characters")
+}
+
+func TestRenderInstanceName(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	nodeClaim := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:   "default-abcde",
+		Labels: map[string]string{karpv1.NodePoolLabelKey: "gpu"},
+	}}
+	nodeClass := &v1alpha1.ECSNodeClass{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+
+	// the instances are named after their NodeClaims without a template
+	name, err := v1alpha1.RenderInstanceName(nodeClass.Spec.InstanceNameTemplate, templateData(ctx, nodeClass, nodeClaim))
+	require.NoError(t, err)
+	assert.Equal(t, "karpenter-default-abcde", name)
+
+	nodeClass.Spec.InstanceNameTemplate = "{{ .ClusterID }}:{{ .NodeClass }}_{{ .NodePool }}.{{ .NodeClaim }}"
+	name, err = v1alpha1.RenderInstanceName(nodeClass.Spec.InstanceNameTemplate, templateData(ctx, nodeClass, nodeClaim))
+	require.NoError(t, err)
+	assert.Equal(t, "c-1:default_gpu.default-abcde", name)
+
+	// the names longer than ECS allows are truncated
+	nodeClaim.Labels[karpv1.NodePoolLabelKey] = strings.Repeat("gpu", 50)
+	name, err = v1alpha1.RenderInstanceName(nodeClass.Spec.InstanceNameTemplate, templateData(ctx, nodeClass, nodeClaim))
+	require.NoError(t, err)
+	assert.Len(t, name, 128)
+	assert.True(t, strings.HasPrefix(name, "c-1:default_gpugpu"))
+}
+
+// newFakeECSClient returns an ECS client calling the handler instead of the ECS API
+func newFakeECSClient(t *testing.T, handler http.HandlerFunc) *ecsclient.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := ecsclient.NewClient(&openapi.Config{
+		AccessKeyId:     tea.String("ak"),
+		AccessKeySecret: tea.String("sk"),
+		RegionId:        tea.String("cn-hangzhou"),
+		Endpoint:        tea.String(strings.TrimPrefix(server.URL, "http://")),
+		Protocol:        tea.String("http"),
+	})
+	require.NoError(t, err)
+	return client
+}
+
+func TestDeleteReleasedInstance(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+
+	released := false
+	deleteCalls := 0
+	ecsClient := newFakeECSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Header.Get("x-acs-action") {
+		case "DescribeInstances":
+			// DescribeInstances is eventually consistent, the released instance is still listed
+			fmt.Fprint(w, `{"RequestId":"r","Instances":{"Instance":[{"InstanceId":"i-1","CreationTime":"2025-01-01T00:00Z",`+
+				`"Status":"Running","ImageId":"image-id","InstanceType":"ecs.g7.large","RegionId":"cn-hangzhou",`+
+				`"ZoneId":"cn-hangzhou-i","SpotStrategy":"NoSpot"}]}}`)
+		case "DeleteInstance":
+			deleteCalls++
+			if released {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"RequestId":"r","Code":"InvalidInstanceId.NotFound","Message":"The specified InstanceId does not exist."}`)
+				return
+			}
+			released = true
+			fmt.Fprint(w, `{"RequestId":"r"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"RequestId":"r","Code":"InvalidAction","Message":"unexpected action"}`)
+		}
+	})
+	p := NewDefaultProvider(ctx, "cn-hangzhou", ecsClient, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+	const terminations = "karpenter_alibabacloud_instance_termination_total"
+	succeeded, notFound := metricValue(t, terminations, map[string]string{resultLabel: resultSuccess}), metricValue(t, terminations, map[string]string{resultLabel: resultNotFound})
+
+	assert.NoError(t, p.Delete(ctx, "i-1"))
+
+	err := p.Delete(ctx, "i-1")
+	assert.True(t, cloudprovider.IsNodeClaimNotFoundError(err), "got %v", err)
+	assert.Equal(t, 2, deleteCalls)
+	assert.Equal(t, succeeded+1, metricValue(t, terminations, map[string]string{resultLabel: resultSuccess}))
+	assert.Equal(t, notFound+1, metricValue(t, terminations, map[string]string{resultLabel: resultNotFound}))
+}
+
+func TestLaunchTimeout(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1", LaunchTimeout: 10 * time.Minute})
+	ecsAPI := fake.NewECSAPI()
+	instance := func(id, status string, created time.Time) *ecsclient.DescribeInstancesResponseBodyInstancesInstance {
+		return &ecsclient.DescribeInstancesResponseBodyInstancesInstance{
+			InstanceId: tea.String(id), Status: tea.String(status), CreationTime: tea.String(created.UTC().Format("2006-01-02T15:04Z")),
+			ImageId: tea.String("image-id"), InstanceType: tea.String("ecs.g7.large"), RegionId: tea.String("cn-hangzhou"),
+			ZoneId: tea.String("cn-hangzhou-i"), SpotStrategy: tea.String("NoSpot"),
+		}
+	}
+	ecsAPI.Instances = []*ecsclient.DescribeInstancesResponseBodyInstancesInstance{
+		instance("i-stuck", InstanceStatusPending, time.Now().Add(-time.Hour)),
+		instance("i-launching", InstanceStatusStarting, time.Now()),
+		instance("i-running", InstanceStatusRunning, time.Now().Add(-time.Hour)),
+	}
+	p := NewDefaultProvider(ctx, "cn-hangzhou", ecsAPI, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+
+	// looking the instances up has no side effect
+	for _, id := range []string{"i-stuck", "i-launching", "i-running"} {
+		_, err := p.Get(ctx, id)
+		require.NoError(t, err)
+	}
+	assert.Zero(t, ecsAPI.DeleteInstanceBehavior.Calls())
+
+	// the instances are only deleted while launching once they timed out
+	err := p.Delete(ctx, "i-launching")
+	assert.True(t, IsInstanceStateOperationNotSupportedError(err), "got %v", err)
+	assert.Zero(t, ecsAPI.DeleteInstanceBehavior.Calls())
+
+	require.NoError(t, p.Delete(ctx, "i-stuck"))
+	assert.Equal(t, "i-stuck", tea.StringValue(ecsAPI.DeleteInstanceBehavior.Requests()[0].InstanceId))
+	assert.True(t, tea.BoolValue(ecsAPI.DeleteInstanceBehavior.Requests()[0].Force))
+}
+
+func TestDataDisks(t *testing.T) {
+	nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{
+		DataDisks: []v1alpha1.DataDisk{
+			{
+				Category:           tea.String(v1alpha1.DiskCategoryESSD),
+				PerformanceLevel:   tea.String("PL1"),
+				VolumeSize:         lo.ToPtr(resource.MustParse("200Gi")),
+				DeleteWithInstance: tea.Bool(false),
+				Encrypted:          tea.Bool(true),
+				Device:             tea.String("/dev/xvdb"),
+			},
+			{VolumeSize: lo.ToPtr(resource.MustParse("10Gi"))},
+		},
+		DataDisksCategories: []string{"cloud_auto"},
+	}}
+
+	disks, configs := dataDisks(nodeClass)
+	assert.Equal(t, []*ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationDataDisk{
+		{
+			Size:               tea.Int32(200),
+			Device:             tea.String("/dev/xvdb"),
+			Category:           tea.String(v1alpha1.DiskCategoryESSD),
+			PerformanceLevel:   tea.String("PL1"),
+			DeleteWithInstance: tea.Bool(false),
+			Encrypted:          tea.Bool(true),
+		},
+		// disks are at least 20GiB, and are released with the instance by default
+		{Size: tea.Int32(20), DeleteWithInstance: tea.Bool(true)},
+	}, disks)
+	assert.Equal(t, []*ecsclient.CreateAutoProvisioningGroupRequestDataDiskConfig{{DiskCategory: tea.String("cloud_auto")}}, configs)
+
+	// a data disk without a category has nowhere to be created in
+	nodeClass.Spec.DataDisksCategories = nil
+	disks, configs = dataDisks(nodeClass)
+	assert.Nil(t, disks)
+	assert.Nil(t, configs)
+
+	nodeClass.Spec.DataDisks = nodeClass.Spec.DataDisks[:1]
+	disks, configs = dataDisks(nodeClass)
+	assert.Len(t, disks, 1)
+	assert.Nil(t, configs)
+}
+
+func TestSetSystemDisk(t *testing.T) {
+	newRequest := func() *ecsclient.CreateAutoProvisioningGroupRequest {
+		return &ecsclient.CreateAutoProvisioningGroupRequest{LaunchConfiguration: &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfiguration{}}
+	}
+
+	request := newRequest()
+	setSystemDisk(request, &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{
+		SystemDisk: &v1alpha1.SystemDisk{
+			Categories:       []string{v1alpha1.DiskCategoryESSD},
+			Size:             tea.Int32(100),
+			PerformanceLevel: tea.String("PL1"),
+			Encrypted:        tea.Bool(true),
+		},
+	}}, 40)
+	assert.Equal(t, int32(100), tea.Int32Value(request.LaunchConfiguration.SystemDiskSize))
+	assert.Equal(t, "PL1", tea.StringValue(request.LaunchConfiguration.SystemDiskPerformanceLevel))
+	assert.Equal(t, "true", tea.StringValue(request.LaunchConfiguration.SystemDisk.Encrypted))
+	assert.Equal(t, []*ecsclient.CreateAutoProvisioningGroupRequestSystemDiskConfig{{DiskCategory: tea.String(v1alpha1.DiskCategoryESSD)}}, request.SystemDiskConfig)
+
+	// the disk is as large as the image by default, and the performance level only applies to ESSDs
+	request = newRequest()
+	setSystemDisk(request, &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{
+		SystemDisk: &v1alpha1.SystemDisk{Categories: []string{"cloud_auto", v1alpha1.DiskCategoryESSD}, PerformanceLevel: tea.String("PL1")},
+	}}, 40)
+	assert.Equal(t, int32(40), tea.Int32Value(request.LaunchConfiguration.SystemDiskSize))
+	assert.Nil(t, request.LaunchConfiguration.SystemDiskPerformanceLevel)
+	assert.Nil(t, request.LaunchConfiguration.SystemDisk)
+
+	request = newRequest()
+	setSystemDisk(request, &v1alpha1.ECSNodeClass{}, 0)
+	assert.Equal(t, int32(20), tea.Int32Value(request.LaunchConfiguration.SystemDiskSize))
+	assert.Len(t, request.SystemDiskConfig, len(imagefamily.DefaultSystemDisk.Categories))
+}
+
+func TestDiskKMSKeys(t *testing.T) {
+	nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{
+		SystemDisk: &v1alpha1.SystemDisk{KMSKeyID: tea.String("key-system")},
+		DataDisks:  []v1alpha1.DataDisk{{Category: tea.String(v1alpha1.DiskCategoryESSD), KMSKeyID: tea.String("key-data")}},
+	}}
+	request := &ecsclient.CreateAutoProvisioningGroupRequest{LaunchConfiguration: &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfiguration{}}
+
+	// the disks with a KMS key are encrypted with it
+	setSystemDisk(request, nodeClass, 40)
+	assert.Equal(t, "true", tea.StringValue(request.LaunchConfiguration.SystemDisk.Encrypted))
+	assert.Equal(t, "key-system", tea.StringValue(request.LaunchConfiguration.SystemDisk.KMSKeyId))
+	request.LaunchConfiguration.DataDisk, request.DataDiskConfig = dataDisks(nodeClass)
+	assert.True(t, tea.BoolValue(request.LaunchConfiguration.DataDisk[0].Encrypted))
+	assert.Equal(t, "key-data", tea.StringValue(request.LaunchConfiguration.DataDisk[0].KmsKeyId))
+
+	// and so are they when launched with RunInstances
+	runInstancesRequest := runInstancesRequest(request, "ecs.g7.large", "vsw-i")
+	assert.Equal(t, "true", tea.StringValue(runInstancesRequest.SystemDisk.Encrypted))
+	assert.Equal(t, "key-system", tea.StringValue(runInstancesRequest.SystemDisk.KMSKeyId))
+	assert.Equal(t, "true", tea.StringValue(runInstancesRequest.DataDisk[0].Encrypted))
+	assert.Equal(t, "key-data", tea.StringValue(runInstancesRequest.DataDisk[0].KMSKeyId))
+}
+
+func TestModifyMetadataOptions(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+
+	var params url.Values
+	ecsClient := newFakeECSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		require.Equal(t, "ModifyInstanceMetadataOptions", r.Header.Get("x-acs-action"))
+		params = r.URL.Query()
+		fmt.Fprint(w, `{"RequestId":"r"}`)
+	})
+	p := NewDefaultProvider(ctx, "cn-hangzhou", ecsClient, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+
+	// the fields left out are secure by default
+	require.NoError(t, p.modifyMetadataOptions(ctx, "i-1", &v1alpha1.MetadataOptions{}))
+	assert.Equal(t, "i-1", params.Get("InstanceId"))
+	assert.Equal(t, "enabled", params.Get("HttpEndpoint"))
+	assert.Equal(t, "required", params.Get("HttpTokens"))
+	assert.False(t, params.Has("HttpPutResponseHopLimit"))
+
+	require.NoError(t, p.modifyMetadataOptions(ctx, "i-1", &v1alpha1.MetadataOptions{
+		HTTPTokens:              tea.String("optional"),
+		HTTPPutResponseHopLimit: tea.Int32(2),
+	}))
+	assert.Equal(t, "enabled", params.Get("HttpEndpoint"))
+	assert.Equal(t, "optional", params.Get("HttpTokens"))
+	assert.Equal(t, "2", params.Get("HttpPutResponseHopLimit"))
+}
+
+func TestGetVSwitchIDSpreadsZones(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	p := NewDefaultProvider(ctx, "cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+
+	offering := func(zone, capacityType string, price float64, available bool) cloudprovider.Offering {
+		return cloudprovider.Offering{
+			Requirements: scheduling.NewRequirements(
+				scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, capacityType),
+				scheduling.NewRequirement(corev1.LabelTopologyZone, corev1.NodeSelectorOpIn, zone),
+			),
+			Price:     price,
+			Available: available,
+		}
+	}
+	instanceTypes := []*cloudprovider.InstanceType{
+		{Name: "ecs.g7.large", Offerings: cloudprovider.Offerings{
+			offering("cn-hangzhou-i", karpv1.CapacityTypeOnDemand, 1, true),
+			offering("cn-hangzhou-j", karpv1.CapacityTypeOnDemand, 1, true),
+			offering("cn-hangzhou-i", karpv1.CapacityTypeSpot, 0.2, true),
+			offering("cn-hangzhou-j", karpv1.CapacityTypeSpot, 0.3, true),
+		}},
+	}
+	zonalVSwitches := map[string]*vswitch.VSwitch{
+		"cn-hangzhou-i": {ID: "vsw-i", ZoneID: "cn-hangzhou-i", AvailableIPAddressCount: 100},
+		"cn-hangzhou-j": {ID: "vsw-j", ZoneID: "cn-hangzhou-j", AvailableIPAddressCount: 100},
+	}
+	launch := func(capacityType string) []string {
+		reqs := scheduling.NewRequirements(scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, capacityType))
+		var vSwitchIDs []string
+		for i := range 4 {
+			vSwitchID := getVSwitchID(instanceTypes[0], zonalVSwitches, reqs, capacityType, "cheapest",
+				p.zoneStats(instanceTypes, capacityType))
+			vSwitchIDs = append(vSwitchIDs, vSwitchID)
+			p.zoneLaunches.SetDefault(fmt.Sprintf("i-%s-%d", capacityType, i), strings.Replace(vSwitchID, "vsw-", "cn-hangzhou-", 1))
+		}
+		return vSwitchIDs
+	}
+
+	// equal zones take turns
+	assert.Equal(t, []string{"vsw-i", "vsw-j", "vsw-i", "vsw-j"}, launch(karpv1.CapacityTypeOnDemand))
+	// the spot price still comes first
+	assert.Equal(t, []string{"vsw-i", "vsw-i", "vsw-i", "vsw-i"}, launch(karpv1.CapacityTypeSpot))
+
+	// the zone with the more available IP addresses wins, unless capacity was recently sold out in it
+	p.zoneLaunches.Flush()
+	zonalVSwitches["cn-hangzhou-i"].AvailableIPAddressCount = 10
+	reqs := scheduling.NewRequirements(scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeOnDemand))
+	assert.Equal(t, "vsw-j", getVSwitchID(instanceTypes[0], zonalVSwitches, reqs, karpv1.CapacityTypeOnDemand, "", p.zoneStats(instanceTypes, karpv1.CapacityTypeOnDemand)))
+	instanceTypes = append(instanceTypes, &cloudprovider.InstanceType{Name: "ecs.g7.xlarge", Offerings: cloudprovider.Offerings{
+		offering("cn-hangzhou-j", karpv1.CapacityTypeOnDemand, 2, false),
+	}})
+	assert.Equal(t, "vsw-i", getVSwitchID(instanceTypes[0], zonalVSwitches, reqs, karpv1.CapacityTypeOnDemand, "", p.zoneStats(instanceTypes, karpv1.CapacityTypeOnDemand)))
+}
+
+func TestGetDeploymentSetID(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	nodeClaim := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{karpv1.NodePoolLabelKey: "default"}}}
+
+	var actions, created []string
+	ecsClient := newFakeECSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		actions = append(actions, r.Header.Get("x-acs-action"))
+		switch r.Header.Get("x-acs-action") {
+		case "DescribeDeploymentSets":
+			// the name filter is a fuzzy match
+			fmt.Fprint(w, `{"RequestId":"r","DeploymentSets":{"DeploymentSet":[{"DeploymentSetId":"ds-2","DeploymentSetName":"karpenter-c-1-default-2"}]}}`)
+		case "CreateDeploymentSet":
+			created = append(created, r.URL.Query().Get("DeploymentSetName")+"/"+r.URL.Query().Get("Strategy"))
+			fmt.Fprintf(w, `{"RequestId":"r","DeploymentSetId":"ds-%d"}`, len(created))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"RequestId":"r","Code":"InvalidAction","Message":"unexpected action"}`)
+		}
+	})
+	p := NewDefaultProvider(ctx, "cn-hangzhou", ecsClient, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+
+	id, err := p.getDeploymentSetID(ctx, &v1alpha1.ECSNodeClass{}, nodeClaim)
+	require.NoError(t, err)
+	assert.Empty(t, id)
+
+	id, err = p.getDeploymentSetID(ctx, &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{
+		DeploymentSet: &v1alpha1.DeploymentSet{ID: tea.String("ds-0")},
+	}}, nodeClaim)
+	require.NoError(t, err)
+	assert.Equal(t, "ds-0", id)
+	assert.Empty(t, actions)
+
+	managed := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{DeploymentSet: &v1alpha1.DeploymentSet{Managed: true}}}
+	for range 2 {
+		id, err = p.getDeploymentSetID(ctx, managed, nodeClaim)
+		require.NoError(t, err)
+		assert.Equal(t, "ds-1", id)
+	}
+	// the deployment set of the NodePool is created once and reused
+	assert.Equal(t, []string{"DescribeDeploymentSets", "CreateDeploymentSet"}, actions)
+	assert.Equal(t, []string{"karpenter-c-1-default/Availability"}, created)
+
+	// the low latency deployment set of the NodePool is another one
+	lowLatency := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{DeploymentSet: &v1alpha1.DeploymentSet{
+		Managed:  true,
+		Strategy: v1alpha1.DeploymentSetStrategyLowLatency,
+	}}}
+	id, err = p.getDeploymentSetID(ctx, lowLatency, nodeClaim)
+	require.NoError(t, err)
+	assert.Equal(t, "ds-2", id)
+	assert.Equal(t, []string{"karpenter-c-1-default/Availability", "karpenter-c-1-default-lowlatency/LowLatency"}, created)
+}
+
+func TestPublishDeploymentSetFull(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	fakeRecorder := record.NewFakeRecorder(10)
+	p := NewDefaultProvider(ctx, "cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, events.NewRecorder(fakeRecorder))
+	nodeClaim := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{Name: "default-abcde", UID: "uid"}}
+	request := &ecsclient.CreateAutoProvisioningGroupRequest{
+		LaunchConfiguration: &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfiguration{DeploymentSetId: tea.String("ds-1")},
+	}
+	resp := testResponse(
+		testLaunchResult("ecs.g7.large", alierrors.ErrCodeDeploymentSetNoCapacity),
+		testLaunchResult("ecs.g6.large", alierrors.ErrCodeDeploymentSetNoCapacity),
+		testLaunchResult("ecs.c7.large", alierrors.ErrCodeNoInstanceStock),
+	)
+
+	p.publishDeploymentSetFull(nodeClaim, request, resp)
+	require.Len(t, fakeRecorder.Events, 1)
+	assert.Equal(t, "Warning DeploymentSetFull Deployment set ds-1 can't place more instances in cn-hangzhou-i, falling back to the other zones", <-fakeRecorder.Events)
+
+	// the other launch failures are not about the deployment set
+	p.publishDeploymentSetFull(nodeClaim, request, testResponse(testLaunchResult("ecs.c7.large", alierrors.ErrCodeNoInstanceStock)))
+	assert.Empty(t, fakeRecorder.Events)
+}
+
+func TestLaunchOnDedicatedHost(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+
+	var runInstances url.Values
+	ecsClient := newFakeECSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Header.Get("x-acs-action") {
+		case "DescribeDedicatedHosts":
+			assert.Equal(t, `["dh-1"]`, r.URL.Query().Get("DedicatedHostIds"))
+			fmt.Fprint(w, `{"RequestId":"r","DedicatedHosts":{"DedicatedHost":[{"DedicatedHostId":"dh-1","ZoneId":"cn-hangzhou-i",`+
+				`"Capacity":{"AvailableVcpus":4,"AvailableMemory":16},"SupportedInstanceTypeFamilies":{"SupportedInstanceTypeFamily":["ecs.g7"]}}]}}`)
+		case "RunInstances":
+			runInstances = r.URL.Query()
+			fmt.Fprint(w, `{"RequestId":"r","InstanceIdSets":{"InstanceIdSet":["i-1"]}}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"RequestId":"r","Code":"InvalidAction","Message":"unexpected action"}`)
+		}
+	})
+	p := NewDefaultProvider(ctx, "cn-hangzhou", ecsClient, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+
+	nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{Tenancy: v1alpha1.TenancyHost, DedicatedHostID: tea.String("dh-1")}}
+	instanceType := func(name, cpu, memory string) *cloudprovider.InstanceType {
+		return &cloudprovider.InstanceType{Name: name, Capacity: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}}
+	}
+	request := &ecsclient.CreateAutoProvisioningGroupRequest{
+		ClientToken: tea.String("token"),
+		RegionId:    tea.String("cn-hangzhou"),
+		LaunchTemplateConfig: []*ecsclient.CreateAutoProvisioningGroupRequestLaunchTemplateConfig{
+			// the host doesn't support the family, and doesn't have enough capacity for the larger type
+			{InstanceType: tea.String("ecs.c7.large"), VSwitchId: tea.String("vsw-i")},
+			{InstanceType: tea.String("ecs.g7.2xlarge"), VSwitchId: tea.String("vsw-i")},
+			{InstanceType: tea.String("ecs.g7.xlarge"), VSwitchId: tea.String("vsw-i")},
+		},
+		LaunchConfiguration: &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfiguration{
+			ImageId:                 tea.String("image-id"),
+			SystemDiskSize:          tea.Int32(40),
+			InternetMaxBandwidthOut: tea.Int32(10),
+			RamRoleName:             tea.String("node-role"),
+			HostName:                tea.String("default-abcde"),
+			KeyPairName:             tea.String("ops"),
+		},
+		SystemDiskConfig: []*ecsclient.CreateAutoProvisioningGroupRequestSystemDiskConfig{{DiskCategory: tea.String(v1alpha1.DiskCategoryESSD)}},
+	}
+	instanceTypes := []*cloudprovider.InstanceType{
+		instanceType("ecs.c7.large", "2", "4Gi"),
+		instanceType("ecs.g7.2xlarge", "8", "32Gi"),
+		instanceType("ecs.g7.xlarge", "4", "16Gi"),
+	}
+	zonalVSwitches := map[string]*vswitch.VSwitch{"cn-hangzhou-i": {ID: "vsw-i", ZoneID: "cn-hangzhou-i"}}
+
+	launchResult, err := p.launchOnDedicatedHost(ctx, nodeClass, request, instanceTypes, zonalVSwitches)
+	require.NoError(t, err)
+	assert.Equal(t, "i-1", tea.StringValue(launchResult.InstanceIds.InstanceId[0]))
+	assert.Equal(t, "ecs.g7.xlarge", tea.StringValue(launchResult.InstanceType))
+	assert.Equal(t, "cn-hangzhou-i", tea.StringValue(launchResult.ZoneId))
+
+	assert.Equal(t, "dh-1", runInstances.Get("DedicatedHostId"))
+	assert.Equal(t, "host", runInstances.Get("Tenancy"))
+	assert.Equal(t, "ecs.g7.xlarge", runInstances.Get("InstanceType"))
+	assert.Equal(t, "vsw-i", runInstances.Get("VSwitchId"))
+	assert.Equal(t, "image-id", runInstances.Get("ImageId"))
+	assert.Equal(t, "token", runInstances.Get("ClientToken"))
+	assert.Equal(t, "40", runInstances.Get("SystemDisk.Size"))
+	assert.Equal(t, v1alpha1.DiskCategoryESSD, runInstances.Get("SystemDisk.Category"))
+	assert.Equal(t, "10", runInstances.Get("InternetMaxBandwidthOut"))
+	assert.Equal(t, "node-role", runInstances.Get("RamRoleName"))
+	assert.Equal(t, "default-abcde", runInstances.Get("HostName"))
+	assert.Equal(t, "ops", runInstances.Get("KeyPairName"))
+	assert.Empty(t, runInstances.Get("Ipv6AddressCount"))
+	// the metadata service is left as launched without metadata options
+	assert.False(t, runInstances.Has("HttpTokens"))
+
+	// the metadata options are configured by RunInstances
+	nodeClass.Spec.MetadataOptions = &v1alpha1.MetadataOptions{HTTPPutResponseHopLimit: tea.Int32(2)}
+	_, err = p.launchOnDedicatedHost(ctx, nodeClass, request, instanceTypes, zonalVSwitches)
+	require.NoError(t, err)
+	assert.Equal(t, "enabled", runInstances.Get("HttpEndpoint"))
+	assert.Equal(t, "required", runInstances.Get("HttpTokens"))
+	assert.Equal(t, "2", runInstances.Get("HttpPutResponseHopLimit"))
+
+	// the IPv6 addresses are requested by RunInstances
+	nodeClass.Spec.IPv6 = &v1alpha1.IPv6{AddressCount: tea.Int32(2)}
+	_, err = p.launchOnDedicatedHost(ctx, nodeClass, request, instanceTypes, zonalVSwitches)
+	require.NoError(t, err)
+	assert.Equal(t, "2", runInstances.Get("Ipv6AddressCount"))
+
+	// no host is in the zones to launch in
+	_, err = p.launchOnDedicatedHost(ctx, nodeClass, request, instanceTypes, map[string]*vswitch.VSwitch{"cn-hangzhou-j": {ID: "vsw-j"}})
+	assert.True(t, cloudprovider.IsInsufficientCapacityError(err))
+}
+
+func TestLaunchOnDedicatedHostInvalidRAMRole(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+
+	ecsClient := newFakeECSClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Header.Get("x-acs-action") {
+		case "DescribeDedicatedHosts":
+			fmt.Fprint(w, `{"RequestId":"r","DedicatedHosts":{"DedicatedHost":[{"DedicatedHostId":"dh-1","ZoneId":"cn-hangzhou-i",`+
+				`"Capacity":{"AvailableVcpus":4,"AvailableMemory":16},"SupportedInstanceTypeFamilies":{"SupportedInstanceTypeFamily":["ecs.g7"]}}]}}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"RequestId":"r","Code":"InvalidRamRole.NotEcsRole","Message":"The specified ram role is not authorized for ecs"}`)
+		}
+	})
+	p := NewDefaultProvider(ctx, "cn-hangzhou", ecsClient, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+
+	nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{Tenancy: v1alpha1.TenancyHost, RAMRoleName: "node-role"}}
+	request := &ecsclient.CreateAutoProvisioningGroupRequest{
+		RegionId:             tea.String("cn-hangzhou"),
+		LaunchTemplateConfig: []*ecsclient.CreateAutoProvisioningGroupRequestLaunchTemplateConfig{{InstanceType: tea.String("ecs.g7.large")}},
+		LaunchConfiguration:  &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfiguration{RamRoleName: tea.String("node-role")},
+	}
+	instanceTypes := []*cloudprovider.InstanceType{{Name: "ecs.g7.large", Capacity: corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("2"),
+		corev1.ResourceMemory: resource.MustParse("8Gi"),
+	}}}
+	zonalVSwitches := map[string]*vswitch.VSwitch{"cn-hangzhou-i": {ID: "vsw-i", ZoneID: "cn-hangzhou-i"}}
+
+	_, err := p.launchOnDedicatedHost(ctx, nodeClass, request, instanceTypes, zonalVSwitches)
+	createError := &cloudprovider.CreateError{}
+	require.ErrorAs(t, err, &createError)
+	assert.Equal(t, "InvalidRamRole.NotEcsRole", createError.ConditionReason)
+	assert.Contains(t, err.Error(), "not authorized for ecs")
+}
+
+func TestAccountErrorPausesLaunches(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{AccountErrorCooldown: time.Minute})
+	fakeRecorder := record.NewFakeRecorder(10)
+	p := NewDefaultProvider(ctx, "cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, events.NewRecorder(fakeRecorder))
+
+	// errors which are not account-level don't pause the launches
+	p.recordAccountError(ctx, cloudprovider.NewInsufficientCapacityError(errors.New("sold out")))
+	p.recordAccountError(ctx, cloudprovider.NewCreateError(errors.New("failed"), alierrors.ErrCodeNoInstanceStock, "sold out"))
+	assert.NoError(t, p.accountError())
+
+	p.recordAccountError(ctx, cloudprovider.NewCreateError(errors.New("failed"), alierrors.ErrCodeInsufficientBalance, "The account balance is insufficient."))
+	// the launch fails before calling ECS, with the condition reason and message of the account error
+	_, err := p.Create(ctx, &v1alpha1.ECSNodeClass{}, &karpv1.NodeClaim{}, nil)
+	var createError *cloudprovider.CreateError
+	require.ErrorAs(t, err, &createError)
+	assert.Equal(t, alierrors.ErrCodeInsufficientBalance, createError.ConditionReason)
+	assert.Equal(t, "The account balance is insufficient.", createError.ConditionMessage)
+	require.Len(t, fakeRecorder.Events, 1)
+	assert.True(t, strings.HasPrefix(<-fakeRecorder.Events, "Warning InsufficientBalance "))
+
+	// a zero cooldown doesn't pause the launches
+	ctx = options.ToContext(context.Background(), &options.Options{})
+	p = NewDefaultProvider(ctx, "cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+	p.recordAccountError(ctx, cloudprovider.NewCreateError(errors.New("failed"), alierrors.ErrCodeAccountArrearage, "arrearage"))
+	assert.NoError(t, p.accountError())
+}
+
+func TestCheckQuota(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{})
+	ecsAPI := fake.NewECSAPI()
+	attributes := map[string]string{"max-postpaid-instance-vcpu-count": "100", "used-postpaid-instance-vcpu-count": "97"}
+	ecsAPI.DescribeAccountAttributesBehavior.SetOutput(&ecsclient.DescribeAccountAttributesResponse{Body: &ecsclient.DescribeAccountAttributesResponseBody{
+		AccountAttributeItems: &ecsclient.DescribeAccountAttributesResponseBodyAccountAttributeItems{
+			AccountAttributeItem: lo.MapToSlice(attributes, func(name, value string) *ecsclient.DescribeAccountAttributesResponseBodyAccountAttributeItemsAccountAttributeItem {
+				return &ecsclient.DescribeAccountAttributesResponseBodyAccountAttributeItemsAccountAttributeItem{
+					AttributeName: tea.String(name),
+					AttributeValues: &ecsclient.DescribeAccountAttributesResponseBodyAccountAttributeItemsAccountAttributeItemAttributeValues{
+						ValueItem: []*ecsclient.DescribeAccountAttributesResponseBodyAccountAttributeItemsAccountAttributeItemAttributeValuesValueItem{{Value: tea.String(value)}},
+					},
+				}
+			}),
+		},
+	}})
+	quotaProvider := quota.NewDefaultProvider("cn-hangzhou", ecsAPI, nil, cache.New(time.Minute, time.Minute))
+	p := NewDefaultProvider(ctx, "cn-hangzhou", ecsAPI, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, quotaProvider, nil)
+	instanceType := func(name, cpu string) *cloudprovider.InstanceType {
+		return &cloudprovider.InstanceType{Name: name, Capacity: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}}
+	}
+
+	// one of the instance types fits in the 3 vCPUs left
+	assert.NoError(t, p.checkQuota(ctx, []*cloudprovider.InstanceType{instanceType("ecs.g7.xlarge", "4"), instanceType("ecs.g7.large", "2")}, karpv1.CapacityTypeOnDemand))
+
+	// none of them fits, the launch fails with a clear message
+	err := p.checkQuota(ctx, []*cloudprovider.InstanceType{instanceType("ecs.g7.xlarge", "4"), instanceType("ecs.g7.2xlarge", "8")}, karpv1.CapacityTypeOnDemand)
+	var createError *cloudprovider.CreateError
+	require.ErrorAs(t, err, &createError)
+	assert.Equal(t, "QuotaExceed.VCPU", createError.ConditionReason)
+	assert.Contains(t, createError.ConditionMessage, "has 3 of 100 vCPUs left, the smallest instance type needs 4 vCPUs")
+	reason, ok := launchFailureReason(err)
+	assert.True(t, ok)
+	assert.Equal(t, "QuotaExceeded", reason)
+	assert.Equal(t, 1, ecsAPI.DescribeAccountAttributesBehavior.Calls())
+
+	// the launches go on when the quota is unknown
+	assert.NoError(t, p.checkQuota(ctx, []*cloudprovider.InstanceType{instanceType("ecs.g7.2xlarge", "8")}, karpv1.CapacityTypeSpot))
+	ecsAPI.DescribeAccountAttributesBehavior.SetError(&tea.SDKError{Code: tea.String("Forbidden.RAM"), StatusCode: tea.Int(403)})
+	p = NewDefaultProvider(ctx, "cn-hangzhou", ecsAPI, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil,
+		quota.NewDefaultProvider("cn-hangzhou", ecsAPI, nil, cache.New(time.Minute, time.Minute)), nil)
+	assert.NoError(t, p.checkQuota(ctx, []*cloudprovider.InstanceType{instanceType("ecs.g7.2xlarge", "8")}, karpv1.CapacityTypeOnDemand))
+}
+
+func TestAcquireLaunchSlot(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{MaxConcurrentLaunches: 3})
+	p := NewDefaultProvider(ctx, "cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+
+	// a burst of launches never has more than the limit in flight
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := p.acquireLaunchSlot(ctx)
+			assert.NoError(t, err)
+			mu.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, maxInFlight)
+
+	// a queued launch gives up when its context is done
+	var releases []func()
+	for range 3 {
+		release, err := p.acquireLaunchSlot(ctx)
+		require.NoError(t, err)
+		releases = append(releases, release)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := p.acquireLaunchSlot(timeoutCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	releases[0]()
+	_, err = p.acquireLaunchSlot(ctx)
+	assert.NoError(t, err)
+
+	// no limit never waits
+	p = NewDefaultProvider(options.ToContext(context.Background(), &options.Options{}), "cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+	for range 100 {
+		_, err := p.acquireLaunchSlot(timeoutCtx)
+		require.NoError(t, err)
+	}
+}
+
+func TestPublishLaunchFailure(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	fakeRecorder := record.NewFakeRecorder(10)
+	p := NewDefaultProvider(ctx, "cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, events.NewRecorder(fakeRecorder))
+
+	cases := []struct {
+		name   string
+		code   string
+		reason string
+	}{
+		{name: "sold out", code: alierrors.ErrCodeNoInstanceStock, reason: "InsufficientCapacity"},
+		{name: "permission error", code: alierrors.ErrCodeForbiddenRAM, reason: "Unauthorized"},
+		{name: "quota exceeded", code: "QuotaExceed.ElasticQuota", reason: "QuotaExceeded"},
+		{name: "invalid spot price limit", code: "InvalidSpotPriceLimit.LowerThanPublicPrice", reason: "LaunchFailed"},
+		// the transient errors are retried without an event
+		{name: "internal error", code: alierrors.ErrCodeInternalError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			nodeClaim := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{Name: "default-abcde", UID: types.UID(tc.name)}}
+			_, err := createAutoProvisioningGroupResponseHandler(testResponse(testLaunchResult("ecs.g7.large", tc.code)))
+			require.Error(t, err)
+
+			p.publishLaunchFailure(nodeClaim, err)
+			if tc.reason == "" {
+				assert.Empty(t, fakeRecorder.Events)
+				return
+			}
+			require.Len(t, fakeRecorder.Events, 1)
+			event := <-fakeRecorder.Events
+			assert.True(t, strings.HasPrefix(event, "Warning "+tc.reason+" Failed to launch instance, "), event)
+			assert.Contains(t, event, tc.code)
+		})
+	}
+}
+
+func TestSetSpotPriceLimit(t *testing.T) {
+	request := &ecsclient.CreateAutoProvisioningGroupRequest{}
+	assert.NoError(t, setSpotPriceLimit(request, &v1alpha1.ECSNodeClass{}))
+	assert.Nil(t, request.MaxSpotPrice)
+	assert.NoError(t, setSpotPriceLimit(request, &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{SpotStrategy: v1alpha1.SpotStrategySpotAsPriceGo}}))
+	assert.Nil(t, request.MaxSpotPrice)
+
+	nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{
+		SpotStrategy:   v1alpha1.SpotStrategySpotWithPriceLimit,
+		SpotPriceLimit: tea.String("0.25"),
+	}}
+	assert.NoError(t, setSpotPriceLimit(request, nodeClass))
+	assert.Equal(t, float32(0.25), tea.Float32Value(request.MaxSpotPrice))
+
+	nodeClass.Spec.SpotPriceLimit = tea.String("0")
+	var createError *cloudprovider.CreateError
+	assert.ErrorAs(t, setSpotPriceLimit(&ecsclient.CreateAutoProvisioningGroupRequest{}, nodeClass), &createError)
+
+	// the rejected bid doesn't pause the launches of the other NodeClasses
+	ctx := options.ToContext(context.Background(), &options.Options{AccountErrorCooldown: time.Minute})
+	p := NewDefaultProvider(ctx, "cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+	p.recordAccountError(ctx, cloudprovider.NewCreateError(errors.New("failed"), "InvalidSpotPriceLimit.LowerThanPublicPrice", "lower than the public price"))
+	assert.NoError(t, p.accountError())
+}
+
+func TestCapacityReservationLaunch(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	p := NewDefaultProvider(ctx, "cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+
+	offering := func(zone, capacityReservationID string, price float64) cloudprovider.Offering {
+		requirement := scheduling.NewRequirement(v1alpha1.LabelCapacityReservationID, corev1.NodeSelectorOpDoesNotExist)
+		if capacityReservationID != "" {
+			requirement = scheduling.NewRequirement(v1alpha1.LabelCapacityReservationID, corev1.NodeSelectorOpIn, capacityReservationID)
+		}
+		return cloudprovider.Offering{
+			Requirements: scheduling.NewRequirements(
+				scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeOnDemand),
+				scheduling.NewRequirement(corev1.LabelTopologyZone, corev1.NodeSelectorOpIn, zone),
+				requirement,
+			),
+			Price:     price,
+			Available: true,
+		}
+	}
+	instanceType := &cloudprovider.InstanceType{Name: "ecs.g7.large", Offerings: cloudprovider.Offerings{
+		offering("cn-hangzhou-i", "", 1),
+		offering("cn-hangzhou-j", "", 1),
+		offering("cn-hangzhou-j", "crp-1", 1e-7),
+	}}
+	zonalVSwitches := map[string]*vswitch.VSwitch{
+		"cn-hangzhou-i": {ID: "vsw-i", ZoneID: "cn-hangzhou-i", AvailableIPAddressCount: 1000},
+		"cn-hangzhou-j": {ID: "vsw-j", ZoneID: "cn-hangzhou-j", AvailableIPAddressCount: 10},
+	}
+	nodeClass := &v1alpha1.ECSNodeClass{Status: v1alpha1.ECSNodeClassStatus{CapacityReservations: []v1alpha1.CapacityReservation{
+		{ID: "crp-1", InstanceType: "ecs.g7.large", ZoneID: "cn-hangzhou-j", AvailableInstanceCount: 2},
+		{ID: "crp-2", InstanceType: "ecs.g7.large", ZoneID: "cn-hangzhou-i", AvailableInstanceCount: 0},
+		{ID: "crp-3", InstanceType: "ecs.c7.large", ZoneID: "cn-hangzhou-j", AvailableInstanceCount: 2},
+	}}}
+	zones := p.zoneStats([]*cloudprovider.InstanceType{instanceType}, karpv1.CapacityTypeOnDemand)
+
+	// the zone of the capacity reservation wins over the zone with more available IP addresses
+	reqs := scheduling.NewRequirements(scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeOnDemand))
+	vSwitchID := getVSwitchID(instanceType, zonalVSwitches, reqs, karpv1.CapacityTypeOnDemand, "", zones)
+	assert.Equal(t, "vsw-j", vSwitchID)
+	configs := []*ecsclient.CreateAutoProvisioningGroupRequestLaunchTemplateConfig{
+		{InstanceType: tea.String("ecs.g7.large"), VSwitchId: tea.String(vSwitchID)},
+	}
+	poolOptions := resourcePoolOptions(nodeClass, reqs, configs, zonalVSwitches)
+	assert.Equal(t, ResourcePoolStrategyPrivatePoolFirst, tea.StringValue(poolOptions.Strategy))
+	assert.Equal(t, []string{"crp-1"}, tea.StringSliceValue(poolOptions.PrivatePoolIds))
+
+	// the capacity reservations are skipped when they are opted out of
+	reqs.Add(scheduling.NewRequirement(v1alpha1.LabelCapacityReservationID, corev1.NodeSelectorOpDoesNotExist))
+	assert.Equal(t, "vsw-i", getVSwitchID(instanceType, zonalVSwitches, reqs, karpv1.CapacityTypeOnDemand, "", zones))
+	assert.Nil(t, resourcePoolOptions(nodeClass, reqs, configs, zonalVSwitches))
+
+	// a required capacity reservation is the only pool to launch into
+	reqs = scheduling.NewRequirements(
+		scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeOnDemand),
+		scheduling.NewRequirement(v1alpha1.LabelCapacityReservationID, corev1.NodeSelectorOpIn, "crp-1"),
+	)
+	assert.Equal(t, "vsw-j", getVSwitchID(instanceType, zonalVSwitches, reqs, karpv1.CapacityTypeOnDemand, "", zones))
+	poolOptions = resourcePoolOptions(nodeClass, reqs, configs, zonalVSwitches)
+	assert.Equal(t, ResourcePoolStrategyPrivatePoolOnly, tea.StringValue(poolOptions.Strategy))
+	assert.Equal(t, []string{"crp-1"}, tea.StringSliceValue(poolOptions.PrivatePoolIds))
+
+	// the instance launched into the only allowed capacity reservation is in it, the instance launched with
+	// PrivatePoolFirst may be in the public pool and is described instead
+	launchResult := &ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult{
+		InstanceIds:  &ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResultInstanceIds{InstanceId: tea.StringSlice([]string{"i-1"})},
+		InstanceType: tea.String("ecs.g7.large"),
+		ZoneId:       tea.String("cn-hangzhou-j"),
+		SpotStrategy: tea.String("NoSpot"),
+	}
+	request := &ecsclient.CreateAutoProvisioningGroupRequest{
+		LaunchConfiguration: &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfiguration{ImageId: tea.String("image-id"), SecurityGroupId: tea.String("sg-1")},
+		ResourcePoolOptions: poolOptions,
+	}
+	assert.Equal(t, "crp-1", NewInstanceFromProvisioningGroup(launchResult, request, "cn-hangzhou").CapacityReservationID)
+	request.ResourcePoolOptions = &ecsclient.CreateAutoProvisioningGroupRequestResourcePoolOptions{
+		Strategy:       tea.String(ResourcePoolStrategyPrivatePoolFirst),
+		PrivatePoolIds: tea.StringSlice([]string{"crp-1"}),
+	}
+	assert.Empty(t, NewInstanceFromProvisioningGroup(launchResult, request, "cn-hangzhou").CapacityReservationID)
+}
+
+// metricValue returns the value of the counter, or the sample count of the histogram, with the labels
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := crmetrics.Registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if !lo.EveryBy(metric.GetLabel(), func(label *dto.LabelPair) bool {
+				return labels[label.GetName()] == label.GetValue()
+			}) {
+				continue
+			}
+			if metric.GetHistogram() != nil {
+				return float64(metric.GetHistogram().GetSampleCount())
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestRecordLaunch(t *testing.T) {
+	const launches = "karpenter_alibabacloud_instance_launch_total"
+	succeeded := map[string]string{resultLabel: resultSuccess, capacityTypeLabel: karpv1.CapacityTypeSpot, errorClassLabel: ""}
+	soldOut := map[string]string{resultLabel: resultFailure, capacityTypeLabel: karpv1.CapacityTypeOnDemand, errorClassLabel: errorClassInsufficientCapacity}
+	failed := map[string]string{resultLabel: resultFailure, capacityTypeLabel: karpv1.CapacityTypeOnDemand, errorClassLabel: errorClassLaunchFailure}
+	launchFailures := map[string]string{resultLabel: resultFailure, capacityTypeLabel: karpv1.CapacityTypeOnDemand}
+	succeededBefore, soldOutBefore, failedBefore := metricValue(t, launches, succeeded), metricValue(t, launches, soldOut), metricValue(t, launches, failed)
+	durationsBefore := metricValue(t, "karpenter_alibabacloud_instance_launch_duration_seconds", launchFailures)
+
+	recordLaunch(karpv1.CapacityTypeSpot, time.Second, nil)
+	recordLaunch(karpv1.CapacityTypeOnDemand, time.Second, cloudprovider.NewInsufficientCapacityError(errors.New("sold out")))
+	recordLaunch(karpv1.CapacityTypeOnDemand, time.Second,
+		cloudprovider.NewCreateError(errors.New("failed"), alierrors.ErrCodeInsufficientBalance, "The account balance is insufficient."))
+
+	assert.Equal(t, succeededBefore+1, metricValue(t, launches, succeeded))
+	assert.Equal(t, soldOutBefore+1, metricValue(t, launches, soldOut))
+	assert.Equal(t, failedBefore+1, metricValue(t, launches, failed))
+	assert.Equal(t, durationsBefore+2, metricValue(t, "karpenter_alibabacloud_instance_launch_duration_seconds", launchFailures))
+
+	assert.Equal(t, errorClassThrottling, launchErrorClass(fmt.Errorf("creating auto provisioning group, %w",
+		&tea.SDKError{Code: tea.String(alierrors.ErrCodeThrottling)})))
+	assert.Equal(t, errorClassOther, launchErrorClass(errors.New("unexpected")))
+}
+
+func TestEIPAssociation(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	ecsAPI, vpcAPI := fake.NewECSAPI(), fake.NewVPCAPI()
+	p := NewDefaultProvider(ctx, "cn-hangzhou", ecsAPI, vpcAPI, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+	nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{EIPAssociation: &v1alpha1.EIPAssociation{Bandwidth: tea.Int32(10)}}}
+	nodeClaim := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{Name: "default-abcde"}}
+
+	// the instances without an elastic IP address aren't associated
+	require.NoError(t, p.associateEIP(ctx, &v1alpha1.ECSNodeClass{}, nodeClaim, "i-0"))
+	assert.Zero(t, vpcAPI.AllocateEipAddressBehavior.Calls())
+
+	require.NoError(t, p.associateEIP(ctx, nodeClass, nodeClaim, "i-1"))
+	allocation := vpcAPI.AllocateEipAddressBehavior.Requests()[0]
+	assert.Equal(t, "10", tea.StringValue(allocation.Bandwidth))
+	assert.Equal(t, defaultEIPInternetChargeType, tea.StringValue(allocation.InternetChargeType))
+	assert.Equal(t, "default-abcde", tea.StringValue(allocation.Name))
+	association := vpcAPI.AssociateEipAddressBehavior.Requests()[0]
+	assert.Equal(t, "i-1", tea.StringValue(association.InstanceId))
+	assert.Equal(t, eipInstanceType, tea.StringValue(association.InstanceType))
+
+	tags, err := getTags(ctx, nodeClass, nodeClaim)
+	require.NoError(t, err)
+	assert.Equal(t, "true", tags[v1alpha1.TagEIPAssociation])
+
+	// the elastic IP addresses which aren't allocated by karpenter are kept when the instance is deleted
+	vpcAPI.EIPs = append(vpcAPI.EIPs, &vpc.DescribeEipAddressesResponseBodyEipAddressesEipAddress{
+		AllocationId: tea.String("eip-user"), InstanceId: tea.String("i-1"), InstanceType: tea.String(eipInstanceType),
+	})
+	p.instanceCache.SetDefault("i-1", &Instance{ID: "i-1", Status: InstanceStatusRunning, Tags: tags})
+	require.NoError(t, p.Delete(ctx, "i-1"))
+	assert.Equal(t, []string{"eip-user"}, lo.Map(vpcAPI.EIPs, func(eip *vpc.DescribeEipAddressesResponseBodyEipAddressesEipAddress, _ int) string {
+		return tea.StringValue(eip.AllocationId)
+	}))
+	assert.Equal(t, 1, vpcAPI.ReleaseEipAddressBehavior.Calls())
+
+	// the elastic IP address is released when it can't be associated before the instance starts
+	backoff := eipBackoff
+	eipBackoff = wait.Backoff{Duration: time.Millisecond, Steps: 2}
+	t.Cleanup(func() { eipBackoff = backoff })
+	vpcAPI.AssociateEipAddressBehavior.SetError(&tea.SDKError{Code: tea.String(alierrors.ErrCodeIncorrectInstanceStatus)})
+	err = p.associateEIP(ctx, nodeClass, nodeClaim, "i-2")
+	assert.True(t, alierrors.IsIncorrectStatus(err), "got %v", err)
+	assert.Equal(t, 3, vpcAPI.AssociateEipAddressBehavior.Calls())
+	assert.Len(t, vpcAPI.EIPs, 1)
+	assert.Equal(t, 1, ecsAPI.DeleteInstanceBehavior.Calls())
+
+	// the launched instance is deleted when the elastic IP address can't be associated, with the elastic IP addresses
+	// karpenter associated with it before
+	vpcAPI.EIPs = append(vpcAPI.EIPs, &vpc.DescribeEipAddressesResponseBodyEipAddressesEipAddress{
+		AllocationId: tea.String("eip-lost"), InstanceId: tea.String("i-3"), InstanceType: tea.String(eipInstanceType),
+		Description: tea.String(eipDescription("c-1")),
+	})
+	err = p.assignAddresses(ctx, nodeClass, nodeClaim, &Instance{ID: "i-3", Status: InstanceStatusPending, CreationTime: time.Now(), Tags: tags})
+	assert.ErrorContains(t, err, "associating elastic IP address with instance i-3")
+	require.Equal(t, 2, ecsAPI.DeleteInstanceBehavior.Calls())
+	assert.Equal(t, "i-3", tea.StringValue(ecsAPI.DeleteInstanceBehavior.Requests()[1].InstanceId))
+	assert.Equal(t, []string{"eip-user"}, lo.Map(vpcAPI.EIPs, func(eip *vpc.DescribeEipAddressesResponseBodyEipAddressesEipAddress, _ int) string {
+		return tea.StringValue(eip.AllocationId)
+	}))
+}
+
+func TestAssignIPv6Addresses(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1"})
+	ecsAPI := fake.NewECSAPI()
+	p := NewDefaultProvider(ctx, "cn-hangzhou", ecsAPI, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+
+	// the instances without IPv6 aren't assigned any
+	require.NoError(t, p.assignIPv6Addresses(ctx, &v1alpha1.ECSNodeClass{}, "i-0"))
+	assert.Zero(t, ecsAPI.DescribeNetworkInterfacesBehavior.Calls())
+
+	require.NoError(t, p.assignIPv6Addresses(ctx, &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{IPv6: &v1alpha1.IPv6{}}}, "i-1"))
+	assert.Equal(t, "i-1", tea.StringValue(ecsAPI.DescribeNetworkInterfacesBehavior.Requests()[0].InstanceId))
+	assert.Equal(t, "Primary", tea.StringValue(ecsAPI.DescribeNetworkInterfacesBehavior.Requests()[0].Type))
+	assignment := ecsAPI.AssignIpv6AddressesBehavior.Requests()[0]
+	assert.Equal(t, "eni-i-1", tea.StringValue(assignment.NetworkInterfaceId))
+	assert.Equal(t, defaultIPv6AddressCount, tea.Int32Value(assignment.Ipv6AddressCount))
+
+	// the assignment is retried while the instance starts
+	backoff := eipBackoff
+	eipBackoff = wait.Backoff{Duration: time.Millisecond, Steps: 2}
+	t.Cleanup(func() { eipBackoff = backoff })
+	ecsAPI.AssignIpv6AddressesBehavior.SetError(&tea.SDKError{Code: tea.String(alierrors.ErrCodeIncorrectInstanceStatus)})
+	err := p.assignIPv6Addresses(ctx, &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{IPv6: &v1alpha1.IPv6{AddressCount: tea.Int32(3)}}}, "i-2")
+	assert.True(t, alierrors.IsIncorrectStatus(err), "got %v", err)
+	assert.Equal(t, 3, ecsAPI.AssignIpv6AddressesBehavior.Calls())
+	assert.Zero(t, ecsAPI.DeleteInstanceBehavior.Calls())
+
+	// the launched instance is deleted when its IPv6 addresses can't be assigned, while it's still pending
+	ecsAPI.AssignIpv6AddressesBehavior.SetError(&tea.SDKError{Code: tea.String("InvalidOperation.Ipv6NotSupported")})
+	nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{IPv6: &v1alpha1.IPv6{}}}
+	err = p.assignAddresses(ctx, nodeClass, &karpv1.NodeClaim{}, &Instance{ID: "i-3", Status: InstanceStatusPending, CreationTime: time.Now()})
+	assert.ErrorContains(t, err, "assigning IPv6 addresses to instance i-3")
+	require.Equal(t, 1, ecsAPI.DeleteInstanceBehavior.Calls())
+	assert.Equal(t, "i-3", tea.StringValue(ecsAPI.DeleteInstanceBehavior.Requests()[0].InstanceId))
+	assert.True(t, tea.BoolValue(ecsAPI.DeleteInstanceBehavior.Requests()[0].Force))
+
+	// the error of the deletion is returned with the one of the assignment
+	ecsAPI.Instances = []*ecsclient.DescribeInstancesResponseBodyInstancesInstance{{
+		InstanceId: tea.String("i-4"), Status: tea.String(InstanceStatusPending), CreationTime: tea.String(time.Now().UTC().Format("2006-01-02T15:04Z")),
+		ImageId: tea.String("image-id"), InstanceType: tea.String("ecs.g7.large"), RegionId: tea.String("cn-hangzhou"),
+		ZoneId: tea.String("cn-hangzhou-i"), SpotStrategy: tea.String("NoSpot"),
+	}}
+	ecsAPI.DeleteInstanceBehavior.SetError(&tea.SDKError{Code: tea.String("InternalError")})
+	err = p.assignAddresses(ctx, nodeClass, &karpv1.NodeClaim{}, &Instance{ID: "i-4", Status: InstanceStatusPending, CreationTime: time.Now()})
+	assert.ErrorContains(t, err, "assigning IPv6 addresses to instance i-4")
+	assert.ErrorContains(t, err, "terminating instance id: i-4")
+}
+
+func TestUpdateUnavailableOfferingsCache(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{InsufficientCapacityCooldown: 100 * time.Millisecond})
+	unavailableOfferings := kcache.NewUnavailableOfferings()
+	p := NewDefaultProvider(ctx, "cn-hangzhou", nil, nil, nil, unavailableOfferings, nil, nil, nil, nil, nil)
+
+	p.updateUnavailableOfferingsCache(ctx, testResponse(
+		testLaunchResult("ecs.g7.large", alierrors.ErrCodeNoInstanceStock),
+		testLaunchResult("ecs.c7.large", alierrors.ErrCodeInsufficientBalance),
+		testLaunchResult("ecs.g7.xlarge", "", "i-1"),
+	), karpv1.CapacityTypeSpot)
+	// only the sold out offering is skipped, and only for its capacity type
+	assert.True(t, unavailableOfferings.IsUnavailable("ecs.g7.large", "cn-hangzhou-i", karpv1.CapacityTypeSpot))
+	assert.False(t, unavailableOfferings.IsUnavailable("ecs.g7.large", "cn-hangzhou-i", karpv1.CapacityTypeOnDemand))
+	assert.False(t, unavailableOfferings.IsUnavailable("ecs.c7.large", "cn-hangzhou-i", karpv1.CapacityTypeSpot))
+	assert.False(t, unavailableOfferings.IsUnavailable("ecs.g7.xlarge", "cn-hangzhou-i", karpv1.CapacityTypeSpot))
+
+	// the offering is launched again after the cooldown
+	assert.Eventually(t, func() bool {
+		return !unavailableOfferings.IsUnavailable("ecs.g7.large", "cn-hangzhou-i", karpv1.CapacityTypeSpot)
+	}, time.Second, 10*time.Millisecond)
+
+	// a zero cooldown doesn't skip the offering
+	ctx = options.ToContext(context.Background(), &options.Options{})
+	p.updateUnavailableOfferingsCache(ctx, testResponse(testLaunchResult("ecs.g7.large", alierrors.ErrCodeNoInstanceStock)), karpv1.CapacityTypeSpot)
+	assert.False(t, unavailableOfferings.IsUnavailable("ecs.g7.large", "cn-hangzhou-i", karpv1.CapacityTypeSpot))
+}
+
+func TestDryRunProvisioningGroup(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1", DryRun: true})
+	ecsAPI := fake.NewECSAPI()
+	p := NewDefaultProvider(ctx, "cn-hangzhou", ecsAPI, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+	request := &ecsclient.CreateAutoProvisioningGroupRequest{
+		RegionId: tea.String("cn-hangzhou"),
+		LaunchTemplateConfig: []*ecsclient.CreateAutoProvisioningGroupRequestLaunchTemplateConfig{
+			{InstanceType: tea.String("ecs.g7.large"), VSwitchId: tea.String("vsw-i")},
+			{InstanceType: tea.String("ecs.c7.large"), VSwitchId: tea.String("vsw-j")},
+		},
+		LaunchConfiguration: &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfiguration{ImageId: tea.String("image-id"), SystemDiskSize: tea.Int32(40)},
+	}
+
+	// the launch which would succeed fails with the dry run reason, without launching an instance
+	err := p.dryRunProvisioningGroup(ctx, request, karpv1.CapacityTypeSpot)
+	var createError *cloudprovider.CreateError
+	require.ErrorAs(t, err, &createError)
+	assert.Equal(t, alierrors.ErrCodeDryRunOperation, createError.ConditionReason)
+	assert.Zero(t, ecsAPI.CreateAutoProvisioningGroupBehavior.Calls())
+	runInstances := ecsAPI.RunInstancesBehavior.Requests()[0]
+	assert.True(t, tea.BoolValue(runInstances.DryRun))
+	assert.Equal(t, "ecs.g7.large", tea.StringValue(runInstances.InstanceType))
+	assert.Equal(t, "vsw-i", tea.StringValue(runInstances.VSwitchId))
+	assert.Equal(t, "image-id", tea.StringValue(runInstances.ImageId))
+	assert.Equal(t, "SpotAsPriceGo", tea.StringValue(runInstances.SpotStrategy))
+
+	// the errors of the launch still surface
+	ecsAPI.RunInstancesBehavior.SetError(&tea.SDKError{Code: tea.String(alierrors.ErrCodeForbiddenRAM), Message: tea.String("not authorized")})
+	err = p.dryRunProvisioningGroup(ctx, request, karpv1.CapacityTypeOnDemand)
+	require.ErrorAs(t, err, &createError)
+	assert.Equal(t, alierrors.ErrCodeForbiddenRAM, createError.ConditionReason)
+	ecsAPI.RunInstancesBehavior.SetError(&tea.SDKError{Code: tea.String(alierrors.ErrCodeNoInstanceStock)})
+	assert.True(t, cloudprovider.IsInsufficientCapacityError(p.dryRunProvisioningGroup(ctx, request, karpv1.CapacityTypeOnDemand)))
+}
+
+func TestFallbackToOnDemand(t *testing.T) {
+	offering := func(capacityType string, available bool) cloudprovider.Offering {
+		return cloudprovider.Offering{
+			Requirements: scheduling.NewRequirements(
+				scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, capacityType),
+				scheduling.NewRequirement(corev1.LabelTopologyZone, corev1.NodeSelectorOpIn, "cn-hangzhou-i"),
+			),
+			Price:     1,
+			Available: available,
+		}
+	}
+	instanceTypes := []*cloudprovider.InstanceType{{Name: "ecs.g7.large", Offerings: cloudprovider.Offerings{
+		offering(karpv1.CapacityTypeSpot, true),
+		offering(karpv1.CapacityTypeOnDemand, true),
+	}}}
+	nodeClaim := func(capacityTypes ...string) *karpv1.NodeClaim {
+		return &karpv1.NodeClaim{Spec: karpv1.NodeClaimSpec{Requirements: []karpv1.NodeSelectorRequirementWithMinValues{{
+			NodeSelectorRequirement: corev1.NodeSelectorRequirement{Key: karpv1.CapacityTypeLabelKey, Operator: corev1.NodeSelectorOpIn, Values: capacityTypes},
+		}}}}
+	}
+	soldOut := cloudprovider.NewInsufficientCapacityError(errors.New("sold out"))
+
+	// the NodeClaim which allows both capacity types falls back to on-demand
+	spotOrOnDemand := nodeClaim(karpv1.CapacityTypeSpot, karpv1.CapacityTypeOnDemand)
+	assert.True(t, fallbackToOnDemand(spotOrOnDemand, instanceTypes, karpv1.CapacityTypeSpot, soldOut))
+	// the NodeClaim which requires spot waits for spot capacity
+	assert.False(t, fallbackToOnDemand(nodeClaim(karpv1.CapacityTypeSpot), instanceTypes, karpv1.CapacityTypeSpot, soldOut))
+
+	// only the spot launches which are sold out fall back
+	assert.False(t, fallbackToOnDemand(spotOrOnDemand, instanceTypes, karpv1.CapacityTypeSpot, nil))
+	assert.False(t, fallbackToOnDemand(spotOrOnDemand, instanceTypes, karpv1.CapacityTypeSpot, errors.New("unexpected")))
+	assert.False(t, fallbackToOnDemand(spotOrOnDemand, instanceTypes, karpv1.CapacityTypeOnDemand, soldOut))
+
+	// no on-demand offering is available
+	instanceTypes[0].Offerings[1].Available = false
+	assert.False(t, fallbackToOnDemand(spotOrOnDemand, instanceTypes, karpv1.CapacityTypeSpot, soldOut))
+}
+
+func TestLaunchBatched(t *testing.T) {
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterID: "c-1", InsufficientCapacityCooldown: time.Minute})
+	ecsAPI := fake.NewECSAPI()
+	p := NewDefaultProvider(ctx, "cn-hangzhou", ecsAPI, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil, nil, nil)
+	request := func(nodeClaim, imageID string) *ecsclient.CreateAutoProvisioningGroupRequest {
+		return &ecsclient.CreateAutoProvisioningGroupRequest{
+			ClientToken:              tea.String(nodeClaim + "-token"),
+			TotalTargetCapacity:      tea.String("1"),
+			PayAsYouGoTargetCapacity: tea.String("1"),
+			SpotTargetCapacity:       tea.String("0"),
+			LaunchTemplateConfig: []*ecsclient.CreateAutoProvisioningGroupRequestLaunchTemplateConfig{
+				{InstanceType: tea.String("ecs.g7.large"), VSwitchId: tea.String("vsw-i")},
+				{InstanceType: tea.String("ecs.c7.large"), VSwitchId: tea.String("vsw-i")},
+			},
+			LaunchConfiguration: &ecsclient.CreateAutoProvisioningGroupRequestLaunchConfiguration{
+				ImageId:      tea.String(imageID),
+				InstanceName: tea.String("karpenter-" + nodeClaim),
+				Tag: []*ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationTag{
+					{Key: tea.String(v1alpha1.TagNodeClaim), Value: tea.String(nodeClaim)},
+					{Key: tea.String(karpv1.NodePoolLabelKey), Value: tea.String("default")},
+				},
+			},
+		}
+	}
+	type launched struct {
+		nodeClaim  string
+		instanceID string
+		err        error
+	}
+	launch := func(imageIDs map[string]string) map[string]launched {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		results := map[string]launched{}
+		for name, imageID := range imageIDs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				nodeClaim := &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{Name: name}}
+				result, err := p.launchBatched(ctx, nodeClaim, request(name, imageID), karpv1.CapacityTypeOnDemand, 50*time.Millisecond)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					results[name] = launched{nodeClaim: name, err: err}
+					return
+				}
+				results[name] = launched{nodeClaim: name, instanceID: tea.StringValue(result.InstanceIds.InstanceId[0])}
+			}()
+		}
+		wg.Wait()
+		return results
+	}
+
+	// the identical NodeClaims are launched by a single auto provisioning group, the instances are split across them
+	ecsAPI.CreateAutoProvisioningGroupBehavior.SetOutput(testResponse(
+		testLaunchResult("ecs.g7.large", "", "i-1", "i-2"),
+		testLaunchResult("ecs.c7.large", "", "i-3"),
+	))
+	results := launch(map[string]string{"default-a": "image-1", "default-b": "image-1", "default-c": "image-1"})
+	require.Equal(t, 1, ecsAPI.CreateAutoProvisioningGroupBehavior.Calls())
+	batched := ecsAPI.CreateAutoProvisioningGroupBehavior.Requests()[0]
+	assert.Equal(t, "3", tea.StringValue(batched.TotalTargetCapacity))
+	assert.Equal(t, "3", tea.StringValue(batched.PayAsYouGoTargetCapacity))
+	assert.Equal(t, "0", tea.StringValue(batched.SpotTargetCapacity))
+	assert.True(t, strings.HasPrefix(tea.StringValue(batched.ClientToken), "batch-"))
+	assert.Equal(t, []string{karpv1.NodePoolLabelKey}, lo.Map(batched.LaunchConfiguration.Tag, func(tag *ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationTag, _ int) string {
+		return tea.StringValue(tag.Key)
+	}))
+	for _, result := range results {
+		assert.NoError(t, result.err)
+	}
+	assert.ElementsMatch(t, []string{"i-1", "i-2", "i-3"}, lo.Map(lo.Values(results), func(l launched, _ int) string { return l.instanceID }))
+	// every instance is tagged with the NodeClaim it's launched for
+	tagged := lo.SliceToMap(ecsAPI.AddTagsBehavior.Requests(), func(r *ecsclient.AddTagsRequest) (string, string) {
+		return tea.StringValue(r.ResourceId), tea.StringValue(r.Tag[0].Value)
+	})
+	for _, result := range results {
+		assert.Equal(t, result.nodeClaim, tagged[result.instanceID])
+	}
+	// and named after it, the names of the NodeClaims don't split the batch
+	assert.Nil(t, batched.LaunchConfiguration.InstanceName)
+	named := lo.SliceToMap(ecsAPI.ModifyInstanceAttributeBehavior.Requests(), func(r *ecsclient.ModifyInstanceAttributeRequest) (string, string) {
+		return tea.StringValue(r.InstanceId), tea.StringValue(r.InstanceName)
+	})
+	for _, result := range results {
+		assert.Equal(t, "karpenter-"+result.nodeClaim, named[result.instanceID])
+	}
+
+	// the NodeClaims left without an instance fail with the errors of the group, the other requests aren't batched
+	ecsAPI.Reset()
+	ecsAPI.CreateAutoProvisioningGroupBehavior.SetOutput(testResponse(
+		testLaunchResult("ecs.g7.large", "", "i-1"),
+		testLaunchResult("ecs.c7.large", alierrors.ErrCodeNoInstanceStock),
+	))
+	results = launch(map[string]string{"default-a": "image-1", "default-b": "image-1", "default-c": "image-1", "default-d": "image-2"})
+	assert.Equal(t, 2, ecsAPI.CreateAutoProvisioningGroupBehavior.Calls())
+	assert.ElementsMatch(t, []string{"3", "1"}, lo.Map(ecsAPI.CreateAutoProvisioningGroupBehavior.Requests(), func(r *ecsclient.CreateAutoProvisioningGroupRequest, _ int) string {
+		return tea.StringValue(r.TotalTargetCapacity)
+	}))
+	require.NoError(t, results["default-d"].err)
+	// the request of a single NodeClaim is launched as is, its instance is already tagged
+	assert.Len(t, ecsAPI.AddTagsBehavior.Requests(), 1)
+	failed := lo.Filter(lo.Values(results), func(l launched, _ int) bool { return l.err != nil })
+	require.Len(t, failed, 2)
+	for _, result := range failed {
+		assert.True(t, cloudprovider.IsInsufficientCapacityError(result.err), result.err)
+	}
+}
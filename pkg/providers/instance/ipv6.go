@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"fmt"
+
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/samber/lo"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/logging"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
+)
+
+const defaultIPv6AddressCount int32 = 1
+
+// ipv6AddressCount returns the number of IPv6 addresses assigned to the instances of the ECSNodeClass, 0 without IPv6
+func ipv6AddressCount(nodeClass *v1alpha1.ECSNodeClass) int32 {
+	if nodeClass.Spec.IPv6 == nil {
+		return 0
+	}
+	return lo.FromPtrOr(nodeClass.Spec.IPv6.AddressCount, defaultIPv6AddressCount)
+}
+
+// assignIPv6Addresses assigns the IPv6 addresses of the ECSNodeClass to the primary network interface of the instance.
+// The auto provisioning group can't request IPv6 addresses, so they're assigned right after the launch, while the
+// instance starts. The instances launched with RunInstances request them in the launch.
+func (p *DefaultProvider) assignIPv6Addresses(ctx context.Context, nodeClass *v1alpha1.ECSNodeClass, instanceID string) error {
+	count := ipv6AddressCount(nodeClass)
+	if count == 0 {
+		return nil
+	}
+	resp, err := ratelimit.Call(ctx, p.rateLimiter, "DescribeNetworkInterfaces", func() (*ecsclient.DescribeNetworkInterfacesResponse, error) {
+		return p.ecsClient.DescribeNetworkInterfacesWithOptions(&ecsclient.DescribeNetworkInterfacesRequest{
+			RegionId:   tea.String(p.region),
+			InstanceId: tea.String(instanceID),
+			Type:       tea.String("Primary"),
+		}, &util.RuntimeOptions{})
+	})
+	if err != nil {
+		return fmt.Errorf("describing network interfaces, %w", err)
+	}
+	if resp == nil || resp.Body == nil || resp.Body.NetworkInterfaceSets == nil || len(resp.Body.NetworkInterfaceSets.NetworkInterfaceSet) == 0 {
+		return fmt.Errorf("no primary network interface found for instance %s", instanceID)
+	}
+	networkInterfaceID := tea.StringValue(resp.Body.NetworkInterfaceSets.NetworkInterfaceSet[0].NetworkInterfaceId)
+
+	if err := retryIncorrectStatus(ctx, func() error {
+		_, err := ratelimit.Call(ctx, p.rateLimiter, "AssignIpv6Addresses", func() (*ecsclient.AssignIpv6AddressesResponse, error) {
+			return p.ecsClient.AssignIpv6AddressesWithOptions(&ecsclient.AssignIpv6AddressesRequest{
+				RegionId:           tea.String(p.region),
+				NetworkInterfaceId: tea.String(networkInterfaceID),
+				Ipv6AddressCount:   tea.Int32(count),
+				ClientToken:        tea.String(fmt.Sprintf("ipv6-%s", instanceID)),
+			}, &util.RuntimeOptions{})
+		})
+		return err
+	}); err != nil {
+		return fmt.Errorf("assigning IPv6 addresses to network interface %s, %w", networkInterfaceID, err)
+	}
+	logging.FromContext(ctx).WithValues("id", instanceID, "count", count).V(1).Info("assigned IPv6 addresses")
+	return nil
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/mitchellh/hashstructure/v2"
+	"github.com/samber/lo"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/logging"
+)
+
+// maxLaunchBatchSize is the max number of instances launched by a single auto provisioning group
+const maxLaunchBatchSize = 100
+
+type launchResult = ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResult
+
+// launchBatch is the launches of identical NodeClaims waiting to be launched by a single auto provisioning group
+type launchBatch struct {
+	// ctx is the context of the first launch, without its cancellation, so the batch outlives it
+	ctx          context.Context
+	request      *ecsclient.CreateAutoProvisioningGroupRequest
+	capacityType string
+	launches     []*batchedLaunch
+	timer        *time.Timer
+}
+
+// batchedLaunch is the launch of a NodeClaim in a batch, done is closed once its result or error is set
+type batchedLaunch struct {
+	nodeClaim *karpv1.NodeClaim
+	request   *ecsclient.CreateAutoProvisioningGroupRequest
+	result    *launchResult
+	err       error
+	done      chan struct{}
+}
+
+// launchBatched launches the NodeClaim together with the identical NodeClaims launched within the batch window. A batch
+// is launched once the window of its first launch ends or it reaches the max batch size, and its instances are split
+// across its NodeClaims. The NodeClaims left without an instance fail with the errors of the auto provisioning group.
+func (p *DefaultProvider) launchBatched(ctx context.Context, nodeClaim *karpv1.NodeClaim, request *ecsclient.CreateAutoProvisioningGroupRequest,
+	capacityType string, window time.Duration,
+) (*launchResult, error) {
+	key := launchBatchKey(request, capacityType)
+	launch := &batchedLaunch{nodeClaim: nodeClaim, request: request, done: make(chan struct{})}
+
+	p.launchBatchesMu.Lock()
+	batch, ok := p.launchBatches[key]
+	if !ok {
+		batch = &launchBatch{ctx: context.WithoutCancel(ctx), request: request, capacityType: capacityType}
+		batch.timer = time.AfterFunc(window, func() { p.flushLaunchBatch(key, batch) })
+		p.launchBatches[key] = batch
+	}
+	batch.launches = append(batch.launches, launch)
+	full := len(batch.launches) >= maxLaunchBatchSize
+	p.launchBatchesMu.Unlock()
+	if full {
+		p.flushLaunchBatch(key, batch)
+	}
+
+	select {
+	case <-launch.done:
+	case <-ctx.Done():
+		// the instance launched for the NodeClaim anyway is garbage collected
+		return nil, ctx.Err()
+	}
+	if launch.err != nil {
+		return nil, launch.err
+	}
+	if len(batch.launches) > 1 {
+		instanceID := tea.StringValue(launch.result.InstanceIds.InstanceId[0])
+		p.tagBatchedInstance(ctx, nodeClaim, instanceID)
+		p.nameBatchedInstance(ctx, nodeClaim, instanceID, tea.StringValue(request.LaunchConfiguration.InstanceName))
+	}
+	return launch.result, nil
+}
+
+// flushLaunchBatch launches the batch unless it's launched already
+func (p *DefaultProvider) flushLaunchBatch(key uint64, batch *launchBatch) {
+	p.launchBatchesMu.Lock()
+	if p.launchBatches[key] != batch {
+		p.launchBatchesMu.Unlock()
+		return
+	}
+	delete(p.launchBatches, key)
+	batch.timer.Stop()
+	p.launchBatchesMu.Unlock()
+
+	defer func() {
+		for _, launch := range batch.launches {
+			close(launch.done)
+		}
+	}()
+
+	request := batch.request
+	if len(batch.launches) > 1 {
+		request = launchBatchRequest(batch.request, batch.launches, batch.capacityType)
+		logging.FromContext(batch.ctx).WithValues("nodeclaims", len(batch.launches)).V(1).Info("launching a batch of nodeclaims")
+	}
+	resp, err := p.createAutoProvisioningGroup(batch.ctx, request, batch.capacityType)
+	if err != nil {
+		for _, launch := range batch.launches {
+			launch.err = err
+		}
+		return
+	}
+	for _, launch := range batch.launches {
+		p.publishDeploymentSetFull(launch.nodeClaim, launch.request, resp)
+	}
+
+	results, err := splitLaunchResults(resp, len(batch.launches))
+	for i, launch := range batch.launches {
+		if i < len(results) {
+			launch.result = results[i]
+			continue
+		}
+		launch.err = err
+	}
+}
+
+// launchBatchKey hashes the request without the client token, the NodeClaim tag and the instance name, the requests
+// of NodeClaims with the same key only differ in the NodeClaim they launch for
+func launchBatchKey(request *ecsclient.CreateAutoProvisioningGroupRequest, capacityType string) uint64 {
+	normalized := *request
+	normalized.ClientToken = nil
+	launchConfiguration := *request.LaunchConfiguration
+	launchConfiguration.Tag = withoutNodeClaimTag(launchConfiguration.Tag)
+	launchConfiguration.InstanceName = nil
+	// the tags are rendered from a map, so their order is random
+	sort.Slice(launchConfiguration.Tag, func(i, j int) bool {
+		return tea.StringValue(launchConfiguration.Tag[i].Key) < tea.StringValue(launchConfiguration.Tag[j].Key)
+	})
+	normalized.LaunchConfiguration = &launchConfiguration
+	return lo.Must(hashstructure.Hash([]any{capacityType, &normalized}, hashstructure.FormatV2, nil))
+}
+
+// launchBatchRequest returns the request launching an instance for every launch of the batch. The instances are
+// tagged and named after their NodeClaims once they're split, and the client token is derived from the tokens of the
+// launches.
+func launchBatchRequest(request *ecsclient.CreateAutoProvisioningGroupRequest, launches []*batchedLaunch,
+	capacityType string,
+) *ecsclient.CreateAutoProvisioningGroupRequest {
+	count := tea.String(strconv.Itoa(len(launches)))
+	tokens := lo.Map(launches, func(launch *batchedLaunch, _ int) string { return tea.StringValue(launch.request.ClientToken) })
+	sort.Strings(tokens)
+
+	batched := *request
+	launchConfiguration := *request.LaunchConfiguration
+	launchConfiguration.Tag = withoutNodeClaimTag(launchConfiguration.Tag)
+	launchConfiguration.InstanceName = nil
+	batched.LaunchConfiguration = &launchConfiguration
+	// The token is at most 64 ASCII characters
+	batched.ClientToken = tea.String(fmt.Sprintf("batch-%016x", lo.Must(hashstructure.Hash(tokens, hashstructure.FormatV2, nil))))
+	batched.TotalTargetCapacity = count
+	if capacityType == karpv1.CapacityTypeSpot {
+		batched.SpotTargetCapacity = count
+	} else {
+		batched.PayAsYouGoTargetCapacity = count
+	}
+	return &batched
+}
+
+func withoutNodeClaimTag(tags []*ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationTag) []*ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationTag {
+	return lo.Reject(tags, func(tag *ecsclient.CreateAutoProvisioningGroupRequestLaunchConfigurationTag, _ int) bool {
+		return tea.StringValue(tag.Key) == v1alpha1.TagNodeClaim
+	})
+}
+
+// splitLaunchResults returns a launch result of a single instance for every instance launched by the auto provisioning
+// group, up to the count. When fewer instances are launched, the error is the one of the group without its instances.
+func splitLaunchResults(resp *ecsclient.CreateAutoProvisioningGroupResponse, count int) ([]*launchResult, error) {
+	if _, err := createAutoProvisioningGroupResponseHandler(resp); err != nil {
+		return nil, err
+	}
+
+	var results []*launchResult
+	for _, result := range lo.Compact(resp.Body.LaunchResults.LaunchResult) {
+		if result.InstanceIds == nil {
+			continue
+		}
+		for _, id := range result.InstanceIds.InstanceId {
+			instance := *result
+			instance.InstanceIds = &ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResultsLaunchResultInstanceIds{InstanceId: []*string{id}}
+			results = append(results, &instance)
+		}
+	}
+	if len(results) >= count {
+		return results[:count], nil
+	}
+
+	failed := *resp
+	body := *resp.Body
+	body.LaunchResults = &ecsclient.CreateAutoProvisioningGroupResponseBodyLaunchResults{
+		LaunchResult: lo.Filter(lo.Compact(resp.Body.LaunchResults.LaunchResult), func(result *launchResult, _ int) bool {
+			return result.InstanceIds == nil || len(result.InstanceIds.InstanceId) == 0
+		}),
+	}
+	failed.Body = &body
+	if _, err := createAutoProvisioningGroupResponseHandler(&failed); err != nil {
+		return results, err
+	}
+	return results, fmt.Errorf("the auto provisioning group launched %d of %d instances: %s", len(results), count, tea.Prettify(resp.Body))
+}
+
+// tagBatchedInstance tags the instance launched by a batch with its NodeClaim. When it fails, the tagging controller
+// tags the instance once its node registers.
+func (p *DefaultProvider) tagBatchedInstance(ctx context.Context, nodeClaim *karpv1.NodeClaim, instanceID string) {
+	request := &ecsclient.AddTagsRequest{
+		RegionId:     tea.String(p.region),
+		ResourceType: tea.String("instance"),
+		ResourceId:   tea.String(instanceID),
+		Tag:          []*ecsclient.AddTagsRequestTag{{Key: tea.String(v1alpha1.TagNodeClaim), Value: tea.String(nodeClaim.Name)}},
+	}
+	if _, err := p.ecsClient.AddTagsWithOptions(request, &util.RuntimeOptions{}); err != nil {
+		logging.ForNodeClaim(ctx, nodeClaim).Error(err, "failed to tag the instance launched by a batch", "instance", instanceID)
+	}
+}
+
+// nameBatchedInstance names the instance launched by a batch after its NodeClaim, the name only shows in the ECS
+// console, so a failure is only logged
+func (p *DefaultProvider) nameBatchedInstance(ctx context.Context, nodeClaim *karpv1.NodeClaim, instanceID, instanceName string) {
+	if instanceName == "" {
+		return
+	}
+	request := &ecsclient.ModifyInstanceAttributeRequest{
+		InstanceId:   tea.String(instanceID),
+		InstanceName: tea.String(instanceName),
+	}
+	if _, err := p.ecsClient.ModifyInstanceAttributeWithOptions(request, &util.RuntimeOptions{}); err != nil {
+		logging.ForNodeClaim(ctx, nodeClaim).Error(err, "failed to name the instance launched by a batch", "instance", instanceID)
+	}
+}
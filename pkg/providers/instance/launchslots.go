@@ -0,0 +1,39 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+)
+
+// acquireLaunchSlot waits for one of the max-concurrent-launches slots, so a large scale-up doesn't exceed the launch
+// quotas of the account. The returned function releases the slot, the wait fails when the context is done.
+func (p *DefaultProvider) acquireLaunchSlot(ctx context.Context) (func(), error) {
+	if p.launchSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case p.launchSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	InstanceLaunchesInFlight.Set(float64(len(p.launchSlots)), map[string]string{})
+	return func() {
+		<-p.launchSlots
+		InstanceLaunchesInFlight.Set(float64(len(p.launchSlots)), map[string]string{})
+	}, nil
+}
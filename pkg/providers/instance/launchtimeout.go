@@ -0,0 +1,40 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+)
+
+// LaunchTimedOut returns whether the instance has been Pending or Starting for longer than the launch timeout,
+// counted from its last start or, when it was never started, from its creation
+func LaunchTimedOut(ctx context.Context, instance *Instance) bool {
+	timeout := lo.FromPtr(options.FromContext(ctx)).LaunchTimeout
+	if timeout <= 0 || (instance.Status != InstanceStatusPending && instance.Status != InstanceStatusStarting) {
+		return false
+	}
+	launched := instance.CreationTime
+	if instance.StartTime.After(launched) {
+		launched = instance.StartTime
+	}
+	return time.Since(launched) > timeout
+}
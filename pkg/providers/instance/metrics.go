@@ -0,0 +1,114 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package instance
+
+import (
+	"errors"
+	"time"
+
+	opmetrics "github.com/awslabs/operatorpkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/metrics"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+)
+
+const (
+	subsystem         = "alibabacloud"
+	resultLabel       = "result"
+	capacityTypeLabel = "capacity_type"
+	errorClassLabel   = "error_class"
+
+	resultSuccess  = "success"
+	resultFailure  = "failure"
+	resultNotFound = "not_found"
+
+	errorClassInsufficientCapacity = "insufficient_capacity"
+	errorClassLaunchFailure        = "launch_failure"
+	errorClassThrottling           = "throttling"
+	errorClassOther                = "other"
+)
+
+var (
+	InstanceLaunchDuration = opmetrics.NewPrometheusHistogram(
+		crmetrics.Registry,
+		prometheus.HistogramOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "instance_launch_duration_seconds",
+			Help:      "Duration of the ECS instance launches in seconds, labeled by the result and the capacity type.",
+			Buckets:   metrics.DurationBuckets(),
+		},
+		[]string{resultLabel, capacityTypeLabel},
+	)
+	InstanceLaunchTotal = opmetrics.NewPrometheusCounter(
+		crmetrics.Registry,
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "instance_launch_total",
+			Help:      "Number of ECS instance launches, labeled by the result, the capacity type and the error class of the failed launches.",
+		},
+		[]string{resultLabel, capacityTypeLabel, errorClassLabel},
+	)
+	InstanceTerminationTotal = opmetrics.NewPrometheusCounter(
+		crmetrics.Registry,
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "instance_termination_total",
+			Help:      "Number of ECS instance terminations, labeled by the result. The instances released before the termination are not_found.",
+		},
+		[]string{resultLabel},
+	)
+	InstanceLaunchesInFlight = opmetrics.NewPrometheusGauge(
+		crmetrics.Registry,
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "instance_launches_in_flight",
+			Help:      "Number of ECS instance launches in flight, limited by max-concurrent-launches.",
+		},
+		[]string{},
+	)
+)
+
+// recordLaunch records the duration and the outcome of a launch
+func recordLaunch(capacityType string, duration time.Duration, err error) {
+	result, errorClass := resultSuccess, ""
+	if err != nil {
+		result, errorClass = resultFailure, launchErrorClass(err)
+	}
+	InstanceLaunchDuration.Observe(duration.Seconds(), map[string]string{resultLabel: result, capacityTypeLabel: capacityType})
+	InstanceLaunchTotal.Inc(map[string]string{resultLabel: result, capacityTypeLabel: capacityType, errorClassLabel: errorClass})
+}
+
+// launchErrorClass classifies the error of a failed launch into a bounded set of metric label values
+func launchErrorClass(err error) string {
+	var createError *cloudprovider.CreateError
+	switch {
+	case cloudprovider.IsInsufficientCapacityError(err):
+		return errorClassInsufficientCapacity
+	case errors.As(err, &createError):
+		return errorClassLaunchFailure
+	case alierrors.IsThrottling(err):
+		return errorClassThrottling
+	default:
+		return errorClassOther
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/logging"
+)
+
+// errCodeQuotaExceedVCPU is the condition reason of the launches failed before calling ECS because they exceed the
+// vCPU quota of the account
+const errCodeQuotaExceedVCPU = alierrors.ErrCodeQuotaExceed + ".VCPU"
+
+// checkQuota fails the launch if none of the instance types fits in the vCPUs left in the quota of the capacity type,
+// ECS would reject it anyway. The launch goes on when the quota is unknown.
+func (p *DefaultProvider) checkQuota(ctx context.Context, instanceTypes []*cloudprovider.InstanceType, capacityType string) error {
+	if p.quotaProvider == nil || len(instanceTypes) == 0 {
+		return nil
+	}
+	quota, err := p.quotaProvider.Get(ctx)
+	if err != nil {
+		// The failure is cached by the quota provider, it's only worth a debug log on every launch
+		logging.FromContext(ctx).V(1).Info("failed getting vCPU quota, launching without checking it", "error", err.Error())
+		return nil
+	}
+	headroom, ok := quota.Headroom(capacityType)
+	if !ok {
+		return nil
+	}
+	minVCPUs := lo.Min(lo.Map(instanceTypes, func(instanceType *cloudprovider.InstanceType, _ int) int64 {
+		return instanceType.Capacity.Cpu().Value()
+	}))
+	if minVCPUs <= headroom {
+		return nil
+	}
+	message := fmt.Sprintf("The %s vCPU quota of the region has %d of %d vCPUs left, the smallest instance type needs %d vCPUs, raise the quota in the Quota Center",
+		capacityType, headroom, quota.VCPULimits[capacityType], minVCPUs)
+	return cloudprovider.NewCreateError(fmt.Errorf("launch exceeds vCPU quota, %s", message), errCodeQuotaExceedVCPU, message)
+}
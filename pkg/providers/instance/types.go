@@ -17,11 +17,14 @@ package instance
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
 	"github.com/samber/lo"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
 )
@@ -33,12 +36,17 @@ const (
 	InstanceStatusStarting = "Starting"
 	InstanceStatusStopping = "Stopping"
 	InstanceStatusStopped  = "Stopped"
+
+	// LockReasonRecycling locks the spot instances which are interrupted and pending release
+	LockReasonRecycling = "Recycling"
 )
 
 // Instance is an internal data representation of either an ecsclient.DescribeInstancesResponseBodyInstancesInstance
 // It contains all the common data that is needed to inject into the Machine from either of these responses
 type Instance struct {
-	CreationTime     time.Time         `json:"creationTime"`
+	CreationTime time.Time `json:"creationTime"`
+	// StartTime is when the instance was last started, zero until it's started
+	StartTime        time.Time         `json:"startTime"`
 	Status           string            `json:"status"`
 	ID               string            `json:"id"`
 	ImageID          string            `json:"imageId"`
@@ -49,6 +57,10 @@ type Instance struct {
 	SecurityGroupIDs []string          `json:"securityGroupIds"`
 	VSwitchID        string            `json:"vSwitchId"`
 	Tags             map[string]string `json:"tags"`
+	// LockReasons are the reasons why the instance is locked, e.g. Recycling when the spot instance is interrupted
+	LockReasons []string `json:"lockReasons"`
+	// CapacityReservationID is the capacity reservation the instance is launched into, empty in the public pool
+	CapacityReservationID string `json:"capacityReservationId"`
 }
 
 func NewInstance(out *ecsclient.DescribeInstancesResponseBodyInstancesInstance) *Instance {
@@ -57,8 +69,16 @@ func NewInstance(out *ecsclient.DescribeInstancesResponseBodyInstancesInstance)
 		log.Log.Error(err, "Failed to parse creation time")
 	}
 
+	var startTime time.Time
+	if out.StartTime != nil && *out.StartTime != "" {
+		if startTime, err = utils.ParseISO8601(*out.StartTime); err != nil {
+			log.Log.Error(err, "Failed to parse start time")
+		}
+	}
+
 	return &Instance{
 		CreationTime:     creationTime,
+		StartTime:        startTime,
 		Status:           *out.Status,
 		ID:               *out.InstanceId,
 		ImageID:          *out.ImageId,
@@ -69,6 +89,9 @@ func NewInstance(out *ecsclient.DescribeInstancesResponseBodyInstancesInstance)
 		SecurityGroupIDs: toSecurityGroupIDs(out.SecurityGroupIds),
 		VSwitchID:        toVSwitchID(out.VpcAttributes),
 		Tags:             toTags(out.Tags),
+		LockReasons:      toLockReasons(out.OperationLocks),
+
+		CapacityReservationID: toCapacityReservationID(out.EcsCapacityReservationAttr),
 	}
 }
 
@@ -100,6 +123,8 @@ func NewInstanceFromProvisioningGroup(out *ecsclient.CreateAutoProvisioningGroup
 		CapacityType:     utils.GetCapacityTypes(*out.SpotStrategy),
 		SecurityGroupIDs: securityGroupIDs,
 		Tags:             tags,
+
+		CapacityReservationID: toLaunchCapacityReservationID(req.ResourcePoolOptions),
 	}
 }
 
@@ -131,6 +156,42 @@ func toTags(tags *ecsclient.DescribeInstancesResponseBodyInstancesInstanceTags)
 	})
 }
 
+func toLockReasons(locks *ecsclient.DescribeInstancesResponseBodyInstancesInstanceOperationLocks) []string {
+	if locks == nil {
+		return nil
+	}
+
+	return lo.FilterMap(locks.LockReason, func(lock *ecsclient.DescribeInstancesResponseBodyInstancesInstanceOperationLocksLockReason, _ int) (string, bool) {
+		if lock == nil || lock.LockReason == nil {
+			return "", false
+		}
+		return *lock.LockReason, true
+	})
+}
+
+func toCapacityReservationID(attr *ecsclient.DescribeInstancesResponseBodyInstancesInstanceEcsCapacityReservationAttr) string {
+	if attr == nil {
+		return ""
+	}
+	return tea.StringValue(attr.CapacityReservationId)
+}
+
+// toLaunchCapacityReservationID returns the capacity reservation the instance is launched into when the auto
+// provisioning group is only allowed a single one, the instance may be in any of several or in the public pool otherwise
+func toLaunchCapacityReservationID(options *ecsclient.CreateAutoProvisioningGroupRequestResourcePoolOptions) string {
+	if options == nil || tea.StringValue(options.Strategy) != ResourcePoolStrategyPrivatePoolOnly || len(options.PrivatePoolIds) != 1 {
+		return ""
+	}
+	return tea.StringValue(options.PrivatePoolIds[0])
+}
+
+// Interrupted returns whether the instance is a spot instance which is interrupted and is going to be released
+func (i *Instance) Interrupted() bool {
+	return i.CapacityType == karpv1.CapacityTypeSpot && lo.ContainsBy(i.LockReasons, func(reason string) bool {
+		return strings.EqualFold(reason, LockReasonRecycling)
+	})
+}
+
 type InstanceStateOperationNotSupportedError struct {
 	error
 }
@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/vswitch"
+)
+
+// zoneStats breaks the ties between the zones which are otherwise equal to launch an instance in, so the launches
+// spread across the zones instead of piling up in one of them.
+type zoneStats struct {
+	// launches is the number of instances recently launched in each zone
+	launches map[string]int
+	// soldOut is the number of offerings recently sold out in each zone
+	soldOut map[string]int
+}
+
+// zoneStats returns the current stats of the zones to launch an instance of the capacity type in
+func (p *DefaultProvider) zoneStats(instanceTypes []*cloudprovider.InstanceType, capacityType string) zoneStats {
+	soldOut := map[string]int{}
+	for _, instanceType := range instanceTypes {
+		for _, offering := range instanceType.Offerings {
+			if !offering.Available && offering.Requirements.Get(karpv1.CapacityTypeLabelKey).Has(capacityType) {
+				soldOut[offering.Requirements.Get(corev1.LabelTopologyZone).Any()]++
+			}
+		}
+	}
+	launches := lo.MapToSlice(p.zoneLaunches.Items(), func(_ string, item cache.Item) string { return item.Object.(string) })
+	return zoneStats{
+		launches: lo.CountValues(launches),
+		soldOut:  soldOut,
+	}
+}
+
+// pick returns the vSwitch in the zone with the fewest recent launches, then the fewest sold out offerings,
+// then the most available IP addresses. The zone ID makes the choice deterministic.
+func (z zoneStats) pick(vSwitches []*vswitch.VSwitch) *vswitch.VSwitch {
+	return slices.MinFunc(vSwitches, func(a, b *vswitch.VSwitch) int {
+		return cmp.Or(
+			cmp.Compare(z.launches[a.ZoneID], z.launches[b.ZoneID]),
+			cmp.Compare(z.soldOut[a.ZoneID], z.soldOut[b.ZoneID]),
+			cmp.Compare(b.AvailableIPAddressCount, a.AvailableIPAddressCount),
+			cmp.Compare(a.ZoneID, b.ZoneID),
+		)
+	})
+}
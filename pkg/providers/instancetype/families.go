@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
+)
+
+// filterInstanceFamilies drops the instance types whose family is not allowed by the allowed-instance-families and
+// blocked-instance-families options. A blocked family is never allowed, and no allowed families allow all of them.
+func filterInstanceFamilies(ctx context.Context, instanceTypes []*cloudprovider.InstanceType) []*cloudprovider.InstanceType {
+	o := options.FromContext(ctx)
+	if o == nil {
+		return instanceTypes
+	}
+	allowed, blocked := options.SplitList(o.AllowedInstanceFamilies), options.SplitList(o.BlockedInstanceFamilies)
+	if len(allowed) == 0 && len(blocked) == 0 {
+		return instanceTypes
+	}
+
+	filtered := make([]*cloudprovider.InstanceType, 0, len(instanceTypes))
+	for _, it := range instanceTypes {
+		family := utils.InstanceFamily(it.Name)
+		if matchesFamily(family, blocked) {
+			continue
+		}
+		if len(allowed) != 0 && !matchesFamily(family, allowed) {
+			continue
+		}
+		filtered = append(filtered, it)
+	}
+	return filtered
+}
+
+// matchesFamily reports whether the family matches any of the patterns. A pattern is a glob like gn* or a prefix of
+// the family like ecs.gn6, the ecs. prefix of the family is optional in the patterns.
+func matchesFamily(family string, patterns []string) bool {
+	for _, pattern := range patterns {
+		for _, f := range []string{family, strings.TrimPrefix(family, "ecs.")} {
+			if ok, _ := path.Match(pattern, f); ok || strings.HasPrefix(f, pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// weighInstanceFamilies multiplies the offering prices of the instance families in the instance-family-weights option
+// by their weights, so the scheduler ranks a preferred family above cheaper ones. The weights only change the ranking,
+// the offerings and their availability are kept, and the families without a weight keep their prices.
+func weighInstanceFamilies(ctx context.Context, instanceTypes []*cloudprovider.InstanceType) []*cloudprovider.InstanceType {
+	o := options.FromContext(ctx)
+	if o == nil {
+		return instanceTypes
+	}
+	// the weights are validated when the options are parsed
+	weights, _ := options.ParseInstanceFamilyWeights(o.InstanceFamilyWeights)
+	if len(weights) == 0 {
+		return instanceTypes
+	}
+
+	for _, it := range instanceTypes {
+		weight, ok := weights[utils.InstanceFamily(it.Name)]
+		if !ok {
+			continue
+		}
+		for i := range it.Offerings {
+			it.Offerings[i].Price *= weight
+		}
+	}
+	return instanceTypes
+}
@@ -19,8 +19,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
 	util "github.com/alibabacloud-go/tea-utils/v2/service"
@@ -28,9 +30,9 @@ import (
 	"github.com/mitchellh/hashstructure/v2"
 	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
+	"golang.org/x/sync/singleflight"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
-	"sigs.k8s.io/controller-runtime/pkg/log"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	"sigs.k8s.io/karpenter/pkg/cloudprovider"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
@@ -38,23 +40,38 @@ import (
 
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
 	kcache "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/cluster"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/pricing"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/zone"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/logging"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
 )
 
+// ReservedPriceDivisor divides the on-demand price of the offerings launched into a capacity reservation, so the
+// scheduler prefers the capacity reservations over the public pool
+const ReservedPriceDivisor = 10_000_000
+
 type Provider interface {
 	LivenessProbe(*http.Request) error
 	List(context.Context, *v1alpha1.KubeletConfiguration, *v1alpha1.ECSNodeClass) ([]*cloudprovider.InstanceType, error)
 	UpdateInstanceTypes(ctx context.Context) error
 	UpdateInstanceTypeOfferings(ctx context.Context) error
+	// UpdateOfferingPrices reprices the offerings of the cached instance types from the latest prices
+	UpdateOfferingPrices(ctx context.Context)
+	// SyncedAtLeastOnce returns whether both the instance types and their offerings have been refreshed from ECS
+	SyncedAtLeastOnce() bool
 }
 
 type DefaultProvider struct {
 	region          string
-	ecsClient       *ecsclient.Client
+	ecsClient       client.ECSClient
+	rateLimiter     *ratelimit.RateLimiter
 	pricingProvider pricing.Provider
 	clusterProvider cluster.Provider
+	zoneProvider    zone.Provider
 
 	// Values stored *before* considering insufficient capacity errors from the unavailableOfferings cache.
 	// Fully initialized Instance Types are also cached based on the set of all instance types, zones, unavailableOfferings cache,
@@ -69,6 +86,13 @@ type DefaultProvider struct {
 	spotInstanceTypesOfferings map[string]sets.Set[string]
 
 	instanceTypesCache *cache.Cache
+	// instanceTypesGroup deduplicates the concurrent computations of the instance types for the same cache key
+	instanceTypesGroup singleflight.Group
+	// updateGroup deduplicates the concurrent refreshes of the instance types and offerings from ECS
+	updateGroup singleflight.Group
+	// instanceTypesSynced and offeringsSynced are set by the first successful refresh of the instance types and offerings
+	instanceTypesSynced atomic.Bool
+	offeringsSynced     atomic.Bool
 
 	unavailableOfferings *kcache.UnavailableOfferings
 	cm                   *pretty.ChangeMonitor
@@ -76,16 +100,33 @@ type DefaultProvider struct {
 	instanceTypesSeqNum uint64
 	// instanceTypesOfferingsSeqNum is a monotonically increasing change counter used to avoid the expensive hashing operation on instance types
 	instanceTypesOfferingsSeqNum uint64
+
+	// preflightCache is the instance types ECS reported as available with the offering preflight, key: zone and
+	// capacity type, value: the instance types
+	preflightCache *cache.Cache
+	// preflightSeqNum is a monotonically increasing change counter of the preflight results
+	preflightSeqNum uint64
+}
+
+// cachedInstanceTypes are the instance types of a NodeClass cached with what repricing their offerings needs
+type cachedInstanceTypes struct {
+	instanceTypes []*cloudprovider.InstanceType
+	// spotPriceLimit is the spot price limit of the NodeClass, the spot offerings priced above it are unavailable
+	spotPriceLimit float64
+	// spotZones are the zones the spot offerings of every instance type are available in, regardless of their price
+	spotZones map[string]sets.Set[string]
 }
 
-func NewDefaultProvider(region string, ecsClient *ecsclient.Client,
+func NewDefaultProvider(region string, ecsClient client.ECSClient, rateLimiter *ratelimit.RateLimiter,
 	instanceTypesCache *cache.Cache, unavailableOfferingsCache *kcache.UnavailableOfferings,
-	pricingProvider pricing.Provider, clusterProvider cluster.Provider) *DefaultProvider {
+	pricingProvider pricing.Provider, clusterProvider cluster.Provider, zoneProvider zone.Provider) *DefaultProvider {
 	return &DefaultProvider{
 		ecsClient:                  ecsClient,
+		rateLimiter:                rateLimiter,
 		region:                     region,
 		pricingProvider:            pricingProvider,
 		clusterProvider:            clusterProvider,
+		zoneProvider:               zoneProvider,
 		instanceTypesInfo:          []*ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{},
 		instanceTypesOfferings:     map[string]sets.Set[string]{},
 		spotInstanceTypesOfferings: map[string]sets.Set[string]{},
@@ -93,6 +134,7 @@ func NewDefaultProvider(region string, ecsClient *ecsclient.Client,
 		unavailableOfferings:       unavailableOfferingsCache,
 		cm:                         pretty.NewChangeMonitor(),
 		instanceTypesSeqNum:        0,
+		preflightCache:             cache.New(kcache.OfferingPreflightTTL, kcache.DefaultCleanupInterval),
 	}
 }
 
@@ -110,7 +152,8 @@ func (p *DefaultProvider) validateState(nodeClass *v1alpha1.ECSNodeClass) error
 	if len(p.instanceTypesOfferings) == 0 {
 		return errors.New("no instance types offerings found")
 	}
-	if len(p.spotInstanceTypesOfferings) == 0 {
+	// some finance and government cloud regions don't offer spot instances at all
+	if len(p.spotInstanceTypesOfferings) == 0 && client.PartitionSupportsSpot(client.PartitionForRegion(p.region)) {
 		return errors.New("no spot instance types offerings found")
 	}
 	if len(nodeClass.Status.VSwitches) == 0 {
@@ -121,6 +164,21 @@ func (p *DefaultProvider) validateState(nodeClass *v1alpha1.ECSNodeClass) error
 }
 
 func (p *DefaultProvider) List(ctx context.Context, kc *v1alpha1.KubeletConfiguration, nodeClass *v1alpha1.ECSNodeClass) ([]*cloudprovider.InstanceType, error) {
+	zones, err := p.zoneProvider.Zones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting zones, %w", err)
+	}
+	// The zones closed for new instances or excluded by the NodeClass are left out even if the NodeClass still
+	// resolves vSwitches in them
+	vSwitchsZones := sets.New(lo.Map(nodeClass.Status.VSwitches, func(s v1alpha1.VSwitch, _ int) string {
+		return s.ZoneID
+	})...).Intersection(sets.New(zones...)).Delete(nodeClass.Spec.ZoneExclusions...)
+	// The zones are preflighted before taking the locks, so the API calls don't block the refresh of the offerings
+	var preflight map[string]sets.Set[string]
+	if options.FromContext(ctx).OfferingPreflight {
+		preflight = p.preflightOfferings(ctx, vSwitchsZones)
+	}
+
 	p.muInstanceTypeInfo.RLock()
 	p.muInstanceTypesOfferings.RLock()
 	defer p.muInstanceTypeInfo.RUnlock()
@@ -133,35 +191,55 @@ func (p *DefaultProvider) List(ctx context.Context, kc *v1alpha1.KubeletConfigur
 		return nil, err
 	}
 
-	vSwitchsZones := sets.New(lo.Map(nodeClass.Status.VSwitches, func(s v1alpha1.VSwitch, _ int) string {
-		return s.ZoneID
-	})...)
-
 	// Compute fully initialized instance types hash key
 	vSwitchZonesHash, _ := hashstructure.Hash(vSwitchsZones, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
 	kcHash, _ := hashstructure.Hash(kc, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
-	key := fmt.Sprintf("%d-%d-%d-%016x-%016x",
+	capacityReservationsHash, _ := hashstructure.Hash(nodeClass.Status.CapacityReservations, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
+	minResourcesHash, _ := hashstructure.Hash(minResourcesKey(nodeClass.Spec.MinResources), hashstructure.FormatV2, nil)
+	terwayHash, err := hashstructure.Hash(nodeClass.Spec.Terway, hashstructure.FormatV2, nil)
+	if err != nil {
+		return nil, fmt.Errorf("hashing terway configuration, %w", err)
+	}
+	// The preflight results are tracked by their sequence number, only the preflighted zones are hashed
+	preflightHash, _ := hashstructure.Hash(lo.Keys(preflight), hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
+	key := fmt.Sprintf("%d-%d-%d-%d-%016x-%016x-%016x-%016x-%016x-%016x-%g",
 		p.instanceTypesSeqNum,
 		p.instanceTypesOfferingsSeqNum,
 		p.unavailableOfferings.SeqNum,
+		atomic.LoadUint64(&p.preflightSeqNum),
+		preflightHash,
 		vSwitchZonesHash,
 		kcHash,
+		capacityReservationsHash,
+		minResourcesHash,
+		terwayHash,
+		spotPriceLimit(nodeClass),
 	)
 
 	if item, ok := p.instanceTypesCache.Get(key); ok {
-		// TODO: some place changes the Capacity filed, we should find it out and fix it, same with aws provider
-		return lo.Map(item.([]*cloudprovider.InstanceType),
-			func(item *cloudprovider.InstanceType, _ int) *cloudprovider.InstanceType {
-				return &cloudprovider.InstanceType{
-					Name:         item.Name,
-					Requirements: item.Requirements,
-					Offerings:    item.Offerings,
-					Capacity:     item.Capacity.DeepCopy(),
-					Overhead:     item.Overhead,
-				}
-			}), nil
+		return copyInstanceTypes(item.(*cachedInstanceTypes).instanceTypes), nil
+	}
+
+	// Concurrent callers with the same key share one computation of the instance types
+	item, err, _ := p.instanceTypesGroup.Do(key, func() (any, error) {
+		if item, ok := p.instanceTypesCache.Get(key); ok {
+			return item, nil
+		}
+		result, err := p.newInstanceTypes(ctx, kc, nodeClass, vSwitchsZones, preflight)
+		if err != nil {
+			return nil, err
+		}
+		p.instanceTypesCache.SetDefault(key, result)
+		return result, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return copyInstanceTypes(item.(*cachedInstanceTypes).instanceTypes), nil
+}
 
+func (p *DefaultProvider) newInstanceTypes(ctx context.Context, kc *v1alpha1.KubeletConfiguration, nodeClass *v1alpha1.ECSNodeClass,
+	vSwitchsZones sets.Set[string], preflight map[string]sets.Set[string]) (*cachedInstanceTypes, error) {
 	// Get all zones across all offerings
 	// We don't use this in the cache key since this is produced from our instanceTypesOfferings which we do cache
 	allZones := sets.New[string]()
@@ -170,42 +248,138 @@ func (p *DefaultProvider) List(ctx context.Context, kc *v1alpha1.KubeletConfigur
 	}
 
 	if p.cm.HasChanged("zones", allZones) {
-		log.FromContext(ctx).WithValues("zones", allZones.UnsortedList()).V(1).Info("discovered zones")
+		logging.FromContext(ctx).WithValues("zones", allZones.UnsortedList()).V(1).Info("discovered zones")
 	}
 
-	clusterCNI, err := p.clusterProvider.GetClusterCNI(ctx)
+	clusterCNI, err := p.clusterCNI(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cluster CNI: %w", err)
 	}
 
+	spotZones := map[string]sets.Set[string]{}
 	result := lo.Map(p.instanceTypesInfo, func(i *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType, _ int) *cloudprovider.InstanceType {
-		zoneData := lo.Map(allZones.UnsortedList(), func(zoneID string, _ int) ZoneData {
-			ret := ZoneData{ID: zoneID, Available: true, SpotAvailable: true}
-			if !p.instanceTypesOfferings[lo.FromPtr(i.InstanceTypeId)].Has(zoneID) || !vSwitchsZones.Has(zoneID) {
-				ret.Available = false
+		// The instance types below the floor of the NodeClass are dropped before their offerings are built
+		if !meetsMinResources(i, nodeClass.Spec.MinResources) {
+			return nil
+		}
+		// The instance types which can't run the Terway configuration of the NodeClass aren't offered
+		if clusterCNI == cluster.ClusterCNITypeTerway {
+			if err := validateTerway(i, nodeClass.Spec.Terway); err != nil {
+				logging.FromContext(ctx).WithValues("instance-type", lo.FromPtr(i.InstanceTypeId), "reason", err.Error()).V(1).Info("skipping instance type, it can't run the terway configuration")
+				return nil
 			}
-			if !p.spotInstanceTypesOfferings[lo.FromPtr(i.InstanceTypeId)].Has(zoneID) || !vSwitchsZones.Has(zoneID) {
-				ret.SpotAvailable = false
+		}
+		// Only the zones of the NodeClass vSwitches can be launched into, so the offerings
+		// of the other zones in the region are left out
+		zoneData := lo.Map(sets.List(allZones.Intersection(vSwitchsZones)), func(zoneID string, _ int) ZoneData {
+			instanceType := lo.FromPtr(i.InstanceTypeId)
+			return ZoneData{
+				ID: zoneID,
+				Available: p.instanceTypesOfferings[instanceType].Has(zoneID) &&
+					preflighted(preflight, zoneID, karpv1.CapacityTypeOnDemand, instanceType),
+				SpotAvailable: p.spotInstanceTypesOfferings[instanceType].Has(zoneID) &&
+					preflighted(preflight, zoneID, karpv1.CapacityTypeSpot, instanceType),
 			}
-			return ret
 		})
+		// The instance type isn't sold in any of the zones
+		if !lo.ContainsBy(zoneData, func(z ZoneData) bool { return z.Available || z.SpotAvailable }) {
+			return nil
+		}
 
 		// !!! Important !!!
 		// Any changes to the values passed into the NewInstanceType method will require making updates to the cache key
 		// so that Karpenter is able to cache the set of InstanceTypes based on values that alter the set of instance types
 		// !!! Important !!!
-		offers := p.createOfferings(ctx, *i.InstanceTypeId, zoneData)
-		return NewInstanceType(ctx, i, kc, p.region, nodeClass.Spec.SystemDisk, offers, clusterCNI)
+		spotZones[*i.InstanceTypeId] = sets.New(lo.FilterMap(zoneData, func(z ZoneData, _ int) (string, bool) {
+			return z.ID, z.SpotAvailable && !p.unavailableOfferings.IsUnavailable(*i.InstanceTypeId, z.ID, karpv1.CapacityTypeSpot)
+		})...)
+		offers := p.createOfferings(ctx, *i.InstanceTypeId, zoneData, nodeClass.Status.CapacityReservations, spotPriceLimit(nodeClass))
+		return NewInstanceType(ctx, i, kc, p.region, nodeClass.Spec.SystemDisk, nodeClass.Spec.Terway, offers, clusterCNI)
 	})
 
 	// Filter out nil values
 	result = lo.Compact(result)
+	result = filterInstanceFamilies(ctx, result)
+	result = weighInstanceFamilies(ctx, result)
+
+	return &cachedInstanceTypes{instanceTypes: result, spotPriceLimit: spotPriceLimit(nodeClass), spotZones: spotZones}, nil
+}
+
+// meetsMinResources reports whether the instance type has at least the vCPUs and the memory of the floor. The floor
+// only ever narrows the instance types, the requirements of the NodePools are still applied to the remaining ones.
+func meetsMinResources(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType, minResources *v1alpha1.MinResources) bool {
+	if minResources == nil {
+		return true
+	}
+	if minResources.CPU != nil && tea.Int32Value(info.CpuCoreCount) < *minResources.CPU {
+		return false
+	}
+	if minResources.Memory != nil && extractMemory(info).Cmp(*minResources.Memory) < 0 {
+		return false
+	}
+	return true
+}
 
-	p.instanceTypesCache.SetDefault(key, result)
-	return result, nil
+// minResourcesKey is the floor of the NodeClass in the cache key, the memory is hashed by its value since the
+// same quantity can be written in different units
+func minResourcesKey(minResources *v1alpha1.MinResources) [2]int64 {
+	if minResources == nil {
+		return [2]int64{}
+	}
+	var memory int64
+	if minResources.Memory != nil {
+		memory = minResources.Memory.Value()
+	}
+	return [2]int64{int64(lo.FromPtr(minResources.CPU)), memory}
+}
+
+// spotPriceLimit is the max price of the spot instances of the NodeClass, zero when the spot instances bid the market
+// price. An invalid price limit fails the launch instead, so it isn't a limit of the offerings.
+func spotPriceLimit(nodeClass *v1alpha1.ECSNodeClass) float64 {
+	if nodeClass.Spec.SpotStrategy != v1alpha1.SpotStrategySpotWithPriceLimit {
+		return 0
+	}
+	limit, err := strconv.ParseFloat(lo.FromPtr(nodeClass.Spec.SpotPriceLimit), 64)
+	if err != nil || limit <= 0 {
+		return 0
+	}
+	return limit
 }
 
+// copyInstanceTypes copies the cached instance types, so the callers don't change the Capacity of the cached ones
+func copyInstanceTypes(instanceTypes []*cloudprovider.InstanceType) []*cloudprovider.InstanceType {
+	// TODO: some place changes the Capacity filed, we should find it out and fix it, same with aws provider
+	return lo.Map(instanceTypes, func(item *cloudprovider.InstanceType, _ int) *cloudprovider.InstanceType {
+		return &cloudprovider.InstanceType{
+			Name:         item.Name,
+			Requirements: item.Requirements,
+			Offerings:    item.Offerings,
+			Capacity:     item.Capacity.DeepCopy(),
+			Overhead:     item.Overhead,
+		}
+	})
+}
+
+// clusterCNI returns the CNI of the cluster, the cluster-cni option takes precedence over the one detected from the cluster
+func (p *DefaultProvider) clusterCNI(ctx context.Context) (string, error) {
+	if o := options.FromContext(ctx); o != nil && o.ClusterCNI != "" {
+		return o.ClusterCNI, nil
+	}
+	return p.clusterProvider.GetClusterCNI(ctx)
+}
+
+// UpdateInstanceTypes refreshes the instance types from ECS, concurrent callers share one sweep of DescribeInstanceTypes
 func (p *DefaultProvider) UpdateInstanceTypes(ctx context.Context) error {
+	_, err, _ := p.updateGroup.Do("instance-types", func() (any, error) {
+		return nil, p.updateInstanceTypes(ctx)
+	})
+	if err == nil {
+		p.instanceTypesSynced.Store(true)
+	}
+	return err
+}
+
+func (p *DefaultProvider) updateInstanceTypes(ctx context.Context) error {
 	// DO NOT REMOVE THIS LOCK ----------------------------------------------------------------------------
 	// We lock here so that multiple callers to getInstanceTypesOfferings do not result in cache misses and multiple
 	// calls to ECS when we could have just made one call.
@@ -213,13 +387,13 @@ func (p *DefaultProvider) UpdateInstanceTypes(ctx context.Context) error {
 	p.muInstanceTypeInfo.Lock()
 	defer p.muInstanceTypeInfo.Unlock()
 
-	instanceTypes, err := getAllInstanceTypes(p.ecsClient)
+	instanceTypes, err := p.getAllInstanceTypes(ctx)
 	if err != nil {
-		log.FromContext(ctx).Error(err, "failed to get instance types")
+		logging.FromContext(ctx).Error(err, "failed to get instance types")
 		return err
 	}
 
-	clusterCNI, err := p.clusterProvider.GetClusterCNI(ctx)
+	clusterCNI, err := p.clusterCNI(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get cluster CNI: %w", err)
 	}
@@ -240,14 +414,29 @@ func (p *DefaultProvider) UpdateInstanceTypes(ctx context.Context) error {
 		// Only update instanceTypesSeqNun with the instance types have been changed
 		// This is to not create new keys with duplicate instance types option
 		atomic.AddUint64(&p.instanceTypesSeqNum, 1)
-		log.FromContext(ctx).WithValues(
+		logging.FromContext(ctx).WithValues(
 			"count", len(instanceTypes)).V(1).Info("discovered instance types")
 	}
 	p.instanceTypesInfo = instanceTypes
 	return nil
 }
 
+// UpdateInstanceTypeOfferings refreshes the offerings from ECS, concurrent callers share one sweep of DescribeAvailableResource
 func (p *DefaultProvider) UpdateInstanceTypeOfferings(ctx context.Context) error {
+	_, err, _ := p.updateGroup.Do("instance-type-offerings", func() (any, error) {
+		return nil, p.updateInstanceTypeOfferings(ctx)
+	})
+	if err == nil {
+		p.offeringsSynced.Store(true)
+	}
+	return err
+}
+
+func (p *DefaultProvider) SyncedAtLeastOnce() bool {
+	return p.instanceTypesSynced.Load() && p.offeringsSynced.Load()
+}
+
+func (p *DefaultProvider) updateInstanceTypeOfferings(ctx context.Context) error {
 	// DO NOT REMOVE THIS LOCK ----------------------------------------------------------------------------
 	// We lock here so that multiple callers to getInstanceTypesOfferings do not result in cache misses and multiple
 	// calls to ECS when we could have just made one call.
@@ -263,22 +452,25 @@ func (p *DefaultProvider) UpdateInstanceTypeOfferings(ctx context.Context) error
 	}
 
 	// TODO: we may use other better API in the future.
-	resp, err := p.ecsClient.DescribeAvailableResourceWithOptions(
-		describeAvailableResourceRequest, &util.RuntimeOptions{})
+	resp, err := ratelimit.Call(ctx, p.rateLimiter, "DescribeAvailableResource", func() (*ecsclient.DescribeAvailableResourceResponse, error) {
+		return p.ecsClient.DescribeAvailableResourceWithOptions(describeAvailableResourceRequest, &util.RuntimeOptions{})
+	})
 	if err != nil {
-		log.FromContext(ctx).Error(err, "failed to get instance type offerings")
+		logging.FromContext(ctx).Error(err, "failed to get instance type offerings")
 		return err
 	}
-	if err := processAvailableResourcesResponse(resp, instanceTypesOfferings); err != nil {
-		log.FromContext(ctx).Error(err, "failed to process available resource response")
+	soldOutOfferings := map[string]sets.Set[string]{}
+	if err := processAvailableResourcesResponse(resp, instanceTypesOfferings, soldOutOfferings); err != nil {
+		logging.FromContext(ctx).Error(err, "failed to process available resource response")
 		return err
 	}
+	p.markSoldOutOfferings(ctx, soldOutOfferings, karpv1.CapacityTypeOnDemand)
 
 	if p.cm.HasChanged("instance-type-offering", instanceTypesOfferings) {
 		// Only update instanceTypesSeqNun with the instance type offerings  have been changed
 		// This is to not create new keys with duplicate instance type offerings option
 		atomic.AddUint64(&p.instanceTypesOfferingsSeqNum, 1)
-		log.FromContext(ctx).WithValues("instance-type-count", len(instanceTypesOfferings)).V(1).Info("discovered offerings for instance types")
+		logging.FromContext(ctx).WithValues("instance-type-count", len(instanceTypesOfferings)).V(1).Info("discovered offerings for instance types")
 	}
 	p.instanceTypesOfferings = instanceTypesOfferings
 
@@ -288,21 +480,94 @@ func (p *DefaultProvider) UpdateInstanceTypeOfferings(ctx context.Context) error
 		DestinationResource: tea.String("InstanceType"),
 		SpotStrategy:        tea.String("SpotAsPriceGo"),
 	}
-	resp, err = p.ecsClient.DescribeAvailableResourceWithOptions(
-		describeAvailableResourceRequest, &util.RuntimeOptions{})
+	resp, err = ratelimit.Call(ctx, p.rateLimiter, "DescribeAvailableResource", func() (*ecsclient.DescribeAvailableResourceResponse, error) {
+		return p.ecsClient.DescribeAvailableResourceWithOptions(describeAvailableResourceRequest, &util.RuntimeOptions{})
+	})
 	if err != nil {
-		log.FromContext(ctx).Error(err, "failed to get spot instance type offerings")
+		logging.FromContext(ctx).Error(err, "failed to get spot instance type offerings")
 		return err
 	}
-	if err := processAvailableResourcesResponse(resp, spotInstanceTypesOfferings); err != nil {
-		log.FromContext(ctx).Error(err, "failed to process spot instance type offerings")
+	spotSoldOutOfferings := map[string]sets.Set[string]{}
+	if err := processAvailableResourcesResponse(resp, spotInstanceTypesOfferings, spotSoldOutOfferings); err != nil {
+		logging.FromContext(ctx).Error(err, "failed to process spot instance type offerings")
 		return err
 	}
+	p.markSoldOutOfferings(ctx, spotSoldOutOfferings, karpv1.CapacityTypeSpot)
 	p.spotInstanceTypesOfferings = spotInstanceTypesOfferings
 	return nil
 }
 
-func processAvailableResourcesResponse(resp *ecsclient.DescribeAvailableResourceResponse, offerings map[string]sets.Set[string]) error {
+// UpdateOfferingPrices reprices the offerings of the cached instance types from the latest prices of the pricing
+// provider. The capacity and requirements of the instance types don't depend on the prices, so only the offerings are
+// copied with the new prices, and the copies replace the cached instance types the callers may still be reading.
+// The spot offerings are priced against the spot price limit of the NodeClass again.
+func (p *DefaultProvider) UpdateOfferingPrices(ctx context.Context) {
+	// The write lock waits for the instance types being computed with the previous prices to be cached first
+	p.muInstanceTypesOfferings.Lock()
+	defer p.muInstanceTypesOfferings.Unlock()
+
+	for key, item := range p.instanceTypesCache.Items() {
+		ttl := cache.NoExpiration
+		if item.Expiration > 0 {
+			if ttl = time.Until(time.Unix(0, item.Expiration)); ttl <= 0 {
+				continue
+			}
+		}
+		cached := item.Object.(*cachedInstanceTypes)
+		instanceTypes := lo.Map(cached.instanceTypes, func(it *cloudprovider.InstanceType, _ int) *cloudprovider.InstanceType {
+			return &cloudprovider.InstanceType{
+				Name:         it.Name,
+				Requirements: it.Requirements,
+				Offerings: lo.Map(it.Offerings, func(offering cloudprovider.Offering, _ int) cloudprovider.Offering {
+					price, ok := p.offeringPrice(it.Name, offering)
+					if !ok {
+						return offering
+					}
+					offering.Price = price
+					if cached.spotPriceLimit != 0 && offering.Requirements.Get(karpv1.CapacityTypeLabelKey).Has(karpv1.CapacityTypeSpot) {
+						offering.Available = cached.spotZones[it.Name].Has(offering.Requirements.Get(corev1.LabelTopologyZone).Any()) &&
+							price <= cached.spotPriceLimit
+					}
+					return offering
+				}),
+				Capacity: it.Capacity,
+				Overhead: it.Overhead,
+			}
+		})
+		p.instanceTypesCache.Set(key, &cachedInstanceTypes{
+			instanceTypes:  weighInstanceFamilies(ctx, instanceTypes),
+			spotPriceLimit: cached.spotPriceLimit,
+			spotZones:      cached.spotZones,
+		}, ttl)
+	}
+}
+
+// offeringPrice returns the latest price of the offering, priced the same way as createOfferings does
+func (p *DefaultProvider) offeringPrice(instanceType string, offering cloudprovider.Offering) (float64, bool) {
+	zone := offering.Requirements.Get(corev1.LabelTopologyZone).Any()
+	if offering.Requirements.Get(karpv1.CapacityTypeLabelKey).Has(karpv1.CapacityTypeSpot) {
+		return p.pricingProvider.SpotPrice(instanceType, zone)
+	}
+	price, ok := p.pricingProvider.OnDemandPrice(instanceType)
+	if ok && offering.Requirements.Get(v1alpha1.LabelCapacityReservationID).Operator() == corev1.NodeSelectorOpIn {
+		price /= ReservedPriceDivisor
+	}
+	return price, ok
+}
+
+// markSoldOutOfferings marks the instance types which ECS reports as sold out in a zone as unavailable for a cooldown period,
+// so that a zone that temporarily stops offering an instance type is not launched into until the stock recovers
+func (p *DefaultProvider) markSoldOutOfferings(ctx context.Context, soldOutOfferings map[string]sets.Set[string], capacityType string) {
+	for instanceType, zones := range soldOutOfferings {
+		for zone := range zones {
+			p.unavailableOfferings.MarkUnavailableWithTTL(ctx, "SoldOut", instanceType, zone, capacityType, options.FromContext(ctx).SoldOutOfferingsCooldown)
+		}
+	}
+}
+
+// processAvailableResourcesResponse collects the zones with stock of every instance type into offerings,
+// and the zones where the instance type is sold out into soldOutOfferings
+func processAvailableResourcesResponse(resp *ecsclient.DescribeAvailableResourceResponse, offerings, soldOutOfferings map[string]sets.Set[string]) error {
 	if resp == nil || resp.Body == nil {
 		return errors.New("DescribeAvailableResourceWithOptions failed to return any instance types")
 	} else if resp.Body.AvailableZones == nil || len(resp.Body.AvailableZones.AvailableZone) == 0 {
@@ -317,12 +582,12 @@ func processAvailableResourcesResponse(resp *ecsclient.DescribeAvailableResource
 			tea.StringValue(az.StatusCategory) != "ClosedWithStock" {
 			continue
 		}
-		processAvailableResources(az, offerings)
+		processAvailableResources(az, offerings, soldOutOfferings)
 	}
 	return nil
 }
 
-func processAvailableResources(az *ecsclient.DescribeAvailableResourceResponseBodyAvailableZonesAvailableZone, instanceTypesOfferings map[string]sets.Set[string]) {
+func processAvailableResources(az *ecsclient.DescribeAvailableResourceResponseBodyAvailableZonesAvailableZone, instanceTypesOfferings, soldOutOfferings map[string]sets.Set[string]) {
 	if az.AvailableResources == nil || az.AvailableResources.AvailableResource == nil {
 		return
 	}
@@ -338,6 +603,12 @@ func processAvailableResources(az *ecsclient.DescribeAvailableResourceResponseBo
 			// ClosedWithStock means there is available capacity, just the provider will not add more capacity.
 			if tea.StringValue(sr.StatusCategory) != "WithStock" &&
 				tea.StringValue(sr.StatusCategory) != "ClosedWithStock" {
+				if tea.StringValue(sr.StatusCategory) == "WithoutStock" {
+					if _, ok := soldOutOfferings[*sr.Value]; !ok {
+						soldOutOfferings[*sr.Value] = sets.New[string]()
+					}
+					soldOutOfferings[*sr.Value].Insert(*az.ZoneId)
+				}
 				continue
 			}
 			if _, ok := instanceTypesOfferings[*sr.Value]; !ok {
@@ -348,7 +619,7 @@ func processAvailableResources(az *ecsclient.DescribeAvailableResourceResponseBo
 	}
 }
 
-func getAllInstanceTypes(client *ecsclient.Client) ([]*ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType, error) {
+func (p *DefaultProvider) getAllInstanceTypes(ctx context.Context) ([]*ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType, error) {
 	var InstanceTypes []*ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType
 
 	describeInstanceTypesRequest := &ecsclient.DescribeInstanceTypesRequest{
@@ -364,7 +635,9 @@ func getAllInstanceTypes(client *ecsclient.Client) ([]*ecsclient.DescribeInstanc
 	}
 
 	for {
-		resp, err := client.DescribeInstanceTypesWithOptions(describeInstanceTypesRequest, &util.RuntimeOptions{})
+		resp, err := ratelimit.Call(ctx, p.rateLimiter, "DescribeInstanceTypes", func() (*ecsclient.DescribeInstanceTypesResponse, error) {
+			return p.ecsClient.DescribeInstanceTypesWithOptions(describeInstanceTypesRequest, &util.RuntimeOptions{})
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -388,12 +661,18 @@ func getAllInstanceTypes(client *ecsclient.Client) ([]*ecsclient.DescribeInstanc
 // invariant that each offering is mutually exclusive. Specifically, there is an offering for each permutation of zone
 // and capacity type. ZoneID is also injected into the offering requirements, when available, but there is a 1-1
 // mapping between zone and zoneID so this does not change the number of offerings.
+// A spot offering is created when the spot price of the zone is known, it is unavailable in the zones where
+// the instance type is not offered as spot, or where the spot price is above the price limit of the NodeClass since
+// ECS rejects the launch with a price limit lower than the spot price.
+// An on-demand offering is created for each capacity reservation of the instance type as well, the capacity
+// reservation id requirement keeps them mutually exclusive with the public pool offerings.
 //
 // Each requirement on the offering is guaranteed to have a single value. To get the value for a requirement on an
 // offering, you can do the following thanks to this invariant:
 //
 //	offering.Requirements.Get(v1.TopologyLabelZone).Any()
-func (p *DefaultProvider) createOfferings(_ context.Context, instanceType string, zones []ZoneData) []cloudprovider.Offering {
+func (p *DefaultProvider) createOfferings(_ context.Context, instanceType string, zones []ZoneData,
+	capacityReservations []v1alpha1.CapacityReservation, spotPriceLimit float64) []cloudprovider.Offering {
 	var offerings []cloudprovider.Offering
 	for _, zone := range zones {
 		odPrice, odOK := p.pricingProvider.OnDemandPrice(instanceType)
@@ -404,11 +683,19 @@ func (p *DefaultProvider) createOfferings(_ context.Context, instanceType string
 			offeringAvailable := !isUnavailable && zone.Available
 
 			offerings = append(offerings, p.createOffering(zone.ID, karpv1.CapacityTypeOnDemand, odPrice, offeringAvailable))
+
+			for _, cr := range capacityReservations {
+				if cr.InstanceType != instanceType || cr.ZoneID != zone.ID {
+					continue
+				}
+				offerings = append(offerings, p.createReservedOffering(zone.ID, cr.ID, odPrice/ReservedPriceDivisor,
+					!isUnavailable && zone.Available && cr.AvailableInstanceCount > 0))
+			}
 		}
 
 		if spotOK {
 			isUnavailable := p.unavailableOfferings.IsUnavailable(instanceType, zone.ID, karpv1.CapacityTypeSpot)
-			offeringAvailable := !isUnavailable && zone.SpotAvailable
+			offeringAvailable := !isUnavailable && zone.SpotAvailable && (spotPriceLimit == 0 || spotPrice <= spotPriceLimit)
 
 			offerings = append(offerings, p.createOffering(zone.ID, karpv1.CapacityTypeSpot, spotPrice, offeringAvailable))
 		}
@@ -423,6 +710,22 @@ func (p *DefaultProvider) createOffering(zone, capacityType string, price float6
 			scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, capacityType),
 			scheduling.NewRequirement(corev1.LabelTopologyZone, corev1.NodeSelectorOpIn, zone),
 			scheduling.NewRequirement(v1alpha1.LabelTopologyZoneID, corev1.NodeSelectorOpIn, zone),
+			scheduling.NewRequirement(v1alpha1.LabelCapacityReservationID, corev1.NodeSelectorOpDoesNotExist),
+		),
+		Price:     price,
+		Available: available,
+	}
+}
+
+// createReservedOffering creates an on-demand offering launched into the capacity reservation, the instances in
+// a capacity reservation are already paid for, so it's priced below every public pool offering
+func (p *DefaultProvider) createReservedOffering(zone, capacityReservationID string, price float64, available bool) cloudprovider.Offering {
+	return cloudprovider.Offering{
+		Requirements: scheduling.NewRequirements(
+			scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeOnDemand),
+			scheduling.NewRequirement(corev1.LabelTopologyZone, corev1.NodeSelectorOpIn, zone),
+			scheduling.NewRequirement(v1alpha1.LabelTopologyZoneID, corev1.NodeSelectorOpIn, zone),
+			scheduling.NewRequirement(v1alpha1.LabelCapacityReservationID, corev1.NodeSelectorOpIn, capacityReservationID),
 		),
 		Price:     price,
 		Available: available,
@@ -433,4 +736,7 @@ func (p *DefaultProvider) Reset() {
 	p.instanceTypesInfo = []*ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{}
 	p.instanceTypesOfferings = map[string]sets.Set[string]{}
 	p.instanceTypesCache.Flush()
+	p.preflightCache.Flush()
+	p.instanceTypesSynced.Store(false)
+	p.offeringsSynced.Store(false)
 }
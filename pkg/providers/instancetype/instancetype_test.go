@@ -0,0 +1,615 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/sets"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	kcache "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/fake"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/zone"
+)
+
+type fakePricingProvider struct {
+	onDemandPrices map[string]float64
+	// spotPrices is keyed by instance type and zone
+	spotPrices map[[2]string]float64
+}
+
+func (f *fakePricingProvider) LivenessProbe(*http.Request) error { return nil }
+func (f *fakePricingProvider) InstanceTypes() []string           { return lo.Keys(f.onDemandPrices) }
+func (f *fakePricingProvider) OnDemandPrice(instanceType string) (float64, bool) {
+	price, ok := f.onDemandPrices[instanceType]
+	return price, ok
+}
+func (f *fakePricingProvider) SpotPrice(instanceType, zone string) (float64, bool) {
+	price, ok := f.spotPrices[[2]string{instanceType, zone}]
+	return price, ok
+}
+func (f *fakePricingProvider) UpdateOnDemandPricing(context.Context) error { return nil }
+func (f *fakePricingProvider) UpdateSpotPricing(context.Context) error     { return nil }
+func (f *fakePricingProvider) LastUpdated() time.Time                      { return time.Time{} }
+func (f *fakePricingProvider) SetCommittedUseUsage(map[string]int)         {}
+func (f *fakePricingProvider) SyncedAtLeastOnce() bool                     { return true }
+
+func TestCreateOfferingsCapacityTypes(t *testing.T) {
+	pricingProvider := &fakePricingProvider{
+		onDemandPrices: map[string]float64{"ecs.g7.large": 0.5},
+		spotPrices: map[[2]string]float64{
+			{"ecs.g7.large", "cn-hangzhou-i"}: 0.1,
+			{"ecs.g7.large", "cn-hangzhou-j"}: 0.1,
+		},
+	}
+	p := NewDefaultProvider("cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), pricingProvider, nil, nil)
+
+	// cn-hangzhou-i offers the instance type on-demand only, cn-hangzhou-j offers both capacity types
+	offerings := cloudprovider.Offerings(p.createOfferings(context.Background(), "ecs.g7.large", []ZoneData{
+		{ID: "cn-hangzhou-i", Available: true, SpotAvailable: false},
+		{ID: "cn-hangzhou-j", Available: true, SpotAvailable: true},
+	}, nil, 0))
+
+	available := lo.Map(offerings.Available(), func(o cloudprovider.Offering, _ int) [2]string {
+		return [2]string{o.Requirements.Get(corev1.LabelTopologyZone).Any(), o.Requirements.Get(karpv1.CapacityTypeLabelKey).Any()}
+	})
+	assert.ElementsMatch(t, [][2]string{
+		{"cn-hangzhou-i", karpv1.CapacityTypeOnDemand},
+		{"cn-hangzhou-j", karpv1.CapacityTypeOnDemand},
+		{"cn-hangzhou-j", karpv1.CapacityTypeSpot},
+	}, available)
+
+	spot, ok := lo.Find(offerings, func(o cloudprovider.Offering) bool {
+		return o.Requirements.Get(corev1.LabelTopologyZone).Any() == "cn-hangzhou-i" &&
+			o.Requirements.Get(karpv1.CapacityTypeLabelKey).Any() == karpv1.CapacityTypeSpot
+	})
+	assert.True(t, ok)
+	assert.False(t, spot.Available)
+	assert.Equal(t, 0.1, spot.Price)
+
+	// The scheduler filters the offerings by the capacity type requirement
+	spotOfferings := offerings.Available().Compatible(scheduling.NewRequirements(
+		scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeSpot),
+	))
+	assert.Len(t, spotOfferings, 1)
+	assert.Equal(t, "cn-hangzhou-j", spotOfferings[0].Requirements.Get(corev1.LabelTopologyZone).Any())
+}
+
+func TestCreateOfferingsSpotPriceLimit(t *testing.T) {
+	pricingProvider := &fakePricingProvider{
+		onDemandPrices: map[string]float64{"ecs.g7.large": 0.5},
+		spotPrices: map[[2]string]float64{
+			{"ecs.g7.large", "cn-hangzhou-i"}: 0.1,
+			{"ecs.g7.large", "cn-hangzhou-j"}: 0.3,
+		},
+	}
+	p := NewDefaultProvider("cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), pricingProvider, nil, nil)
+	zones := []ZoneData{
+		{ID: "cn-hangzhou-i", Available: true, SpotAvailable: true},
+		{ID: "cn-hangzhou-j", Available: true, SpotAvailable: true},
+	}
+	spotZones := func(nodeClass *v1alpha1.ECSNodeClass) []string {
+		offerings := cloudprovider.Offerings(p.createOfferings(context.Background(), "ecs.g7.large", zones, nil, spotPriceLimit(nodeClass)))
+		return lo.Map(offerings.Available().Compatible(scheduling.NewRequirements(
+			scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeSpot),
+		)), func(o cloudprovider.Offering, _ int) string {
+			return o.Requirements.Get(corev1.LabelTopologyZone).Any()
+		})
+	}
+
+	// the spot offering above the price limit isn't offered, ECS rejects its launch
+	nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{
+		SpotStrategy:   v1alpha1.SpotStrategySpotWithPriceLimit,
+		SpotPriceLimit: lo.ToPtr("0.2"),
+	}}
+	assert.Equal(t, []string{"cn-hangzhou-i"}, spotZones(nodeClass))
+	// the spot offering at the price limit is offered
+	nodeClass.Spec.SpotPriceLimit = lo.ToPtr("0.3")
+	assert.Equal(t, []string{"cn-hangzhou-i", "cn-hangzhou-j"}, spotZones(nodeClass))
+	// the spot offerings bidding the market price aren't limited
+	nodeClass.Spec.SpotStrategy = v1alpha1.SpotStrategySpotAsPriceGo
+	nodeClass.Spec.SpotPriceLimit = nil
+	assert.Equal(t, []string{"cn-hangzhou-i", "cn-hangzhou-j"}, spotZones(nodeClass))
+}
+
+func TestCreateOfferingsUnavailable(t *testing.T) {
+	pricingProvider := &fakePricingProvider{onDemandPrices: map[string]float64{"ecs.g7.large": 0.5}}
+	unavailableOfferings := kcache.NewUnavailableOfferings()
+	p := NewDefaultProvider("cn-hangzhou", nil, nil, nil, unavailableOfferings, pricingProvider, nil, nil)
+	zones := []ZoneData{{ID: "cn-hangzhou-i", Available: true}, {ID: "cn-hangzhou-j", Available: true}}
+	availableZones := func() []string {
+		return lo.Map(cloudprovider.Offerings(p.createOfferings(context.Background(), "ecs.g7.large", zones, nil, 0)).Available(), func(o cloudprovider.Offering, _ int) string {
+			return o.Requirements.Get(corev1.LabelTopologyZone).Any()
+		})
+	}
+
+	// the sold out offering isn't offered during the cooldown
+	unavailableOfferings.MarkUnavailableWithTTL(context.Background(), "NoInstanceStock", "ecs.g7.large", "cn-hangzhou-i", karpv1.CapacityTypeOnDemand, 100*time.Millisecond)
+	assert.Equal(t, []string{"cn-hangzhou-j"}, availableZones())
+	assert.Eventually(t, func() bool { return len(availableZones()) == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestValidateStateSpotOfferings(t *testing.T) {
+	nodeClass := &v1alpha1.ECSNodeClass{Status: v1alpha1.ECSNodeClassStatus{VSwitches: []v1alpha1.VSwitch{{ID: "vsw-1", ZoneID: "cn-hangzhou-i"}}}}
+	for region, wantErr := range map[string]bool{"cn-hangzhou": true, "cn-hangzhou-finance": false} {
+		p := NewDefaultProvider(region, nil, nil, nil, nil, nil, nil, nil)
+		p.instanceTypesInfo = []*ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{{InstanceTypeId: tea.String("ecs.g7.large")}}
+		p.instanceTypesOfferings = map[string]sets.Set[string]{"ecs.g7.large": sets.New("cn-hangzhou-i")}
+		assert.Equal(t, wantErr, p.validateState(nodeClass) != nil, region)
+	}
+}
+
+func TestFilterInstanceFamilies(t *testing.T) {
+	instanceTypes := lo.Map([]string{"ecs.g7.large", "ecs.g7ne.large", "ecs.c7.large", "ecs.gn6i-c4g1.xlarge", "ecs.gn7i-c8g1.2xlarge"},
+		func(name string, _ int) *cloudprovider.InstanceType { return &cloudprovider.InstanceType{Name: name} })
+	names := func(o *options.Options) []string {
+		return lo.Map(filterInstanceFamilies(options.ToContext(context.Background(), o), instanceTypes),
+			func(it *cloudprovider.InstanceType, _ int) string { return it.Name })
+	}
+
+	// no lists allow all the families
+	assert.Len(t, names(&options.Options{}), len(instanceTypes))
+	// globs and prefixes match with or without the ecs. prefix
+	assert.Equal(t, []string{"ecs.g7.large", "ecs.g7ne.large", "ecs.c7.large"}, names(&options.Options{BlockedInstanceFamilies: "gn*"}))
+	assert.Equal(t, []string{"ecs.g7.large", "ecs.g7ne.large", "ecs.c7.large", "ecs.gn7i-c8g1.2xlarge"}, names(&options.Options{BlockedInstanceFamilies: "ecs.gn6"}))
+	assert.Equal(t, []string{"ecs.g7.large", "ecs.g7ne.large"}, names(&options.Options{AllowedInstanceFamilies: "ecs.g7"}))
+	// the blocked families take precedence over the allowed ones
+	assert.Equal(t, []string{"ecs.g7.large", "ecs.g7ne.large"}, names(&options.Options{AllowedInstanceFamilies: "g*", BlockedInstanceFamilies: " gn* ,"}))
+}
+
+func TestWeighInstanceFamilies(t *testing.T) {
+	instanceTypes := func() cloudprovider.InstanceTypes {
+		return lo.Map([]lo.Tuple2[string, float64]{{A: "ecs.g6.large", B: 0.40}, {A: "ecs.g8i.large", B: 0.44}, {A: "ecs.c7.large", B: 0.42}},
+			func(it lo.Tuple2[string, float64], _ int) *cloudprovider.InstanceType {
+				return &cloudprovider.InstanceType{Name: it.A, Offerings: cloudprovider.Offerings{
+					{Requirements: scheduling.NewRequirements(), Price: it.B, Available: true},
+					{Requirements: scheduling.NewRequirements(), Price: it.B / 2, Available: false},
+				}}
+			})
+	}
+	ranking := func(o *options.Options) []string {
+		weighted := cloudprovider.InstanceTypes(weighInstanceFamilies(options.ToContext(context.Background(), o), instanceTypes()))
+		return lo.Map(weighted.OrderByPrice(scheduling.NewRequirements()), func(it *cloudprovider.InstanceType, _ int) string { return it.Name })
+	}
+
+	// no weights rank the instance types by their prices
+	assert.Equal(t, []string{"ecs.g6.large", "ecs.c7.large", "ecs.g8i.large"}, ranking(&options.Options{}))
+	// the weighted families are ranked by their weighted prices, with or without the ecs. prefix
+	assert.Equal(t, []string{"ecs.g8i.large", "ecs.g6.large", "ecs.c7.large"}, ranking(&options.Options{InstanceFamilyWeights: "g8i=0.9"}))
+	assert.Equal(t, []string{"ecs.c7.large", "ecs.g8i.large", "ecs.g6.large"}, ranking(&options.Options{InstanceFamilyWeights: "ecs.g6=1.2,ecs.g8i=0.96"}))
+
+	// the families without a weight keep their prices, and the availability of the offerings is kept
+	weighted := weighInstanceFamilies(options.ToContext(context.Background(), &options.Options{InstanceFamilyWeights: "ecs.g8i=0.5"}), instanceTypes())
+	assert.Equal(t, []float64{0.40, 0.20}, lo.Map(weighted[0].Offerings, func(o cloudprovider.Offering, _ int) float64 { return o.Price }))
+	assert.Equal(t, []float64{0.22, 0.11}, lo.Map(weighted[1].Offerings, func(o cloudprovider.Offering, _ int) float64 { return o.Price }))
+	assert.Equal(t, []bool{true, false}, lo.Map(weighted[1].Offerings, func(o cloudprovider.Offering, _ int) bool { return o.Available }))
+}
+
+func TestUpdateInstanceTypesSharesSweep(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		assert.Equal(t, "DescribeInstanceTypes", r.Header.Get("x-acs-action"))
+		calls.Add(1)
+		// keep the sweep in flight until every caller is waiting for it
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, `{"RequestId":"r","InstanceTypes":{"InstanceType":[{"InstanceTypeId":"ecs.g7.large"}]}}`)
+	}))
+	t.Cleanup(server.Close)
+	ecsClient, err := ecsclient.NewClient(&openapi.Config{
+		AccessKeyId:     tea.String("ak"),
+		AccessKeySecret: tea.String("sk"),
+		RegionId:        tea.String("cn-hangzhou"),
+		Endpoint:        tea.String(strings.TrimPrefix(server.URL, "http://")),
+		Protocol:        tea.String("http"),
+	})
+	require.NoError(t, err)
+
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterCNI: options.ClusterCNIFlannel})
+	p := NewDefaultProvider("cn-hangzhou", ecsClient, nil, nil, kcache.NewUnavailableOfferings(), nil, nil, nil)
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			assert.NoError(t, p.UpdateInstanceTypes(ctx))
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Len(t, p.instanceTypesInfo, 1)
+}
+
+func TestCreateOfferingsCapacityReservations(t *testing.T) {
+	pricingProvider := &fakePricingProvider{onDemandPrices: map[string]float64{"ecs.g7.large": 0.5}}
+	p := NewDefaultProvider("cn-hangzhou", nil, nil, nil, kcache.NewUnavailableOfferings(), pricingProvider, nil, nil)
+
+	offerings := cloudprovider.Offerings(p.createOfferings(context.Background(), "ecs.g7.large", []ZoneData{
+		{ID: "cn-hangzhou-i", Available: true},
+		{ID: "cn-hangzhou-j", Available: true},
+	}, []v1alpha1.CapacityReservation{
+		{ID: "crp-1", InstanceType: "ecs.g7.large", ZoneID: "cn-hangzhou-i", AvailableInstanceCount: 1},
+		{ID: "crp-2", InstanceType: "ecs.g7.large", ZoneID: "cn-hangzhou-j"},
+		{ID: "crp-3", InstanceType: "ecs.c7.large", ZoneID: "cn-hangzhou-i", AvailableInstanceCount: 1},
+	}, 0))
+	assert.Len(t, offerings, 4)
+
+	reserved := offerings.Available().Compatible(scheduling.NewRequirements(
+		scheduling.NewRequirement(v1alpha1.LabelCapacityReservationID, corev1.NodeSelectorOpExists),
+	))
+	assert.Len(t, reserved, 1)
+	assert.Equal(t, "crp-1", reserved[0].Requirements.Get(v1alpha1.LabelCapacityReservationID).Any())
+	assert.Equal(t, "cn-hangzhou-i", reserved[0].Requirements.Get(corev1.LabelTopologyZone).Any())
+	assert.Less(t, reserved[0].Price, 0.5)
+	assert.Equal(t, reserved[0].Price, offerings.Available().Cheapest().Price)
+
+	// the public pool offerings are kept apart from the capacity reservations
+	public := offerings.Available().Compatible(scheduling.NewRequirements(
+		scheduling.NewRequirement(v1alpha1.LabelCapacityReservationID, corev1.NodeSelectorOpDoesNotExist),
+	))
+	assert.Len(t, public, 2)
+	assert.Equal(t, 0.5, public.Cheapest().Price)
+}
+
+func TestListZoneFiltering(t *testing.T) {
+	pricingProvider := &fakePricingProvider{
+		onDemandPrices: map[string]float64{"ecs.g7.large": 0.5, "ecs.c7.large": 0.4},
+		spotPrices: map[[2]string]float64{
+			{"ecs.g7.large", "cn-hangzhou-i"}: 0.1, {"ecs.g7.large", "cn-hangzhou-j"}: 0.1,
+			{"ecs.c7.large", "cn-hangzhou-j"}: 0.1,
+		},
+	}
+	p := NewDefaultProvider("cn-hangzhou", nil, nil, cache.New(time.Minute, time.Minute), kcache.NewUnavailableOfferings(), pricingProvider, nil,
+		zone.NewDefaultProvider("cn-hangzhou", fake.NewECSAPI(), nil, cache.New(time.Minute, time.Minute)))
+	for _, instanceType := range []string{"ecs.g7.large", "ecs.c7.large"} {
+		p.instanceTypesInfo = append(p.instanceTypesInfo, &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+			InstanceTypeId:              tea.String(instanceType),
+			CpuArchitecture:             tea.String("X86"),
+			CpuCoreCount:                tea.Int32(2),
+			MemorySize:                  tea.Float32(8),
+			EniQuantity:                 tea.Int32(3),
+			EniPrivateIpAddressQuantity: tea.Int32(6),
+		})
+	}
+	// ecs.g7.large is sold in both zones, ecs.c7.large only in cn-hangzhou-j
+	p.instanceTypesOfferings = map[string]sets.Set[string]{
+		"ecs.g7.large": sets.New("cn-hangzhou-i", "cn-hangzhou-j"),
+		"ecs.c7.large": sets.New("cn-hangzhou-j"),
+	}
+	p.spotInstanceTypesOfferings = p.instanceTypesOfferings
+
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterCNI: options.ClusterCNIFlannel, VMMemoryOverheadPercent: 0.065})
+	list := func(zones ...string) map[string]cloudprovider.Offerings {
+		nodeClass := &v1alpha1.ECSNodeClass{Status: v1alpha1.ECSNodeClassStatus{
+			VSwitches: lo.Map(zones, func(zone string, i int) v1alpha1.VSwitch {
+				return v1alpha1.VSwitch{ID: fmt.Sprintf("vsw-%d", i), ZoneID: zone}
+			}),
+		}}
+		instanceTypes, err := p.List(ctx, nil, nodeClass)
+		require.NoError(t, err)
+		return lo.SliceToMap(instanceTypes, func(it *cloudprovider.InstanceType) (string, cloudprovider.Offerings) {
+			return it.Name, it.Offerings
+		})
+	}
+	zones := func(offerings cloudprovider.Offerings) []string {
+		return lo.Uniq(lo.Map(offerings.Available(), func(o cloudprovider.Offering, _ int) string {
+			return o.Requirements.Get(corev1.LabelTopologyZone).Any()
+		}))
+	}
+
+	offerings := list("cn-hangzhou-i")
+	assert.Len(t, offerings, 1)
+	assert.Len(t, offerings["ecs.g7.large"], 2)
+	assert.Equal(t, []string{"cn-hangzhou-i"}, zones(offerings["ecs.g7.large"]))
+
+	offerings = list("cn-hangzhou-i", "cn-hangzhou-j")
+	assert.Len(t, offerings, 2)
+	assert.ElementsMatch(t, []string{"cn-hangzhou-i", "cn-hangzhou-j"}, zones(offerings["ecs.g7.large"]))
+	assert.Equal(t, []string{"cn-hangzhou-j"}, zones(offerings["ecs.c7.large"]))
+
+	// the excluded zone isn't offered even if the status still has its vSwitches
+	nodeClass := &v1alpha1.ECSNodeClass{
+		Spec: v1alpha1.ECSNodeClassSpec{ZoneExclusions: []string{"cn-hangzhou-j"}},
+		Status: v1alpha1.ECSNodeClassStatus{VSwitches: []v1alpha1.VSwitch{
+			{ID: "vsw-0", ZoneID: "cn-hangzhou-i"}, {ID: "vsw-1", ZoneID: "cn-hangzhou-j"},
+		}},
+	}
+	instanceTypes, err := p.List(ctx, nil, nodeClass)
+	require.NoError(t, err)
+	require.Len(t, instanceTypes, 1)
+	assert.Equal(t, "ecs.g7.large", instanceTypes[0].Name)
+	assert.Equal(t, []string{"cn-hangzhou-i"}, zones(instanceTypes[0].Offerings))
+}
+
+func TestListMinResources(t *testing.T) {
+	sizes := map[string]int32{"ecs.g7.large": 2, "ecs.g7.xlarge": 4, "ecs.g7.2xlarge": 8}
+	pricingProvider := &fakePricingProvider{onDemandPrices: map[string]float64{}}
+	p := NewDefaultProvider("cn-hangzhou", nil, nil, cache.New(time.Minute, time.Minute), kcache.NewUnavailableOfferings(), pricingProvider, nil,
+		zone.NewDefaultProvider("cn-hangzhou", fake.NewECSAPI(), nil, cache.New(time.Minute, time.Minute)))
+	p.instanceTypesOfferings = map[string]sets.Set[string]{}
+	p.spotInstanceTypesOfferings = map[string]sets.Set[string]{}
+	for instanceType, cpu := range sizes {
+		p.instanceTypesInfo = append(p.instanceTypesInfo, &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+			InstanceTypeId:              tea.String(instanceType),
+			CpuArchitecture:             tea.String("X86"),
+			CpuCoreCount:                tea.Int32(cpu),
+			MemorySize:                  tea.Float32(float32(cpu * 4)),
+			EniQuantity:                 tea.Int32(3),
+			EniPrivateIpAddressQuantity: tea.Int32(6),
+		})
+		p.instanceTypesOfferings[instanceType] = sets.New("cn-hangzhou-i")
+		p.spotInstanceTypesOfferings[instanceType] = sets.New[string]()
+		pricingProvider.onDemandPrices[instanceType] = float64(cpu) / 10
+	}
+
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterCNI: options.ClusterCNIFlannel, VMMemoryOverheadPercent: 0.065})
+	list := func(minResources *v1alpha1.MinResources) []*cloudprovider.InstanceType {
+		nodeClass := &v1alpha1.ECSNodeClass{
+			Spec:   v1alpha1.ECSNodeClassSpec{MinResources: minResources},
+			Status: v1alpha1.ECSNodeClassStatus{VSwitches: []v1alpha1.VSwitch{{ID: "vsw-0", ZoneID: "cn-hangzhou-i"}}},
+		}
+		instanceTypes, err := p.List(ctx, nil, nodeClass)
+		require.NoError(t, err)
+		return instanceTypes
+	}
+	names := func(instanceTypes []*cloudprovider.InstanceType) []string {
+		return lo.Map(instanceTypes, func(it *cloudprovider.InstanceType, _ int) string { return it.Name })
+	}
+
+	assert.ElementsMatch(t, []string{"ecs.g7.large", "ecs.g7.xlarge", "ecs.g7.2xlarge"}, names(list(nil)))
+	assert.ElementsMatch(t, []string{"ecs.g7.xlarge", "ecs.g7.2xlarge"}, names(list(&v1alpha1.MinResources{CPU: tea.Int32(4)})))
+	assert.ElementsMatch(t, []string{"ecs.g7.2xlarge"}, names(list(&v1alpha1.MinResources{Memory: lo.ToPtr(resource.MustParse("17Gi"))})))
+	// the memory is compared before the VM overhead, and the same floor in other units shares the cached instance types
+	assert.ElementsMatch(t, []string{"ecs.g7.xlarge", "ecs.g7.2xlarge"}, names(list(&v1alpha1.MinResources{Memory: lo.ToPtr(resource.MustParse("16Gi"))})))
+	assert.ElementsMatch(t, []string{"ecs.g7.xlarge", "ecs.g7.2xlarge"}, names(list(&v1alpha1.MinResources{Memory: lo.ToPtr(resource.MustParse("16384Mi"))})))
+
+	// the floor narrows the instance types compatible with the NodePool requirements, it never adds any
+	requirements := scheduling.NewRequirements(scheduling.NewRequirement(v1alpha1.LabelInstanceCPU, corev1.NodeSelectorOpIn, "2", "4"))
+	compatible := func(instanceTypes []*cloudprovider.InstanceType) []string {
+		return names(lo.Filter(instanceTypes, func(it *cloudprovider.InstanceType, _ int) bool {
+			return it.Requirements.Compatible(requirements) == nil
+		}))
+	}
+	assert.ElementsMatch(t, []string{"ecs.g7.large", "ecs.g7.xlarge"}, compatible(list(nil)))
+	assert.ElementsMatch(t, []string{"ecs.g7.xlarge"}, compatible(list(&v1alpha1.MinResources{CPU: tea.Int32(4)})))
+	assert.Empty(t, compatible(list(&v1alpha1.MinResources{CPU: tea.Int32(8)})))
+}
+
+func TestListTerway(t *testing.T) {
+	enis := map[string]int32{"ecs.g7.large": 3, "ecs.g7.xlarge": 4, "ecs.g7.2xlarge": 8}
+	pricingProvider := &fakePricingProvider{onDemandPrices: map[string]float64{}}
+	p := NewDefaultProvider("cn-hangzhou", nil, nil, cache.New(time.Minute, time.Minute), kcache.NewUnavailableOfferings(), pricingProvider, nil,
+		zone.NewDefaultProvider("cn-hangzhou", fake.NewECSAPI(), nil, cache.New(time.Minute, time.Minute)))
+	p.instanceTypesOfferings = map[string]sets.Set[string]{}
+	p.spotInstanceTypesOfferings = map[string]sets.Set[string]{}
+	for instanceType, eniQuantity := range enis {
+		p.instanceTypesInfo = append(p.instanceTypesInfo, &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+			InstanceTypeId:              tea.String(instanceType),
+			CpuArchitecture:             tea.String("X86"),
+			CpuCoreCount:                tea.Int32(2),
+			MemorySize:                  tea.Float32(8),
+			EniQuantity:                 tea.Int32(eniQuantity),
+			EniPrivateIpAddressQuantity: tea.Int32(10),
+			EniTrunkSupported:           tea.Bool(instanceType != "ecs.g7.xlarge"),
+		})
+		p.instanceTypesOfferings[instanceType] = sets.New("cn-hangzhou-i")
+		p.spotInstanceTypesOfferings[instanceType] = sets.New[string]()
+		pricingProvider.onDemandPrices[instanceType] = float64(eniQuantity) / 10
+	}
+
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterCNI: options.ClusterCNITerway, VMMemoryOverheadPercent: 0.065})
+	list := func(terway *v1alpha1.TerwayConfiguration) map[string]int64 {
+		nodeClass := &v1alpha1.ECSNodeClass{
+			Spec:   v1alpha1.ECSNodeClassSpec{Terway: terway},
+			Status: v1alpha1.ECSNodeClassStatus{VSwitches: []v1alpha1.VSwitch{{ID: "vsw-0", ZoneID: "cn-hangzhou-i"}}},
+		}
+		instanceTypes, err := p.List(ctx, nil, nodeClass)
+		require.NoError(t, err)
+		return lo.SliceToMap(instanceTypes, func(it *cloudprovider.InstanceType) (string, int64) {
+			return it.Name, it.Capacity.Pods().Value()
+		})
+	}
+
+	assert.Equal(t, map[string]int64{
+		"ecs.g7.large":   2*10 + BaseHostNetworkPods,
+		"ecs.g7.xlarge":  3*10 + BaseHostNetworkPods,
+		"ecs.g7.2xlarge": 7*10 + BaseHostNetworkPods,
+	}, list(nil))
+	// the instance types with fewer secondary ENIs than the ENI count are filtered out
+	assert.Equal(t, map[string]int64{
+		"ecs.g7.xlarge":  3*10 + BaseHostNetworkPods,
+		"ecs.g7.2xlarge": 3*10 + BaseHostNetworkPods,
+	}, list(&v1alpha1.TerwayConfiguration{ENICount: tea.Int32(3)}))
+	// the trunk ENI takes one of the ENIs, and it's only offered on the instance types supporting it
+	assert.Equal(t, map[string]int64{
+		"ecs.g7.2xlarge": 2*10 + BaseHostNetworkPods,
+	}, list(&v1alpha1.TerwayConfiguration{ENITrunking: true, ENICount: tea.Int32(3)}))
+}
+
+func TestUpdateInstanceTypeOfferings(t *testing.T) {
+	ecsAPI := fake.NewECSAPI()
+	pricingProvider := &fakePricingProvider{onDemandPrices: map[string]float64{"ecs.g7.large": 0.5, "ecs.g7.xlarge": 1, "ecs.c7.large": 0.4, "ecs.g8y.large": 0.45}}
+	p := NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute), kcache.NewUnavailableOfferings(), pricingProvider, nil,
+		zone.NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute)))
+
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterCNI: options.ClusterCNIFlannel, VMMemoryOverheadPercent: 0.065})
+	// the provider is synced once both the instance types and the offerings are refreshed
+	assert.False(t, p.SyncedAtLeastOnce())
+	require.NoError(t, p.UpdateInstanceTypes(ctx))
+	assert.False(t, p.SyncedAtLeastOnce())
+	require.NoError(t, p.UpdateInstanceTypeOfferings(ctx))
+	assert.True(t, p.SyncedAtLeastOnce())
+
+	// the on-demand and the spot offerings are described separately
+	requests := ecsAPI.DescribeAvailableResourceBehavior.Requests()
+	require.Len(t, requests, 2)
+	assert.Nil(t, requests[0].SpotStrategy)
+	assert.Equal(t, "SpotAsPriceGo", tea.StringValue(requests[1].SpotStrategy))
+
+	// the ARM instance type is only sold in the first zone
+	instanceTypes, err := p.List(ctx, nil, &v1alpha1.ECSNodeClass{Status: v1alpha1.ECSNodeClassStatus{
+		VSwitches: []v1alpha1.VSwitch{{ID: "vsw-2", ZoneID: fake.DefaultZones[1]}},
+	}})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"ecs.g7.large", "ecs.g7.xlarge", "ecs.c7.large"}, lo.Map(instanceTypes, func(it *cloudprovider.InstanceType, _ int) string {
+		return it.Name
+	}))
+}
+
+func TestListOfferingPreflight(t *testing.T) {
+	ecsAPI := fake.NewECSAPI()
+	pricingProvider := &fakePricingProvider{onDemandPrices: map[string]float64{"ecs.g7.large": 0.5, "ecs.g7.xlarge": 1, "ecs.c7.large": 0.4, "ecs.g8y.large": 0.45}}
+	p := NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute), kcache.NewUnavailableOfferings(), pricingProvider, nil,
+		zone.NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute)))
+
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterCNI: options.ClusterCNIFlannel, VMMemoryOverheadPercent: 0.065})
+	require.NoError(t, p.UpdateInstanceTypes(ctx))
+	require.NoError(t, p.UpdateInstanceTypeOfferings(ctx))
+
+	// ecs.g7.large sells out in the first zone after the offerings are refreshed
+	zones := fake.DefaultInstanceTypeZones()
+	zones["ecs.g7.large"] = fake.DefaultZones[1:]
+	ecsAPI.Seed(fake.ECSAPIState{InstanceTypes: fake.DefaultInstanceTypes(), InstanceTypeZones: zones, Images: fake.DefaultImages(), Zones: fake.DefaultZones})
+	ecsAPI.DescribeAvailableResourceBehavior.Reset()
+
+	nodeClass := &v1alpha1.ECSNodeClass{Status: v1alpha1.ECSNodeClassStatus{
+		VSwitches: []v1alpha1.VSwitch{{ID: "vsw-1", ZoneID: fake.DefaultZones[0]}},
+	}}
+	onDemandAvailable := func(ctx context.Context) bool {
+		instanceTypes, err := p.List(ctx, nil, nodeClass)
+		require.NoError(t, err)
+		// the instance types without any available offering are left out
+		instanceType, ok := lo.Find(instanceTypes, func(it *cloudprovider.InstanceType) bool { return it.Name == "ecs.g7.large" })
+		return ok && lo.ContainsBy(instanceType.Offerings.Available(), func(o cloudprovider.Offering) bool {
+			return o.Requirements.Get(karpv1.CapacityTypeLabelKey).Has(karpv1.CapacityTypeOnDemand)
+		})
+	}
+
+	// without the preflight the offerings are the ones of the last refresh
+	assert.True(t, onDemandAvailable(ctx))
+	assert.Zero(t, ecsAPI.DescribeAvailableResourceBehavior.Calls())
+
+	// the preflight of the zone drops the sold out offering, and is cached
+	ctx = options.ToContext(context.Background(), &options.Options{ClusterCNI: options.ClusterCNIFlannel, VMMemoryOverheadPercent: 0.065, OfferingPreflight: true})
+	assert.False(t, onDemandAvailable(ctx))
+	assert.False(t, onDemandAvailable(ctx))
+	requests := ecsAPI.DescribeAvailableResourceBehavior.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, fake.DefaultZones[0], tea.StringValue(requests[0].ZoneId))
+	assert.Equal(t, "SpotAsPriceGo", tea.StringValue(requests[1].SpotStrategy))
+
+	// a zone which fails to be preflighted isn't restricted
+	p.preflightCache.Flush()
+	ecsAPI.DescribeAvailableResourceBehavior.SetError(fmt.Errorf("internal error"))
+	assert.True(t, onDemandAvailable(ctx))
+}
+
+func TestUpdateOfferingPrices(t *testing.T) {
+	ecsAPI := fake.NewECSAPI()
+	pricingProvider := &fakePricingProvider{
+		onDemandPrices: map[string]float64{"ecs.g7.large": 0.5, "ecs.g7.xlarge": 1, "ecs.c7.large": 0.4, "ecs.g8y.large": 0.45},
+		spotPrices:     map[[2]string]float64{{"ecs.g7.large", fake.DefaultZones[0]}: 0.1},
+	}
+	p := NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute), kcache.NewUnavailableOfferings(), pricingProvider, nil,
+		zone.NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute)))
+
+	ctx := options.ToContext(context.Background(), &options.Options{ClusterCNI: options.ClusterCNIFlannel, VMMemoryOverheadPercent: 0.065})
+	require.NoError(t, p.UpdateInstanceTypes(ctx))
+	require.NoError(t, p.UpdateInstanceTypeOfferings(ctx))
+
+	nodeClass := &v1alpha1.ECSNodeClass{Status: v1alpha1.ECSNodeClassStatus{
+		VSwitches:            []v1alpha1.VSwitch{{ID: "vsw-1", ZoneID: fake.DefaultZones[0]}},
+		CapacityReservations: []v1alpha1.CapacityReservation{{ID: "crp-1", InstanceType: "ecs.g7.large", ZoneID: fake.DefaultZones[0], AvailableInstanceCount: 1}},
+	}}
+	prices := func() map[string]float64 {
+		instanceTypes, err := p.List(ctx, nil, nodeClass)
+		require.NoError(t, err)
+		instanceType, ok := lo.Find(instanceTypes, func(it *cloudprovider.InstanceType) bool { return it.Name == "ecs.g7.large" })
+		require.True(t, ok)
+		return lo.SliceToMap(instanceType.Offerings, func(o cloudprovider.Offering) (string, float64) {
+			if id := o.Requirements.Get(v1alpha1.LabelCapacityReservationID); id.Operator() == corev1.NodeSelectorOpIn {
+				return id.Any(), o.Price
+			}
+			return o.Requirements.Get(karpv1.CapacityTypeLabelKey).Any(), o.Price
+		})
+	}
+	assert.Equal(t, map[string]float64{karpv1.CapacityTypeOnDemand: 0.5, karpv1.CapacityTypeSpot: 0.1, "crp-1": 0.5 / ReservedPriceDivisor}, prices())
+	calls := ecsAPI.DescribeInstanceTypesBehavior.Calls()
+
+	// the prices of the cached instance types are updated in place of the recomputation
+	pricingProvider.onDemandPrices["ecs.g7.large"] = 0.6
+	pricingProvider.spotPrices[[2]string{"ecs.g7.large", fake.DefaultZones[0]}] = 0.2
+	// the instance types the callers already hold keep their prices
+	instanceTypes, err := p.List(ctx, nil, nodeClass)
+	require.NoError(t, err)
+	p.UpdateOfferingPrices(ctx)
+	assert.Equal(t, map[string]float64{karpv1.CapacityTypeOnDemand: 0.6, karpv1.CapacityTypeSpot: 0.2, "crp-1": 0.6 / ReservedPriceDivisor}, prices())
+	assert.Equal(t, calls, ecsAPI.DescribeInstanceTypesBehavior.Calls())
+	assert.Len(t, p.instanceTypesCache.Items(), 1)
+	held, ok := lo.Find(instanceTypes, func(it *cloudprovider.InstanceType) bool { return it.Name == "ecs.g7.large" })
+	require.True(t, ok)
+	assert.Contains(t, lo.Map(held.Offerings, func(o cloudprovider.Offering, _ int) float64 { return o.Price }), 0.5)
+
+	// the repriced spot offerings are only available below the spot price limit of the NodeClass
+	limited := nodeClass.DeepCopy()
+	limited.Spec.SpotStrategy = v1alpha1.SpotStrategySpotWithPriceLimit
+	limited.Spec.SpotPriceLimit = lo.ToPtr("0.25")
+	spotAvailable := func() bool {
+		instanceTypes, err := p.List(ctx, nil, limited)
+		require.NoError(t, err)
+		instanceType, ok := lo.Find(instanceTypes, func(it *cloudprovider.InstanceType) bool { return it.Name == "ecs.g7.large" })
+		require.True(t, ok)
+		spot, ok := lo.Find(instanceType.Offerings, func(o cloudprovider.Offering) bool {
+			return o.Requirements.Get(karpv1.CapacityTypeLabelKey).Any() == karpv1.CapacityTypeSpot
+		})
+		require.True(t, ok)
+		return spot.Available
+	}
+	assert.True(t, spotAvailable())
+	pricingProvider.spotPrices[[2]string{"ecs.g7.large", fake.DefaultZones[0]}] = 0.3
+	p.UpdateOfferingPrices(ctx)
+	assert.False(t, spotAvailable())
+	pricingProvider.spotPrices[[2]string{"ecs.g7.large", fake.DefaultZones[0]}] = 0.15
+	p.UpdateOfferingPrices(ctx)
+	assert.True(t, spotAvailable())
+	assert.Equal(t, calls, ecsAPI.DescribeInstanceTypesBehavior.Calls())
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"k8s.io/apimachinery/pkg/util/sets"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/logging"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
+)
+
+// resourceStatusAvailable is the status of the instance types ECS can launch in the zone right now
+const resourceStatusAvailable = "Available"
+
+// preflightOfferings returns the instance types ECS reports as available in each of the zones for each capacity type,
+// key: zone and capacity type. The results are cached for a short TTL. The zones which fail to be preflighted are left
+// out, so their offerings aren't restricted.
+func (p *DefaultProvider) preflightOfferings(ctx context.Context, zones sets.Set[string]) map[string]sets.Set[string] {
+	preflight := map[string]sets.Set[string]{}
+	for _, zone := range sets.List(zones) {
+		for _, capacityType := range []string{karpv1.CapacityTypeOnDemand, karpv1.CapacityTypeSpot} {
+			key := preflightKey(zone, capacityType)
+			if item, ok := p.preflightCache.Get(key); ok {
+				preflight[key] = item.(sets.Set[string])
+				continue
+			}
+			available, err := p.describeAvailableInstanceTypes(ctx, zone, capacityType)
+			if err != nil {
+				logging.FromContext(ctx).WithValues("zone", zone, "capacity-type", capacityType).Error(err, "failed to preflight offerings")
+				continue
+			}
+			if p.cm.HasChanged("preflight-"+key, available) {
+				atomic.AddUint64(&p.preflightSeqNum, 1)
+			}
+			p.preflightCache.SetDefault(key, available)
+			preflight[key] = available
+		}
+	}
+	return preflight
+}
+
+func (p *DefaultProvider) describeAvailableInstanceTypes(ctx context.Context, zone, capacityType string) (sets.Set[string], error) {
+	request := &ecsclient.DescribeAvailableResourceRequest{
+		RegionId:            tea.String(p.region),
+		ZoneId:              tea.String(zone),
+		DestinationResource: tea.String("InstanceType"),
+		InstanceChargeType:  tea.String("PostPaid"),
+	}
+	if capacityType == karpv1.CapacityTypeSpot {
+		request.SpotStrategy = tea.String("SpotAsPriceGo")
+	}
+	resp, err := ratelimit.Call(ctx, p.rateLimiter, "DescribeAvailableResource", func() (*ecsclient.DescribeAvailableResourceResponse, error) {
+		return p.ecsClient.DescribeAvailableResourceWithOptions(request, &util.RuntimeOptions{})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing available resources in zone %s, %w", zone, err)
+	}
+	if resp == nil || resp.Body == nil {
+		return nil, errors.New("invalid response when describing available resources")
+	}
+
+	available := sets.New[string]()
+	if resp.Body.AvailableZones == nil {
+		return available, nil
+	}
+	for _, az := range resp.Body.AvailableZones.AvailableZone {
+		if az == nil || tea.StringValue(az.ZoneId) != zone || az.AvailableResources == nil {
+			continue
+		}
+		for _, ar := range az.AvailableResources.AvailableResource {
+			if ar == nil || ar.SupportedResources == nil {
+				continue
+			}
+			for _, sr := range ar.SupportedResources.SupportedResource {
+				if sr != nil && tea.StringValue(sr.Status) == resourceStatusAvailable {
+					available.Insert(tea.StringValue(sr.Value))
+				}
+			}
+		}
+	}
+	return available, nil
+}
+
+// preflighted returns whether the instance type passed the preflight of the zone, it always does without a preflight
+// result for the zone
+func preflighted(preflight map[string]sets.Set[string], zone, capacityType, instanceType string) bool {
+	available, ok := preflight[preflightKey(zone, capacityType)]
+	return !ok || available.Has(instanceType)
+}
+
+func preflightKey(zone, capacityType string) string {
+	return zone + "/" + capacityType
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/samber/lo"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/sets"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	"sigs.k8s.io/karpenter/pkg/cloudprovider"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
@@ -37,10 +38,15 @@ import (
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/cluster"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/imagefamily"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/logging"
 )
 
 var (
 	instanceTypeScheme = regexp.MustCompile(`^ecs\.([a-z]+)(\-[0-9]+tb)?([0-9]+).*`)
+	// yitianInstanceFamilies are the ARM instance families with the Yitian 710 processor, they are used when
+	// DescribeInstanceTypes doesn't report the architecture or the processor of the instance type
+	yitianInstanceFamilies = sets.New("ecs.g8y", "ecs.c8y", "ecs.r8y")
 )
 
 const (
@@ -106,7 +112,7 @@ func calculateCPUOverhead(cpuM int64) int64 {
 
 func NewInstanceType(ctx context.Context,
 	info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType,
-	kc *v1alpha1.KubeletConfiguration, region string, systemDisk *v1alpha1.SystemDisk,
+	kc *v1alpha1.KubeletConfiguration, region string, systemDisk *v1alpha1.SystemDisk, terway *v1alpha1.TerwayConfiguration,
 	offerings cloudprovider.Offerings, clusterCNI string) *cloudprovider.InstanceType {
 	if offerings == nil {
 		return nil
@@ -116,7 +122,7 @@ func NewInstanceType(ctx context.Context,
 		Name:         *info.InstanceTypeId,
 		Requirements: computeRequirements(info, offerings, region),
 		Offerings:    offerings,
-		Capacity:     computeCapacity(ctx, info, kc.MaxPods, kc.PodsPerCore, systemDisk, clusterCNI),
+		Capacity:     computeCapacity(ctx, info, kc.MaxPods, kc.PodsPerCore, systemDisk, terway, clusterCNI),
 		Overhead: &cloudprovider.InstanceTypeOverhead{
 			KubeReserved:      corev1.ResourceList{},
 			SystemReserved:    corev1.ResourceList{},
@@ -124,24 +130,33 @@ func NewInstanceType(ctx context.Context,
 		},
 	}
 
-	// Follow KubeReserved/SystemReserved/EvictionThreshold will be merged, so we can set only one overhead totally
-	it.Overhead.KubeReserved = calculateResourceOverhead(it.Capacity.Pods().Value(),
-		it.Capacity.Cpu().MilliValue(), extractMemory(info).Value()/MiBByteRatio)
+	// Follow KubeReserved/SystemReserved/EvictionThreshold will be merged, the ACK reservation policy is used for
+	// the resources that the KubeletConfiguration doesn't reserve
+	it.Overhead.KubeReserved = lo.Assign(calculateResourceOverhead(it.Capacity.Pods().Value(),
+		it.Capacity.Cpu().MilliValue(), extractMemory(info).Value()/MiBByteRatio), reservedResources(kc.KubeReserved))
+	it.Overhead.SystemReserved = reservedResources(kc.SystemReserved)
+	it.Overhead.EvictionThreshold = evictionThreshold(it.Capacity, kc.EvictionHard, kc.EvictionSoft)
+	if name, ok := overReservedResource(it); ok {
+		logging.FromContext(ctx).WithValues("instance-type", it.Name, "resource", name).V(1).Info("skipping instance type, the reserved resources exceed the capacity")
+		return nil
+	}
 	if it.Requirements.Compatible(scheduling.NewRequirements(scheduling.NewRequirement(corev1.LabelOSStable, corev1.NodeSelectorOpIn, string(corev1.Windows)))) == nil {
 		it.Capacity[v1alpha1.ResourcePrivateIPv4Address] = *privateIPv4Address(info)
 	}
 	return it
 }
 
-func extractECSArch(unFormatedArch string) string {
-	switch unFormatedArch {
+func extractECSArch(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType) string {
+	switch strings.ToUpper(tea.StringValue(info.CpuArchitecture)) {
 	case "X86":
-		return "amd64"
+		return karpv1.ArchitectureAmd64
 	case "ARM":
-		return "arm64"
-	default:
-		return "amd64"
+		return karpv1.ArchitectureArm64
+	}
+	if yitianInstanceFamilies.Has(utils.InstanceFamily(tea.StringValue(info.InstanceTypeId))) {
+		return karpv1.ArchitectureArm64
 	}
+	return karpv1.ArchitectureAmd64
 }
 
 //nolint:gocyclo
@@ -149,7 +164,7 @@ func computeRequirements(info *ecsclient.DescribeInstanceTypesResponseBodyInstan
 	requirements := scheduling.NewRequirements(
 		// Well Known Upstream
 		scheduling.NewRequirement(corev1.LabelInstanceTypeStable, corev1.NodeSelectorOpIn, tea.StringValue(info.InstanceTypeId)),
-		scheduling.NewRequirement(corev1.LabelArchStable, corev1.NodeSelectorOpIn, extractECSArch(tea.StringValue(info.CpuArchitecture))),
+		scheduling.NewRequirement(corev1.LabelArchStable, corev1.NodeSelectorOpIn, extractECSArch(info)),
 		scheduling.NewRequirement(corev1.LabelOSStable, corev1.NodeSelectorOpIn, string(corev1.Linux)),
 		scheduling.NewRequirement(corev1.LabelTopologyZone, corev1.NodeSelectorOpIn, lo.Map(offerings.Available(), func(o cloudprovider.Offering, _ int) string {
 			return o.Requirements.Get(corev1.LabelTopologyZone).Any()
@@ -163,6 +178,7 @@ func computeRequirements(info *ecsclient.DescribeInstanceTypesResponseBodyInstan
 		// Well Known to AlibabaCloud
 		scheduling.NewRequirement(v1alpha1.LabelInstanceCPU, corev1.NodeSelectorOpIn, fmt.Sprint(tea.Int32Value(info.CpuCoreCount))),
 		scheduling.NewRequirement(v1alpha1.LabelInstanceCPUModel, corev1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha1.LabelInstanceCPUManufacturer, corev1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1alpha1.LabelInstanceMemory, corev1.NodeSelectorOpIn, fmt.Sprint(tea.Float32Value(info.MemorySize)*GiBMiBRatio)),
 		scheduling.NewRequirement(v1alpha1.LabelInstanceCategory, corev1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1alpha1.LabelInstanceFamily, corev1.NodeSelectorOpDoesNotExist),
@@ -172,6 +188,11 @@ func computeRequirements(info *ecsclient.DescribeInstanceTypesResponseBodyInstan
 		scheduling.NewRequirement(v1alpha1.LabelInstanceGPUManufacturer, corev1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1alpha1.LabelInstanceGPUCount, corev1.NodeSelectorOpDoesNotExist),
 		scheduling.NewRequirement(v1alpha1.LabelInstanceGPUMemory, corev1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha1.LabelInstanceLocalStorage, corev1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha1.LabelInstanceLocalStorageCategory, corev1.NodeSelectorOpDoesNotExist),
+		scheduling.NewRequirement(v1alpha1.LabelInstanceENICount, corev1.NodeSelectorOpIn, fmt.Sprint(tea.Int32Value(info.EniQuantity))),
+		scheduling.NewRequirement(v1alpha1.LabelInstanceENIPrivateIPCount, corev1.NodeSelectorOpIn, fmt.Sprint(tea.Int32Value(info.EniPrivateIpAddressQuantity))),
+		scheduling.NewRequirement(v1alpha1.LabelInstanceNetworkBandwidth, corev1.NodeSelectorOpDoesNotExist),
 	)
 	// Only add zone-id label when available in offerings. It may not be available if a user has upgraded from a
 	// previous version of Karpenter w/o zone-id support and the nodeclass vswitch status has not yet updated.
@@ -203,9 +224,24 @@ func computeRequirements(info *ecsclient.DescribeInstanceTypesResponseBodyInstan
 		requirements.Get(v1alpha1.LabelInstanceGPUMemory).Insert(fmt.Sprint(tea.Float32Value(info.GPUMemorySize)))
 	}
 
-	// CPU Manufacturer, valid options: intel, amd
-	if info.PhysicalProcessorModel != nil {
-		requirements.Get(v1alpha1.LabelInstanceCPUModel).Insert(getCPUModel(tea.StringValue(info.PhysicalProcessorModel)))
+	// Network Bandwidth Label, in Mbit/s
+	if bandwidth := getInstanceBandwidth(info); bandwidth != 0 {
+		requirements.Get(v1alpha1.LabelInstanceNetworkBandwidth).Insert(fmt.Sprint(bandwidth / 1000))
+	}
+
+	// Local Storage Labels, instance types without local disks report no amount
+	if localStorage := int64(tea.Int32Value(info.LocalStorageAmount)) * tea.Int64Value(info.LocalStorageCapacity); localStorage != 0 {
+		requirements.Get(v1alpha1.LabelInstanceLocalStorage).Insert(fmt.Sprint(localStorage))
+		requirements.Get(v1alpha1.LabelInstanceLocalStorageCategory).Insert(tea.StringValue(info.LocalStorageCategory))
+	}
+
+	// CPU Model, valid options: intel, amd
+	if cpuModel := getCPUModel(tea.StringValue(info.PhysicalProcessorModel)); cpuModel != "" {
+		requirements.Get(v1alpha1.LabelInstanceCPUModel).Insert(cpuModel)
+	}
+	// CPU Manufacturer, valid options: intel, amd, yitian
+	if manufacturer := getCPUManufacturer(info); manufacturer != "" {
+		requirements.Get(v1alpha1.LabelInstanceCPUManufacturer).Insert(manufacturer)
 	}
 
 	return requirements
@@ -213,13 +249,13 @@ func computeRequirements(info *ecsclient.DescribeInstanceTypesResponseBodyInstan
 
 func computeCapacity(ctx context.Context,
 	info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType,
-	maxPods *int32, podsPerCore *int32, systemDisk *v1alpha1.SystemDisk, clusterCNI string) corev1.ResourceList {
+	maxPods *int32, podsPerCore *int32, systemDisk *v1alpha1.SystemDisk, terway *v1alpha1.TerwayConfiguration, clusterCNI string) corev1.ResourceList {
 
 	resourceList := corev1.ResourceList{
 		corev1.ResourceCPU:              *cpu(info),
 		corev1.ResourceMemory:           *memory(ctx, info),
 		corev1.ResourceEphemeralStorage: *ephemeralStorage(systemDisk),
-		corev1.ResourcePods:             *pods(ctx, info, maxPods, podsPerCore, clusterCNI),
+		corev1.ResourcePods:             *pods(ctx, info, maxPods, podsPerCore, terway, clusterCNI),
 		v1alpha1.ResourceNVIDIAGPU:      *nvidiaGPUs(info),
 		v1alpha1.ResourceAMDGPU:         *amdGPUs(info),
 		v1alpha1.ResourceAliyunENI:      *aliyunENIs(info),
@@ -227,30 +263,93 @@ func computeCapacity(ctx context.Context,
 	return resourceList
 }
 
+// reservedResources returns the cpu, memory and ephemeral-storage reserved by the kubelet, the pid reservation
+// and the values that can't be parsed don't take any node resources
+func reservedResources(reserved map[string]string) corev1.ResourceList {
+	resourceList := corev1.ResourceList{}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage} {
+		v, ok := reserved[string(name)]
+		if !ok {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(v)
+		if err != nil {
+			continue
+		}
+		resourceList[name] = quantity
+	}
+	return resourceList
+}
+
+// evictionThreshold returns the memory and ephemeral-storage kept free by the kubelet eviction thresholds,
+// the larger of the hard and soft threshold is used for each signal
+func evictionThreshold(capacity corev1.ResourceList, evictionHard, evictionSoft map[string]string) corev1.ResourceList {
+	signals := map[string]corev1.ResourceName{
+		"memory.available": corev1.ResourceMemory,
+		"nodefs.available": corev1.ResourceEphemeralStorage,
+	}
+
+	threshold := corev1.ResourceList{}
+	for _, eviction := range []map[string]string{evictionHard, evictionSoft} {
+		for signal, name := range signals {
+			v, ok := eviction[signal]
+			if !ok {
+				continue
+			}
+			quantity, err := computeEvictionSignal(capacity[name], v)
+			if err != nil {
+				continue
+			}
+			if current, ok := threshold[name]; !ok || quantity.Cmp(current) > 0 {
+				threshold[name] = quantity
+			}
+		}
+	}
+	return threshold
+}
+
+// overReservedResource returns the resource whose overhead leaves nothing allocatable on the instance type
+func overReservedResource(it *cloudprovider.InstanceType) (corev1.ResourceName, bool) {
+	overhead := it.Overhead.Total()
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage} {
+		reserved, ok := overhead[name]
+		if !ok {
+			continue
+		}
+		if capacity := it.Capacity[name]; reserved.Cmp(capacity) >= 0 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
 // computeEvictionSignal computes the resource quantity value for an eviction signal value, computed off the
 // base capacity value if the signal value is a percentage or as a resource quantity if the signal value isn't a percentage
-func computeEvictionSignal(capacity resource.Quantity, signalValue string) resource.Quantity {
+func computeEvictionSignal(capacity resource.Quantity, signalValue string) (resource.Quantity, error) {
 	if strings.HasSuffix(signalValue, "%") {
-		p := mustParsePercentage(signalValue)
+		p, err := parsePercentage(signalValue)
+		if err != nil {
+			return resource.Quantity{}, err
+		}
 
 		// Calculation is node.capacity * signalValue if percentage
 		// From https://kubernetes.io/docs/concepts/scheduling-eviction/node-pressure-eviction/#eviction-signals
-		return resource.MustParse(fmt.Sprint(math.Ceil(capacity.AsApproximateFloat64() / 100 * p)))
+		return resource.MustParse(fmt.Sprint(math.Ceil(capacity.AsApproximateFloat64() / 100 * p))), nil
 	}
-	return resource.MustParse(signalValue)
+	return resource.ParseQuantity(signalValue)
 }
 
-func mustParsePercentage(v string) float64 {
+func parsePercentage(v string) (float64, error) {
 	p, err := strconv.ParseFloat(strings.Trim(v, "%"), 64)
 	if err != nil {
-		panic(fmt.Sprintf("expected percentage value to be a float but got %s, %v", v, err))
+		return 0, fmt.Errorf("expected percentage value to be a float but got %s, %w", v, err)
 	}
 	// Setting percentage value to 100% is considered disabling the threshold according to
 	// https://kubernetes.io/docs/reference/config-api/kubelet-config.v1beta1/
 	if p == 100 {
 		p = 0
 	}
-	return p
+	return p, nil
 }
 
 func cpu(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType) *resource.Quantity {
@@ -272,21 +371,12 @@ func memory(ctx context.Context, info *ecsclient.DescribeInstanceTypesResponseBo
 	return mem
 }
 
-func pods(_ context.Context,
+func pods(ctx context.Context,
 	info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType,
-	maxPods *int32, podsPerCore *int32, clusterCNI string) *resource.Quantity {
-	var count int64
-	switch {
-	case maxPods != nil:
+	maxPods *int32, podsPerCore *int32, terway *v1alpha1.TerwayConfiguration, clusterCNI string) *resource.Quantity {
+	count := MaxPods(ctx, info, clusterCNI, terway)
+	if maxPods != nil {
 		count = int64(lo.FromPtr(maxPods))
-	// TODO: support other network type, please check https://help.aliyun.com/zh/ack/ack-managed-and-ack-dedicated/user-guide/container-network/?spm=a2c4g.11186623.help-menu-85222.d_2_4_3.6d501109uQI315&scm=20140722.H_195424._.OR_help-V_1
-	case clusterCNI == cluster.ClusterCNITypeTerway:
-		maxENIPods := (tea.Int32Value(info.EniQuantity) - 1) * tea.Int32Value(info.EniPrivateIpAddressQuantity)
-		count = int64(maxENIPods + BaseHostNetworkPods)
-	case clusterCNI == cluster.ClusterCNITypeFlannel:
-		count = FlannelDefaultPods
-	default:
-		count = v1alpha1.KubeletMaxPods
 	}
 	if lo.FromPtr(podsPerCore) > 0 {
 		count = lo.Min([]int64{int64(lo.FromPtr(podsPerCore) * lo.FromPtr(info.CpuCoreCount)), count})
@@ -295,12 +385,27 @@ func pods(_ context.Context,
 	return resources.Quantity(fmt.Sprint(count))
 }
 
-func nvidiaGPUs(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType) *resource.Quantity {
-	if strings.ToLower(getGPUManufacturer(*info.GPUSpec)) == "nvidia" {
-		return resources.Quantity(fmt.Sprint(*info.GPUAmount))
+// MaxPods returns the number of pods the instance type can run with the CNI of the cluster. With Terway, every pod
+// takes a private IP of the secondary ENIs configured for Terway and the host network pods don't take any. With Flannel,
+// the pods get their IPs from the pod CIDR of the node, so the count is the flannel-max-pods option.
+func MaxPods(ctx context.Context, info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType, cniMode string,
+	terway *v1alpha1.TerwayConfiguration) int64 {
+	switch cniMode {
+	// TODO: support other network type, please check https://help.aliyun.com/zh/ack/ack-managed-and-ack-dedicated/user-guide/container-network/?spm=a2c4g.11186623.help-menu-85222.d_2_4_3.6d501109uQI315&scm=20140722.H_195424._.OR_help-V_1
+	case cluster.ClusterCNITypeTerway:
+		return terwayPodIPs(info, terway) + BaseHostNetworkPods
+	case cluster.ClusterCNITypeFlannel:
+		if o := options.FromContext(ctx); o != nil && o.FlannelMaxPods > 0 {
+			return int64(o.FlannelMaxPods)
+		}
+		return FlannelDefaultPods
+	default:
+		return v1alpha1.KubeletMaxPods
 	}
+}
 
-	return resources.Quantity("0")
+func nvidiaGPUs(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType) *resource.Quantity {
+	return gpus(info, "nvidia")
 }
 
 func aliyunENIs(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType) *resource.Quantity {
@@ -309,8 +414,14 @@ func aliyunENIs(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesIn
 }
 
 func amdGPUs(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType) *resource.Quantity {
-	if strings.ToLower(getGPUManufacturer(*info.GPUSpec)) == "amd" {
-		return resources.Quantity(fmt.Sprint(*info.GPUAmount))
+	return gpus(info, "amd")
+}
+
+// gpus returns the GPU count of the instance type if its GPUs are made by the manufacturer, CPU-only
+// instance types don't report GPUSpec or GPUAmount so they always advertise zero
+func gpus(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType, manufacturer string) *resource.Quantity {
+	if tea.Int32Value(info.GPUAmount) > 0 && strings.ToLower(getGPUManufacturer(tea.StringValue(info.GPUSpec))) == manufacturer {
+		return resources.Quantity(fmt.Sprint(tea.Int32Value(info.GPUAmount)))
 	}
 
 	return resources.Quantity("0")
@@ -338,6 +449,20 @@ func getCPUModel(cpuName string) string {
 	return ""
 }
 
+// getCPUManufacturer returns the vendor of the processor, e.g. the processor of ecs.g8y is "Yitian 710"
+func getCPUManufacturer(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType) string {
+	processorModel := strings.ToLower(tea.StringValue(info.PhysicalProcessorModel))
+	for _, manufacturer := range []string{v1alpha1.ECSIntelCPUModelValue, v1alpha1.ECSAMDCPUModelValue, v1alpha1.ECSYitianCPUModelValue} {
+		if strings.Contains(processorModel, strings.ToLower(manufacturer)) {
+			return strings.ToLower(manufacturer)
+		}
+	}
+	if yitianInstanceFamilies.Has(utils.InstanceFamily(tea.StringValue(info.InstanceTypeId))) {
+		return strings.ToLower(v1alpha1.ECSYitianCPUModelValue)
+	}
+	return ""
+}
+
 func ephemeralStorage(systemDisk *v1alpha1.SystemDisk) *resource.Quantity {
 	if systemDisk == nil || systemDisk.VolumeSize == nil {
 		return imagefamily.DefaultSystemDisk.VolumeSize
@@ -350,6 +475,37 @@ func privateIPv4Address(info *ecsclient.DescribeInstanceTypesResponseBodyInstanc
 	return resources.Quantity(fmt.Sprint(*info.EniPrivateIpAddressQuantity * (*info.EniQuantity)))
 }
 
+// terwayPodIPs returns the number of pod IPs of the instance type with Terway, the pods get the private IPv4 addresses
+// of the secondary ENIs, the primary ENI is kept for the node. The ENI count of the Terway configuration caps the
+// secondary ENIs, and the trunk ENI takes one of them, the pods with dedicated ENIs get its member ENIs instead.
+func terwayPodIPs(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType, terway *v1alpha1.TerwayConfiguration) int64 {
+	enis := max(tea.Int32Value(info.EniQuantity)-1, 0)
+	if terway != nil && terway.ENICount != nil {
+		enis = min(enis, *terway.ENICount)
+	}
+	if terway != nil && terway.ENITrunking {
+		enis = max(enis-1, 0)
+	}
+	return int64(enis) * int64(tea.Int32Value(info.EniPrivateIpAddressQuantity))
+}
+
+// validateTerway returns an error when the instance type can't run the Terway configuration, it has fewer secondary
+// ENIs than the ENI count or it doesn't support trunk ENIs
+func validateTerway(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType, terway *v1alpha1.TerwayConfiguration) error {
+	if terway == nil {
+		return nil
+	}
+	if secondaryENIs := tea.Int32Value(info.EniQuantity) - 1; terway.ENICount != nil && secondaryENIs < *terway.ENICount {
+		return fmt.Errorf("instance type %s has %d secondary ENIs, fewer than the ENI count %d",
+			tea.StringValue(info.InstanceTypeId), max(secondaryENIs, 0), *terway.ENICount)
+	}
+	if terway.ENITrunking && !tea.BoolValue(info.EniTrunkSupported) {
+		return fmt.Errorf("instance type %s doesn't support trunk ENIs", tea.StringValue(info.InstanceTypeId))
+	}
+	return nil
+}
+
+// getInstanceBandwidth returns the max internal bandwidth of the instance type in Kbit/s
 func getInstanceBandwidth(info *ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType) int32 {
 	return max(lo.FromPtr(info.InstanceBandwidthRx), lo.FromPtr(info.InstanceBandwidthTx))
 }
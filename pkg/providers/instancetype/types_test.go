@@ -0,0 +1,320 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"context"
+	"testing"
+
+	ecsclient "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+	"sigs.k8s.io/karpenter/pkg/cloudprovider"
+	"sigs.k8s.io/karpenter/pkg/scheduling"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/cluster"
+)
+
+var testOfferings = cloudprovider.Offerings{
+	{
+		Requirements: scheduling.NewRequirements(
+			scheduling.NewRequirement(karpv1.CapacityTypeLabelKey, corev1.NodeSelectorOpIn, karpv1.CapacityTypeOnDemand),
+			scheduling.NewRequirement(corev1.LabelTopologyZone, corev1.NodeSelectorOpIn, "cn-hangzhou-i"),
+			scheduling.NewRequirement(v1alpha1.LabelTopologyZoneID, corev1.NodeSelectorOpIn, "cn-hangzhou-i"),
+		),
+		Price:     1,
+		Available: true,
+	},
+}
+
+func testContext() context.Context {
+	return options.ToContext(context.Background(), &options.Options{VMMemoryOverheadPercent: 0.065})
+}
+
+func TestNewInstanceTypeGPU(t *testing.T) {
+	info := &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		InstanceTypeId:              tea.String("ecs.gn6i-c4g1.xlarge"),
+		CpuArchitecture:             tea.String("X86"),
+		CpuCoreCount:                tea.Int32(4),
+		MemorySize:                  tea.Float32(15),
+		EniQuantity:                 tea.Int32(2),
+		EniPrivateIpAddressQuantity: tea.Int32(10),
+		GPUAmount:                   tea.Int32(1),
+		GPUSpec:                     tea.String("NVIDIA T4"),
+		GPUMemorySize:               tea.Float32(16),
+	}
+	it := NewInstanceType(testContext(), info, &v1alpha1.KubeletConfiguration{}, "cn-hangzhou", nil, nil, testOfferings, cluster.ClusterCNITypeFlannel)
+
+	assert.Equal(t, int64(1), it.Capacity.Name(v1alpha1.ResourceNVIDIAGPU, "").Value())
+	assert.Equal(t, int64(0), it.Capacity.Name(v1alpha1.ResourceAMDGPU, "").Value())
+	assert.Equal(t, "nvidia-t4", it.Requirements.Get(v1alpha1.LabelInstanceGPUName).Any())
+	assert.Equal(t, "1", it.Requirements.Get(v1alpha1.LabelInstanceGPUCount).Any())
+	assert.Equal(t, "16", it.Requirements.Get(v1alpha1.LabelInstanceGPUMemory).Any())
+}
+
+func TestNewInstanceTypeCPUOnly(t *testing.T) {
+	info := &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		InstanceTypeId:              tea.String("ecs.g7.large"),
+		CpuArchitecture:             tea.String("X86"),
+		CpuCoreCount:                tea.Int32(2),
+		MemorySize:                  tea.Float32(8),
+		EniQuantity:                 tea.Int32(3),
+		EniPrivateIpAddressQuantity: tea.Int32(6),
+	}
+	it := NewInstanceType(testContext(), info, &v1alpha1.KubeletConfiguration{}, "cn-hangzhou", nil, nil, testOfferings, cluster.ClusterCNITypeFlannel)
+
+	assert.Equal(t, int64(0), it.Capacity.Name(v1alpha1.ResourceNVIDIAGPU, "").Value())
+	assert.Equal(t, int64(0), it.Capacity.Name(v1alpha1.ResourceAMDGPU, "").Value())
+	assert.Equal(t, corev1.NodeSelectorOpDoesNotExist, it.Requirements.Get(v1alpha1.LabelInstanceGPUName).Operator())
+	assert.Equal(t, corev1.NodeSelectorOpDoesNotExist, it.Requirements.Get(v1alpha1.LabelInstanceGPUMemory).Operator())
+}
+
+func TestNewInstanceTypeCPUManufacturer(t *testing.T) {
+	newInstanceType := func(instanceType, cpuArchitecture, processorModel string) *cloudprovider.InstanceType {
+		return NewInstanceType(testContext(), &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+			InstanceTypeId:              tea.String(instanceType),
+			CpuArchitecture:             lo.EmptyableToPtr(cpuArchitecture),
+			PhysicalProcessorModel:      lo.EmptyableToPtr(processorModel),
+			CpuCoreCount:                tea.Int32(2),
+			MemorySize:                  tea.Float32(8),
+			EniQuantity:                 tea.Int32(3),
+			EniPrivateIpAddressQuantity: tea.Int32(6),
+		}, &v1alpha1.KubeletConfiguration{}, "cn-hangzhou", nil, nil, testOfferings, cluster.ClusterCNITypeFlannel)
+	}
+
+	it := newInstanceType("ecs.g8y.large", "ARM", "Yitian 710")
+	assert.Equal(t, karpv1.ArchitectureArm64, it.Requirements.Get(corev1.LabelArchStable).Any())
+	assert.Equal(t, "yitian", it.Requirements.Get(v1alpha1.LabelInstanceCPUManufacturer).Any())
+	assert.Equal(t, corev1.NodeSelectorOpDoesNotExist, it.Requirements.Get(v1alpha1.LabelInstanceCPUModel).Operator())
+
+	// the Yitian families are known without the architecture and processor
+	it = newInstanceType("ecs.c8y.xlarge", "", "")
+	assert.Equal(t, karpv1.ArchitectureArm64, it.Requirements.Get(corev1.LabelArchStable).Any())
+	assert.Equal(t, "yitian", it.Requirements.Get(v1alpha1.LabelInstanceCPUManufacturer).Any())
+
+	it = newInstanceType("ecs.g8a.large", "X86", "AMD EPYC Genoa")
+	assert.Equal(t, karpv1.ArchitectureAmd64, it.Requirements.Get(corev1.LabelArchStable).Any())
+	assert.Equal(t, "amd", it.Requirements.Get(v1alpha1.LabelInstanceCPUManufacturer).Any())
+
+	it = newInstanceType("ecs.g7.large", "X86", "Intel Xeon(Ice Lake) Platinum 8369B")
+	assert.Equal(t, "intel", it.Requirements.Get(v1alpha1.LabelInstanceCPUManufacturer).Any())
+	assert.Equal(t, "intel", it.Requirements.Get(v1alpha1.LabelInstanceCPUModel).Any())
+
+	// the scheduler selects the instance types by the architecture and the manufacturer
+	reqs := scheduling.NewRequirements(
+		scheduling.NewRequirement(corev1.LabelArchStable, corev1.NodeSelectorOpIn, karpv1.ArchitectureArm64),
+		scheduling.NewRequirement(v1alpha1.LabelInstanceCPUManufacturer, corev1.NodeSelectorOpIn, "yitian"),
+	)
+	assert.NoError(t, newInstanceType("ecs.r8y.large", "ARM", "Yitian 710").Requirements.Compatible(reqs, scheduling.AllowUndefinedWellKnownLabels))
+	assert.Error(t, it.Requirements.Compatible(reqs, scheduling.AllowUndefinedWellKnownLabels))
+}
+
+func TestNewInstanceTypeLocalStorage(t *testing.T) {
+	info := &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		InstanceTypeId:              tea.String("ecs.i3.2xlarge"),
+		CpuArchitecture:             tea.String("X86"),
+		CpuCoreCount:                tea.Int32(8),
+		MemorySize:                  tea.Float32(64),
+		EniQuantity:                 tea.Int32(4),
+		EniPrivateIpAddressQuantity: tea.Int32(15),
+		LocalStorageAmount:          tea.Int32(2),
+		LocalStorageCapacity:        tea.Int64(894),
+		LocalStorageCategory:        tea.String("local_ssd_pro"),
+	}
+	it := NewInstanceType(testContext(), info, &v1alpha1.KubeletConfiguration{}, "cn-hangzhou", nil, nil, testOfferings, cluster.ClusterCNITypeFlannel)
+	assert.Equal(t, "1788", it.Requirements.Get(v1alpha1.LabelInstanceLocalStorage).Any())
+	assert.Equal(t, "local_ssd_pro", it.Requirements.Get(v1alpha1.LabelInstanceLocalStorageCategory).Any())
+
+	// regular instance types report no local disk
+	info = &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		InstanceTypeId:              tea.String("ecs.g7.large"),
+		CpuArchitecture:             tea.String("X86"),
+		CpuCoreCount:                tea.Int32(2),
+		MemorySize:                  tea.Float32(8),
+		EniQuantity:                 tea.Int32(3),
+		EniPrivateIpAddressQuantity: tea.Int32(6),
+		LocalStorageAmount:          tea.Int32(0),
+		LocalStorageCapacity:        tea.Int64(0),
+	}
+	it = NewInstanceType(testContext(), info, &v1alpha1.KubeletConfiguration{}, "cn-hangzhou", nil, nil, testOfferings, cluster.ClusterCNITypeFlannel)
+	assert.Equal(t, corev1.NodeSelectorOpDoesNotExist, it.Requirements.Get(v1alpha1.LabelInstanceLocalStorage).Operator())
+	assert.Equal(t, corev1.NodeSelectorOpDoesNotExist, it.Requirements.Get(v1alpha1.LabelInstanceLocalStorageCategory).Operator())
+}
+
+func TestNewInstanceTypeNetwork(t *testing.T) {
+	info := &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		InstanceTypeId:              tea.String("ecs.g7.large"),
+		CpuArchitecture:             tea.String("X86"),
+		CpuCoreCount:                tea.Int32(2),
+		MemorySize:                  tea.Float32(8),
+		EniQuantity:                 tea.Int32(3),
+		EniPrivateIpAddressQuantity: tea.Int32(6),
+		InstanceBandwidthRx:         tea.Int32(2048000),
+		InstanceBandwidthTx:         tea.Int32(2048000),
+	}
+	it := NewInstanceType(testContext(), info, &v1alpha1.KubeletConfiguration{}, "cn-hangzhou", nil, nil, testOfferings, cluster.ClusterCNITypeTerway)
+
+	assert.Equal(t, "3", it.Requirements.Get(v1alpha1.LabelInstanceENICount).Any())
+	assert.Equal(t, "6", it.Requirements.Get(v1alpha1.LabelInstanceENIPrivateIPCount).Any())
+	assert.Equal(t, "2048", it.Requirements.Get(v1alpha1.LabelInstanceNetworkBandwidth).Any())
+	// the secondary ENIs carry the pod IPs, plus the host network pods
+	assert.Equal(t, int64(2*6+BaseHostNetworkPods), it.Capacity.Pods().Value())
+
+	info.InstanceBandwidthRx, info.InstanceBandwidthTx = nil, nil
+	it = NewInstanceType(testContext(), info, &v1alpha1.KubeletConfiguration{}, "cn-hangzhou", nil, nil, testOfferings, cluster.ClusterCNITypeTerway)
+	assert.Equal(t, corev1.NodeSelectorOpDoesNotExist, it.Requirements.Get(v1alpha1.LabelInstanceNetworkBandwidth).Operator())
+}
+
+func TestMaxPods(t *testing.T) {
+	info := &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		EniQuantity:                 tea.Int32(4),
+		EniPrivateIpAddressQuantity: tea.Int32(15),
+	}
+
+	assert.Equal(t, int64(3*15+BaseHostNetworkPods), MaxPods(testContext(), info, cluster.ClusterCNITypeTerway, nil))
+	assert.Equal(t, int64(FlannelDefaultPods), MaxPods(testContext(), info, cluster.ClusterCNITypeFlannel, nil))
+	ctx := options.ToContext(context.Background(), &options.Options{FlannelMaxPods: 128})
+	assert.Equal(t, int64(128), MaxPods(ctx, info, cluster.ClusterCNITypeFlannel, nil))
+	assert.Equal(t, int64(v1alpha1.KubeletMaxPods), MaxPods(testContext(), info, "Custom", nil))
+
+	// a single ENI leaves no IPs for the pods
+	info.EniQuantity = tea.Int32(1)
+	assert.Equal(t, int64(BaseHostNetworkPods), MaxPods(testContext(), info, cluster.ClusterCNITypeTerway, nil))
+}
+
+func TestMaxPodsTerway(t *testing.T) {
+	info := &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		EniQuantity:                 tea.Int32(4),
+		EniPrivateIpAddressQuantity: tea.Int32(15),
+	}
+	cases := []struct {
+		name   string
+		terway *v1alpha1.TerwayConfiguration
+		pods   int64
+	}{
+		{name: "all the secondary ENIs", terway: &v1alpha1.TerwayConfiguration{}, pods: 3*15 + BaseHostNetworkPods},
+		{name: "ENI count", terway: &v1alpha1.TerwayConfiguration{ENICount: tea.Int32(2)}, pods: 2*15 + BaseHostNetworkPods},
+		{name: "trunk ENI", terway: &v1alpha1.TerwayConfiguration{ENITrunking: true}, pods: 2*15 + BaseHostNetworkPods},
+		{name: "trunk ENI in the ENI count", terway: &v1alpha1.TerwayConfiguration{ENITrunking: true, ENICount: tea.Int32(2)}, pods: 15 + BaseHostNetworkPods},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.pods, MaxPods(testContext(), info, cluster.ClusterCNITypeTerway, tc.terway))
+			// the Terway configuration doesn't change the pods of the other CNIs
+			assert.Equal(t, int64(FlannelDefaultPods), MaxPods(testContext(), info, cluster.ClusterCNITypeFlannel, tc.terway))
+		})
+	}
+}
+
+func TestValidateTerway(t *testing.T) {
+	info := &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		InstanceTypeId:              tea.String("ecs.g7.large"),
+		EniQuantity:                 tea.Int32(3),
+		EniPrivateIpAddressQuantity: tea.Int32(6),
+	}
+	assert.NoError(t, validateTerway(info, nil))
+	assert.NoError(t, validateTerway(info, &v1alpha1.TerwayConfiguration{ENICount: tea.Int32(2)}))
+	assert.EqualError(t, validateTerway(info, &v1alpha1.TerwayConfiguration{ENICount: tea.Int32(3)}),
+		"instance type ecs.g7.large has 2 secondary ENIs, fewer than the ENI count 3")
+	assert.EqualError(t, validateTerway(info, &v1alpha1.TerwayConfiguration{ENITrunking: true}),
+		"instance type ecs.g7.large doesn't support trunk ENIs")
+
+	info.EniTrunkSupported = tea.Bool(true)
+	assert.NoError(t, validateTerway(info, &v1alpha1.TerwayConfiguration{ENITrunking: true, ENICount: tea.Int32(2)}))
+}
+
+func TestNewInstanceTypeKubeletOverhead(t *testing.T) {
+	info := &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		InstanceTypeId:              tea.String("ecs.g7.large"),
+		CpuArchitecture:             tea.String("X86"),
+		CpuCoreCount:                tea.Int32(2),
+		MemorySize:                  tea.Float32(8),
+		EniQuantity:                 tea.Int32(3),
+		EniPrivateIpAddressQuantity: tea.Int32(6),
+	}
+	kc := &v1alpha1.KubeletConfiguration{
+		KubeReserved:   map[string]string{"memory": "1Gi"},
+		SystemReserved: map[string]string{"cpu": "100m", "pid": "1000"},
+		EvictionHard:   map[string]string{"memory.available": "200Mi"},
+		EvictionSoft:   map[string]string{"memory.available": "500Mi", "nodefs.available": "10%"},
+	}
+	it := NewInstanceType(testContext(), info, kc, "cn-hangzhou", nil, nil, testOfferings, cluster.ClusterCNITypeFlannel)
+
+	// The ACK reservation policy is kept for the cpu, the memory is overridden by the kubelet configuration
+	assert.Equal(t, "70m", lo.ToPtr(it.Overhead.KubeReserved[corev1.ResourceCPU]).String())
+	assert.Equal(t, "1Gi", lo.ToPtr(it.Overhead.KubeReserved[corev1.ResourceMemory]).String())
+	assert.Equal(t, corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}, it.Overhead.SystemReserved)
+	assert.Equal(t, "500Mi", lo.ToPtr(it.Overhead.EvictionThreshold[corev1.ResourceMemory]).String())
+	assert.Equal(t, int64(2*1024*1024*1024), lo.ToPtr(it.Overhead.EvictionThreshold[corev1.ResourceEphemeralStorage]).Value())
+}
+
+func TestNewInstanceTypeOverReserved(t *testing.T) {
+	info := &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		InstanceTypeId:              tea.String("ecs.g7.large"),
+		CpuArchitecture:             tea.String("X86"),
+		CpuCoreCount:                tea.Int32(2),
+		MemorySize:                  tea.Float32(8),
+		EniQuantity:                 tea.Int32(3),
+		EniPrivateIpAddressQuantity: tea.Int32(6),
+	}
+
+	for name, kc := range map[string]*v1alpha1.KubeletConfiguration{
+		"cpu":               {KubeReserved: map[string]string{"cpu": "1"}, SystemReserved: map[string]string{"cpu": "1"}},
+		"memory":            {SystemReserved: map[string]string{"memory": "8Gi"}},
+		"ephemeral-storage": {EvictionHard: map[string]string{"nodefs.available": "10Gi"}, KubeReserved: map[string]string{"ephemeral-storage": "100Gi"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, NewInstanceType(testContext(), info, kc, "cn-hangzhou", nil, nil, testOfferings, cluster.ClusterCNITypeFlannel))
+		})
+	}
+}
+
+func TestMaxPodsPrecedence(t *testing.T) {
+	info := &ecsclient.DescribeInstanceTypesResponseBodyInstanceTypesInstanceType{
+		EniQuantity:                 tea.Int32(4),
+		EniPrivateIpAddressQuantity: tea.Int32(15),
+		CpuCoreCount:                tea.Int32(4),
+	}
+	cases := []struct {
+		name                 string
+		kubeletConfiguration *v1alpha1.KubeletConfiguration
+		defaultMaxPods       *int32
+		pods                 int64
+	}{
+		{name: "cni default", pods: 3*15 + BaseHostNetworkPods},
+		{name: "node class default", defaultMaxPods: tea.Int32(64), pods: 64},
+		{name: "node class default with another kubelet configuration", kubeletConfiguration: &v1alpha1.KubeletConfiguration{PodsPerCore: tea.Int32(20)}, defaultMaxPods: tea.Int32(64), pods: 64},
+		{name: "kubelet max pods", kubeletConfiguration: &v1alpha1.KubeletConfiguration{MaxPods: tea.Int32(32)}, defaultMaxPods: tea.Int32(64), pods: 32},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{KubeletConfiguration: tc.kubeletConfiguration, DefaultMaxPods: tc.defaultMaxPods}}
+			kc := lo.FromPtr(nodeClass.ResolvedKubeletConfiguration())
+			assert.Equal(t, tc.pods, pods(testContext(), info, kc.MaxPods, kc.PodsPerCore, nodeClass.Spec.Terway, cluster.ClusterCNITypeTerway).Value())
+		})
+	}
+
+	// the bootstrap configuration of a node class default is the one of an explicit kubelet max pods
+	nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{DefaultMaxPods: tea.Int32(64)}}
+	explicit := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{KubeletConfiguration: &v1alpha1.KubeletConfiguration{MaxPods: tea.Int32(64)}}}
+	assert.Equal(t, explicit.UserDataHash(), nodeClass.UserDataHash())
+	assert.Nil(t, nodeClass.Spec.KubeletConfiguration)
+}
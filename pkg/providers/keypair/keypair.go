@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keypair
+
+import (
+	"context"
+	"fmt"
+
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
+)
+
+type Provider interface {
+	Exists(context.Context, string) (bool, error)
+}
+
+type DefaultProvider struct {
+	region      string
+	ecsapi      client.ECSClient
+	rateLimiter *ratelimit.RateLimiter
+	cache       *cache.Cache
+}
+
+func NewDefaultProvider(region string, ecsapi client.ECSClient, rateLimiter *ratelimit.RateLimiter, cache *cache.Cache) *DefaultProvider {
+	return &DefaultProvider{
+		region:      region,
+		ecsapi:      ecsapi,
+		rateLimiter: rateLimiter,
+		cache:       cache,
+	}
+}
+
+// Exists returns whether the key pair exists in the region, the instances fail to launch with a key pair which doesn't
+func (p *DefaultProvider) Exists(ctx context.Context, keyPairName string) (bool, error) {
+	if exists, ok := p.cache.Get(keyPairName); ok {
+		return exists.(bool), nil
+	}
+	output, err := ratelimit.CallIdempotent(ctx, p.rateLimiter, "DescribeKeyPairs", func() (*ecs.DescribeKeyPairsResponse, error) {
+		return p.ecsapi.DescribeKeyPairsWithOptions(&ecs.DescribeKeyPairsRequest{
+			RegionId:    tea.String(p.region),
+			KeyPairName: tea.String(keyPairName),
+			PageSize:    tea.Int32(50),
+		}, &util.RuntimeOptions{})
+	})
+	if err != nil {
+		return false, fmt.Errorf("describing key pair %s, %w", keyPairName, err)
+	} else if output == nil || output.Body == nil {
+		return false, fmt.Errorf("unexpected null value was returned")
+	} else if output.Body.KeyPairs == nil {
+		return false, alierrors.WithRequestID(tea.StringValue(output.Body.RequestId), fmt.Errorf("unexpected null value was returned"))
+	}
+
+	// The name filter matches the key pairs with wildcards too, only the exact name counts
+	exists := lo.ContainsBy(output.Body.KeyPairs.KeyPair, func(keyPair *ecs.DescribeKeyPairsResponseBodyKeyPairsKeyPair) bool {
+		return keyPair != nil && tea.StringValue(keyPair.KeyPairName) == keyPairName
+	})
+	p.cache.SetDefault(keyPairName, exists)
+	return exists, nil
+}
@@ -30,9 +30,15 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/karpenter/pkg/utils/pretty"
 
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
 	utilsobject "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/object"
 )
 
+// initialOnDemandPricesData is a snapshot of the on-demand prices of all regions which seeds the provider
+// until the first pricing update succeeds, regenerate it with `go generate` or `make codegen`
+//
+//go:generate go run ../../../hack/tools/price_gen -output initial-on-demand-prices.json
 //go:embed initial-on-demand-prices.json
 var initialOnDemandPricesData []byte
 
@@ -45,6 +51,15 @@ type Provider interface {
 	SpotPrice(string, string) (float64, bool)
 	UpdateOnDemandPricing(context.Context) error
 	UpdateSpotPricing(context.Context) error
+	// SetCommittedUseUsage sets the number of running on-demand instances per instance family, the committed use
+	// discount of a family only applies while they don't exceed the instances it covers
+	SetCommittedUseUsage(map[string]int)
+	// LastUpdated returns the time of the last successful sync of the pricing data, the zero time means
+	// that only the static initial pricing data is in use
+	LastUpdated() time.Time
+	// SyncedAtLeastOnce returns whether both the on-demand and the spot prices have been updated from the pricing
+	// endpoint, rather than only the static initial pricing data being in use
+	SyncedAtLeastOnce() bool
 }
 
 // DefaultProvider provides actual pricing data to the AlibabaCloud provider to allow it to make more informed decisions
@@ -56,17 +71,28 @@ type Provider interface {
 type DefaultProvider struct {
 	muPriceLastUpdatedTimestamp sync.RWMutex
 	priceLastUpdatedTimestamp   time.Time
-	alibabaCloudPriceClient     tools.QueryClientInterface
 
-	region string
-	cm     *pretty.ChangeMonitor
+	muPriceClient           sync.Mutex
+	alibabaCloudPriceClient tools.QueryClientInterface
 
-	muOnDemand     sync.RWMutex
-	onDemandPrices map[string]float64
+	region   string
+	endpoint string
+	cm       *pretty.ChangeMonitor
+
+	muOnDemand             sync.RWMutex
+	onDemandPrices         map[string]float64
+	onDemandPricingUpdated bool
 
 	muSpot             sync.RWMutex
 	spotPrices         map[string]zonal
 	spotPricingUpdated bool
+
+	// committedUseCoverage is the number of instances covered by reserved instances or savings plans per
+	// instance family, it's empty unless the committed-use pricing mode is enabled
+	muCommittedUse       sync.RWMutex
+	committedUseCoverage map[string]int
+	committedUseUsage    map[string]int
+	committedUseDiscount float64
 }
 
 // zonalPricing is used to capture the per-zone price
@@ -94,23 +120,67 @@ const (
 )
 
 func NewDefaultProvider(ctx context.Context, region string) (*DefaultProvider, error) {
-	queryClient, err := tools.NewQueryClient(defaultPriceQueryEndpoint, tools.AlibabaCloudProvider, region)
-	if err != nil {
-		log.FromContext(ctx).Error(err, "unable to create query client")
-		return nil, err
-	}
 	p := &DefaultProvider{
-		region:                  region,
-		alibabaCloudPriceClient: queryClient,
+		region:   region,
+		endpoint: defaultPriceQueryEndpoint,
 
 		cm: pretty.NewChangeMonitor(),
 	}
+	if o := options.FromContext(ctx); o != nil {
+		if o.PricingEndpoint != "" {
+			p.endpoint = o.PricingEndpoint
+		}
+		if o.PricingMode == options.PricingModeCommittedUse {
+			coverage, err := options.ParseCommittedUseCoverage(o.CommittedUseCoverage)
+			if err != nil {
+				return nil, fmt.Errorf("parsing committed use coverage, %w", err)
+			}
+			p.committedUseCoverage = coverage
+			p.committedUseDiscount = o.CommittedUseDiscount
+		}
+	}
 	// sets the pricing data from the static default state for the provider
 	p.Reset()
 
+	// The pricing endpoint being unavailable at startup must not block scheduling, fall back to the static
+	// pricing data and retry creating the query client on the next pricing update
+	if _, err := p.priceClient(); err != nil {
+		log.FromContext(ctx).Error(err, "unable to create query client, falling back to the static pricing data")
+	}
+
 	return p, nil
 }
 
+// priceClient returns the query client of the pricing endpoint, creating it if it's not created yet
+func (p *DefaultProvider) priceClient() (tools.QueryClientInterface, error) {
+	p.muPriceClient.Lock()
+	defer p.muPriceClient.Unlock()
+
+	if p.alibabaCloudPriceClient != nil {
+		return p.alibabaCloudPriceClient, nil
+	}
+	queryClient, err := tools.NewQueryClient(p.endpoint, tools.AlibabaCloudProvider, p.region)
+	if err != nil {
+		return nil, err
+	}
+	p.alibabaCloudPriceClient = queryClient
+	return queryClient, nil
+}
+
+func (p *DefaultProvider) LastUpdated() time.Time {
+	p.muPriceLastUpdatedTimestamp.RLock()
+	defer p.muPriceLastUpdatedTimestamp.RUnlock()
+	return p.priceLastUpdatedTimestamp
+}
+
+func (p *DefaultProvider) SyncedAtLeastOnce() bool {
+	p.muOnDemand.RLock()
+	defer p.muOnDemand.RUnlock()
+	p.muSpot.RLock()
+	defer p.muSpot.RUnlock()
+	return p.onDemandPricingUpdated && p.spotPricingUpdated
+}
+
 // InstanceTypes returns the list of all instance types for which either a spot or on-demand price is known.
 func (p *DefaultProvider) InstanceTypes() []string {
 	p.muOnDemand.RLock()
@@ -129,7 +199,26 @@ func (p *DefaultProvider) OnDemandPrice(instanceType string) (float64, bool) {
 	if !ok {
 		return 0.0, false
 	}
-	return price, true
+	return p.committedUsePrice(instanceType, price), true
+}
+
+// committedUsePrice returns the effective on-demand price of the instance type, the price of an instance family covered
+// by committed use is discounted as long as its running instances don't exceed the covered ones. The running instances
+// being equal to the covered ones keeps the discount, so the covered instances are not consolidated into others.
+func (p *DefaultProvider) committedUsePrice(instanceType string, price float64) float64 {
+	p.muCommittedUse.RLock()
+	defer p.muCommittedUse.RUnlock()
+	family := utils.InstanceFamily(instanceType)
+	if covered, ok := p.committedUseCoverage[family]; ok && p.committedUseUsage[family] <= covered {
+		return price * (1 - p.committedUseDiscount)
+	}
+	return price
+}
+
+func (p *DefaultProvider) SetCommittedUseUsage(usage map[string]int) {
+	p.muCommittedUse.Lock()
+	defer p.muCommittedUse.Unlock()
+	p.committedUseUsage = usage
 }
 
 // SpotPrice returns the last known spot price for a given instance type and zone, returning an error
@@ -182,14 +271,16 @@ func (p *DefaultProvider) Reset() {
 	// default our spot pricing to the same as the on-demand pricing until a price update
 	p.spotPrices = populateInitialSpotPricing(staticPricing)
 	p.spotPricingUpdated = false
+	p.onDemandPricingUpdated = false
 }
 
 func (p *DefaultProvider) UpdateOnDemandPricing(ctx context.Context) error {
-	if err := p.syncPricingData(ctx); err != nil {
+	priceClient, err := p.syncPricingData(ctx)
+	if err != nil {
 		return err
 	}
 
-	prices := p.alibabaCloudPriceClient.ListInstancesDetails(p.region)
+	prices := priceClient.ListInstancesDetails(p.region)
 	if prices == nil || len(prices.InstanceTypePrices) == 0 {
 		err := fmt.Errorf("no price info available for region %s", p.region)
 		log.FromContext(ctx).Error(err, "failed to get on-demand pricing data from alibaba cloud")
@@ -201,15 +292,17 @@ func (p *DefaultProvider) UpdateOnDemandPricing(ctx context.Context) error {
 	p.onDemandPrices = lo.MapEntries(prices.InstanceTypePrices, func(key string, value *apis.InstanceTypePrice) (string, float64) {
 		return key, value.OnDemandPricePerHour
 	})
+	p.onDemandPricingUpdated = true
 
 	return nil
 }
 func (p *DefaultProvider) UpdateSpotPricing(ctx context.Context) error {
-	if err := p.syncPricingData(ctx); err != nil {
+	priceClient, err := p.syncPricingData(ctx)
+	if err != nil {
 		return err
 	}
 
-	prices := p.alibabaCloudPriceClient.ListInstancesDetails(p.region)
+	prices := priceClient.ListInstancesDetails(p.region)
 	if prices == nil || len(prices.InstanceTypePrices) == 0 {
 		err := fmt.Errorf("no price info available for region %s", p.region)
 		log.FromContext(ctx).Error(err, "failed to get spot pricing data from alibaba cloud")
@@ -239,20 +332,26 @@ func (p *DefaultProvider) UpdateSpotPricing(ctx context.Context) error {
 	return nil
 }
 
-func (p *DefaultProvider) syncPricingData(ctx context.Context) error {
+func (p *DefaultProvider) syncPricingData(ctx context.Context) (tools.QueryClientInterface, error) {
+	priceClient, err := p.priceClient()
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to create query client for pricing data")
+		return nil, err
+	}
+
 	p.muPriceLastUpdatedTimestamp.Lock()
 	lastUpdatedTime := p.priceLastUpdatedTimestamp
 	p.muPriceLastUpdatedTimestamp.Unlock()
 
 	if lastUpdatedTime.Add(time.Minute * 5).Before(time.Now()) {
-		if err := p.alibabaCloudPriceClient.Sync(); err != nil {
+		if err := priceClient.Sync(); err != nil {
 			log.FromContext(ctx).Error(err, "failed to sync pricing data from alibaba cloud")
-			return err
+			return nil, err
 		}
 		p.muPriceLastUpdatedTimestamp.Lock()
 		p.priceLastUpdatedTimestamp = time.Now()
 		p.muPriceLastUpdatedTimestamp.Unlock()
 	}
 
-	return nil
+	return priceClient, nil
 }
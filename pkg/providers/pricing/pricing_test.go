@@ -18,8 +18,10 @@ package pricing
 
 import (
 	"context"
+	"sort"
 	"testing"
 
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -66,3 +68,31 @@ func TestNewDefaultProvider(t *testing.T) {
 		})
 	}
 }
+
+func TestCommittedUsePrice(t *testing.T) {
+	p := &DefaultProvider{onDemandPrices: map[string]float64{
+		"ecs.g7.large":  0.5,
+		"ecs.g8i.large": 0.4,
+		"ecs.c7.large":  0.45,
+	}}
+	ranked := func() []string {
+		instanceTypes := lo.Keys(p.onDemandPrices)
+		sort.Slice(instanceTypes, func(i, j int) bool {
+			pi, _ := p.OnDemandPrice(instanceTypes[i])
+			pj, _ := p.OnDemandPrice(instanceTypes[j])
+			return pi < pj
+		})
+		return instanceTypes
+	}
+
+	assert.Equal(t, []string{"ecs.g8i.large", "ecs.c7.large", "ecs.g7.large"}, ranked())
+
+	// the covered family is the cheapest until its committed instances are used up
+	p.committedUseCoverage = map[string]int{"ecs.g7": 2}
+	p.committedUseDiscount = 0.5
+	assert.Equal(t, []string{"ecs.g7.large", "ecs.g8i.large", "ecs.c7.large"}, ranked())
+	p.SetCommittedUseUsage(map[string]int{"ecs.g7": 2})
+	assert.Equal(t, []string{"ecs.g7.large", "ecs.g8i.large", "ecs.c7.large"}, ranked())
+	p.SetCommittedUseUsage(map[string]int{"ecs.g7": 3})
+	assert.Equal(t, []string{"ecs.g8i.large", "ecs.c7.large", "ecs.g7.large"}, ranked())
+}
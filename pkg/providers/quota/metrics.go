@@ -0,0 +1,52 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	opmetrics "github.com/awslabs/operatorpkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/karpenter/pkg/metrics"
+)
+
+const (
+	subsystem         = "alibabacloud"
+	capacityTypeLabel = "capacity_type"
+)
+
+var (
+	VCPUQuota = opmetrics.NewPrometheusGauge(
+		crmetrics.Registry,
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "vcpu_quota",
+			Help:      "The vCPU quota of the ECS instances in the region, labeled by the capacity type.",
+		},
+		[]string{capacityTypeLabel},
+	)
+	VCPUQuotaHeadroom = opmetrics.NewPrometheusGauge(
+		crmetrics.Registry,
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "vcpu_quota_headroom",
+			Help:      "The vCPUs left in the quota of the ECS instances in the region, labeled by the capacity type.",
+		},
+		[]string{capacityTypeLabel},
+	)
+)
@@ -0,0 +1,156 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
+)
+
+// The account attributes of the vCPU quotas, ECS enforces the quotas on the vCPUs of the pay-as-you-go and the spot
+// instances of the region, the number of instances isn't limited by a quota of its own
+const (
+	attributeMaxOnDemandVCPUs  = "max-postpaid-instance-vcpu-count"
+	attributeUsedOnDemandVCPUs = "used-postpaid-instance-vcpu-count"
+	attributeMaxSpotVCPUs      = "max-spot-instance-vcpu-count"
+	attributeUsedSpotVCPUs     = "used-spot-instance-vcpu-count"
+)
+
+// Quota is the vCPU quota of the account in the region and the vCPUs used of it, keyed by capacity type
+type Quota struct {
+	VCPULimits map[string]int64
+	VCPUUsage  map[string]int64
+}
+
+// Headroom returns the vCPUs left in the quota of the capacity type, it's false when the quota is unknown
+func (q *Quota) Headroom(capacityType string) (int64, bool) {
+	limit, ok := q.VCPULimits[capacityType]
+	if !ok {
+		return 0, false
+	}
+	return max(limit-q.VCPUUsage[capacityType], 0), true
+}
+
+// NearLimit returns the capacity types whose used vCPUs reach the fraction of their quota
+func (q *Quota) NearLimit(threshold float64) []string {
+	return lo.Filter([]string{karpv1.CapacityTypeOnDemand, karpv1.CapacityTypeSpot}, func(capacityType string, _ int) bool {
+		limit, ok := q.VCPULimits[capacityType]
+		return ok && float64(q.VCPUUsage[capacityType]) >= threshold*float64(limit)
+	})
+}
+
+type Provider interface {
+	// Get returns the vCPU quota of the account in the region
+	Get(context.Context) (*Quota, error)
+}
+
+type DefaultProvider struct {
+	sync.Mutex
+	region      string
+	ecsapi      client.ECSClient
+	rateLimiter *ratelimit.RateLimiter
+	cache       *cache.Cache
+}
+
+func NewDefaultProvider(region string, ecsapi client.ECSClient, rateLimiter *ratelimit.RateLimiter, cache *cache.Cache) *DefaultProvider {
+	return &DefaultProvider{
+		region:      region,
+		ecsapi:      ecsapi,
+		rateLimiter: rateLimiter,
+		cache:       cache,
+	}
+}
+
+// Get returns the vCPU quota of the account in the region, the quota and its usage are described once and cached.
+// A failure is cached as well, e.g. the RAM identity isn't allowed ecs:DescribeAccountAttributes, so the launches
+// don't describe the quota again until the cache expires.
+func (p *DefaultProvider) Get(ctx context.Context) (*Quota, error) {
+	// The lock keeps the concurrent callers from describing the quota more than once
+	p.Lock()
+	defer p.Unlock()
+
+	if item, ok := p.cache.Get(p.region); ok {
+		if err, ok := item.(error); ok {
+			return nil, err
+		}
+		return item.(*Quota), nil
+	}
+	quota, err := p.describe(ctx)
+	if err != nil {
+		p.cache.SetDefault(p.region, err)
+		return nil, err
+	}
+	p.cache.SetDefault(p.region, quota)
+	return quota, nil
+}
+
+func (p *DefaultProvider) describe(ctx context.Context) (*Quota, error) {
+	output, err := ratelimit.CallIdempotent(ctx, p.rateLimiter, "DescribeAccountAttributes", func() (*ecs.DescribeAccountAttributesResponse, error) {
+		return p.ecsapi.DescribeAccountAttributesWithOptions(&ecs.DescribeAccountAttributesRequest{
+			RegionId:      tea.String(p.region),
+			AttributeName: tea.StringSlice([]string{attributeMaxOnDemandVCPUs, attributeUsedOnDemandVCPUs, attributeMaxSpotVCPUs, attributeUsedSpotVCPUs}),
+		}, &util.RuntimeOptions{})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing account attributes, %w", err)
+	} else if output == nil || output.Body == nil {
+		return nil, fmt.Errorf("unexpected null value was returned")
+	} else if output.Body.AccountAttributeItems == nil {
+		return nil, alierrors.WithRequestID(tea.StringValue(output.Body.RequestId), fmt.Errorf("unexpected null value was returned"))
+	}
+
+	attributes := map[string]int64{}
+	for _, item := range lo.Compact(output.Body.AccountAttributeItems.AccountAttributeItem) {
+		if item.AttributeValues == nil || len(item.AttributeValues.ValueItem) == 0 || item.AttributeValues.ValueItem[0] == nil {
+			continue
+		}
+		value, err := strconv.ParseInt(tea.StringValue(item.AttributeValues.ValueItem[0].Value), 10, 64)
+		if err != nil {
+			return nil, alierrors.WithRequestID(tea.StringValue(output.Body.RequestId), fmt.Errorf("parsing account attribute %s, %w", tea.StringValue(item.AttributeName), err))
+		}
+		attributes[tea.StringValue(item.AttributeName)] = value
+	}
+	quota := &Quota{VCPULimits: map[string]int64{}, VCPUUsage: map[string]int64{}}
+	for capacityType, names := range map[string][2]string{
+		karpv1.CapacityTypeOnDemand: {attributeMaxOnDemandVCPUs, attributeUsedOnDemandVCPUs},
+		karpv1.CapacityTypeSpot:     {attributeMaxSpotVCPUs, attributeUsedSpotVCPUs},
+	} {
+		limit, ok := attributes[names[0]]
+		if !ok {
+			continue
+		}
+		quota.VCPULimits[capacityType] = limit
+		quota.VCPUUsage[capacityType] = attributes[names[1]]
+		headroom, _ := quota.Headroom(capacityType)
+		VCPUQuota.Set(float64(limit), map[string]string{capacityTypeLabel: capacityType})
+		VCPUQuotaHeadroom.Set(float64(headroom), map[string]string{capacityTypeLabel: capacityType})
+	}
+	return quota, nil
+}
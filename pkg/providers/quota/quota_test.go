@@ -0,0 +1,130 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/fake"
+)
+
+func accountAttributes(attributes map[string]string) *ecs.DescribeAccountAttributesResponse {
+	return &ecs.DescribeAccountAttributesResponse{Body: &ecs.DescribeAccountAttributesResponseBody{
+		AccountAttributeItems: &ecs.DescribeAccountAttributesResponseBodyAccountAttributeItems{
+			AccountAttributeItem: lo.MapToSlice(attributes, func(name, value string) *ecs.DescribeAccountAttributesResponseBodyAccountAttributeItemsAccountAttributeItem {
+				return &ecs.DescribeAccountAttributesResponseBodyAccountAttributeItemsAccountAttributeItem{
+					AttributeName: tea.String(name),
+					AttributeValues: &ecs.DescribeAccountAttributesResponseBodyAccountAttributeItemsAccountAttributeItemAttributeValues{
+						ValueItem: []*ecs.DescribeAccountAttributesResponseBodyAccountAttributeItemsAccountAttributeItemAttributeValuesValueItem{{Value: tea.String(value)}},
+					},
+				}
+			}),
+		},
+	}}
+}
+
+func TestGet(t *testing.T) {
+	ecsAPI := fake.NewECSAPI()
+	ecsAPI.DescribeAccountAttributesBehavior.SetOutput(accountAttributes(map[string]string{
+		attributeMaxOnDemandVCPUs:  "1000",
+		attributeUsedOnDemandVCPUs: "950",
+		attributeMaxSpotVCPUs:      "500",
+		attributeUsedSpotVCPUs:     "600",
+	}))
+	p := NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute))
+
+	quota, err := p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{karpv1.CapacityTypeOnDemand: 1000, karpv1.CapacityTypeSpot: 500}, quota.VCPULimits)
+	assert.Equal(t, map[string]int64{karpv1.CapacityTypeOnDemand: 950, karpv1.CapacityTypeSpot: 600}, quota.VCPUUsage)
+	require.Equal(t, 1, ecsAPI.DescribeAccountAttributesBehavior.Calls())
+	assert.Equal(t, fake.DefaultRegion, tea.StringValue(ecsAPI.DescribeAccountAttributesBehavior.Requests()[0].RegionId))
+
+	// the headroom of a quota used beyond its limit is 0
+	headroom, ok := quota.Headroom(karpv1.CapacityTypeOnDemand)
+	assert.True(t, ok)
+	assert.Equal(t, int64(50), headroom)
+	headroom, ok = quota.Headroom(karpv1.CapacityTypeSpot)
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), headroom)
+
+	// the quota is cached
+	_, err = p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, ecsAPI.DescribeAccountAttributesBehavior.Calls())
+}
+
+func TestGetUnknownQuota(t *testing.T) {
+	// only the on-demand quota is reported
+	ecsAPI := fake.NewECSAPI()
+	ecsAPI.DescribeAccountAttributesBehavior.SetOutput(accountAttributes(map[string]string{
+		attributeMaxOnDemandVCPUs:  "1000",
+		attributeUsedOnDemandVCPUs: "10",
+	}))
+	quota, err := NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute)).Get(context.Background())
+	require.NoError(t, err)
+	_, ok := quota.Headroom(karpv1.CapacityTypeSpot)
+	assert.False(t, ok)
+	assert.Empty(t, quota.NearLimit(0.9))
+
+	// a value which isn't a number is an error, it's cached until it expires
+	ecsAPI.DescribeAccountAttributesBehavior.SetOutput(accountAttributes(map[string]string{attributeMaxOnDemandVCPUs: "unlimited"}))
+	p := NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(100*time.Millisecond, time.Minute))
+	_, err = p.Get(context.Background())
+	assert.Error(t, err)
+	ecsAPI.Reset()
+	_, err = p.Get(context.Background())
+	assert.Error(t, err)
+	assert.Eventually(t, func() bool {
+		quota, err = p.Get(context.Background())
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(t, quota.VCPULimits)
+}
+
+func TestGetFailureCached(t *testing.T) {
+	ecsAPI := fake.NewECSAPI()
+	ecsAPI.DescribeAccountAttributesBehavior.SetError(&tea.SDKError{Code: tea.String("Forbidden.RAM"), StatusCode: tea.Int(403)})
+	p := NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute))
+
+	// the RAM identity isn't allowed to describe the quota, the launches don't describe it again
+	for range 3 {
+		_, err := p.Get(context.Background())
+		assert.ErrorContains(t, err, "Forbidden.RAM")
+	}
+	assert.Equal(t, 1, ecsAPI.DescribeAccountAttributesBehavior.Calls())
+}
+
+func TestNearLimit(t *testing.T) {
+	quota := &Quota{
+		VCPULimits: map[string]int64{karpv1.CapacityTypeOnDemand: 1000, karpv1.CapacityTypeSpot: 500},
+		VCPUUsage:  map[string]int64{karpv1.CapacityTypeOnDemand: 900, karpv1.CapacityTypeSpot: 100},
+	}
+	assert.Equal(t, []string{karpv1.CapacityTypeOnDemand}, quota.NearLimit(0.9))
+	assert.Empty(t, quota.NearLimit(0.95))
+	assert.Equal(t, []string{karpv1.CapacityTypeOnDemand, karpv1.CapacityTypeSpot}, quota.NearLimit(0.2))
+}
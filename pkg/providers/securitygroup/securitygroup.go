@@ -19,6 +19,7 @@ package securitygroup
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 
 	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
@@ -31,28 +32,37 @@ import (
 	"sigs.k8s.io/karpenter/pkg/utils/pretty"
 
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
 )
 
+// MaxSecurityGroups is the max number of security groups an ECS instance can join
+const MaxSecurityGroups = 5
+
 type Provider interface {
 	List(context.Context, *v1alpha1.ECSNodeClass) ([]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup, error)
 }
 
 type DefaultProvider struct {
 	sync.Mutex
-	region string
-	ecsapi *ecs.Client
-	cache  *cache.Cache
-	cm     *pretty.ChangeMonitor
+	region      string
+	ecsapi      client.ECSClient
+	rateLimiter *ratelimit.RateLimiter
+	cache       *cache.Cache
+	cm          *pretty.ChangeMonitor
 	// TODO: Alibaba Cloud security groups have a limit on the number of IP addresses, may need to prevent miss
 	// And the available IPs returned by the API are not real-time. It is likely that an IP cache like VSwitchProvider will be needed later.
 }
 
-func NewDefaultProvider(region string, ecsapi *ecs.Client, cache *cache.Cache) *DefaultProvider {
+func NewDefaultProvider(region string, ecsapi client.ECSClient, rateLimiter *ratelimit.RateLimiter, cache *cache.Cache) *DefaultProvider {
 	return &DefaultProvider{
-		region: region,
-		ecsapi: ecsapi,
-		cm:     pretty.NewChangeMonitor(),
+		region:      region,
+		ecsapi:      ecsapi,
+		rateLimiter: rateLimiter,
+		cm:          pretty.NewChangeMonitor(),
 		// TODO: Remove cache cache when we utilize the security groups from the ECSNodeClass.status
 		cache: cache,
 	}
@@ -63,8 +73,8 @@ func (p *DefaultProvider) List(ctx context.Context, nodeClass *v1alpha1.ECSNodeC
 	defer p.Unlock()
 
 	// Get SecurityGroups
-	filterSets := getFilterSets(nodeClass.Spec.SecurityGroupSelectorTerms)
-	securityGroups, err := p.getSecurityGroups(filterSets)
+	filterSets := getFilterSets(nodeClass.Spec.SecurityGroupSelectorTerms, options.ResourceGroupID(ctx, nodeClass), nodeClass.ResolvedVPCID())
+	securityGroups, err := p.getSecurityGroups(ctx, filterSets)
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +89,7 @@ func (p *DefaultProvider) List(ctx context.Context, nodeClass *v1alpha1.ECSNodeC
 	return securityGroups, nil
 }
 
-func (p *DefaultProvider) getSecurityGroups(filterSets []*ecs.DescribeSecurityGroupsRequest) ([]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup, error) {
+func (p *DefaultProvider) getSecurityGroups(ctx context.Context, filterSets []*ecs.DescribeSecurityGroupsRequest) ([]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup, error) {
 	hash, err := hashstructure.Hash(filterSets, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
 	if err != nil {
 		return nil, err
@@ -89,25 +99,49 @@ func (p *DefaultProvider) getSecurityGroups(filterSets []*ecs.DescribeSecurityGr
 		// so that modifications to the ordering of the data don't affect the original
 		return append([]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{}, sg.([]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup)...), nil
 	}
-	securityGroups := map[string]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{}
-	for _, filter := range filterSets {
-		if err := p.describeSecurityGroups(filter, func(securityGroup *ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup) {
-			securityGroups[lo.FromPtr(securityGroup.SecurityGroupId)] = securityGroup
+	matches := make([][]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup, len(filterSets))
+	for i, filter := range filterSets {
+		if err := p.describeSecurityGroups(ctx, filter, func(securityGroup *ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup) {
+			matches[i] = append(matches[i], securityGroup)
 		}); err != nil {
 			return nil, fmt.Errorf("describing security groups %+v, %w", filter, err)
 		}
 	}
-	p.cache.SetDefault(fmt.Sprint(hash), lo.Values(securityGroups))
-	return lo.Values(securityGroups), nil
+	securityGroups, err := unionSecurityGroups(matches)
+	if err != nil {
+		return nil, err
+	}
+	p.cache.SetDefault(fmt.Sprint(hash), securityGroups)
+	return append([]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{}, securityGroups...), nil
+}
+
+// unionSecurityGroups returns the union of the security groups matched by every selector term, deduplicated
+// and ordered by id, an error is returned if more security groups are matched than an instance can join
+func unionSecurityGroups(matches [][]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup) ([]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup, error) {
+	securityGroups := lo.UniqBy(lo.Flatten(matches), func(securityGroup *ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup) string {
+		return lo.FromPtr(securityGroup.SecurityGroupId)
+	})
+	sort.Slice(securityGroups, func(i, j int) bool {
+		return lo.FromPtr(securityGroups[i].SecurityGroupId) < lo.FromPtr(securityGroups[j].SecurityGroupId)
+	})
+	if len(securityGroups) > MaxSecurityGroups {
+		return nil, fmt.Errorf("security group selector terms matched %d security groups %s, an instance can join at most %d security groups",
+			len(securityGroups), utils.PrettySlice(lo.Map(securityGroups, func(securityGroup *ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup, _ int) string {
+				return lo.FromPtr(securityGroup.SecurityGroupId)
+			}), MaxSecurityGroups), MaxSecurityGroups)
+	}
+	return securityGroups, nil
 }
 
-func (p *DefaultProvider) describeSecurityGroups(request *ecs.DescribeSecurityGroupsRequest, process func(*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup)) error {
+func (p *DefaultProvider) describeSecurityGroups(ctx context.Context, request *ecs.DescribeSecurityGroupsRequest, process func(*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup)) error {
 	runtime := &util.RuntimeOptions{}
 	request.RegionId = tea.String(p.region)
 	request.MaxResults = tea.Int32(100)
 	request.IsQueryEcsCount = tea.Bool(true)
 	for {
-		output, err := p.ecsapi.DescribeSecurityGroupsWithOptions(request, runtime)
+		output, err := ratelimit.CallIdempotent(ctx, p.rateLimiter, "DescribeSecurityGroups", func() (*ecs.DescribeSecurityGroupsResponse, error) {
+			return p.ecsapi.DescribeSecurityGroupsWithOptions(request, runtime)
+		})
 		if err != nil {
 			return err
 		} else if output == nil || output.Body == nil {
@@ -127,7 +161,10 @@ func (p *DefaultProvider) describeSecurityGroups(request *ecs.DescribeSecurityGr
 	return nil
 }
 
-func getFilterSets(terms []v1alpha1.SecurityGroupSelectorTerm) []*ecs.DescribeSecurityGroupsRequest {
+// getFilterSets returns the DescribeSecurityGroups requests of the selector terms, the terms selecting by tags or
+// name are scoped to the VPC, the ones selecting by ID are not, so a security group outside the VPC fails the
+// validation instead of vanishing
+func getFilterSets(terms []v1alpha1.SecurityGroupSelectorTerm, resourceGroupID string, vpcID string) []*ecs.DescribeSecurityGroupsRequest {
 	var filterSets []*ecs.DescribeSecurityGroupsRequest
 	for _, term := range terms {
 		if term.ID != "" {
@@ -135,7 +172,7 @@ func getFilterSets(terms []v1alpha1.SecurityGroupSelectorTerm) []*ecs.DescribeSe
 			continue
 		}
 		if term.Name != "" {
-			filterSets = append(filterSets, &ecs.DescribeSecurityGroupsRequest{SecurityGroupName: tea.String(term.Name)})
+			filterSets = append(filterSets, &ecs.DescribeSecurityGroupsRequest{SecurityGroupName: tea.String(term.Name), VpcId: lo.EmptyableToPtr(vpcID)})
 			continue
 		}
 
@@ -147,8 +184,13 @@ func getFilterSets(terms []v1alpha1.SecurityGroupSelectorTerm) []*ecs.DescribeSe
 			}
 			tags = append(tags, tag)
 		}
-		filterSets = append(filterSets, &ecs.DescribeSecurityGroupsRequest{Tag: tags})
+		filterSets = append(filterSets, &ecs.DescribeSecurityGroupsRequest{Tag: tags, VpcId: lo.EmptyableToPtr(vpcID)})
 	}
 
+	if resourceGroupID != "" {
+		for _, filterSet := range filterSets {
+			filterSet.ResourceGroupId = tea.String(resourceGroupID)
+		}
+	}
 	return filterSets
 }
@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package securitygroup
+
+import (
+	"testing"
+
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+)
+
+func securityGroups(ids ...string) []*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup {
+	return lo.Map(ids, func(id string, _ int) *ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup {
+		return &ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{SecurityGroupId: tea.String(id)}
+	})
+}
+
+func TestUnionSecurityGroupsOverlapping(t *testing.T) {
+	result, err := unionSecurityGroups([][]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{
+		securityGroups("sg-c", "sg-a"),
+		securityGroups("sg-b", "sg-a"),
+		securityGroups(),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sg-a", "sg-b", "sg-c"}, lo.Map(result, func(sg *ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup, _ int) string {
+		return tea.StringValue(sg.SecurityGroupId)
+	}))
+}
+
+func TestUnionSecurityGroupsOverLimit(t *testing.T) {
+	_, err := unionSecurityGroups([][]*ecs.DescribeSecurityGroupsResponseBodySecurityGroupsSecurityGroup{
+		securityGroups("sg-a", "sg-b", "sg-c"),
+		securityGroups("sg-c", "sg-d", "sg-e", "sg-f"),
+	})
+	assert.ErrorContains(t, err, "matched 6 security groups")
+}
+
+func TestGetFilterSetsResourceGroup(t *testing.T) {
+	terms := []v1alpha1.SecurityGroupSelectorTerm{
+		{ID: "sg-a"},
+		{Name: "karpenter"},
+		{Tags: map[string]string{"karpenter.sh/discovery": "cluster"}},
+	}
+	for _, filterSet := range getFilterSets(terms, "rg-123", "") {
+		assert.Equal(t, "rg-123", tea.StringValue(filterSet.ResourceGroupId))
+	}
+	for _, filterSet := range getFilterSets(terms, "", "") {
+		assert.Nil(t, filterSet.ResourceGroupId)
+	}
+}
+
+func TestGetFilterSetsVPC(t *testing.T) {
+	terms := []v1alpha1.SecurityGroupSelectorTerm{
+		{ID: "sg-a"},
+		{Name: "karpenter"},
+		{Tags: map[string]string{"karpenter.sh/discovery": "cluster"}},
+	}
+	// only the security groups selected by name or tags are scoped to the VPC
+	filterSets := getFilterSets(terms, "", "vpc-1")
+	assert.Nil(t, filterSets[0].VpcId)
+	assert.Equal(t, "vpc-1", tea.StringValue(filterSets[1].VpcId))
+	assert.Equal(t, "vpc-1", tea.StringValue(filterSets[2].VpcId))
+	for _, filterSet := range getFilterSets(terms, "", "") {
+		assert.Nil(t, filterSet.VpcId)
+	}
+}
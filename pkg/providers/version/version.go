@@ -18,9 +18,14 @@ package version
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
 	"k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -28,17 +33,43 @@ import (
 )
 
 const (
-	kubernetesVersionCacheKey = "kubernetesVersion"
+	kubernetesVersionCacheKey       = "kubernetesVersion"
+	kubernetesParsedVersionCacheKey = "kubernetesParsedVersion"
 	// MinK8sVersion defines the min K8s version which has tested on ack
 	// Currently the min k8s version of ack is 1.28.1-aliyun.1
 	MinK8sVersion = "1.28.1"
 	// MaxK8sVersion defines the max K8s version which has tested on ack
 	// Currently the max k8s version of ack is 1.33.3-aliyun.1
 	MaxK8sVersion = "1.33.3"
+	// ackVersionSuffix is the separator ACK uses between the upstream version and its own patch level,
+	// eg: v1.30.1-aliyun.1
+	ackVersionSuffix = "-aliyun."
+	// DefaultKubernetesVersionTTL is how long a discovered version is trusted before the API Server
+	// is asked again, so in-place control plane upgrades are picked up in a timely manner
+	DefaultKubernetesVersionTTL = 5 * time.Minute
 )
 
 type Provider interface {
 	Get(ctx context.Context) (string, error)
+	// GetParsed returns the APIServer version parsed into a *version.Version, so that
+	// callers can compare versions without re-parsing the string returned from Get
+	GetParsed(ctx context.Context) (*version.Version, error)
+}
+
+// parsedVersion keeps the raw version next to its parsed form, so that a stale parsed
+// entry is never returned for a newer raw version
+type parsedVersion struct {
+	raw    string
+	parsed *version.Version
+}
+
+// ProviderOptions allows overriding the range of K8s versions which are considered as supported,
+// eg: for operators running a validated but newer ACK release. Empty fields fall back to the defaults.
+type ProviderOptions struct {
+	MinVersion string
+	MaxVersion string
+	// TTL is how long the discovered version is cached, defaults to DefaultKubernetesVersionTTL
+	TTL time.Duration
 }
 
 // DefaultProvider get the APIServer version. This will be initialized at start up and allows karpenter to have an understanding of the cluster version
@@ -47,16 +78,50 @@ type DefaultProvider struct {
 	cache               *cache.Cache
 	cm                  *pretty.ChangeMonitor
 	kubernetesInterface kubernetes.Interface
+	ttl                 time.Duration
+	minVersion          string
+	maxVersion          string
 }
 
 func NewDefaultProvider(kubernetesInterface kubernetes.Interface, cache *cache.Cache) *DefaultProvider {
+	return NewDefaultProviderWithTTL(kubernetesInterface, cache, DefaultKubernetesVersionTTL)
+}
+
+// NewDefaultProviderWithTTL creates a DefaultProvider which caches the discovered version for the given ttl,
+// independent of the default expiration of the supplied cache
+func NewDefaultProviderWithTTL(kubernetesInterface kubernetes.Interface, cache *cache.Cache, ttl time.Duration) *DefaultProvider {
 	return &DefaultProvider{
 		cm:                  pretty.NewChangeMonitor(),
 		cache:               cache,
 		kubernetesInterface: kubernetesInterface,
+		ttl:                 ttl,
+		minVersion:          MinK8sVersion,
+		maxVersion:          MaxK8sVersion,
 	}
 }
 
+// NewDefaultProviderWithOptions creates a DefaultProvider with the supported version range and ttl overridden by opts
+func NewDefaultProviderWithOptions(kubernetesInterface kubernetes.Interface, cache *cache.Cache, opts ProviderOptions) (*DefaultProvider, error) {
+	minVersion := lo.Ternary(opts.MinVersion != "", opts.MinVersion, MinK8sVersion)
+	maxVersion := lo.Ternary(opts.MaxVersion != "", opts.MaxVersion, MaxK8sVersion)
+	minParsed, err := version.ParseGeneric(minVersion)
+	if err != nil {
+		return nil, fmt.Errorf("parsing min kubernetes version %s, %w", minVersion, err)
+	}
+	maxParsed, err := version.ParseGeneric(maxVersion)
+	if err != nil {
+		return nil, fmt.Errorf("parsing max kubernetes version %s, %w", maxVersion, err)
+	}
+	if maxParsed.LessThan(minParsed) {
+		return nil, fmt.Errorf("min kubernetes version %s is greater than max kubernetes version %s", minVersion, maxVersion)
+	}
+
+	p := NewDefaultProviderWithTTL(kubernetesInterface, cache, lo.Ternary(opts.TTL > 0, opts.TTL, DefaultKubernetesVersionTTL))
+	p.minVersion = minParsed.String()
+	p.maxVersion = maxParsed.String()
+	return p, nil
+}
+
 func (p *DefaultProvider) Get(ctx context.Context) (string, error) {
 	if version, ok := p.cache.Get(kubernetesVersionCacheKey); ok {
 		return version.(string), nil
@@ -66,24 +131,103 @@ func (p *DefaultProvider) Get(ctx context.Context) (string, error) {
 		return "", err
 	}
 	version := serverVersion.String()
-	p.cache.SetDefault(kubernetesVersionCacheKey, version)
+	p.cache.Set(kubernetesVersionCacheKey, version, p.ttl)
 	if p.cm.HasChanged("kubernetes-version", version) {
 		log.FromContext(ctx).WithValues("version", version).V(1).Info("discovered kubernetes version")
-		if err := validateK8sVersion(version); err != nil {
+		ClusterVersionInfo.Reset()
+		ClusterVersionInfo.Set(1, map[string]string{versionLabel: version})
+		if err := validateK8sVersion(version, p.minVersion, p.maxVersion); err != nil {
 			log.FromContext(ctx).Error(err, "failed validating kubernetes version")
+			ClusterVersionSupported.Set(0, map[string]string{})
+		} else {
+			ClusterVersionSupported.Set(1, map[string]string{})
 		}
 	}
 	return version, nil
 }
 
-func validateK8sVersion(v string) error {
-	k8sVersion := version.MustParseGeneric(v)
+func (p *DefaultProvider) GetParsed(ctx context.Context) (*version.Version, error) {
+	raw, err := p.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := p.cache.Get(kubernetesParsedVersionCacheKey); ok && cached.(parsedVersion).raw == raw {
+		return cached.(parsedVersion).parsed, nil
+	}
+	parsed, err := version.ParseGeneric(normalizeVersion(raw))
+	if err != nil {
+		return nil, fmt.Errorf("parsing kubernetes version %s, %w", raw, err)
+	}
+	p.cache.Set(kubernetesParsedVersionCacheKey, parsedVersion{raw: raw, parsed: parsed}, p.ttl)
+	return parsed, nil
+}
+
+// normalizeVersion strips the v prefix and the build metadata of a version, e.g. v1.30.2+k3s1 is normalized to 1.30.2.
+// The self-managed clusters report the build of their distribution as the build metadata, it doesn't order versions.
+func normalizeVersion(v string) string {
+	v, _, _ = strings.Cut(strings.TrimSpace(v), "+")
+	return strings.TrimPrefix(v, "v")
+}
+
+// ParseACKVersion splits an ACK version such as 1.30.1-aliyun.1 into the upstream version and the aliyun patch level.
+// Versions without the aliyun suffix, e.g. the versions of vanilla clusters, are returned with a patch level of 0.
+func ParseACKVersion(v string) (upstream *version.Version, aliyunPatch int, err error) {
+	raw, patch, found := strings.Cut(normalizeVersion(v), ackVersionSuffix)
+	upstream, err = version.ParseGeneric(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parsing kubernetes version %s, %w", v, err)
+	}
+	if !found {
+		return upstream, 0, nil
+	}
+	aliyunPatch, err = strconv.Atoi(patch)
+	if err != nil || aliyunPatch < 0 {
+		return nil, 0, fmt.Errorf("parsing aliyun patch level of kubernetes version %s", v)
+	}
+	return upstream, aliyunPatch, nil
+}
+
+var (
+	// ErrVersionBelowMin is matched by an UnsupportedVersionError when the cluster is older than MinK8sVersion
+	ErrVersionBelowMin = errors.New("kubernetes version is below the min supported version")
+	// ErrVersionAboveMax is matched by an UnsupportedVersionError when the cluster is newer than MaxK8sVersion
+	ErrVersionAboveMax = errors.New("kubernetes version is above the max supported version")
+)
+
+// UnsupportedVersionError is returned when the cluster version is out of the range supported by karpenter.
+// Use errors.Is with ErrVersionBelowMin or ErrVersionAboveMax to find out which bound has been crossed.
+type UnsupportedVersionError struct {
+	Actual string
+	Min    string
+	Max    string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("karpenter version is not compatible with K8s version %s, supported range is [%s, %s]", e.Actual, e.Min, e.Max)
+}
+
+func (e *UnsupportedVersionError) Unwrap() error {
+	actual, err := version.ParseGeneric(e.Actual)
+	if err != nil {
+		return nil
+	}
+	if actual.LessThan(version.MustParseGeneric(e.Min)) {
+		return ErrVersionBelowMin
+	}
+	return ErrVersionAboveMax
+}
+
+func validateK8sVersion(v, minVersion, maxVersion string) error {
+	k8sVersion, _, err := ParseACKVersion(v)
+	if err != nil {
+		return err
+	}
 
 	// We will only error if the user is running karpenter on a k8s version,
 	// that is out of the range of the minK8sVersion and maxK8sVersion
-	if k8sVersion.LessThan(version.MustParseGeneric(MinK8sVersion)) ||
-		version.MustParseGeneric(MaxK8sVersion).LessThan(k8sVersion) {
-		return fmt.Errorf("karpenter version is not compatible with K8s version %s", k8sVersion)
+	if k8sVersion.LessThan(version.MustParseGeneric(minVersion)) ||
+		version.MustParseGeneric(maxVersion).LessThan(k8sVersion) {
+		return &UnsupportedVersionError{Actual: k8sVersion.String(), Min: minVersion, Max: maxVersion}
 	}
 
 	return nil
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package version
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apimachineryversion "k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseACKVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     string
+		upstream    string
+		aliyunPatch int
+		wantErr     bool
+	}{
+		{name: "ack version", version: "v1.30.1-aliyun.1", upstream: "1.30.1", aliyunPatch: 1},
+		{name: "upstream version", version: "1.30.1", upstream: "1.30.1", aliyunPatch: 0},
+		{name: "build metadata", version: "v1.30.2+k3s1", upstream: "1.30.2", aliyunPatch: 0},
+		{name: "ack version with build metadata", version: "v1.30.1-aliyun.1+build.2", upstream: "1.30.1", aliyunPatch: 1},
+		{name: "malformed aliyun patch", version: "1.30.1-aliyun.x", wantErr: true},
+		{name: "empty aliyun patch", version: "1.30.1-aliyun.", wantErr: true},
+		{name: "malformed version", version: "aliyun", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, aliyunPatch, err := ParseACKVersion(tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.upstream, upstream.String())
+			assert.Equal(t, tt.aliyunPatch, aliyunPatch)
+		})
+	}
+}
+
+func TestValidateK8sVersion(t *testing.T) {
+	for _, v := range []string{"v1.30.1-aliyun.1", "1.30.2-aliyun.1", "v1.30.2+k3s1", "1.30.2", "v1.30.2+rke2r1"} {
+		assert.NoError(t, validateK8sVersion(v, MinK8sVersion, MaxK8sVersion), v)
+	}
+
+	var unsupportedErr *UnsupportedVersionError
+	err := validateK8sVersion("v1.20.4-aliyun.1", MinK8sVersion, MaxK8sVersion)
+	assert.ErrorAs(t, err, &unsupportedErr)
+	assert.Equal(t, "1.20.4", unsupportedErr.Actual)
+	assert.ErrorIs(t, err, ErrVersionBelowMin)
+
+	err = validateK8sVersion("v1.99.0", MinK8sVersion, MaxK8sVersion)
+	assert.ErrorAs(t, err, &unsupportedErr)
+	assert.ErrorIs(t, err, ErrVersionAboveMax)
+
+	// the build metadata doesn't hide an unsupported version
+	err = validateK8sVersion("v1.20.4+k3s1", MinK8sVersion, MaxK8sVersion)
+	assert.ErrorAs(t, err, &unsupportedErr)
+	assert.Equal(t, "1.20.4", unsupportedErr.Actual)
+	assert.ErrorIs(t, err, ErrVersionBelowMin)
+}
+
+func TestNewDefaultProviderWithOptions(t *testing.T) {
+	_, err := NewDefaultProviderWithOptions(nil, nil, ProviderOptions{MaxVersion: "1.34.0"})
+	assert.NoError(t, err)
+
+	_, err = NewDefaultProviderWithOptions(nil, nil, ProviderOptions{MinVersion: "1.30.0", MaxVersion: "1.29.0"})
+	assert.Error(t, err)
+
+	_, err = NewDefaultProviderWithOptions(nil, nil, ProviderOptions{MaxVersion: "latest"})
+	assert.Error(t, err)
+}
+
+func TestGetParsed(t *testing.T) {
+	ctx := context.Background()
+	kubernetesInterface := fake.NewSimpleClientset()
+	discovery := kubernetesInterface.Discovery().(*fakediscovery.FakeDiscovery)
+	p := NewDefaultProvider(kubernetesInterface, cache.New(time.Minute, time.Minute))
+
+	for _, tt := range []struct {
+		name    string
+		version string
+		parsed  string
+		wantErr bool
+	}{
+		{name: "upstream version", version: "v1.30.1", parsed: "1.30.1"},
+		{name: "ack version", version: "v1.30.1-aliyun.1", parsed: "1.30.1"},
+		{name: "build metadata", version: "v1.30.2+k3s1", parsed: "1.30.2"},
+		{name: "malformed version", version: "latest", wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p.cache.Flush()
+			discovery.FakedServerVersion = &apimachineryversion.Info{GitVersion: tt.version}
+			parsed, err := p.GetParsed(ctx)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.parsed, parsed.String())
+		})
+	}
+
+	// the parsed version is cached with the raw version
+	p.cache.Flush()
+	discovery.FakedServerVersion = &apimachineryversion.Info{GitVersion: "v1.30.1-aliyun.1"}
+	parsed, err := p.GetParsed(ctx)
+	require.NoError(t, err)
+	cached, err := p.GetParsed(ctx)
+	require.NoError(t, err)
+	assert.Same(t, parsed, cached)
+
+	// the version is parsed again once the raw version changes, e.g. after an in-place upgrade of the control plane
+	discovery.FakedServerVersion = &apimachineryversion.Info{GitVersion: "v1.31.1-aliyun.1"}
+	p.cache.Delete(kubernetesVersionCacheKey)
+	parsed, err = p.GetParsed(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1.31.1", parsed.String())
+}
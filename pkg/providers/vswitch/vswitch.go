@@ -30,14 +30,18 @@ import (
 	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
 	corev1 "k8s.io/api/core/v1"
-	"sigs.k8s.io/controller-runtime/pkg/log"
 	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
 	"sigs.k8s.io/karpenter/pkg/cloudprovider"
 	"sigs.k8s.io/karpenter/pkg/scheduling"
 	"sigs.k8s.io/karpenter/pkg/utils/pretty"
 
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/zone"
 	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/logging"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
 )
 
 type Provider interface {
@@ -51,7 +55,9 @@ type DefaultProvider struct {
 	region string
 
 	sync.Mutex
-	vpcapi                  *vpc.Client
+	vpcapi                  client.VPCClient
+	zoneProvider            zone.Provider
+	rateLimiter             *ratelimit.RateLimiter
 	cache                   *cache.Cache
 	availableIPAddressCache *cache.Cache
 	cm                      *pretty.ChangeMonitor
@@ -64,11 +70,13 @@ type VSwitch struct {
 	AvailableIPAddressCount int64
 }
 
-func NewDefaultProvider(region string, vpcapi *vpc.Client, cache *cache.Cache, availableIPAddressCache *cache.Cache) *DefaultProvider {
+func NewDefaultProvider(region string, vpcapi client.VPCClient, zoneProvider zone.Provider, rateLimiter *ratelimit.RateLimiter, cache *cache.Cache, availableIPAddressCache *cache.Cache) *DefaultProvider {
 	return &DefaultProvider{
-		region: region,
-		vpcapi: vpcapi,
-		cm:     pretty.NewChangeMonitor(),
+		region:       region,
+		vpcapi:       vpcapi,
+		zoneProvider: zoneProvider,
+		rateLimiter:  rateLimiter,
+		cm:           pretty.NewChangeMonitor(),
 		// TODO: Remove cache when we utilize the resolved vSwitches from the ECSNodeClass.status
 		// VSwitches are sorted on AvailableIpAddressCount, descending order
 		cache:                   cache,
@@ -85,7 +93,8 @@ func (p *DefaultProvider) List(ctx context.Context, nodeClass *v1alpha1.ECSNodeC
 	if len(nodeClass.Spec.VSwitchSelectorTerms) == 0 {
 		return []*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{}, nil
 	}
-	hash, err := hashstructure.Hash(nodeClass.Spec.VSwitchSelectorTerms, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
+	filterSets := getFilterSets(nodeClass.Spec.VSwitchSelectorTerms, options.ResourceGroupID(ctx, nodeClass), nodeClass.Spec.VPCID)
+	hash, err := hashstructure.Hash(filterSets, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
 	if err != nil {
 		return nil, err
 	}
@@ -95,27 +104,21 @@ func (p *DefaultProvider) List(ctx context.Context, nodeClass *v1alpha1.ECSNodeC
 		return append([]*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{}, switches.([]*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch)...), nil
 	}
 
+	zones, err := p.zoneProvider.Zones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting zones, %w", err)
+	}
+
 	// Ensure that all the vSwitches that are returned here are unique
 	vSwitches := map[string]*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch{}
-	for _, selectorTerms := range nodeClass.Spec.VSwitchSelectorTerms {
-		var tags []*vpc.DescribeVSwitchesRequestTag
-		var vSwitchID *string
-
-		if len(selectorTerms.ID) > 0 {
-			vSwitchID = tea.String(selectorTerms.ID)
-		}
-		for k, v := range selectorTerms.Tags {
-			// Value: nil selector all switches, '' selector specify switch
-			tag := &vpc.DescribeVSwitchesRequestTag{Key: tea.String(k)}
-			if v != "*" {
-				tag.Value = tea.String(v)
-			}
-			tags = append(tags, tag)
-		}
-
+	for i, filterSet := range filterSets {
 		// API Rate Limits: 360/60(s), Max selector items: 30
 		// TODO: additional rate limits
-		if err = p.describeVSwitches(tags, vSwitchID, func(vSwitch *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch) {
+		if err = p.describeVSwitches(ctx, filterSet, func(vSwitch *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch) {
+			// No instances can be launched into the vSwitches of the zones closed for new instances
+			if !lo.Contains(zones, lo.FromPtr(vSwitch.ZoneId)) {
+				return
+			}
 			vSwitches[lo.FromPtr(vSwitch.VSwitchId)] = vSwitch
 			// switches can be leaked here, if a switch is never called received from ecs
 			// we are accepting it for now, as this will be an insignificant amount of memory
@@ -124,13 +127,13 @@ func (p *DefaultProvider) List(ctx context.Context, nodeClass *v1alpha1.ECSNodeC
 			// remove any previously tracked IP addresses since we just refreshed from ECS
 			delete(p.inflightIPs, lo.FromPtr(vSwitch.VSwitchId))
 		}); err != nil {
-			return nil, fmt.Errorf("describing vSwitches %s, %w", pretty.Concise(selectorTerms), err)
+			return nil, fmt.Errorf("describing vSwitches %s, %w", pretty.Concise(nodeClass.Spec.VSwitchSelectorTerms[i]), err)
 		}
 	}
 
 	p.cache.SetDefault(fmt.Sprint(hash), lo.Values(vSwitches))
 	if p.cm.HasChanged(fmt.Sprintf("vSwitches/%s", nodeClass.Name), lo.Keys(vSwitches)) {
-		log.FromContext(ctx).
+		logging.FromContext(ctx).
 			WithValues("vSwitches", lo.Map(lo.Values(vSwitches), func(v *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, _ int) v1alpha1.VSwitch {
 				return v1alpha1.VSwitch{
 					ID:     lo.FromPtr(v.VSwitchId),
@@ -157,24 +160,33 @@ func (p *DefaultProvider) ZonalVSwitchesForLaunch(ctx context.Context, nodeClass
 		}
 	}
 
+	vSwitches := nodeClass.Status.VSwitches
+	// The IPv6 addresses can only be assigned in the vSwitches with an IPv6 CIDR block
+	if nodeClass.Spec.IPv6 != nil {
+		vSwitches = lo.Filter(vSwitches, func(vSwitch v1alpha1.VSwitch, _ int) bool { return vSwitch.IPv6CIDRBlock != "" })
+		if len(vSwitches) == 0 {
+			return nil, fmt.Errorf("IPv6 is requested but no vSwitch with an IPv6 CIDR block matched selector %v", nodeClass.Spec.VSwitchSelectorTerms)
+		}
+	}
+
 	zonalVSwitches := map[string]*VSwitch{}
-	for _, vSwitch := range nodeClass.Status.VSwitches {
+	for _, vSwitch := range vSwitches {
+		newZonalVSwitchIPAddressCount, known := p.trackedIPAddressCount(vSwitch.ID, availableIPAddressCount)
+		// Skip vSwitches which are known to be exhausted, launching into them will fail
+		if known && newZonalVSwitchIPAddressCount <= 0 {
+			continue
+		}
 		if v, ok := zonalVSwitches[vSwitch.ZoneID]; ok {
-			currentZonalVSwitchIPAddressCount := v.AvailableIPAddressCount
-			newZonalVSwitchIPAddressCount := availableIPAddressCount[vSwitch.ID]
-			if ips, ok := p.inflightIPs[v.ID]; ok {
-				currentZonalVSwitchIPAddressCount = ips
-			}
-			if ips, ok := p.inflightIPs[vSwitch.ID]; ok {
-				newZonalVSwitchIPAddressCount = ips
-			}
-
+			currentZonalVSwitchIPAddressCount, _ := p.trackedIPAddressCount(v.ID, availableIPAddressCount)
 			if currentZonalVSwitchIPAddressCount >= newZonalVSwitchIPAddressCount {
 				continue
 			}
 		}
 		zonalVSwitches[vSwitch.ZoneID] = &VSwitch{ID: vSwitch.ID, ZoneID: vSwitch.ZoneID, AvailableIPAddressCount: availableIPAddressCount[vSwitch.ID]}
 	}
+	if len(zonalVSwitches) == 0 {
+		return nil, fmt.Errorf("no vSwitches with available ip addresses matched selector %v", nodeClass.Spec.VSwitchSelectorTerms)
+	}
 
 	for _, vSwitch := range zonalVSwitches {
 		predictedIPsUsed := p.minPods(instanceTypes, scheduling.NewRequirements(
@@ -190,6 +202,16 @@ func (p *DefaultProvider) ZonalVSwitchesForLaunch(ctx context.Context, nodeClass
 	return zonalVSwitches, nil
 }
 
+// trackedIPAddressCount returns the available ip address count of the vSwitch, taking the inflight ips into account,
+// known is false when the count of the vSwitch has not been discovered yet or has expired from the cache
+func (p *DefaultProvider) trackedIPAddressCount(vSwitchID string, availableIPAddressCount map[string]int64) (count int64, known bool) {
+	if ips, ok := p.inflightIPs[vSwitchID]; ok {
+		return ips, true
+	}
+	count, known = availableIPAddressCount[vSwitchID]
+	return count, known
+}
+
 // UpdateInflightIPs is used to refresh the in-memory IP usage by adding back unused IPs after a CreateAutoProvisioningGroup response is returned
 func (p *DefaultProvider) UpdateInflightIPs(createAutoProvisioningGroupRequest *ecs.CreateAutoProvisioningGroupRequest, createAutoProvisioningGroupResponse *ecs.DescribeInstancesResponseBodyInstances, instanceTypes []*cloudprovider.InstanceType,
 	vSwitches []*VSwitch, capacityType string) {
@@ -257,17 +279,41 @@ func (p *DefaultProvider) LivenessProbe(_ *http.Request) error {
 	return nil
 }
 
-func (p *DefaultProvider) describeVSwitches(tags []*vpc.DescribeVSwitchesRequestTag, id *string, process func(*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch)) error {
+// getFilterSets returns the DescribeVSwitches requests of the selector terms, the terms selecting by tags are scoped
+// to the VPC, the ones selecting by ID are not, so a vSwitch outside the VPC fails the validation instead of vanishing
+func getFilterSets(terms []v1alpha1.VSwitchSelectorTerm, resourceGroupID string, vpcID string) []*vpc.DescribeVSwitchesRequest {
+	return lo.Map(terms, func(term v1alpha1.VSwitchSelectorTerm, _ int) *vpc.DescribeVSwitchesRequest {
+		filterSet := &vpc.DescribeVSwitchesRequest{}
+		if len(term.ID) > 0 {
+			filterSet.VSwitchId = tea.String(term.ID)
+		}
+		for k, v := range term.Tags {
+			// Value: nil selector all switches, '' selector specify switch
+			tag := &vpc.DescribeVSwitchesRequestTag{Key: tea.String(k)}
+			if v != "*" {
+				tag.Value = tea.String(v)
+			}
+			filterSet.Tag = append(filterSet.Tag, tag)
+		}
+		if len(term.Tags) > 0 {
+			filterSet.VpcId = lo.EmptyableToPtr(vpcID)
+		}
+		if resourceGroupID != "" {
+			filterSet.ResourceGroupId = tea.String(resourceGroupID)
+		}
+		return filterSet
+	})
+}
+
+func (p *DefaultProvider) describeVSwitches(ctx context.Context, describeVSwitchesRequest *vpc.DescribeVSwitchesRequest, process func(*vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch)) error {
 	runtime := &util.RuntimeOptions{}
-	describeVSwitchesRequest := &vpc.DescribeVSwitchesRequest{
-		RegionId:  tea.String(p.region),
-		Tag:       tags,
-		VSwitchId: id,
-		PageSize:  tea.Int32(50),
-	}
+	describeVSwitchesRequest.RegionId = tea.String(p.region)
+	describeVSwitchesRequest.PageSize = tea.Int32(50)
 	for pageNumber := int32(1); pageNumber < 360; pageNumber++ {
 		describeVSwitchesRequest.PageNumber = tea.Int32(pageNumber)
-		output, err := p.vpcapi.DescribeVSwitchesWithOptions(describeVSwitchesRequest, runtime)
+		output, err := ratelimit.CallIdempotent(ctx, p.rateLimiter, "DescribeVSwitches", func() (*vpc.DescribeVSwitchesResponse, error) {
+			return p.vpcapi.DescribeVSwitchesWithOptions(describeVSwitchesRequest, runtime)
+		})
 		if err != nil {
 			return err
 		} else if output == nil || output.Body == nil {
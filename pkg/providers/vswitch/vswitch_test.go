@@ -0,0 +1,177 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vswitch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	vpc "github.com/alibabacloud-go/vpc-20160428/v6/client"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/apis/v1alpha1"
+	kcache "github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/cache"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/fake"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/providers/zone"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
+)
+
+func TestZonalVSwitchesForLaunch(t *testing.T) {
+	availableIPAddressCache := cache.New(kcache.AvailableIPAddressTTL, kcache.DefaultCleanupInterval)
+	availableIPAddressCache.SetDefault("vsw-a-exhausted", int64(0))
+	availableIPAddressCache.SetDefault("vsw-a-small", int64(10))
+	availableIPAddressCache.SetDefault("vsw-a-large", int64(100))
+	availableIPAddressCache.SetDefault("vsw-b-exhausted", int64(0))
+	p := NewDefaultProvider("cn-hangzhou", nil, nil, nil, cache.New(kcache.DefaultTTL, kcache.DefaultCleanupInterval), availableIPAddressCache)
+
+	nodeClass := &v1alpha1.ECSNodeClass{
+		Status: v1alpha1.ECSNodeClassStatus{
+			VSwitches: []v1alpha1.VSwitch{
+				{ID: "vsw-a-exhausted", ZoneID: "cn-hangzhou-a"},
+				{ID: "vsw-a-small", ZoneID: "cn-hangzhou-a"},
+				{ID: "vsw-a-large", ZoneID: "cn-hangzhou-a"},
+				{ID: "vsw-b-exhausted", ZoneID: "cn-hangzhou-b"},
+				{ID: "vsw-c-unknown", ZoneID: "cn-hangzhou-c"},
+			},
+		},
+	}
+	vSwitches, err := p.ZonalVSwitchesForLaunch(context.Background(), nodeClass, nil, karpv1.CapacityTypeOnDemand)
+	assert.NoError(t, err)
+	assert.Len(t, vSwitches, 2)
+	assert.Equal(t, "vsw-a-large", vSwitches["cn-hangzhou-a"].ID)
+	assert.Equal(t, "vsw-c-unknown", vSwitches["cn-hangzhou-c"].ID)
+	assert.NotContains(t, vSwitches, "cn-hangzhou-b")
+}
+
+func TestZonalVSwitchesForLaunchIPv6(t *testing.T) {
+	p := NewDefaultProvider("cn-hangzhou", nil, nil, nil, cache.New(kcache.DefaultTTL, kcache.DefaultCleanupInterval),
+		cache.New(kcache.AvailableIPAddressTTL, kcache.DefaultCleanupInterval))
+	nodeClass := &v1alpha1.ECSNodeClass{
+		Spec: v1alpha1.ECSNodeClassSpec{IPv6: &v1alpha1.IPv6{}},
+		Status: v1alpha1.ECSNodeClassStatus{
+			VSwitches: []v1alpha1.VSwitch{
+				{ID: "vsw-a", ZoneID: "cn-hangzhou-a"},
+				{ID: "vsw-b", ZoneID: "cn-hangzhou-b", IPv6CIDRBlock: "2408:4005:3ac:7c00::/64"},
+			},
+		},
+	}
+
+	// only the vSwitches with an IPv6 CIDR block are launched into
+	vSwitches, err := p.ZonalVSwitchesForLaunch(context.Background(), nodeClass, nil, karpv1.CapacityTypeOnDemand)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cn-hangzhou-b"}, lo.Keys(vSwitches))
+
+	nodeClass.Status.VSwitches = nodeClass.Status.VSwitches[:1]
+	_, err = p.ZonalVSwitchesForLaunch(context.Background(), nodeClass, nil, karpv1.CapacityTypeOnDemand)
+	assert.ErrorContains(t, err, "IPv6 is requested but no vSwitch with an IPv6 CIDR block matched selector")
+}
+
+func TestGetFilterSetsResourceGroup(t *testing.T) {
+	terms := []v1alpha1.VSwitchSelectorTerm{
+		{ID: "vsw-a"},
+		{Tags: map[string]string{"karpenter.sh/discovery": "cluster"}},
+	}
+	filterSets := getFilterSets(terms, "rg-123", "")
+	assert.Equal(t, "vsw-a", tea.StringValue(filterSets[0].VSwitchId))
+	assert.Equal(t, "karpenter.sh/discovery", tea.StringValue(filterSets[1].Tag[0].Key))
+	for _, filterSet := range filterSets {
+		assert.Equal(t, "rg-123", tea.StringValue(filterSet.ResourceGroupId))
+	}
+	for _, filterSet := range getFilterSets(terms, "", "") {
+		assert.Nil(t, filterSet.ResourceGroupId)
+	}
+}
+
+func TestGetFilterSetsVPC(t *testing.T) {
+	terms := []v1alpha1.VSwitchSelectorTerm{
+		{ID: "vsw-a"},
+		{Tags: map[string]string{"karpenter.sh/discovery": "cluster"}},
+	}
+	// only the vSwitches selected by tags are scoped to the VPC
+	filterSets := getFilterSets(terms, "", "vpc-1")
+	assert.Nil(t, filterSets[0].VpcId)
+	assert.Equal(t, "vpc-1", tea.StringValue(filterSets[1].VpcId))
+	for _, filterSet := range getFilterSets(terms, "", "") {
+		assert.Nil(t, filterSet.VpcId)
+	}
+}
+
+func TestList(t *testing.T) {
+	vpcAPI := fake.NewVPCAPI()
+	zoneProvider := zone.NewDefaultProvider(fake.DefaultRegion, fake.NewECSAPI(), nil, cache.New(time.Minute, time.Minute))
+	p := NewDefaultProvider(fake.DefaultRegion, vpcAPI, zoneProvider, nil, cache.New(time.Minute, time.Minute), cache.New(time.Minute, time.Minute))
+
+	vSwitches, err := p.List(context.Background(), &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{
+		VSwitchSelectorTerms: []v1alpha1.VSwitchSelectorTerm{
+			{Tags: map[string]string{"karpenter.sh/discovery": "test", "zone": "cn-hangzhou-i"}},
+			{ID: "vsw-3"},
+		},
+	}})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"vsw-1", "vsw-3"}, lo.Map(vSwitches, func(v *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, _ int) string {
+		return tea.StringValue(v.VSwitchId)
+	}))
+
+	// every selector term is a DescribeVSwitches call in the region
+	requests := vpcAPI.DescribeVSwitchesBehavior.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, fake.DefaultRegion, tea.StringValue(requests[0].RegionId))
+	assert.Len(t, requests[0].Tag, 2)
+	assert.Equal(t, "vsw-3", tea.StringValue(requests[1].VSwitchId))
+
+	// the vSwitches are cached
+	_, err = p.List(context.Background(), &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{
+		VSwitchSelectorTerms: []v1alpha1.VSwitchSelectorTerm{{ID: "vsw-3"}, {Tags: map[string]string{"karpenter.sh/discovery": "test", "zone": "cn-hangzhou-i"}}},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, vpcAPI.DescribeVSwitchesBehavior.Calls())
+}
+
+func TestListSkipsClosedZones(t *testing.T) {
+	vpcAPI := fake.NewVPCAPI()
+	ecsAPI := fake.NewECSAPI()
+	// no instances can be created in the last zone
+	ecsAPI.Seed(fake.ECSAPIState{Zones: fake.DefaultZones[:2]})
+	zoneProvider := zone.NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute))
+	p := NewDefaultProvider(fake.DefaultRegion, vpcAPI, zoneProvider, nil, cache.New(time.Minute, time.Minute), cache.New(time.Minute, time.Minute))
+
+	vSwitches, err := p.List(context.Background(), &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{
+		VSwitchSelectorTerms: []v1alpha1.VSwitchSelectorTerm{{Tags: map[string]string{"karpenter.sh/discovery": "test"}}},
+	}})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"vsw-1", "vsw-2"}, lo.Map(vSwitches, func(v *vpc.DescribeVSwitchesResponseBodyVSwitchesVSwitch, _ int) string {
+		return tea.StringValue(v.VSwitchId)
+	}))
+}
+
+func TestListFailsFastOnAuthorizationErrors(t *testing.T) {
+	vpcAPI := fake.NewVPCAPI()
+	vpcAPI.DescribeVSwitchesBehavior.SetError(&tea.SDKError{Code: tea.String("Forbidden.RAM"), StatusCode: tea.Int(403)})
+	zoneProvider := zone.NewDefaultProvider(fake.DefaultRegion, fake.NewECSAPI(), nil, cache.New(time.Minute, time.Minute))
+	p := NewDefaultProvider(fake.DefaultRegion, vpcAPI, zoneProvider, ratelimit.NewRateLimiter(nil, 1000, 3), cache.New(time.Minute, time.Minute), cache.New(time.Minute, time.Minute))
+
+	nodeClass := &v1alpha1.ECSNodeClass{Spec: v1alpha1.ECSNodeClassSpec{VSwitchSelectorTerms: []v1alpha1.VSwitchSelectorTerm{{ID: "vsw-1"}}}}
+	_, err := p.List(context.Background(), nodeClass)
+	assert.Error(t, err)
+	assert.Equal(t, 1, vpcAPI.DescribeVSwitchesBehavior.Calls())
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package zone
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"sigs.k8s.io/karpenter/pkg/utils/pretty"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/logging"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/ratelimit"
+)
+
+// resourceTypeInstance is the resource type of the zones the instances can be created in
+const resourceTypeInstance = "Instance"
+
+type Provider interface {
+	// Zones returns the IDs of the zones of the region the instances can be created in
+	Zones(context.Context) ([]string, error)
+}
+
+type DefaultProvider struct {
+	sync.Mutex
+	region      string
+	ecsapi      client.ECSClient
+	rateLimiter *ratelimit.RateLimiter
+	cache       *cache.Cache
+	cm          *pretty.ChangeMonitor
+}
+
+func NewDefaultProvider(region string, ecsapi client.ECSClient, rateLimiter *ratelimit.RateLimiter, cache *cache.Cache) *DefaultProvider {
+	return &DefaultProvider{
+		region:      region,
+		ecsapi:      ecsapi,
+		rateLimiter: rateLimiter,
+		cache:       cache,
+		cm:          pretty.NewChangeMonitor(),
+	}
+}
+
+// Zones returns the usable zones of the region, the zones are described once and cached
+func (p *DefaultProvider) Zones(ctx context.Context) ([]string, error) {
+	// The lock keeps the concurrent callers from describing the zones more than once
+	p.Lock()
+	defer p.Unlock()
+
+	if zones, ok := p.cache.Get(p.region); ok {
+		return append([]string{}, zones.([]string)...), nil
+	}
+	output, err := ratelimit.CallIdempotent(ctx, p.rateLimiter, "DescribeZones", func() (*ecs.DescribeZonesResponse, error) {
+		return p.ecsapi.DescribeZonesWithOptions(&ecs.DescribeZonesRequest{
+			RegionId: tea.String(p.region),
+		}, &util.RuntimeOptions{})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing zones, %w", err)
+	} else if output == nil || output.Body == nil {
+		return nil, fmt.Errorf("unexpected null value was returned")
+	} else if output.Body.Zones == nil {
+		return nil, alierrors.WithRequestID(tea.StringValue(output.Body.RequestId), fmt.Errorf("unexpected null value was returned"))
+	}
+
+	// The zones closed for new instances, e.g. the retiring ones, are left out
+	zones := lo.FilterMap(output.Body.Zones.Zone, func(zone *ecs.DescribeZonesResponseBodyZonesZone, _ int) (string, bool) {
+		if zone == nil || zone.AvailableResourceCreation == nil {
+			return "", false
+		}
+		return tea.StringValue(zone.ZoneId), lo.Contains(tea.StringSliceValue(zone.AvailableResourceCreation.ResourceTypes), resourceTypeInstance)
+	})
+	sort.Strings(zones)
+	if len(zones) == 0 {
+		return nil, alierrors.WithRequestID(tea.StringValue(output.Body.RequestId), fmt.Errorf("no zones to create instances in were found in region %s", p.region))
+	}
+	if p.cm.HasChanged("zones", zones) {
+		logging.FromContext(ctx).WithValues("zones", zones).V(1).Info("discovered zones")
+	}
+	p.cache.SetDefault(p.region, zones)
+	return append([]string{}, zones...), nil
+}
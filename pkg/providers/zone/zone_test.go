@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package zone
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/fake"
+)
+
+func TestZones(t *testing.T) {
+	ecsAPI := fake.NewECSAPI()
+	ecsAPI.Seed(fake.ECSAPIState{Zones: []string{"cn-hangzhou-k", "cn-hangzhou-i", "cn-hangzhou-j"}})
+	p := NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute))
+
+	zones, err := p.Zones(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cn-hangzhou-i", "cn-hangzhou-j", "cn-hangzhou-k"}, zones)
+	require.Equal(t, 1, ecsAPI.DescribeZonesBehavior.Calls())
+	assert.Equal(t, fake.DefaultRegion, tea.StringValue(ecsAPI.DescribeZonesBehavior.Requests()[0].RegionId))
+
+	// the zones are cached, and the callers can't change the cached ones
+	zones[0] = "cn-hangzhou-z"
+	zones, err = p.Zones(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cn-hangzhou-i", "cn-hangzhou-j", "cn-hangzhou-k"}, zones)
+	assert.Equal(t, 1, ecsAPI.DescribeZonesBehavior.Calls())
+}
+
+func TestZonesSkipsClosedZones(t *testing.T) {
+	ecsAPI := fake.NewECSAPI()
+	ecsAPI.DescribeZonesBehavior.SetOutput(&ecs.DescribeZonesResponse{Body: &ecs.DescribeZonesResponseBody{
+		Zones: &ecs.DescribeZonesResponseBodyZones{Zone: []*ecs.DescribeZonesResponseBodyZonesZone{
+			{
+				ZoneId:                    tea.String("cn-hangzhou-i"),
+				AvailableResourceCreation: &ecs.DescribeZonesResponseBodyZonesZoneAvailableResourceCreation{ResourceTypes: tea.StringSlice([]string{"Instance", "Disk"})},
+			},
+			// the zone is closed for new instances
+			{
+				ZoneId:                    tea.String("cn-hangzhou-b"),
+				AvailableResourceCreation: &ecs.DescribeZonesResponseBodyZonesZoneAvailableResourceCreation{ResourceTypes: tea.StringSlice([]string{"Disk"})},
+			},
+			{ZoneId: tea.String("cn-hangzhou-c")},
+			nil,
+		}},
+	}})
+	p := NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute))
+
+	zones, err := p.Zones(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cn-hangzhou-i"}, zones)
+}
+
+func TestZonesErrors(t *testing.T) {
+	ecsAPI := fake.NewECSAPI()
+	ecsAPI.Seed(fake.ECSAPIState{})
+	p := NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute))
+
+	// a region without usable zones is an error and isn't cached
+	_, err := p.Zones(context.Background())
+	assert.Error(t, err)
+	ecsAPI.Reset()
+	zones, err := p.Zones(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, fake.DefaultZones, zones)
+
+	ecsAPI.DescribeZonesBehavior.SetError(&tea.SDKError{Code: tea.String("Forbidden.RAM"), StatusCode: tea.Int(403)})
+	p = NewDefaultProvider(fake.DefaultRegion, ecsAPI, nil, cache.New(time.Minute, time.Minute))
+	_, err = p.Zones(context.Background())
+	assert.Error(t, err)
+}
@@ -20,14 +20,93 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/alibabacloud-go/tea/tea"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	ErrCodeNoInstanceStock        = "NoInstanceStock"
+	ErrCodeOperationDeniedNoStock = "OperationDenied.NoStock"
+	ErrCodeZoneNotOnSale          = "Zone.NotOnSale"
+	// ErrCodeDeploymentSetNoCapacity means the deployment set can't place more instances in the zone
+	ErrCodeDeploymentSetNoCapacity = "DeploymentSet.NoCapacity"
+
+	ErrCodeInsufficientBalance = "InsufficientBalance"
+	ErrCodeNotEnoughBalance    = "InvalidAccountStatus.NotEnoughBalance"
+	ErrCodeAccountArrearage    = "Account.Arrearage"
+	ErrCodeForbiddenRAM        = "Forbidden.RAM"
+
+	// ErrCodeInvalidSpotPriceLimit prefixes the errors of a spot price limit ECS rejects, e.g. it's lower than
+	// the market price
+	ErrCodeInvalidSpotPriceLimit = "InvalidSpotPriceLimit"
+	// ErrCodeQuotaExceed prefixes the errors of a launch exceeding a quota of the account, e.g. the vCPUs of the
+	// pay-as-you-go instances
+	ErrCodeQuotaExceed = "QuotaExceed"
+	// ErrCodeInvalidRAMRole prefixes the errors of a RAM role ECS rejects, e.g. it doesn't exist or isn't trusted
+	// by ECS
+	ErrCodeInvalidRAMRole = "InvalidRamRole"
+
+	ErrCodeInstanceNotFound = "InvalidInstanceId.NotFound"
+	ErrCodeResourceNotFound = "InvalidResourceId.NotFound"
+
+	// ErrCodeIncorrectInstanceStatus means the instance can't be operated in its status yet, e.g. an elastic IP
+	// address can't be associated with a pending instance
+	ErrCodeIncorrectInstanceStatus = "IncorrectInstanceStatus"
+	// ErrCodeIncorrectEipStatus means the elastic IP address is being associated or unassociated
+	ErrCodeIncorrectEipStatus = "IncorrectEipStatus"
+	ErrCodeTaskConflict       = "TaskConflict"
+	// ErrCodeDryRunOperation means the dry run of the request passed, the request would have succeeded
+	ErrCodeDryRunOperation = "DryRunOperation"
+
+	ErrCodeThrottling         = "Throttling"
+	ErrCodeServiceUnavailable = "ServiceUnavailable"
+
+	ErrCodeInternalError               = "InternalError"
+	ErrCodeUnknownError                = "UnknownError"
+	ErrCodeServiceUnavailableTemporary = "ServiceUnavailableTemporary"
+)
+
+var (
+	// insufficientCapacityErrorCodes mean the offering is sold out, the launch can fall back to another offering
+	insufficientCapacityErrorCodes = sets.New(
+		ErrCodeNoInstanceStock,
+		ErrCodeOperationDeniedNoStock,
+		ErrCodeZoneNotOnSale,
+		ErrCodeDeploymentSetNoCapacity,
+	)
+	// notFoundErrorCodes mean the instance doesn't exist, e.g. it has been released out-of-band
+	notFoundErrorCodes = sets.New(
+		ErrCodeInstanceNotFound,
+		ErrCodeResourceNotFound,
+	)
+	// transientErrorCodes mean AlibabaCloud failed to serve the API call, retrying it may succeed
+	transientErrorCodes = sets.New(
+		ErrCodeInternalError,
+		ErrCodeUnknownError,
+		ErrCodeServiceUnavailableTemporary,
+	)
+	// incorrectStatusErrorCodes mean the resource is transitioning, retrying the operation once it's settled may succeed
+	incorrectStatusErrorCodes = sets.New(
+		ErrCodeIncorrectInstanceStatus,
+		ErrCodeIncorrectEipStatus,
+		ErrCodeTaskConflict,
+	)
+	// balanceErrorCodes mean the account doesn't have the balance to pay for the instances
+	balanceErrorCodes = sets.New(
+		ErrCodeInsufficientBalance,
+		ErrCodeNotEnoughBalance,
+		ErrCodeAccountArrearage,
+	)
+	// terminalErrorCodes mean no offering can be launched until the account is fixed by the user
+	terminalErrorCodes = balanceErrorCodes.Clone().Insert(ErrCodeForbiddenRAM)
 )
 
 func IsNotFound(err error) bool {
 	var sdkError *tea.SDKError
 	if errors.As(err, &sdkError) {
-		if *sdkError.StatusCode == http.StatusNotFound {
+		if tea.IntValue(sdkError.StatusCode) == http.StatusNotFound || notFoundErrorCodes.Has(tea.StringValue(sdkError.Code)) {
 			return true
 		}
 	}
@@ -35,6 +114,72 @@ func IsNotFound(err error) bool {
 	return false
 }
 
+// IsIncorrectStatus returns whether the operation is rejected because the resource is transitioning, e.g. the
+// instance is starting
+func IsIncorrectStatus(err error) bool {
+	return incorrectStatusErrorCodes.Has(ErrorCode(err))
+}
+
+// IsInsufficientCapacityCode returns whether the error code means the offering is out of stock
+func IsInsufficientCapacityCode(code string) bool {
+	return insufficientCapacityErrorCodes.Has(code)
+}
+
+// IsTerminalCode returns whether the error code fails every launch, retrying other offerings does not help
+func IsTerminalCode(code string) bool {
+	return terminalErrorCodes.Has(code)
+}
+
+// IsLaunchFailureCode returns whether the error code fails the launch of the NodeClaim, either because of the account
+// or because of the NodeClass, e.g. a spot price limit lower than the market price or a RAM role which doesn't exist
+func IsLaunchFailureCode(code string) bool {
+	return IsTerminalCode(code) || IsQuotaExceededCode(code) || strings.HasPrefix(code, ErrCodeInvalidSpotPriceLimit+".") ||
+		strings.HasPrefix(code, ErrCodeInvalidRAMRole+".")
+}
+
+// IsBalanceCode returns whether the error code means the account can't pay for the instances
+func IsBalanceCode(code string) bool {
+	return balanceErrorCodes.Has(code)
+}
+
+// IsUnauthorizedCode returns whether the error code means the credentials of karpenter aren't allowed to launch the
+// instances
+func IsUnauthorizedCode(code string) bool {
+	return code == ErrCodeForbiddenRAM
+}
+
+// IsQuotaExceededCode returns whether the error code means the launch exceeds a quota of the account, e.g.
+// QuotaExceed.ElasticQuota
+func IsQuotaExceededCode(code string) bool {
+	return strings.HasPrefix(code, ErrCodeQuotaExceed+".")
+}
+
+// IsThrottling returns whether the API call is rejected by the flow control of AlibabaCloud, e.g. Throttling.User,
+// retrying it later may succeed
+func IsThrottling(err error) bool {
+	code := ErrorCode(err)
+	return code == ErrCodeThrottling || strings.HasPrefix(code, ErrCodeThrottling+".") || code == ErrCodeServiceUnavailable
+}
+
+// IsRetryable returns whether the API call is throttled or failed by a transient server error of AlibabaCloud,
+// the errors of the request itself, e.g. the authorization or the parameters, are not retryable
+func IsRetryable(err error) bool {
+	if IsThrottling(err) {
+		return true
+	}
+	code := ErrorCode(err)
+	return transientErrorCodes.Has(code) || strings.HasPrefix(code, ErrCodeInternalError+".")
+}
+
+// ErrorCode returns the AlibabaCloud error code of an SDK error
+func ErrorCode(err error) string {
+	var sdkError *tea.SDKError
+	if errors.As(err, &sdkError) {
+		return tea.StringValue(sdkError.Code)
+	}
+	return ""
+}
+
 func WithRequestID(requestID string, err error) error {
 	if err == nil {
 		return nil
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	ackclient "github.com/alibabacloud-go/cs-20151215/v5/client"
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	vpc "github.com/alibabacloud-go/vpc-20160428/v6/client"
+)
+
+// The SDK clients implement the interfaces the providers depend on
+var (
+	_ ECSClient = (*ecs.Client)(nil)
+	_ VPCClient = (*vpc.Client)(nil)
+	_ ACKClient = (*ackclient.Client)(nil)
+)
+
+// ECSClient is the subset of the ECS API the providers call, it's implemented by the ECS SDK client
+// and by the in-memory fake of the tests
+type ECSClient interface {
+	AddTagsWithOptions(*ecs.AddTagsRequest, *util.RuntimeOptions) (*ecs.AddTagsResponse, error)
+	AssignIpv6AddressesWithOptions(*ecs.AssignIpv6AddressesRequest, *util.RuntimeOptions) (*ecs.AssignIpv6AddressesResponse, error)
+	CreateAutoProvisioningGroupWithOptions(*ecs.CreateAutoProvisioningGroupRequest, *util.RuntimeOptions) (*ecs.CreateAutoProvisioningGroupResponse, error)
+	CreateDeploymentSet(*ecs.CreateDeploymentSetRequest) (*ecs.CreateDeploymentSetResponse, error)
+	DeleteInstanceWithOptions(*ecs.DeleteInstanceRequest, *util.RuntimeOptions) (*ecs.DeleteInstanceResponse, error)
+	DescribeAccountAttributesWithOptions(*ecs.DescribeAccountAttributesRequest, *util.RuntimeOptions) (*ecs.DescribeAccountAttributesResponse, error)
+	DescribeAvailableResourceWithOptions(*ecs.DescribeAvailableResourceRequest, *util.RuntimeOptions) (*ecs.DescribeAvailableResourceResponse, error)
+	DescribeCapacityReservationsWithOptions(*ecs.DescribeCapacityReservationsRequest, *util.RuntimeOptions) (*ecs.DescribeCapacityReservationsResponse, error)
+	DescribeDedicatedHostsWithOptions(*ecs.DescribeDedicatedHostsRequest, *util.RuntimeOptions) (*ecs.DescribeDedicatedHostsResponse, error)
+	DescribeDeploymentSets(*ecs.DescribeDeploymentSetsRequest) (*ecs.DescribeDeploymentSetsResponse, error)
+	DescribeImages(*ecs.DescribeImagesRequest) (*ecs.DescribeImagesResponse, error)
+	DescribeInstanceTypesWithOptions(*ecs.DescribeInstanceTypesRequest, *util.RuntimeOptions) (*ecs.DescribeInstanceTypesResponse, error)
+	DescribeInstancesWithOptions(*ecs.DescribeInstancesRequest, *util.RuntimeOptions) (*ecs.DescribeInstancesResponse, error)
+	DescribeKeyPairsWithOptions(*ecs.DescribeKeyPairsRequest, *util.RuntimeOptions) (*ecs.DescribeKeyPairsResponse, error)
+	DescribeNetworkInterfacesWithOptions(*ecs.DescribeNetworkInterfacesRequest, *util.RuntimeOptions) (*ecs.DescribeNetworkInterfacesResponse, error)
+	DescribeSecurityGroupsWithOptions(*ecs.DescribeSecurityGroupsRequest, *util.RuntimeOptions) (*ecs.DescribeSecurityGroupsResponse, error)
+	DescribeZonesWithOptions(*ecs.DescribeZonesRequest, *util.RuntimeOptions) (*ecs.DescribeZonesResponse, error)
+	ModifyInstanceAttributeWithOptions(*ecs.ModifyInstanceAttributeRequest, *util.RuntimeOptions) (*ecs.ModifyInstanceAttributeResponse, error)
+	ModifyInstanceMetadataOptionsWithOptions(*ecs.ModifyInstanceMetadataOptionsRequest, *util.RuntimeOptions) (*ecs.ModifyInstanceMetadataOptionsResponse, error)
+	RemoveTagsWithOptions(*ecs.RemoveTagsRequest, *util.RuntimeOptions) (*ecs.RemoveTagsResponse, error)
+	RunInstancesWithOptions(*ecs.RunInstancesRequest, *util.RuntimeOptions) (*ecs.RunInstancesResponse, error)
+}
+
+// VPCClient is the subset of the VPC API the providers call
+type VPCClient interface {
+	AllocateEipAddressWithOptions(*vpc.AllocateEipAddressRequest, *util.RuntimeOptions) (*vpc.AllocateEipAddressResponse, error)
+	AssociateEipAddressWithOptions(*vpc.AssociateEipAddressRequest, *util.RuntimeOptions) (*vpc.AssociateEipAddressResponse, error)
+	DescribeEipAddressesWithOptions(*vpc.DescribeEipAddressesRequest, *util.RuntimeOptions) (*vpc.DescribeEipAddressesResponse, error)
+	ReleaseEipAddressWithOptions(*vpc.ReleaseEipAddressRequest, *util.RuntimeOptions) (*vpc.ReleaseEipAddressResponse, error)
+	DescribeVSwitchesWithOptions(*vpc.DescribeVSwitchesRequest, *util.RuntimeOptions) (*vpc.DescribeVSwitchesResponse, error)
+}
+
+// ACKClient is the subset of the ACK API the cluster provider calls
+type ACKClient interface {
+	DescribeClusterAttachScripts(*string, *ackclient.DescribeClusterAttachScriptsRequest) (*ackclient.DescribeClusterAttachScriptsResponse, error)
+	DescribeClusterDetail(*string) (*ackclient.DescribeClusterDetailResponse, error)
+	DescribeClusterNodePools(*string, *ackclient.DescribeClusterNodePoolsRequest) (*ackclient.DescribeClusterNodePoolsResponse, error)
+	DescribeClusterUserKubeconfig(*string, *ackclient.DescribeClusterUserKubeconfigRequest) (*ackclient.DescribeClusterUserKubeconfigResponse, error)
+	DescribeKubernetesVersionMetadata(*ackclient.DescribeKubernetesVersionMetadataRequest) (*ackclient.DescribeKubernetesVersionMetadataResponse, error)
+}
@@ -19,22 +19,25 @@ package client
 import (
 	"context"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
 	"github.com/alibabacloud-go/tea/tea"
 	"github.com/aliyun/credentials-go/credentials"
+	"github.com/samber/lo"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-func NewClientConfig(ctx context.Context, region string, network string) (*openapi.Config, error) {
-	// Load in the following order: 1. AK/SK, 2. RRSA, 3. config.json, 4. RAMRole
-	// https://www.alibabacloud.com/help/zh/sdk/developer-reference/v2-manage-go-access-credentials#3ca299f04bw3c
-	credential, err := credentials.NewCredential(nil)
+func NewClientConfig(ctx context.Context, region string, network string, credentialRefreshWindow time.Duration) (*openapi.Config, error) {
+	credential, err := newCredential(credentialRefreshWindow)
 	if err != nil {
 		return nil, err
 	}
 	if cred, err := credential.GetCredential(); err == nil && cred != nil {
-		log.FromContext(ctx).Info(fmt.Sprintf("using credential type: %s, AccessKeyID: %s", tea.StringValue(cred.Type), tea.StringValue(cred.AccessKeyId)))
+		log.FromContext(ctx).WithValues("credential-type", tea.StringValue(cred.Type), "access-key-id", redactAccessKeyID(tea.StringValue(cred.AccessKeyId))).
+			Info("using credential")
 	} else {
 		return nil, fmt.Errorf("failed get credential, error: %w", err)
 	}
@@ -45,3 +48,42 @@ func NewClientConfig(ctx context.Context, region string, network string) (*opena
 		Network:    tea.String(network), // 1. public, 2. vpc, default is public
 	}, nil
 }
+
+// newCredential returns the credential the SDK clients get the credentials from on every request.
+// Load in the following order: 1. AK/SK, 2. RRSA, 3. credentials URI, 4. config.json, 5. RAMRole
+// https://www.alibabacloud.com/help/zh/sdk/developer-reference/v2-manage-go-access-credentials#3ca299f04bw3c
+// The temporary credentials of RRSA and the RAM role of the instance are refreshed within the refresh window of their
+// expiration, the default chain of the SDK is used for the other sources.
+func newCredential(credentialRefreshWindow time.Duration) (credentials.Credential, error) {
+	switch {
+	case os.Getenv("ALIBABA_CLOUD_ACCESS_KEY_ID") != "":
+		return credentials.NewCredential(nil)
+	case os.Getenv("ALIBABA_CLOUD_ROLE_ARN") != "" && os.Getenv("ALIBABA_CLOUD_OIDC_TOKEN_FILE") != "":
+		provider, err := newOIDCCredentialsProvider(credentialRefreshWindow, nil)
+		if err != nil {
+			return nil, err
+		}
+		return credentials.FromCredentialsProvider(oidcProviderName, provider), nil
+	case lo.SomeBy([]string{
+		"ALIBABA_CLOUD_CREDENTIALS_URI",
+		"ALIBABA_CLOUD_PROFILE",
+		"ALIBABA_CLOUD_CREDENTIALS_FILE",
+	}, func(env string) bool { return os.Getenv(env) != "" }):
+		return credentials.NewCredential(nil)
+	default:
+		provider, err := newRAMRoleCredentialsProvider(credentialRefreshWindow, nil)
+		if err != nil {
+			return nil, err
+		}
+		return credentials.FromCredentialsProvider(ramRoleProviderName, provider), nil
+	}
+}
+
+// redactAccessKeyID keeps the first characters of an access key ID for the logs, enough to tell the keys apart
+// without logging the whole key
+func redactAccessKeyID(id string) string {
+	if len(id) <= 8 {
+		return strings.Repeat("*", len(id))
+	}
+	return id[:4] + strings.Repeat("*", len(id)-4)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/aliyun/credentials-go/credentials/providers"
+)
+
+const (
+	ramRoleProviderName = "ecs_ram_role"
+	oidcProviderName    = "oidc_role_arn"
+
+	// DefaultCredentialRefreshWindow is how long before their expiration the temporary credentials are refreshed,
+	// the SDK refreshes them as late
+	DefaultCredentialRefreshWindow = 3 * time.Minute
+
+	defaultRoleSessionName = "karpenter"
+)
+
+// lockedCredentialsProvider serializes the calls to a credentials provider of the SDK, which refreshes its cached
+// credentials without a lock while the SDK clients get them concurrently. The SDK refreshes the credentials 3 minutes
+// before they expire, the credentials within the refresh window of their expiration are fetched again by a new
+// provider of the SDK.
+type lockedCredentialsProvider struct {
+	mu            sync.Mutex
+	refreshWindow time.Duration
+	newProvider   func() (providers.CredentialsProvider, error)
+	provider      providers.CredentialsProvider
+	// refreshed is the expiration of the credentials fetched again last, the source keeps serving the same credentials
+	// until it rotates them, so they aren't fetched again on every call
+	refreshed time.Time
+}
+
+func newLockedCredentialsProvider(refreshWindow time.Duration, newProvider func() (providers.CredentialsProvider, error)) (*lockedCredentialsProvider, error) {
+	provider, err := newProvider()
+	if err != nil {
+		return nil, err
+	}
+	return &lockedCredentialsProvider{refreshWindow: refreshWindow, newProvider: newProvider, provider: provider}, nil
+}
+
+func (p *lockedCredentialsProvider) GetCredentials() (*providers.Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if expiration, ok := credentialsExpiration(p.provider); ok && !expiration.Equal(p.refreshed) && time.Until(expiration) <= p.refreshWindow {
+		// The cached credentials are still valid if they can't be fetched again, the refresh is retried on the next call
+		if provider, err := p.newProvider(); err == nil {
+			if credentials, err := provider.GetCredentials(); err == nil {
+				p.provider, p.refreshed = provider, expiration
+				return credentials, nil
+			}
+		}
+	}
+	return p.provider.GetCredentials()
+}
+
+func (p *lockedCredentialsProvider) GetProviderName() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.provider.GetProviderName()
+}
+
+// credentialsExpiration returns the expiration of the credentials cached by the provider of the SDK, which doesn't
+// expose it. It's false before the credentials are fetched, or if the provider doesn't cache an expiration.
+func credentialsExpiration(provider providers.CredentialsProvider) (time.Time, bool) {
+	v := reflect.ValueOf(provider)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return time.Time{}, false
+	}
+	field := v.Elem().FieldByName("expirationTimestamp")
+	if !field.IsValid() || field.Kind() != reflect.Int64 || field.Int() == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(field.Int(), 0), true
+}
+
+// newRAMRoleCredentialsProvider provides the temporary credentials of the RAM role attached to the instance, the SDK
+// reads them from the metadata service. The role is the one named by the ALIBABA_CLOUD_ECS_METADATA environment
+// variable, or else the one attached to the instance.
+func newRAMRoleCredentialsProvider(refreshWindow time.Duration, httpOptions *providers.HttpOptions) (providers.CredentialsProvider, error) {
+	provider, err := newLockedCredentialsProvider(refreshWindow, func() (providers.CredentialsProvider, error) {
+		return providers.NewECSRAMRoleCredentialsProviderBuilder().WithHttpOptions(httpOptions).Build()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating RAM role credentials provider, %w", err)
+	}
+	return provider, nil
+}
+
+// newOIDCCredentialsProvider provides the temporary credentials of the RAM role assumed through RRSA (RAM Roles for
+// Service Accounts). The SDK configures it from the environment variables injected by RRSA, and reads the projected
+// OIDC token again on every refresh so a rotated token is picked up.
+func newOIDCCredentialsProvider(refreshWindow time.Duration, httpOptions *providers.HttpOptions) (providers.CredentialsProvider, error) {
+	roleSessionName := os.Getenv("ALIBABA_CLOUD_ROLE_SESSION_NAME")
+	if roleSessionName == "" {
+		roleSessionName = defaultRoleSessionName
+	}
+	provider, err := newLockedCredentialsProvider(refreshWindow, func() (providers.CredentialsProvider, error) {
+		return providers.NewOIDCCredentialsProviderBuilder().WithRoleSessionName(roleSessionName).WithHttpOptions(httpOptions).Build()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating RRSA credentials provider, %w", err)
+	}
+	return provider, nil
+}
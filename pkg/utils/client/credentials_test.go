@@ -0,0 +1,201 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/aliyun/credentials-go/credentials/providers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeRAMRoleServer returns a metadata server that rotates the credentials of the role on every request,
+// the credentials expire after the given duration and a second later on every rotation. The SDK reaches it as the
+// proxy of the metadata service.
+func newFakeRAMRoleServer(expiresIn time.Duration) (*httptest.Server, *atomic.Int32) {
+	requests := &atomic.Int32{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			_, _ = w.Write([]byte("metadata-token"))
+		case "/latest/meta-data/ram/security-credentials/":
+			_, _ = w.Write([]byte("KarpenterRole"))
+		case "/latest/meta-data/ram/security-credentials/KarpenterRole":
+			n := requests.Add(1)
+			_, _ = fmt.Fprintf(w, `{"Code":"Success","AccessKeyId":"STS.key-%d","AccessKeySecret":"secret","SecurityToken":"token-%d","Expiration":%q}`,
+				n, n, time.Now().Add(expiresIn+time.Duration(n)*time.Second).UTC().Format("2006-01-02T15:04:05Z"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})), requests
+}
+
+func TestRAMRoleCredentialsProviderCachesCredentials(t *testing.T) {
+	server, requests := newFakeRAMRoleServer(time.Hour)
+	defer server.Close()
+	p, err := newRAMRoleCredentialsProvider(DefaultCredentialRefreshWindow, &providers.HttpOptions{Proxy: server.URL})
+	require.NoError(t, err)
+
+	for range 3 {
+		credentials, err := p.GetCredentials()
+		require.NoError(t, err)
+		assert.Equal(t, "STS.key-1", credentials.AccessKeyId)
+		assert.Equal(t, "token-1", credentials.SecurityToken)
+		assert.Equal(t, ramRoleProviderName, credentials.ProviderName)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestRAMRoleCredentialsProviderRefreshesCredentials(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		expiresIn     time.Duration
+		refreshWindow time.Duration
+		refreshed     bool
+	}{
+		// The credentials expire within the minutes the SDK refreshes them ahead of, so they are refreshed on every call
+		{name: "within the default window", expiresIn: time.Minute, refreshWindow: DefaultCredentialRefreshWindow, refreshed: true},
+		{name: "outside the default window", expiresIn: 10 * time.Minute, refreshWindow: DefaultCredentialRefreshWindow},
+		{name: "within the configured window", expiresIn: 10 * time.Minute, refreshWindow: 15 * time.Minute, refreshed: true},
+		{name: "outside the configured window", expiresIn: 10 * time.Minute, refreshWindow: 5 * time.Minute},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, requests := newFakeRAMRoleServer(tc.expiresIn)
+			defer server.Close()
+			p, err := newRAMRoleCredentialsProvider(tc.refreshWindow, &providers.HttpOptions{Proxy: server.URL})
+			require.NoError(t, err)
+
+			credentials, err := p.GetCredentials()
+			require.NoError(t, err)
+			assert.Equal(t, "token-1", credentials.SecurityToken)
+			credentials, err = p.GetCredentials()
+			require.NoError(t, err)
+			if !tc.refreshed {
+				assert.Equal(t, "token-1", credentials.SecurityToken)
+				assert.Equal(t, int32(1), requests.Load())
+				return
+			}
+			assert.Equal(t, "token-2", credentials.SecurityToken)
+			assert.Equal(t, ramRoleProviderName, credentials.ProviderName)
+			assert.Equal(t, int32(2), requests.Load())
+		})
+	}
+}
+
+func TestOIDCCredentialsProviderFromEnv(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token-1"), 0o600))
+
+	// the provider can't assume the role without the OIDC provider injected by RRSA
+	t.Setenv("ALIBABA_CLOUD_ACCESS_KEY_ID", "")
+	t.Setenv("ALIBABA_CLOUD_ROLE_ARN", "acs:ram::123:role/karpenter")
+	t.Setenv("ALIBABA_CLOUD_OIDC_TOKEN_FILE", tokenFile)
+	t.Setenv("ALIBABA_CLOUD_OIDC_PROVIDER_ARN", "")
+	_, err := newOIDCCredentialsProvider(DefaultCredentialRefreshWindow, nil)
+	assert.Error(t, err)
+
+	t.Setenv("ALIBABA_CLOUD_OIDC_PROVIDER_ARN", "acs:ram::123:oidc-provider/ack-rrsa")
+	p, err := newOIDCCredentialsProvider(DefaultCredentialRefreshWindow, nil)
+	require.NoError(t, err)
+	assert.Equal(t, oidcProviderName, p.GetProviderName())
+
+	// the credential of the SDK clients is selected from the same environment
+	credential, err := newCredential(DefaultCredentialRefreshWindow)
+	require.NoError(t, err)
+	assert.Equal(t, oidcProviderName, tea.StringValue(credential.GetType()))
+}
+
+// newFakeSTSServer returns a proxy tunneling the requests to an STS server which records the OIDC tokens the roles are
+// assumed with, the credentials expire within the minutes the SDK refreshes them ahead of. The SDK only reaches STS
+// over TLS, so the STS server certificate is trusted by the default transport the SDK clones.
+func newFakeSTSServer(t *testing.T) (*httptest.Server, *[]string) {
+	var received []string
+	sts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AssumeRoleWithOIDC", r.URL.Query().Get("Action"))
+		assert.Equal(t, "acs:ram::123:role/karpenter", r.FormValue("RoleArn"))
+		received = append(received, r.FormValue("OIDCToken"))
+		_, _ = fmt.Fprintf(w, `{"RequestId":"request-id","Credentials":{"AccessKeyId":"STS.key-%d","AccessKeySecret":"secret","SecurityToken":"sts-token-%d","Expiration":%q}}`,
+			len(received), len(received), time.Now().Add(time.Minute).UTC().Format("2006-01-02T15:04:05Z"))
+	}))
+	t.Cleanup(sts.Close)
+
+	transport := http.DefaultTransport.(*http.Transport)
+	tlsClientConfig := transport.TLSClientConfig
+	transport.TLSClientConfig = sts.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	// The certificate of the STS server is issued to example.com
+	transport.TLSClientConfig.ServerName = "example.com"
+	t.Cleanup(func() { transport.TLSClientConfig = tlsClientConfig })
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodConnect, r.Method)
+		upstream, err := net.Dial("tcp", sts.Listener.Addr().String())
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		go func() {
+			defer conn.Close()
+			_, _ = io.Copy(conn, upstream)
+		}()
+		go func() {
+			defer upstream.Close()
+			_, _ = io.Copy(upstream, conn)
+		}()
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy, &received
+}
+
+func TestOIDCCredentialsProviderTokenRotation(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token-1"), 0o600))
+	proxy, received := newFakeSTSServer(t)
+
+	t.Setenv("ALIBABA_CLOUD_ROLE_ARN", "acs:ram::123:role/karpenter")
+	t.Setenv("ALIBABA_CLOUD_OIDC_PROVIDER_ARN", "acs:ram::123:oidc-provider/ack-rrsa")
+	t.Setenv("ALIBABA_CLOUD_OIDC_TOKEN_FILE", tokenFile)
+	p, err := newOIDCCredentialsProvider(DefaultCredentialRefreshWindow, &providers.HttpOptions{Proxy: proxy.URL})
+	require.NoError(t, err)
+
+	credentials, err := p.GetCredentials()
+	require.NoError(t, err)
+	assert.Equal(t, "sts-token-1", credentials.SecurityToken)
+
+	// The projected token is rotated by the kubelet, the refresh assumes the role with the new one
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token-2"), 0o600))
+	credentials, err = p.GetCredentials()
+	require.NoError(t, err)
+	assert.Equal(t, "STS.key-2", credentials.AccessKeyId)
+	assert.Equal(t, []string{"token-1", "token-2"}, *received)
+}
+
+func TestRedactAccessKeyID(t *testing.T) {
+	assert.Equal(t, "LTAI****************", redactAccessKeyID("LTAI5tExampleKeyId12"))
+	assert.Equal(t, "******", redactAccessKeyID("short1"))
+	assert.Equal(t, "", redactAccessKeyID(""))
+}
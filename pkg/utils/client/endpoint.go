@@ -0,0 +1,59 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+
+	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	endpointutil "github.com/alibabacloud-go/endpoint-util/service"
+	"github.com/alibabacloud-go/tea/tea"
+)
+
+// The products of the AlibabaCloud services in their endpoints
+const (
+	ServiceECS = "ecs"
+	ServiceVPC = "vpc"
+	ServiceACK = "cs"
+)
+
+// ResolveEndpoint returns the endpoint of the service in the region, the override takes precedence when it's set.
+// Otherwise, the endpoint is derived from the region as <service>.<region>.aliyuncs.com, or
+// <service>-vpc.<region>.aliyuncs.com in the vpc network. The finance and government cloud regions use the central
+// <service>.aliyuncs.com endpoint in the public network.
+func ResolveEndpoint(service, region, network, override string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+	endpoint, err := endpointutil.GetEndpointRules(tea.String(service), tea.String(region),
+		tea.String(endpointType(PartitionForRegion(region), network)), tea.String(network), nil)
+	if err != nil {
+		return "", fmt.Errorf("resolving endpoint of %s, %w", service, err)
+	}
+	return tea.StringValue(endpoint), nil
+}
+
+// ServiceConfig returns a copy of the client config with the endpoint of the service resolved
+func ServiceConfig(config *openapi.Config, service, override string) (*openapi.Config, error) {
+	endpoint, err := ResolveEndpoint(service, tea.StringValue(config.RegionId), tea.StringValue(config.Network), override)
+	if err != nil {
+		return nil, err
+	}
+	serviceConfig := *config
+	serviceConfig.Endpoint = tea.String(endpoint)
+	return &serviceConfig, nil
+}
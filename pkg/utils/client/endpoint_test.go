@@ -0,0 +1,92 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+
+	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  string
+		region   string
+		network  string
+		override string
+		want     string
+		wantErr  bool
+	}{
+		{name: "ecs public", service: ServiceECS, region: "cn-hangzhou", want: "ecs.cn-hangzhou.aliyuncs.com"},
+		{name: "ecs public network", service: ServiceECS, region: "cn-hangzhou", network: "public", want: "ecs.cn-hangzhou.aliyuncs.com"},
+		{name: "vpc in the vpc network", service: ServiceVPC, region: "cn-beijing", network: "vpc", want: "vpc-vpc.cn-beijing.aliyuncs.com"},
+		{name: "ack", service: ServiceACK, region: "ap-southeast-1", want: "cs.ap-southeast-1.aliyuncs.com"},
+		{name: "override", service: ServiceECS, region: "cn-hangzhou", network: "vpc", override: "ecs.example.internal", want: "ecs.example.internal"},
+		{name: "finance", service: ServiceECS, region: "cn-shanghai-finance-1", want: "ecs.aliyuncs.com"},
+		{name: "finance in the vpc network", service: ServiceVPC, region: "cn-hangzhou-finance", network: "vpc", want: "vpc-vpc.cn-hangzhou-finance.aliyuncs.com"},
+		{name: "gov", service: ServiceACK, region: "cn-north-2-gov-1", network: "public", want: "cs.aliyuncs.com"},
+		{name: "missing region", service: ServiceECS, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveEndpoint(tt.service, tt.region, tt.network, tt.override)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServiceConfig(t *testing.T) {
+	config := &openapi.Config{
+		RegionId: tea.String("cn-shanghai"),
+		Network:  tea.String("vpc"),
+	}
+
+	ecsConfig, err := ServiceConfig(config, ServiceECS, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "ecs-vpc.cn-shanghai.aliyuncs.com", tea.StringValue(ecsConfig.Endpoint))
+
+	vpcConfig, err := ServiceConfig(config, ServiceVPC, "vpc.example.internal")
+	assert.NoError(t, err)
+	assert.Equal(t, "vpc.example.internal", tea.StringValue(vpcConfig.Endpoint))
+
+	// the shared config is left untouched
+	assert.Nil(t, config.Endpoint)
+}
+
+func TestPartitionForRegion(t *testing.T) {
+	for region, want := range map[string]string{
+		"cn-hangzhou":            PartitionPublic,
+		"ap-southeast-1":         PartitionPublic,
+		"cn-hangzhou-finance":    PartitionFinance,
+		"cn-shanghai-finance-1":  PartitionFinance,
+		"cn-beijing-finance-pop": PartitionFinance,
+		"cn-north-2-gov-1":       PartitionGov,
+		"cn-beijing-gov-1":       PartitionGov,
+	} {
+		assert.Equal(t, want, PartitionForRegion(region), region)
+	}
+	assert.True(t, PartitionSupportsSpot(PartitionForRegion("cn-hangzhou")))
+	assert.False(t, PartitionSupportsSpot(PartitionForRegion("cn-shenzhen-finance-1")))
+}
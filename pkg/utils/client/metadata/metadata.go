@@ -33,11 +33,15 @@ const (
 	regionID = "region-id"
 )
 
+// ErrNotFound is returned when the requested metadata does not exist
+var ErrNotFound = errors.New("metadata not found")
+
 // MetaData wrap http client
 type MetaData struct {
 	// mock for unit test.
-	mock   requestMock
-	client *http.Client
+	mock     requestMock
+	client   *http.Client
+	endpoint string
 }
 
 // NewMetaData returns MetaData
@@ -50,10 +54,17 @@ func NewMetaData(client *http.Client) *MetaData {
 	}
 }
 
+// WithEndpoint overrides the metadata endpoint, which defaults to the METADATA_ENDPOINT environment variable or Endpoint
+func (m *MetaData) WithEndpoint(endpoint string) *MetaData {
+	m.endpoint = endpoint
+	return m
+}
+
 // New returns MetaDataRequest
 func (m *MetaData) New() *MetaDataRequest {
 	return &MetaDataRequest{
 		client:      m.client,
+		endpoint:    m.endpoint,
 		sendRequest: m.mock,
 	}
 }
@@ -92,6 +103,7 @@ type MetaDataRequest struct {
 	resourceType string
 	resource     string
 	subResource  string
+	endpoint     string
 	client       *http.Client
 
 	sendRequest requestMock
@@ -132,7 +144,10 @@ func (r *MetaDataRequest) URL() (string, error) {
 	if r.resource == "" {
 		return "", errors.New("the resource you want to visit must not be nil")
 	}
-	endpoint := os.Getenv("METADATA_ENDPOINT")
+	endpoint := r.endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("METADATA_ENDPOINT")
+	}
 	if endpoint == "" {
 		endpoint = Endpoint
 	}
@@ -190,10 +205,13 @@ func (r *MetaDataRequest) send() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("aliyun Metadata API Error: %w, url=[%s]", ErrNotFound, url)
+	}
 	if resp.StatusCode != 200 {
 		return "", fmt.Errorf("aliyun Metadata API Error: Status Code: %d", resp.StatusCode)
 	}
-	defer resp.Body.Close()
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -0,0 +1,300 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"time"
+
+	ackclient "github.com/alibabacloud-go/cs-20151215/v5/client"
+	ecs "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	vpc "github.com/alibabacloud-go/vpc-20160428/v6/client"
+	opmetrics "github.com/awslabs/operatorpkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/karpenter/pkg/metrics"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+)
+
+const (
+	subsystem   = "alibabacloud"
+	actionLabel = "action"
+	resultLabel = "result"
+
+	ResultSuccess   = "success"
+	ResultThrottled = "throttled"
+	ResultError     = "error"
+)
+
+var (
+	APIRequests = opmetrics.NewPrometheusCounter(
+		crmetrics.Registry,
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "api_requests_total",
+			Help:      "Number of AlibabaCloud API requests, labeled by the API action and the result, one of success, throttled or error.",
+		},
+		[]string{actionLabel, resultLabel},
+	)
+	APIRequestDuration = opmetrics.NewPrometheusHistogram(
+		crmetrics.Registry,
+		prometheus.HistogramOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: subsystem,
+			Name:      "api_request_duration_seconds",
+			Help:      "Duration of the AlibabaCloud API requests in seconds, labeled by the API action.",
+			Buckets:   metrics.DurationBuckets(),
+		},
+		[]string{actionLabel},
+	)
+)
+
+// The decorators implement the interfaces they wrap
+var (
+	_ ECSClient = (*instrumentedECSClient)(nil)
+	_ VPCClient = (*instrumentedVPCClient)(nil)
+	_ ACKClient = (*instrumentedACKClient)(nil)
+)
+
+// observe calls the API action and records its duration and result
+func observe[O any](action string, call func() (O, error)) (O, error) {
+	start := time.Now()
+	out, err := call()
+	APIRequestDuration.Observe(time.Since(start).Seconds(), map[string]string{actionLabel: action})
+	result := ResultSuccess
+	if alierrors.IsThrottling(err) {
+		result = ResultThrottled
+	} else if err != nil {
+		result = ResultError
+	}
+	APIRequests.Inc(map[string]string{actionLabel: action, resultLabel: result})
+	return out, err
+}
+
+type instrumentedECSClient struct {
+	client ECSClient
+}
+
+// NewInstrumentedECSClient returns an ECS client recording the request metrics of every call
+func NewInstrumentedECSClient(client ECSClient) ECSClient {
+	return &instrumentedECSClient{client: client}
+}
+
+func (c *instrumentedECSClient) AddTagsWithOptions(request *ecs.AddTagsRequest, runtime *util.RuntimeOptions) (*ecs.AddTagsResponse, error) {
+	return observe("AddTags", func() (*ecs.AddTagsResponse, error) {
+		return c.client.AddTagsWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) AssignIpv6AddressesWithOptions(request *ecs.AssignIpv6AddressesRequest, runtime *util.RuntimeOptions) (*ecs.AssignIpv6AddressesResponse, error) {
+	return observe("AssignIpv6Addresses", func() (*ecs.AssignIpv6AddressesResponse, error) {
+		return c.client.AssignIpv6AddressesWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) CreateAutoProvisioningGroupWithOptions(request *ecs.CreateAutoProvisioningGroupRequest, runtime *util.RuntimeOptions) (*ecs.CreateAutoProvisioningGroupResponse, error) {
+	return observe("CreateAutoProvisioningGroup", func() (*ecs.CreateAutoProvisioningGroupResponse, error) {
+		return c.client.CreateAutoProvisioningGroupWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) CreateDeploymentSet(request *ecs.CreateDeploymentSetRequest) (*ecs.CreateDeploymentSetResponse, error) {
+	return observe("CreateDeploymentSet", func() (*ecs.CreateDeploymentSetResponse, error) {
+		return c.client.CreateDeploymentSet(request)
+	})
+}
+
+func (c *instrumentedECSClient) DeleteInstanceWithOptions(request *ecs.DeleteInstanceRequest, runtime *util.RuntimeOptions) (*ecs.DeleteInstanceResponse, error) {
+	return observe("DeleteInstance", func() (*ecs.DeleteInstanceResponse, error) {
+		return c.client.DeleteInstanceWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeAccountAttributesWithOptions(request *ecs.DescribeAccountAttributesRequest, runtime *util.RuntimeOptions) (*ecs.DescribeAccountAttributesResponse, error) {
+	return observe("DescribeAccountAttributes", func() (*ecs.DescribeAccountAttributesResponse, error) {
+		return c.client.DescribeAccountAttributesWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeAvailableResourceWithOptions(request *ecs.DescribeAvailableResourceRequest, runtime *util.RuntimeOptions) (*ecs.DescribeAvailableResourceResponse, error) {
+	return observe("DescribeAvailableResource", func() (*ecs.DescribeAvailableResourceResponse, error) {
+		return c.client.DescribeAvailableResourceWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeCapacityReservationsWithOptions(request *ecs.DescribeCapacityReservationsRequest, runtime *util.RuntimeOptions) (*ecs.DescribeCapacityReservationsResponse, error) {
+	return observe("DescribeCapacityReservations", func() (*ecs.DescribeCapacityReservationsResponse, error) {
+		return c.client.DescribeCapacityReservationsWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeDedicatedHostsWithOptions(request *ecs.DescribeDedicatedHostsRequest, runtime *util.RuntimeOptions) (*ecs.DescribeDedicatedHostsResponse, error) {
+	return observe("DescribeDedicatedHosts", func() (*ecs.DescribeDedicatedHostsResponse, error) {
+		return c.client.DescribeDedicatedHostsWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeDeploymentSets(request *ecs.DescribeDeploymentSetsRequest) (*ecs.DescribeDeploymentSetsResponse, error) {
+	return observe("DescribeDeploymentSets", func() (*ecs.DescribeDeploymentSetsResponse, error) {
+		return c.client.DescribeDeploymentSets(request)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeImages(request *ecs.DescribeImagesRequest) (*ecs.DescribeImagesResponse, error) {
+	return observe("DescribeImages", func() (*ecs.DescribeImagesResponse, error) {
+		return c.client.DescribeImages(request)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeInstanceTypesWithOptions(request *ecs.DescribeInstanceTypesRequest, runtime *util.RuntimeOptions) (*ecs.DescribeInstanceTypesResponse, error) {
+	return observe("DescribeInstanceTypes", func() (*ecs.DescribeInstanceTypesResponse, error) {
+		return c.client.DescribeInstanceTypesWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeInstancesWithOptions(request *ecs.DescribeInstancesRequest, runtime *util.RuntimeOptions) (*ecs.DescribeInstancesResponse, error) {
+	return observe("DescribeInstances", func() (*ecs.DescribeInstancesResponse, error) {
+		return c.client.DescribeInstancesWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeKeyPairsWithOptions(request *ecs.DescribeKeyPairsRequest, runtime *util.RuntimeOptions) (*ecs.DescribeKeyPairsResponse, error) {
+	return observe("DescribeKeyPairs", func() (*ecs.DescribeKeyPairsResponse, error) {
+		return c.client.DescribeKeyPairsWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeNetworkInterfacesWithOptions(request *ecs.DescribeNetworkInterfacesRequest, runtime *util.RuntimeOptions) (*ecs.DescribeNetworkInterfacesResponse, error) {
+	return observe("DescribeNetworkInterfaces", func() (*ecs.DescribeNetworkInterfacesResponse, error) {
+		return c.client.DescribeNetworkInterfacesWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeSecurityGroupsWithOptions(request *ecs.DescribeSecurityGroupsRequest, runtime *util.RuntimeOptions) (*ecs.DescribeSecurityGroupsResponse, error) {
+	return observe("DescribeSecurityGroups", func() (*ecs.DescribeSecurityGroupsResponse, error) {
+		return c.client.DescribeSecurityGroupsWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) DescribeZonesWithOptions(request *ecs.DescribeZonesRequest, runtime *util.RuntimeOptions) (*ecs.DescribeZonesResponse, error) {
+	return observe("DescribeZones", func() (*ecs.DescribeZonesResponse, error) {
+		return c.client.DescribeZonesWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) ModifyInstanceAttributeWithOptions(request *ecs.ModifyInstanceAttributeRequest, runtime *util.RuntimeOptions) (*ecs.ModifyInstanceAttributeResponse, error) {
+	return observe("ModifyInstanceAttribute", func() (*ecs.ModifyInstanceAttributeResponse, error) {
+		return c.client.ModifyInstanceAttributeWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) ModifyInstanceMetadataOptionsWithOptions(request *ecs.ModifyInstanceMetadataOptionsRequest, runtime *util.RuntimeOptions) (*ecs.ModifyInstanceMetadataOptionsResponse, error) {
+	return observe("ModifyInstanceMetadataOptions", func() (*ecs.ModifyInstanceMetadataOptionsResponse, error) {
+		return c.client.ModifyInstanceMetadataOptionsWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) RemoveTagsWithOptions(request *ecs.RemoveTagsRequest, runtime *util.RuntimeOptions) (*ecs.RemoveTagsResponse, error) {
+	return observe("RemoveTags", func() (*ecs.RemoveTagsResponse, error) {
+		return c.client.RemoveTagsWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedECSClient) RunInstancesWithOptions(request *ecs.RunInstancesRequest, runtime *util.RuntimeOptions) (*ecs.RunInstancesResponse, error) {
+	return observe("RunInstances", func() (*ecs.RunInstancesResponse, error) {
+		return c.client.RunInstancesWithOptions(request, runtime)
+	})
+}
+
+type instrumentedVPCClient struct {
+	client VPCClient
+}
+
+// NewInstrumentedVPCClient returns a VPC client recording the request metrics of every call
+func NewInstrumentedVPCClient(client VPCClient) VPCClient {
+	return &instrumentedVPCClient{client: client}
+}
+
+func (c *instrumentedVPCClient) AllocateEipAddressWithOptions(request *vpc.AllocateEipAddressRequest, runtime *util.RuntimeOptions) (*vpc.AllocateEipAddressResponse, error) {
+	return observe("AllocateEipAddress", func() (*vpc.AllocateEipAddressResponse, error) {
+		return c.client.AllocateEipAddressWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedVPCClient) AssociateEipAddressWithOptions(request *vpc.AssociateEipAddressRequest, runtime *util.RuntimeOptions) (*vpc.AssociateEipAddressResponse, error) {
+	return observe("AssociateEipAddress", func() (*vpc.AssociateEipAddressResponse, error) {
+		return c.client.AssociateEipAddressWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedVPCClient) DescribeEipAddressesWithOptions(request *vpc.DescribeEipAddressesRequest, runtime *util.RuntimeOptions) (*vpc.DescribeEipAddressesResponse, error) {
+	return observe("DescribeEipAddresses", func() (*vpc.DescribeEipAddressesResponse, error) {
+		return c.client.DescribeEipAddressesWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedVPCClient) ReleaseEipAddressWithOptions(request *vpc.ReleaseEipAddressRequest, runtime *util.RuntimeOptions) (*vpc.ReleaseEipAddressResponse, error) {
+	return observe("ReleaseEipAddress", func() (*vpc.ReleaseEipAddressResponse, error) {
+		return c.client.ReleaseEipAddressWithOptions(request, runtime)
+	})
+}
+
+func (c *instrumentedVPCClient) DescribeVSwitchesWithOptions(request *vpc.DescribeVSwitchesRequest, runtime *util.RuntimeOptions) (*vpc.DescribeVSwitchesResponse, error) {
+	return observe("DescribeVSwitches", func() (*vpc.DescribeVSwitchesResponse, error) {
+		return c.client.DescribeVSwitchesWithOptions(request, runtime)
+	})
+}
+
+type instrumentedACKClient struct {
+	client ACKClient
+}
+
+// NewInstrumentedACKClient returns an ACK client recording the request metrics of every call
+func NewInstrumentedACKClient(client ACKClient) ACKClient {
+	return &instrumentedACKClient{client: client}
+}
+
+func (c *instrumentedACKClient) DescribeClusterAttachScripts(clusterID *string, request *ackclient.DescribeClusterAttachScriptsRequest) (*ackclient.DescribeClusterAttachScriptsResponse, error) {
+	return observe("DescribeClusterAttachScripts", func() (*ackclient.DescribeClusterAttachScriptsResponse, error) {
+		return c.client.DescribeClusterAttachScripts(clusterID, request)
+	})
+}
+
+func (c *instrumentedACKClient) DescribeClusterDetail(clusterID *string) (*ackclient.DescribeClusterDetailResponse, error) {
+	return observe("DescribeClusterDetail", func() (*ackclient.DescribeClusterDetailResponse, error) {
+		return c.client.DescribeClusterDetail(clusterID)
+	})
+}
+
+func (c *instrumentedACKClient) DescribeClusterNodePools(clusterID *string, request *ackclient.DescribeClusterNodePoolsRequest) (*ackclient.DescribeClusterNodePoolsResponse, error) {
+	return observe("DescribeClusterNodePools", func() (*ackclient.DescribeClusterNodePoolsResponse, error) {
+		return c.client.DescribeClusterNodePools(clusterID, request)
+	})
+}
+
+func (c *instrumentedACKClient) DescribeClusterUserKubeconfig(clusterID *string, request *ackclient.DescribeClusterUserKubeconfigRequest) (*ackclient.DescribeClusterUserKubeconfigResponse, error) {
+	return observe("DescribeClusterUserKubeconfig", func() (*ackclient.DescribeClusterUserKubeconfigResponse, error) {
+		return c.client.DescribeClusterUserKubeconfig(clusterID, request)
+	})
+}
+
+func (c *instrumentedACKClient) DescribeKubernetesVersionMetadata(request *ackclient.DescribeKubernetesVersionMetadataRequest) (*ackclient.DescribeKubernetesVersionMetadataResponse, error) {
+	return observe("DescribeKubernetesVersionMetadata", func() (*ackclient.DescribeKubernetesVersionMetadataResponse, error) {
+		return c.client.DescribeKubernetesVersionMetadata(request)
+	})
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client_test
+
+import (
+	"testing"
+
+	"github.com/alibabacloud-go/tea/tea"
+	vpc "github.com/alibabacloud-go/vpc-20160428/v6/client"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/fake"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/client"
+)
+
+// apiRequests returns the number of requests of the action with the result
+func apiRequests(t *testing.T, action, result string) float64 {
+	families, err := crmetrics.Registry.Gather()
+	require.NoError(t, err)
+	family, ok := lo.Find(families, func(family *dto.MetricFamily) bool {
+		return family.GetName() == "karpenter_alibabacloud_api_requests_total"
+	})
+	if !ok {
+		return 0
+	}
+	metric, ok := lo.Find(family.GetMetric(), func(metric *dto.Metric) bool {
+		labels := lo.SliceToMap(metric.GetLabel(), func(label *dto.LabelPair) (string, string) {
+			return label.GetName(), label.GetValue()
+		})
+		return labels["action"] == action && labels["result"] == result
+	})
+	if !ok {
+		return 0
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func TestInstrumentedVPCClient(t *testing.T) {
+	vpcAPI := fake.NewVPCAPI()
+	vpcClient := client.NewInstrumentedVPCClient(vpcAPI)
+	succeeded := apiRequests(t, "DescribeVSwitches", client.ResultSuccess)
+	throttled := apiRequests(t, "DescribeVSwitches", client.ResultThrottled)
+	failed := apiRequests(t, "DescribeVSwitches", client.ResultError)
+
+	_, err := vpcClient.DescribeVSwitchesWithOptions(&vpc.DescribeVSwitchesRequest{}, nil)
+	require.NoError(t, err)
+	vpcAPI.DescribeVSwitchesBehavior.SetError(&tea.SDKError{Code: tea.String(alierrors.ErrCodeThrottling)})
+	_, err = vpcClient.DescribeVSwitchesWithOptions(&vpc.DescribeVSwitchesRequest{}, nil)
+	assert.True(t, alierrors.IsThrottling(err))
+	vpcAPI.DescribeVSwitchesBehavior.SetError(&tea.SDKError{Code: tea.String("Forbidden.RAM")})
+	_, err = vpcClient.DescribeVSwitchesWithOptions(&vpc.DescribeVSwitchesRequest{}, nil)
+	assert.Error(t, err)
+
+	assert.Equal(t, succeeded+1, apiRequests(t, "DescribeVSwitches", client.ResultSuccess))
+	assert.Equal(t, throttled+1, apiRequests(t, "DescribeVSwitches", client.ResultThrottled))
+	assert.Equal(t, failed+1, apiRequests(t, "DescribeVSwitches", client.ResultError))
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"regexp"
+)
+
+// The partitions of the AlibabaCloud regions
+const (
+	PartitionPublic  = "aliyun"
+	PartitionFinance = "finance"
+	PartitionGov     = "gov"
+)
+
+var (
+	// financeRegionPattern matches the finance cloud regions, e.g. cn-hangzhou-finance, cn-shanghai-finance-1
+	// or cn-beijing-finance-pop
+	financeRegionPattern = regexp.MustCompile(`^[a-z]+-[a-z0-9]+-finance(-[a-z0-9]+)?$`)
+	// govRegionPattern matches the government cloud regions, e.g. cn-north-2-gov-1 or cn-beijing-gov-1
+	govRegionPattern = regexp.MustCompile(`^[a-z]+(-[a-z0-9]+)+-gov-[0-9]+$`)
+)
+
+// PartitionForRegion returns the partition of the region, the regions which are neither finance nor government
+// cloud regions are in the public cloud
+func PartitionForRegion(region string) string {
+	switch {
+	case financeRegionPattern.MatchString(region):
+		return PartitionFinance
+	case govRegionPattern.MatchString(region):
+		return PartitionGov
+	default:
+		return PartitionPublic
+	}
+}
+
+// PartitionSupportsSpot returns whether every region of the partition offers spot instances. Some of the finance
+// and government cloud regions don't, so no spot offerings is expected there.
+func PartitionSupportsSpot(partition string) bool {
+	return partition == PartitionPublic
+}
+
+// endpointType returns the type of the endpoints of the services in the partition. The services of the finance
+// and government cloud are reached at their central endpoints from the public network, see the endpoint maps of the SDKs.
+func endpointType(partition, network string) string {
+	if partition != PartitionPublic && (network == "" || network == "public") {
+		return "central"
+	}
+	return "regional"
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+)
+
+// FromContext returns the logger of the context with the region and the cluster of the options, so the logs of
+// the controllers of different clusters and regions can be told apart. Only the identifiers are added, the
+// options never carry the credentials
+func FromContext(ctx context.Context) logr.Logger {
+	logger := log.FromContext(ctx)
+	if o := options.FromContext(ctx); o != nil {
+		logger = logger.WithValues("region", o.RegionID, "cluster-id", o.ClusterID)
+	}
+	return logger
+}
+
+// ForNodeClaim returns the logger of FromContext with the NodeClaim, and the zone of its instance once it's known
+func ForNodeClaim(ctx context.Context, nodeClaim *karpv1.NodeClaim) logr.Logger {
+	logger := FromContext(ctx)
+	if nodeClaim == nil {
+		return logger
+	}
+	logger = logger.WithValues("nodeclaim", nodeClaim.Name)
+	if zone, ok := nodeClaim.Labels[corev1.LabelTopologyZone]; ok {
+		logger = logger.WithValues("zone", zone)
+	}
+	return logger
+}
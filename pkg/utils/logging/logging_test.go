@@ -0,0 +1,50 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	karpv1 "sigs.k8s.io/karpenter/pkg/apis/v1"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/operator/options"
+)
+
+func TestForNodeClaim(t *testing.T) {
+	var entries []string
+	logger := funcr.New(func(prefix, args string) { entries = append(entries, args) }, funcr.Options{})
+	ctx := log.IntoContext(context.Background(), logger)
+	ctx = options.ToContext(ctx, &options.Options{RegionID: "cn-hangzhou", ClusterID: "c1234567890"})
+
+	ForNodeClaim(ctx, &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:   "default-abcde",
+		Labels: map[string]string{corev1.LabelTopologyZone: "cn-hangzhou-k"},
+	}}).Info("launched instance")
+	ForNodeClaim(ctx, &karpv1.NodeClaim{ObjectMeta: metav1.ObjectMeta{Name: "default-fghij"}}).Info("launching instance")
+	FromContext(context.Background()).Info("no options")
+
+	assert.Equal(t, []string{
+		`"level"=0 "msg"="launched instance" "region"="cn-hangzhou" "cluster-id"="c1234567890" "nodeclaim"="default-abcde" "zone"="cn-hangzhou-k"`,
+		`"level"=0 "msg"="launching instance" "region"="cn-hangzhou" "cluster-id"="c1234567890" "nodeclaim"="default-fghij"`,
+	}, entries)
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pkg/utils/alierrors"
+)
+
+const (
+	// DefaultQPS is the rate limit of the API actions without a configured limit
+	DefaultQPS = 20
+	// DefaultMaxRetries is how many times a throttled API call is retried
+	DefaultMaxRetries = 3
+
+	baseBackoff = 200 * time.Millisecond
+	maxBackoff  = 5 * time.Second
+)
+
+// RateLimiter limits the rate of the AlibabaCloud API calls with a token bucket per API action, which is shared by
+// all the providers, and retries the calls throttled or failed transiently by AlibabaCloud with a jittered
+// exponential backoff.
+// A nil RateLimiter doesn't limit nor retry the calls.
+type RateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+
+	limits     map[string]float64
+	defaultQPS float64
+	maxRetries int
+	backoff    time.Duration
+}
+
+func NewRateLimiter(limits map[string]float64, defaultQPS float64, maxRetries int) *RateLimiter {
+	return &RateLimiter{
+		limiters:   map[string]*rate.Limiter{},
+		limits:     limits,
+		defaultQPS: defaultQPS,
+		maxRetries: maxRetries,
+		backoff:    baseBackoff,
+	}
+}
+
+func (r *RateLimiter) limiter(action string) *rate.Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l, ok := r.limiters[action]; ok {
+		return l
+	}
+	qps, ok := r.limits[action]
+	if !ok {
+		qps = r.defaultQPS
+	}
+	l := rate.NewLimiter(rate.Limit(qps), max(int(qps), 1))
+	r.limiters[action] = l
+	return l
+}
+
+// Wait blocks until the API action is allowed by its rate limit
+func (r *RateLimiter) Wait(ctx context.Context, action string) error {
+	if r == nil {
+		return nil
+	}
+	if err := r.limiter(action).Wait(ctx); err != nil {
+		return fmt.Errorf("waiting for the rate limit of %s, %w", action, err)
+	}
+	return nil
+}
+
+// backoffFor returns the jittered backoff of the retry, between the half and the whole of the exponential backoff
+func (r *RateLimiter) backoffFor(retry int) time.Duration {
+	backoff := min(r.backoff<<retry, maxBackoff)
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// Call calls the API action within its rate limit, the call is retried when it's throttled by AlibabaCloud
+func Call[T any](ctx context.Context, r *RateLimiter, action string, call func() (T, error)) (T, error) {
+	return retryCall(ctx, r, action, alierrors.IsThrottling, call)
+}
+
+// CallIdempotent calls the API action within its rate limit like Call, the call is also retried on the transient
+// server errors of AlibabaCloud, e.g. InternalError. It must only be used for the API actions that can be repeated
+// safely, e.g. the describe actions.
+func CallIdempotent[T any](ctx context.Context, r *RateLimiter, action string, call func() (T, error)) (T, error) {
+	return retryCall(ctx, r, action, alierrors.IsRetryable, call)
+}
+
+func retryCall[T any](ctx context.Context, r *RateLimiter, action string, retryable func(error) bool, call func() (T, error)) (T, error) {
+	if r == nil {
+		return call()
+	}
+	for retry := 0; ; retry++ {
+		if err := r.Wait(ctx, action); err != nil {
+			var zero T
+			return zero, err
+		}
+		resp, err := call()
+		if err == nil || !retryable(err) {
+			return resp, err
+		}
+		if alierrors.IsThrottling(err) {
+			ThrottledCalls.Inc(map[string]string{actionLabel: action})
+		}
+		if retry >= r.maxRetries {
+			return resp, err
+		}
+		RetriedCalls.Inc(map[string]string{actionLabel: action, codeLabel: alierrors.ErrorCode(err)})
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(r.backoffFor(retry)):
+		}
+	}
+}
+
+// ParseLimits parses the rate limits of the API actions in the format of Action=QPS[,Action=QPS...]
+func ParseLimits(s string) (map[string]float64, error) {
+	limits := map[string]float64{}
+	for _, limit := range strings.Split(s, ",") {
+		limit = strings.TrimSpace(limit)
+		if limit == "" {
+			continue
+		}
+		action, value, ok := strings.Cut(limit, "=")
+		if !ok || strings.TrimSpace(action) == "" {
+			return nil, fmt.Errorf("invalid rate limit %q, expected Action=QPS", limit)
+		}
+		qps, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || qps <= 0 {
+			return nil, fmt.Errorf("invalid rate limit %q, QPS must be a positive number", limit)
+		}
+		limits[strings.TrimSpace(action)] = qps
+	}
+	return limits, nil
+}
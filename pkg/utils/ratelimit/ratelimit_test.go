@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallCapsRate(t *testing.T) {
+	r := NewRateLimiter(map[string]float64{"DescribeInstances": 10}, 1000, 0)
+
+	start := time.Now()
+	for i := 0; i < 15; i++ {
+		_, err := Call(context.Background(), r, "DescribeInstances", func() (struct{}, error) { return struct{}{}, nil })
+		assert.NoError(t, err)
+	}
+	// the burst of 10 is used up, the other 5 calls wait 100ms each
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	// the other actions have their own token bucket
+	start = time.Now()
+	for i := 0; i < 15; i++ {
+		_, err := Call(context.Background(), r, "DescribeVSwitches", func() (struct{}, error) { return struct{}{}, nil })
+		assert.NoError(t, err)
+	}
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestCallRetriesThrottling(t *testing.T) {
+	throttled := &tea.SDKError{Code: tea.String("Throttling.User"), StatusCode: tea.Int(400)}
+
+	tests := []struct {
+		name       string
+		errs       []error
+		maxRetries int
+		wantCalls  int
+		wantErr    error
+	}{
+		{name: "succeeds after throttling", errs: []error{throttled, throttled, nil}, maxRetries: 3, wantCalls: 3},
+		{name: "gives up after max retries", errs: []error{throttled, throttled, throttled}, maxRetries: 2, wantCalls: 3, wantErr: throttled},
+		{name: "other errors are not retried", errs: []error{errors.New("boom"), nil}, maxRetries: 3, wantCalls: 1, wantErr: errors.New("boom")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRateLimiter(nil, 1000, tt.maxRetries)
+			r.backoff = time.Millisecond
+
+			calls := 0
+			_, err := Call(context.Background(), r, "DescribeInstances", func() (int, error) {
+				err := tt.errs[calls]
+				calls++
+				return calls, err
+			})
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestCallIdempotentRetriesTransientErrors(t *testing.T) {
+	internal := &tea.SDKError{Code: tea.String("InternalError"), StatusCode: tea.Int(500)}
+	forbidden := &tea.SDKError{Code: tea.String("Forbidden.RAM"), StatusCode: tea.Int(403)}
+	invalid := &tea.SDKError{Code: tea.String("InvalidParameter"), StatusCode: tea.Int(400)}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "succeeds after transient errors", errs: []error{internal, &tea.SDKError{Code: tea.String("ServiceUnavailable")}, nil}, wantCalls: 3},
+		{name: "gives up after max retries", errs: []error{internal, internal, internal, internal}, wantCalls: 4, wantErr: internal},
+		{name: "authorization errors are not retried", errs: []error{forbidden, nil}, wantCalls: 1, wantErr: forbidden},
+		{name: "parameter errors are not retried", errs: []error{invalid, nil}, wantCalls: 1, wantErr: invalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRateLimiter(nil, 1000, 3)
+			r.backoff = time.Millisecond
+
+			calls := 0
+			_, err := CallIdempotent(context.Background(), r, "DescribeVSwitches", func() (int, error) {
+				err := tt.errs[calls]
+				calls++
+				return calls, err
+			})
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+
+	// the transient errors are only retried for the idempotent calls
+	r := NewRateLimiter(nil, 1000, 3)
+	calls := 0
+	_, err := Call(context.Background(), r, "CreateAutoProvisioningGroup", func() (int, error) {
+		calls++
+		return calls, internal
+	})
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, internal, err)
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits("DescribeInstances=10, DescribeVSwitches=2.5,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"DescribeInstances": 10, "DescribeVSwitches": 2.5}, limits)
+
+	for _, s := range []string{"DescribeInstances", "=10", "DescribeInstances=0", "DescribeInstances=abc"} {
+		_, err := ParseLimits(s)
+		assert.Error(t, err, s)
+	}
+}
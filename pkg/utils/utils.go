@@ -32,21 +32,21 @@ import (
 
 // alibabacloud ack node spec providerID format, ref: https://github.com/cloudpilot-ai/karpenter-provider-alibabacloud/pull/35#discussion_r1794805184
 // eg: cn-zhangjiakou.i-xxxx
-var instanceIDRegex = regexp.MustCompile(`(?P<AZ>.*)\.(?P<InstanceID>.*)`)
+var providerIDRegex = regexp.MustCompile(`^(?P<Region>[^.\s]+)\.(?P<InstanceID>[^.\s]+)$`)
 
-// ParseInstanceID parses the provider ID stored on the node to get the instance ID
+// ParseProviderID parses the provider ID stored on the node to get the region and the instance ID
 // associated with a node
-func ParseInstanceID(providerID string) (string, error) {
-	matches := instanceIDRegex.FindStringSubmatch(providerID)
+func ParseProviderID(providerID string) (region, instanceID string, err error) {
+	matches := providerIDRegex.FindStringSubmatch(providerID)
 	if matches == nil {
-		return "", fmt.Errorf("parsing instance id %s", providerID)
+		return "", "", fmt.Errorf("malformed provider id %q, expected <region>.<instance-id>", providerID)
 	}
-	for i, name := range instanceIDRegex.SubexpNames() {
-		if name == "InstanceID" {
-			return matches[i], nil
-		}
-	}
-	return "", fmt.Errorf("parsing instance id %s", providerID)
+	return matches[providerIDRegex.SubexpIndex("Region")], matches[providerIDRegex.SubexpIndex("InstanceID")], nil
+}
+
+// FormatProviderID returns the provider ID of the node of an instance, it's the inverse of ParseProviderID
+func FormatProviderID(region, instanceID string) string {
+	return fmt.Sprintf("%s.%s", region, instanceID)
 }
 
 // ParseISO8601 parses the given time string into a time.Time object
@@ -107,3 +107,12 @@ func GetCapacityTypes(spotStrategy string) string {
 func Hash(str string) string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(str)))
 }
+
+// InstanceFamily returns the family of the instance type, e.g. ecs.gn6i for ecs.gn6i-c4g1.xlarge
+func InstanceFamily(instanceType string) string {
+	parts := strings.Split(instanceType, ".")
+	if len(parts) < 2 {
+		return instanceType
+	}
+	return strings.Join(parts[0:2], ".")
+}
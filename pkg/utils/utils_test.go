@@ -0,0 +1,39 @@
+/*
+Copyright 2024 The CloudPilot AI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderID(t *testing.T) {
+	providerID := FormatProviderID("cn-hangzhou", "i-bp1234567890")
+	assert.Equal(t, "cn-hangzhou.i-bp1234567890", providerID)
+	region, instanceID, err := ParseProviderID(providerID)
+	require.NoError(t, err)
+	assert.Equal(t, "cn-hangzhou", region)
+	assert.Equal(t, "i-bp1234567890", instanceID)
+
+	for _, providerID := range []string{"", ".", "i-bp1234567890", "cn-hangzhou.", ".i-bp1234567890",
+		"cn-hangzhou.i-bp1234567890.", "cn.hangzhou.i-bp1234567890", "cn-hangzhou.i-bp12 34567890"} {
+		_, _, err := ParseProviderID(providerID)
+		assert.Error(t, err, providerID)
+	}
+}